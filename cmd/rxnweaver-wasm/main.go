@@ -0,0 +1,257 @@
+//go:build js && wasm
+
+// Command rxnweaver-wasm exposes the handling of structures to
+// JavaScript, when built for WebAssembly:
+//
+//	GOOS=js GOARCH=wasm go build -o rxnweaver.wasm ./cmd/rxnweaver-wasm
+//
+// It is loaded with the `wasm_exec.js` support file of the Go
+// distribution, and defines a global object `rxnweaver` with the
+// following functions.  Each takes the text of a molecule, and the name
+// of its format: `smi` or `mol`, an SD record being read as the latter.
+//
+//	rxnweaver.parse(text, format)
+//	    answers {formula, smiles, atoms, bonds, attributes}, the atoms
+//	    and bonds being as in the JSON API of package `server`.
+//	rxnweaver.canonicalize(text, format)
+//	    answers {formula, hash, fullHash}, as in the JSON API.
+//	rxnweaver.depict(text, format, options)
+//	    answers the PNG of a depiction, as a `Uint8Array`.  The options,
+//	    which may be omitted, are any of {width, height, dpi, scale,
+//	    transparent}; see `render.Options`.
+//
+// Failures are answered as {error}, rather than thrown.
+//
+// Molecules are passive, and live only for the duration of a call, so
+// that no goroutines run in the background, and no molecules are held
+// in registries.  The functions are synchronous, and run on the thread
+// of the caller; they are meant for a molecule at a time, as a user
+// draws or pastes it.
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"syscall/js"
+
+	"github.com/RxnWeaver/rxnweaver/data/loader"
+	"github.com/RxnWeaver/rxnweaver/data/molecule"
+	"github.com/RxnWeaver/rxnweaver/data/render"
+)
+
+// Seed of the embedding of molecules without coordinates, so that
+// depictions are reproducible.
+const embedSeed = 1
+
+func main() {
+	js.Global().Set("rxnweaver", js.ValueOf(map[string]interface{}{
+		"parse":        js.FuncOf(withMolecule(parse)),
+		"canonicalize": js.FuncOf(withMolecule(canonicalize)),
+		"depict":       js.FuncOf(withMolecule(depict)),
+	}))
+
+	// The functions are called for as long as the page lives.
+	select {}
+}
+
+// withMolecule answers a JavaScript function that reads the molecule
+// given by its first two arguments, and answers the result of the
+// given function on it, and the remaining arguments.  The molecule is
+// released afterwards.
+func withMolecule(f func(mol *molecule.Molecule, args []js.Value) (interface{}, error)) func(this js.Value, args []js.Value) interface{} {
+	return func(this js.Value, args []js.Value) interface{} {
+		if len(args) < 2 || args[0].Type() != js.TypeString || args[1].Type() != js.TypeString {
+			return failure(fmt.Errorf("Expected the text of a molecule, and its format."))
+		}
+
+		mol, err := read(args[0].String(), args[1].String())
+		if err != nil {
+			return failure(err)
+		}
+		defer mol.Release()
+
+		res, err := f(mol, args[2:])
+		if err != nil {
+			return failure(err)
+		}
+		return res
+	}
+}
+
+// failure answers the JavaScript form of the given error.
+func failure(err error) interface{} {
+	return map[string]interface{}{"error": err.Error()}
+}
+
+// read answers the sanitised, passive molecule of the given text, in
+// the given format.
+func read(text, format string) (*molecule.Molecule, error) {
+	var parse loader.ParseFunc
+	switch format {
+	case "smi", "smiles":
+		parse = loader.SmilesParser(nil)
+	case "mol", "sdf":
+		parse = loader.MolfileParser(nil)
+	default:
+		return nil, fmt.Errorf("Unknown format : %q", format)
+	}
+
+	mol, err := loader.Sanitized(parse, 0)([]byte(text))
+	if err != nil && mol != nil {
+		mol.Release()
+	}
+	return mol, err
+}
+
+// parse answers the JavaScript form of the given molecule.
+func parse(mol *molecule.Molecule, _ []js.Value) (interface{}, error) {
+	smi, err := loader.Smiles(mol)
+	if err != nil {
+		return nil, err
+	}
+
+	atoms := []interface{}{}
+	it := mol.Atoms()
+	for it.Next() {
+		a := it.Atom()
+		atoms = append(atoms, map[string]interface{}{
+			"id":       int(a.Iid),
+			"symbol":   a.Symbol,
+			"charge":   int(a.Charge),
+			"isotope":  int(a.Isotope),
+			"x":        float64(a.X),
+			"y":        float64(a.Y),
+			"z":        float64(a.Z),
+			"hCount":   int(a.HCount),
+			"aromatic": a.IsAromatic,
+		})
+	}
+	if err := it.Err(); err != nil {
+		return nil, err
+	}
+
+	bonds := []interface{}{}
+	bit := mol.Bonds()
+	for bit.Next() {
+		b := bit.Bond()
+		bonds = append(bonds, map[string]interface{}{
+			"id":       int(b.Id),
+			"a1":       int(b.A1),
+			"a2":       int(b.A2),
+			"order":    int(b.Type),
+			"stereo":   int(b.Stereo),
+			"aromatic": b.IsAromatic,
+		})
+	}
+	if err := bit.Err(); err != nil {
+		return nil, err
+	}
+
+	attrs, err := mol.Attributes()
+	if err != nil {
+		return nil, err
+	}
+	jattrs := make(map[string]interface{}, len(attrs))
+	for _, attr := range attrs {
+		jattrs[attr.Name] = attr.Value
+	}
+
+	return map[string]interface{}{
+		"formula":    mol.Formula(),
+		"smiles":     smi,
+		"atoms":      atoms,
+		"bonds":      bonds,
+		"attributes": jattrs,
+	}, nil
+}
+
+// canonicalize answers the canonical identifiers of the given
+// molecule.
+func canonicalize(mol *molecule.Molecule, _ []js.Value) (interface{}, error) {
+	h, err := mol.Hash128(0)
+	if err != nil {
+		return nil, err
+	}
+	fh, err := mol.Hash128(molecule.HashStereo | molecule.HashIsotopes)
+	if err != nil {
+		return nil, err
+	}
+	smi, err := loader.CanonicalSmiles(mol, molecule.HashStereo|molecule.HashIsotopes)
+	if err != nil {
+		return nil, err
+	}
+	loose, err := loader.CanonicalSmiles(mol, molecule.HashIsotopes)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{
+		"formula":     mol.Formula(),
+		"hash":        h.String(),
+		"fullHash":    fh.String(),
+		"smiles":      smi,
+		"looseSmiles": loose,
+	}, nil
+}
+
+// depict answers a PNG depiction of the given molecule, with the
+// options given as the first of the remaining arguments, if any.
+//
+// Molecules without coordinates, as read from SMILES, are embedded in
+// 3D, and drawn from the projection of their conformers.
+func depict(mol *molecule.Molecule, args []js.Value) (interface{}, error) {
+	opts := render.Options{}
+	if len(args) > 0 && args[0].Type() == js.TypeObject {
+		o := args[0]
+		opts.Width = intOption(o, "width")
+		opts.Height = intOption(o, "height")
+		opts.DPI = floatOption(o, "dpi")
+		opts.Scale = floatOption(o, "scale")
+		opts.Transparent = o.Get("transparent").Truthy()
+	}
+
+	if !hasCoords(mol) {
+		if _, err := mol.Embed(molecule.EmbedOptions{Seed: embedSeed}); err != nil {
+			return nil, err
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := render.WritePNG(&buf, mol, opts); err != nil {
+		return nil, err
+	}
+	png := js.Global().Get("Uint8Array").New(buf.Len())
+	js.CopyBytesToJS(png, buf.Bytes())
+	return png, nil
+}
+
+// hasCoords answers if any two atoms of the given molecule have
+// different coordinates.
+func hasCoords(mol *molecule.Molecule) bool {
+	first, seen := molecule.AtomInfo{}, false
+	it := mol.Atoms()
+	for it.Next() {
+		a := it.Atom()
+		if !seen {
+			first, seen = a, true
+		} else if a.X != first.X || a.Y != first.Y || a.Z != first.Z {
+			return true
+		}
+	}
+	return false
+}
+
+// intOption answers the integer option of the given name, or `0`.
+func intOption(o js.Value, name string) int {
+	if v := o.Get(name); v.Type() == js.TypeNumber {
+		return v.Int()
+	}
+	return 0
+}
+
+// floatOption answers the numeric option of the given name, or `0`.
+func floatOption(o js.Value, name string) float64 {
+	if v := o.Get(name); v.Type() == js.TypeNumber {
+		return v.Float()
+	}
+	return 0
+}
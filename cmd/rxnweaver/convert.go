@@ -0,0 +1,69 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/RxnWeaver/rxnweaver/data/loader"
+)
+
+// runConvert converts the molecules of the input files to the output
+// format, standardising them as asked.  Molecules that fail are
+// reported, and skipped.
+func runConvert(args []string) error {
+	fs := flag.NewFlagSet("convert", flag.ExitOnError)
+	from := fs.String("from", "", "input format: "+formatNames()+"; implied by the extension of each file, if not given")
+	to := fs.String("to", "", "output format; implied by the extension of the output file, if not given")
+	out := fs.String("o", "-", "output file; `-` for the standard output")
+	workers := fs.Int("workers", 0, "number of goroutines parsing molecules; the number of processors, if 0")
+	std := addStandardFlags(fs)
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: rxnweaver convert [flags] [files]")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if err := std.init(); err != nil {
+		return err
+	}
+
+	outFmt, err := formatOf(*to, *out)
+	if err != nil {
+		return err
+	}
+	o, err := openOutput(*out, outFmt)
+	if err != nil {
+		return err
+	}
+
+	total, failed := 0, 0
+	err = readMolecules(fs.Args(), *from, std.opts, *workers, func(name string, res loader.Result) error {
+		total++
+		mol, err := res.Molecule, res.Err
+		if err == nil {
+			mol, err = std.apply(mol)
+		}
+		if err == nil {
+			err = o.write(mol)
+		}
+		if mol != nil {
+			mol.Release()
+		}
+
+		if err != nil {
+			failed++
+			fmt.Fprintf(os.Stderr, "%s : record %d : %v\n", name, res.Index+1, err)
+		}
+		return nil
+	})
+	if cerr := o.close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d molecules not converted.", failed, total)
+	}
+	return nil
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+
+	"github.com/RxnWeaver/rxnweaver/data/loader"
+	"github.com/RxnWeaver/rxnweaver/data/molecule"
+)
+
+// readMolecules reads the molecules of the given files, in order, in
+// the given format, or in that implied by the extension of each.  The
+// standard input is read if no files are given.  The molecules are
+// sanitised with the given options, and handed to the given function,
+// with the names of their files, in the order of their records.  The
+// function owns the molecules.  Reading stops at the first error it
+// answers.
+func readMolecules(files []string, format string, opts molecule.SanitizeOptions, workers int, fn func(name string, res loader.Result) error) error {
+	if len(files) == 0 {
+		files = []string{"-"}
+	}
+
+	for _, file := range files {
+		f, err := formatOf(format, file)
+		if err != nil {
+			return err
+		}
+		if err := f.readable(); err != nil {
+			return err
+		}
+
+		in, name := os.Stdin, "<stdin>"
+		if file != "-" {
+			if in, err = os.Open(file); err != nil {
+				return err
+			}
+			name = file
+		}
+
+		done := make(chan struct{})
+		parse := loader.Sanitized(f.parser(nil), opts)
+		for res := range loader.LoadNamed(in, name, f.split, parse, workers, done) {
+			if err == nil {
+				err = fn(name, res)
+				if err != nil {
+					close(done)
+				}
+			} else if res.Molecule != nil {
+				res.Molecule.Release()
+			}
+		}
+		if err == nil {
+			close(done)
+		}
+		if in != os.Stdin {
+			in.Close()
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// _Output is a file being written, in a format.
+type _Output struct {
+	format  *_Format
+	w       *bufio.Writer
+	f       *os.File // `nil` for the standard output.
+	written int      // Number of molecules written.
+}
+
+// openOutput answers an output to the named file, or to the standard
+// output, for `-`, in the given format.
+func openOutput(file string, format *_Format) (*_Output, error) {
+	if err := format.writable(); err != nil {
+		return nil, err
+	}
+	if file == "-" {
+		return &_Output{format: format, w: bufio.NewWriter(os.Stdout)}, nil
+	}
+
+	f, err := os.Create(file)
+	if err != nil {
+		return nil, err
+	}
+	return &_Output{format: format, w: bufio.NewWriter(f), f: f}, nil
+}
+
+// write writes the given molecule.
+func (o *_Output) write(mol *molecule.Molecule) error {
+	if o.format.single && o.written > 0 {
+		return fmt.Errorf("A %s file holds a single molecule.", o.format.name)
+	}
+	if err := o.format.write(o.w, mol); err != nil {
+		return err
+	}
+	o.written++
+	return nil
+}
+
+// close flushes the output, and closes its file, if any.
+func (o *_Output) close() error {
+	err := o.w.Flush()
+	if o.f != nil {
+		if cerr := o.f.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
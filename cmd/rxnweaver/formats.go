@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/RxnWeaver/rxnweaver/data/loader"
+	"github.com/RxnWeaver/rxnweaver/data/molecule"
+)
+
+// _Format is a file format of molecules.  Formats without a parser or
+// a writer can not be read or written, respectively.
+type _Format struct {
+	name   string
+	exts   []string
+	split  bufio.SplitFunc
+	parser func(reg *molecule.MoleculeRegistry) loader.ParseFunc
+	write  func(w io.Writer, mol *molecule.Molecule) error
+	single bool // Does a file hold a single molecule?
+}
+
+// formats lists the known formats.
+//
+// InChI is recognised, so that it is reported as unsupported, rather
+// than unknown.  Reading and writing it needs the IUPAC InChI library,
+// which is not a dependency of this module.
+var formats = []*_Format{
+	{"smi", []string{".smi", ".smiles", ".ism"}, loader.SplitLines, loader.SmilesParser, loader.WriteSmiles, false},
+	{"sdf", []string{".sdf", ".sd"}, loader.SplitSDF, loader.MolfileParser, loader.WriteSDF, false},
+	{"mol", []string{".mol"}, loader.SplitSDF, loader.MolfileParser, loader.WriteMolfile, true},
+	{"helm", []string{".helm"}, loader.SplitLines, loader.HelmParser, nil, false},
+	{"pep", []string{".pep"}, loader.SplitLines, loader.PeptideParser, nil, false},
+	{"oligo", []string{".oligo"}, loader.SplitLines, loader.OligoParser, nil, false},
+	{"inchi", []string{".inchi"}, nil, nil, nil, false},
+}
+
+// formatNames answers the names of the known formats.
+func formatNames() string {
+	names := make([]string, len(formats))
+	for i, f := range formats {
+		names[i] = f.name
+	}
+	return strings.Join(names, ", ")
+}
+
+// formatNamed answers the format with the given name.
+func formatNamed(name string) (*_Format, error) {
+	for _, f := range formats {
+		if f.name == strings.ToLower(name) {
+			return f, nil
+		}
+	}
+	return nil, fmt.Errorf("Unknown format : %q.  Known formats are : %s.", name, formatNames())
+}
+
+// formatOf answers the format of the named file, given explicitly, or
+// implied by the extension of its name.
+func formatOf(explicit, file string) (*_Format, error) {
+	if explicit != "" {
+		return formatNamed(explicit)
+	}
+
+	ext := strings.ToLower(filepath.Ext(file))
+	for _, f := range formats {
+		for _, e := range f.exts {
+			if e == ext {
+				return f, nil
+			}
+		}
+	}
+	if file == "" || file == "-" {
+		return nil, fmt.Errorf("Format of standard input or output not given.")
+	}
+	return nil, fmt.Errorf("Format of %s not given, nor known by its extension.", file)
+}
+
+// readable answers an error unless this format can be read.
+func (f *_Format) readable() error {
+	if f.parser == nil {
+		return fmt.Errorf("Reading %s is not supported.", f.name)
+	}
+	return nil
+}
+
+// writable answers an error unless this format can be written.
+func (f *_Format) writable() error {
+	if f.write == nil {
+		return fmt.Errorf("Writing %s is not supported.", f.name)
+	}
+	return nil
+}
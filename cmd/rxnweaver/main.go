@@ -0,0 +1,88 @@
+// Command rxnweaver converts files of molecules between formats, and
+// screens them for substructures and similar molecules.
+//
+// Usage:
+//
+//	rxnweaver <command> [flags] [files]
+//
+// The commands are:
+//
+//	convert   convert molecules between SMILES, MOL and SDF
+//	search    screen molecules for a substructure or similarity
+//
+// Run `rxnweaver <command> -h` for the flags of a command.  Input is
+// read from the named files in order, or from the standard input if
+// none are named, or for the name `-`.
+//
+// The formats are `smi`, `sdf` and `mol`, implied by the extensions
+// `.smi`, `.sdf` and `.mol` of the files, unless given by flags, and,
+// for reading only, `helm`, `pep` and `oligo`, of HELM strings, and
+// of peptide and oligonucleotide sequences, by `.helm`, `.pep` and
+// `.oligo`.  See package `loader` for how they are read and written.
+// Molecules are sanitised as they are read; their standardisation is
+// controlled by flags common to the commands.
+//
+// The search command writes the molecules matching its query, with the
+// number of occurrences of the substructure and the similarity as the
+// attributes `MATCH_COUNT` and `SIMILARITY`, and reports the numbers
+// of molecules screened and matched.  Substructures are given in the
+// SMILES subset of SMARTS; see `molecule.SubstructureMatches` for how
+// they match.  Similarity is the continuous Tanimoto similarity of the
+// fingerprints of the molecules.
+//
+// InChI is recognised, but neither read nor written, since that needs
+// the IUPAC InChI library, which is not a dependency of this module.
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+)
+
+// _Command is a subcommand of `rxnweaver`.
+type _Command struct {
+	run     func(args []string) error
+	summary string
+}
+
+// commands holds the subcommands, by their names.
+var commands = map[string]_Command{
+	"convert": {runConvert, "convert molecules between SMILES, MOL and SDF"},
+	"search":  {runSearch, "screen molecules for a substructure or similarity"},
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+
+	cmd, ok := commands[os.Args[1]]
+	if !ok {
+		if os.Args[1] != "-h" && os.Args[1] != "help" {
+			fmt.Fprintf(os.Stderr, "rxnweaver: unknown command : %s\n", os.Args[1])
+		}
+		usage()
+		os.Exit(2)
+	}
+
+	if err := cmd.run(os.Args[2:]); err != nil {
+		fmt.Fprintf(os.Stderr, "rxnweaver %s: %v\n", os.Args[1], err)
+		os.Exit(1)
+	}
+}
+
+// usage prints a summary of the commands.
+func usage() {
+	fmt.Fprintln(os.Stderr, "Usage: rxnweaver <command> [flags] [files]")
+	fmt.Fprintln(os.Stderr, "\nThe commands are:")
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "  %-9s %s\n", name, commands[name].summary)
+	}
+}
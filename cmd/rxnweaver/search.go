@@ -0,0 +1,175 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/RxnWeaver/rxnweaver/data/loader"
+	"github.com/RxnWeaver/rxnweaver/data/molecule"
+	"github.com/RxnWeaver/rxnweaver/data/reaction"
+)
+
+// Names of the attributes recording the statistics of a match, written
+// as data fields of SD records.
+const (
+	MatchCountField = "MATCH_COUNT"
+	SimilarityField = "SIMILARITY"
+)
+
+// _Query is what `search` screens molecules for.
+type _Query struct {
+	sub       *molecule.Molecule // Substructure; `nil` if none.
+	fp        []int32            // Fingerprint of the similar molecule; `nil` if none.
+	threshold float64
+	max       int // Most occurrences of the substructure counted.
+}
+
+// runSearch screens the molecules of the input files for a
+// substructure, for similarity to a molecule, or for both, writing
+// those that match.
+func runSearch(args []string) error {
+	fs := flag.NewFlagSet("search", flag.ExitOnError)
+	smarts := fs.String("smarts", "", "substructure to search for, in the SMILES subset of SMARTS")
+	similar := fs.String("similar", "", "SMILES of the molecule to search for similar ones to")
+	threshold := fs.Float64("threshold", 0.7, "least Tanimoto similarity to the molecule given by -similar")
+	max := fs.Int("max", 0, "most occurrences of the substructure counted per molecule; all, if 0")
+	from := fs.String("from", "", "input format: "+formatNames()+"; implied by the extension of each file, if not given")
+	to := fs.String("to", "", "output format; implied by the extension of the output file, or that of the input, if not given")
+	out := fs.String("o", "-", "output file; `-` for the standard output")
+	workers := fs.Int("workers", 0, "number of goroutines parsing molecules; the number of processors, if 0")
+	std := addStandardFlags(fs)
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: rxnweaver search [flags] [files]")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if err := std.init(); err != nil {
+		return err
+	}
+	if *smarts == "" && *similar == "" {
+		return fmt.Errorf("Neither -smarts nor -similar given.")
+	}
+
+	q := &_Query{threshold: *threshold, max: *max}
+	if *smarts != "" {
+		sub, err := readQuery(*smarts, std.opts)
+		if err != nil {
+			return fmt.Errorf("Query : %v", err)
+		}
+		defer sub.Release()
+		q.sub = sub
+	}
+	if *similar != "" {
+		ref, err := readQuery(*similar, std.opts)
+		if err != nil {
+			return fmt.Errorf("Similar molecule : %v", err)
+		}
+		q.fp, err = fingerprint(ref)
+		ref.Release()
+		if err != nil {
+			return err
+		}
+	}
+
+	outFmt, err := formatOf(*to, *out)
+	if err != nil && *to == "" && *out == "-" {
+		first := "-"
+		if fs.NArg() > 0 {
+			first = fs.Arg(0)
+		}
+		outFmt, err = formatOf(*from, first)
+	}
+	if err != nil {
+		return err
+	}
+	o, err := openOutput(*out, outFmt)
+	if err != nil {
+		return err
+	}
+
+	total, failed, hits := 0, 0, 0
+	err = readMolecules(fs.Args(), *from, std.opts, *workers, func(name string, res loader.Result) error {
+		total++
+		mol, err := res.Molecule, res.Err
+		if err == nil {
+			mol, err = std.apply(mol)
+		}
+		matched := false
+		if err == nil {
+			matched, err = q.match(mol)
+		}
+		if err == nil && matched {
+			if err = o.write(mol); err == nil {
+				hits++
+			}
+		}
+		if mol != nil {
+			mol.Release()
+		}
+
+		if err != nil {
+			failed++
+			fmt.Fprintf(os.Stderr, "%s : record %d : %v\n", name, res.Index+1, err)
+		}
+		return nil
+	})
+	if cerr := o.close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "Screened %d molecules : %d matched, %d failed.\n", total, hits, failed)
+	if failed > 0 {
+		return fmt.Errorf("%d of %d molecules not screened.", failed, total)
+	}
+	return nil
+}
+
+// readQuery answers the sanitised molecule of the given SMILES.
+func readQuery(smi string, opts molecule.SanitizeOptions) (*molecule.Molecule, error) {
+	return loader.Sanitized(loader.SmilesParser(nil), opts)([]byte(smi))
+}
+
+// fingerprint answers the fingerprint of the given molecule, with the
+// default parameters.
+func fingerprint(mol *molecule.Molecule) ([]int32, error) {
+	reply := mol.Call(molecule.ReqFingerprint, molecule.FingerprintQuery{Size: molecule.FingerprintSize, Radius: molecule.FingerprintRadius})
+	if reply.Status != molecule.StSuccess {
+		return nil, fmt.Errorf("Molecule %d : fingerprint not computed : %v", mol.Id(), reply.Status)
+	}
+	return reply.Payload.([]int32), nil
+}
+
+// match answers if the given molecule matches this query.  The
+// statistics of a match are set as the attributes `MATCH_COUNT`, the
+// number of occurrences of the substructure, and `SIMILARITY`, as
+// applicable.
+func (q *_Query) match(mol *molecule.Molecule) (bool, error) {
+	if q.fp != nil {
+		fp, err := fingerprint(mol)
+		if err != nil {
+			return false, err
+		}
+		sim := reaction.Similarity(q.fp, fp)
+		if sim < q.threshold {
+			return false, nil
+		}
+		if err := mol.SetAttribute(SimilarityField, fmt.Sprintf("%.4f", sim)); err != nil {
+			return false, err
+		}
+	}
+
+	if q.sub != nil {
+		ms, err := mol.SubstructureMatches(q.sub, q.max)
+		if err != nil || len(ms) == 0 {
+			return false, err
+		}
+		if err := mol.SetAttribute(MatchCountField, len(ms)); err != nil {
+			return false, err
+		}
+	}
+	return true, nil
+}
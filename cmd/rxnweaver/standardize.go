@@ -0,0 +1,223 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/RxnWeaver/rxnweaver/data/molecule"
+)
+
+// _Standardizer holds the options of standardisation common to the
+// commands reading molecules.
+type _Standardizer struct {
+	skip       string
+	largest    bool
+	neutralize bool
+	opts       molecule.SanitizeOptions
+}
+
+// addStandardFlags defines the flags of standardisation in the given
+// set, and answers the standardiser they configure.
+func addStandardFlags(fs *flag.FlagSet) *_Standardizer {
+	s := &_Standardizer{}
+	fs.StringVar(&s.skip, "skip", "", "stages of sanitisation to skip, separated by commas: hydrogens, valence, rings, aromaticity, stereo")
+	fs.BoolVar(&s.largest, "largest", false, "keep only the largest fragment of each molecule")
+	fs.BoolVar(&s.neutralize, "neutralize", false, "neutralise charged atoms, by adding or removing hydrogens")
+	return s
+}
+
+// init completes the configuration, once the flags are parsed.
+func (s *_Standardizer) init() error {
+	opts, err := molecule.ParseSanitizeOptions(s.skip)
+	if err != nil {
+		return err
+	}
+	s.opts = opts
+	return nil
+}
+
+// apply standardises the given sanitised molecule.  It answers the
+// standardised molecule, which may be a new one, in which case the
+// given one is released.
+func (s *_Standardizer) apply(mol *molecule.Molecule) (*molecule.Molecule, error) {
+	changed := false
+	if s.largest {
+		lm, err := largestFragment(mol)
+		if err != nil {
+			return mol, err
+		}
+		if lm != mol {
+			mol.Release()
+			mol, changed = lm, true
+		}
+	}
+	if s.neutralize {
+		n, err := neutralize(mol)
+		if err != nil {
+			return mol, err
+		}
+		changed = changed || n > 0
+	}
+
+	if changed {
+		if _, err := molecule.Sanitize(mol, s.opts); err != nil {
+			return mol, err
+		}
+	}
+	return mol, nil
+}
+
+// largestFragment answers a new molecule of the connected component of
+// the given molecule having the most heavy atoms, the earliest among
+// equals.  It answers the given molecule itself if it has a single
+// component.  Hydrogen atoms without neighbours are counted in their
+// former neighbours, and are dropped.
+func largestFragment(mol *molecule.Molecule) (*molecule.Molecule, error) {
+	atoms := make(map[uint16]molecule.AtomInfo, mol.AtomCount())
+	order := make([]uint16, 0, mol.AtomCount())
+	it := mol.Atoms()
+	for it.Next() {
+		a := it.Atom()
+		if a.AtomicNumber == 1 && len(a.Neighbours) == 0 {
+			continue
+		}
+		atoms[a.Iid] = a
+		order = append(order, a.Iid)
+	}
+	if err := it.Err(); err != nil {
+		return nil, err
+	}
+
+	seen := make(map[uint16]bool, len(atoms))
+	var best []uint16
+	count := 0
+	for _, iid := range order {
+		if seen[iid] {
+			continue
+		}
+		count++
+
+		comp := []uint16{iid}
+		seen[iid] = true
+		for k := 0; k < len(comp); k++ {
+			for _, nbr := range atoms[comp[k]].Neighbours {
+				if !seen[nbr] {
+					seen[nbr] = true
+					comp = append(comp, nbr)
+				}
+			}
+		}
+		if len(comp) > len(best) {
+			best = comp
+		}
+	}
+	if count <= 1 {
+		return mol, nil
+	}
+
+	lm, err := mol.ExtractAtoms(best)
+	if err != nil {
+		return nil, err
+	}
+	detail := fmt.Sprintf("kept 1 of %d fragments", count)
+	if err := lm.RecordStep("largest-fragment", detail); err != nil {
+		lm.Release()
+		return nil, err
+	}
+	return lm, nil
+}
+
+// neutralize neutralises the charged atoms of the given molecule, as
+// far as hydrogens allow, answering the number of charges removed.
+//
+// Positive atoms bearing hydrogens lose protons.  Negative atoms of
+// nitrogen, oxygen, phosphorus, sulphur and selenium that are not next
+// to positive atoms gain protons, but only as long as the molecule
+// remains negative overall, so that salts and zwitterions such as
+// nitro groups are retained.
+func neutralize(mol *molecule.Molecule) (int, error) {
+	atoms := make([]molecule.AtomInfo, 0, mol.AtomCount())
+	charges := make(map[uint16]int8, mol.AtomCount())
+	it := mol.Atoms()
+	for it.Next() {
+		a := it.Atom()
+		atoms = append(atoms, a)
+		charges[a.Iid] = a.Charge
+	}
+	if err := it.Err(); err != nil {
+		return 0, err
+	}
+
+	n := 0
+	set := func(a molecule.AtomInfo, charge int8, hCount uint8) error {
+		if err := mol.SetAtomCharge(a.Iid, charge); err != nil {
+			return err
+		}
+		if err := mol.SetAtomHCount(a.Iid, hCount); err != nil {
+			return err
+		}
+		d := int(a.Charge - charge)
+		if d < 0 {
+			d = -d
+		}
+		n += d
+		charges[a.Iid] = charge
+		return nil
+	}
+
+	for _, a := range atoms {
+		if a.Charge <= 0 || a.HCount == 0 {
+			continue
+		}
+		d := a.Charge
+		if int(d) > int(a.HCount) {
+			d = int8(a.HCount)
+		}
+		if err := set(a, a.Charge-d, a.HCount-uint8(d)); err != nil {
+			return n, err
+		}
+	}
+
+	net := 0
+	for _, ch := range charges {
+		net += int(ch)
+	}
+	for _, a := range atoms {
+		if net >= 0 {
+			break
+		}
+		if a.Charge >= 0 || !neutralizable[a.AtomicNumber] || hasPositiveNeighbour(a, charges) {
+			continue
+		}
+		d := -a.Charge
+		if int(d) > -net {
+			d = int8(-net)
+		}
+		if err := set(a, a.Charge+d, a.HCount+uint8(d)); err != nil {
+			return n, err
+		}
+		net += int(d)
+	}
+
+	if n > 0 {
+		if err := mol.RecordStep("neutralize", fmt.Sprintf("removed %d charges", n)); err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+// neutralizable holds the atomic numbers of the elements whose
+// negative atoms `neutralize` protonates.
+var neutralizable = map[uint8]bool{7: true, 8: true, 15: true, 16: true, 34: true}
+
+// hasPositiveNeighbour answers if the given atom has a neighbour with
+// a positive charge, among the given ones.
+func hasPositiveNeighbour(a molecule.AtomInfo, charges map[uint16]int8) bool {
+	for _, nbr := range a.Neighbours {
+		if charges[nbr] > 0 {
+			return true
+		}
+	}
+	return false
+}
@@ -13,4 +13,7 @@ const (
 	MaxBonds    = 20            // Maximum number of bonds an atom can have.
 	MaxRings    = ListSizeSmall // Maximum number of rings an atom can be a part of.
 	MaxFeatures = ListSizeSmall // Maximum number functional groups on an atom.
+
+	MaxMassNumber = 300 // Maximum mass number of an isotope.
+	MaxRGroup     = 32  // Maximum number of an R-group, as in molfiles.
 )
@@ -1,5 +1,65 @@
 package common
 
+import (
+	"fmt"
+)
+
+// StereoGroupType is the kind of an enhanced stereo group, as of MDL
+// V3000 molfiles: how the configurations drawn at its stereocentres
+// relate to those of the substance.
+type StereoGroupType uint8
+
+const (
+	StereoGroupAbsolute StereoGroupType = iota // As drawn.
+	StereoGroupAnd                             // As drawn, mixed with its inverse: racemic.
+	StereoGroupOr                              // As drawn, or its inverse: relative.
+)
+
+// stereoGroupNames holds the keywords of the group types, as in
+// V3000 molfiles.
+var stereoGroupNames = [...]string{"ABS", "AND", "OR"}
+
+// String answers the keyword of this group type.
+func (t StereoGroupType) String() string {
+	if int(t) < len(stereoGroupNames) {
+		return stereoGroupNames[t]
+	}
+	return fmt.Sprintf("StereoGroupType(%d)", t)
+}
+
+// SgroupType is the kind of an Sgroup, as of MDL molfiles: what the
+// information it attaches to its atoms is.
+type SgroupType uint8
+
+const (
+	SgroupNone      SgroupType = iota
+	SgroupSuperatom            // An abbreviation, such as `Ph'.
+	SgroupRepeat               // A structural repeating unit of a polymer.
+	SgroupData                 // A named value.
+)
+
+// sgroupNames holds the keywords of the Sgroup types, as in molfiles.
+var sgroupNames = [...]string{"", "SUP", "SRU", "DAT"}
+
+// String answers the keyword of this Sgroup type.
+func (t SgroupType) String() string {
+	if int(t) < len(sgroupNames) {
+		return sgroupNames[t]
+	}
+	return fmt.Sprintf("SgroupType(%d)", t)
+}
+
+// SgroupTypeOf answers the Sgroup type of the given keyword, as in
+// molfiles, and whether it is one of those known.
+func SgroupTypeOf(keyword string) (SgroupType, bool) {
+	for i, name := range sgroupNames {
+		if i > 0 && name == keyword {
+			return SgroupType(i), true
+		}
+	}
+	return SgroupNone, false
+}
+
 // The following `enum` definitions are in line with the corresponding
 // ones in InChI 1.04 software.  A notable difference is that we DO
 // NOT provide for specifying bond stereo with respect to the second
@@ -24,9 +84,32 @@ const (
 	BondTypeSingle
 	BondTypeDouble
 	BondTypeTriple
-	BondTypeAltern // InChI says 'avoid by all means'!
+	BondTypeAltern // Aromatic, as type `4' of molfiles.  InChI says 'avoid by all means'!
+
+	// A query bond matching single and double bonds, aromatic or not, as
+	// type `5' of molfiles.
+	BondTypeSingleOrDouble
+
+	// A dative, or coordination, bond, from its first atom, the donor
+	// of the electron pair, to its second, the acceptor.  It is
+	// numbered as in V3000 molfiles.
+	BondTypeDative BondType = 9
 )
 
+// Order answers the number of bonds this type contributes to the
+// valences of its atoms: `1`, `2` or `3` for single, double and triple
+// bonds, and `0` otherwise.  A dative bond contributes none, since its
+// electron pair is the donor's own; thus, the nitrogen of `H3N->BH3`
+// keeps its three hydrogens.  Aromatic and query bonds have no order
+// of their own; molecules count them by the Kekulé types perceived for
+// them.
+func (t BondType) Order() int {
+	if t >= BondTypeSingle && t <= BondTypeTriple {
+		return int(t)
+	}
+	return 0
+}
+
 // BondStereo defines the possible stereo orientations of a given
 // bond, when 2-D coordinates are given.
 type BondStereo uint8
@@ -48,6 +131,8 @@ const (
 	StereoTypeDoubleBond
 	StereoTypeTetrahedral
 	StereoTypeAllene
+	StereoTypeAxial // Hindered rotation about a single bond; atropisomerism.
+	StereoTypeRing  // Cis/trans about a ring, as in 1,4-disubstituted cyclohexanes.
 )
 
 // StereoParity defines the possible stereo configurations, given a
@@ -62,6 +147,86 @@ const (
 	StereoParityUndefined
 )
 
+// Inverse answers the opposite parity, for odd and even ones, and this
+// parity otherwise.  Exchanging the numbers of two neighbours of a
+// stereocentre inverts its parity.
+func (p StereoParity) Inverse() StereoParity {
+	switch p {
+	case StereoParityOdd:
+		return StereoParityEven
+	case StereoParityEven:
+		return StereoParityOdd
+	}
+	return p
+}
+
+// CIPDescriptor is the configuration of a stereogenic unit, as named
+// by the Cahn-Ingold-Prelog rules.
+type CIPDescriptor uint8
+
+const (
+	CIPNone CIPDescriptor = iota // Not stereogenic, or not determined.
+	CIPM                         // Axial; anticlockwise helicity.
+	CIPP                         // Axial; clockwise helicity.
+	CIPR                         // Tetrahedral; clockwise.
+	CIPS                         // Tetrahedral; anticlockwise.
+	CIPr                         // Pseudo-asymmetric; clockwise.
+	CIPs                         // Pseudo-asymmetric; anticlockwise.
+	CIPE                         // Double bond; opposite sides.
+	CIPZ                         // Double bond; same side.
+)
+
+// Inverse answers the descriptor of the mirror image of a stereogenic
+// unit having this descriptor.  Those of pseudo-asymmetric centres, and
+// of double bonds, are their own inverses.
+func (d CIPDescriptor) Inverse() CIPDescriptor {
+	switch d {
+	case CIPM:
+		return CIPP
+	case CIPP:
+		return CIPM
+	case CIPR:
+		return CIPS
+	case CIPS:
+		return CIPR
+	}
+	return d
+}
+
+// cipNames holds the conventional symbols of the descriptors.
+var cipNames = [...]string{"", "M", "P", "R", "S", "r", "s", "E", "Z"}
+
+// String answers the conventional symbol of this descriptor, or an
+// empty string if there is none.
+func (d CIPDescriptor) String() string {
+	if int(d) < len(cipNames) {
+		return cipNames[d]
+	}
+	return fmt.Sprintf("CIPDescriptor(%d)", d)
+}
+
+// RingRelation is the relative configuration of two substituted atoms
+// of a ring: whether their substituents lie on the same face of it.
+type RingRelation uint8
+
+const (
+	RingRelationNone  RingRelation = iota // Not stereogenic, or not determined.
+	RingRelationCis                       // Same face.
+	RingRelationTrans                     // Opposite faces.
+)
+
+// ringRelationNames holds the conventional prefixes of the relations.
+var ringRelationNames = [...]string{"", "cis", "trans"}
+
+// String answers the conventional prefix of this relation, or an
+// empty string if there is none.
+func (r RingRelation) String() string {
+	if int(r) < len(ringRelationNames) {
+		return ringRelationNames[r]
+	}
+	return fmt.Sprintf("RingRelation(%d)", r)
+}
+
 // The following `enum` definitions are as per RxnWeaver's internal
 // requirements and concepts.  They do not necessarily map readily to
 // any definitions in other software.
@@ -499,3 +499,19 @@ func IsValidOxidationState(atNum uint8, os int8) (bool, error) {
 	}
 	return false, fmt.Errorf("Invalid oxidation state: %d for element: %s", os, sym)
 }
+
+// nonMetals holds the atomic numbers of the non-metals and the
+// metalloids.
+var nonMetals = map[uint8]bool{
+	1: true, 2: true, 5: true, 6: true, 7: true, 8: true, 9: true, 10: true,
+	14: true, 15: true, 16: true, 17: true, 18: true,
+	32: true, 33: true, 34: true, 35: true, 36: true,
+	51: true, 52: true, 53: true, 54: true,
+	85: true, 86: true,
+}
+
+// IsMetal answers if the element with the given atomic number is a
+// metal.  Metalloids are NOT considered metals.
+func IsMetal(atNum uint8) bool {
+	return atNum > 0 && int(atNum) < len(ElementSymbols) && !nonMetals[atNum]
+}
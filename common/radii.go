@@ -0,0 +1,45 @@
+package common
+
+// Single-bond covalent radii, in Angstroms, of the elements commonly
+// found in organic molecules.
+//
+// P. Pyykkö and M. Atsumi, Molecular Single-Bond Covalent Radii for
+// Elements 1-118.  Chem. Eur. J. 2009, 15, 186-197.
+var covalentRadii = map[uint8]float64{
+	1:  0.32,
+	3:  1.33,
+	5:  0.85,
+	6:  0.75,
+	7:  0.71,
+	8:  0.63,
+	9:  0.64,
+	11: 1.55,
+	12: 1.39,
+	13: 1.26,
+	14: 1.16,
+	15: 1.11,
+	16: 1.03,
+	17: 0.99,
+	19: 1.96,
+	20: 1.71,
+	26: 1.16,
+	29: 1.12,
+	30: 1.18,
+	33: 1.21,
+	34: 1.16,
+	35: 1.14,
+	50: 1.40,
+	53: 1.33,
+}
+
+// DefaultCovalentRadius is assumed for the elements not listed above.
+const DefaultCovalentRadius = 1.50
+
+// CovalentRadius answers the single-bond covalent radius, in
+// Angstroms, of the element with the given atomic number.
+func CovalentRadius(atNum uint8) float64 {
+	if r, ok := covalentRadii[atNum]; ok {
+		return r
+	}
+	return DefaultCovalentRadius
+}
@@ -0,0 +1,147 @@
+package common
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Severity grades the issues found in validating a structure.
+type Severity uint8
+
+const (
+	SeverityInfo Severity = iota
+	SeverityWarning
+	SeverityError
+)
+
+// severityNames holds the descriptive names of the severities.
+var severityNames = [...]string{"info", "warning", "error"}
+
+// String answers the name of this severity.
+func (s Severity) String() string {
+	if int(s) < len(severityNames) {
+		return severityNames[s]
+	}
+	return fmt.Sprintf("Severity(%d)", s)
+}
+
+// Machine-readable codes of the issues reported by the validators in
+// this program.  Tools consuming reports should switch on these, and
+// never on the messages.
+const (
+	CodeSyntax          = "syntax"           // Malformed input.
+	CodeValenceExceeded = "valence-exceeded" // More bonds than the element allows.
+	CodeNoKekuleForm    = "no-kekule-form"   // Aromatic bonds admitting no Kekulé structure.
+
+	// Structure checker; see `molecule.Checker`.
+	CodeOverlappingAtoms = "overlapping-atoms"
+	CodeAbnormalCharge   = "abnormal-charge"
+	CodeUnusualValence   = "unusual-valence"
+	CodeIsolatedMetal    = "isolated-metal"
+	CodePolymerMarker    = "polymer-marker"
+)
+
+// Issue is a single problem found in validating a structure.
+//
+// The atoms and bonds concerned, if any, are identified by their input
+// IDs and IDs, respectively.  Parsers locate issues by their one-based
+// line numbers in the input, instead.
+type Issue struct {
+	Severity Severity
+	Code     string
+	Message  string
+	Atoms    []uint16
+	Bonds    []uint16
+	Line     int // `0` if not applicable.
+}
+
+// Error answers a description of this issue.
+func (i Issue) Error() string {
+	if i.Line > 0 {
+		return fmt.Sprintf("%v [%s] line %d : %s", i.Severity, i.Code, i.Line, i.Message)
+	}
+	return fmt.Sprintf("%v [%s] : %s", i.Severity, i.Code, i.Message)
+}
+
+// ValidationReport aggregates the issues found in validating a
+// structure, in the order of their discovery.  It is answered by the
+// parsers, the standardiser and `Molecule.Validate`.
+//
+// The zero value is an empty report, ready to use.
+type ValidationReport struct {
+	Issues []Issue
+}
+
+// Add appends the given issue to this report.
+func (r *ValidationReport) Add(issue Issue) {
+	r.Issues = append(r.Issues, issue)
+}
+
+// Addf appends an issue with the given severity, code and formatted
+// message, concerning the given atoms, to this report.
+func (r *ValidationReport) Addf(sev Severity, code string, atoms []uint16, format string, args ...interface{}) {
+	r.Add(Issue{Severity: sev, Code: code, Message: fmt.Sprintf(format, args...), Atoms: atoms})
+}
+
+// Merge appends the issues of the given report to this report.
+func (r *ValidationReport) Merge(o *ValidationReport) {
+	if o != nil {
+		r.Issues = append(r.Issues, o.Issues...)
+	}
+}
+
+// Filter answers the issues of this report of at least the given
+// severity.
+func (r *ValidationReport) Filter(min Severity) []Issue {
+	res := make([]Issue, 0, len(r.Issues))
+	for _, i := range r.Issues {
+		if i.Severity >= min {
+			res = append(res, i)
+		}
+	}
+	return res
+}
+
+// Errors answers the issues of this report of severity `error`.
+func (r *ValidationReport) Errors() []Issue {
+	return r.Filter(SeverityError)
+}
+
+// Warnings answers the issues of this report of severity `warning`.
+func (r *ValidationReport) Warnings() []Issue {
+	res := make([]Issue, 0, len(r.Issues))
+	for _, i := range r.Issues {
+		if i.Severity == SeverityWarning {
+			res = append(res, i)
+		}
+	}
+	return res
+}
+
+// HasErrors answers if this report has any issue of severity `error`.
+func (r *ValidationReport) HasErrors() bool {
+	for _, i := range r.Issues {
+		if i.Severity >= SeverityError {
+			return true
+		}
+	}
+	return false
+}
+
+// Err answers this report as an error, if it has any issue of severity
+// `error`.  Answers `nil` otherwise.
+func (r *ValidationReport) Err() error {
+	if r.HasErrors() {
+		return r
+	}
+	return nil
+}
+
+// Error answers the descriptions of all the issues, one per line.
+func (r *ValidationReport) Error() string {
+	msgs := make([]string, 0, len(r.Issues))
+	for _, i := range r.Issues {
+		msgs = append(msgs, i.Error())
+	}
+	return fmt.Sprintf("%d issues :\n%s", len(r.Issues), strings.Join(msgs, "\n"))
+}
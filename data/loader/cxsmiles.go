@@ -0,0 +1,158 @@
+package loader
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	cmn "github.com/RxnWeaver/rxnweaver/common"
+	"github.com/RxnWeaver/rxnweaver/data/molecule"
+)
+
+// splitCXExtension splits the given text, following a SMILES string
+// in a line, into its ChemAxon extension, `|...|`, without the bars,
+// and the remainder, trimmed.  The extension is blank if there is
+// none.
+func splitCXExtension(rest string) (string, string) {
+	if !strings.HasPrefix(rest, "|") {
+		return "", rest
+	}
+	i := strings.IndexByte(rest[1:], '|')
+	if i < 0 {
+		return "", rest
+	}
+	return rest[1 : i+1], strings.TrimSpace(rest[i+2:])
+}
+
+// cxFields answers the comma-separated fields of the given CXSMILES
+// extension.  Commas within parentheses, brackets or dollar-quoted
+// labels do not separate fields.
+func cxFields(ext string) []string {
+	res := []string(nil)
+	depth, quoted, start := 0, false, 0
+	for i := 0; i < len(ext); i++ {
+		switch c := ext[i]; {
+		case c == '$':
+			quoted = !quoted
+		case quoted:
+		case c == '(' || c == '[':
+			depth++
+		case (c == ')' || c == ']') && depth > 0:
+			depth--
+		case c == ',' && depth == 0:
+			res = append(res, ext[start:i])
+			start = i + 1
+		}
+	}
+	return append(res, ext[start:])
+}
+
+// cxStereoGroups answers the enhanced stereo groups of the given
+// CXSMILES extension, of a SMILES string of the given number of atoms:
+// those of its fields `a:`, `&n:` and `on:`, each followed by the
+// indices of its atoms, counted from `0`, separated by commas, which
+// are also their input IDs.  Other fields are skipped.
+func cxStereoGroups(ext string, na int) ([]molecule.StereoGroup, error) {
+	syntaxError := func(format string, args ...interface{}) error {
+		rep := new(cmn.ValidationReport)
+		msg := fmt.Sprintf(format, args...)
+		rep.Add(cmn.Issue{Severity: cmn.SeverityError, Code: cmn.CodeSyntax, Message: fmt.Sprintf("%s in CXSMILES extension : %q", msg, ext)})
+		return rep
+	}
+
+	type key struct {
+		typ cmn.StereoGroupType
+		num int
+	}
+	index := make(map[key]int)
+	groups := []molecule.StereoGroup(nil)
+	cur := -1 // Group of the atom indices that follow, if any.
+	for _, f := range cxFields(ext) {
+		if n, err := strconv.Atoi(f); err == nil {
+			if cur < 0 {
+				continue
+			}
+			if n < 0 || n >= na {
+				return nil, syntaxError("Stereo group holds unknown atom %d", n)
+			}
+			groups[cur].Atoms = append(groups[cur].Atoms, uint16(n))
+			continue
+		}
+
+		cur = -1
+		i := strings.IndexByte(f, ':')
+		if i < 1 {
+			continue
+		}
+		k := key{}
+		switch f[0] {
+		case 'a':
+			if i != 1 {
+				continue
+			}
+			k.typ = cmn.StereoGroupAbsolute
+		case '&', 'o':
+			num, err := strconv.Atoi(f[1:i])
+			if err != nil {
+				continue
+			}
+			k.typ, k.num = cmn.StereoGroupAnd, num
+			if f[0] == 'o' {
+				k.typ = cmn.StereoGroupOr
+			}
+		default:
+			continue
+		}
+		n, err := strconv.Atoi(f[i+1:])
+		if err != nil || n < 0 || n >= na {
+			return nil, syntaxError("Invalid stereo group %q", f)
+		}
+
+		g, ok := index[k]
+		if !ok {
+			g = len(groups)
+			index[k] = g
+			groups = append(groups, molecule.StereoGroup{Type: k.typ, Number: k.num})
+		}
+		groups[g].Atoms = append(groups[g].Atoms, uint16(n))
+		cur = g
+	}
+	return groups, nil
+}
+
+// cxRGroups answers the numbers of the R-groups of the atoms of the
+// given CXSMILES extension, of a SMILES string of the given number of
+// atoms, by their positions, counted from `0`; `nil` if there are
+// none.  They are those of the atom labels of the field `$...$`,
+// separated by semicolons, that are `_Rn`, as of the R-group `n`.
+// Other labels are skipped.
+func cxRGroups(ext string, na int) ([]int, error) {
+	for _, f := range cxFields(ext) {
+		if len(f) < 2 || f[0] != '$' || f[len(f)-1] != '$' || strings.HasPrefix(f, "$_AV:") {
+			continue
+		}
+
+		labels := strings.Split(f[1:len(f)-1], ";")
+		if len(labels) > na {
+			rep := new(cmn.ValidationReport)
+			rep.Add(cmn.Issue{Severity: cmn.SeverityError, Code: cmn.CodeSyntax, Message: fmt.Sprintf("More atom labels than atoms in CXSMILES extension : %q", ext)})
+			return nil, rep
+		}
+		res := []int(nil)
+		for i, l := range labels {
+			if !strings.HasPrefix(l, "_R") {
+				continue
+			}
+			n, err := strconv.Atoi(l[2:])
+			if err != nil || n < 1 || n > cmn.MaxRGroup {
+				continue
+			}
+			if res == nil {
+				res = make([]int, na)
+			}
+			res[i] = n
+		}
+		return res, nil
+	}
+	return nil, nil
+}
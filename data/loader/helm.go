@@ -0,0 +1,818 @@
+package loader
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	cmn "github.com/RxnWeaver/rxnweaver/common"
+	"github.com/RxnWeaver/rxnweaver/data/molecule"
+)
+
+// helmLibraries holds the monomer libraries of the polymer types that
+// HELM strings may hold, by their names.
+var helmLibraries = map[string]map[string]*_Monomer{
+	"PEPTIDE": peptideMonomers,
+	"RNA":     nucleicMonomers,
+}
+
+// peptideCodes holds the monomers of peptides having three-letter
+// codes, by their codes in lower case.
+var peptideCodes = func() map[string]*_Monomer {
+	res := make(map[string]*_Monomer)
+	for _, mon := range peptideMonomers {
+		if mon.code != "" {
+			res[strings.ToLower(mon.code)] = mon
+		}
+	}
+	return res
+}()
+
+// HelmParser answers a parse function that reads lines of HELM files,
+// creating their molecules in the given registry, or as passive
+// molecules, if `nil`.  See `ReadHelm`.
+func HelmParser(reg *molecule.MoleculeRegistry) ParseFunc {
+	return func(rec []byte) (*molecule.Molecule, error) {
+		return ReadHelm(reg, rec)
+	}
+}
+
+// ReadHelm answers a new molecule, in the given registry, or a passive
+// one, if `nil`, built from the given line of a HELM file: a HELM
+// string, optionally followed by white space and the name of the
+// molecule, which is set as its `name` attribute.  The molecule is not
+// sanitised; see `Sanitized`.
+//
+// The polymers, separated by `|`, are of the types `PEPTIDE`, as in
+// `PEPTIDE1{A.C.[dA].G}`, and `RNA`, as in `RNA1{R(A)P.R(U)P.R(G)}`.
+// Their monomers are expanded into atoms from the built-in library.
+// Those of peptides are the natural amino acids, by their one-letter
+// codes, their D-enantiomers, as `[dA]`, and a few others, such as
+// `[Aib]`, `[Orn]` and `[Sar]`, and the terminal caps `[ac]` and
+// `[am]`.  Those of nucleic acids are the sugars, ribose, `R`,
+// deoxyribose, `[dR]`, and the 2'-modified `[mR]`, with a methoxy
+// group, and `[fR]`, with fluorine; the bases `A`, `C`, `G`, `T` and
+// `U`, and `[5meC]` and `[I]`, for 5-methylcytosine and hypoxanthine;
+// and the linkers, phosphate, `P`, and phosphorothioate, `[sP]`.
+//
+// Each monomer is bonded to the one following it, at its `R2` and at
+// the other's `R1`, and to the monomer in parentheses following it, if
+// any, at its `R3` and at the other's `R1`: so are the sugars of
+// nucleotides bonded to their bases, and to their linkers.  The
+// connections between monomers, as `PEPTIDE1,PEPTIDE1,2:R3-7:R3` for a
+// disulfide bridge, bond them at the given R-groups, the monomers
+// being counted from `1` in the order of the string.  The R-groups
+// left free are capped as the library defines: those of amino acids by
+// hydrogen at the amino group and the side chain, and by hydroxyl at
+// the carboxyl groups; those of nucleic acids by hydrogen, but for
+// hydroxyl at the linkers.  The hydrogens of the atoms bonded, or
+// capped by hydrogen, are perceived by sanitisation.  The
+// configurations of the monomers are kept.
+//
+// Hydrogen bonds, `pair`, and annotations, in double quotes, are
+// ignored, as are the sections following the connections, but for
+// polymer groups.  Inline SMILES monomers, repeated monomers, polymer
+// groups, and monomers not in the library are not supported, and are
+// reported as malformed strings are: by a `*cmn.ValidationReport`,
+// whose issues give the positions in the string, counted from `1`.
+func ReadHelm(reg *molecule.MoleculeRegistry, rec []byte) (*molecule.Molecule, error) {
+	helm, name := splitRecordName(rec)
+
+	pb := newPolymerBuilder(reg)
+	defer pb.release()
+	p := &_HelmParser{s: helm, pb: pb, polymers: make(map[string][]*_Residue)}
+	if err := p.parse(); err != nil {
+		pb.mol.Release()
+		return nil, err
+	}
+	return pb.build(name)
+}
+
+// PeptideParser answers a parse function that reads lines of peptide
+// sequence files, creating their molecules in the given registry, or
+// as passive molecules, if `nil`.  See `ReadPeptide`.
+func PeptideParser(reg *molecule.MoleculeRegistry) ParseFunc {
+	return func(rec []byte) (*molecule.Molecule, error) {
+		return ReadPeptide(reg, rec)
+	}
+}
+
+// ReadPeptide answers a new molecule, in the given registry, or a
+// passive one, if `nil`, built from the given line of a peptide
+// sequence file: a sequence, optionally followed by white space and
+// the name of the molecule, which is set as its `name` attribute.  The
+// molecule is not sanitised; see `Sanitized`.
+//
+// The sequence is of the one-letter codes of the natural amino acids,
+// as `ACDK`, or of three-letter codes separated by hyphens, as
+// `H-Ala-Cys-Asp-Lys-OH`.  The latter may prefix amino acids by `D-`,
+// for their D-enantiomers, and name the others of the built-in library
+// by their HELM symbols, as `Aib` and `Orn`; its termini may be given,
+// as `H` or `Ac`, for an acetyl cap, at the start, and `OH` or `NH2`,
+// for an amide, at the end.  The residues are built as those of a
+// linear HELM peptide; see `ReadHelm`.  Sequences not understood are
+// reported by a `*cmn.ValidationReport`.
+func ReadPeptide(reg *molecule.MoleculeRegistry, rec []byte) (*molecule.Molecule, error) {
+	seq, name := splitRecordName(rec)
+	mons, err := peptideSequence(seq)
+	if err != nil {
+		return nil, err
+	}
+
+	pb := newPolymerBuilder(reg)
+	defer pb.release()
+	if err := pb.chain("PEPTIDE1", mons); err != nil {
+		pb.mol.Release()
+		return nil, err
+	}
+	return pb.build(name)
+}
+
+// OligoParser answers a parse function that reads lines of
+// oligonucleotide sequence files, creating their molecules in the given
+// registry, or as passive molecules, if `nil`.  See `ReadOligo`.
+func OligoParser(reg *molecule.MoleculeRegistry) ParseFunc {
+	return func(rec []byte) (*molecule.Molecule, error) {
+		return ReadOligo(reg, rec)
+	}
+}
+
+// ReadOligo answers a new molecule, in the given registry, or a
+// passive one, if `nil`, built from the given line of an
+// oligonucleotide sequence file: a sequence, optionally followed by
+// white space and the name of the molecule, which is set as its `name`
+// attribute.  The molecule is not sanitised; see `Sanitized`.
+//
+// The sequence is of the bases of its nucleotides, from the 5'-end, as
+// `ACGT`, optionally marked `5'-ACGT-3'`.  The bases are `A`, `C`, `G`,
+// `T` and `U`, and those of the built-in library named by their HELM
+// symbols in brackets, as `[5meC]`.  A base may be prefixed by its
+// sugar: `d` for deoxyribose, `r` for ribose, `m` for 2'-O-methylribose
+// and `f` for 2'-deoxy-2'-fluororibose, as in `mA`; the sugar of the
+// others is deoxyribose, but for the sequences having `U` and no `T`,
+// which are of RNA.  The nucleotides are linked by phosphates, or by
+// phosphorothioates, following those marked `*`, as in `dA*dC*dG`.
+// The 5'- and 3'-ends are hydroxyl groups.  The nucleotides are built
+// as those of a linear HELM nucleic acid; see `ReadHelm`.  Sequences
+// not understood are reported by a `*cmn.ValidationReport`.
+func ReadOligo(reg *molecule.MoleculeRegistry, rec []byte) (*molecule.Molecule, error) {
+	seq, name := splitRecordName(rec)
+	nts, err := oligoSequence(seq)
+	if err != nil {
+		return nil, err
+	}
+
+	pb := newPolymerBuilder(reg)
+	defer pb.release()
+	if err := pb.strand("RNA1", nts); err != nil {
+		pb.mol.Release()
+		return nil, err
+	}
+	return pb.build(name)
+}
+
+// splitRecordName answers the given line, without surrounding white
+// space, split at its first white space into its string and its name.
+func splitRecordName(rec []byte) (string, string) {
+	line := strings.TrimSpace(string(rec))
+	if i := strings.IndexAny(line, " \t"); i >= 0 {
+		return line[:i], strings.TrimSpace(line[i+1:])
+	}
+	return line, ""
+}
+
+// syntaxIssue answers a report of the given problem at the given
+// position in the given string.
+func syntaxIssue(s string, i int, format string, args ...interface{}) error {
+	rep := new(cmn.ValidationReport)
+	msg := fmt.Sprintf(format, args...)
+	rep.Add(cmn.Issue{Severity: cmn.SeverityError, Code: cmn.CodeSyntax, Message: fmt.Sprintf("%s at position %d : %q", msg, i+1, s)})
+	return rep
+}
+
+// peptideSequence answers the monomers of the given peptide sequence.
+// See `ReadPeptide`.
+func peptideSequence(seq string) ([]*_Monomer, error) {
+	if seq == "" {
+		return nil, syntaxIssue(seq, 0, "Empty sequence")
+	}
+
+	mons := []*_Monomer(nil)
+	if !strings.Contains(seq, "-") {
+		for i := 0; i < len(seq); i++ {
+			mon, ok := peptideMonomers[seq[i:i+1]]
+			if !ok || !isUpper(seq[i]) {
+				return nil, syntaxIssue(seq, i, "Unknown amino acid %q", seq[i:i+1])
+			}
+			mons = append(mons, mon)
+		}
+		return mons, nil
+	}
+
+	parts := strings.Split(seq, "-")
+	last := len(parts) - 1
+	for k, at := 0, 0; k <= last; k++ {
+		code, pos := parts[k], at
+		at += len(parts[k]) + 1
+		switch {
+		case k == 0 && code == "H" && last > 0:
+			continue
+		case k == last && code == "OH" && last > 0:
+			continue
+		case (code == "D" || code == "L") && k < last:
+			k++
+			at += len(parts[k]) + 1
+			if code == "D" {
+				code = "D-" + parts[k]
+			} else {
+				code = parts[k]
+			}
+		}
+
+		mon, ok := peptideCodes[strings.ToLower(code)]
+		switch {
+		case !ok:
+			return nil, syntaxIssue(seq, pos, "Unknown amino acid %q", code)
+		case mon.symbol == "ac" && k != 0, mon.symbol == "am" && k != last:
+			return nil, syntaxIssue(seq, pos, "Misplaced terminal group %q", code)
+		}
+		mons = append(mons, mon)
+	}
+	if len(mons) == 0 {
+		return nil, syntaxIssue(seq, 0, "Empty sequence")
+	}
+	return mons, nil
+}
+
+// _Nucleotide is a nucleotide of an oligonucleotide sequence: its
+// sugar and its base, and the linker following it, if any.
+type _Nucleotide struct {
+	sugar, base, linker *_Monomer
+}
+
+// oligoSugars holds the sugars of nucleotides, by their prefixes in
+// oligonucleotide sequences.
+var oligoSugars = map[byte]string{'d': "dR", 'r': "R", 'm': "mR", 'f': "fR"}
+
+// oligoSequence answers the nucleotides of the given oligonucleotide
+// sequence.  See `ReadOligo`.
+func oligoSequence(seq string) ([]_Nucleotide, error) {
+	body, off := seq, 0
+	if strings.HasPrefix(body, "5'-") {
+		body, off = body[3:], 3
+	}
+	body = strings.TrimSuffix(body, "-3'")
+	if body == "" {
+		return nil, syntaxIssue(seq, 0, "Empty sequence")
+	}
+
+	sugar := nucleicMonomers["dR"]
+	if strings.ContainsRune(body, 'U') && !strings.ContainsRune(body, 'T') {
+		sugar = nucleicMonomers["R"]
+	}
+
+	nts := []_Nucleotide(nil)
+	for i := 0; i < len(body); {
+		nt := _Nucleotide{sugar: sugar}
+		if sym, ok := oligoSugars[body[i]]; ok {
+			nt.sugar = nucleicMonomers[sym]
+			i++
+		}
+
+		start, sym := i, ""
+		switch {
+		case i >= len(body):
+			return nil, syntaxIssue(seq, off+i, "Missing base")
+		case body[i] == '[':
+			end := strings.IndexByte(body[i:], ']')
+			if end < 0 {
+				return nil, syntaxIssue(seq, off+i, "Unclosed base")
+			}
+			sym = body[i+1 : i+end]
+			i += end + 1
+		default:
+			sym = body[i : i+1]
+			i++
+		}
+		base, ok := nucleicMonomers[sym]
+		if !ok || !isBase(base) {
+			return nil, syntaxIssue(seq, off+start, "Unknown base %q", sym)
+		}
+		nt.base = base
+
+		if i < len(body) {
+			nt.linker = nucleicMonomers["P"]
+			if body[i] == '*' {
+				nt.linker = nucleicMonomers["sP"]
+				i++
+			}
+		}
+		if i >= len(body) && nt.linker != nil {
+			return nil, syntaxIssue(seq, off+i-1, "Misplaced phosphorothioate")
+		}
+		nts = append(nts, nt)
+	}
+	return nts, nil
+}
+
+// isBase answers if the given monomer is a nucleic acid base.
+func isBase(mon *_Monomer) bool {
+	for i := range nucleicBases {
+		if &nucleicBases[i] == mon {
+			return true
+		}
+	}
+	return false
+}
+
+// _HelmParser holds the state of parsing a HELM string.
+type _HelmParser struct {
+	s        string
+	i        int
+	pb       *_PolymerBuilder
+	polymers map[string][]*_Residue // Monomers of the polymers, by their IDs.
+}
+
+// syntaxError answers a report of the given problem at the current
+// position in the string.
+func (p *_HelmParser) syntaxError(format string, args ...interface{}) error {
+	return syntaxIssue(p.s, p.i, format, args...)
+}
+
+// consume skips the given character, answering if it is next.
+func (p *_HelmParser) consume(c byte) bool {
+	if p.i < len(p.s) && p.s[p.i] == c {
+		p.i++
+		return true
+	}
+	return false
+}
+
+// skipAnnotation skips an annotation, in double quotes, if next.
+func (p *_HelmParser) skipAnnotation() error {
+	if !p.consume('"') {
+		return nil
+	}
+	end := strings.IndexByte(p.s[p.i:], '"')
+	if end < 0 {
+		return p.syntaxError("Unclosed annotation")
+	}
+	p.i += end + 1
+	return nil
+}
+
+// parse reads the polymers and the connections of the string, building
+// their monomers.
+func (p *_HelmParser) parse() error {
+	if p.s == "" {
+		return p.syntaxError("Empty HELM")
+	}
+
+	for {
+		if err := p.parsePolymer(); err != nil {
+			return err
+		}
+		if !p.consume('|') {
+			break
+		}
+	}
+	if !p.consume('$') {
+		if p.i < len(p.s) {
+			return p.syntaxError("Unexpected character")
+		}
+		return nil
+	}
+
+	for p.i < len(p.s) && p.s[p.i] != '$' {
+		if err := p.parseConnection(); err != nil {
+			return err
+		}
+		if !p.consume('|') {
+			break
+		}
+	}
+	if p.consume('$') && p.i < len(p.s) && p.s[p.i] != '$' {
+		return p.syntaxError("Polymer groups are not supported")
+	}
+	return nil
+}
+
+// parsePolymer reads a simple polymer, as `PEPTIDE1{A.C.G}`.
+func (p *_HelmParser) parsePolymer() error {
+	start := p.i
+	for p.i < len(p.s) && isUpper(p.s[p.i]) {
+		p.i++
+	}
+	typ := p.s[start:p.i]
+	for p.i < len(p.s) && isDigit(p.s[p.i]) {
+		p.i++
+	}
+	id := p.s[start:p.i]
+	if typ == "" || id == typ {
+		return p.syntaxError("Invalid polymer ID")
+	}
+	lib, ok := helmLibraries[typ]
+	if !ok {
+		return p.syntaxError("Unsupported polymer type %s", typ)
+	}
+	if _, ok := p.polymers[id]; ok {
+		return p.syntaxError("Duplicate polymer %s", id)
+	}
+
+	if !p.consume('{') {
+		return p.syntaxError("Polymer without monomers")
+	}
+	res, err := p.parseMonomers(id, lib)
+	if err != nil {
+		return err
+	}
+	if !p.consume('}') {
+		return p.syntaxError("Unclosed polymer")
+	}
+	p.polymers[id] = res
+	return p.skipAnnotation()
+}
+
+// parseMonomers reads the monomers of the polymer with the given ID,
+// from the given library, up to its closing brace, bonding them along
+// its backbone and to its branches.
+func (p *_HelmParser) parseMonomers(id string, lib map[string]*_Monomer) ([]*_Residue, error) {
+	res := []*_Residue(nil)
+	var prev *_Residue
+	dot := false
+	for p.i < len(p.s) && p.s[p.i] != '}' {
+		switch c := p.s[p.i]; c {
+		case '.':
+			if prev == nil || dot {
+				return nil, p.syntaxError("Misplaced dot")
+			}
+			dot = true
+			p.i++
+
+		case '(':
+			if prev == nil || dot {
+				return nil, p.syntaxError("Branch without a monomer")
+			}
+			p.i++
+			r, err := p.parseMonomer(id, lib, len(res)+1)
+			if err != nil {
+				return nil, err
+			}
+			res = append(res, r)
+			if !p.consume(')') {
+				return nil, p.syntaxError("Unclosed branch")
+			}
+			if err := p.pb.link(prev, 3, r, 1); err != nil {
+				return nil, p.syntaxError("%v", err)
+			}
+
+		case '"':
+			if err := p.skipAnnotation(); err != nil {
+				return nil, err
+			}
+
+		case '\'':
+			return nil, p.syntaxError("Repeated monomers are not supported")
+
+		default:
+			r, err := p.parseMonomer(id, lib, len(res)+1)
+			if err != nil {
+				return nil, err
+			}
+			res = append(res, r)
+			if prev != nil {
+				if err := p.pb.link(prev, 2, r, 1); err != nil {
+					return nil, p.syntaxError("%v", err)
+				}
+			}
+			prev, dot = r, false
+		}
+	}
+	if prev == nil || dot {
+		return nil, p.syntaxError("Polymer without monomers")
+	}
+	return res, nil
+}
+
+// parseMonomer reads a monomer, a letter or a symbol in brackets, of
+// the polymer with the given ID, from the given library, and builds it
+// at the given position of the polymer.
+func (p *_HelmParser) parseMonomer(id string, lib map[string]*_Monomer, pos int) (*_Residue, error) {
+	start := p.i
+	sym := ""
+	switch {
+	case p.i >= len(p.s):
+		return nil, p.syntaxError("Missing monomer")
+	case p.s[p.i] == '[':
+		end := strings.IndexByte(p.s[p.i:], ']')
+		if end < 0 {
+			return nil, p.syntaxError("Unclosed monomer")
+		}
+		sym = p.s[p.i+1 : p.i+end]
+		p.i += end + 1
+	case isUpper(p.s[p.i]) || isLower(p.s[p.i]):
+		sym = p.s[p.i : p.i+1]
+		p.i++
+	default:
+		return nil, p.syntaxError("Invalid monomer")
+	}
+
+	mon, ok := lib[sym]
+	if !ok {
+		p.i = start
+		return nil, p.syntaxError("Unknown monomer %q", sym)
+	}
+	return p.pb.add(mon, id, pos)
+}
+
+// parseConnection reads a connection, as `PEPTIDE1,PEPTIDE1,2:R3-7:R3`,
+// and bonds its monomers.
+func (p *_HelmParser) parseConnection() error {
+	end := p.i
+	for end < len(p.s) && p.s[end] != '|' && p.s[end] != '$' {
+		end++
+	}
+	conn := p.s[p.i:end]
+	if k := strings.IndexByte(conn, '"'); k >= 0 {
+		conn = conn[:k]
+	}
+
+	fields := strings.Split(conn, ",")
+	if len(fields) != 3 {
+		return p.syntaxError("Invalid connection")
+	}
+	ends := strings.Split(fields[2], "-")
+	if len(ends) != 2 {
+		return p.syntaxError("Invalid connection")
+	}
+	rs, ns := [2]*_Residue{}, [2]int{}
+	pairs := 0
+	for k, e := range ends {
+		res, ok := p.polymers[fields[k]]
+		if !ok {
+			return p.syntaxError("Unknown polymer %s", fields[k])
+		}
+		parts := strings.SplitN(e, ":", 2)
+		pos, err := strconv.Atoi(parts[0])
+		if err != nil || pos < 1 || pos > len(res) || len(parts) != 2 {
+			return p.syntaxError("Invalid connection end %q", e)
+		}
+		if parts[1] == "pair" {
+			pairs++
+			continue
+		}
+		n, err := strconv.Atoi(strings.TrimPrefix(parts[1], "R"))
+		if err != nil || !strings.HasPrefix(parts[1], "R") {
+			return p.syntaxError("Invalid connection end %q", e)
+		}
+		rs[k], ns[k] = res[pos-1], n
+	}
+
+	switch pairs {
+	case 0:
+		if err := p.pb.link(rs[0], ns[0], rs[1], ns[1]); err != nil {
+			return p.syntaxError("%v", err)
+		}
+	case 1:
+		return p.syntaxError("Invalid connection")
+	}
+	p.i = end
+	return nil
+}
+
+// _Residue is a monomer of a polymer being built.
+type _Residue struct {
+	mon     *_Monomer
+	polymer string         // ID of its polymer.
+	pos     int            // Position in its polymer, counted from `1`.
+	rgroups map[int]uint16 // Input IDs of the `R` atoms of its free R-groups, by number.
+}
+
+// String answers a description of this residue, for reporting.
+func (r *_Residue) String() string {
+	return fmt.Sprintf("%s %d of %s", r.mon.symbol, r.pos, r.polymer)
+}
+
+// take answers the `R` atom of the given free R-group of this residue,
+// which is no longer free.
+func (r *_Residue) take(n int) (uint16, error) {
+	iid, ok := r.rgroups[n]
+	if !ok {
+		return 0, fmt.Errorf("Monomer %v : no free R%d", r, n)
+	}
+	delete(r.rgroups, n)
+	return iid, nil
+}
+
+// _PolymerBuilder assembles a molecule from monomers of the built-in
+// library.
+type _PolymerBuilder struct {
+	mol      *molecule.Molecule
+	residues []*_Residue
+	frags    map[string]*molecule.Molecule // Monomers and caps, by their SMILES.
+}
+
+// newPolymerBuilder answers a builder of a new molecule, in the given
+// registry, or a passive one, if `nil`.
+func newPolymerBuilder(reg *molecule.MoleculeRegistry) *_PolymerBuilder {
+	return &_PolymerBuilder{mol: newMolecule(reg), frags: make(map[string]*molecule.Molecule)}
+}
+
+// release releases the fragments read by this builder.
+func (pb *_PolymerBuilder) release() {
+	for _, frag := range pb.frags {
+		frag.Release()
+	}
+}
+
+// fragment answers the passive molecule of the given SMILES of a
+// monomer or a cap, reading it but once.  Its `*` atoms of the classes
+// from `1` to `3` are `R` atoms of those R-groups.
+func (pb *_PolymerBuilder) fragment(smi string) (*molecule.Molecule, error) {
+	if frag, ok := pb.frags[smi]; ok {
+		return frag, nil
+	}
+
+	p := &_SmilesParser{s: smi}
+	if err := p.parse(); err != nil {
+		return nil, err
+	}
+	labels := make([]string, len(p.atoms))
+	found := false
+	for i, a := range p.atoms {
+		if a.sym == "Q_STAR" && a.class >= 1 && a.class <= 3 {
+			labels[i] = fmt.Sprintf("_R%d", a.class)
+			found = true
+		}
+	}
+	rec := smi
+	if found {
+		rec += " |$" + strings.Join(labels, ";") + "$|"
+	}
+
+	frag, err := ReadSmiles(nil, []byte(rec))
+	if err != nil {
+		return nil, err
+	}
+	pb.frags[smi] = frag
+	return frag, nil
+}
+
+// add merges the given monomer into the molecule, as a residue at the
+// given position of the polymer with the given ID.
+func (pb *_PolymerBuilder) add(mon *_Monomer, polymer string, pos int) (*_Residue, error) {
+	frag, err := pb.fragment(mon.smiles)
+	if err != nil {
+		return nil, err
+	}
+	iids, err := pb.mol.Merge(frag, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &_Residue{mon: mon, polymer: polymer, pos: pos, rgroups: make(map[int]uint16)}
+	it := frag.Atoms()
+	for it.Next() {
+		if a := it.Atom(); a.RGroup >= 1 && a.RGroup <= 3 {
+			r.rgroups[int(a.RGroup)] = iids[a.Iid]
+		}
+	}
+	if err := it.Err(); err != nil {
+		return nil, err
+	}
+	pb.residues = append(pb.residues, r)
+	return r, nil
+}
+
+// chain merges the given monomers into the molecule, as a linear
+// polymer with the given ID.
+func (pb *_PolymerBuilder) chain(polymer string, mons []*_Monomer) error {
+	var prev *_Residue
+	for i, mon := range mons {
+		r, err := pb.add(mon, polymer, i+1)
+		if err != nil {
+			return err
+		}
+		if prev != nil {
+			if err := pb.link(prev, 2, r, 1); err != nil {
+				return err
+			}
+		}
+		prev = r
+	}
+	return nil
+}
+
+// strand merges the given nucleotides into the molecule, as a linear
+// nucleic acid with the given ID: the sugar of each bonded to its base
+// and to its linker, which is bonded to the sugar following it.
+func (pb *_PolymerBuilder) strand(polymer string, nts []_Nucleotide) error {
+	pos := 0
+	next := func(mon *_Monomer) (*_Residue, error) {
+		pos++
+		return pb.add(mon, polymer, pos)
+	}
+
+	var prev *_Residue
+	for _, nt := range nts {
+		s, err := next(nt.sugar)
+		if err != nil {
+			return err
+		}
+		b, err := next(nt.base)
+		if err != nil {
+			return err
+		}
+		if err := pb.link(s, 3, b, 1); err != nil {
+			return err
+		}
+		if prev != nil {
+			if err := pb.link(prev, 2, s, 1); err != nil {
+				return err
+			}
+		}
+		if nt.linker == nil {
+			break
+		}
+		if prev, err = next(nt.linker); err != nil {
+			return err
+		}
+		if err := pb.link(s, 2, prev, 1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// link bonds the given residues at the given free R-groups, their `R`
+// atoms being replaced by a single bond between their neighbours.
+func (pb *_PolymerBuilder) link(r1 *_Residue, n1 int, r2 *_Residue, n2 int) error {
+	a1, err := r1.take(n1)
+	if err != nil {
+		return err
+	}
+	a2, err := r2.take(n2)
+	if err != nil {
+		return err
+	}
+	return pb.mol.JoinAtoms(a1, a2, cmn.BondTypeSingle)
+}
+
+// bearer answers the atom bearing the given `R` atom.
+func (pb *_PolymerBuilder) bearer(iid uint16) (uint16, error) {
+	a, err := pb.mol.AtomInfo(iid)
+	if err != nil {
+		return 0, err
+	}
+	if len(a.Neighbours) != 1 {
+		return 0, fmt.Errorf("R-group %d at atom %d : %d neighbours", a.RGroup, iid, len(a.Neighbours))
+	}
+	return a.Neighbours[0], nil
+}
+
+// build caps the free R-groups of the residues, as their monomers
+// define, and answers the molecule, validated, with the given name, if
+// any.  The molecule is released on failure.
+func (pb *_PolymerBuilder) build(name string) (*molecule.Molecule, error) {
+	fail := func(err error) (*molecule.Molecule, error) {
+		pb.mol.Release()
+		return nil, err
+	}
+
+	for _, r := range pb.residues {
+		for n := 1; n <= 3; n++ {
+			iid, err := r.take(n)
+			if err != nil {
+				continue
+			}
+			x, err := pb.bearer(iid)
+			if err != nil {
+				return fail(err)
+			}
+			if err := pb.mol.RemoveAtom(iid); err != nil {
+				return fail(err)
+			}
+			if r.mon.caps[n-1] == "" {
+				continue
+			}
+
+			frag, err := pb.fragment(r.mon.caps[n-1])
+			if err != nil {
+				return fail(err)
+			}
+			if _, err := pb.mol.Merge(frag, &molecule.MergeLink{Atom: x, OtherAtom: 0, Type: cmn.BondTypeSingle}); err != nil {
+				return fail(err)
+			}
+		}
+	}
+
+	if err := pb.mol.Build(); err != nil {
+		return fail(err)
+	}
+	if name != "" {
+		if err := pb.mol.SetAttribute("name", name); err != nil {
+			return fail(err)
+		}
+	}
+	return pb.mol, nil
+}
@@ -0,0 +1,230 @@
+// Package loader reads large, multi-record streams of molecules
+// concurrently.
+//
+// A stream is split into its records sequentially, since that is
+// cheap.  The records are then parsed on several goroutines, since
+// that is expensive.  The molecules are delivered in the order of
+// their records in the input, regardless of the order in which their
+// parsing completes.
+//
+// Parsing itself is delegated to the given parse function, making the
+// loader independent of the input format.
+package loader
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"runtime"
+	"time"
+
+	"github.com/RxnWeaver/rxnweaver/data/molecule"
+)
+
+// ParseFunc parses a single record into a molecule.
+type ParseFunc func(rec []byte) (*molecule.Molecule, error)
+
+// Sanitized answers a parse function that sanitises the molecules
+// parsed by the given one, with the given options, so that molecules
+// read from all formats are perceived alike.  See
+// `molecule.Sanitize`.  A molecule having errors is answered along
+// with its report, as the error.
+func Sanitized(parse ParseFunc, opts molecule.SanitizeOptions) ParseFunc {
+	return func(rec []byte) (*molecule.Molecule, error) {
+		mol, err := parse(rec)
+		if err != nil || mol == nil {
+			return mol, err
+		}
+
+		rep, err := molecule.Sanitize(mol, opts)
+		if err != nil {
+			return mol, err
+		}
+		return mol, rep.Err()
+	}
+}
+
+// newMolecule answers a new molecule in the given registry, or a
+// passive one, if `nil`.  Passive molecules suit parsing in bulk, and
+// environments without background goroutines; see
+// `molecule.NewPassive`.
+func newMolecule(reg *molecule.MoleculeRegistry) *molecule.Molecule {
+	if reg == nil {
+		return molecule.NewPassive()
+	}
+	return reg.NewMolecule()
+}
+
+// Result is the outcome of parsing a single record.
+type Result struct {
+	Index    int // Zero-based position of the record in the input.
+	Molecule *molecule.Molecule
+	Err      error
+}
+
+// Maximum size of a single record.
+const MaxRecordSize = 16 * 1024 * 1024
+
+// _Job is a record to be parsed, along with the channel on which the
+// result of parsing it is to be sent.
+type _Job struct {
+	idx int
+	rec []byte
+	res chan Result
+}
+
+// Load splits the given stream into records using the given split
+// function, and parses them on the given number of goroutines.  A
+// non-positive number means the number of logical processors.
+//
+// It answers the channel on which the results are delivered, in the
+// order of their records in the input.  The channel is closed when
+// the input is exhausted, or when `done` is closed.  An error reading
+// the input is delivered as the last result, with `nil` molecule.
+func Load(r io.Reader, split bufio.SplitFunc, parse ParseFunc, workers int, done <-chan struct{}) <-chan Result {
+	return load(r, "", split, parse, workers, done)
+}
+
+// LoadNamed is like `Load`, but additionally records the given name of
+// the input, and the one-based number of its record, as the source in
+// the provenance of each molecule parsed.
+func LoadNamed(r io.Reader, name string, split bufio.SplitFunc, parse ParseFunc, workers int, done <-chan struct{}) <-chan Result {
+	return load(r, name, split, parse, workers, done)
+}
+
+// load implements `Load` and `LoadNamed`.  Sources are recorded unless
+// the given name is empty.
+func load(r io.Reader, name string, split bufio.SplitFunc, parse ParseFunc, workers int, done <-chan struct{}) <-chan Result {
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+
+	jobs := make(chan _Job, workers)
+	pending := make(chan chan Result, 2*workers)
+	out := make(chan Result, molecule.ReqChanSize)
+
+	// Split the input, and queue the records both for parsing and for
+	// delivery, in order.
+	go func() {
+		defer close(jobs)
+		defer close(pending)
+
+		sc := bufio.NewScanner(r)
+		sc.Buffer(make([]byte, 0, 64*1024), MaxRecordSize)
+		sc.Split(split)
+
+		idx := 0
+		for ; sc.Scan(); idx++ {
+			rec := append([]byte{}, sc.Bytes()...)
+			job := _Job{idx, rec, make(chan Result, 1)}
+
+			select {
+			case pending <- job.res:
+			case <-done:
+				return
+			}
+			select {
+			case jobs <- job:
+			case <-done:
+				return
+			}
+		}
+
+		if err := sc.Err(); err != nil {
+			res := make(chan Result, 1)
+			res <- Result{Index: idx, Err: err}
+			select {
+			case pending <- res:
+			case <-done:
+			}
+		}
+	}()
+
+	// Parse the records.
+	for i := 0; i < workers; i++ {
+		go func() {
+			for job := range jobs {
+				mol, err := parse(job.rec)
+				if err == nil && mol != nil && name != "" {
+					err = mol.SetSource(molecule.SourceInfo{File: name, Record: job.idx + 1, ParsedAt: time.Now()})
+				}
+				job.res <- Result{job.idx, mol, err}
+			}
+		}()
+	}
+
+	// Deliver the results in input order.
+	go func() {
+		defer close(out)
+
+		for res := range pending {
+			select {
+			case r := <-res:
+				select {
+				case out <- r:
+				case <-done:
+					return
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return out
+}
+
+// sdfTerminator marks the end of a record in an MDL SD file.
+var sdfTerminator = []byte("$$$$")
+
+// SplitSDF is a split function that splits an MDL SD file into its
+// records.  Each record answered excludes its terminating `$$$$'
+// line.  A trailing record without a terminator is answered as well,
+// unless it is blank.
+func SplitSDF(data []byte, atEOF bool) (int, []byte, error) {
+	start := 0
+	for start < len(data) {
+		end := bytes.IndexByte(data[start:], '\n')
+		if end < 0 {
+			break
+		}
+
+		line := bytes.TrimRight(data[start:start+end], "\r")
+		if bytes.Equal(line, sdfTerminator) {
+			return start + end + 1, data[:start], nil
+		}
+		start += end + 1
+	}
+
+	if !atEOF {
+		return 0, nil, nil
+	}
+
+	// Final record, possibly with its terminator on an unterminated
+	// last line.
+	rec := bytes.TrimRight(data, "\r\n")
+	if bytes.HasSuffix(rec, sdfTerminator) {
+		rec = rec[:len(rec)-len(sdfTerminator)]
+	}
+	if len(bytes.TrimSpace(rec)) == 0 {
+		return len(data), nil, nil
+	}
+	return len(data), rec, nil
+}
+
+// SplitLines is a split function that answers each non-blank line as
+// a record, as in SMILES files.
+func SplitLines(data []byte, atEOF bool) (int, []byte, error) {
+	adv := 0
+	for {
+		n, line, err := bufio.ScanLines(data[adv:], atEOF)
+		if err != nil || n == 0 {
+			return adv + n, nil, err
+		}
+
+		adv += n
+		if len(bytes.TrimSpace(line)) > 0 {
+			return adv, line, nil
+		}
+	}
+}
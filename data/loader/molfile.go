@@ -0,0 +1,643 @@
+package loader
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	cmn "github.com/RxnWeaver/rxnweaver/common"
+	"github.com/RxnWeaver/rxnweaver/data/molecule"
+)
+
+// Names of the data fields describing conformers in SD files written
+// by `WriteConformersSDF`.
+const (
+	ConformerIdField     = "CONFORMER_ID"
+	ConformerEnergyField = "ENERGY"
+)
+
+// molfileSymbols maps the symbols of MDL molfiles that are not those
+// of elements to the symbols of the periodic table.  Deuterium and
+// tritium are read as isotopes of hydrogen.
+var molfileSymbols = map[string]string{
+	"*":  "Q_STAR",
+	"A":  "Q_A",
+	"Q":  "Q_Q",
+	"R#": "R",
+	"D":  "H",
+	"T":  "H",
+}
+
+// molfilePseudoSymbols maps the symbols of pseudo-elements to those
+// of MDL molfiles.
+var molfilePseudoSymbols = map[string]string{
+	"Q_STAR": "*",
+	"Q_A":    "A",
+	"Q_Q":    "Q",
+	"R":      "R#",
+}
+
+// _MolfileAtom is an atom read from the atom block of a molfile.
+type _MolfileAtom struct {
+	sym     string
+	x, y, z float32
+	isotope int
+	charge  int
+	radical bool
+	valence int
+	rgroup  int // Of `R#' atoms.
+	apo     int // Attachment points.
+}
+
+// _MolfileBond is a bond read from the bond block of a molfile, with
+// the positions of its atoms in the atom block, counted from `1`.
+type _MolfileBond struct {
+	a1, a2 int
+	typ    int
+	stereo int
+}
+
+// _MolfileSyntaxError reports a syntax error at the given line of a
+// molfile, counted from `1`.
+type _MolfileSyntaxError func(ln int, format string, args ...interface{}) error
+
+// MolfileParser answers a parse function that reads MDL molfiles and
+// SD records, creating their molecules in the given registry, or as
+// passive molecules, if `nil`.  See `ReadMolfile`.
+func MolfileParser(reg *molecule.MoleculeRegistry) ParseFunc {
+	return func(rec []byte) (*molecule.Molecule, error) {
+		return ReadMolfile(reg, rec)
+	}
+}
+
+// ReadMolfile answers a new molecule, in the given registry, or a
+// passive one, if `nil`, built from the given MDL molfile or SD
+// record, of either V2000 or V3000.  The molecule is not sanitised;
+// see `Sanitized`.
+//
+// Atoms are numbered in the order of the atom block.  Charges and
+// isotopes are read from the `M  CHG' and `M  ISO' lines, if any, and
+// from the atom block otherwise, as the format requires.  Radicals of
+// all multiplicities, of `M  RAD' lines, are read as doublets, the
+// only ones that `AtomBuilder` can set.  The numbers of the R-groups
+// of `R#' atoms are read from `M  RGP' lines, and attachment points
+// from `M  APO' lines; the R-group definitions of RGfiles are not
+// read.  Bonds to
+// hydrogen atoms are counted in their neighbours, as by
+// `BondBuilder.Connect`.  Bonds of type `9`, coordination bonds in
+// V3000, are read as dative bonds from their first atoms, in V2000
+// too, where they are a common extension.  Aromatic bonds, of type
+// `4`, and single-or-double query bonds, of type `5`, keep their types;
+// sanitisation assigns the Kekulé types of the former.  Other query
+// bond types are rejected.  The title, if any, is set as the `name`
+// attribute, and the data fields of an SD record as tags.  See
+// `AttachSDFields`.
+//
+// Coordinates and bond stereo flags are kept as drawn.  Sanitisation
+// determines the configurations of stereocentres from them, and those
+// of double bonds, `E` or `Z`, from the coordinates alone, as the
+// format carries no flags for them; only `either' double bonds, and
+// those with wavy bonds from their ends, are left undetermined.  The
+// atom parities of the atom block are ignored, as the format
+// prescribes.
+//
+// The record may include its `$$$$' terminator.  Malformed records are
+// reported by a `*cmn.ValidationReport`, whose issues are located by
+// their lines in the record.
+//
+// Of V3000 connection tables, the atom and bond blocks, with the
+// `RGROUPS' and `ATTCHPT' properties of atoms, and the
+// enhanced stereo groups of the collection block, `MDLV30/STEABS',
+// `MDLV30/STERACn' and `MDLV30/STERELn', are read; see `StereoGroup`.
+// Atoms are numbered in the order of the atom block, whatever their
+// indices.  Atom lists, query properties and 3-D features are not
+// supported, and other blocks are skipped.
+//
+// Superatoms, structural repeating units and data Sgroups, of the
+// `M  STY' lines of V2000, and of the Sgroup block of V3000, are read
+// with their atoms, crossing bonds, labels, connectivities, expansion
+// states, brackets and data; see `Sgroup`.  Sgroups of other types are
+// skipped, as are crossing bonds to hydrogen atoms, which are not
+// built.
+func ReadMolfile(reg *molecule.MoleculeRegistry, rec []byte) (*molecule.Molecule, error) {
+	if t := bytes.TrimRight(rec, "\r\n"); bytes.HasSuffix(t, sdfTerminator) {
+		rec = t[:len(t)-len(sdfTerminator)]
+	}
+	lines := strings.Split(string(rec), "\n")
+	for i, l := range lines {
+		lines[i] = strings.TrimRight(l, "\r")
+	}
+	rep := new(cmn.ValidationReport)
+	syntaxError := func(ln int, format string, args ...interface{}) error {
+		rep.Add(cmn.Issue{Severity: cmn.SeverityError, Code: cmn.CodeSyntax, Message: fmt.Sprintf(format, args...), Line: ln})
+		return rep
+	}
+
+	if len(lines) < 4 {
+		return nil, syntaxError(len(lines), "No counts line in molfile.")
+	}
+	var (
+		atoms  []_MolfileAtom
+		bonds  []_MolfileBond
+		groups []molecule.StereoGroup
+		sgs    []molecule.Sgroup
+		end    int
+		err    error
+	)
+	if strings.Contains(lines[3], "V3000") {
+		atoms, bonds, groups, sgs, end, err = readV3000(lines, syntaxError)
+	} else {
+		atoms, bonds, sgs, end, err = readV2000(lines, syntaxError)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	mol := newMolecule(reg)
+	ab := mol.NewAtomBuilder()
+	for _, a := range atoms {
+		// The symbols are known, so that an atom is being built.
+		ab.Element(a.sym)
+		if a.radical {
+			ab.Charge(4)
+		}
+		ab.Valence(a.valence)
+		if a.charge != 0 {
+			ab.FormalCharge(a.charge)
+		}
+		if a.isotope != 0 {
+			ab.Isotope(a.isotope)
+		}
+		if a.rgroup != 0 {
+			ab.RGroup(a.rgroup)
+		}
+		ab.Attachment(a.apo).Coords(a.x, a.y, a.z).Add()
+	}
+	bb := mol.NewBondBuilder()
+	for _, b := range bonds {
+		bb.Connect(b.a1-1, b.a2-1).Type(cmn.BondType(b.typ)).Stereo(cmn.BondStereo(b.stereo)).Add()
+	}
+	if err := mol.Build(); err != nil {
+		mol.Release()
+		return nil, err
+	}
+	if len(groups) > 0 {
+		if err := mol.SetStereoGroups(groups...); err != nil {
+			mol.Release()
+			return nil, err
+		}
+	}
+	if len(sgs) > 0 {
+		if err := mol.SetSgroups(sgroupBondIds(mol, sgs, bonds)...); err != nil {
+			mol.Release()
+			return nil, err
+		}
+	}
+
+	if title := strings.TrimSpace(lines[0]); title != "" {
+		if err := mol.SetAttribute("name", title); err != nil {
+			mol.Release()
+			return nil, err
+		}
+	}
+	if end < len(lines) && strings.TrimSpace(strings.Join(lines[end:], "")) != "" {
+		if err := AttachSDFields(mol, rec, nil); err != nil {
+			mol.Release()
+			return nil, err
+		}
+	}
+	return mol, nil
+}
+
+// readV2000 answers the atoms, bonds and Sgroups of the given lines of
+// a V2000 molfile, and the number of lines up to and including its
+// `M  END' line.  See `readV2000Sgroups`.
+func readV2000(lines []string, syntaxError _MolfileSyntaxError) ([]_MolfileAtom, []_MolfileBond, []molecule.Sgroup, int, error) {
+	counts := lines[3]
+	na, err1 := strconv.Atoi(molfileColumn(counts, 0, 3))
+	nb, err2 := strconv.Atoi(molfileColumn(counts, 3, 6))
+	if err1 != nil || err2 != nil || na < 0 || nb < 0 {
+		return nil, nil, nil, 0, syntaxError(4, "Invalid counts line : %q", counts)
+	}
+	if len(lines) < 4+na+nb {
+		return nil, nil, nil, 0, syntaxError(len(lines), "Expected %d atoms and %d bonds, but the molfile ends.", na, nb)
+	}
+
+	atoms := make([]_MolfileAtom, na)
+	for i := range atoms {
+		ln := 5 + i
+		l := lines[ln-1]
+		x, err1 := strconv.ParseFloat(molfileColumn(l, 0, 10), 32)
+		y, err2 := strconv.ParseFloat(molfileColumn(l, 10, 20), 32)
+		z, err3 := strconv.ParseFloat(molfileColumn(l, 20, 30), 32)
+		if err1 != nil || err2 != nil || err3 != nil {
+			return nil, nil, nil, 0, syntaxError(ln, "Invalid atom coordinates : %q", l)
+		}
+
+		a := &atoms[i]
+		a.x, a.y, a.z = float32(x), float32(y), float32(z)
+		a.sym = molfileColumn(l, 31, 34)
+		if sym, ok := molfileSymbols[a.sym]; ok {
+			switch a.sym {
+			case "D":
+				a.isotope = 2
+			case "T":
+				a.isotope = 3
+			}
+			a.sym = sym
+		}
+		el, ok := cmn.PeriodicTable[a.sym]
+		if !ok {
+			return nil, nil, nil, 0, syntaxError(ln, "Unknown element symbol : %q", a.sym)
+		}
+
+		// Optional fields are read leniently, as blanks are common.
+		if d, err := strconv.Atoi(molfileColumn(l, 34, 36)); err == nil && d != 0 && el.Number > 0 {
+			a.isotope = int(math.Round(el.Weight)) + d
+		}
+		switch c, _ := strconv.Atoi(molfileColumn(l, 36, 39)); {
+		case c == 4:
+			a.radical = true
+		case c >= 1 && c <= 7:
+			a.charge = 4 - c
+		}
+		a.valence, _ = strconv.Atoi(molfileColumn(l, 48, 51))
+	}
+
+	bonds := make([]_MolfileBond, nb)
+	for i := range bonds {
+		ln := 5 + na + i
+		l := lines[ln-1]
+		b := &bonds[i]
+		var err1, err2, err3 error
+		b.a1, err1 = strconv.Atoi(molfileColumn(l, 0, 3))
+		b.a2, err2 = strconv.Atoi(molfileColumn(l, 3, 6))
+		b.typ, err3 = strconv.Atoi(molfileColumn(l, 6, 9))
+		if err1 != nil || err2 != nil || err3 != nil {
+			return nil, nil, nil, 0, syntaxError(ln, "Invalid bond line : %q", l)
+		}
+		if b.a1 < 1 || b.a1 > na || b.a2 < 1 || b.a2 > na {
+			return nil, nil, nil, 0, syntaxError(ln, "Bond joins unknown atoms : %q", l)
+		}
+		b.stereo, _ = strconv.Atoi(molfileColumn(l, 9, 12))
+	}
+
+	// Property lines.  The first `M  CHG' or `M  ISO' line resets the
+	// corresponding values of all atoms given in the atom block.
+	end := 0
+	chgSeen, isoSeen := false, false
+	for i := 4 + na + nb; i < len(lines); i++ {
+		l := lines[i]
+		if strings.TrimRight(l, " ") == string(molfileEnd) {
+			end = i + 1
+			break
+		}
+		switch {
+		case strings.HasPrefix(l, "M  CHG"), strings.HasPrefix(l, "M  ISO"), strings.HasPrefix(l, "M  RAD"):
+		case strings.HasPrefix(l, "M  RGP"), strings.HasPrefix(l, "M  APO"):
+		default:
+			continue
+		}
+
+		fs := strings.Fields(l[6:])
+		n, err := strconv.Atoi(firstField(fs))
+		if err != nil || len(fs) != 1+2*n {
+			return nil, nil, nil, 0, syntaxError(i+1, "Invalid property line : %q", l)
+		}
+		prop := l[3:6]
+		switch {
+		case prop == "CHG" && !chgSeen:
+			for j := range atoms {
+				atoms[j].charge = 0
+			}
+			chgSeen = true
+		case prop == "ISO" && !isoSeen:
+			for j := range atoms {
+				atoms[j].isotope = 0
+			}
+			isoSeen = true
+		}
+		for k := 1; k < len(fs); k += 2 {
+			idx, err1 := strconv.Atoi(fs[k])
+			v, err2 := strconv.Atoi(fs[k+1])
+			if err1 != nil || err2 != nil || idx < 1 || idx > na {
+				return nil, nil, nil, 0, syntaxError(i+1, "Invalid property line : %q", l)
+			}
+			switch prop {
+			case "CHG":
+				atoms[idx-1].charge = v
+			case "ISO":
+				atoms[idx-1].isotope = v
+			case "RAD":
+				atoms[idx-1].radical = v != 0
+			case "RGP":
+				atoms[idx-1].rgroup = v
+			case "APO":
+				atoms[idx-1].apo = v
+			}
+		}
+	}
+	if end == 0 {
+		return nil, nil, nil, 0, syntaxError(len(lines), "No `M  END' line in molfile.")
+	}
+
+	sgs, err := readV2000Sgroups(lines[4+na+nb:end-1], 5+na+nb, na, nb, syntaxError)
+	if err != nil {
+		return nil, nil, nil, 0, err
+	}
+	return atoms, bonds, sgs, end, nil
+}
+
+// molfileColumn answers the trimmed text of the given line in the
+// given range of columns, counted from `0`.  Missing columns are
+// blank.
+func molfileColumn(line string, from, to int) string {
+	if from >= len(line) {
+		return ""
+	}
+	if to > len(line) {
+		to = len(line)
+	}
+	return strings.TrimSpace(line[from:to])
+}
+
+// firstField answers the first of the given fields, if any.
+func firstField(fs []string) string {
+	if len(fs) == 0 {
+		return ""
+	}
+	return fs[0]
+}
+
+// WriteConformersSDF writes the conformers of the given molecule with
+// the given IDs, in that order, as the records of an SD file.  All
+// conformers are written, in the order of their addition, if no IDs
+// are given.
+//
+// Each record is an MDL V2000 connection table with the coordinates of
+// the conformer.  Its data fields are the attributes of the molecule,
+// followed by the conformer's ID and, if known, its energy.  The
+// molecule's `name` attribute, if any, is written as the title.
+func WriteConformersSDF(w io.Writer, mol *molecule.Molecule, ids ...int) error {
+	confs, err := mol.Conformers()
+	if err != nil {
+		return err
+	}
+	if len(ids) > 0 {
+		sel := make([]molecule.Conformer, 0, len(ids))
+		for _, id := range ids {
+			c, err := mol.Conformer(id)
+			if err != nil {
+				return err
+			}
+			sel = append(sel, c)
+		}
+		confs = sel
+	}
+
+	atoms := make([]molecule.AtomInfo, 0, mol.AtomCount())
+	for it := mol.Atoms(); it.Next(); {
+		atoms = append(atoms, it.Atom())
+	}
+	bonds := make([]molecule.BondInfo, 0, mol.BondCount())
+	for it := mol.Bonds(); it.Next(); {
+		bonds = append(bonds, it.Bond())
+	}
+	attrs, err := mol.Attributes()
+	if err != nil {
+		return err
+	}
+	sgs, err := mol.Sgroups()
+	if err != nil {
+		return err
+	}
+	title, _ := mol.AttributeString("name")
+
+	bw := bufio.NewWriter(w)
+	for _, c := range confs {
+		writeMolBlock(bw, title, "3D", atoms, bonds, sgs, c.Coords)
+
+		fields := append([]molecule.Attribute{}, attrs...)
+		fields = append(fields, molecule.Attribute{Name: ConformerIdField, Value: strconv.Itoa(c.Id)})
+		if c.HasEnergy {
+			fields = append(fields, molecule.Attribute{Name: ConformerEnergyField, Value: strconv.FormatFloat(c.Energy, 'f', 4, 64)})
+		}
+		if err := WriteSDFields(bw, fields); err != nil {
+			return err
+		}
+		bw.Write(sdfTerminator)
+		bw.WriteByte('\n')
+	}
+	return bw.Flush()
+}
+
+// WriteSDF writes the given molecule to the given writer, as a record
+// of an SD file, at the coordinates of its atoms.
+//
+// The record is an MDL V2000 connection table, followed by the
+// attributes of the molecule as data fields.  Dative bonds are written
+// with type `9`, as V3000 numbers coordination bonds.  Aromatic and
+// query bonds are written with the types they were given, `4` and `5`,
+// and others by their Kekulé types.  The molecule's `name` attribute,
+// if any, is written as the title.  The coordinates are
+// marked as 3D if any atom has a non-zero Z-coordinate, and as 2D
+// otherwise.
+func WriteSDF(w io.Writer, mol *molecule.Molecule) error {
+	return writeMolecule(w, mol, true)
+}
+
+// WriteMolfile writes the given molecule to the given writer, as an
+// MDL molfile.  It is as `WriteSDF`, but without the data fields and
+// the terminator.
+func WriteMolfile(w io.Writer, mol *molecule.Molecule) error {
+	return writeMolecule(w, mol, false)
+}
+
+// writeMolecule implements `WriteSDF` and `WriteMolfile`.  The
+// attributes of the molecule are written as data fields if `asRecord`
+// is set.
+func writeMolecule(w io.Writer, mol *molecule.Molecule, asRecord bool) error {
+	atoms := make([]molecule.AtomInfo, 0, mol.AtomCount())
+	coords := make(map[uint16]molecule.Point, mol.AtomCount())
+	dim := "2D"
+	for it := mol.Atoms(); it.Next(); {
+		a := it.Atom()
+		atoms = append(atoms, a)
+		coords[a.Iid] = molecule.Point{float64(a.X), float64(a.Y), float64(a.Z)}
+		if a.Z != 0 {
+			dim = "3D"
+		}
+	}
+	bonds := make([]molecule.BondInfo, 0, mol.BondCount())
+	for it := mol.Bonds(); it.Next(); {
+		bonds = append(bonds, it.Bond())
+	}
+	sgs, err := mol.Sgroups()
+	if err != nil {
+		return err
+	}
+	title, _ := mol.AttributeString("name")
+
+	bw := bufio.NewWriter(w)
+	writeMolBlock(bw, title, dim, atoms, bonds, sgs, coords)
+	if asRecord {
+		attrs, err := mol.Attributes()
+		if err != nil {
+			return err
+		}
+		if err := WriteSDFields(bw, attrs); err != nil {
+			return err
+		}
+		bw.Write(sdfTerminator)
+		bw.WriteByte('\n')
+	}
+	return bw.Flush()
+}
+
+// molfileParity answers the parity of the given atom, as written in the
+// atom block, whose atoms are at the given positions.  The parity of
+// the atom is by the input IDs of its neighbours; it is inverted
+// should their positions order them by an odd permutation of those.
+func molfileParity(a molecule.AtomInfo, pos map[uint16]int) int {
+	switch a.Parity {
+	case cmn.StereoParityOdd, cmn.StereoParityEven:
+	case cmn.StereoParityUnknown:
+		return int(a.Parity)
+	default:
+		return 0
+	}
+
+	nbrs := append([]uint16(nil), a.Neighbours...)
+	sort.Slice(nbrs, func(i, j int) bool { return nbrs[i] < nbrs[j] })
+	odd := false
+	for i := range nbrs {
+		for j := i + 1; j < len(nbrs); j++ {
+			if pos[nbrs[i]] > pos[nbrs[j]] {
+				odd = !odd
+			}
+		}
+	}
+	if odd {
+		return int(a.Parity.Inverse())
+	}
+	return int(a.Parity)
+}
+
+// writeMolBlock writes an MDL V2000 connection table of the given atoms,
+// bonds and Sgroups, at the given coordinates, whose dimensionality is
+// `2D` or `3D`.  Charges, isotopes, radicals, R-groups, attachment
+// points and Sgroups are written as property lines.  The parities of the stereocentres are written in the
+// atom block.
+func writeMolBlock(bw *bufio.Writer, title, dim string, atoms []molecule.AtomInfo, bonds []molecule.BondInfo, sgs []molecule.Sgroup, coords map[uint16]molecule.Point) {
+	// The program name is limited to eight characters, followed by the
+	// date and time, as MMDDYYHHmm.
+	fmt.Fprintf(bw, "%s\n  %-8.8s%s%s\n\n", title, "RxnWeaver", time.Now().Format("0102061504"), dim)
+	fmt.Fprintf(bw, "%3d%3d  0  0  0  0  0  0  0  0999 V2000\n", len(atoms), len(bonds))
+
+	pos := make(map[uint16]int, len(atoms))
+	for i, a := range atoms {
+		pos[a.Iid] = i + 1
+	}
+	charged := make([]int, 0, len(atoms))
+	isotopic := make([]int, 0, len(atoms))
+	radicals := make([]int, 0, len(atoms))
+	rgroups := make([]int, 0, len(atoms))
+	attached := make([]int, 0, len(atoms))
+	for i, a := range atoms {
+		if a.Charge != 0 {
+			charged = append(charged, i)
+		}
+		if a.Isotope != 0 {
+			isotopic = append(isotopic, i)
+		}
+		if a.Radical != cmn.RadicalNone {
+			radicals = append(radicals, i)
+		}
+		if a.RGroup != 0 {
+			rgroups = append(rgroups, i)
+		}
+		if a.Attachment != 0 {
+			attached = append(attached, i)
+		}
+
+		sym := a.Symbol
+		if a.AtomicNumber == 0 {
+			if s, ok := molfilePseudoSymbols[sym]; ok {
+				sym = s
+			}
+		}
+		p := coords[a.Iid]
+		fmt.Fprintf(bw, "%10.4f%10.4f%10.4f %-3s 0  0%3d  0  0  0  0  0  0  0  0  0\n", p[0], p[1], p[2], sym, molfileParity(a, pos))
+	}
+	bondPos := make(map[uint16]int, len(bonds))
+	for i, b := range bonds {
+		fmt.Fprintf(bw, "%3d%3d%3d%3d\n", pos[b.A1], pos[b.A2], b.Type, b.Stereo)
+		bondPos[b.Id] = i + 1
+	}
+
+	// Property lines hold at most eight entries each.
+	for start := 0; start < len(charged); start += 8 {
+		end := start + 8
+		if end > len(charged) {
+			end = len(charged)
+		}
+		fmt.Fprintf(bw, "M  CHG%3d", end-start)
+		for _, i := range charged[start:end] {
+			fmt.Fprintf(bw, " %3d %3d", i+1, atoms[i].Charge)
+		}
+		bw.WriteByte('\n')
+	}
+	for start := 0; start < len(isotopic); start += 8 {
+		end := start + 8
+		if end > len(isotopic) {
+			end = len(isotopic)
+		}
+		fmt.Fprintf(bw, "M  ISO%3d", end-start)
+		for _, i := range isotopic[start:end] {
+			fmt.Fprintf(bw, " %3d %3d", i+1, atoms[i].Isotope)
+		}
+		bw.WriteByte('\n')
+	}
+	for start := 0; start < len(radicals); start += 8 {
+		end := start + 8
+		if end > len(radicals) {
+			end = len(radicals)
+		}
+		fmt.Fprintf(bw, "M  RAD%3d", end-start)
+		for _, i := range radicals[start:end] {
+			fmt.Fprintf(bw, " %3d %3d", i+1, atoms[i].Radical)
+		}
+		bw.WriteByte('\n')
+	}
+	for start := 0; start < len(rgroups); start += 8 {
+		end := start + 8
+		if end > len(rgroups) {
+			end = len(rgroups)
+		}
+		fmt.Fprintf(bw, "M  RGP%3d", end-start)
+		for _, i := range rgroups[start:end] {
+			fmt.Fprintf(bw, " %3d %3d", i+1, atoms[i].RGroup)
+		}
+		bw.WriteByte('\n')
+	}
+	for start := 0; start < len(attached); start += 8 {
+		end := start + 8
+		if end > len(attached) {
+			end = len(attached)
+		}
+		fmt.Fprintf(bw, "M  APO%3d", end-start)
+		for _, i := range attached[start:end] {
+			fmt.Fprintf(bw, " %3d %3d", i+1, atoms[i].Attachment)
+		}
+		bw.WriteByte('\n')
+	}
+	writeSgroups(bw, sgs, pos, bondPos)
+	bw.Write(molfileEnd)
+	bw.WriteByte('\n')
+}
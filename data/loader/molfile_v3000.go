@@ -0,0 +1,354 @@
+package loader
+
+import (
+	"strconv"
+	"strings"
+
+	cmn "github.com/RxnWeaver/rxnweaver/common"
+	"github.com/RxnWeaver/rxnweaver/data/molecule"
+)
+
+// v30Prefix begins each line of a V3000 connection table.
+const v30Prefix = "M  V30 "
+
+// _V30Line is a logical line of a V3000 connection table, its
+// continuation lines joined, with the line of the molfile at which it
+// begins, counted from `1`.
+type _V30Line struct {
+	text string
+	ln   int
+}
+
+// v30BondStereo maps the `CFG' values of V3000 bonds to the stereo
+// designations of V2000 bonds, for single bonds.  An `either' double
+// bond is marked as such separately.
+var v30BondStereo = map[int]cmn.BondStereo{
+	0: cmn.BondStereoNone,
+	1: cmn.BondStereoUp,
+	2: cmn.BondStereoEither,
+	3: cmn.BondStereoDown,
+}
+
+// readV3000 answers the atoms, bonds, enhanced stereo groups and
+// Sgroups of the given lines of a V3000 molfile, and the number of
+// lines up to and including its `M  END' line.  The groups hold the
+// input IDs of their atoms, their positions in the atom block counted
+// from `0`, and the Sgroups the positions of their bonds in the bond
+// block, counted from `1`.
+func readV3000(lines []string, syntaxError _MolfileSyntaxError) ([]_MolfileAtom, []_MolfileBond, []molecule.StereoGroup, []molecule.Sgroup, int, error) {
+	fail := func(ln int, format string, args ...interface{}) ([]_MolfileAtom, []_MolfileBond, []molecule.StereoGroup, []molecule.Sgroup, int, error) {
+		return nil, nil, nil, nil, 0, syntaxError(ln, format, args...)
+	}
+
+	// Logical lines, up to `M  END'.
+	v30 := []_V30Line(nil)
+	end := 0
+	for i := 4; i < len(lines); i++ {
+		l := lines[i]
+		if strings.TrimRight(l, " ") == string(molfileEnd) {
+			end = i + 1
+			break
+		}
+		if !strings.HasPrefix(l, v30Prefix) {
+			continue
+		}
+		text, ln := strings.TrimSpace(l[len(v30Prefix):]), i+1
+		for strings.HasSuffix(text, "-") && i+1 < len(lines) && strings.HasPrefix(lines[i+1], v30Prefix) {
+			i++
+			text = text[:len(text)-1] + strings.TrimRight(lines[i][len(v30Prefix):], " ")
+		}
+		v30 = append(v30, _V30Line{text, ln})
+	}
+	if end == 0 {
+		return fail(len(lines), "No `M  END' line in molfile.")
+	}
+
+	var atoms []_MolfileAtom
+	var bonds []_MolfileBond
+	var groups []molecule.StereoGroup
+	var sgs []molecule.Sgroup
+	pos := make(map[int]int)  // Positions of the atoms by their indices.
+	bpos := make(map[int]int) // Positions of the bonds by their indices.
+	na, nb := -1, -1
+	block := ""
+	for _, vl := range v30 {
+		fs := v30Fields(vl.text)
+		if len(fs) == 0 {
+			continue
+		}
+		switch {
+		case fs[0] == "BEGIN" && len(fs) > 1:
+			if block != "" && block != "CTAB" {
+				return fail(vl.ln, "Nested block : %q", vl.text)
+			}
+			block = fs[1]
+			continue
+		case fs[0] == "END" && len(fs) > 1:
+			if fs[1] == "CTAB" {
+				block = ""
+			} else {
+				block = "CTAB"
+			}
+			continue
+		}
+
+		switch block {
+		case "CTAB":
+			if fs[0] != "COUNTS" {
+				continue
+			}
+			var err1, err2 error
+			if len(fs) < 3 {
+				return fail(vl.ln, "Invalid counts line : %q", vl.text)
+			}
+			na, err1 = strconv.Atoi(fs[1])
+			nb, err2 = strconv.Atoi(fs[2])
+			if err1 != nil || err2 != nil || na < 0 || nb < 0 {
+				return fail(vl.ln, "Invalid counts line : %q", vl.text)
+			}
+
+		case "ATOM":
+			a, idx, err := readV30Atom(fs, vl, syntaxError)
+			if err != nil {
+				return nil, nil, nil, nil, 0, err
+			}
+			if _, ok := pos[idx]; ok {
+				return fail(vl.ln, "Duplicate atom index : %d", idx)
+			}
+			atoms = append(atoms, a)
+			pos[idx] = len(atoms)
+
+		case "BOND":
+			if len(fs) < 4 {
+				return fail(vl.ln, "Invalid bond line : %q", vl.text)
+			}
+			idx, err0 := strconv.Atoi(fs[0])
+			typ, err1 := strconv.Atoi(fs[1])
+			i1, err2 := strconv.Atoi(fs[2])
+			i2, err3 := strconv.Atoi(fs[3])
+			if err0 != nil || err1 != nil || err2 != nil || err3 != nil {
+				return fail(vl.ln, "Invalid bond line : %q", vl.text)
+			}
+			b := _MolfileBond{a1: pos[i1], a2: pos[i2], typ: typ}
+			if b.a1 == 0 || b.a2 == 0 {
+				return fail(vl.ln, "Bond joins unknown atoms : %q", vl.text)
+			}
+			for _, f := range fs[4:] {
+				k, v := v30Property(f)
+				if k != "CFG" {
+					continue
+				}
+				cfg, err := strconv.Atoi(v)
+				st, ok := v30BondStereo[cfg]
+				if err != nil || !ok {
+					return fail(vl.ln, "Invalid bond configuration : %q", f)
+				}
+				if typ == int(cmn.BondTypeDouble) && st == cmn.BondStereoEither {
+					st = cmn.BondStereoDoubleEither
+				}
+				b.stereo = int(st)
+			}
+			bonds = append(bonds, b)
+			bpos[idx] = len(bonds)
+
+		case "COLLECTION":
+			g, ok := v30StereoGroup(fs[0])
+			if !ok {
+				continue
+			}
+			for _, f := range fs[1:] {
+				k, v := v30Property(f)
+				if k != "ATOMS" {
+					continue
+				}
+				idxs, ok := v30List(v)
+				if !ok {
+					return fail(vl.ln, "Invalid atom list : %q", f)
+				}
+				for _, idx := range idxs {
+					p, ok := pos[idx]
+					if !ok {
+						return fail(vl.ln, "Stereo group holds unknown atom : %d", idx)
+					}
+					g.Atoms = append(g.Atoms, uint16(p-1))
+				}
+			}
+			groups = append(groups, g)
+
+		case "SGROUP":
+			g, ok, err := readV30Sgroup(fs, vl, pos, bpos, syntaxError)
+			if err != nil {
+				return nil, nil, nil, nil, 0, err
+			}
+			if ok {
+				sgs = append(sgs, g)
+			}
+		}
+	}
+
+	if na < 0 {
+		return fail(4, "No counts line in V3000 connection table.")
+	}
+	if len(atoms) != na || len(bonds) != nb {
+		return fail(end, "Expected %d atoms and %d bonds, but read %d and %d.", na, nb, len(atoms), len(bonds))
+	}
+	return atoms, bonds, groups, sgs, end, nil
+}
+
+// readV30Atom answers the atom of the given fields of a line of the
+// atom block of a V3000 molfile, and its index.
+func readV30Atom(fs []string, vl _V30Line, syntaxError _MolfileSyntaxError) (_MolfileAtom, int, error) {
+	a := _MolfileAtom{}
+	if len(fs) < 6 {
+		return a, 0, syntaxError(vl.ln, "Invalid atom line : %q", vl.text)
+	}
+	idx, err := strconv.Atoi(fs[0])
+	if err != nil {
+		return a, 0, syntaxError(vl.ln, "Invalid atom index : %q", fs[0])
+	}
+	x, err1 := strconv.ParseFloat(fs[2], 32)
+	y, err2 := strconv.ParseFloat(fs[3], 32)
+	z, err3 := strconv.ParseFloat(fs[4], 32)
+	if err1 != nil || err2 != nil || err3 != nil {
+		return a, 0, syntaxError(vl.ln, "Invalid atom coordinates : %q", vl.text)
+	}
+	a.x, a.y, a.z = float32(x), float32(y), float32(z)
+
+	a.sym = fs[1]
+	if sym, ok := molfileSymbols[a.sym]; ok {
+		switch a.sym {
+		case "D":
+			a.isotope = 2
+		case "T":
+			a.isotope = 3
+		}
+		a.sym = sym
+	}
+	if _, ok := cmn.PeriodicTable[a.sym]; !ok {
+		return a, 0, syntaxError(vl.ln, "Unknown element symbol : %q", fs[1])
+	}
+
+	for _, f := range fs[6:] {
+		k, v := v30Property(f)
+		n, err := strconv.Atoi(v)
+		switch k {
+		case "CHG", "MASS", "RAD", "VAL":
+			if err != nil {
+				return a, 0, syntaxError(vl.ln, "Invalid atom property : %q", f)
+			}
+		}
+		switch k {
+		case "CHG":
+			a.charge = n
+		case "MASS":
+			a.isotope = n
+		case "RAD":
+			a.radical = n != 0
+		case "VAL":
+			a.valence = n
+		case "RGROUPS":
+			// Atoms standing for several R-groups are not supported.
+			rgs, ok := v30List(v)
+			if !ok || len(rgs) != 1 {
+				return a, 0, syntaxError(vl.ln, "Invalid atom property : %q", f)
+			}
+			a.rgroup = rgs[0]
+		case "ATTCHPT":
+			if err != nil {
+				return a, 0, syntaxError(vl.ln, "Invalid atom property : %q", f)
+			}
+			if a.apo = n; n == -1 {
+				a.apo = 3 // Both points.
+			}
+		}
+	}
+	return a, idx, nil
+}
+
+// v30StereoGroup answers an empty stereo group of the type and number
+// given by the name of a collection of a V3000 molfile, and whether
+// the collection is a stereo group at all.
+func v30StereoGroup(name string) (molecule.StereoGroup, bool) {
+	g := molecule.StereoGroup{}
+	var num string
+	switch {
+	case name == "MDLV30/STEABS":
+		g.Type = cmn.StereoGroupAbsolute
+		return g, true
+	case strings.HasPrefix(name, "MDLV30/STERAC"):
+		g.Type, num = cmn.StereoGroupAnd, name[len("MDLV30/STERAC"):]
+	case strings.HasPrefix(name, "MDLV30/STEREL"):
+		g.Type, num = cmn.StereoGroupOr, name[len("MDLV30/STEREL"):]
+	default:
+		return g, false
+	}
+	n, err := strconv.Atoi(num)
+	if err != nil || n < 1 {
+		return g, false
+	}
+	g.Number = n
+	return g, true
+}
+
+// v30Fields answers the fields of the given logical line of a V3000
+// connection table, separated by blanks.  Blanks within parentheses or
+// double quotes do not separate fields.
+func v30Fields(s string) []string {
+	res := []string(nil)
+	depth, quoted, start := 0, false, -1
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '"':
+			quoted = !quoted
+		case quoted:
+		case c == '(':
+			depth++
+		case c == ')' && depth > 0:
+			depth--
+		case c == ' ' && depth == 0:
+			if start >= 0 {
+				res = append(res, s[start:i])
+				start = -1
+			}
+			continue
+		}
+		if start < 0 {
+			start = i
+		}
+	}
+	if start >= 0 {
+		res = append(res, s[start:])
+	}
+	return res
+}
+
+// v30Property answers the keyword and the value of the given field of
+// the form `KEY=VALUE'.  The keyword is blank for other fields.
+func v30Property(f string) (string, string) {
+	i := strings.IndexByte(f, '=')
+	if i < 0 {
+		return "", f
+	}
+	return f[:i], f[i+1:]
+}
+
+// v30List answers the integers of the given list of the form
+// `(n a1 a2 ... an)'.
+func v30List(s string) ([]int, bool) {
+	if !strings.HasPrefix(s, "(") || !strings.HasSuffix(s, ")") {
+		return nil, false
+	}
+	fs := strings.Fields(s[1 : len(s)-1])
+	n, err := strconv.Atoi(firstField(fs))
+	if err != nil || len(fs) != n+1 {
+		return nil, false
+	}
+	res := make([]int, n)
+	for i := range res {
+		if res[i], err = strconv.Atoi(fs[i+1]); err != nil {
+			return nil, false
+		}
+	}
+	return res, true
+}
@@ -0,0 +1,147 @@
+package loader
+
+import (
+	"strings"
+)
+
+// _Monomer is a monomer of the built-in library, as HELM defines it:
+// a fragment bearing up to three R-groups, at which it is bonded to
+// the other monomers of its polymer, and which are capped when left
+// unused.
+//
+// The configuration of a stereocentre bearing an R-group is kept when
+// a monomer is bonded in its place, but not when it is capped, so caps
+// must not be at stereocentres.
+type _Monomer struct {
+	symbol string    // HELM symbol.
+	code   string    // Three-letter code, if any.
+	name   string    // Descriptive name.
+	smiles string    // With its R-groups as the atom classes of `*` atoms, `[*:n]`.
+	caps   [3]string // Of R1 to R3, the SMILES of the groups capping them, bonded at their first atoms; blank for hydrogen.
+}
+
+// Caps of the R-groups of amino acids: hydrogen at the amino group and
+// the side chain, and hydroxyl at the carboxyl group.  Acidic side
+// chains are capped by hydroxyl, as well.
+var (
+	aminoCaps  = [3]string{"", "O", ""}
+	acidicCaps = [3]string{"", "O", "O"}
+)
+
+// alphaAmino answers the SMILES of the L-amino acid with the given side
+// chain, as a monomer.
+func alphaAmino(side string) string {
+	return "[*:1]N[C@@H](" + side + ")C(=O)[*:2]"
+}
+
+// naturalAminoAcids lists the proteinogenic amino acids, by their
+// one-letter codes.
+var naturalAminoAcids = []_Monomer{
+	{"A", "Ala", "Alanine", alphaAmino("C"), aminoCaps},
+	{"R", "Arg", "Arginine", alphaAmino("CCCNC(=N)N"), aminoCaps},
+	{"N", "Asn", "Asparagine", alphaAmino("CC(N)=O"), aminoCaps},
+	{"D", "Asp", "Aspartic acid", alphaAmino("CC(=O)[*:3]"), acidicCaps},
+	{"C", "Cys", "Cysteine", alphaAmino("CS[*:3]"), aminoCaps},
+	{"Q", "Gln", "Glutamine", alphaAmino("CCC(N)=O"), aminoCaps},
+	{"E", "Glu", "Glutamic acid", alphaAmino("CCC(=O)[*:3]"), acidicCaps},
+	{"G", "Gly", "Glycine", "[*:1]NCC(=O)[*:2]", aminoCaps},
+	{"H", "His", "Histidine", alphaAmino("Cc1c[nH]cn1"), aminoCaps},
+	{"I", "Ile", "Isoleucine", alphaAmino("[C@@H](C)CC"), aminoCaps},
+	{"L", "Leu", "Leucine", alphaAmino("CC(C)C"), aminoCaps},
+	{"K", "Lys", "Lysine", alphaAmino("CCCCN[*:3]"), aminoCaps},
+	{"M", "Met", "Methionine", alphaAmino("CCSC"), aminoCaps},
+	{"F", "Phe", "Phenylalanine", alphaAmino("Cc1ccccc1"), aminoCaps},
+	{"P", "Pro", "Proline", "[*:1]N1CCC[C@H]1C(=O)[*:2]", aminoCaps},
+	{"S", "Ser", "Serine", alphaAmino("CO"), aminoCaps},
+	{"T", "Thr", "Threonine", alphaAmino("[C@@H](C)O"), aminoCaps},
+	{"W", "Trp", "Tryptophan", alphaAmino("Cc1c[nH]c2ccccc12"), aminoCaps},
+	{"Y", "Tyr", "Tyrosine", alphaAmino("Cc1ccc(O)cc1"), aminoCaps},
+	{"V", "Val", "Valine", alphaAmino("C(C)C"), aminoCaps},
+}
+
+// otherPeptideMonomers lists the other monomers of peptides: some
+// common unnatural amino acids, and the terminal caps, acetyl and
+// amide.
+var otherPeptideMonomers = []_Monomer{
+	{"Aib", "Aib", "2-Aminoisobutyric acid", "[*:1]NC(C)(C)C(=O)[*:2]", aminoCaps},
+	{"Abu", "Abu", "2-Aminobutyric acid", alphaAmino("CC"), aminoCaps},
+	{"Nva", "Nva", "Norvaline", alphaAmino("CCC"), aminoCaps},
+	{"Nle", "Nle", "Norleucine", alphaAmino("CCCC"), aminoCaps},
+	{"Orn", "Orn", "Ornithine", alphaAmino("CCCN[*:3]"), aminoCaps},
+	{"Cit", "Cit", "Citrulline", alphaAmino("CCCNC(N)=O"), aminoCaps},
+	{"Sar", "Sar", "Sarcosine", "[*:1]N(C)CC(=O)[*:2]", aminoCaps},
+	{"ac", "Ac", "N-Terminal acetyl", "CC(=O)[*:2]", aminoCaps},
+	{"am", "NH2", "C-Terminal amide", "N[*:1]", aminoCaps},
+}
+
+// peptideMonomers holds the monomers of peptides, by their HELM
+// symbols: the natural amino acids, by their one-letter codes, their
+// D-enantiomers, prefixed `d`, and the others.
+var peptideMonomers = func() map[string]*_Monomer {
+	mirror := strings.NewReplacer("@@", "@", "@", "@@")
+	res := make(map[string]*_Monomer)
+	for i := range naturalAminoAcids {
+		mon := &naturalAminoAcids[i]
+		res[mon.symbol] = mon
+		if !strings.Contains(mon.smiles, "@") {
+			continue
+		}
+		res["d"+mon.symbol] = &_Monomer{"d" + mon.symbol, "D-" + mon.code, "D-" + mon.name, mirror.Replace(mon.smiles), mon.caps}
+	}
+	for i := range otherPeptideMonomers {
+		mon := &otherPeptideMonomers[i]
+		res[mon.symbol] = mon
+	}
+	return res
+}()
+
+// Caps of the R-groups of nucleic acid monomers: hydrogen at the
+// sugars, the 5'- and 3'-hydroxyl groups, and the bases, and hydroxyl
+// at the phosphates.
+var (
+	sugarCaps     = [3]string{"", "", ""}
+	phosphateCaps = [3]string{"O", "O", ""}
+	baseCaps      = [3]string{"", "", ""}
+)
+
+// nucleicSugars lists the sugars of nucleic acids, bearing their
+// 5'-oxygens at `R1`, their 3'-oxygens at `R2`, and their bases at
+// `R3`, at the anomeric carbons, in the beta configuration.
+var nucleicSugars = []_Monomer{
+	{"R", "", "Ribose", "[*:1]OC[C@@H]1[C@H](O[*:2])[C@@H](O)[C@@H](O1)[*:3]", sugarCaps},
+	{"dR", "", "Deoxyribose", "[*:1]OC[C@@H]1[C@@H](O[*:2])C[C@@H](O1)[*:3]", sugarCaps},
+	{"mR", "", "2'-O-Methylribose", "[*:1]OC[C@@H]1[C@H](O[*:2])[C@@H](OC)[C@@H](O1)[*:3]", sugarCaps},
+	{"fR", "", "2'-Deoxy-2'-fluororibose", "[*:1]OC[C@@H]1[C@H](O[*:2])[C@@H](F)[C@@H](O1)[*:3]", sugarCaps},
+}
+
+// nucleicBases lists the bases of nucleic acids, bearing their sugars
+// at `R1`, at N9 of the purines and N1 of the pyrimidines.
+var nucleicBases = []_Monomer{
+	{"A", "", "Adenine", "[*:1]N1C=NC2=C1N=CN=C2N", baseCaps},
+	{"C", "", "Cytosine", "[*:1]N1C=CC(N)=NC1=O", baseCaps},
+	{"G", "", "Guanine", "[*:1]N1C=NC2=C1N=C(N)NC2=O", baseCaps},
+	{"T", "", "Thymine", "[*:1]N1C=C(C)C(=O)NC1=O", baseCaps},
+	{"U", "", "Uracil", "[*:1]N1C=CC(=O)NC1=O", baseCaps},
+	{"5meC", "", "5-Methylcytosine", "[*:1]N1C=C(C)C(N)=NC1=O", baseCaps},
+	{"I", "", "Hypoxanthine", "[*:1]N1C=NC2=C1N=CNC2=O", baseCaps},
+}
+
+// nucleicLinkers lists the linkers of nucleic acids, bonded to the
+// 3'-oxygen of the preceding sugar at `R1`, and to the 5'-oxygen of the
+// following one at `R2`.
+var nucleicLinkers = []_Monomer{
+	{"P", "", "Phosphate", "P([*:1])([*:2])(=O)O", phosphateCaps},
+	{"sP", "", "Phosphorothioate", "P([*:1])([*:2])(=S)O", phosphateCaps},
+}
+
+// nucleicMonomers holds the monomers of nucleic acids, by their HELM
+// symbols.
+var nucleicMonomers = func() map[string]*_Monomer {
+	res := make(map[string]*_Monomer)
+	for _, list := range [][]_Monomer{nucleicSugars, nucleicBases, nucleicLinkers} {
+		for i := range list {
+			res[list[i].symbol] = &list[i]
+		}
+	}
+	return res
+}()
@@ -0,0 +1,315 @@
+package loader
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+
+	cmn "github.com/RxnWeaver/rxnweaver/common"
+	"github.com/RxnWeaver/rxnweaver/data/molecule"
+)
+
+// molfileEnd marks the end of the connection table in an MDL SD
+// record.  The data fields follow it.
+var molfileEnd = []byte("M  END")
+
+// ReadSDFields answers the data fields of the given SD record, as
+// attributes, in the order of their appearance.  The record is as
+// answered by `SplitSDF`.
+//
+// Each field is answered verbatim: its header line is retained in
+// `Header`, and the lines of its value are joined with newlines,
+// without any trimming beyond line terminators.  Fields of the same
+// name are all answered.
+//
+// Malformed records are reported by a `*cmn.ValidationReport`, whose
+// issues are located by their lines in the record.
+func ReadSDFields(rec []byte) ([]molecule.Attribute, error) {
+	sc := bufio.NewScanner(bytes.NewReader(rec))
+	sc.Buffer(make([]byte, 0, 4096), MaxRecordSize)
+	rep := new(cmn.ValidationReport)
+	syntaxError := func(ln int, format string, args ...interface{}) error {
+		rep.Add(cmn.Issue{Severity: cmn.SeverityError, Code: cmn.CodeSyntax, Message: fmt.Sprintf(format, args...), Line: ln})
+		return rep
+	}
+
+	ln := 0
+	inBlock := false
+	for sc.Scan() {
+		ln++
+		if bytes.Equal(bytes.TrimRight(sc.Bytes(), " \r"), molfileEnd) {
+			inBlock = true
+			break
+		}
+	}
+	if !inBlock {
+		return nil, syntaxError(0, "No `M  END' line in SD record.")
+	}
+
+	res := []molecule.Attribute(nil)
+	cur := (*molecule.Attribute)(nil)
+	vals := []string(nil)
+	for sc.Scan() {
+		ln++
+		line := strings.TrimRight(sc.Text(), "\r")
+
+		if cur == nil {
+			if line == "" {
+				continue
+			}
+			if line[0] != '>' {
+				return nil, syntaxError(ln, "Expected a data header : %q", line)
+			}
+			name := sdFieldName(line)
+			if name == "" {
+				return nil, syntaxError(ln, "No field name in header : %q", line)
+			}
+			res = append(res, molecule.Attribute{Name: name, Header: line})
+			cur, vals = &res[len(res)-1], vals[:0]
+			continue
+		}
+
+		if line == "" {
+			cur.Value = strings.Join(vals, "\n")
+			cur = nil
+			continue
+		}
+		vals = append(vals, line)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	if cur != nil {
+		cur.Value = strings.Join(vals, "\n")
+	}
+
+	return res, nil
+}
+
+// sdFieldName answers the name of the data field with the given
+// header line.  It is the text within angular brackets, if any;
+// otherwise, that following the initial `>'.
+func sdFieldName(header string) string {
+	if i := strings.IndexByte(header, '<'); i >= 0 {
+		if j := strings.IndexByte(header[i+1:], '>'); j >= 0 {
+			return header[i+1 : i+1+j]
+		}
+	}
+	return strings.TrimSpace(header[1:])
+}
+
+// WriteSDFields writes the given attributes as the data fields of an
+// SD record, each followed by a blank line.  The `$$$$' terminator is
+// NOT written.
+//
+// An attribute read by `ReadSDFields`, and not renamed since, is
+// written with its header verbatim.  Others are written with a
+// header of the form `>  <NAME>`.
+func WriteSDFields(w io.Writer, attrs []molecule.Attribute) error {
+	bw := bufio.NewWriter(w)
+	for _, attr := range attrs {
+		header := attr.Header
+		if header == "" || sdFieldName(header) != attr.Name {
+			header = fmt.Sprintf(">  <%s>", attr.Name)
+		}
+
+		bw.WriteString(header)
+		bw.WriteByte('\n')
+		if attr.Value != "" {
+			bw.WriteString(attr.Value)
+			bw.WriteByte('\n')
+		}
+		bw.WriteByte('\n')
+	}
+	return bw.Flush()
+}
+
+// TagMap remaps the names of data fields during conversion.  Fields
+// whose names are mapped to the empty string are dropped.  Those whose
+// names are not mapped are retained as they are.
+type TagMap map[string]string
+
+// Apply answers the given attributes, renamed and filtered according to
+// this map.  Their order is retained.  The header of a renamed
+// attribute is rewritten to carry the new name, with its formatting
+// otherwise intact.
+func (tm TagMap) Apply(attrs []molecule.Attribute) []molecule.Attribute {
+	res := make([]molecule.Attribute, 0, len(attrs))
+	for _, attr := range attrs {
+		to, ok := tm[attr.Name]
+		if !ok {
+			res = append(res, attr)
+			continue
+		}
+		if to == "" {
+			continue
+		}
+
+		if attr.Header != "" {
+			attr.Header = strings.Replace(attr.Header, "<"+attr.Name+">", "<"+to+">", 1)
+		}
+		attr.Name = to
+		res = append(res, attr)
+	}
+	return res
+}
+
+// AttachSDFields reads the data fields of the given SD record, remaps
+// them according to the given map, which may be `nil`, and adds them to
+// the given molecule as tags, in order.
+//
+// The molecule's attributes are then conformed to the attribute schema
+// of its registry, if any.  Violations are answered as a
+// `*molecule.SchemaError`; the attributes are retained regardless.
+func AttachSDFields(mol *molecule.Molecule, rec []byte, tags TagMap) error {
+	attrs, err := ReadSDFields(rec)
+	if err != nil {
+		return err
+	}
+
+	for _, attr := range tags.Apply(attrs) {
+		if err := mol.AddTag(attr); err != nil {
+			return err
+		}
+	}
+	return mol.ConformAttributes()
+}
+
+// Prefixes of the names of data fields carrying the attributes of
+// atoms and bonds.
+const (
+	AtomPropPrefix = "atom.prop."
+	BondPropPrefix = "bond.prop."
+)
+
+// Placeholder for an atom or a bond lacking an attribute.
+const missingProp = "n/a"
+
+// PropertyFields answers the attributes of the atoms and bonds of the
+// given molecule as SD data fields, one per attribute name.
+//
+// The field for an atom attribute is named `atom.prop.NAME`.  Its
+// value lists the attribute's values for all the atoms, in their
+// order in the molecule, separated by single spaces.  Atoms lacking
+// the attribute are represented by `n/a`.  Bond attributes are
+// analogous, with the prefix `bond.prop.`.  Values containing white
+// space can not be represented thus, and are reported as errors.
+func PropertyFields(mol *molecule.Molecule) ([]molecule.Attribute, error) {
+	atoms, bonds, err := entityIds(mol)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := propertyFields(AtomPropPrefix, atoms, mol.AtomAttributes)
+	if err != nil {
+		return nil, err
+	}
+	bres, err := propertyFields(BondPropPrefix, bonds, mol.BondAttributes)
+	if err != nil {
+		return nil, err
+	}
+	return append(res, bres...), nil
+}
+
+// entityIds answers the input IDs of the atoms, and the IDs of the
+// bonds, of the given molecule, in their order in it.
+func entityIds(mol *molecule.Molecule) ([]uint16, []uint16, error) {
+	ait := mol.Atoms()
+	atoms := make([]uint16, 0, ait.Len())
+	for ait.Next() {
+		atoms = append(atoms, ait.Atom().Iid)
+	}
+	if err := ait.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	bit := mol.Bonds()
+	bonds := make([]uint16, 0, bit.Len())
+	for bit.Next() {
+		bonds = append(bonds, bit.Bond().Id)
+	}
+	if err := bit.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	return atoms, bonds, nil
+}
+
+// propertyFields answers the data fields with the given prefix for the
+// attributes of the given atoms or bonds, fetched using the given
+// function.
+func propertyFields(prefix string, ids []uint16, fetch func(uint16) ([]molecule.Attribute, error)) ([]molecule.Attribute, error) {
+	names := []string(nil)
+	vals := make(map[string][]string)
+	for i, id := range ids {
+		attrs, err := fetch(id)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, attr := range attrs {
+			if strings.IndexAny(attr.Value, " \t\r\n") >= 0 || attr.Value == "" {
+				return nil, fmt.Errorf("Attribute %s of %d can not be written : %q", attr.Name, id, attr.Value)
+			}
+			vs, ok := vals[attr.Name]
+			if !ok {
+				names = append(names, attr.Name)
+				vs = make([]string, len(ids))
+				for j := range vs {
+					vs[j] = missingProp
+				}
+				vals[attr.Name] = vs
+			}
+			vs[i] = attr.Value // The most recent one wins.
+		}
+	}
+
+	res := make([]molecule.Attribute, 0, len(names))
+	for _, name := range names {
+		res = append(res, molecule.Attribute{Name: prefix + name, Value: strings.Join(vals[name], " ")})
+	}
+	return res, nil
+}
+
+// AttachPropertyFields assigns the atom and bond attributes carried by
+// the given data fields, as written by `PropertyFields`, to the atoms
+// and bonds of the given molecule.  It answers the remaining fields,
+// in their original order.
+func AttachPropertyFields(mol *molecule.Molecule, attrs []molecule.Attribute) ([]molecule.Attribute, error) {
+	atoms, bonds, err := entityIds(mol)
+	if err != nil {
+		return nil, err
+	}
+
+	rest := make([]molecule.Attribute, 0, len(attrs))
+	for _, attr := range attrs {
+		prefix, ids, set := "", []uint16(nil), (func(uint16, string, interface{}) error)(nil)
+		switch {
+		case strings.HasPrefix(attr.Name, AtomPropPrefix):
+			prefix, ids, set = AtomPropPrefix, atoms, mol.SetAtomAttribute
+		case strings.HasPrefix(attr.Name, BondPropPrefix):
+			prefix, ids, set = BondPropPrefix, bonds, mol.SetBondAttribute
+		default:
+			rest = append(rest, attr)
+			continue
+		}
+
+		name := attr.Name[len(prefix):]
+		vals := strings.Fields(attr.Value)
+		if len(vals) != len(ids) {
+			return nil, fmt.Errorf("Field %s : %d values for %d entities.", attr.Name, len(vals), len(ids))
+		}
+		for i, v := range vals {
+			if v == missingProp {
+				continue
+			}
+			if err := set(ids[i], name, v); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return rest, nil
+}
@@ -0,0 +1,350 @@
+package loader
+
+import (
+	"bufio"
+	"fmt"
+	"strconv"
+	"strings"
+
+	cmn "github.com/RxnWeaver/rxnweaver/common"
+	"github.com/RxnWeaver/rxnweaver/data/molecule"
+)
+
+// Length of the data of a `M  SCD' or `M  SED' line.
+const sgroupDataChunk = 69
+
+// readV2000Sgroups answers the Sgroups of the given property lines of
+// a V2000 molfile, the first of which is at the given line, counted
+// from `1`, of a molfile of the given numbers of atoms and bonds.  The
+// Sgroups hold the input IDs of their atoms, their positions counted
+// from `0`, and the positions of their bonds, counted from `1`.  Those of types other than superatoms, repeating units and data
+// groups are skipped.
+func readV2000Sgroups(lines []string, first, na, nb int, syntaxError _MolfileSyntaxError) ([]molecule.Sgroup, error) {
+	res := []molecule.Sgroup(nil)
+	index := make(map[int]int) // Positions of the Sgroups by their indices.
+	value := make(map[int]string)
+
+	for i, l := range lines {
+		if len(l) < 6 || !strings.HasPrefix(l, "M  S") {
+			continue
+		}
+		ln := first + i
+		fail := func() ([]molecule.Sgroup, error) {
+			return nil, syntaxError(ln, "Invalid Sgroup line : %q", l)
+		}
+		fs := strings.Fields(l[6:])
+		prop := l[3:6]
+
+		if prop == "STY" {
+			n, err := strconv.Atoi(firstField(fs))
+			if err != nil || len(fs) != 1+2*n {
+				return fail()
+			}
+			for k := 1; k < len(fs); k += 2 {
+				idx, err := strconv.Atoi(fs[k])
+				if err != nil {
+					return fail()
+				}
+				if typ, ok := cmn.SgroupTypeOf(fs[k+1]); ok {
+					index[idx] = len(res)
+					res = append(res, molecule.Sgroup{Type: typ})
+				}
+			}
+			continue
+		}
+
+		// The other lines begin with the index of their Sgroup, but for
+		// `M  SCN' and `M  SDS EXP', which list several.
+		switch prop {
+		case "SCN":
+			n, err := strconv.Atoi(firstField(fs))
+			if err != nil || len(fs) != 1+2*n {
+				return fail()
+			}
+			for k := 1; k < len(fs); k += 2 {
+				idx, err := strconv.Atoi(fs[k])
+				if err != nil {
+					return fail()
+				}
+				if p, ok := index[idx]; ok {
+					res[p].Connectivity = fs[k+1]
+				}
+			}
+			continue
+		case "SDS":
+			if len(fs) < 2 || fs[0] != "EXP" {
+				continue
+			}
+			n, err := strconv.Atoi(fs[1])
+			if err != nil || len(fs) != 2+n {
+				return fail()
+			}
+			for _, f := range fs[2:] {
+				idx, err := strconv.Atoi(f)
+				if err != nil {
+					return fail()
+				}
+				if p, ok := index[idx]; ok {
+					res[p].Expanded = true
+				}
+			}
+			continue
+		}
+
+		idx, err := strconv.Atoi(firstField(fs))
+		if err != nil {
+			continue
+		}
+		p, ok := index[idx]
+		if !ok {
+			continue
+		}
+		g := &res[p]
+		text := ""
+		if len(l) > 11 {
+			text = l[11:]
+		}
+
+		switch prop {
+		case "SAL", "SBL":
+			n, err := strconv.Atoi(fs[1%len(fs)])
+			if err != nil || len(fs) != 2+n {
+				return fail()
+			}
+			for _, f := range fs[2:] {
+				v, err := strconv.Atoi(f)
+				switch {
+				case err != nil, prop == "SAL" && (v < 1 || v > na), prop == "SBL" && (v < 1 || v > nb):
+					return fail()
+				case prop == "SAL":
+					g.Atoms = append(g.Atoms, uint16(v-1))
+				default:
+					g.Bonds = append(g.Bonds, uint16(v))
+				}
+			}
+		case "SMT":
+			g.Label = strings.TrimSpace(text)
+		case "SDT":
+			if len(text) > 30 {
+				text = text[:30]
+			}
+			g.FieldName = strings.TrimSpace(text)
+		case "SCD":
+			value[p] += text
+		case "SED":
+			g.FieldValue = strings.TrimRight(value[p]+text, " ")
+		case "SDI":
+			if len(fs) != 6 || fs[1] != "4" {
+				return fail()
+			}
+			var br [4]float32
+			for k := range br {
+				v, err := strconv.ParseFloat(fs[2+k], 32)
+				if err != nil {
+					return fail()
+				}
+				br[k] = float32(v)
+			}
+			g.Brackets = append(g.Brackets, br)
+		}
+	}
+	return res, nil
+}
+
+// readV30Sgroup answers the Sgroup of the given fields of a line of the
+// Sgroup block of a V3000 molfile, and whether it is of a type that is
+// read, given the positions of the atoms and the bonds by their
+// indices.  The Sgroup holds the input IDs of its atoms, their
+// positions counted from `0`, and the positions of its bonds, counted
+// from `1`.
+func readV30Sgroup(fs []string, vl _V30Line, atoms, bonds map[int]int, syntaxError _MolfileSyntaxError) (molecule.Sgroup, bool, error) {
+	g := molecule.Sgroup{}
+	if len(fs) < 3 {
+		return g, false, syntaxError(vl.ln, "Invalid Sgroup line : %q", vl.text)
+	}
+	typ, ok := cmn.SgroupTypeOf(fs[1])
+	if !ok {
+		return g, false, nil
+	}
+	g.Type = typ
+
+	fail := func(f string) (molecule.Sgroup, bool, error) {
+		return g, false, syntaxError(vl.ln, "Invalid Sgroup property : %q", f)
+	}
+	for _, f := range fs[3:] {
+		k, v := v30Property(f)
+		switch k {
+		case "ATOMS", "XBONDS", "CBONDS":
+			idxs, ok := v30List(v)
+			if !ok {
+				return fail(f)
+			}
+			for _, idx := range idxs {
+				if k == "ATOMS" {
+					p, ok := atoms[idx]
+					if !ok {
+						return fail(f)
+					}
+					g.Atoms = append(g.Atoms, uint16(p-1))
+					continue
+				}
+				p, ok := bonds[idx]
+				if !ok {
+					return fail(f)
+				}
+				g.Bonds = append(g.Bonds, uint16(p))
+			}
+		case "LABEL":
+			g.Label = v30Unquote(v)
+		case "CONNECT":
+			g.Connectivity = v
+		case "ESTATE":
+			g.Expanded = v == "E"
+		case "FIELDNAME":
+			g.FieldName = v30Unquote(v)
+		case "FIELDDATA":
+			g.FieldValue = v30Unquote(v)
+		case "BRKXYZ":
+			xyz, ok := v30Floats(v)
+			if !ok || len(xyz) != 9 {
+				return fail(f)
+			}
+			g.Brackets = append(g.Brackets, [4]float32{float32(xyz[0]), float32(xyz[1]), float32(xyz[3]), float32(xyz[4])})
+		}
+	}
+	return g, true, nil
+}
+
+// v30Unquote answers the given value of a V3000 property, without its
+// double quotes, if any; doubled quotes within stand for one.
+func v30Unquote(v string) string {
+	if len(v) < 2 || v[0] != '"' || v[len(v)-1] != '"' {
+		return v
+	}
+	return strings.Replace(v[1:len(v)-1], `""`, `"`, -1)
+}
+
+// v30Floats answers the numbers of the given list of the form
+// `(n x1 x2 ... xn)'.
+func v30Floats(s string) ([]float64, bool) {
+	if !strings.HasPrefix(s, "(") || !strings.HasSuffix(s, ")") {
+		return nil, false
+	}
+	fs := strings.Fields(s[1 : len(s)-1])
+	n, err := strconv.Atoi(firstField(fs))
+	if err != nil || len(fs) != n+1 {
+		return nil, false
+	}
+	res := make([]float64, n)
+	for i := range res {
+		if res[i], err = strconv.ParseFloat(fs[i+1], 64); err != nil {
+			return nil, false
+		}
+	}
+	return res, true
+}
+
+// sgroupBondIds answers the given Sgroups of the given molecule, read
+// from a molfile with the given bonds, their bonds given by their
+// positions in the bond block, with the IDs of those bonds instead.
+// The bonds are identified by their atoms, since those to hydrogen
+// atoms are not built, so that bond IDs need not be positions.
+// Crossing bonds that were not built are dropped.
+func sgroupBondIds(mol *molecule.Molecule, gs []molecule.Sgroup, bonds []_MolfileBond) []molecule.Sgroup {
+	for i := range gs {
+		g := &gs[i]
+		ids := []uint16(nil)
+		for _, p := range g.Bonds {
+			mb := bonds[p-1]
+			b, err := mol.BondBetween(uint16(mb.a1-1), uint16(mb.a2-1))
+			if err != nil {
+				continue
+			}
+			ids = append(ids, b.Id)
+		}
+		g.Bonds = ids
+	}
+	return gs
+}
+
+// writeSgroups writes the given Sgroups as the property lines of a
+// V2000 molfile, with the given positions of the atoms and bonds.
+// Lists longer than a line holds are continued on further lines.
+func writeSgroups(bw *bufio.Writer, gs []molecule.Sgroup, atomPos, bondPos map[uint16]int) {
+	if len(gs) == 0 {
+		return
+	}
+
+	chunks := func(n, size int, f func(from, to int)) {
+		for from := 0; from < n; from += size {
+			to := from + size
+			if to > n {
+				to = n
+			}
+			f(from, to)
+		}
+	}
+	chunks(len(gs), 8, func(from, to int) {
+		fmt.Fprintf(bw, "M  STY%3d", to-from)
+		for i := from; i < to; i++ {
+			fmt.Fprintf(bw, " %3d %3s", i+1, gs[i].Type)
+		}
+		bw.WriteByte('\n')
+	})
+
+	expanded := []int(nil)
+	connected := []int(nil)
+	for i, g := range gs {
+		idx := i + 1
+		chunks(len(g.Atoms), 15, func(from, to int) {
+			fmt.Fprintf(bw, "M  SAL %3d%3d", idx, to-from)
+			for _, iid := range g.Atoms[from:to] {
+				fmt.Fprintf(bw, " %3d", atomPos[iid])
+			}
+			bw.WriteByte('\n')
+		})
+		chunks(len(g.Bonds), 15, func(from, to int) {
+			fmt.Fprintf(bw, "M  SBL %3d%3d", idx, to-from)
+			for _, id := range g.Bonds[from:to] {
+				fmt.Fprintf(bw, " %3d", bondPos[id])
+			}
+			bw.WriteByte('\n')
+		})
+		if g.Label != "" {
+			fmt.Fprintf(bw, "M  SMT %3d %s\n", idx, g.Label)
+		}
+		for _, br := range g.Brackets {
+			fmt.Fprintf(bw, "M  SDI %3d  4%10.4f%10.4f%10.4f%10.4f\n", idx, br[0], br[1], br[2], br[3])
+		}
+		if g.Type == cmn.SgroupData {
+			fmt.Fprintf(bw, "M  SDT %3d %s\n", idx, g.FieldName)
+			v := g.FieldValue
+			for len(v) > sgroupDataChunk {
+				fmt.Fprintf(bw, "M  SCD %3d %s\n", idx, v[:sgroupDataChunk])
+				v = v[sgroupDataChunk:]
+			}
+			fmt.Fprintf(bw, "M  SED %3d %s\n", idx, v)
+		}
+		if g.Type == cmn.SgroupSuperatom && g.Expanded {
+			expanded = append(expanded, idx)
+		}
+		if g.Connectivity != "" {
+			connected = append(connected, idx)
+		}
+	}
+
+	chunks(len(connected), 8, func(from, to int) {
+		fmt.Fprintf(bw, "M  SCN%3d", to-from)
+		for _, idx := range connected[from:to] {
+			fmt.Fprintf(bw, " %3d %-3s", idx, gs[idx-1].Connectivity)
+		}
+		bw.WriteByte('\n')
+	})
+	chunks(len(expanded), 15, func(from, to int) {
+		fmt.Fprintf(bw, "M  SDS EXP%3d", to-from)
+		for _, idx := range expanded[from:to] {
+			fmt.Fprintf(bw, " %3d", idx)
+		}
+		bw.WriteByte('\n')
+	})
+}
@@ -0,0 +1,319 @@
+package loader
+
+import (
+	"strings"
+
+	cmn "github.com/RxnWeaver/rxnweaver/common"
+	"github.com/RxnWeaver/rxnweaver/data/molecule"
+)
+
+// ReadSmarts answers a substructure query read from the given SMARTS
+// pattern, as reaction templates write them; see `molecule.Query`.
+//
+// The atoms of the query are built as those of SMILES are, but as
+// written: aromatic atoms are not kekulised, bonds written `:` are
+// given the aromatic type, and no hydrogen counts are set.  What a
+// molecule can not say of its atoms and bonds is given by the
+// constraints of the query.  Atoms without brackets, as `C`, `c`, `*`,
+// `a` and `A`, constrain their elements and aromaticity alone.  Of
+// bracket atoms, these primitives are read, joined by `&` or `;`, or
+// by nothing: a leading mass number, element symbols, aliphatic or
+// aromatic, `#n`, `*`, `a`, `A`, `Hn`, `Dn`, `Xn`, `R`, `R0` and `!R`,
+// charges, which constrain the charge even if `+0`, tetrahedral
+// chirality, `@` and `@@`, and a trailing map number, `:n`.  As in
+// SMILES, chirality is read of atoms with four neighbours, counting a
+// hydrogen, `H1`; see `molecule.Query` for its parities.  Elements
+// alone may be joined by `,`, as in `[Cl,Br,I]`.  Bonds not written
+// match single or aromatic bonds, and `~` any bond; the directions of
+// single bonds, `/` and `\`, are read as single bonds.
+//
+// Other primitives, recursive SMARTS, `$(...)`, and hydrogen atoms,
+// as `[H]` and `[#1]`, are reported as errors, since they can not be
+// matched as written.  Malformed patterns are reported as those of
+// SMILES are; see `ReadSmiles`.
+func ReadSmarts(pattern string) (*molecule.Query, error) {
+	p := &_SmilesParser{s: pattern, smarts: true}
+	if err := p.parse(); err != nil {
+		return nil, err
+	}
+	for _, a := range p.atoms {
+		if a.sym == "H" {
+			p.i = a.pos
+			return nil, p.syntaxError("Hydrogen atoms are not supported in SMARTS")
+		}
+	}
+
+	mol := molecule.NewPassive()
+	q := &molecule.Query{
+		Mol:   mol,
+		Atoms: make(map[uint16]molecule.AtomConstraint, len(p.atoms)),
+		Bonds: make(map[uint16]molecule.BondConstraint),
+		Maps:  make(map[uint16]int),
+
+		Parities: make(map[uint16]cmn.StereoParity),
+	}
+	ab := mol.NewAtomBuilder()
+	for i, a := range p.atoms {
+		ab.Element(a.sym)
+		if a.charge != 0 {
+			ab.FormalCharge(a.charge)
+		}
+		if a.isotope != 0 {
+			ab.Isotope(a.isotope)
+		}
+		ab.Add()
+		if par := p.parity(i); par != cmn.StereoParityNone {
+			q.Parities[uint16(i)] = par
+		}
+
+		q.Atoms[uint16(i)] = a.query
+		if a.class > 0 {
+			q.Maps[uint16(i)] = a.class
+		}
+	}
+	bb := mol.NewBondBuilder()
+	for k, b := range p.bonds {
+		typ := cmn.BondType(b.order)
+		switch {
+		case b.dative:
+			typ = cmn.BondTypeDative
+		case b.aromatic:
+			typ = cmn.BondTypeAltern
+		}
+		bb.Connect(b.a1, b.a2).Type(typ).Add()
+		if b.query != molecule.BondAsGiven {
+			q.Bonds[uint16(k)] = b.query
+		}
+	}
+	if err := mol.Build(); err != nil {
+		mol.Release()
+		return nil, err
+	}
+	return q, nil
+}
+
+// parseSmartsAtom reads the SMARTS atom at the current position.
+func (p *_SmilesParser) parseSmartsAtom() (_SmilesAtom, error) {
+	switch p.s[p.i] {
+	case '[':
+		return p.parseSmartsBracketAtom()
+
+	case 'a', 'A':
+		a := _SmilesAtom{pos: p.i, sym: "Q_STAR", query: molecule.NewAtomConstraint()}
+		a.query.AnyElement = true
+		a.query.Aromatic = smartsAromaticity(p.s[p.i] == 'a')
+		p.i++
+		return a, nil
+	}
+
+	a, err := p.parseAtom()
+	if err != nil {
+		return a, err
+	}
+	a.query = molecule.NewAtomConstraint()
+	if a.sym == "Q_STAR" {
+		a.query.AnyElement = true
+	} else {
+		a.query.Aromatic = smartsAromaticity(a.aromatic)
+	}
+	return a, nil
+}
+
+// parseSmartsBracketAtom reads the SMARTS bracket atom at the current
+// position: `[`, an optional mass number, the primitives, and `]`.  See
+// `ReadSmarts`.
+func (p *_SmilesParser) parseSmartsBracketAtom() (_SmilesAtom, error) {
+	a := _SmilesAtom{pos: p.i, bracket: true, query: molecule.NewAtomConstraint()}
+	p.i++
+	a.isotope = p.readNumber(0)
+
+	var els []uint8      // Of the elements given, alternatives among them.
+	var aroms []int8     // Of those elements, their aromaticity.
+	either := false      // Whether the next element is an alternative.
+	lastElement := false // Whether the last primitive was an element.
+	first := true        // Whether no primitive was read.
+
+	// element records the element of the given symbol, aromatic or not,
+	// or of either aromaticity, if `0`.
+	element := func(sym string, arom int8) error {
+		if len(els) > 0 && !either {
+			return p.syntaxError("Conflicting elements")
+		}
+		if len(els) == 0 {
+			a.sym, a.aromatic = sym, arom > 0
+		}
+		els = append(els, cmn.PeriodicTable[sym].Number)
+		aroms = append(aroms, arom)
+		either = false
+		return nil
+	}
+
+	for p.i < len(p.s) && p.s[p.i] != ']' {
+		c := p.s[p.i]
+		rest := p.s[p.i:]
+		isElem := true
+		switch {
+		case c == '&' || c == ';':
+			p.i++
+			continue
+
+		case c == ',':
+			if !lastElement {
+				return a, p.syntaxError("Unsupported disjunction")
+			}
+			either = true
+			p.i++
+			continue
+
+		case c == '$':
+			return a, p.syntaxError("Recursive SMARTS is not supported")
+
+		case c == '#':
+			p.i++
+			n := p.readNumber(-1)
+			if n < 1 || n >= len(cmn.ElementSymbols) {
+				return a, p.syntaxError("Invalid atomic number")
+			}
+			if err := element(cmn.ElementSymbols[n], 0); err != nil {
+				return a, err
+			}
+
+		case c == '*':
+			p.i++
+			a.query.AnyElement = true
+			isElem = false
+
+		case len(rest) >= 2 && smilesAromatic[rest[:2]] != "":
+			if err := element(smilesAromatic[rest[:2]], 1); err != nil {
+				return a, err
+			}
+			p.i += 2
+
+		case len(rest) >= 2 && isUpper(c) && isLower(rest[1]) && isElement(rest[:2]):
+			if err := element(rest[:2], -1); err != nil {
+				return a, err
+			}
+			p.i += 2
+
+		case c == 'D' || c == 'X' || (c == 'H' && !first):
+			p.i++
+			n := p.readNumber(1)
+			switch c {
+			case 'H':
+				a.hCount, a.query.HCount = n, n
+			case 'D':
+				a.query.Degree = n
+			case 'X':
+				a.query.Connectivity = n
+			}
+			isElem = false
+
+		case c == 'R' || strings.HasPrefix(rest, "!R"):
+			if c == '!' {
+				p.i++
+			}
+			p.i++
+			switch n := p.readNumber(-1); {
+			case n < 0 && c == 'R':
+				a.query.Ring = 1
+			case n == 0 && c == 'R', n < 0 && c == '!':
+				a.query.Ring = -1
+			default:
+				return a, p.syntaxError("Unsupported ring primitive")
+			}
+			isElem = false
+
+		case len(rest) >= 1 && smilesAromatic[rest[:1]] != "":
+			if err := element(smilesAromatic[rest[:1]], 1); err != nil {
+				return a, err
+			}
+			p.i++
+
+		case isUpper(c) && isElement(rest[:1]):
+			if err := element(rest[:1], -1); err != nil {
+				return a, err
+			}
+			p.i++
+
+		case c == 'a' || c == 'A':
+			p.i++
+			if len(els) == 0 {
+				a.query.AnyElement = true
+			}
+			a.query.Aromatic = smartsAromaticity(c == 'a')
+			isElem = false
+
+		case c == '@':
+			p.i++
+			a.chiral = 1
+			if p.i < len(p.s) && p.s[p.i] == '@' {
+				a.chiral = 2
+				p.i++
+			}
+			isElem = false
+
+		case c == '+' || c == '-':
+			p.i++
+			n := 1
+			if p.i < len(p.s) && isDigit(p.s[p.i]) {
+				n = p.readNumber(1)
+			} else {
+				for p.i < len(p.s) && p.s[p.i] == c {
+					n++
+					p.i++
+				}
+			}
+			if c == '-' {
+				n = -n
+			}
+			a.charge, a.query.Charged = n, true
+			isElem = false
+
+		case c == ':':
+			p.i++
+			a.class = p.readNumber(-1)
+			if a.class < 0 {
+				return a, p.syntaxError("Invalid map number")
+			}
+			isElem = false
+
+		default:
+			return a, p.syntaxError("Unsupported SMARTS primitive")
+		}
+		if either && !isElem {
+			return a, p.syntaxError("Unsupported disjunction")
+		}
+		lastElement, first = isElem, false
+	}
+	if p.i >= len(p.s) {
+		return a, p.syntaxError("Unclosed bracket atom")
+	}
+	p.i++
+
+	switch {
+	case either:
+		return a, p.syntaxError("Unsupported disjunction")
+	case a.sym == "":
+		a.sym, a.query.AnyElement = "Q_STAR", true
+	case len(els) > 1:
+		a.query.Elements = els
+	}
+	if len(els) > 0 && a.query.Aromatic == 0 {
+		a.query.Aromatic = aroms[0]
+		for _, arom := range aroms[1:] {
+			if arom != aroms[0] {
+				a.query.Aromatic = 0
+			}
+		}
+	}
+	return a, nil
+}
+
+// smartsAromaticity answers the aromaticity constraint of an atom
+// written aromatic, or aliphatic, in SMARTS.
+func smartsAromaticity(aromatic bool) int8 {
+	if aromatic {
+		return 1
+	}
+	return -1
+}
@@ -0,0 +1,1545 @@
+package loader
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	cmn "github.com/RxnWeaver/rxnweaver/common"
+	"github.com/RxnWeaver/rxnweaver/data/molecule"
+)
+
+// smilesValences holds the lowest standard valences of the elements
+// that SMILES writes without brackets, and of the other elements that
+// it allows to be aromatic.
+var smilesValences = map[string][]int{
+	"B":  {3},
+	"C":  {4},
+	"N":  {3, 5},
+	"O":  {2},
+	"P":  {3, 5},
+	"S":  {2, 4, 6},
+	"F":  {1},
+	"Cl": {1},
+	"Br": {1},
+	"I":  {1},
+	"As": {3},
+	"Se": {2},
+	"Te": {2},
+}
+
+// smilesOrganic lists the elements of the organic subset, which SMILES
+// writes without brackets.
+var smilesOrganic = map[string]bool{
+	"B": true, "C": true, "N": true, "O": true, "P": true, "S": true,
+	"F": true, "Cl": true, "Br": true, "I": true,
+}
+
+// smilesAromatic maps the aromatic symbols of SMILES to those of the
+// elements.
+var smilesAromatic = map[string]string{
+	"b": "B", "c": "C", "n": "N", "o": "O", "p": "P", "s": "S",
+	"as": "As", "se": "Se", "te": "Te",
+}
+
+// _SmilesAtom is an atom read from a SMILES string.
+type _SmilesAtom struct {
+	sym      string
+	aromatic bool
+	bracket  bool
+	isotope  int
+	charge   int
+	hCount   int  // Of bracket atoms only.
+	chiral   int8 // `1` for `@`, `2` for `@@`; `0` if not given.
+	class    int  // Atom class, `:n`, of bracket atoms; an atom map number.
+	nbrs     []int
+	pos      int                     // Position in the string, for reporting.
+	query    molecule.AtomConstraint // Of SMARTS atoms only.
+}
+
+// _SmilesBond is a bond read from a SMILES string.
+type _SmilesBond struct {
+	a1, a2   int // Indices of the atoms; the donor first, if dative.
+	order    int
+	aromatic bool
+	dative   bool
+	dir      int8                    // `1` for `/`, `-1` for `\`, from the first atom.
+	query    molecule.BondConstraint // Of SMARTS bonds only.
+}
+
+// _SmilesParser holds the state of parsing a SMILES string.
+type _SmilesParser struct {
+	s      string
+	i      int
+	atoms  []_SmilesAtom
+	bonds  []_SmilesBond
+	smarts bool // Whether the string is a SMARTS pattern; see `ReadSmarts`.
+}
+
+// SmilesParser answers a parse function that reads lines of SMILES
+// files, creating their molecules in the given registry, or as passive
+// molecules, if `nil`.  See `ReadSmiles`.
+func SmilesParser(reg *molecule.MoleculeRegistry) ParseFunc {
+	return func(rec []byte) (*molecule.Molecule, error) {
+		return ReadSmiles(reg, rec)
+	}
+}
+
+// ReadSmiles answers a new molecule, in the given registry, or a
+// passive one, if `nil`, built from the given line of a SMILES file: a
+// SMILES string, optionally followed by white space, a ChemAxon
+// extension, `|...|`, and the name of the molecule, which is set as
+// its `name` attribute.  The molecule is not sanitised; see
+// `Sanitized`.
+//
+// Atoms are numbered in the order of their appearance.  Aromatic atoms
+// and bonds are read in their Kekulé form, which settles the hydrogens
+// they imply; aromaticity is perceived afresh by sanitisation, and
+// `Molecule.Aromatise` gives the aromatic bonds the aromatic type.
+// The hydrogen counts of bracket atoms are set as given; those of the
+// atoms of the organic subset are perceived by sanitisation.  Bracket
+// atoms of the organic subset falling short of their lowest standard
+// valences are marked as radicals, so that sanitisation does not
+// raise their hydrogen counts.  Dative bonds are read from `->`, from
+// the donor to the acceptor, and `<-`, the other way, as RDKit writes
+// them; they add nothing to the valences of their atoms, so that
+// `N->[Pt]` has an ammine ligand.
+//
+// Tetrahedral stereo designations, `@` and `@@`, or `@TH1` and
+// `@TH2`, are declared as the parities of their atoms, and those of
+// double bonds, `/` and `\`, as their configurations; see
+// `AtomBuilder.Parity` and `BondBuilder.Cis`.  They are read in the
+// order of the neighbours in the string: the preceding atom, an
+// implicit hydrogen, the ring closures, at the positions of their
+// digits, and the following atoms.  The directions of ring closure
+// bonds and other stereo classes are accepted, but ignored.  Atom
+// classes, `:n`, are read as atom map numbers; see
+// `molecule.AtomMapAttribute`.  Of the extension, only the enhanced stereo groups, `a:`,
+// `&n:` and `on:`, are read, see `StereoGroup`, and the atom labels,
+// `$...$`, of which `_Rn` makes a `*` atom stand for the R-group `n`;
+// see `AtomBuilder.RGroup`.
+//
+// Malformed strings are reported by a `*cmn.ValidationReport`, whose
+// issues give the positions in the string, counted from `1`.
+func ReadSmiles(reg *molecule.MoleculeRegistry, rec []byte) (*molecule.Molecule, error) {
+	line := strings.TrimSpace(string(rec))
+	smi, name := line, ""
+	if i := strings.IndexAny(line, " \t"); i >= 0 {
+		smi, name = line[:i], strings.TrimSpace(line[i+1:])
+	}
+	ext, name := splitCXExtension(name)
+
+	p := &_SmilesParser{s: smi}
+	if err := p.parse(); err != nil {
+		return nil, err
+	}
+	if err := p.kekulise(); err != nil {
+		return nil, err
+	}
+	groups, err := cxStereoGroups(ext, len(p.atoms))
+	if err != nil {
+		return nil, err
+	}
+	rgroups, err := cxRGroups(ext, len(p.atoms))
+	if err != nil {
+		return nil, err
+	}
+
+	mol := newMolecule(reg)
+	ab := mol.NewAtomBuilder()
+	for i, a := range p.atoms {
+		if rgroups != nil && rgroups[i] != 0 && a.sym == "Q_STAR" {
+			ab.Element("R").RGroup(rgroups[i])
+		} else {
+			ab.Element(a.sym)
+		}
+		if p.isRadical(i) {
+			ab.Charge(4)
+		}
+		if a.charge != 0 {
+			ab.FormalCharge(a.charge)
+		}
+		if a.isotope != 0 {
+			ab.Isotope(a.isotope)
+		}
+		if par := p.parity(i); par != cmn.StereoParityNone {
+			ab.Parity(par)
+		}
+		ab.Add()
+	}
+	bb := mol.NewBondBuilder()
+	hs := make([]int, len(p.atoms)) // Hydrogens bonded explicitly.
+	for _, b := range p.bonds {
+		switch {
+		case p.atoms[b.a1].sym == "H":
+			hs[b.a2]++
+		case p.atoms[b.a2].sym == "H":
+			hs[b.a1]++
+		}
+		typ := cmn.BondType(b.order)
+		if b.dative {
+			typ = cmn.BondTypeDative
+		}
+		bb.Connect(b.a1, b.a2).Type(typ)
+		if cis, ok := p.isCis(b); ok {
+			bb.Cis(cis)
+		}
+		bb.Add()
+	}
+	if err := mol.Build(); err != nil {
+		mol.Release()
+		return nil, err
+	}
+
+	for i, a := range p.atoms {
+		if a.hCount == 0 {
+			continue
+		}
+		if err := mol.SetAtomHCount(uint16(i), uint8(a.hCount+hs[i])); err != nil {
+			mol.Release()
+			return nil, err
+		}
+	}
+	for i, a := range p.atoms {
+		if a.class == 0 {
+			continue
+		}
+		if err := mol.SetAtomAttribute(uint16(i), molecule.AtomMapAttribute, a.class); err != nil {
+			mol.Release()
+			return nil, err
+		}
+	}
+	if len(groups) > 0 {
+		if err := mol.SetStereoGroups(groups...); err != nil {
+			mol.Release()
+			return nil, err
+		}
+	}
+	if name != "" {
+		if err := mol.SetAttribute("name", name); err != nil {
+			mol.Release()
+			return nil, err
+		}
+	}
+	return mol, nil
+}
+
+// syntaxError answers a report of the given problem at the current
+// position in the string.
+func (p *_SmilesParser) syntaxError(format string, args ...interface{}) error {
+	rep := new(cmn.ValidationReport)
+	msg := fmt.Sprintf(format, args...)
+	rep.Add(cmn.Issue{Severity: cmn.SeverityError, Code: cmn.CodeSyntax, Message: fmt.Sprintf("%s at position %d : %q", msg, p.i+1, p.s)})
+	return rep
+}
+
+// parse reads the atoms and bonds of the string.
+func (p *_SmilesParser) parse() error {
+	if p.s == "" {
+		return p.syntaxError("Empty SMILES")
+	}
+
+	type ring struct {
+		atom int
+		bond byte
+		slot int // Of the ring closure among the neighbours of the atom.
+	}
+	rings := make(map[int]ring)
+	branches := []int(nil)
+	prev := -1
+	bond := byte(0)
+
+	for p.i < len(p.s) {
+		c := p.s[p.i]
+		switch {
+		case c == '(':
+			if prev < 0 || bond != 0 {
+				return p.syntaxError("Branch without an atom")
+			}
+			branches = append(branches, prev)
+			p.i++
+
+		case c == ')':
+			if len(branches) == 0 || bond != 0 {
+				return p.syntaxError("Unbalanced branch")
+			}
+			prev = branches[len(branches)-1]
+			branches = branches[:len(branches)-1]
+			p.i++
+
+		case c == '.':
+			if prev < 0 || bond != 0 {
+				return p.syntaxError("Misplaced dot")
+			}
+			prev = -1
+			p.i++
+
+		case strings.HasPrefix(p.s[p.i:], "->") || strings.HasPrefix(p.s[p.i:], "<-"):
+			if prev < 0 || bond != 0 {
+				return p.syntaxError("Misplaced bond")
+			}
+			bond = '>'
+			if c == '<' {
+				bond = '<'
+			}
+			p.i += 2
+
+		case strings.IndexByte("-=#:/\\", c) >= 0 || (p.smarts && c == '~'):
+			if prev < 0 || bond != 0 {
+				return p.syntaxError("Misplaced bond")
+			}
+			bond = c
+			p.i++
+
+		case c == '$':
+			return p.syntaxError("Quadruple bonds are not supported")
+
+		case c == '%' || (c >= '0' && c <= '9'):
+			if prev < 0 {
+				return p.syntaxError("Ring closure without an atom")
+			}
+			num := int(c - '0')
+			if c == '%' {
+				if p.i+2 >= len(p.s) || !isDigit(p.s[p.i+1]) || !isDigit(p.s[p.i+2]) {
+					return p.syntaxError("Invalid ring number")
+				}
+				num, _ = strconv.Atoi(p.s[p.i+1 : p.i+3])
+				p.i += 2
+			}
+
+			if r, ok := rings[num]; ok {
+				if r.atom == prev {
+					return p.syntaxError("Ring closed on its own atom")
+				}
+				b1, b2 := ringBondSymbol(r.bond), reversedBondSymbol(ringBondSymbol(bond))
+				if b1 != 0 && b2 != 0 && b1 != b2 {
+					return p.syntaxError("Conflicting ring bonds")
+				}
+				if b1 == 0 {
+					b1 = b2
+				}
+				p.addBond(r.atom, prev, b1)
+				p.atoms[r.atom].nbrs[r.slot] = prev
+				p.atoms[prev].nbrs = append(p.atoms[prev].nbrs, r.atom)
+				delete(rings, num)
+			} else {
+				rings[num] = ring{prev, bond, len(p.atoms[prev].nbrs)}
+				p.atoms[prev].nbrs = append(p.atoms[prev].nbrs, -1)
+			}
+			bond = 0
+			p.i++
+
+		default:
+			parseAtom := p.parseAtom
+			if p.smarts {
+				parseAtom = p.parseSmartsAtom
+			}
+			a, err := parseAtom()
+			if err != nil {
+				return err
+			}
+			p.atoms = append(p.atoms, a)
+			cur := len(p.atoms) - 1
+			if prev >= 0 {
+				p.addBond(prev, cur, bond)
+				p.atoms[prev].nbrs = append(p.atoms[prev].nbrs, cur)
+				p.atoms[cur].nbrs = append(p.atoms[cur].nbrs, prev)
+			}
+			if a.bracket && a.hCount == 1 {
+				p.atoms[cur].nbrs = append(p.atoms[cur].nbrs, implicitH)
+			}
+			prev = cur
+			bond = 0
+		}
+	}
+
+	switch {
+	case bond != 0:
+		return p.syntaxError("Bond without a second atom")
+	case len(branches) > 0:
+		return p.syntaxError("Unclosed branch")
+	case len(rings) > 0:
+		return p.syntaxError("Unclosed ring")
+	}
+	return nil
+}
+
+// implicitH stands for the implicit hydrogen of a bracket atom among
+// the neighbours of the atom.
+const implicitH = -1
+
+// ringBondSymbol answers the given bond symbol, ignoring those of
+// double bond stereo.
+func ringBondSymbol(c byte) byte {
+	if c == '/' || c == '\\' {
+		return 0
+	}
+	return c
+}
+
+// reversedBondSymbol answers the given bond symbol as read from the
+// other end of its bond: `>`, for `->`, and `<`, for `<-`, are swapped,
+// and others are as given.  A dative ring bond given at its closing
+// digit is thus read from its opening atom.
+func reversedBondSymbol(c byte) byte {
+	switch c {
+	case '>':
+		return '<'
+	case '<':
+		return '>'
+	}
+	return c
+}
+
+// addBond adds a bond between the given atoms, with the given symbol.
+// A bond without a symbol between aromatic atoms is aromatic; in SMARTS,
+// it is single or aromatic, and `~` is any bond.  A dative
+// bond, `>` or `<`, points from the first atom to the second, or from
+// the second to the first.
+func (p *_SmilesParser) addBond(a1, a2 int, sym byte) {
+	b := _SmilesBond{a1: a1, a2: a2, order: 1}
+	switch sym {
+	case '>':
+		b.order, b.dative = 0, true
+	case '<':
+		b.a1, b.a2 = a2, a1
+		b.order, b.dative = 0, true
+	case '/':
+		b.dir = 1
+	case '\\':
+		b.dir = -1
+	case '=':
+		b.order = 2
+	case '#':
+		b.order = 3
+	case ':':
+		b.aromatic = true
+	case '~':
+		b.query = molecule.BondAny
+	case 0:
+		if p.smarts {
+			b.query = molecule.BondSingleOrAromatic
+		} else {
+			b.aromatic = p.atoms[a1].aromatic && p.atoms[a2].aromatic
+		}
+	}
+	p.bonds = append(p.bonds, b)
+}
+
+// parseAtom reads the atom at the current position.
+func (p *_SmilesParser) parseAtom() (_SmilesAtom, error) {
+	a := _SmilesAtom{pos: p.i}
+	c := p.s[p.i]
+	switch {
+	case c == '[':
+		return p.parseBracketAtom()
+
+	case c == '*':
+		a.sym = "Q_STAR"
+		p.i++
+		return a, nil
+
+	case p.i+1 < len(p.s) && (p.s[p.i:p.i+2] == "Cl" || p.s[p.i:p.i+2] == "Br"):
+		a.sym = p.s[p.i : p.i+2]
+		p.i += 2
+		return a, nil
+	}
+
+	sym := string(c)
+	if el, ok := smilesAromatic[sym]; ok {
+		a.sym, a.aromatic = el, true
+	} else if smilesOrganic[sym] {
+		a.sym = sym
+	} else {
+		return a, p.syntaxError("Unexpected character %q", c)
+	}
+	p.i++
+	return a, nil
+}
+
+// parseBracketAtom reads the bracket atom at the current position:
+// `[`, an optional mass number, the symbol, optional chirality,
+// hydrogen count, charge and atom class, and `]`.
+func (p *_SmilesParser) parseBracketAtom() (_SmilesAtom, error) {
+	a := _SmilesAtom{pos: p.i, bracket: true}
+	p.i++
+	a.isotope = p.readNumber(0)
+
+	switch rest := p.s[p.i:]; {
+	case strings.HasPrefix(rest, "*"):
+		a.sym = "Q_STAR"
+		p.i++
+	case len(rest) >= 2 && smilesAromatic[rest[:2]] != "":
+		a.sym, a.aromatic = smilesAromatic[rest[:2]], true
+		p.i += 2
+	case len(rest) >= 1 && smilesAromatic[rest[:1]] != "":
+		a.sym, a.aromatic = smilesAromatic[rest[:1]], true
+		p.i++
+	case len(rest) >= 2 && isUpper(rest[0]) && isLower(rest[1]) && isElement(rest[:2]):
+		a.sym = rest[:2]
+		p.i += 2
+	case len(rest) >= 1 && isUpper(rest[0]) && isElement(rest[:1]):
+		a.sym = rest[:1]
+		p.i++
+	default:
+		return a, p.syntaxError("Invalid bracket atom")
+	}
+
+	// Chirality: `@`, `@@`, or `@` followed by a class and a number, as
+	// in `@TH1`.  Only the tetrahedral class is read.
+	if p.i < len(p.s) && p.s[p.i] == '@' {
+		p.i++
+		a.chiral = 1
+		if p.i < len(p.s) && p.s[p.i] == '@' {
+			a.chiral = 2
+			p.i++
+		} else if p.i+1 < len(p.s) && isUpper(p.s[p.i]) && isUpper(p.s[p.i+1]) {
+			class := p.s[p.i : p.i+2]
+			p.i += 2
+			switch n := p.readNumber(0); {
+			case class == "TH" && (n == 1 || n == 2):
+				a.chiral = int8(n)
+			default:
+				a.chiral = 0
+			}
+		}
+	}
+
+	if p.i < len(p.s) && p.s[p.i] == 'H' {
+		p.i++
+		a.hCount = p.readNumber(1)
+	}
+
+	if p.i < len(p.s) && (p.s[p.i] == '+' || p.s[p.i] == '-') {
+		sign := p.s[p.i]
+		p.i++
+		n := 1
+		if p.i < len(p.s) && isDigit(p.s[p.i]) {
+			n = p.readNumber(1)
+		} else {
+			for p.i < len(p.s) && p.s[p.i] == sign {
+				n++
+				p.i++
+			}
+		}
+		if sign == '-' {
+			n = -n
+		}
+		a.charge = n
+	}
+
+	if p.i < len(p.s) && p.s[p.i] == ':' {
+		p.i++
+		a.class = p.readNumber(0)
+	}
+
+	if p.i >= len(p.s) || p.s[p.i] != ']' {
+		return a, p.syntaxError("Unclosed bracket atom")
+	}
+	p.i++
+	return a, nil
+}
+
+// parity answers the MDL parity of the given atom, by the input IDs of
+// its neighbours, as declared by its chirality.  `@` has the first
+// three of its neighbours, in the order of the string, span a positive
+// volume, and `@@` a negative one; the parity is odd should that of
+// the first three in the ascending order of their input IDs, an
+// implicit hydrogen being last, be negative.  A hydrogen atom bonded
+// explicitly, isotopic or not, is taken to be the implicit hydrogen,
+// as it is counted in the hydrogens of the atom.  `StereoParityNone`
+// is answered unless the atom is chiral, with four neighbours, counting
+// an implicit hydrogen.
+func (p *_SmilesParser) parity(i int) cmn.StereoParity {
+	a := p.atoms[i]
+	if a.chiral == 0 || len(a.nbrs) != 4 {
+		return cmn.StereoParityNone
+	}
+
+	seq := make([]uint16, len(a.nbrs))
+	for k, n := range a.nbrs {
+		seq[k] = uint16(n + 1) // The implicit hydrogen is `0`.
+		if n >= 0 && p.atoms[n].sym == "H" {
+			seq[k] = 0
+		}
+	}
+	asc := append([]uint16(nil), seq...)
+	sort.Slice(asc, func(i, j int) bool {
+		if asc[i] == 0 || asc[j] == 0 {
+			return asc[j] == 0 && asc[i] != 0
+		}
+		return asc[i] < asc[j]
+	})
+
+	odd := a.chiral == 2
+	if isOddPermutation(seq, asc) {
+		odd = !odd
+	}
+	if odd {
+		return cmn.StereoParityOdd
+	}
+	return cmn.StereoParityEven
+}
+
+// isCis answers the configuration of the given double bond, as
+// declared by the directions of the single bonds to its ends: whether
+// the substituents of the lowest input IDs at its ends lie on the same
+// side of it.  It answers `false` should the bond not be a double bond
+// with a directed single bond at each end.
+func (p *_SmilesParser) isCis(db _SmilesBond) (bool, bool) {
+	if db.order != 2 || db.aromatic {
+		return false, false
+	}
+
+	// side answers the side of the double bond on which lies the
+	// substituent of its given end, marked by a directed bond: `1`
+	// above, `-1` below, as `/` and `\` draw them from left to right.
+	// The substituent is compared with the lowest one of the end.
+	side := func(end, other int) (int, bool) {
+		lowest := -1
+		for _, n := range p.atoms[end].nbrs {
+			if n != other && n != implicitH && (lowest < 0 || n < lowest) {
+				lowest = n
+			}
+		}
+		for _, b := range p.bonds {
+			if b.dir == 0 || (b.a1 != end && b.a2 != end) {
+				continue
+			}
+			sub, s := b.a2, int(b.dir)
+			if b.a2 == end {
+				sub, s = b.a1, -s
+			}
+			if sub != lowest {
+				s = -s
+			}
+			return s, true
+		}
+		return 0, false
+	}
+	s1, ok1 := side(db.a1, db.a2)
+	s2, ok2 := side(db.a2, db.a1)
+	if !ok1 || !ok2 {
+		return false, false
+	}
+	return s1 == s2, true
+}
+
+// isOddPermutation answers if the given sequence is an odd
+// permutation of the given reference, whose elements are distinct.
+func isOddPermutation(seq, ref []uint16) bool {
+	pos := make(map[uint16]int, len(ref))
+	for i, n := range ref {
+		pos[n] = i
+	}
+	odd := false
+	for i := range seq {
+		for j := i + 1; j < len(seq); j++ {
+			if pos[seq[i]] > pos[seq[j]] {
+				odd = !odd
+			}
+		}
+	}
+	return odd
+}
+
+// readNumber reads the unsigned decimal number at the current
+// position, answering the given default if there is none.
+func (p *_SmilesParser) readNumber(def int) int {
+	start := p.i
+	for p.i < len(p.s) && isDigit(p.s[p.i]) {
+		p.i++
+	}
+	if p.i == start {
+		return def
+	}
+	n, _ := strconv.Atoi(p.s[start:p.i])
+	return n
+}
+
+// valence answers the total order of the bonds of the given atom,
+// counting aromatic bonds as single, and dative bonds as none, plus its
+// hydrogen count, if given.
+func (p *_SmilesParser) valence(i int) int {
+	v := p.atoms[i].hCount
+	for _, b := range p.bonds {
+		if b.a1 == i || b.a2 == i {
+			v += b.order
+		}
+	}
+	return v
+}
+
+// targetValence answers the lowest standard valence of the given atom,
+// adjusted for its charge, that accommodates its current valence.  It
+// answers `-1` for elements without standard valences.
+func (p *_SmilesParser) targetValence(i int) int {
+	a := p.atoms[i]
+	vals, ok := smilesValences[a.sym]
+	if !ok {
+		return -1
+	}
+
+	used := p.valence(i)
+	for _, v := range vals {
+		switch ch := a.charge; a.sym {
+		case "B":
+			v -= ch
+		case "C":
+			if ch < 0 {
+				ch = -ch
+			}
+			v -= ch
+		default:
+			v += ch
+		}
+		if v >= used {
+			return v
+		}
+	}
+	return -1
+}
+
+// isRadical answers if the given atom is a bracket atom of the organic
+// subset falling short of its lowest standard valence.
+func (p *_SmilesParser) isRadical(i int) bool {
+	a := p.atoms[i]
+	if !a.bracket || !smilesOrganic[a.sym] {
+		return false
+	}
+	v := p.targetValence(i)
+	return v >= 0 && p.valence(i) < v
+}
+
+// kekulise assigns single and double bonds to the aromatic bonds, so
+// that each aromatic atom short of its standard valence gets exactly
+// one double bond.  Aromatic bonds outside rings are made single.
+func (p *_SmilesParser) kekulise() error {
+	bridges := p.bridges()
+	cands := make([][]int, len(p.atoms)) // Candidate bonds, by atom.
+	for k := range p.bonds {
+		b := &p.bonds[k]
+		if !b.aromatic || bridges[k] {
+			continue
+		}
+		cands[b.a1] = append(cands[b.a1], k)
+		cands[b.a2] = append(cands[b.a2], k)
+	}
+
+	needs := make([]bool, len(p.atoms))
+	order := []int(nil)
+	for i, a := range p.atoms {
+		if a.aromatic && p.valence(i) < p.targetValence(i) {
+			needs[i] = true
+			order = append(order, i)
+		}
+	}
+
+	matched := make([]bool, len(p.atoms))
+	var match func(k int) bool
+	match = func(k int) bool {
+		for k < len(order) && matched[order[k]] {
+			k++
+		}
+		if k == len(order) {
+			return true
+		}
+
+		i := order[k]
+		for _, bk := range cands[i] {
+			b := &p.bonds[bk]
+			j := b.a1 + b.a2 - i
+			if !needs[j] || matched[j] {
+				continue
+			}
+			matched[i], matched[j] = true, true
+			b.order = 2
+			if match(k + 1) {
+				return true
+			}
+			matched[i], matched[j] = false, false
+			b.order = 1
+		}
+		return false
+	}
+	if !match(0) {
+		p.i = p.atoms[order[0]].pos
+		return p.syntaxError("Can not kekulise aromatic atoms")
+	}
+	return nil
+}
+
+// bridges answers which bonds are not in any ring.
+func (p *_SmilesParser) bridges() []bool {
+	adj := make([][]int, len(p.atoms))
+	for k, b := range p.bonds {
+		adj[b.a1] = append(adj[b.a1], k)
+		adj[b.a2] = append(adj[b.a2], k)
+	}
+
+	res := make([]bool, len(p.bonds))
+	disc := make([]int, len(p.atoms)) // Discovery times, from `1`.
+	low := make([]int, len(p.atoms))
+	t := 0
+	var visit func(i, via int)
+	visit = func(i, via int) {
+		t++
+		disc[i], low[i] = t, t
+		for _, k := range adj[i] {
+			if k == via {
+				continue
+			}
+			b := p.bonds[k]
+			j := b.a1 + b.a2 - i
+			if disc[j] == 0 {
+				visit(j, k)
+				if low[j] < low[i] {
+					low[i] = low[j]
+				}
+				if low[j] > disc[i] {
+					res[k] = true
+				}
+			} else if disc[j] < low[i] {
+				low[i] = disc[j]
+			}
+		}
+	}
+	for i := range p.atoms {
+		if disc[i] == 0 {
+			visit(i, -1)
+		}
+	}
+	return res
+}
+
+func isDigit(c byte) bool { return c >= '0' && c <= '9' }
+func isUpper(c byte) bool { return c >= 'A' && c <= 'Z' }
+func isLower(c byte) bool { return c >= 'a' && c <= 'z' }
+
+// isElement answers if the given symbol is that of an element.
+func isElement(sym string) bool {
+	el, ok := cmn.PeriodicTable[sym]
+	return ok && el.Number > 0
+}
+
+// WriteSmiles writes the given molecule to the given writer as a line
+// of a SMILES file: a SMILES string, followed by the molecule's `name`
+// attribute, if any.
+//
+// The string is in the Kekulé form, aromatic and query bonds being
+// written by their Kekulé types, and is not canonical: atoms are
+// written in depth-first order from the first atom of each component.
+// Stereo is not written.  `R` atoms are written as `*`, with their
+// R-groups as the atom labels, `_Rn`, of a ChemAxon extension,
+// `|$...$|`, following a space.  Hydrogen atoms counted in the hydrogen
+// counts of their former neighbours are not written, but the deuterium
+// and tritium among them are, as branches, `([2H])` and `([3H])`, of
+// their atoms.  Hydrogen atoms standing on their own, as those of
+// `H2`, or a proton, are written, with their hydrogens as branches, as
+// `[H][H]`.
+func WriteSmiles(w io.Writer, mol *molecule.Molecule) error {
+	smi, err := Smiles(mol)
+	if err != nil {
+		return err
+	}
+
+	bw := bufio.NewWriter(w)
+	bw.WriteString(smi)
+	if name, _ := mol.AttributeString("name"); name != "" {
+		bw.WriteByte(' ')
+		bw.WriteString(name)
+	}
+	bw.WriteByte('\n')
+	return bw.Flush()
+}
+
+// _SmilesWriter holds the state of writing a SMILES string.
+type _SmilesWriter struct {
+	atoms   map[uint16]molecule.AtomInfo
+	bonds   map[[2]uint16]molecule.BondInfo
+	order   []uint16       // Atoms written, in the order of their components.
+	ranks   map[uint16]int // Canonical ranks, if canonical.
+	opts    molecule.HashOptions
+	visited map[uint16]bool
+	open    map[uint16]bool // Atoms being visited.
+	pos     map[uint16]int  // Positions of the atoms in the string.
+	npos    int             // Number of atoms planned, with hydrogen branches.
+	parent  map[uint16]uint16
+	tree    map[uint16][]uint16
+	rings   map[uint16][]uint16 // Ring closures, by either atom.
+	digits  map[[2]uint16]int   // Digits of open ring closures.
+	dirs    map[[2]uint16]byte  // Directions of single bonds, `/` or `\`.
+	used    []bool              // Digits in use.
+	sb      strings.Builder
+}
+
+// Smiles answers a SMILES string of the given molecule.  See
+// `WriteSmiles`.
+func Smiles(mol *molecule.Molecule) (string, error) {
+	sw, err := newSmilesWriter(mol)
+	if err != nil {
+		return "", err
+	}
+	sw.opts = molecule.HashIsotopes | molecule.HashIsotopeSites
+	sw.writeAll()
+	if labels := sw.cxLabels(); labels != "" {
+		sw.sb.WriteString(" |" + labels + "|")
+	}
+	return sw.sb.String(), nil
+}
+
+// CanonicalSmiles answers the canonical SMILES string of the given
+// molecule, with the given optional layers, as of `Hash128`: equal
+// strings for equal structures, regardless of the order of their atoms
+// and bonds.  The molecule should have been sanitised.
+//
+// The atoms are ordered by their canonical ranks; see
+// `molecule.CanonicalRanks`.  Each component starts at its atom of the
+// lowest rank, and the neighbours of each atom are visited in the order
+// of their ranks.  The components follow one another in the order of
+// their first atoms.  The aromatic bonds are written in a Kekulé form
+// chosen by the ranks, whichever form the molecule was read in.
+//
+// With the stereo layer, the configurations of the stereocentres are
+// written as `@` or `@@`, those of the double bonds as `/` and `\` on
+// the single bonds to their ends, and the enhanced stereo groups as a
+// ChemAxon extension, `|a:...,&n:...,on:...|`, following a space, with
+// their atoms at their positions in the string, counted from `0`, and
+// the `AND` and `OR` groups numbered afresh from `1`.  The R-groups of
+// `R` atoms are written in the same extension, as atom labels, `_Rn`,
+// whatever the layers.  Without it, the
+// string is a stereo-insensitive variant, for loose matching.  Isotopes
+// are written only with the isotope layer, and the deuterium and
+// tritium counted in the hydrogens of atoms, as branches, only with
+// the isotope layer or the isotope sites layer.  Since SMILES has no
+// other way of writing them, the isotope layer implies the isotope
+// sites layer here: the strings of isotopomers that hash alike without
+// the latter, as `CD3-CH2-OH` and `CH3-CD2-OH`, differ.
+func CanonicalSmiles(mol *molecule.Molecule, opts molecule.HashOptions) (string, error) {
+	sw, groups, err := writeCanonical(mol, opts)
+	if err != nil {
+		return "", err
+	}
+	fields := []string(nil)
+	if ext := cxStereoExtension(groups); ext != "" {
+		fields = append(fields, ext)
+	}
+	if labels := sw.cxLabels(); labels != "" {
+		fields = append(fields, labels)
+	}
+	if len(fields) > 0 {
+		sw.sb.WriteString(" |" + strings.Join(fields, ",") + "|")
+	}
+	return sw.sb.String(), nil
+}
+
+// writeCanonical answers a writer that has written the canonical
+// SMILES string of the given molecule, with the given optional layers,
+// and, with the stereo layer, the enhanced stereo groups of the
+// molecule, by the positions of their atoms in the string.  See
+// `CanonicalSmiles`.
+func writeCanonical(mol *molecule.Molecule, opts molecule.HashOptions) (*_SmilesWriter, []_CXStereoGroup, error) {
+	sw, err := newSmilesWriter(mol)
+	if err != nil {
+		return nil, nil, err
+	}
+	// Deuterium and tritium counted in hydrogens are written as
+	// branches at their atoms, which the ranks should then tell apart.
+	if opts&molecule.HashIsotopes != 0 {
+		opts |= molecule.HashIsotopeSites
+	}
+	if sw.ranks, err = mol.CanonicalRanks(opts); err != nil {
+		return nil, nil, err
+	}
+	sw.opts = opts
+	sw.kekulise()
+	sort.Slice(sw.order, func(i, j int) bool { return sw.ranks[sw.order[i]] < sw.ranks[sw.order[j]] })
+	sw.writeAll()
+
+	if opts&molecule.HashStereo == 0 {
+		return sw, nil, nil
+	}
+	groups, err := mol.StereoGroups()
+	if err != nil {
+		return nil, nil, err
+	}
+	return sw, sw.cxStereoGroups(groups), nil
+}
+
+// kekulise assigns the aromatic bonds Kekulé types chosen by the
+// canonical ranks of their atoms, rather than by the order of their
+// input, so that the Kekulé forms of a molecule are written alike.
+// The atoms having a double aromatic bond are those of any Kekulé
+// form; of the perfect matchings of these along the aromatic bonds,
+// the one pairing each atom, lowest ranked first, with its neighbour
+// of the lowest rank that still allows a matching is taken.
+func (sw *_SmilesWriter) kekulise() {
+	aromatic := func(b molecule.BondInfo) bool {
+		return b.IsAromatic || b.Type == cmn.BondTypeAltern
+	}
+	needy := make(map[uint16]bool)
+	for _, b := range sw.bonds {
+		if aromatic(b) && b.KekuleType == cmn.BondTypeDouble {
+			needy[b.A1], needy[b.A2] = true, true
+		}
+	}
+	atoms := make([]uint16, 0, len(needy))
+	for iid := range needy {
+		atoms = append(atoms, iid)
+	}
+	sort.Slice(atoms, func(i, j int) bool { return sw.ranks[atoms[i]] < sw.ranks[atoms[j]] })
+
+	mate := make(map[uint16]uint16, len(atoms))
+	var match func(k int) bool
+	match = func(k int) bool {
+		for k < len(atoms) {
+			if _, ok := mate[atoms[k]]; !ok {
+				break
+			}
+			k++
+		}
+		if k == len(atoms) {
+			return true
+		}
+		iid := atoms[k]
+		for _, nbr := range sw.neighbours(iid) {
+			if _, ok := mate[nbr]; ok || !needy[nbr] || !aromatic(sw.bonds[bondKey(iid, nbr)]) {
+				continue
+			}
+			mate[iid], mate[nbr] = nbr, iid
+			if match(k + 1) {
+				return true
+			}
+			delete(mate, iid)
+			delete(mate, nbr)
+		}
+		return false
+	}
+	if !match(0) {
+		return
+	}
+
+	for key, b := range sw.bonds {
+		if !aromatic(b) {
+			continue
+		}
+		b.KekuleType = cmn.BondTypeSingle
+		if mate[key[0]] == key[1] && needy[key[0]] {
+			b.KekuleType = cmn.BondTypeDouble
+		}
+		sw.bonds[key] = b
+	}
+}
+
+// newSmilesWriter answers a writer of the given molecule, holding its
+// atoms, but the hydrogen atoms counted in their former neighbours, and
+// its bonds.
+func newSmilesWriter(mol *molecule.Molecule) (*_SmilesWriter, error) {
+	sw := &_SmilesWriter{
+		atoms:   make(map[uint16]molecule.AtomInfo, mol.AtomCount()),
+		bonds:   make(map[[2]uint16]molecule.BondInfo, mol.BondCount()),
+		order:   make([]uint16, 0, mol.AtomCount()),
+		visited: make(map[uint16]bool),
+		open:    make(map[uint16]bool),
+		pos:     make(map[uint16]int),
+		parent:  make(map[uint16]uint16),
+		tree:    make(map[uint16][]uint16),
+		rings:   make(map[uint16][]uint16),
+		digits:  make(map[[2]uint16]int),
+		dirs:    make(map[[2]uint16]byte),
+	}
+	it := mol.Atoms()
+	for it.Next() {
+		a := it.Atom()
+		if a.AtomicNumber == 1 && a.Counted && len(a.Neighbours) == 0 && a.Charge == 0 {
+			continue
+		}
+		sw.atoms[a.Iid] = a
+		sw.order = append(sw.order, a.Iid)
+	}
+	if err := it.Err(); err != nil {
+		return nil, err
+	}
+	bit := mol.Bonds()
+	for bit.Next() {
+		b := bit.Bond()
+		sw.bonds[bondKey(b.A1, b.A2)] = b
+	}
+	if err := bit.Err(); err != nil {
+		return nil, err
+	}
+	return sw, nil
+}
+
+// writeAll plans the traversal of all components, and writes them,
+// separated by dots.
+func (sw *_SmilesWriter) writeAll() {
+	roots := []uint16(nil)
+	for _, iid := range sw.order {
+		if !sw.visited[iid] {
+			sw.plan(iid, noParent)
+			roots = append(roots, iid)
+		}
+	}
+	if sw.opts&molecule.HashStereo != 0 {
+		sw.planDirections()
+	}
+	for k, iid := range roots {
+		if k > 0 {
+			sw.sb.WriteByte('.')
+		}
+		sw.write(iid)
+	}
+}
+
+// bondKey answers the key of the bond between the given atoms.
+func bondKey(a1, a2 uint16) [2]uint16 {
+	if a1 > a2 {
+		a1, a2 = a2, a1
+	}
+	return [2]uint16{a1, a2}
+}
+
+// noParent stands for the parent of the first atom of a component.
+// No atom has its input ID.
+const noParent = math.MaxUint16
+
+// plan traverses the component of the given atom depth-first, from
+// the given parent, recording the branches and the ring closures.
+func (sw *_SmilesWriter) plan(iid, parent uint16) {
+	sw.visited[iid] = true
+	sw.open[iid] = true
+	sw.pos[iid] = sw.npos
+	sw.npos += 1 + len(sw.hydrogenBranches(iid))
+	sw.parent[iid] = parent
+	for _, nbr := range sw.neighbours(iid) {
+		switch {
+		case nbr == parent:
+		case !sw.visited[nbr]:
+			sw.tree[iid] = append(sw.tree[iid], nbr)
+			sw.plan(nbr, iid)
+		case sw.open[nbr]:
+			sw.rings[nbr] = append(sw.rings[nbr], iid)
+			sw.rings[iid] = append(sw.rings[iid], nbr)
+		}
+	}
+	sw.open[iid] = false
+}
+
+// hydrogenBranches answers the hydrogens of the given atom to be
+// written as its branches: the deuterium and tritium counted in them,
+// with the isotope sites layer, and, of a hydrogen atom, the rest of
+// them too, since `[HH]` is not widely read.
+func (sw *_SmilesWriter) hydrogenBranches(iid uint16) []string {
+	a := sw.atoms[iid]
+	d, t := 0, 0
+	if sw.opts&molecule.HashIsotopeSites != 0 {
+		d, t = int(a.Deuterium), int(a.Tritium)
+	}
+	res := make([]string, 0, a.HCount)
+	for k := 0; k < d; k++ {
+		res = append(res, "[2H]")
+	}
+	for k := 0; k < t; k++ {
+		res = append(res, "[3H]")
+	}
+	if a.AtomicNumber == 1 {
+		for k := d + t; k < int(a.HCount); k++ {
+			res = append(res, "[H]")
+		}
+	}
+	return res
+}
+
+// neighbours answers the neighbours of the given atom, in the order of
+// their canonical ranks, if any.
+func (sw *_SmilesWriter) neighbours(iid uint16) []uint16 {
+	nbrs := sw.atoms[iid].Neighbours
+	if sw.ranks == nil {
+		return nbrs
+	}
+	nbrs = append([]uint16(nil), nbrs...)
+	sort.Slice(nbrs, func(i, j int) bool { return sw.ranks[nbrs[i]] < sw.ranks[nbrs[j]] })
+	return nbrs
+}
+
+// planDirections chooses the directions of single bonds, `/` or `\`,
+// that give the configurations of the double bonds: one bond at each
+// end, a branch rather than a ring closure, preferably one already
+// directed, for a conjugated neighbour.  The first end of a double
+// bond not otherwise settled has its substituent placed above the
+// bond.  Double bonds whose ends lack such bonds, or whose directions
+// conflict with those already chosen, are left undirected.
+func (sw *_SmilesWriter) planDirections() {
+	keys := make([][2]uint16, 0, len(sw.bonds))
+	for k, b := range sw.bonds {
+		if b.KekuleType == cmn.BondTypeDouble && b.Sides != 0 {
+			keys = append(keys, k)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		pi, pj := sw.pos[keys[i][0]]+sw.pos[keys[i][1]], sw.pos[keys[j][0]]+sw.pos[keys[j][1]]
+		if pi != pj {
+			return pi < pj
+		}
+		return sw.pos[keys[i][0]] < sw.pos[keys[j][0]]
+	})
+
+	// height answers the side of the double bond on which the given
+	// substituent of its given end lies, by the direction of their
+	// bond: `1` above, `-1` below.
+	height := func(end, sub uint16, dir byte) int {
+		h := 1
+		if dir == '\\' {
+			h = -1
+		}
+		if sw.pos[sub] < sw.pos[end] {
+			h = -h
+		}
+		return h
+	}
+	// substituent answers the substituent of the given end of a double
+	// bond, other than its given partner, to direct.
+	substituent := func(end, partner uint16) (uint16, bool) {
+		var res uint16
+		found := false
+		for _, n := range sw.neighbours(end) {
+			if n == partner || (sw.parent[n] != end && sw.parent[end] != n) {
+				continue
+			}
+			if _, ok := sw.dirs[bondKey(end, n)]; ok || !found {
+				res, found = n, true
+				if ok {
+					break
+				}
+			}
+		}
+		return res, found
+	}
+
+	for _, k := range keys {
+		b := sw.bonds[k]
+		x1, x2 := b.A1, b.A2
+		if sw.pos[x1] > sw.pos[x2] {
+			x1, x2 = x2, x1
+		}
+		s1, ok1 := substituent(x1, x2)
+		s2, ok2 := substituent(x2, x1)
+		if !ok1 || !ok2 {
+			continue
+		}
+
+		// The sides of the lowest substituents, by input IDs, are
+		// given; each other substituent lies opposite.
+		cis := int(b.Sides)
+		for _, end := range [][2]uint16{{x1, s1}, {x2, s2}} {
+			for _, n := range sw.atoms[end[0]].Neighbours {
+				if n != x1 && n != x2 && n < end[1] {
+					cis = -cis
+					break
+				}
+			}
+		}
+
+		d1, set1 := sw.dirs[bondKey(x1, s1)]
+		d2, set2 := sw.dirs[bondKey(x2, s2)]
+		h1, h2 := 1, cis
+		switch {
+		case set1 && set2:
+			continue
+		case set1:
+			h1 = height(x1, s1, d1)
+			h2 = cis * h1
+		case set2:
+			h2 = height(x2, s2, d2)
+			h1 = cis * h2
+		}
+		sw.direct(x1, s1, h1)
+		sw.direct(x2, s2, h2)
+	}
+}
+
+// direct sets the direction of the bond between the given end of a
+// double bond and its given substituent, so that the substituent lies
+// at the given height, `1` above the bond or `-1` below it.
+func (sw *_SmilesWriter) direct(end, sub uint16, h int) {
+	if sw.pos[sub] < sw.pos[end] {
+		h = -h
+	}
+	sw.dirs[bondKey(end, sub)] = '/'
+	if h < 0 {
+		sw.dirs[bondKey(end, sub)] = '\\'
+	}
+}
+
+// write writes the given atom, its ring closures and its branches,
+// its hydrogen branches first.
+func (sw *_SmilesWriter) write(iid uint16) {
+	hs := sw.hydrogenBranches(iid)
+	sw.writeAtom(sw.atoms[iid], sw.chirality(iid), len(hs))
+
+	for _, nbr := range sw.rings[iid] {
+		key := bondKey(iid, nbr)
+		d, ok := sw.digits[key]
+		if ok {
+			sw.used[d] = false
+			delete(sw.digits, key)
+		} else {
+			d = sw.freeDigit()
+			sw.digits[key] = d
+			sw.writeBond(key, iid)
+		}
+		if d < 10 {
+			sw.sb.WriteByte(byte('0' + d))
+		} else {
+			fmt.Fprintf(&sw.sb, "%%%02d", d)
+		}
+	}
+
+	kids := sw.tree[iid]
+	for k, h := range hs {
+		if k < len(hs)-1 || len(kids) > 0 {
+			h = "(" + h + ")"
+		}
+		sw.sb.WriteString(h)
+	}
+	for k, kid := range kids {
+		if k < len(kids)-1 {
+			sw.sb.WriteByte('(')
+		}
+		sw.writeBond(bondKey(iid, kid), iid)
+		sw.write(kid)
+		if k < len(kids)-1 {
+			sw.sb.WriteByte(')')
+		}
+	}
+}
+
+// freeDigit answers the lowest ring closure digit not in use, from
+// `1`, and marks it used.
+func (sw *_SmilesWriter) freeDigit() int {
+	for d := 1; d < len(sw.used); d++ {
+		if !sw.used[d] {
+			sw.used[d] = true
+			return d
+		}
+	}
+	if len(sw.used) == 0 {
+		sw.used = append(sw.used, true)
+	}
+	sw.used = append(sw.used, true)
+	return len(sw.used) - 1
+}
+
+// writeBond writes the symbol of the bond with the given key, written
+// from the given atom, unless it is single, or its direction if it is.
+// A dative bond is written `->` from its donor, and `<-` from its
+// acceptor.
+func (sw *_SmilesWriter) writeBond(key [2]uint16, from uint16) {
+	if d, ok := sw.dirs[key]; ok {
+		sw.sb.WriteByte(d)
+		return
+	}
+	switch b := sw.bonds[key]; b.KekuleType {
+	case cmn.BondTypeDouble:
+		sw.sb.WriteByte('=')
+	case cmn.BondTypeTriple:
+		sw.sb.WriteByte('#')
+	case cmn.BondTypeDative:
+		if b.A1 == from {
+			sw.sb.WriteString("->")
+		} else {
+			sw.sb.WriteString("<-")
+		}
+	}
+}
+
+// chirality answers the chirality of the given atom, `@` or `@@`, as
+// written, should it have a parity, and four neighbours, counting an
+// implicit hydrogen; blank otherwise.  The neighbours are ordered as
+// written: the parent, the implicit hydrogen, the ring closures and
+// the branches, the hydrogen following the ring closures if written as
+// an isotopic branch.  See `ReadSmiles`.
+func (sw *_SmilesWriter) chirality(iid uint16) string {
+	a := sw.atoms[iid]
+	if sw.opts&molecule.HashStereo == 0 {
+		return ""
+	}
+	switch {
+	case a.Parity != cmn.StereoParityOdd && a.Parity != cmn.StereoParityEven:
+		return ""
+	case len(a.Neighbours) == 4:
+	case len(a.Neighbours) == 3 && a.HCount == 1:
+	default:
+		return ""
+	}
+
+	const hydrogen = math.MaxUint16 // Stands for the implicit hydrogen.
+	seq := make([]uint16, 0, 4)
+	if p := sw.parent[iid]; p != noParent {
+		seq = append(seq, p)
+	}
+	branched := len(sw.hydrogenBranches(iid)) > 0
+	if len(a.Neighbours) == 3 && !branched {
+		seq = append(seq, hydrogen)
+	}
+	seq = append(seq, sw.rings[iid]...)
+	if len(a.Neighbours) == 3 && branched {
+		seq = append(seq, hydrogen)
+	}
+	seq = append(seq, sw.tree[iid]...)
+	asc := append([]uint16(nil), a.Neighbours...)
+	sort.Slice(asc, func(i, j int) bool { return asc[i] < asc[j] })
+	if len(a.Neighbours) == 3 {
+		asc = append(asc, hydrogen)
+	}
+
+	odd := a.Parity == cmn.StereoParityOdd
+	if isOddPermutation(seq, asc) {
+		odd = !odd
+	}
+	if odd {
+		return "@@"
+	}
+	return "@"
+}
+
+// _CXStereoGroup is an enhanced stereo group, as written in a ChemAxon
+// extension.
+type _CXStereoGroup struct {
+	typ   cmn.StereoGroupType
+	atoms []int // Positions of the atoms in the string, in ascending order.
+}
+
+// cxStereoGroups answers the given enhanced stereo groups, by the
+// positions of their atoms in the string, skipping those not written.
+func (sw *_SmilesWriter) cxStereoGroups(groups []molecule.StereoGroup) []_CXStereoGroup {
+	gs := make([]_CXStereoGroup, 0, len(groups))
+	for _, g := range groups {
+		atoms := make([]int, 0, len(g.Atoms))
+		for _, iid := range g.Atoms {
+			if p, ok := sw.pos[iid]; ok {
+				atoms = append(atoms, p)
+			}
+		}
+		if len(atoms) == 0 {
+			continue
+		}
+		sort.Ints(atoms)
+		gs = append(gs, _CXStereoGroup{g.Type, atoms})
+	}
+	return gs
+}
+
+// cxLabels answers the atom labels field of a CXSMILES extension,
+// `$...$`, giving the R-groups of the `R` atoms written as `_Rn`;
+// blank if there are none.
+func (sw *_SmilesWriter) cxLabels() string {
+	labels := make([]string, sw.npos)
+	found := false
+	for iid, p := range sw.pos {
+		if a := sw.atoms[iid]; a.RGroup != 0 {
+			labels[p] = fmt.Sprintf("_R%d", a.RGroup)
+			found = true
+		}
+	}
+	if !found {
+		return ""
+	}
+	return "$" + strings.Join(labels, ";") + "$"
+}
+
+// cxStereoExtension answers the fields of a CXSMILES extension for the
+// given enhanced stereo groups; blank if there are none.  The groups
+// are ordered by their types, and by their first atoms, and the `AND`
+// and `OR` groups numbered afresh from `1`.
+func cxStereoExtension(gs []_CXStereoGroup) string {
+	sort.Slice(gs, func(i, j int) bool {
+		if gs[i].typ != gs[j].typ {
+			return gs[i].typ < gs[j].typ
+		}
+		return gs[i].atoms[0] < gs[j].atoms[0]
+	})
+
+	fields := make([]string, 0, len(gs))
+	num := make(map[cmn.StereoGroupType]int)
+	for _, g := range gs {
+		prefix := "a"
+		switch g.typ {
+		case cmn.StereoGroupAnd:
+			num[g.typ]++
+			prefix = fmt.Sprintf("&%d", num[g.typ])
+		case cmn.StereoGroupOr:
+			num[g.typ]++
+			prefix = fmt.Sprintf("o%d", num[g.typ])
+		}
+		atoms := make([]string, len(g.atoms))
+		for k, p := range g.atoms {
+			atoms[k] = strconv.Itoa(p)
+		}
+		fields = append(fields, prefix+":"+strings.Join(atoms, ","))
+	}
+	return strings.Join(fields, ",")
+}
+
+// writeAtom writes the given atom, with the given chirality, if any,
+// and the given number of its hydrogens written as branches,
+// in brackets unless it is of the organic subset, has the hydrogen
+// count implied by its bonds, and no chirality.  The mass number is
+// written only with the isotope layer.
+func (sw *_SmilesWriter) writeAtom(a molecule.AtomInfo, chiral string, branches int) {
+	if a.AtomicNumber == 0 {
+		sw.sb.WriteByte('*')
+		return
+	}
+
+	a.HCount -= uint8(branches)
+	used := branches
+	for _, nbr := range a.Neighbours {
+		used += sw.bonds[bondKey(a.Iid, nbr)].KekuleType.Order()
+	}
+	isotope := a.Isotope
+	if sw.opts&molecule.HashIsotopes == 0 {
+		isotope = 0
+	}
+	implicit := -1
+	if smilesOrganic[a.Symbol] && a.Charge == 0 && isotope == 0 && a.Radical == cmn.RadicalNone && chiral == "" {
+		implicit = 0
+		for _, v := range smilesValences[a.Symbol] {
+			if v >= used {
+				implicit = v - used
+				break
+			}
+		}
+	}
+	if implicit == int(a.HCount) {
+		sw.sb.WriteString(a.Symbol)
+		return
+	}
+
+	sw.sb.WriteByte('[')
+	if isotope != 0 {
+		sw.sb.WriteString(strconv.Itoa(int(isotope)))
+	}
+	sw.sb.WriteString(a.Symbol)
+	sw.sb.WriteString(chiral)
+	switch {
+	case a.HCount == 1:
+		sw.sb.WriteByte('H')
+	case a.HCount > 1:
+		fmt.Fprintf(&sw.sb, "H%d", a.HCount)
+	}
+	switch {
+	case a.Charge == 1:
+		sw.sb.WriteByte('+')
+	case a.Charge == -1:
+		sw.sb.WriteByte('-')
+	case a.Charge != 0:
+		fmt.Fprintf(&sw.sb, "%+d", a.Charge)
+	}
+	sw.sb.WriteByte(']')
+}
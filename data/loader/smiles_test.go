@@ -0,0 +1,135 @@
+package loader_test
+
+import (
+	"testing"
+
+	"github.com/RxnWeaver/rxnweaver/data/loader"
+	"github.com/RxnWeaver/rxnweaver/data/molecule"
+)
+
+// readSmiles answers the sanitised passive molecule of the given SMILES
+// string.
+func readSmiles(t *testing.T, smi string) *molecule.Molecule {
+	t.Helper()
+	mol, err := loader.ReadSmiles(nil, []byte(smi))
+	if err != nil {
+		t.Fatalf("%s : %v", smi, err)
+	}
+	rep, err := molecule.Sanitize(mol, 0)
+	if err == nil && rep.HasErrors() {
+		err = rep
+	}
+	if err != nil {
+		mol.Release()
+		t.Fatalf("%s : %v", smi, err)
+	}
+	return mol
+}
+
+// canonical answers the canonical SMILES string of the given SMILES
+// string, with the given optional layers.
+func canonical(t *testing.T, smi string, opts molecule.HashOptions) string {
+	t.Helper()
+	mol := readSmiles(t, smi)
+	defer mol.Release()
+	res, err := loader.CanonicalSmiles(mol, opts)
+	if err != nil {
+		t.Fatalf("%s : %v", smi, err)
+	}
+	return res
+}
+
+func TestCanonicalSmilesAlike(t *testing.T) {
+	tests := []struct {
+		name string
+		opts molecule.HashOptions
+		smis []string
+	}{
+		{"naphthalene", 0, []string{
+			"c1ccc2ccccc2c1", "c1cccc2c1cccc2", "C1=CC=C2C=CC=CC2=C1", "C1=CC2=CC=CC=C2C=C1",
+		}},
+		{"salicylic acid", 0, []string{
+			"Oc1ccccc1C(=O)O", "c1cccc(O)c1C(O)=O", "OC1=CC=CC=C1C(O)=O", "OC(=O)C1=C(O)C=CC=C1",
+		}},
+		{"indole", 0, []string{"c1ccc2[nH]ccc2c1", "C1=CC=C2NC=CC2=C1", "N1C=CC2=CC=CC=C12"}},
+		{"biphenyl", 0, []string{"c1ccccc1-c1ccccc1", "C1=CC=C(C=C1)C1=CC=CC=C1", "C1(C2=CC=CC=C2)=CC=CC=C1"}},
+		{"pyridone", 0, []string{"O=c1cccc[nH]1", "O=C1C=CC=CN1", "N1C=CC=CC1=O"}},
+		{"salicylic acid, stereo", molecule.HashStereo | molecule.HashIsotopes, []string{
+			"Oc1ccccc1C(=O)O", "OC(=O)C1=C(O)C=CC=C1",
+		}},
+	}
+	for _, tt := range tests {
+		want := canonical(t, tt.smis[0], tt.opts)
+		for _, smi := range tt.smis[1:] {
+			if got := canonical(t, smi, tt.opts); got != want {
+				t.Errorf("%s : %s gives %s, want %s", tt.name, smi, got, want)
+			}
+		}
+	}
+}
+
+func TestCanonicalSmilesRoundTrip(t *testing.T) {
+	tests := []string{
+		"c1ccc2ccccc2c1",
+		"Oc1ccccc1C(=O)O",
+		"c1ccc2[nH]ccc2c1",
+		"Cc1ccncc1",
+	}
+	for _, smi := range tests {
+		want := canonical(t, smi, 0)
+		if got := canonical(t, want, 0); got != want {
+			t.Errorf("%s : %s reads back as %s", smi, want, got)
+		}
+	}
+}
+
+func TestCanonicalSmilesHydrogens(t *testing.T) {
+	tests := []struct {
+		smi  string
+		opts molecule.HashOptions
+		want string
+	}{
+		{"[H]C([H])([H])[H]", 0, "C"},
+		{"[H]OC", 0, "CO"},
+		{"[2H]C([2H])([2H])[2H]", 0, "C"},
+		{"[2H]C([2H])([2H])[2H]", molecule.HashIsotopes, "C([2H])([2H])([2H])[2H]"},
+		{"[2H]C", molecule.HashIsotopes, "C[2H]"},
+		{"C", molecule.HashIsotopes, "C"},
+		{"[13CH4]", 0, "C"},
+		{"[13CH4]", molecule.HashIsotopes, "[13CH4]"},
+	}
+	for _, tt := range tests {
+		if got := canonical(t, tt.smi, tt.opts); got != tt.want {
+			t.Errorf("%s, options %d : %s, want %s", tt.smi, tt.opts, got, tt.want)
+		}
+	}
+}
+
+func TestSmilesLoneHydrogens(t *testing.T) {
+	tests := []struct {
+		smi  string
+		want string
+	}{
+		{"[H][H]", "[H][H]"},
+		{"[H]", "[H]"},
+		{"[2H][2H]", "[2H][2H]"},
+		{"[H+]", "[H+]"},
+		{"[H-]", "[H-]"},
+		{"[H][H].C", "[H][H].C"},
+		{"[H]C([H])([H])[H]", "C"},
+	}
+	for _, tt := range tests {
+		mol := readSmiles(t, tt.smi)
+		got, err := loader.Smiles(mol)
+		mol.Release()
+		if err != nil {
+			t.Fatalf("%s : %v", tt.smi, err)
+		}
+		if got != tt.want {
+			t.Errorf("%s : %s, want %s", tt.smi, got, tt.want)
+		}
+		if c := canonical(t, got, molecule.HashIsotopes); c != canonical(t, tt.smi, molecule.HashIsotopes) {
+			t.Errorf("%s : %s reads back as %s", tt.smi, got, c)
+		}
+	}
+}
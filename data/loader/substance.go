@@ -0,0 +1,120 @@
+package loader
+
+import (
+	"bufio"
+	"io"
+	"sort"
+	"strings"
+
+	cmn "github.com/RxnWeaver/rxnweaver/common"
+	"github.com/RxnWeaver/rxnweaver/data/molecule"
+	"github.com/RxnWeaver/rxnweaver/data/substance"
+)
+
+// ReadSubstance answers the substance read from the given record by
+// the given parse function, which should sanitise its molecules, as
+// those of `Sanitized` do: the connected components of the molecule
+// parsed, with their counts.  Thus, a SMILES string such as
+// `CC(=O)O.CC(=O)O.O`, or a molfile of several fragments, is read as a
+// substance.  See `substance.FromMolecule`.
+func ReadSubstance(parse ParseFunc, rec []byte) (*substance.Substance, error) {
+	mol, err := parse(rec)
+	if mol == nil || err != nil {
+		if mol != nil {
+			mol.Release()
+		}
+		return nil, err
+	}
+	defer mol.Release()
+
+	return substance.FromMolecule(mol)
+}
+
+// SubstanceSmiles answers the canonical SMILES string of the given
+// substance, with the given optional layers: those of its components,
+// each written as many times as its units, in the order of the
+// strings, and separated by dots.  With the stereo layer, the string is
+// a ChemAxon extended one, with the enhanced stereo groups of all the
+// components; each unit of a racemic component is numbered afresh.  See
+// `CanonicalSmiles`.
+func SubstanceSmiles(s *substance.Substance, opts molecule.HashOptions) (string, error) {
+	type part struct {
+		smi    string
+		na     int // Atoms written.
+		groups []_CXStereoGroup
+	}
+	parts := make([]part, 0, len(s.Components()))
+	for _, c := range s.Components() {
+		sw, groups, err := writeCanonical(c.Molecule, opts)
+		if err != nil {
+			return "", err
+		}
+		for k := 0; k < c.Count; k++ {
+			parts = append(parts, part{sw.sb.String(), sw.npos, groups})
+		}
+	}
+	sort.SliceStable(parts, func(i, j int) bool { return parts[i].smi < parts[j].smi })
+
+	var sb strings.Builder
+	abs := _CXStereoGroup{typ: cmn.StereoGroupAbsolute}
+	groups := []_CXStereoGroup(nil)
+	offset := 0
+	for i, p := range parts {
+		if i > 0 {
+			sb.WriteByte('.')
+		}
+		sb.WriteString(p.smi)
+		for _, g := range p.groups {
+			atoms := make([]int, len(g.atoms))
+			for k, pos := range g.atoms {
+				atoms[k] = offset + pos
+			}
+			if g.typ == cmn.StereoGroupAbsolute {
+				abs.atoms = append(abs.atoms, atoms...)
+				continue
+			}
+			groups = append(groups, _CXStereoGroup{g.typ, atoms})
+		}
+		offset += p.na
+	}
+	if len(abs.atoms) > 0 {
+		groups = append(groups, abs)
+	}
+	if ext := cxStereoExtension(groups); ext != "" {
+		sb.WriteString(" |" + ext + "|")
+	}
+	return sb.String(), nil
+}
+
+// WriteSubstanceSmiles writes the given substance to the given writer
+// as a line of a SMILES file: its canonical SMILES string, with all
+// layers, followed by its name, if any.  See `SubstanceSmiles`.
+func WriteSubstanceSmiles(w io.Writer, s *substance.Substance) error {
+	smi, err := SubstanceSmiles(s, molecule.HashStereo|molecule.HashIsotopes)
+	if err != nil {
+		return err
+	}
+
+	bw := bufio.NewWriter(w)
+	bw.WriteString(smi)
+	if name := s.Name(); name != "" {
+		bw.WriteByte(' ')
+		bw.WriteString(name)
+	}
+	bw.WriteByte('\n')
+	return bw.Flush()
+}
+
+// WriteSubstanceSDF writes the given substance to the given writer, as
+// a record of an SD file, whose connection table has the components of
+// the substance as its fragments, each as many times as its units.  The
+// substance's name, if any, is written as the title.  See `WriteSDF`.
+func WriteSubstanceSDF(w io.Writer, s *substance.Substance) error {
+	mol, err := s.Molecule(nil)
+	if err != nil {
+		return err
+	}
+	defer mol.Release()
+
+	return WriteSDF(w, mol)
+}
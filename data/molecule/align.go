@@ -0,0 +1,428 @@
+package molecule
+
+import (
+	"fmt"
+	"math"
+	"sort"
+
+	cmn "github.com/RxnWeaver/rxnweaver/common"
+)
+
+// RMSDQuery is the payload of `ReqConformerRMSD`.
+type RMSDQuery struct {
+	Ref, Conformer int  // IDs of the conformers.
+	Align          bool // Superpose them first?
+}
+
+// ConformerAlignment is the payload of `ReqAlignConformer`.
+type ConformerAlignment struct {
+	Conformer int              // ID of the conformer to align.
+	Reference map[uint16]Point // Positions to fit, by input IDs of atoms.
+}
+
+// Superpose answers the given moving points, rotated and translated to
+// best fit the corresponding reference points by the Kabsch method,
+// and the RMSD of the fit.  The given points are not modified.
+func Superpose(ref, mov []Point) ([]Point, float64) {
+	return superpose(ref, mov)
+}
+
+// RMSD answers the root mean square deviation of the given
+// corresponding points, as they are.
+func RMSD(x, y []Point) float64 {
+	return rmsd(x, y)
+}
+
+// ConformerRMSD answers the RMSD between the conformers of this
+// molecule with the given IDs, over all the atoms.  If `align` is
+// `true`, the second conformer is first superposed on the first, for
+// an RMSD independent of their orientations; neither is modified.
+func (m *Molecule) ConformerRMSD(refId, id int, align bool) (float64, error) {
+	reply := m.Call(ReqConformerRMSD, RMSDQuery{refId, id, align})
+	if err := statusError(reply, fmt.Sprintf("conformers %d and %d", refId, id)); err != nil {
+		return 0, err
+	}
+	return reply.Payload.(float64), nil
+}
+
+// AlignConformer rotates and translates the conformer with the given
+// ID, so that the atoms with the given input IDs best fit the given
+// positions.  The other atoms move along with them.  It answers the
+// RMSD of the fitted atoms.
+func (m *Molecule) AlignConformer(id int, ref map[uint16]Point) (float64, error) {
+	reply := m.Call(ReqAlignConformer, ConformerAlignment{id, ref})
+	if err := statusError(reply, fmt.Sprintf("conformer %d", id)); err != nil {
+		return 0, err
+	}
+	return reply.Payload.(float64), nil
+}
+
+// AlignConformerTo aligns the conformer with the given ID to the
+// conformer of the given reference molecule with the given ID.  The
+// atom map pairs input IDs of atoms in this molecule with those of the
+// corresponding atoms in the reference; those atoms are fitted, as in
+// `AlignConformer`.  The map is typically that of a common scaffold.
+func (m *Molecule) AlignConformerTo(id int, ref *Molecule, refId int, atomMap map[uint16]uint16) (float64, error) {
+	rc, err := ref.Conformer(refId)
+	if err != nil {
+		return 0, err
+	}
+
+	pts := make(map[uint16]Point, len(atomMap))
+	for iid, riid := range atomMap {
+		p, ok := rc.Coords[riid]
+		if !ok {
+			return 0, fmt.Errorf("Atom %d is not in molecule %d.", riid, ref.id)
+		}
+		pts[iid] = p
+	}
+	return m.AlignConformer(id, pts)
+}
+
+// AlignToTemplate orients the 2D depiction of this molecule to match
+// that of the given template, so that a series of molecules sharing a
+// scaffold are depicted alike.  The atom map pairs input IDs of atoms
+// in this molecule with those of the corresponding atoms in the
+// template.
+//
+// The coordinates of all the atoms are rotated, scaled and translated
+// to best fit the mapped atoms to the template.  The depiction is
+// flipped over, too, if that fits better; the wedges of its bonds are
+// then inverted, to retain its stereochemistry.  It answers the RMSD
+// of the mapped atoms, in the units of the template's coordinates.
+func (m *Molecule) AlignToTemplate(tmpl *Molecule, atomMap map[uint16]uint16) (float64, error) {
+	pts := make(map[uint16]Point, len(atomMap))
+	for iid, tiid := range atomMap {
+		ai, err := tmpl.AtomInfo(tiid)
+		if err != nil {
+			return 0, err
+		}
+		pts[iid] = Point{float64(ai.X), float64(ai.Y), 0}
+	}
+
+	reply := m.Call(ReqAlignDepiction, pts)
+	if err := statusError(reply, fmt.Sprintf("molecule %d", m.id)); err != nil {
+		return 0, err
+	}
+	return reply.Payload.(float64), nil
+}
+
+// handleConformerRMSD answers the RMSD between the requested
+// conformers.
+func (m *Molecule) handleConformerRMSD(p interface{}) (StatusType, interface{}) {
+	q, ok := p.(RMSDQuery)
+	if !ok {
+		return StIncorrectParameter, nil
+	}
+	i, j := m.conformerIndex(q.Ref), m.conformerIndex(q.Conformer)
+	if i < 0 || j < 0 {
+		return StNotFound, nil
+	}
+
+	ref, mov := m.points(m.conformers[i]), m.points(m.conformers[j])
+	if q.Align {
+		_, r := superpose(ref, mov)
+		return StSuccess, r
+	}
+	return StSuccess, rmsd(ref, mov)
+}
+
+// fitPoints answers the current and the requested positions of the
+// atoms with the given input IDs, in increasing order of the IDs.
+// `cur` answers the current position of an atom.
+func (m *Molecule) fitPoints(ref map[uint16]Point, cur func(a *_Atom) Point) ([]Point, []Point, error) {
+	if len(ref) == 0 {
+		return nil, nil, fmt.Errorf("No atoms to fit.")
+	}
+
+	iids := make([]int, 0, len(ref))
+	for iid := range ref {
+		iids = append(iids, int(iid))
+	}
+	sort.Ints(iids)
+
+	from := make([]Point, 0, len(iids))
+	to := make([]Point, 0, len(iids))
+	for _, iid := range iids {
+		a := m.atomWithIid(uint16(iid))
+		if a == nil {
+			return nil, nil, fmt.Errorf("Atom %d is not in molecule %d.", iid, m.id)
+		}
+		from = append(from, cur(a))
+		to = append(to, ref[uint16(iid)])
+	}
+	return from, to, nil
+}
+
+// handleAlignConformer aligns the requested conformer to the given
+// positions of some of its atoms.
+func (m *Molecule) handleAlignConformer(p interface{}) (StatusType, interface{}) {
+	q, ok := p.(ConformerAlignment)
+	if !ok {
+		return StIncorrectParameter, nil
+	}
+	i := m.conformerIndex(q.Conformer)
+	if i < 0 {
+		return StNotFound, nil
+	}
+	c := m.conformers[i]
+
+	mov, ref, err := m.fitPoints(q.Reference, func(a *_Atom) Point { return c.Coords[a.iId] })
+	if err != nil {
+		return StIncorrectParameter, err
+	}
+	rm := kabsch(ref, mov)
+
+	pts := rm.apply(m.points(c))
+	c.Coords = make(map[uint16]Point, len(pts))
+	for k, a := range m.atoms {
+		c.Coords[a.iId] = pts[k]
+	}
+	confs := append([]Conformer(nil), m.conformers...)
+	confs[i] = c
+	m.conformers = confs
+
+	return StSuccess, rmsd(ref, rm.apply(mov))
+}
+
+// handleAlignDepiction fits the 2D coordinates of the atoms of this
+// molecule to the given template positions of some of them.
+//
+// Taking the points of the plane as complex numbers, the best fit of
+// centred points `p` to centred points `q`, by rotation and scaling,
+// is `z p`, with `z = Σ conj(p) q / Σ |p|²`.  That by a reflection as
+// well is `z' conj(p)`, with `z' = Σ p q / Σ |p|²`.  The better of the
+// two has the larger `|z|`.
+func (m *Molecule) handleAlignDepiction(p interface{}) (StatusType, interface{}) {
+	tmpl, ok := p.(map[uint16]Point)
+	if !ok {
+		return StIncorrectParameter, nil
+	}
+	mov, ref, err := m.fitPoints(tmpl, func(a *_Atom) Point { return Point{float64(a.X), float64(a.Y), 0} })
+	if err != nil {
+		return StIncorrectParameter, err
+	}
+
+	cm, cr := centroid(mov), centroid(ref)
+	var rot, refl complex128
+	norm := 0.0
+	for i := range mov {
+		pc := complex(mov[i][0]-cm[0], mov[i][1]-cm[1])
+		qc := complex(ref[i][0]-cr[0], ref[i][1]-cr[1])
+		rot += complex(real(pc), -imag(pc)) * qc
+		refl += pc * qc
+		norm += real(pc)*real(pc) + imag(pc)*imag(pc)
+	}
+
+	z, flip := complex(1, 0), false
+	if norm > 0 {
+		z = rot / complex(norm, 0)
+		if cAbs(refl) > cAbs(rot) {
+			z, flip = refl/complex(norm, 0), true
+		}
+	}
+	scale := cAbs(z)
+
+	move := func(x, y float64) (float64, float64) {
+		pc := complex(x-cm[0], y-cm[1])
+		if flip {
+			pc = complex(real(pc), -imag(pc))
+		}
+		r := z * pc
+		return real(r) + cr[0], imag(r) + cr[1]
+	}
+
+	dev := 0.0
+	for i := range mov {
+		x, y := move(mov[i][0], mov[i][1])
+		dx, dy := x-ref[i][0], y-ref[i][1]
+		dev += dx*dx + dy*dy
+	}
+
+	// Flipping the plane over, and the Z-axis with it, is a rotation
+	// in space; so, the depiction retains its stereochemistry if its
+	// wedges are inverted.
+	for _, a := range m.atoms {
+		x, y := move(float64(a.X), float64(a.Y))
+		a.X, a.Y = float32(x), float32(y)
+		a.Z = float32(float64(a.Z) * scale)
+		if flip {
+			a.Z = -a.Z
+		}
+		m.publish(EvAtomChanged, a.iId, 0)
+	}
+	if flip {
+		for _, b := range m.bonds {
+			switch b.bStereo {
+			case cmn.BondStereoUp:
+				b.bStereo = cmn.BondStereoDown
+			case cmn.BondStereoDown:
+				b.bStereo = cmn.BondStereoUp
+			default:
+				continue
+			}
+			m.publish(EvBondChanged, 0, b.id)
+		}
+	}
+
+	return StSuccess, math.Sqrt(dev / float64(len(mov)))
+}
+
+// cAbs answers the modulus of the given complex number.
+func cAbs(z complex128) float64 {
+	return math.Hypot(real(z), imag(z))
+}
+
+// centroid answers the mean of the given points.
+func centroid(pts []Point) Point {
+	c := Point{}
+	for _, p := range pts {
+		for k := 0; k < 3; k++ {
+			c[k] += p[k]
+		}
+	}
+	for k := 0; k < 3; k++ {
+		c[k] /= float64(len(pts))
+	}
+	return c
+}
+
+// rmsd answers the root mean square deviation of the given
+// corresponding points, without aligning them.
+func rmsd(x, y []Point) float64 {
+	if len(x) == 0 {
+		return 0
+	}
+	s := 0.0
+	for i := range x {
+		d := sub(x[i], y[i])
+		s += dot(d, d)
+	}
+	return math.Sqrt(s / float64(len(x)))
+}
+
+// superpose answers the given moving points, rotated and translated to
+// best fit the corresponding reference points, and the RMSD of the
+// fit.
+func superpose(ref, mov []Point) ([]Point, float64) {
+	if len(ref) == 0 {
+		return nil, 0
+	}
+	res := kabsch(ref, mov).apply(mov)
+	return res, rmsd(ref, res)
+}
+
+// _RigidMotion is a rotation about a centre, followed by a
+// translation of the centre to a new position.
+type _RigidMotion struct {
+	rot      [3][3]float64
+	from, to Point
+}
+
+// apply answers the given points moved by this motion.
+func (rm _RigidMotion) apply(pts []Point) []Point {
+	res := make([]Point, len(pts))
+	for i, p := range pts {
+		d := sub(p, rm.from)
+		for a := 0; a < 3; a++ {
+			res[i][a] = rm.rot[a][0]*d[0] + rm.rot[a][1]*d[1] + rm.rot[a][2]*d[2] + rm.to[a]
+		}
+	}
+	return res
+}
+
+// kabsch answers the rigid motion that best fits the given moving
+// points to the corresponding reference points.
+//
+// The optimal rotation is that of Kabsch, found here through Horn's
+// quaternion formulation: it is the eigenvector of the largest
+// eigenvalue of a 4x4 symmetric matrix built from the covariance of
+// the points.  That avoids a singular value decomposition, and never
+// answers a reflection.
+func kabsch(ref, mov []Point) _RigidMotion {
+	cr, cm := centroid(ref), centroid(mov)
+
+	s := [3][3]float64{}
+	for i := range ref {
+		p, q := sub(mov[i], cm), sub(ref[i], cr)
+		for a := 0; a < 3; a++ {
+			for b := 0; b < 3; b++ {
+				s[a][b] += p[a] * q[b]
+			}
+		}
+	}
+
+	n := [4][4]float64{
+		{s[0][0] + s[1][1] + s[2][2], s[1][2] - s[2][1], s[2][0] - s[0][2], s[0][1] - s[1][0]},
+		{s[1][2] - s[2][1], s[0][0] - s[1][1] - s[2][2], s[0][1] + s[1][0], s[2][0] + s[0][2]},
+		{s[2][0] - s[0][2], s[0][1] + s[1][0], -s[0][0] + s[1][1] - s[2][2], s[1][2] + s[2][1]},
+		{s[0][1] - s[1][0], s[2][0] + s[0][2], s[1][2] + s[2][1], -s[0][0] - s[1][1] + s[2][2]},
+	}
+	q := largestEigenvector4(n)
+	return _RigidMotion{quaternionRotation(q), cm, cr}
+}
+
+// quaternionRotation answers the rotation matrix of the given unit
+// quaternion.
+func quaternionRotation(q [4]float64) [3][3]float64 {
+	w, x, y, z := q[0], q[1], q[2], q[3]
+	return [3][3]float64{
+		{w*w + x*x - y*y - z*z, 2 * (x*y - w*z), 2 * (x*z + w*y)},
+		{2 * (x*y + w*z), w*w - x*x + y*y - z*z, 2 * (y*z - w*x)},
+		{2 * (x*z - w*y), 2 * (y*z + w*x), w*w - x*x - y*y + z*z},
+	}
+}
+
+// largestEigenvector4 answers the unit eigenvector of the largest
+// eigenvalue of the given symmetric matrix, by the cyclic Jacobi
+// method.
+func largestEigenvector4(a [4][4]float64) [4]float64 {
+	v := [4][4]float64{{1, 0, 0, 0}, {0, 1, 0, 0}, {0, 0, 1, 0}, {0, 0, 0, 1}}
+	for sweep := 0; sweep < 50; sweep++ {
+		off := 0.0
+		for p := 0; p < 4; p++ {
+			for q := p + 1; q < 4; q++ {
+				off += a[p][q] * a[p][q]
+			}
+		}
+		if off < 1e-22 {
+			break
+		}
+
+		for p := 0; p < 4; p++ {
+			for q := p + 1; q < 4; q++ {
+				if a[p][q] == 0 {
+					continue
+				}
+				theta := (a[q][q] - a[p][p]) / (2 * a[p][q])
+				t := 1 / (math.Abs(theta) + math.Sqrt(theta*theta+1))
+				if theta < 0 {
+					t = -t
+				}
+				c := 1 / math.Sqrt(t*t+1)
+				s := t * c
+
+				for k := 0; k < 4; k++ {
+					akp, akq := a[k][p], a[k][q]
+					a[k][p], a[k][q] = c*akp-s*akq, s*akp+c*akq
+				}
+				for k := 0; k < 4; k++ {
+					apk, aqk := a[p][k], a[q][k]
+					a[p][k], a[q][k] = c*apk-s*aqk, s*apk+c*aqk
+				}
+				for k := 0; k < 4; k++ {
+					vkp, vkq := v[k][p], v[k][q]
+					v[k][p], v[k][q] = c*vkp-s*vkq, s*vkp+c*vkq
+				}
+			}
+		}
+	}
+
+	best := 0
+	for k := 1; k < 4; k++ {
+		if a[k][k] > a[best][best] {
+			best = k
+		}
+	}
+	return [4]float64{v[0][best], v[1][best], v[2][best], v[3][best]}
+}
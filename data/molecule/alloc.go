@@ -0,0 +1,91 @@
+package molecule
+
+import (
+	"sync"
+
+	bits "github.com/willf/bitset"
+
+	cmn "github.com/RxnWeaver/rxnweaver/common"
+)
+
+// Pools of atoms and bonds, whose storage is reused across molecules.
+//
+// Pipelines that stream very many molecules can `Release` each
+// molecule once done with it.  Its atoms and bonds are then recycled,
+// along with their bitsets and lists, reducing the pressure on the
+// garbage collector.
+var (
+	atomPool = sync.Pool{New: func() interface{} { return new(_Atom) }}
+	bondPool = sync.Pool{New: func() interface{} { return new(_Bond) }}
+)
+
+// allocAtom answers a zeroed atom, reusing released storage when
+// available.
+func allocAtom() *_Atom {
+	a := atomPool.Get().(*_Atom)
+	if a.bonds == nil {
+		a.bonds = bits.New(cmn.MaxBonds)
+		a.nbrs = make([]uint16, 0, cmn.MaxBonds)
+		a.adj = make([]Neighbour, 0, cmn.MaxBonds)
+		a.rings = bits.New(cmn.MaxRings)
+		a.features = make([]uint16, 0, cmn.MaxFeatures)
+	}
+	return a
+}
+
+// releaseAtom zeroes the given atom, retaining its storage, and returns
+// it to the pool.
+func releaseAtom(a *_Atom) {
+	*a = _Atom{
+		bonds:    a.bonds.ClearAll(),
+		nbrs:     a.nbrs[:0],
+		adj:      a.adj[:0],
+		rings:    a.rings.ClearAll(),
+		features: a.features[:0],
+	}
+	atomPool.Put(a)
+}
+
+// allocBond answers a zeroed bond, reusing released storage when
+// available.
+func allocBond() *_Bond {
+	b := bondPool.Get().(*_Bond)
+	if b.rings == nil {
+		b.rings = make([]uint16, 0, cmn.MaxRings)
+	}
+	return b
+}
+
+// releaseBond zeroes the given bond, retaining its storage, and returns
+// it to the pool.
+func releaseBond(b *_Bond) {
+	*b = _Bond{rings: b.rings[:0]}
+	bondPool.Put(b)
+}
+
+// Release terminates this molecule, if it is alive, and returns the
+// storage of its atoms and bonds for reuse.
+//
+// Neither this molecule, nor its builders, nor any data obtained from
+// them by reference, may be used after its release.  A molecule held
+// through handles is released by its last handle instead; see
+// `Handle`.
+func (m *Molecule) Release() {
+	m.Call(ReqExit, nil)
+	<-m.done
+
+	for _, a := range m.atoms {
+		releaseAtom(a)
+	}
+	for _, b := range m.bonds {
+		releaseBond(b)
+	}
+
+	m.atoms, m.bonds = nil, nil
+	m.rings, m.ringSystems = nil, nil
+	m.atomsByIid, m.atomsByNid = nil, nil
+	m.bondsById, m.bondsByPair = nil, nil
+	m.attributes, m.subscribers = nil, nil
+	m.cols, m.members = nil, nil
+	m.discardDistances()
+}
@@ -15,11 +15,12 @@ import (
 // transient information attached to it during its participation in
 // reactions.
 type _Atom struct {
-	mol    *Molecule // Containing molecule of this atom.
-	atNum  uint8     // Atomic number of this atom's element.
-	symbol string    // Symbol, in case of a different isotope.
-	iId    uint16    // Serial input ID of this atom.
-	nId    uint16    // Normalised ID of this atom.
+	mol     *Molecule // Containing molecule of this atom.
+	atNum   uint8     // Atomic number of this atom's element.
+	symbol  string    // Symbol, in case of a different isotope.
+	isotope uint16    // Mass number, if of a specific isotope; `0` otherwise.
+	iId     uint16    // Serial input ID of this atom.
+	nId     uint16    // Normalised ID of this atom.
 
 	X float32 // X-coordinate of this atom.
 	Y float32 // Y-coordinate of this atom.
@@ -37,6 +38,7 @@ type _Atom struct {
 
 	bonds           *bits.BitSet // Bitmap of bonds of this atom.
 	nbrs            []uint16     // Expanded list of neighbours of this atom.
+	adj             []Neighbour  // Distinct neighbours, with the bonds to them.
 	singleBondCount uint8        // Number of single bonds this atom has.
 	doubleBondCount uint8        // Number of double bonds this atom has.
 	tripleBondCount uint8        // Number of triple bonds this atom has.
@@ -48,6 +50,16 @@ type _Atom struct {
 	isBridgeHead bool
 	// Is this atom the sole common atom of all of its rings?
 	isSpiro bool
+	// Is this atom a stereocentre?  Set by stereo perception.
+	stereoType cmn.StereoType
+	cip        cmn.CIPDescriptor // Configuration, if a stereocentre and determined.
+	parity     cmn.StereoParity  // MDL parity, if a tetrahedral stereocentre.
+	declared   cmn.StereoParity  // Parity declared without coordinates, as by SMILES.
+
+	rgroup     uint8    // Of an `R` atom, the number of the R-group it stands for.
+	attachment uint8    // Attachment points of a substituent at this atom; see `AtomInfo`.
+	hIsotopes  [2]uint8 // Of its hydrogens, those of deuterium and tritium.
+	counted    bool     // Of a hydrogen atom, whether counted in the hydrogen count of a neighbour.
 
 	// The functional groups substituted on this atom.  They are listed in
 	// descending order of importance.  The first is the primary feature.
@@ -59,12 +71,15 @@ type _Atom struct {
 	unsatEwNbrCount int
 	// Number of saturated electron-withdrawing neighbours.
 	satEwNbrCount int
+
+	// Optional annotations of this atom.
+	attributes []Attribute
 }
 
 // newAtom constructs and initialises a new atom of the given element
 // type, and belonging to the given molecule.
 func newAtom(mol *Molecule, atNum uint8, iId int) *_Atom {
-	atom := new(_Atom)
+	atom := allocAtom()
 	atom.mol = mol
 	atom.atNum = atNum
 	atom.iId = uint16(iId)
@@ -73,12 +88,6 @@ func newAtom(mol *Molecule, atNum uint8, iId int) *_Atom {
 	atom.symbol = el.Symbol
 	atom.valence = el.Valence
 
-	atom.bonds = bits.New(cmn.MaxBonds)
-	atom.nbrs = make([]uint16, 0, cmn.MaxBonds)
-	atom.rings = bits.New(cmn.MaxRings)
-
-	atom.features = make([]uint16, 0, cmn.MaxFeatures)
-
 	return atom
 }
 
@@ -102,7 +111,6 @@ func (a *_Atom) Parent() *Molecule {
 // parts of RxnWeaver's decision rules.  Exercise great caution should
 // you need to modify this in any manner!
 func (a *_Atom) determineUnsaturation() error {
-	nb := int(a.bonds.Count())
 	nn := len(a.nbrs)
 
 	// Atom has a residual charge.
@@ -119,8 +127,9 @@ func (a *_Atom) determineUnsaturation() error {
 		}
 	}
 
-	// Case of all single bonds.
-	if nb == nn {
+	// Case of all single bonds, but for dative ones, which add nothing
+	// to the valence.
+	if a.doubleBondCount == 0 && a.tripleBondCount == 0 {
 		a.unsaturation = cmn.UnsaturationNone
 		return nil
 	}
@@ -187,9 +196,25 @@ func (a *_Atom) determineUnsaturation() error {
 // could contribute towards computation of aromaticity or not.  A
 // `false` value means that the presence of such an atom prevents the
 // ring containing it from becoming aromatic.
+//
+// Bonds to metal atoms are not counted, since they bind ligands to
+// their centres; thus, the cyclopentadienide rings of a metallocene
+// remain aromatic.
 func (a *_Atom) piElectronCount() (int, bool) {
 	mol := a.mol
-	wtSum := 100*int16(a.doubleBondCount) + 10*int16(a.singleBondCount) + int16(a.charge)
+	nsb, ndb := int16(a.singleBondCount), int16(a.doubleBondCount)
+	for _, nbr := range a.adj {
+		if !cmn.IsMetal(mol.atomWithIid(nbr.Atom).atNum) {
+			continue
+		}
+		switch mol.bondWithId(nbr.Bond).bType {
+		case cmn.BondTypeSingle:
+			nsb--
+		case cmn.BondTypeDouble:
+			ndb--
+		}
+	}
+	wtSum := 100*ndb + 10*nsb + int16(a.charge)
 
 	switch a.atNum {
 	case 6:
@@ -204,7 +229,7 @@ func (a *_Atom) piElectronCount() (int, bool) {
 			var b *_Bond
 			for bid, ok := a.bonds.NextSet(0); ok; bid, ok = a.bonds.NextSet(bid + 1) {
 				b = mol.bondWithId(uint16(bid))
-				if b.bType == cmn.BondTypeDouble {
+				if b.bType == cmn.BondTypeDouble && !b.isCoordination() {
 					break
 				}
 			}
@@ -296,7 +321,8 @@ func (a *_Atom) addBond(b *_Bond) {
 
 	a.bonds.Set(uint(b.id))
 	nbrId := b.otherAtomIid(a.iId)
-	n := int(b.bType)
+	a.adj = append(a.adj, Neighbour{nbrId, b.id})
+	n := b.bType.Order()
 	for i := 0; i < n; i++ {
 		a.nbrs = append(a.nbrs, nbrId)
 	}
@@ -338,17 +364,22 @@ func (a *_Atom) removeBond(b *_Bond) {
 	}
 	a.nbrs = a.nbrs[:wid]
 
+	for i, nbr := range a.adj {
+		if nbr.Bond == b.id {
+			a.adj = append(a.adj[:i], a.adj[i+1:]...)
+			break
+		}
+	}
+
 	a.bonds.Clear(uint(b.id))
 }
 
 // bondTo answers the bond that binds this atom to the given atom, if
 // one such bond exists.  Answers `nil` otherwise.
 func (a *_Atom) bondTo(other uint16) *_Bond {
-	mol := a.mol
-	for bid, ok := a.bonds.NextSet(0); ok; bid, ok = a.bonds.NextSet(bid + 1) {
-		b := mol.bondWithId(uint16(bid))
-		if b.otherAtomIid(a.iId) == other {
-			return b
+	for _, nbr := range a.adj {
+		if nbr.Atom == other {
+			return a.mol.bondWithId(nbr.Bond)
 		}
 	}
 
@@ -391,7 +422,7 @@ func (a *_Atom) firstMultiplyBondedNeighbourId() (uint16, *_Bond) {
 	mol := a.mol
 	for bid, ok := a.bonds.NextSet(0); ok; bid, ok = a.bonds.NextSet(bid + 1) {
 		b := mol.bondWithId(uint16(bid))
-		if b.bType >= cmn.BondTypeDouble {
+		if b.bType == cmn.BondTypeDouble || b.bType == cmn.BondTypeTriple {
 			return b.otherAtomIid(a.iId), b
 		}
 	}
@@ -402,15 +433,7 @@ func (a *_Atom) firstMultiplyBondedNeighbourId() (uint16, *_Bond) {
 // isInRingOfSize answers if this atom participates in at least one
 // ring of the given size.
 func (a *_Atom) isInRingOfSize(n int) bool {
-	mol := a.mol
-	for rid, ok := a.rings.NextSet(0); ok; rid, ok = a.rings.NextSet(rid + 1) {
-		r := mol.ringWithId(uint8(rid))
-		if r.size() == n {
-			return true
-		}
-	}
-
-	return false
+	return a.mol.isAtomInRingOfSize(a.iId, n)
 }
 
 // isInRingLargerThan answers if this atom participates in at least
@@ -418,7 +441,7 @@ func (a *_Atom) isInRingOfSize(n int) bool {
 func (a *_Atom) isInRingLargerThan(n int) bool {
 	mol := a.mol
 	for rid, ok := a.rings.NextSet(0); ok; rid, ok = a.rings.NextSet(rid + 1) {
-		r := mol.ringWithId(uint8(rid))
+		r := mol.ringWithId(uint16(rid))
 		if r.size() > n {
 			return true
 		}
@@ -429,23 +452,23 @@ func (a *_Atom) isInRingLargerThan(n int) bool {
 
 // smallestRing answers the smallest unique ring in which this atom
 // participates.  If no such unique ring exists, an error is answered.
-func (a *_Atom) smallestRing() (uint8, error) {
+func (a *_Atom) smallestRing() (uint16, error) {
 	if !a.isCyclic() {
 		return 0, fmt.Errorf("Atom not cyclic.")
 	}
 
 	min := int(math.MaxUint8)
 	c := 0
-	var ret uint8
+	var ret uint16
 
 	mol := a.mol
 	for rid, ok := a.rings.NextSet(0); ok; rid, ok = a.rings.NextSet(rid + 1) {
-		r := mol.ringWithId(uint8(rid))
+		r := mol.ringWithId(uint16(rid))
 		size := r.size()
 		if size == min {
 			c++
 		} else if size < min {
-			ret = uint8(rid)
+			ret = uint16(rid)
 			c = 1
 		}
 	}
@@ -474,7 +497,7 @@ func (a *_Atom) isInHeteroAromaticRing() bool {
 
 	mol := a.mol
 	for rid, ok := a.rings.NextSet(0); ok; rid, ok = a.rings.NextSet(rid + 1) {
-		r := mol.ringWithId(uint8(rid))
+		r := mol.ringWithId(uint16(rid))
 		if r.isHeteroAromatic() {
 			return true
 		}
@@ -798,3 +821,43 @@ func (a *_Atom) isNH2orOHorSH() bool {
 
 	return false
 }
+
+// distinctNeighbours answers the input IDs of the distinct neighbours
+// of this atom.
+func (a *_Atom) distinctNeighbours() []uint16 {
+	nbrs := make([]uint16, len(a.adj))
+	for i, nbr := range a.adj {
+		nbrs[i] = nbr.Atom
+	}
+
+	return nbrs
+}
+
+// info answers a snapshot of the current state of this atom.
+func (a *_Atom) info() AtomInfo {
+	return AtomInfo{
+		Iid:          a.iId,
+		Nid:          a.nId,
+		AtomicNumber: a.atNum,
+		Symbol:       a.symbol,
+		Isotope:      a.isotope,
+		Charge:       a.charge,
+		HCount:       a.hCount,
+		Valence:      a.valence,
+		Radical:      a.radical,
+		X:            a.X,
+		Y:            a.Y,
+		Z:            a.Z,
+		IsAromatic:   a.isInAroRing,
+		IsCyclic:     a.isCyclic(),
+		StereoType:   a.stereoType,
+		CIP:          a.cip,
+		Parity:       a.parity,
+		RGroup:       a.rgroup,
+		Attachment:   a.attachment,
+		Deuterium:    a.hIsotopes[0],
+		Tritium:      a.hIsotopes[1],
+		Counted:      a.counted,
+		Neighbours:   a.distinctNeighbours(),
+	}
+}
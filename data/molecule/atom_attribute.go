@@ -0,0 +1,219 @@
+package molecule
+
+import (
+	"fmt"
+)
+
+// Atoms and bonds can carry their own attributes, such as partial
+// charges, atom map numbers, colour hints or model scores.  Their
+// semantics are those of the attributes of molecules: names are
+// case-sensitive, setting an attribute overrides all existing ones of
+// the same name, and lookups answer the most recently added one.  See
+// `Attribute`.
+//
+// Attributes follow their atoms and bonds when molecules are cloned,
+// merged or extracted from.
+
+// AtomMapAttribute names the attribute of an atom holding its atom map
+// number, which pairs it with an atom on the other side of a reaction.
+// See `loader.ReadSmiles`.
+const AtomMapAttribute = "map"
+
+// AtomAttributes answers all the attributes of the atom with the given
+// input ID, in the order of their addition.
+func (m *Molecule) AtomAttributes(iid uint16) ([]Attribute, error) {
+	reply := m.Call(ReqAtomAttributes, AtomQuery{iid})
+	if err := statusError(reply, fmt.Sprintf("atom %d", iid)); err != nil {
+		return nil, err
+	}
+	return reply.Payload.([]Attribute), nil
+}
+
+// AtomAttribute answers the attribute with the given name of the atom
+// with the given input ID.
+func (m *Molecule) AtomAttribute(iid uint16, name string) (Attribute, error) {
+	attrs, err := m.AtomAttributes(iid)
+	if err != nil {
+		return Attribute{}, err
+	}
+	return lookupAttribute(ReqAtomAttributes, attrs, name, fmt.Sprintf("atom %d", iid))
+}
+
+// SetAtomAttribute sets the value of the attribute with the given name
+// of the atom with the given input ID.  The value is as documented for
+// `SetAttribute`.
+func (m *Molecule) SetAtomAttribute(iid uint16, name string, value interface{}) error {
+	s, err := formatAttribute(value)
+	if err != nil {
+		return fmt.Errorf("Attribute %s of atom %d : %v", name, iid, err)
+	}
+	attr := Attribute{Name: name, Value: s}
+	return statusError(m.Call(ReqSetAtomAttribute, AtomAttribute{iid, attr}), fmt.Sprintf("atom %d", iid))
+}
+
+// DeleteAtomAttribute removes all the attributes with the given name of
+// the atom with the given input ID.
+func (m *Molecule) DeleteAtomAttribute(iid uint16, name string) error {
+	attr := Attribute{Name: name}
+	return statusError(m.Call(ReqDeleteAtomAttribute, AtomAttribute{iid, attr}), fmt.Sprintf("attribute %s of atom %d", name, iid))
+}
+
+// BondAttributes answers all the attributes of the bond with the given
+// ID, in the order of their addition.
+func (m *Molecule) BondAttributes(id uint16) ([]Attribute, error) {
+	reply := m.Call(ReqBondAttributes, BondQuery{id})
+	if err := statusError(reply, fmt.Sprintf("bond %d", id)); err != nil {
+		return nil, err
+	}
+	return reply.Payload.([]Attribute), nil
+}
+
+// BondAttribute answers the attribute with the given name of the bond
+// with the given ID.
+func (m *Molecule) BondAttribute(id uint16, name string) (Attribute, error) {
+	attrs, err := m.BondAttributes(id)
+	if err != nil {
+		return Attribute{}, err
+	}
+	return lookupAttribute(ReqBondAttributes, attrs, name, fmt.Sprintf("bond %d", id))
+}
+
+// SetBondAttribute sets the value of the attribute with the given name
+// of the bond with the given ID.  The value is as documented for
+// `SetAttribute`.
+func (m *Molecule) SetBondAttribute(id uint16, name string, value interface{}) error {
+	s, err := formatAttribute(value)
+	if err != nil {
+		return fmt.Errorf("Attribute %s of bond %d : %v", name, id, err)
+	}
+	attr := Attribute{Name: name, Value: s}
+	return statusError(m.Call(ReqSetBondAttribute, BondAttribute{id, attr}), fmt.Sprintf("bond %d", id))
+}
+
+// DeleteBondAttribute removes all the attributes with the given name of
+// the bond with the given ID.
+func (m *Molecule) DeleteBondAttribute(id uint16, name string) error {
+	attr := Attribute{Name: name}
+	return statusError(m.Call(ReqDeleteBondAttribute, BondAttribute{id, attr}), fmt.Sprintf("attribute %s of bond %d", name, id))
+}
+
+// lookupAttribute answers the most recently added attribute with the
+// given name in the given list of the given owner, as answered to the
+// given request.
+func lookupAttribute(req RequestType, attrs []Attribute, name, owner string) (Attribute, error) {
+	i := attributeIndex(attrs, name)
+	if i < 0 {
+		return Attribute{}, newRequestError(req, StNotFound, fmt.Errorf("attribute %s of %s", name, owner))
+	}
+	return attrs[i], nil
+}
+
+// handleAtomAttributes answers a copy of the attributes of the
+// requested atom.
+func (m *Molecule) handleAtomAttributes(p interface{}) (StatusType, interface{}) {
+	q, ok := p.(AtomQuery)
+	if !ok {
+		return StIncorrectParameter, nil
+	}
+
+	a := m.atomWithIid(q.Iid)
+	if a == nil {
+		return StNotFound, nil
+	}
+	return StSuccess, append([]Attribute{}, a.attributes...)
+}
+
+// handleBondAttributes answers a copy of the attributes of the
+// requested bond.
+func (m *Molecule) handleBondAttributes(p interface{}) (StatusType, interface{}) {
+	q, ok := p.(BondQuery)
+	if !ok {
+		return StIncorrectParameter, nil
+	}
+
+	b := m.bondWithId(q.Id)
+	if b == nil {
+		return StNotFound, nil
+	}
+	return StSuccess, append([]Attribute{}, b.attributes...)
+}
+
+// handleSetAtomAttribute sets the given attribute of the requested
+// atom.
+func (m *Molecule) handleSetAtomAttribute(p interface{}) (StatusType, interface{}) {
+	q, ok := p.(AtomAttribute)
+	if !ok || q.Attr.Name == "" {
+		return StIncorrectParameter, nil
+	}
+
+	a := m.atomWithIid(q.Iid)
+	if a == nil {
+		return StNotFound, nil
+	}
+
+	a.attributes, _ = setAttribute(a.attributes, q.Attr)
+	m.publish(EvAtomChanged, a.iId, 0)
+	return StSuccess, nil
+}
+
+// handleSetBondAttribute sets the given attribute of the requested
+// bond.
+func (m *Molecule) handleSetBondAttribute(p interface{}) (StatusType, interface{}) {
+	q, ok := p.(BondAttribute)
+	if !ok || q.Attr.Name == "" {
+		return StIncorrectParameter, nil
+	}
+
+	b := m.bondWithId(q.Id)
+	if b == nil {
+		return StNotFound, nil
+	}
+
+	b.attributes, _ = setAttribute(b.attributes, q.Attr)
+	m.publish(EvBondChanged, 0, b.id)
+	return StSuccess, nil
+}
+
+// handleDeleteAtomAttribute removes the attributes with the given name
+// of the requested atom.
+func (m *Molecule) handleDeleteAtomAttribute(p interface{}) (StatusType, interface{}) {
+	q, ok := p.(AtomAttribute)
+	if !ok {
+		return StIncorrectParameter, nil
+	}
+
+	a := m.atomWithIid(q.Iid)
+	if a == nil {
+		return StNotFound, nil
+	}
+
+	attrs, ok := deleteAttributes(a.attributes, q.Attr.Name)
+	if !ok {
+		return StNotFound, nil
+	}
+	a.attributes = attrs
+	m.publish(EvAtomChanged, a.iId, 0)
+	return StSuccess, nil
+}
+
+// handleDeleteBondAttribute removes the attributes with the given name
+// of the requested bond.
+func (m *Molecule) handleDeleteBondAttribute(p interface{}) (StatusType, interface{}) {
+	q, ok := p.(BondAttribute)
+	if !ok {
+		return StIncorrectParameter, nil
+	}
+
+	b := m.bondWithId(q.Id)
+	if b == nil {
+		return StNotFound, nil
+	}
+
+	attrs, ok := deleteAttributes(b.attributes, q.Attr.Name)
+	if !ok {
+		return StNotFound, nil
+	}
+	b.attributes = attrs
+	m.publish(EvBondChanged, 0, b.id)
+	return StSuccess, nil
+}
@@ -15,9 +15,18 @@ import (
 // is to send it to a molecule for inclusion in it.
 //
 // An instance of builder can create and build any number of atoms.
+//
+// Besides the methods answering errors immediately, the builder has
+// chainable methods, beginning with `Element` and ending with `Add`,
+// that record the first error in building the current atom.  Errors
+// so recorded are also accumulated in the molecule, to be reported
+// together by `Molecule.Build`.
+//
+//	ab.Element("N").FormalCharge(1).Isotope(15).Coords(x, y, z).Add()
 type AtomBuilder struct {
 	mol *Molecule // Molecule whose atoms this builder constructs.
 	a   *_Atom    // Atom being built by this builder.
+	err error     // First error in building the current atom.
 }
 
 // New creates a new atom instance in this builder.
@@ -34,6 +43,11 @@ func (ab *AtomBuilder) New(sym string, iId int) (*AtomBuilder, error) {
 	// The molecule, in which this atom gets eventually included,
 	// should set itself as the containing molecule.
 	ab.a = newAtom(ab.mol, el.Number, iId)
+	if el.Number == 0 {
+		// Pseudo-elements share the atomic number `0`; their symbols
+		// tell them apart.
+		ab.a.symbol = el.Symbol
+	}
 	return ab, nil
 }
 
@@ -47,7 +61,11 @@ func (ab *AtomBuilder) Coordinates(x, y, z float32) *AtomBuilder {
 	return ab
 }
 
-// Charge sets the residual charge on this atom.
+// Charge sets the residual charge on this atom, given in the MDL
+// encoding: `1`, `2` and `3` mean +3, +2 and +1, respectively; `4`
+// means a doublet radical; `5`, `6` and `7` mean -1, -2 and -3,
+// respectively.  See `FormalCharge` for specifying the charge
+// directly.
 func (ab *AtomBuilder) Charge(ch int) *AtomBuilder {
 	switch ch {
 	case 1:
@@ -79,3 +97,155 @@ func (ab *AtomBuilder) Valence(v int) *AtomBuilder {
 
 	return ab
 }
+
+// Element creates a new atom of the element with the given symbol in
+// this builder, assigning it the next input ID in sequence.
+func (ab *AtomBuilder) Element(sym string) *AtomBuilder {
+	ab.err = nil
+	if _, err := ab.New(sym, int(ab.mol.nextAtomIid)); err != nil {
+		ab.a = nil
+		ab.fail(err)
+	}
+	return ab
+}
+
+// FormalCharge sets the residual charge on this atom, in the range
+// [-7, 7].
+func (ab *AtomBuilder) FormalCharge(ch int) *AtomBuilder {
+	if ab.a == nil {
+		return ab.fail(fmt.Errorf("No atom being built."))
+	}
+	if ch < -7 || ch > 7 {
+		return ab.fail(fmt.Errorf("Atom %d : formal charge out of range : %d", ab.a.iId, ch))
+	}
+
+	ab.a.charge = int8(ch)
+	return ab
+}
+
+// Isotope sets the mass number of this atom, to mark it as being of
+// that specific isotope.
+func (ab *AtomBuilder) Isotope(mass int) *AtomBuilder {
+	if ab.a == nil {
+		return ab.fail(fmt.Errorf("No atom being built."))
+	}
+	if mass < int(ab.a.atNum) || mass > cmn.MaxMassNumber {
+		return ab.fail(fmt.Errorf("Atom %d : invalid mass number for %s : %d", ab.a.iId, ab.a.symbol, mass))
+	}
+
+	ab.a.isotope = uint16(mass)
+	return ab
+}
+
+// Radical sets the radical configuration of this atom.  See `Charge`
+// for the MDL encoding of a doublet.
+func (ab *AtomBuilder) Radical(r cmn.Radical) *AtomBuilder {
+	if ab.a == nil {
+		return ab.fail(fmt.Errorf("No atom being built."))
+	}
+	if r > cmn.RadicalTriplet {
+		return ab.fail(fmt.Errorf("Atom %d : invalid radical configuration : %d", ab.a.iId, r))
+	}
+
+	ab.a.radical = r
+	return ab
+}
+
+// Counted marks this hydrogen atom as counted in the hydrogen count of
+// a former neighbour, as bonding it to one does; see
+// `BondBuilder.Atoms`.  This serves formats that keep such atoms, as
+// stores do.
+func (ab *AtomBuilder) Counted() *AtomBuilder {
+	if ab.a == nil {
+		return ab.fail(fmt.Errorf("No atom being built."))
+	}
+	if ab.a.atNum != 1 {
+		return ab.fail(fmt.Errorf("Atom %d : %s counted as a hydrogen", ab.a.iId, ab.a.symbol))
+	}
+
+	ab.a.counted = true
+	return ab
+}
+
+// Coords sets the given coordinates as the X-, Y- and Z-coordinates of
+// this atom.
+func (ab *AtomBuilder) Coords(x, y, z float32) *AtomBuilder {
+	if ab.a == nil {
+		return ab.fail(fmt.Errorf("No atom being built."))
+	}
+	return ab.Coordinates(x, y, z)
+}
+
+// Parity declares the configuration of this atom, as a tetrahedral
+// stereocentre, by the MDL parity of its neighbours, numbered by their
+// input IDs; see `AtomInfo`.  This serves formats that give
+// configurations without coordinates, as SMILES does.  A declared
+// parity overrides the coordinates of the atom, and the wedges drawn
+// from it.  It is dropped should a bond of the atom be removed.
+func (ab *AtomBuilder) Parity(p cmn.StereoParity) *AtomBuilder {
+	if ab.a == nil {
+		return ab.fail(fmt.Errorf("No atom being built."))
+	}
+	ab.a.declared = p
+	return ab
+}
+
+// RGroup sets the number of the R-group that this `R` atom stands for,
+// from `1` to `cmn.MaxRGroup`, as numbered in molfiles.  See `Markush`
+// in package `enumeration`.
+func (ab *AtomBuilder) RGroup(n int) *AtomBuilder {
+	if ab.a == nil {
+		return ab.fail(fmt.Errorf("No atom being built."))
+	}
+	if ab.a.symbol != "R" {
+		return ab.fail(fmt.Errorf("Atom %d : R-group number for %s : %d", ab.a.iId, ab.a.symbol, n))
+	}
+	if n < 1 || n > cmn.MaxRGroup {
+		return ab.fail(fmt.Errorf("Atom %d : R-group number out of range : %d", ab.a.iId, n))
+	}
+
+	ab.a.rgroup = uint8(n)
+	return ab
+}
+
+// Attachment marks this atom as bearing the given attachment points of
+// a substituent, as in the R-group definitions of molfiles: `1` for
+// the first, `2` for the second, and `3` for both.
+func (ab *AtomBuilder) Attachment(points int) *AtomBuilder {
+	if ab.a == nil {
+		return ab.fail(fmt.Errorf("No atom being built."))
+	}
+	if points < 0 || points > 3 {
+		return ab.fail(fmt.Errorf("Atom %d : invalid attachment points : %d", ab.a.iId, points))
+	}
+
+	ab.a.attachment = uint8(points)
+	return ab
+}
+
+// Add adds the atom built so far to the molecule, unless an error was
+// recorded in building it.  It answers that error, or the one in
+// adding the atom, if any.  The error is also accumulated in the
+// molecule.
+func (ab *AtomBuilder) Add() error {
+	err := ab.err
+	if err == nil {
+		err = ab.mol.AddAtom(ab)
+	}
+	ab.err = nil
+
+	if err != nil {
+		ab.a = nil
+		ab.mol.noteBuildError(err)
+	}
+	return err
+}
+
+// fail records the given error for the current atom, unless one is
+// already recorded.
+func (ab *AtomBuilder) fail(err error) *AtomBuilder {
+	if ab.err == nil {
+		ab.err = err
+	}
+	return ab
+}
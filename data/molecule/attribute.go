@@ -1,10 +1,281 @@
 package molecule
 
+import (
+	"fmt"
+	"strconv"
+)
+
 // Attribute represents a (key, value) pair that annotates this
 // molecule.
 //
-// A given molecule can have zero or more such attributes.
+// A given molecule can have zero or more such attributes.  Names are
+// case-sensitive.
+//
+// Several attributes can share a name, as data fields in SD files
+// can.  `AddTag` always appends a new attribute, whereas
+// `SetAttribute` overrides all existing ones of the same name.  When
+// looking up a name, the most recently added attribute of that name
+// wins.
 type Attribute struct {
 	Name  string
 	Value string
+
+	// Verbatim header line of the SD data field that this attribute
+	// was read from, if any.  See package `loader`.
+	Header string
+}
+
+// Attributes answers all the attributes of this molecule, in the order
+// of their addition.
+func (m *Molecule) Attributes() ([]Attribute, error) {
+	reply := m.Call(ReqAttributes, nil)
+	if err := statusError(reply, fmt.Sprintf("molecule %d", m.id)); err != nil {
+		return nil, err
+	}
+	return reply.Payload.([]Attribute), nil
+}
+
+// Attribute answers the attribute of this molecule with the given
+// name.  Should there be several, the most recently added one is
+// answered.
+func (m *Molecule) Attribute(name string) (Attribute, error) {
+	reply := m.Call(ReqAttribute, name)
+	if err := statusError(reply, fmt.Sprintf("attribute %s", name)); err != nil {
+		return Attribute{}, err
+	}
+	return reply.Payload.(Attribute), nil
+}
+
+// SetAttribute sets the value of the attribute with the given name,
+// adding it if it does not exist.  Should there be several of that
+// name, the first of them takes the new value, and the others are
+// removed.  Its position among the attributes, and its SD header, if
+// any, are thus retained.
+//
+// The value can be a string, a boolean, an integer or a
+// floating-point number.  Non-string values are stored in their
+// canonical textual forms, as answered by `strconv`.
+func (m *Molecule) SetAttribute(name string, value interface{}) error {
+	s, err := formatAttribute(value)
+	if err != nil {
+		return fmt.Errorf("Attribute %s : %v", name, err)
+	}
+	return statusError(m.Call(ReqSetAttribute, Attribute{Name: name, Value: s}), fmt.Sprintf("attribute %s", name))
+}
+
+// DeleteAttribute removes all the attributes of this molecule with the
+// given name.
+func (m *Molecule) DeleteAttribute(name string) error {
+	return statusError(m.Call(ReqDeleteAttribute, name), fmt.Sprintf("attribute %s", name))
+}
+
+// AttributeString answers the value of the attribute with the given
+// name.
+func (m *Molecule) AttributeString(name string) (string, error) {
+	attr, err := m.Attribute(name)
+	if err != nil {
+		return "", err
+	}
+	return attr.Value, nil
+}
+
+// AttributeInt answers the value of the attribute with the given name,
+// as an integer.
+func (m *Molecule) AttributeInt(name string) (int64, error) {
+	attr, err := m.Attribute(name)
+	if err != nil {
+		return 0, err
+	}
+	return attr.Int()
+}
+
+// AttributeFloat answers the value of the attribute with the given
+// name, as a floating-point number.
+func (m *Molecule) AttributeFloat(name string) (float64, error) {
+	attr, err := m.Attribute(name)
+	if err != nil {
+		return 0, err
+	}
+	return attr.Float()
+}
+
+// AttributeBool answers the value of the attribute with the given
+// name, as a boolean.
+func (m *Molecule) AttributeBool(name string) (bool, error) {
+	attr, err := m.Attribute(name)
+	if err != nil {
+		return false, err
+	}
+	return attr.Bool()
+}
+
+// Int answers the value of this attribute as an integer.  Surrounding
+// white space is NOT tolerated.
+func (attr Attribute) Int() (int64, error) {
+	n, err := strconv.ParseInt(attr.Value, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("Attribute %s is not an integer : %q", attr.Name, attr.Value)
+	}
+	return n, nil
+}
+
+// Float answers the value of this attribute as a floating-point
+// number.
+func (attr Attribute) Float() (float64, error) {
+	f, err := strconv.ParseFloat(attr.Value, 64)
+	if err != nil {
+		return 0, fmt.Errorf("Attribute %s is not a number : %q", attr.Name, attr.Value)
+	}
+	return f, nil
+}
+
+// Bool answers the value of this attribute as a boolean.  The values
+// understood are those of `strconv.ParseBool`.
+func (attr Attribute) Bool() (bool, error) {
+	b, err := strconv.ParseBool(attr.Value)
+	if err != nil {
+		return false, fmt.Errorf("Attribute %s is not a boolean : %q", attr.Name, attr.Value)
+	}
+	return b, nil
+}
+
+// formatAttribute answers the textual form of the given attribute
+// value.
+func formatAttribute(value interface{}) (string, error) {
+	switch v := value.(type) {
+	case string:
+		return v, nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case int:
+		return strconv.FormatInt(int64(v), 10), nil
+	case int32:
+		return strconv.FormatInt(int64(v), 10), nil
+	case int64:
+		return strconv.FormatInt(v, 10), nil
+	case uint:
+		return strconv.FormatUint(uint64(v), 10), nil
+	case uint32:
+		return strconv.FormatUint(uint64(v), 10), nil
+	case uint64:
+		return strconv.FormatUint(v, 10), nil
+	case float32:
+		return strconv.FormatFloat(float64(v), 'g', -1, 32), nil
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64), nil
+	}
+	return "", fmt.Errorf("Unsupported value type : %T", value)
+}
+
+// attributeIndex answers the position of the most recently added
+// attribute with the given name in the given list, or `-1` if there is
+// none.
+func attributeIndex(attrs []Attribute, name string) int {
+	for i := len(attrs) - 1; i >= 0; i-- {
+		if attrs[i].Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// setAttribute overrides the attributes in the given list having the
+// name of the given attribute, or appends it if there are none.  See
+// `SetAttribute`.  It answers the updated list, and if any attribute
+// was overridden.
+func setAttribute(attrs []Attribute, attr Attribute) ([]Attribute, bool) {
+	first := -1
+	wid := 0
+	for _, el := range attrs {
+		if el.Name == attr.Name {
+			if first >= 0 {
+				continue
+			}
+			first = wid
+			if attr.Header == "" {
+				attr.Header = el.Header
+			}
+			el = attr
+		}
+		attrs[wid] = el
+		wid++
+	}
+	attrs = attrs[:wid]
+
+	if first < 0 {
+		return append(attrs, attr), false
+	}
+	return attrs, true
+}
+
+// deleteAttributes removes the attributes with the given name from the
+// given list.  It answers the updated list, and if any attribute was
+// removed.
+func deleteAttributes(attrs []Attribute, name string) ([]Attribute, bool) {
+	wid := 0
+	for _, el := range attrs {
+		if el.Name != name {
+			attrs[wid] = el
+			wid++
+		}
+	}
+	return attrs[:wid], wid < len(attrs)
+}
+
+// handleAttributes answers a copy of the attributes of this molecule.
+func (m *Molecule) handleAttributes(p interface{}) (StatusType, interface{}) {
+	res := make([]Attribute, len(m.attributes))
+	copy(res, m.attributes)
+	return StSuccess, res
+}
+
+// handleAttribute answers the most recently added attribute with the
+// given name.
+func (m *Molecule) handleAttribute(p interface{}) (StatusType, interface{}) {
+	name, ok := p.(string)
+	if !ok {
+		return StIncorrectParameter, nil
+	}
+
+	i := attributeIndex(m.attributes, name)
+	if i < 0 {
+		return StNotFound, nil
+	}
+	return StSuccess, m.attributes[i]
+}
+
+// handleSetAttribute overrides the attributes with the given
+// attribute's name, or adds it if there are none.  See
+// `SetAttribute`.
+func (m *Molecule) handleSetAttribute(p interface{}) (StatusType, interface{}) {
+	attr, ok := p.(Attribute)
+	if !ok || attr.Name == "" {
+		return StIncorrectParameter, nil
+	}
+
+	attrs, replaced := setAttribute(m.attributes, attr)
+	m.attributes = attrs
+	if replaced {
+		m.publish(EvTagChanged, 0, 0)
+	} else {
+		m.publish(EvTagAdded, 0, 0)
+	}
+	return StSuccess, nil
+}
+
+// handleDeleteAttribute removes all the attributes with the given
+// name.
+func (m *Molecule) handleDeleteAttribute(p interface{}) (StatusType, interface{}) {
+	name, ok := p.(string)
+	if !ok {
+		return StIncorrectParameter, nil
+	}
+
+	attrs, ok := deleteAttributes(m.attributes, name)
+	if !ok {
+		return StNotFound, nil
+	}
+	m.attributes = attrs
+	m.publish(EvTagRemoved, 0, 0)
+	return StSuccess, nil
 }
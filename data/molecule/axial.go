@@ -0,0 +1,115 @@
+package molecule
+
+import (
+	cmn "github.com/RxnWeaver/rxnweaver/common"
+)
+
+// Least number of substituents ortho to a biaryl axis that hinder its
+// rotation enough for its atropisomers to be isolable at room
+// temperature.  Two suffice only with very bulky groups; three or four
+// is the usual rule.
+const minOrthoSubstituents = 3
+
+// isAtropisomericAxis answers if this bond is a stereogenic axis of
+// hindered rotation, given the canonical classes of the atoms: an
+// acyclic single bond joining two aromatic rings, each end of which
+// bears two constitutionally distinct ortho atoms, with enough
+// substituents among them.  Ring fusions count as substituents, as in
+// 1,1'-binaphthyl.
+func (b *_Bond) isAtropisomericAxis(cls map[uint16]uint64) bool {
+	if b.bType != cmn.BondTypeSingle || b.isAro || b.isCyclic() {
+		return false
+	}
+
+	subs := 0
+	for _, aid := range []uint16{b.a1, b.a2} {
+		a := b.mol.atomWithIid(aid)
+		if !a.isInAroRing || len(a.adj) != 3 {
+			return false
+		}
+		orthos := b.axisOrthos(a)
+		if cls[orthos[0]] == cls[orthos[1]] {
+			return false
+		}
+		for _, oid := range orthos {
+			o := b.mol.atomWithIid(oid)
+			if len(o.adj) > 2 {
+				subs++
+			}
+		}
+	}
+	return subs >= minOrthoSubstituents
+}
+
+// axisOrthos answers the two neighbours of the given end of this axis
+// other than its other end.
+func (b *_Bond) axisOrthos(a *_Atom) []uint16 {
+	other := b.otherAtomIid(a.iId)
+	res := make([]uint16, 0, 2)
+	for _, nbr := range a.adj {
+		if nbr.Atom != other {
+			res = append(res, nbr.Atom)
+		}
+	}
+	return res
+}
+
+// axialDescriptor answers the helicity of this stereogenic axis, from
+// the 3-D coordinates of its atoms: `P` should the higher-ranked ortho
+// atom of the near end turn clockwise onto that of the far end, by the
+// shorter way, when viewed along the axis; `M` otherwise.  The answer
+// is the same from either end.
+//
+// Should the coordinates be planar, or the ortho atoms of an end be
+// tied in rank, `CIPNone` is answered.
+func (b *_Bond) axialDescriptor() cmn.CIPDescriptor {
+	m := b.mol
+	if !m.has3DCoordinates() {
+		return cmn.CIPNone
+	}
+
+	a1, a2 := m.atomWithIid(b.a1), m.atomWithIid(b.a2)
+	o1, tied1 := m.cipRanked(a1.iId, b.axisOrthos(a1))
+	o2, tied2 := m.cipRanked(a2.iId, b.axisOrthos(a2))
+	if tied1 || tied2 {
+		return cmn.CIPNone
+	}
+
+	phi, _, _, _, _ := dihedralGradient(m.atomWithIid(o1[0]).point(), a1.point(), a2.point(), m.atomWithIid(o2[0]).point())
+	switch {
+	case phi > 0:
+		return cmn.CIPP
+	case phi < 0:
+		return cmn.CIPM
+	}
+	return cmn.CIPNone
+}
+
+// point answers the coordinates of this atom.
+func (a *_Atom) point() Point {
+	return Point{float64(a.X), float64(a.Y), float64(a.Z)}
+}
+
+// has3DCoordinates answers if the atoms of this molecule do not all lie
+// in the plane `z = 0`.
+func (m *Molecule) has3DCoordinates() bool {
+	for _, a := range m.atoms {
+		if a.Z != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// perceiveAxes marks the stereogenic axes of hindered rotation of this
+// molecule, and determines their helicities from its coordinates, if
+// they are 3-D.
+func (m *Molecule) perceiveAxes(cls map[uint16]uint64) {
+	for _, b := range m.bonds {
+		b.cip = cmn.CIPNone
+		if b.stereoType == cmn.StereoTypeNone && b.isAtropisomericAxis(cls) {
+			b.stereoType = cmn.StereoTypeAxial
+			b.cip = b.axialDescriptor()
+		}
+	}
+}
@@ -20,25 +20,31 @@ type _Bond struct {
 
 	a1      uint16         // iId of the first atom in the bond.
 	a2      uint16         // iId of the second atom in the bond.
-	bType   cmn.BondType   // Is this bond single, double or triple?
+	bType   cmn.BondType   // Is this bond single, double, triple or dative?
+	given   cmn.BondType   // Aromatic or query type, if so given; `bType` then holds its Kekulé type.
 	bStereo cmn.BondStereo // See the enum definitions for details.
+	// Is this bond stereogenic?  Set by stereo perception.
+	stereoType cmn.StereoType
+	cip        cmn.CIPDescriptor // Configuration, if stereogenic and determined.
+	sides      int8              // Of a stereogenic double bond; see `BondInfo`.
+	declared   int8              // Sides declared without coordinates, as by SMILES.
 
 	isAro  bool   // Is this bond aromatic?
 	isLink bool   // Is this bond part of a linking chain?
 	hash   uint32 // For fast comparisons.
 
-	rings []uint8 // The rings this bond participates in.
+	rings []uint16 // The rings this bond participates in.
+
+	attributes []Attribute // Optional annotations of this bond.
 }
 
 // newBond constructs and initialises a new bond between the two given
 // atoms, with the provided configuration.
 func newBond(mol *Molecule, id int) *_Bond {
-	bond := new(_Bond)
+	bond := allocBond()
 	bond.mol = mol
 	bond.id = uint16(id)
 
-	bond.rings = make([]uint8, 0, cmn.MaxRings)
-
 	return bond
 }
 
@@ -57,6 +63,56 @@ func (b *_Bond) otherAtomIid(aid uint16) uint16 {
 	return 0
 }
 
+// isCoordination answers if this bond is a dative one, or joins a
+// metal atom, as in metal complexes and organometallic compounds.  Ring
+// perception disregards such bonds, so that metal centres are in no
+// ring, and the rings of their ligands are perceived as those of free
+// ligands would be.
+func (b *_Bond) isCoordination() bool {
+	if b.bType == cmn.BondTypeDative {
+		return true
+	}
+	m := b.mol
+	return cmn.IsMetal(m.atomWithIid(b.a1).atNum) || cmn.IsMetal(m.atomWithIid(b.a2).atNum)
+}
+
+// isValidBondType answers if bonds may be built of the given type:
+// single, double, triple, dative, aromatic and single-or-double bonds.
+func isValidBondType(t cmn.BondType) bool {
+	return t.Order() > 0 || t == cmn.BondTypeDative || isGivenBondType(t)
+}
+
+// isGivenBondType answers if the given type is one that bonds keep as
+// given, alongside their Kekulé types: aromatic and query types.
+func isGivenBondType(t cmn.BondType) bool {
+	return t == cmn.BondTypeAltern || t == cmn.BondTypeSingleOrDouble
+}
+
+// setType sets the type of this bond, which should not be among the
+// bonds of its atoms.  An aromatic or a query bond keeps its Kekulé
+// type, if single or double, and is otherwise made single, until
+// sanitisation assigns its Kekulé type.
+func (b *_Bond) setType(t cmn.BondType) {
+	if !isGivenBondType(t) {
+		b.bType, b.given = t, cmn.BondTypeNone
+		return
+	}
+
+	b.given = t
+	if b.bType != cmn.BondTypeSingle && b.bType != cmn.BondTypeDouble {
+		b.bType = cmn.BondTypeSingle
+	}
+}
+
+// givenType answers the type of this bond as given: its aromatic or
+// query type, if any, and its Kekulé type otherwise.
+func (b *_Bond) givenType() cmn.BondType {
+	if b.given != cmn.BondTypeNone {
+		return b.given
+	}
+	return b.bType
+}
+
 // isCyclic answers if this bond participates in at least one ring.
 func (b *_Bond) isCyclic() bool {
 	return len(b.rings) > 0
@@ -64,7 +120,7 @@ func (b *_Bond) isCyclic() bool {
 
 // addRing adds the given ring to the list of rings in which this bond
 // participates.
-func (b *_Bond) addRing(rid uint8) {
+func (b *_Bond) addRing(rid uint16) {
 	for _, id := range b.rings {
 		if id == rid {
 			return
@@ -76,7 +132,7 @@ func (b *_Bond) addRing(rid uint8) {
 
 // removeRing removes the given ring from the list of rings in which
 // this bond participates, if it does participate in the given ring.
-func (b *_Bond) removeRing(rid uint8) {
+func (b *_Bond) removeRing(rid uint16) {
 	idx := -1
 	for i, id := range b.rings {
 		if id == rid {
@@ -91,7 +147,7 @@ func (b *_Bond) removeRing(rid uint8) {
 }
 
 // isInRing answers if this bond participates in the given ring.
-func (b *_Bond) isInRing(rid uint8) bool {
+func (b *_Bond) isInRing(rid uint16) bool {
 	for _, id := range b.rings {
 		if id == rid {
 			return true
@@ -104,36 +160,28 @@ func (b *_Bond) isInRing(rid uint8) bool {
 // isInRingOfSize answers if this bond participates in at least one
 // ring of the given size.
 func (b *_Bond) isInRingOfSize(n int) bool {
-	mol := b.mol
-	for _, rid := range b.rings {
-		r := mol.ringWithId(rid)
-		if r.size() == n {
-			return true
-		}
-	}
-
-	return false
+	return b.mol.isBondInRingOfSize(b.id, n)
 }
 
 // smallestRing answers the smallest unique ring in which this atom
 // participates.  If no such unique ring exists, an error is answered.
-func (b *_Bond) smallestRing() (uint8, error) {
+func (b *_Bond) smallestRing() (uint16, error) {
 	if !b.isCyclic() {
 		return 0, fmt.Errorf("Bond is not cyclic.")
 	}
 
 	min := int(math.MaxUint8)
 	c := 0
-	var ret uint8
+	var ret uint16
 
 	mol := b.mol
 	for _, rid := range b.rings {
-		r := mol.ringWithId(uint8(rid))
+		r := mol.ringWithId(rid)
 		size := r.size()
 		if size == min {
 			c++
 		} else if size < min {
-			ret = uint8(rid)
+			ret = rid
 			c = 1
 		}
 	}
@@ -144,3 +192,20 @@ func (b *_Bond) smallestRing() (uint8, error) {
 
 	return ret, nil
 }
+
+// info answers a snapshot of the current state of this bond.
+func (b *_Bond) info() BondInfo {
+	return BondInfo{
+		Id:         b.id,
+		A1:         b.a1,
+		A2:         b.a2,
+		Type:       b.givenType(),
+		KekuleType: b.bType,
+		Stereo:     b.bStereo,
+		IsAromatic: b.isAro,
+		IsCyclic:   b.isCyclic(),
+		StereoType: b.stereoType,
+		CIP:        b.cip,
+		Sides:      b.sides,
+	}
+}
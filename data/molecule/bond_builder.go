@@ -15,9 +15,16 @@ import (
 // is to send it to a molecule for inclusion in it.
 //
 // An instance of builder can create and build any number of bonds.
+//
+// Like `AtomBuilder`, this builder has chainable methods, beginning
+// with `Connect` and ending with `Add`, that record errors instead of
+// answering them.
+//
+//	bb.Connect(0, 1).Type(cmn.BondTypeDouble).Add()
 type BondBuilder struct {
 	mol *Molecule // Molecule whose bonds this builder constructs.
 	b   *_Bond    // Bond being built by this builder.
+	err error     // First error in building the current bond.
 }
 
 // New creates a new bond instance in this builder.
@@ -48,12 +55,12 @@ func (bb *BondBuilder) Atoms(aiid1, aiid2 int) (*BondBuilder, error) {
 
 	// We do not add bonds to hydrogen atoms.
 	if a1.atNum == 1 {
-		a2.hCount++
+		mol.addHydrogen(a2, a1)
 		bb.b = nil
 		return bb, fmt.Errorf("Bond involves a hydrogen atom.")
 	}
 	if a2.atNum == 1 {
-		a1.hCount++
+		mol.addHydrogen(a1, a2)
 		bb.b = nil
 		return bb, fmt.Errorf("Bond involves a hydrogen atom.")
 	}
@@ -63,13 +70,15 @@ func (bb *BondBuilder) Atoms(aiid1, aiid2 int) (*BondBuilder, error) {
 	return bb, nil
 }
 
-// BondType sets the bond order of this bond.
+// BondType sets the bond order of this bond.  Setting an aromatic or a
+// query type after a single or a double one sets the Kekulé type of
+// the bond as well; see `Molecule.SetBondType`.
 func (bb *BondBuilder) BondType(bType cmn.BondType) (*BondBuilder, error) {
-	if bType == cmn.BondTypeNone || bType == cmn.BondTypeAltern {
+	if !isValidBondType(bType) {
 		return nil, fmt.Errorf("Unhandled bond type : %v", bType)
 	}
 
-	bb.b.bType = bType
+	bb.b.setType(bType)
 	return bb, nil
 }
 
@@ -78,3 +87,87 @@ func (bb *BondBuilder) BondStereo(bStereo cmn.BondStereo) *BondBuilder {
 	bb.b.bStereo = bStereo
 	return bb
 }
+
+// Connect creates a new bond in this builder, between the atoms with
+// the given input IDs, assigning it the next bond ID in sequence.  It
+// is a single bond, unless its type is set otherwise.
+//
+// As with `Atoms`, a bond to a hydrogen atom is not built; the
+// hydrogen is counted in its neighbour instead.  That is not an
+// error, and `Add` does nothing in that case.
+func (bb *BondBuilder) Connect(aiid1, aiid2 int) *BondBuilder {
+	bb.err = nil
+	if _, err := bb.New(int(bb.mol.nextBondId)); err != nil {
+		bb.b = nil
+		return bb.fail(err)
+	}
+
+	bb.b.bType = cmn.BondTypeSingle
+	if res, err := bb.Atoms(aiid1, aiid2); err != nil && res == nil {
+		bb.b = nil
+		return bb.fail(err)
+	}
+	return bb
+}
+
+// Type sets the bond order of this bond.
+func (bb *BondBuilder) Type(bType cmn.BondType) *BondBuilder {
+	if bb.b == nil {
+		return bb
+	}
+	if _, err := bb.BondType(bType); err != nil {
+		return bb.fail(fmt.Errorf("Bond %d : %v", bb.b.id, err))
+	}
+	return bb
+}
+
+// Stereo sets the stereo type of this bond.
+func (bb *BondBuilder) Stereo(bStereo cmn.BondStereo) *BondBuilder {
+	if bb.b == nil {
+		return bb
+	}
+	return bb.BondStereo(bStereo)
+}
+
+// Cis declares the configuration of this double bond: whether the
+// substituents of the lowest input IDs at its ends lie on the same
+// side of it.  As with `AtomBuilder.Parity`, this serves formats that
+// give configurations without coordinates, overrides the coordinates,
+// and is dropped should a bond of either end be removed.
+func (bb *BondBuilder) Cis(cis bool) *BondBuilder {
+	if bb.b == nil {
+		return bb
+	}
+	bb.b.declared = -1
+	if cis {
+		bb.b.declared = 1
+	}
+	return bb
+}
+
+// Add adds the bond built so far to the molecule, unless an error was
+// recorded in building it.  It answers that error, or the one in
+// adding the bond, if any.  The error is also accumulated in the
+// molecule.
+func (bb *BondBuilder) Add() error {
+	err := bb.err
+	if err == nil && bb.b != nil {
+		err = bb.mol.AddBond(bb)
+	}
+	bb.err = nil
+
+	if err != nil {
+		bb.b = nil
+		bb.mol.noteBuildError(err)
+	}
+	return err
+}
+
+// fail records the given error for the current bond, unless one is
+// already recorded.
+func (bb *BondBuilder) fail(err error) *BondBuilder {
+	if bb.err == nil {
+		bb.err = err
+	}
+	return bb
+}
@@ -0,0 +1,124 @@
+package molecule
+
+import (
+	"fmt"
+	"strings"
+
+	cmn "github.com/RxnWeaver/rxnweaver/common"
+)
+
+// BuildError reports all the errors encountered in building a
+// molecule.  See `Molecule.Build`.
+type BuildError struct {
+	Errs []error
+}
+
+// Error answers the messages of all the errors, one per line.
+func (e *BuildError) Error() string {
+	msgs := make([]string, 0, len(e.Errs))
+	for _, err := range e.Errs {
+		msgs = append(msgs, err.Error())
+	}
+	return fmt.Sprintf("%d build errors :\n%s", len(e.Errs), strings.Join(msgs, "\n"))
+}
+
+// noteBuildError accumulates the given error encountered in building
+// this molecule.
+func (m *Molecule) noteBuildError(err error) {
+	m.buildMu.Lock()
+	defer m.buildMu.Unlock()
+
+	m.buildErrs = append(m.buildErrs, err)
+}
+
+// Build concludes the building of this molecule.
+//
+// It validates the molecule, and answers a `*BuildError` listing both
+// the errors accumulated by the chainable builder methods since the
+// last call to `Build`, and those found by validation.  It answers
+// `nil` if there are none.
+func (m *Molecule) Build() error {
+	m.buildMu.Lock()
+	errs := m.buildErrs
+	m.buildErrs = nil
+	m.buildMu.Unlock()
+
+	rep, err := m.Validate()
+	if err != nil {
+		errs = append(errs, err)
+	} else {
+		for _, issue := range rep.Errors() {
+			errs = append(errs, issue)
+		}
+	}
+
+	if len(errs) == 0 {
+		return nil
+	}
+	return &BuildError{errs}
+}
+
+// Validate answers a report of the problems found in the structure of
+// this molecule.  Unlike `Build`, it neither consumes nor reports the
+// errors accumulated by the chainable builder methods.
+func (m *Molecule) Validate() (*cmn.ValidationReport, error) {
+	reply := m.Call(ReqValidate, nil)
+	if err := statusError(reply, fmt.Sprintf("molecule %d", m.id)); err != nil {
+		return nil, err
+	}
+	return reply.Payload.(*cmn.ValidationReport), nil
+}
+
+// maxCoordination is the highest coordination number of metal atoms
+// accepted by validation.
+const maxCoordination = 12
+
+// handleValidate answers a report of the problems found in the
+// structure of this molecule.
+func (m *Molecule) handleValidate(p interface{}) (StatusType, interface{}) {
+	return StSuccess, m.validate()
+}
+
+// validate answers a report of the problems found in the structure of
+// this molecule.  Presently, it checks that no atom exceeds the
+// highest valence of its element, adjusted for its charge.  Metal
+// atoms, whose bonds in complexes need not reflect their oxidation
+// states, are checked against the highest coordination number
+// instead, counting dative bonds too.  Pseudo-elements, such as `*`
+// and `R`, stand for atoms and groups of any valence, and are not
+// checked.
+func (m *Molecule) validate() *cmn.ValidationReport {
+	rep := new(cmn.ValidationReport)
+	for _, a := range m.atoms {
+		if a.atNum == 0 {
+			continue
+		}
+		if cmn.IsMetal(a.atNum) {
+			if n := len(a.adj) + int(a.hCount); n > maxCoordination {
+				rep.Addf(cmn.SeverityError, cmn.CodeValenceExceeded, []uint16{a.iId},
+					"Atom %d (%s) exceeds the highest coordination number : %d > %d", a.iId, a.symbol, n, maxCoordination)
+			}
+			continue
+		}
+
+		el := cmn.PeriodicTable[cmn.ElementSymbols[a.atNum]]
+		max := int(el.Valence)
+		for _, ox := range el.OxStates {
+			if int(ox) > max {
+				max = int(ox)
+			}
+		}
+		if a.charge < 0 {
+			max -= int(a.charge)
+		} else {
+			max += int(a.charge)
+		}
+
+		if used := len(a.nbrs) + int(a.hCount); used > max {
+			rep.Addf(cmn.SeverityError, cmn.CodeValenceExceeded, []uint16{a.iId},
+				"Atom %d (%s) exceeds its valence : %d > %d", a.iId, a.symbol, used, max)
+		}
+	}
+
+	return rep
+}
@@ -0,0 +1,171 @@
+package molecule
+
+import (
+	"fmt"
+	"math"
+
+	cmn "github.com/RxnWeaver/rxnweaver/common"
+)
+
+// CheckRule identifies a rule of the structure checker.  Rules can be
+// combined with `|`.
+type CheckRule uint32
+
+// Constants representing the rules of the structure checker.
+const (
+	// Atoms placed (nearly) on top of each other.
+	CheckOverlappingAtoms CheckRule = 1 << iota
+	// Atoms bearing charges of unusually high magnitude.
+	CheckAbnormalCharges
+	// Atoms whose bonds and hydrogens match none of the valences of
+	// their elements, adjusted for charge.
+	CheckUnusualValences
+	// Metal atoms bonded to nothing, in molecules of several atoms.
+	CheckIsolatedMetals
+	// Star and R atoms, as mark the ends of polymer repeating units.
+	CheckPolymerMarkers
+
+	CheckAllRules = CheckOverlappingAtoms | CheckAbnormalCharges | CheckUnusualValences |
+		CheckIsolatedMetals | CheckPolymerMarkers
+)
+
+// Default thresholds of the structure checker.
+const (
+	DefaultOverlapDistance = 0.1 // In the units of the coordinates.
+	DefaultMaxCharge       = 2
+)
+
+// Checker flags suspicious structures, as the checkers of compound
+// registration systems do.  Each rule can be enabled individually.
+// All issues are reported as warnings; none of them makes a structure
+// invalid per se.
+//
+// A checker is NOT modified by checking, and can be shared by
+// concurrent checks once configured.
+type Checker struct {
+	Rules           CheckRule
+	OverlapDistance float64 // Atoms closer than this overlap.
+	MaxCharge       int8    // Largest acceptable magnitude of an atom's charge.
+}
+
+// NewChecker answers a checker with all rules enabled, and default
+// thresholds.
+func NewChecker() *Checker {
+	return &Checker{CheckAllRules, DefaultOverlapDistance, DefaultMaxCharge}
+}
+
+// Enable enables the given rules, answering this checker.
+func (c *Checker) Enable(rules CheckRule) *Checker {
+	c.Rules |= rules
+	return c
+}
+
+// Disable disables the given rules, answering this checker.
+func (c *Checker) Disable(rules CheckRule) *Checker {
+	c.Rules &^= rules
+	return c
+}
+
+// Check answers a report of the suspicious features of the given
+// molecule, per the enabled rules.
+func (c *Checker) Check(m *Molecule) (*cmn.ValidationReport, error) {
+	reply := m.Call(ReqCheck, c)
+	if err := statusError(reply, fmt.Sprintf("molecule %d", m.id)); err != nil {
+		return nil, err
+	}
+	return reply.Payload.(*cmn.ValidationReport), nil
+}
+
+// handleCheck answers a report of the suspicious features of this
+// molecule, per the rules of the given checker.
+func (m *Molecule) handleCheck(p interface{}) (StatusType, interface{}) {
+	c, ok := p.(*Checker)
+	if !ok || c == nil {
+		return StIncorrectParameter, nil
+	}
+
+	rep := new(cmn.ValidationReport)
+	if c.Rules&CheckOverlappingAtoms != 0 {
+		m.checkOverlaps(c.OverlapDistance, rep)
+	}
+	for _, a := range m.atoms {
+		if c.Rules&CheckAbnormalCharges != 0 && (a.charge > c.MaxCharge || -a.charge > c.MaxCharge) {
+			rep.Addf(cmn.SeverityWarning, cmn.CodeAbnormalCharge, []uint16{a.iId},
+				"Atom %d (%s) has an abnormal charge : %d", a.iId, a.symbol, a.charge)
+		}
+		if c.Rules&CheckUnusualValences != 0 && !a.hasUsualValence() {
+			rep.Addf(cmn.SeverityWarning, cmn.CodeUnusualValence, []uint16{a.iId},
+				"Atom %d (%s) has an unusual valence : %d", a.iId, a.symbol, len(a.nbrs)+int(a.hCount))
+		}
+		if c.Rules&CheckIsolatedMetals != 0 && cmn.IsMetal(a.atNum) && len(a.adj) == 0 && len(m.atoms) > 1 {
+			rep.Addf(cmn.SeverityWarning, cmn.CodeIsolatedMetal, []uint16{a.iId},
+				"Atom %d (%s) is an isolated metal.", a.iId, a.symbol)
+		}
+		if c.Rules&CheckPolymerMarkers != 0 && (a.symbol == "Q_STAR" || a.symbol == "R") {
+			rep.Addf(cmn.SeverityWarning, cmn.CodePolymerMarker, []uint16{a.iId},
+				"Atom %d (%s) is a polymer marker.", a.iId, a.symbol)
+		}
+	}
+
+	return StSuccess, rep
+}
+
+// checkOverlaps reports the pairs of atoms of this molecule closer than
+// the given distance.  Molecules without coordinates, i.e., having all
+// their atoms at the origin, are skipped.
+func (m *Molecule) checkOverlaps(dist float64, rep *cmn.ValidationReport) {
+	placed := false
+	for _, a := range m.atoms {
+		if a.X != 0 || a.Y != 0 || a.Z != 0 {
+			placed = true
+			break
+		}
+	}
+	if !placed {
+		return
+	}
+
+	for i, a := range m.atoms {
+		for _, b := range m.atoms[i+1:] {
+			dx, dy, dz := float64(a.X-b.X), float64(a.Y-b.Y), float64(a.Z-b.Z)
+			if d := math.Sqrt(dx*dx + dy*dy + dz*dz); d < dist {
+				rep.Addf(cmn.SeverityWarning, cmn.CodeOverlappingAtoms, []uint16{a.iId, b.iId},
+					"Atoms %d and %d overlap : %.3f apart", a.iId, b.iId, d)
+			}
+		}
+	}
+}
+
+// hasUsualValence answers if the bonds and hydrogens of this atom match
+// one of the valences of its element, adjusted for its charge.  Atoms
+// of metals and pseudo-elements, and radicals, are not judged.  An atom
+// bonded to metal atoms may match either with its bonds to them, as in
+// an organometallic compound, or without them, as a ligand drawn with
+// plain bonds to its centre; dative bonds count in neither.
+func (a *_Atom) hasUsualValence() bool {
+	if a.atNum == 0 || cmn.IsMetal(a.atNum) || a.radical != cmn.RadicalNone {
+		return true
+	}
+
+	el := cmn.PeriodicTable[cmn.ElementSymbols[a.atNum]]
+	used := len(a.nbrs) + int(a.hCount)
+	ligand := used
+	for _, nbr := range a.adj {
+		if cmn.IsMetal(a.mol.atomWithIid(nbr.Atom).atNum) {
+			ligand -= a.mol.bondWithId(nbr.Bond).bType.Order()
+		}
+	}
+	ch := int(a.charge)
+	ok := func(v int) bool {
+		return used == v+ch || used == v-ch || ligand == v+ch || ligand == v-ch
+	}
+	if ok(int(el.Valence)) {
+		return true
+	}
+	for _, ox := range el.OxStates {
+		if v := int(ox); ok(v) || ok(-v) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,457 @@
+package molecule
+
+import (
+	"math"
+	"sort"
+
+	cmn "github.com/RxnWeaver/rxnweaver/common"
+)
+
+// IsChiral answers if this molecule is not superimposable on its
+// mirror image, as judged by the configurations of its stereogenic
+// units, as determined by sanitisation.  Molecules whose stereocentres
+// have no determined configurations are not chiral by this measure.
+// See `IsMeso`.
+func (m *Molecule) IsChiral() (bool, error) {
+	v, err := m.Descriptor("chiral")
+	return v != 0, err
+}
+
+// IsMeso answers if this molecule is a meso compound: one with two or
+// more stereocentres of determined configurations, that is nonetheless
+// superimposable on its mirror image, as (2R,3S)-tartaric acid is.
+// Such molecules are achiral, and (2R,3S) and (2S,3R) name the same
+// one of them.
+func (m *Molecule) IsMeso() (bool, error) {
+	v, err := m.Descriptor("meso")
+	return v != 0, err
+}
+
+// drawnVolume answers the signed volume spanned by the given three
+// neighbours of this atom, relative to it, as drawn: in space, should
+// the molecule have 3-D coordinates; in the plane otherwise, with the
+// neighbours at the far ends of wedge bonds from this atom lifted
+// above it, or dropped below it, by a unit.  A wedge to the fourth
+// neighbour, if any, displaces this atom instead.  It answers `false`
+// should the volume vanish, as it does when no wedge is drawn.
+//
+// A declared parity overrides the coordinates; a unit volume of the
+// sign it implies is answered then.
+func (a *_Atom) drawnVolume(n1, n2, n3 uint16, threeD bool) (float64, bool) {
+	if a.declared == cmn.StereoParityOdd || a.declared == cmn.StereoParityEven {
+		return a.declaredVolume(n1, n2, n3)
+	}
+
+	m := a.mol
+	centre := a.point()
+	pts := make(map[uint16]Point, len(a.adj))
+	for _, nbr := range a.adj {
+		p := m.atomWithIid(nbr.Atom).point()
+		if !threeD {
+			p[2] = 0
+			if b := m.bondWithId(nbr.Bond); b.a1 == a.iId {
+				switch b.bStereo {
+				case cmn.BondStereoUp:
+					p[2] = 1
+				case cmn.BondStereoDown:
+					p[2] = -1
+				}
+			}
+		}
+		pts[nbr.Atom] = p
+	}
+	if !threeD {
+		centre[2] = 0
+		for _, nbr := range a.adj {
+			if nbr.Atom != n1 && nbr.Atom != n2 && nbr.Atom != n3 {
+				centre[2] = pts[nbr.Atom][2] / 2 // The fourth neighbour displaces the centre.
+			}
+		}
+	}
+
+	v := tripleProduct(sub(pts[n1], centre), sub(pts[n2], centre), sub(pts[n3], centre))
+	if math.Abs(v) < 1e-6 {
+		return 0, false
+	}
+	return v, true
+}
+
+// declaredVolume answers the sign of the volume spanned by the given
+// three neighbours of this atom, as implied by its declared parity.
+// The parity gives the sign of the volume of the first three of its
+// neighbours in the ascending order of their input IDs, an implicit
+// hydrogen, if any, being last: negative if odd.  Every exchange of
+// two neighbours, the fourth neighbour included, inverts it.  It
+// answers `false` should the atom not have four neighbours, counting
+// an implicit hydrogen.
+func (a *_Atom) declaredVolume(n1, n2, n3 uint16) (float64, bool) {
+	const hydrogen = implicitHydrogen
+	asc := a.neighbourIids()
+	sort.Slice(asc, func(i, j int) bool { return asc[i] < asc[j] })
+	switch {
+	case len(asc) == 3 && a.hCount == 1:
+		asc = append(asc, hydrogen)
+	case len(asc) != 4:
+		return 0, false
+	}
+
+	// The given neighbours, followed by the remaining one.
+	tuple := []uint16{n1, n2, n3, hydrogen}
+	for _, n := range asc {
+		if n != n1 && n != n2 && n != n3 {
+			tuple[3] = n
+		}
+	}
+
+	v := 1.0
+	if a.declared == cmn.StereoParityOdd {
+		v = -1
+	}
+	if permutationIsOdd(tuple, asc) {
+		v = -v
+	}
+	return v, true
+}
+
+// implicitHydrogen stands for an implicit hydrogen among the input IDs
+// of the neighbours of an atom, ordered last.  No atom has its ID.
+const implicitHydrogen = math.MaxUint16
+
+// permutationIsOdd answers if the given sequence is an odd permutation
+// of the given reference, whose elements are distinct.
+func permutationIsOdd(seq, ref []uint16) bool {
+	pos := make(map[uint16]int, len(ref))
+	for i, n := range ref {
+		pos[n] = i
+	}
+	odd := false
+	for i := range seq {
+		for j := i + 1; j < len(seq); j++ {
+			if pos[seq[i]] > pos[seq[j]] {
+				odd = !odd
+			}
+		}
+	}
+	return odd
+}
+
+// tetrahedralDescriptor answers the configuration of this atom, given
+// its neighbours in the descending order of their priorities: `R`
+// should the first three turn clockwise when viewed with the lowest
+// ranked substituent, or the hydrogen, away from the viewer, and `S`
+// otherwise.  `CIPNone` is answered should the configuration not be
+// drawn.
+func (a *_Atom) tetrahedralDescriptor(ranked []uint16, threeD bool) cmn.CIPDescriptor {
+	v, ok := a.drawnVolume(ranked[0], ranked[1], ranked[2], threeD)
+	switch {
+	case !ok:
+		return cmn.CIPNone
+	case v < 0:
+		return cmn.CIPR
+	}
+	return cmn.CIPS
+}
+
+// hasEitherWedge answers if a bond of unknown sense, a wavy one, is
+// drawn from this atom, marking its configuration as unknown.
+func (a *_Atom) hasEitherWedge() bool {
+	m := a.mol
+	for _, nbr := range a.adj {
+		if b := m.bondWithId(nbr.Bond); b.a1 == a.iId && b.bStereo == cmn.BondStereoEither {
+			return true
+		}
+	}
+	return false
+}
+
+// neighbourIids answers the input IDs of the neighbours of this atom.
+func (a *_Atom) neighbourIids() []uint16 {
+	res := make([]uint16, 0, len(a.adj))
+	for _, nbr := range a.adj {
+		res = append(res, nbr.Atom)
+	}
+	return res
+}
+
+// twinSubstituents answers the two neighbours of this atom that are
+// constitutionally equivalent, given the canonical classes of the
+// atoms, should there be exactly one such pair, its other neighbours
+// being distinct.
+func (a *_Atom) twinSubstituents(cls map[uint16]uint64) (uint16, uint16, bool) {
+	var p, q uint16
+	pairs := 0
+	for i, n1 := range a.adj {
+		for _, n2 := range a.adj[i+1:] {
+			if cls[n1.Atom] == cls[n2.Atom] {
+				p, q = n1.Atom, n2.Atom
+				pairs++
+			}
+		}
+	}
+	return p, q, pairs == 1
+}
+
+// perceiveConfigurations determines the configurations of the
+// tetrahedral stereocentres of this molecule, given the canonical
+// classes of its atoms, and then marks and determines its
+// pseudo-asymmetric centres.  Configurations are determined from 3-D
+// coordinates, should the molecule have them, by the signed volumes of
+// the neighbours of the centres, and from the wedges of 2-D ones
+// otherwise; those of centres with wavy bonds are not determined.  The
+// MDL parities of all the centres are then determined likewise.
+//
+// The neighbours of a centre may be told apart only by the
+// configurations of other units, by Rules 3 to 5; see `cipCompare`.
+// Configurations are therefore determined in rounds, each using those
+// determined before, until no more are.  Those of stereogenic double
+// bonds left undetermined by their constitutions are determined so,
+// too.
+//
+// An acyclic atom bearing two constitutionally equivalent substituents
+// is a stereocentre nonetheless, should they differ in configuration.
+// It is a pseudo-asymmetric centre should they be enantiomorphic, as
+// those of C3 of 2,3,4-trihydroxyglutaric acid are.  Of the two, that
+// whose stereocentres are first found to be `R`, sphere by sphere,
+// ranks higher (Rule 5).  Since reflection exchanges the two, the
+// configuration of the centre is unchanged by it, and is named `r` or
+// `s`.  Two equivalent substituents of like configurations do not make
+// an atom stereogenic.
+func (m *Molecule) perceiveConfigurations(cls map[uint16]uint64) {
+	threeD := m.has3DCoordinates()
+	for {
+		m.determineConfigurations(cls, threeD)
+		if !m.perceiveTwinCentres(cls, threeD) {
+			break
+		}
+	}
+
+	for _, a := range m.atoms {
+		a.parity = a.mdlParity(threeD)
+	}
+}
+
+// determineConfigurations determines the configurations of the
+// stereocentres and stereogenic double bonds of this molecule not yet
+// determined, in rounds, until no more are, given the canonical
+// classes of its atoms.  Centres with twin substituents are left to
+// `perceiveTwinCentres`.
+func (m *Molecule) determineConfigurations(cls map[uint16]uint64, threeD bool) {
+	for changed := true; changed; {
+		changed = false
+		for _, a := range m.atoms {
+			switch {
+			case a.stereoType != cmn.StereoTypeTetrahedral || a.cip != cmn.CIPNone:
+				continue
+			case a.hasEitherWedge() || !a.isTetrahedralCentre(cls):
+				continue
+			}
+			if ranked, tied := m.cipRanked(a.iId, a.neighbourIids()); !tied {
+				a.cip = a.tetrahedralDescriptor(ranked, threeD)
+				changed = changed || a.cip != cmn.CIPNone
+			}
+		}
+		for _, b := range m.bonds {
+			if b.stereoType != cmn.StereoTypeDoubleBond || b.cip != cmn.CIPNone || b.isDrawnEither() {
+				continue
+			}
+			b.cip = b.doubleBondDescriptor()
+			changed = changed || b.cip != cmn.CIPNone
+		}
+	}
+}
+
+// perceiveTwinCentres marks the acyclic atoms of this molecule bearing
+// two constitutionally equivalent substituents of different
+// configurations as stereocentres, given the canonical classes of its
+// atoms, and determines their configurations: `r` or `s` should the
+// substituents be enantiomorphic, and `R` or `S` otherwise.  It
+// answers if any centre was marked, or had its configuration
+// determined.
+func (m *Molecule) perceiveTwinCentres(cls map[uint16]uint64, threeD bool) bool {
+	found := false
+	for _, a := range m.atoms {
+		switch {
+		case a.isCyclic() || !a.isTetrahedralCandidate():
+			continue
+		case a.stereoType == cmn.StereoTypeNone:
+		case a.stereoType == cmn.StereoTypeTetrahedral && a.cip == cmn.CIPNone && !a.isTetrahedralCentre(cls):
+		default:
+			continue
+		}
+		p, q, ok := a.twinSubstituents(cls)
+		if !ok || m.cipCompare(a.iId, p, q) == 0 {
+			continue
+		}
+		if a.stereoType == cmn.StereoTypeNone {
+			a.stereoType = cmn.StereoTypeTetrahedral
+			found = true
+		}
+
+		ranked, tied := m.cipRanked(a.iId, a.neighbourIids())
+		if tied || a.hasEitherWedge() {
+			continue
+		}
+		a.cip = a.tetrahedralDescriptor(ranked, threeD)
+		if m.compareEnantiomorphic(a.iId, p, q, cls) != 0 {
+			switch a.cip {
+			case cmn.CIPR:
+				a.cip = cmn.CIPr
+			case cmn.CIPS:
+				a.cip = cmn.CIPs
+			}
+		}
+		found = found || a.cip != cmn.CIPNone
+	}
+	return found
+}
+
+// mdlParity answers the parity of this atom, as an MDL molfile numbers
+// it, should it be a tetrahedral stereocentre, or a ring stereo atom.  Its neighbours are
+// numbered by their input IDs, and an implicit hydrogen numbered
+// highest.  Viewed with the highest numbered neighbour away from the
+// viewer, the parity is odd should the others turn clockwise in
+// ascending order, and even otherwise.  It is unknown should the
+// configuration not be drawn, or be drawn as unknown.
+//
+// Unlike the CIP descriptor, the parity does not depend on the
+// priorities of the neighbours, and so is determined from 3-D
+// coordinates even when they are tied.
+func (a *_Atom) mdlParity(threeD bool) cmn.StereoParity {
+	if a.stereoType != cmn.StereoTypeTetrahedral && a.stereoType != cmn.StereoTypeRing {
+		return cmn.StereoParityNone
+	}
+	nbrs := a.neighbourIids()
+	sort.Slice(nbrs, func(i, j int) bool { return nbrs[i] < nbrs[j] })
+	if len(nbrs) < 3 || a.hasEitherWedge() {
+		return cmn.StereoParityUnknown
+	}
+	v, ok := a.drawnVolume(nbrs[0], nbrs[1], nbrs[2], threeD)
+	switch {
+	case !ok:
+		return cmn.StereoParityUnknown
+	case v < 0:
+		return cmn.StereoParityOdd
+	}
+	return cmn.StereoParityEven
+}
+
+// compareEnantiomorphic compares the constitutionally equivalent
+// branches of this molecule rooted at the given atom, through its
+// given neighbours.  It answers `0` unless they are enantiomorphic; a
+// positive number if the first ranks higher by Rule 5, and a negative
+// one if the second does.
+//
+// The stereocentres of each branch are grouped by their distances
+// from the root, and their canonical classes.  The branches are
+// enantiomorphic if each group of either has as many `R` centres as
+// the corresponding group of the other has `S` ones, and the branches
+// differ.  The first group, nearest first, with more `R` centres ranks
+// its branch higher.
+func (m *Molecule) compareEnantiomorphic(root, p, q uint16, cls map[uint16]uint64) int {
+	type group struct {
+		dist int
+		cls  uint64
+	}
+	type counts struct{ r, s int }
+	tally := func(first uint16) map[group]*counts {
+		res := make(map[group]*counts)
+		seen := map[uint16]bool{root: true, first: true}
+		level := []uint16{first}
+		for dist := 1; len(level) > 0; dist++ {
+			next := []uint16(nil)
+			for _, iid := range level {
+				a := m.atomWithIid(iid)
+				if a.cip == cmn.CIPR || a.cip == cmn.CIPS {
+					g := group{dist, cls[iid]}
+					if res[g] == nil {
+						res[g] = new(counts)
+					}
+					if a.cip == cmn.CIPR {
+						res[g].r++
+					} else {
+						res[g].s++
+					}
+				}
+				for _, nbr := range a.adj {
+					if !seen[nbr.Atom] {
+						seen[nbr.Atom] = true
+						next = append(next, nbr.Atom)
+					}
+				}
+			}
+			level = next
+		}
+		return res
+	}
+
+	tp, tq := tally(p), tally(q)
+	if len(tp) != len(tq) {
+		return 0
+	}
+	groups := make([]group, 0, len(tp))
+	for g, cp := range tp {
+		cq := tq[g]
+		if cq == nil || cp.r != cq.s || cp.s != cq.r {
+			return 0
+		}
+		groups = append(groups, g)
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		if groups[i].dist != groups[j].dist {
+			return groups[i].dist < groups[j].dist
+		}
+		return groups[i].cls < groups[j].cls
+	})
+	for _, g := range groups {
+		if d := tp[g].r - tq[g].r; d != 0 {
+			return d
+		}
+	}
+	return 0
+}
+
+// mirrorSymmetry answers the number of stereogenic units of this
+// molecule whose determined configurations reflection inverts, and
+// whether its mirror image is the same molecule, given the canonical
+// classes of its atoms.
+//
+// The mirror image is deemed the same should the configurations of
+// each class of constitutionally equivalent units invert into one
+// another, as they do when a symmetry of the molecule exchanges its
+// enantiomorphic halves.  Classes of atoms stand in for the orbits of
+// its automorphisms; pseudo-asymmetric centres, which reflection
+// leaves unchanged, never break the symmetry.
+func (m *Molecule) mirrorSymmetry(cls map[uint16]uint64) (int, bool) {
+	type key struct {
+		cls uint64
+		cip cmn.CIPDescriptor
+	}
+	counts := make(map[key]int)
+	units := 0
+	add := func(c uint64, d cmn.CIPDescriptor) {
+		if d == cmn.CIPNone {
+			return
+		}
+		counts[key{c, d}]++
+		if d.Inverse() != d {
+			units++
+		}
+	}
+	for _, a := range m.atoms {
+		add(cls[a.iId], a.cip)
+	}
+	for _, b := range m.bonds {
+		c1, c2 := cls[b.a1], cls[b.a2]
+		if c1 > c2 {
+			c1, c2 = c2, c1
+		}
+		add(hashInts(c1, c2), b.cip)
+	}
+
+	for k, n := range counts {
+		if counts[key{k.cls, k.cip.Inverse()}] != n {
+			return units, false
+		}
+	}
+	return units, true
+}
@@ -0,0 +1,406 @@
+package molecule
+
+import (
+	"sort"
+
+	cmn "github.com/RxnWeaver/rxnweaver/common"
+)
+
+// Bounds on the exploration of the hierarchical digraph of a branch,
+// so that ranking large, highly cyclic molecules stays cheap.  Branches
+// still tied at these bounds are deemed equivalent.
+const (
+	cipMaxSpheres = 32
+	cipMaxNodes   = 4096
+)
+
+// _CIPNode is a node of the hierarchical digraph of a molecule, as seen
+// from a stereogenic unit.  Atoms closing rings, and the partners of
+// multiple bonds, appear as duplicates, which have no substituents.
+type _CIPNode struct {
+	iid   uint16   // Atom this node stands for, unless a hydrogen.
+	key   uint32   // Atomic number, root distance and mass number, as ranked.
+	dup   bool     // Is this a duplicate?
+	order uint8    // Of the bond from the parent of this node.
+	path  []uint16 // Atoms from the root to this node, inclusive.
+}
+
+// cipKey answers the ranking key of an atom of the given atomic number
+// and mass number, at the given distance from the root, or duplicating
+// an atom at that distance.  Higher keys rank higher: first by atomic
+// number (Rule 1a), then by root distance, nearer first (Rule 1b), and
+// then by mass number (Rule 2).
+func cipKey(atNum uint8, dist int, mass uint16) uint32 {
+	if dist > 0xff {
+		dist = 0xff
+	}
+	return uint32(atNum)<<24 | uint32(0xff-dist)<<16 | uint32(mass)
+}
+
+// cipSpheres answers the nodes of the hierarchical digraph of the
+// branch of this molecule rooted at the given atom, through its given
+// neighbour, sphere by sphere.  The nodes of each sphere are in the
+// descending order of their keys.
+func (m *Molecule) cipSpheres(root, first uint16) [][]*_CIPNode {
+	rb := m.atomWithIid(root).bondTo(first)
+	fa := m.atomWithIid(first)
+	start := &_CIPNode{iid: first, key: cipKey(fa.atNum, 1, fa.isotope), order: uint8(rb.bType.Order()), path: []uint16{root, first}}
+
+	spheres := [][]*_CIPNode{{start}}
+	level := []*_CIPNode{start}
+	count := 1
+	for len(level) > 0 && len(spheres) < cipMaxSpheres && count < cipMaxNodes {
+		next := []*_CIPNode(nil)
+		for _, n := range level {
+			next = append(next, m.cipSubstituents(n)...)
+		}
+		if len(next) == 0 {
+			break
+		}
+		sort.SliceStable(next, func(i, j int) bool { return next[i].key > next[j].key })
+		spheres = append(spheres, next)
+		count += len(next)
+		level = next
+	}
+	return spheres
+}
+
+// cipSubstituents answers the nodes of the substituents of the given
+// node: its neighbours other than its parent, its hydrogens, and
+// duplicates for its multiple bonds, including that to its parent.
+// Duplicates are keyed by the distances of the atoms they duplicate
+// from the root.
+func (m *Molecule) cipSubstituents(n *_CIPNode) []*_CIPNode {
+	if n.dup {
+		return nil
+	}
+	a := m.atomWithIid(n.iid)
+	depth := len(n.path) // Of the substituents.
+	parent := n.path[depth-2]
+
+	res := make([]*_CIPNode, 0, len(a.adj)+int(a.hCount)+2)
+	pa := m.atomWithIid(parent)
+	for i := 1; i < int(n.order); i++ {
+		res = append(res, &_CIPNode{iid: parent, key: cipKey(pa.atNum, depth-2, pa.isotope), dup: true})
+	}
+	for i := 0; i < int(a.hCount); i++ {
+		res = append(res, &_CIPNode{key: cipKey(1, depth, 0), dup: true})
+	}
+
+	for _, nbr := range a.adj {
+		if nbr.Atom == parent {
+			continue
+		}
+		na := m.atomWithIid(nbr.Atom)
+		b := m.bondWithId(nbr.Bond)
+
+		onPath := -1
+		for i, p := range n.path {
+			if p == nbr.Atom {
+				onPath = i
+				break
+			}
+		}
+		if onPath >= 0 {
+			// Closure of a ring: a duplicate of the atom, as reached.
+			res = append(res, &_CIPNode{iid: nbr.Atom, key: cipKey(na.atNum, onPath, na.isotope), dup: true})
+			continue
+		}
+
+		path := make([]uint16, depth+1)
+		copy(path, n.path)
+		path[depth] = nbr.Atom
+		key := cipKey(na.atNum, depth, na.isotope)
+		res = append(res, &_CIPNode{iid: nbr.Atom, key: key, order: uint8(b.bType.Order()), path: path})
+		for i := 1; i < b.bType.Order(); i++ {
+			res = append(res, &_CIPNode{iid: nbr.Atom, key: key, dup: true})
+		}
+	}
+	return res
+}
+
+// cipDescriptors answers the descriptors of the atom the given node
+// stands for, unless it is a duplicate: that of the atom, as a
+// stereocentre, and that of a stereogenic double bond of the atom, if
+// any.  Those of stereocentres within the digraph serve as their
+// auxiliary descriptors.  It answers `false` should the atom be a
+// stereocentre, or an end of a stereogenic double bond, whose
+// configuration is not determined.
+func (m *Molecule) cipDescriptors(n *_CIPNode) (cmn.CIPDescriptor, cmn.CIPDescriptor, bool) {
+	if n.dup {
+		return cmn.CIPNone, cmn.CIPNone, true
+	}
+	a := m.atomWithIid(n.iid)
+	if a.stereoType == cmn.StereoTypeTetrahedral && a.cip == cmn.CIPNone {
+		return cmn.CIPNone, cmn.CIPNone, false
+	}
+	dbl := cmn.CIPNone
+	for _, nbr := range a.adj {
+		if b := m.bondWithId(nbr.Bond); b.stereoType == cmn.StereoTypeDoubleBond {
+			if b.cip == cmn.CIPNone {
+				return a.cip, cmn.CIPNone, false
+			}
+			dbl = b.cip
+			break
+		}
+	}
+	return a.cip, dbl, true
+}
+
+// chiralSign answers `1` for the descriptors `R` and `M`, `-1` for `S`
+// and `P`, and `0` for the others.  Descriptors of like signs form like
+// pairs (Rule 4b).
+func chiralSign(d cmn.CIPDescriptor) int {
+	switch d {
+	case cmn.CIPR, cmn.CIPM:
+		return 1
+	case cmn.CIPS, cmn.CIPP:
+		return -1
+	}
+	return 0
+}
+
+// _CIPStereo holds the descriptors of the atom a node of a
+// hierarchical digraph stands for.  See `cipDescriptors`.
+type _CIPStereo struct {
+	atom cmn.CIPDescriptor
+	dbl  cmn.CIPDescriptor
+}
+
+// cipStereoRules are the stereo sequence rules, in order.  Each
+// answers the ranks of the given spheres of descriptors, each sphere in
+// descending order; higher ranks first.
+var cipStereoRules = []func([][]_CIPStereo) [][]uint32{
+	rankingBy(cipRule3),
+	rankingBy(cipRule4a),
+	likeRanks,
+	rankingBy(cipRule4c),
+	rankingBy(cipRule5),
+}
+
+// cipRule3 ranks the atoms of `Z` double bonds above those of `E` ones.
+func cipRule3(d _CIPStereo) uint32 {
+	switch d.dbl {
+	case cmn.CIPZ:
+		return 2
+	case cmn.CIPE:
+		return 1
+	}
+	return 0
+}
+
+// cipRule4a ranks chiral units above pseudo-asymmetric ones.
+func cipRule4a(d _CIPStereo) uint32 {
+	switch {
+	case chiralSign(d.atom) != 0:
+		return 2
+	case d.atom == cmn.CIPr || d.atom == cmn.CIPs:
+		return 1
+	}
+	return 0
+}
+
+// cipRule4c ranks `r` above `s`.
+func cipRule4c(d _CIPStereo) uint32 {
+	switch d.atom {
+	case cmn.CIPr:
+		return 2
+	case cmn.CIPs:
+		return 1
+	}
+	return 0
+}
+
+// cipRule5 ranks `R` and `M` above `S` and `P`.
+func cipRule5(d _CIPStereo) uint32 {
+	switch chiralSign(d.atom) {
+	case 1:
+		return 2
+	case -1:
+		return 1
+	}
+	return 0
+}
+
+// cipCompare compares the branches of this molecule rooted at the
+// given atom, through its given neighbours, by the sequence rules.  It
+// answers a positive number if the first ranks higher, a negative one
+// if the second does, and `0` if they could not be told apart.
+//
+// The comparison is that of the spheres of the hierarchical digraphs
+// of the branches, in order, rule by rule, over the whole digraph:
+//
+//   - Rule 1a: higher atomic numbers first;
+//   - Rule 1b: duplicates of atoms nearer the root first;
+//   - Rule 2: higher mass numbers first;
+//   - Rule 3: atoms of `Z` double bonds, then those of `E` ones;
+//   - Rule 4a: chiral stereocentres and axes, then pseudo-asymmetric
+//     centres;
+//   - Rule 4b: like descriptors, then unlike ones, relative to the
+//     first chiral descriptor of the branch;
+//   - Rule 4c: `r`, then `s`;
+//   - Rule 5: `R` and `M`, then `S` and `P`.
+//
+// Each sphere is compared as a whole, rather than set by set in the
+// order of the branches within it, so that the answer never depends on
+// the order of the atoms.  Aromatic rings are taken in their Kekulé
+// forms.  The descriptors of the stereogenic units within the branches
+// are those perceived so far, which stand in for their auxiliary
+// descriptors; see `perceiveConfigurations`.
+func (m *Molecule) cipCompare(root, a, b uint16) int {
+	sa, sb := m.cipSpheres(root, a), m.cipSpheres(root, b)
+	for _, shift := range []uint{24, 16, 0} {
+		proj := func(n *_CIPNode) uint32 { return n.key >> shift }
+		if c := compareSpheres(projectSpheres(sa, proj), projectSpheres(sb, proj)); c != 0 {
+			return c
+		}
+	}
+
+	da, anyA, okA := m.describeSpheres(sa)
+	db, anyB, okB := m.describeSpheres(sb)
+	if (!anyA && !anyB) || !okA || !okB {
+		return 0
+	}
+	for _, rule := range cipStereoRules {
+		if c := compareSpheres(rule(da), rule(db)); c != 0 {
+			return c
+		}
+	}
+	return 0
+}
+
+// projectSpheres answers the given spheres of nodes, as projected by
+// the given function, each sphere in descending order.
+func projectSpheres(spheres [][]*_CIPNode, proj func(*_CIPNode) uint32) [][]uint32 {
+	res := make([][]uint32, len(spheres))
+	for i, sp := range spheres {
+		res[i] = make([]uint32, len(sp))
+		for j, n := range sp {
+			res[i][j] = proj(n)
+		}
+		sort.Slice(res[i], func(x, y int) bool { return res[i][x] > res[i][y] })
+	}
+	return res
+}
+
+// describeSpheres answers the descriptors of the given spheres of
+// nodes, whether any is determined, and whether all are.  Branches
+// holding units of undetermined configurations are not ranked by the
+// stereo rules, since those units could rank them either way.
+func (m *Molecule) describeSpheres(spheres [][]*_CIPNode) ([][]_CIPStereo, bool, bool) {
+	res := make([][]_CIPStereo, len(spheres))
+	found, all := false, true
+	for i, sp := range spheres {
+		res[i] = make([]_CIPStereo, len(sp))
+		for j, n := range sp {
+			at, dbl, ok := m.cipDescriptors(n)
+			res[i][j] = _CIPStereo{at, dbl}
+			found = found || at != cmn.CIPNone || dbl != cmn.CIPNone
+			all = all && ok
+		}
+	}
+	return res, found, all
+}
+
+// rankingBy answers a function ranking spheres of descriptors by the
+// given rule.  See `rankStereo`.
+func rankingBy(rule func(_CIPStereo) uint32) func([][]_CIPStereo) [][]uint32 {
+	return func(spheres [][]_CIPStereo) [][]uint32 {
+		return rankStereo(spheres, rule)
+	}
+}
+
+// rankStereo answers the ranks of the given spheres of descriptors by
+// the given rule, each sphere in descending order.
+func rankStereo(spheres [][]_CIPStereo, rule func(_CIPStereo) uint32) [][]uint32 {
+	res := make([][]uint32, len(spheres))
+	for i, sp := range spheres {
+		res[i] = make([]uint32, len(sp))
+		for j, d := range sp {
+			res[i][j] = rule(d)
+		}
+		sort.Slice(res[i], func(x, y int) bool { return res[i][x] > res[i][y] })
+	}
+	return res
+}
+
+// likeRanks answers the ranks of the given spheres of descriptors by
+// Rule 4b: `2` for a chiral descriptor forming a like pair with the
+// reference descriptor of the branch, `1` for one forming an unlike
+// pair, and `0` for the others.  The reference is the first chiral
+// descriptor, sphere by sphere; should the first sphere holding any
+// hold both signs, each is tried, and the higher ranks answered.
+func likeRanks(spheres [][]_CIPStereo) [][]uint32 {
+	refs := []int(nil)
+	for _, sp := range spheres {
+		for _, d := range sp {
+			if s := chiralSign(d.atom); s != 0 && (len(refs) == 0 || refs[0] != s) {
+				refs = append(refs, s)
+			}
+		}
+		if len(refs) > 0 {
+			break
+		}
+	}
+
+	var best [][]uint32
+	for _, ref := range refs {
+		ranks := rankStereo(spheres, func(d _CIPStereo) uint32 {
+			switch s := chiralSign(d.atom); {
+			case s == 0:
+				return 0
+			case s == ref:
+				return 2
+			}
+			return 1
+		})
+		if best == nil || compareSpheres(ranks, best) > 0 {
+			best = ranks
+		}
+	}
+	return best
+}
+
+// compareSpheres compares the given spheres of ranks, in order.
+// Missing nodes are phantom atoms, which rank lowest.
+func compareSpheres(sa, sb [][]uint32) int {
+	for i := 0; i < len(sa) || i < len(sb); i++ {
+		var ka, kb []uint32
+		if i < len(sa) {
+			ka = sa[i]
+		}
+		if i < len(sb) {
+			kb = sb[i]
+		}
+		for j := 0; j < len(ka) || j < len(kb); j++ {
+			x, y := uint32(0), uint32(0)
+			if j < len(ka) {
+				x = ka[j]
+			}
+			if j < len(kb) {
+				y = kb[j]
+			}
+			switch {
+			case x > y:
+				return 1
+			case x < y:
+				return -1
+			}
+		}
+	}
+	return 0
+}
+
+// cipRanked answers the given neighbours of the given atom in the
+// descending order of their priorities, and whether any two of them
+// are tied.
+func (m *Molecule) cipRanked(root uint16, nbrs []uint16) ([]uint16, bool) {
+	res := append([]uint16(nil), nbrs...)
+	sort.SliceStable(res, func(i, j int) bool { return m.cipCompare(root, res[i], res[j]) > 0 })
+	for i := 1; i < len(res); i++ {
+		if m.cipCompare(root, res[i-1], res[i]) == 0 {
+			return res, true
+		}
+	}
+	return res, false
+}
@@ -0,0 +1,164 @@
+package molecule
+
+import (
+	"context"
+)
+
+// handleClone answers a copy of this molecule.  The copy is passive if
+// this molecule is, or if so requested.
+func (m *Molecule) handleClone(p interface{}) (StatusType, interface{}) {
+	passive := m.passive
+	if p != nil {
+		q, ok := p.(CloneQuery)
+		if !ok {
+			return StIncorrectParameter, nil
+		}
+		passive = passive || q.Passive
+	}
+
+	return StSuccess, m.clone(passive)
+}
+
+// clone answers a deep copy of this molecule, with a new ID.  The copy
+// shares no mutable state with this molecule.  A passive copy is not
+// tracked by any registry.
+//
+// Derived data that is computed lazily, such as the distance matrices,
+// is not copied.  Neither are the subscribers.
+func (m *Molecule) clone(passive bool) *Molecule {
+	c := m.duplicate(passive)
+	if !passive {
+		c.start(context.Background())
+	}
+	return c
+}
+
+// duplicate answers a deep copy of this molecule, as `clone` does, but
+// without starting the event loop of a copy that is not passive.  The
+// copy can thus be modified further in the current goroutine, before
+// being started.
+func (m *Molecule) duplicate(passive bool) *Molecule {
+	reg := m.registry
+	if passive {
+		reg = nil
+	}
+	c := initMolecule(reg, nil)
+
+	for _, a := range m.atoms {
+		na := a.clone(c)
+		c.atoms = append(c.atoms, na)
+		c.atomsByIid[na.iId] = na
+		if na.nId != 0 {
+			c.atomsByNid[na.nId] = na
+		}
+	}
+	for _, b := range m.bonds {
+		nb := b.clone(c)
+		c.bonds = append(c.bonds, nb)
+		c.bondsById[nb.id] = nb
+		c.bondsByPair[atomPairKey(nb.a1, nb.a2)] = nb
+	}
+	for _, r := range m.rings {
+		c.rings = append(c.rings, r.clone(c))
+	}
+	for _, rs := range m.ringSystems {
+		c.ringSystems = append(c.ringSystems, rs.clone(c))
+	}
+
+	c.nextAtomIid = m.nextAtomIid
+	c.nextBondId = m.nextBondId
+	c.nextRingId = m.nextRingId
+	c.nextRingSystemId = m.nextRingSystemId
+
+	c.vendor = m.vendor
+	c.vendorMoleculeId = m.vendorMoleculeId
+	c.source = m.source
+	c.steps = append(c.steps, m.steps...)
+	c.attributes = append(c.attributes, m.attributes...)
+	c.conformers = append(c.conformers, m.conformers...)
+	c.nextConformerId = m.nextConformerId
+	c.stereoGroups = cloneStereoGroups(m.stereoGroups)
+	c.sgroups = cloneSgroups(m.sgroups)
+
+	if m.cols != nil {
+		c.rebuildColumns()
+	}
+	c.members = m.members.clone()
+
+	c.passive = passive
+	return c
+}
+
+// clone answers a copy of this atom, belonging to the given molecule.
+func (a *_Atom) clone(mol *Molecule) *_Atom {
+	na := new(_Atom)
+	*na = *a
+	na.mol = mol
+
+	na.bonds = a.bonds.Clone()
+	na.nbrs = append([]uint16{}, a.nbrs...)
+	na.adj = append([]Neighbour{}, a.adj...)
+	na.rings = a.rings.Clone()
+	na.features = append([]uint16{}, a.features...)
+	na.attributes = append([]Attribute(nil), a.attributes...)
+
+	return na
+}
+
+// clone answers a copy of this bond, belonging to the given molecule.
+func (b *_Bond) clone(mol *Molecule) *_Bond {
+	nb := new(_Bond)
+	*nb = *b
+	nb.mol = mol
+
+	nb.rings = append([]uint16{}, b.rings...)
+	nb.attributes = append([]Attribute(nil), b.attributes...)
+
+	return nb
+}
+
+// clone answers a copy of this ring, belonging to the given molecule.
+func (r *_Ring) clone(mol *Molecule) *_Ring {
+	nr := new(_Ring)
+	*nr = *r
+	nr.mol = mol
+
+	nr.atoms = append([]uint16{}, r.atoms...)
+	nr.bonds = append([]uint16{}, r.bonds...)
+	nr.nbrs = append([]uint16{}, r.nbrs...)
+	nr.faces = append([]int8(nil), r.faces...)
+	nr.atomBitSet = r.atomBitSet.Clone()
+	nr.bondBitSet = r.bondBitSet.Clone()
+
+	return nr
+}
+
+// clone answers a copy of this ring system, belonging to the given
+// molecule.
+func (rs *_RingSystem) clone(mol *Molecule) *_RingSystem {
+	nrs := new(_RingSystem)
+	*nrs = *rs
+	nrs.mol = mol
+
+	nrs.rings = append([]uint16{}, rs.rings...)
+	nrs.atomBitSet = rs.atomBitSet.Clone()
+	nrs.bondBitSet = rs.bondBitSet.Clone()
+
+	return nrs
+}
+
+// clone answers a copy of these membership bitsets.
+func (ms *_Membership) clone() *_Membership {
+	nms := newMembership()
+	nms.cyclicAtoms = ms.cyclicAtoms.Clone()
+	nms.cyclicBonds = ms.cyclicBonds.Clone()
+	nms.aromaticAtoms = ms.aromaticAtoms.Clone()
+	nms.aromaticBonds = ms.aromaticBonds.Clone()
+	for n, bs := range ms.atomsByRingSize {
+		nms.atomsByRingSize[n] = bs.Clone()
+	}
+	for n, bs := range ms.bondsByRingSize {
+		nms.bondsByRingSize[n] = bs.Clone()
+	}
+	return nms
+}
@@ -0,0 +1,354 @@
+package molecule
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// Collection is a named set of molecules of a registry, such as a
+// dataset being screened, held by their IDs.
+//
+// A collection does not keep its molecules alive: those that exit
+// remain in it by their IDs, but are skipped when it is resolved to
+// molecules.  See `Prune`.
+//
+// Collections are safe for concurrent use.
+type Collection struct {
+	name     string
+	registry *MoleculeRegistry
+
+	mu  sync.RWMutex
+	ids map[uint64]bool
+}
+
+// NewCollection creates an empty collection of the given name in this
+// registry, answering an error if one of that name already exists.
+func (reg *MoleculeRegistry) NewCollection(name string) (*Collection, error) {
+	c := &Collection{name: name, registry: reg, ids: make(map[uint64]bool)}
+	if err := reg.addCollection(c); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// addCollection tracks the given collection in this registry, unless
+// one of its name already exists.
+func (reg *MoleculeRegistry) addCollection(c *Collection) error {
+	if c.name == "" {
+		return fmt.Errorf("Collection name is empty.")
+	}
+
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+
+	if _, ok := reg.collections[c.name]; ok {
+		return fmt.Errorf("Collection %s already exists.", c.name)
+	}
+	if reg.collections == nil {
+		reg.collections = make(map[string]*Collection)
+	}
+	reg.collections[c.name] = c
+	return nil
+}
+
+// Collection answers the collection of the given name in this
+// registry, if one such exists.  Answers `nil` otherwise.
+func (reg *MoleculeRegistry) Collection(name string) *Collection {
+	reg.mu.RLock()
+	defer reg.mu.RUnlock()
+
+	return reg.collections[name]
+}
+
+// Collections answers the names of the collections of this registry,
+// in ascending order.
+func (reg *MoleculeRegistry) Collections() []string {
+	reg.mu.RLock()
+	defer reg.mu.RUnlock()
+
+	names := make([]string, 0, len(reg.collections))
+	for name := range reg.collections {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// DropCollection stops tracking the collection of the given name.  Its
+// molecules are unaffected.
+func (reg *MoleculeRegistry) DropCollection(name string) {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+
+	delete(reg.collections, name)
+}
+
+// Union creates a collection of the given name holding the molecules
+// in any of the named collections.
+func (reg *MoleculeRegistry) Union(name string, of ...string) (*Collection, error) {
+	return reg.combine(name, of, func(n, total int) bool { return n > 0 })
+}
+
+// Intersection creates a collection of the given name holding the
+// molecules in all of the named collections.
+func (reg *MoleculeRegistry) Intersection(name string, of ...string) (*Collection, error) {
+	return reg.combine(name, of, func(n, total int) bool { return n == total })
+}
+
+// Difference creates a collection of the given name holding the
+// molecules in the first named collection, but in none of the others.
+func (reg *MoleculeRegistry) Difference(name, from string, minus ...string) (*Collection, error) {
+	src := reg.Collection(from)
+	if src == nil {
+		return nil, fmt.Errorf("Collection %s does not exist.", from)
+	}
+	ids := src.idSet()
+	for _, m := range minus {
+		o := reg.Collection(m)
+		if o == nil {
+			return nil, fmt.Errorf("Collection %s does not exist.", m)
+		}
+		for id := range o.idSet() {
+			delete(ids, id)
+		}
+	}
+
+	c := &Collection{name: name, registry: reg, ids: ids}
+	if err := reg.addCollection(c); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// combine creates a collection of the given name holding the molecules
+// in the named collections whose number of occurrences therein
+// satisfies the given test.
+func (reg *MoleculeRegistry) combine(name string, of []string, keep func(n, total int) bool) (*Collection, error) {
+	counts := make(map[uint64]int)
+	for _, o := range of {
+		src := reg.Collection(o)
+		if src == nil {
+			return nil, fmt.Errorf("Collection %s does not exist.", o)
+		}
+		for id := range src.idSet() {
+			counts[id]++
+		}
+	}
+
+	ids := make(map[uint64]bool)
+	for id, n := range counts {
+		if keep(n, len(of)) {
+			ids[id] = true
+		}
+	}
+
+	c := &Collection{name: name, registry: reg, ids: ids}
+	if err := reg.addCollection(c); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Name answers the name of this collection.
+func (c *Collection) Name() string {
+	return c.name
+}
+
+// Add adds the given molecules to this collection.  Molecules of other
+// registries are rejected, with none added.
+func (c *Collection) Add(mols ...*Molecule) error {
+	for _, mol := range mols {
+		if mol.registry != c.registry {
+			return fmt.Errorf("Molecule %d is not of the registry of collection %s.", mol.id, c.name)
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, mol := range mols {
+		c.ids[mol.id] = true
+	}
+	return nil
+}
+
+// AddIds adds the molecules with the given IDs to this collection,
+// whether or not they are alive.
+func (c *Collection) AddIds(ids ...uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, id := range ids {
+		c.ids[id] = true
+	}
+}
+
+// AddFiltered adds the molecules of a snapshot of the registry of this
+// collection that satisfy the given predicate.  See
+// `MoleculeRegistry.Each`.
+func (c *Collection) AddFiltered(pred Predicate) {
+	c.registry.Each(pred, func(mol *Molecule) bool {
+		c.AddIds(mol.id)
+		return true
+	})
+}
+
+// Remove removes the molecules with the given IDs from this
+// collection.
+func (c *Collection) Remove(ids ...uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, id := range ids {
+		delete(c.ids, id)
+	}
+}
+
+// Has answers if the molecule with the given ID is in this collection.
+func (c *Collection) Has(id uint64) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.ids[id]
+}
+
+// Len answers the number of molecule IDs in this collection, including
+// those of molecules that have exited.
+func (c *Collection) Len() int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return len(c.ids)
+}
+
+// Ids answers the molecule IDs in this collection, in ascending order.
+func (c *Collection) Ids() []uint64 {
+	c.mu.RLock()
+	ids := make([]uint64, 0, len(c.ids))
+	for id := range c.ids {
+		ids = append(ids, id)
+	}
+	c.mu.RUnlock()
+
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
+
+// idSet answers a copy of the set of IDs in this collection.
+func (c *Collection) idSet() map[uint64]bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	ids := make(map[uint64]bool, len(c.ids))
+	for id := range c.ids {
+		ids[id] = true
+	}
+	return ids
+}
+
+// Molecules answers the molecules in this collection that are
+// currently alive, in the ascending order of their IDs.  As with
+// `MoleculeRegistry.List`, the answer is a snapshot.
+func (c *Collection) Molecules() []*Molecule {
+	ids := c.Ids()
+	mols := make([]*Molecule, 0, len(ids))
+	for _, id := range ids {
+		if mol := c.registry.MoleculeWithId(id); mol != nil {
+			mols = append(mols, mol)
+		}
+	}
+	return mols
+}
+
+// Prune removes the IDs of the molecules that have exited from this
+// collection, and answers their number.
+func (c *Collection) Prune() int {
+	n := 0
+	for _, id := range c.Ids() {
+		if c.registry.MoleculeWithId(id) == nil {
+			c.Remove(id)
+			n++
+		}
+	}
+	return n
+}
+
+// Apply calls the given function with each alive molecule of this
+// collection, concurrently, and waits for all the calls to complete.
+// It answers the errors of the failed calls, by the IDs of their
+// molecules.
+//
+// No more calls run at once than the size of the worker pool of the
+// registry; see `MoleculeRegistry.SetWorkerPool`.  Calls yet to start
+// when the given context is done are not started, but fail with the
+// context's error.
+func (c *Collection) Apply(ctx context.Context, f func(ctx context.Context, mol *Molecule) error) map[uint64]error {
+	pool := c.registry.WorkerPool()
+	if pool == nil {
+		pool = DefaultWorkerPool
+	}
+
+	var mu sync.Mutex
+	errs := make(map[uint64]error)
+	fail := func(id uint64, err error) {
+		mu.Lock()
+		errs[id] = err
+		mu.Unlock()
+	}
+
+	// Molecules run their heavy requests in the pool themselves; the
+	// calls are merely bounded to the same extent here.
+	var wg sync.WaitGroup
+	slots := make(chan struct{}, pool.Size())
+	for _, mol := range c.Molecules() {
+		select {
+		case slots <- struct{}{}:
+		case <-ctx.Done():
+			fail(mol.id, ctx.Err())
+			continue
+		}
+
+		wg.Add(1)
+		go func(mol *Molecule) {
+			defer func() { <-slots; wg.Done() }()
+			if err := f(ctx, mol); err != nil {
+				fail(mol.id, err)
+			}
+		}(mol)
+	}
+	wg.Wait()
+
+	return errs
+}
+
+// Descriptors computes the named descriptors of the alive molecules of
+// this collection, and answers their values by the IDs of the
+// molecules, in the order of the names.  See `Apply` and
+// `DescriptorNames`.
+//
+// The values of molecules for which any descriptor failed are not
+// answered; their errors are.
+func (c *Collection) Descriptors(ctx context.Context, names ...string) (map[uint64][]float64, map[uint64]error) {
+	var mu sync.Mutex
+	res := make(map[uint64][]float64)
+
+	errs := c.Apply(ctx, func(ctx context.Context, mol *Molecule) error {
+		vals := make([]float64, len(names))
+		for i, name := range names {
+			reply, _ := mol.CallContext(ctx, ReqDescriptor, DescriptorQuery{name})
+			if err := statusError(reply, fmt.Sprintf("descriptor %s", name)); err != nil {
+				return err
+			}
+			vals[i] = reply.Payload.(DescriptorValue).Value
+		}
+
+		mu.Lock()
+		res[mol.id] = vals
+		mu.Unlock()
+		return nil
+	})
+
+	return res, errs
+}
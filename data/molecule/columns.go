@@ -0,0 +1,166 @@
+package molecule
+
+// Option configures a molecule at its construction.
+type Option func(m *Molecule)
+
+// ColumnarStorage answers an option that makes a molecule additionally
+// hold the frequently-used properties of its atoms in parallel slices,
+// one per property, indexed by the positions of the atoms.
+//
+// Descriptor computations then scan contiguous slices of small values,
+// rather than chasing a pointer per atom.  This benefits batch jobs
+// that compute many descriptors over many molecules, at the cost of
+// some memory and of keeping the columns in sync upon edits.
+func ColumnarStorage() Option {
+	return func(m *Molecule) {
+		m.cols = newAtomColumns()
+	}
+}
+
+// _AtomColumns holds properties of the atoms of a molecule in parallel
+// slices.  The atom at position `i` in the molecule's list of atoms
+// has its properties at index `i` of each slice.
+type _AtomColumns struct {
+	pos map[uint16]int // Positions of atoms, by their input IDs.
+
+	iIds     []uint16
+	atNums   []uint8
+	charges  []int8
+	hCounts  []uint8
+	degrees  []uint8 // Numbers of distinct neighbours.
+	aromatic []bool
+	counted  []bool // Of hydrogen atoms, whether counted in their former neighbours.
+}
+
+// newAtomColumns creates empty columns.
+func newAtomColumns() *_AtomColumns {
+	c := new(_AtomColumns)
+	c.pos = make(map[uint16]int)
+	return c
+}
+
+// appendAtom appends the properties of the given atom to these
+// columns.
+func (c *_AtomColumns) appendAtom(a *_Atom) {
+	c.pos[a.iId] = len(c.iIds)
+	c.iIds = append(c.iIds, a.iId)
+	c.atNums = append(c.atNums, a.atNum)
+	c.charges = append(c.charges, a.charge)
+	c.hCounts = append(c.hCounts, a.hCount)
+	c.degrees = append(c.degrees, uint8(len(a.adj)))
+	c.aromatic = append(c.aromatic, a.isInAroRing)
+	c.counted = append(c.counted, a.isCountedHydrogen())
+}
+
+// updateAtom refreshes the properties of the given atom in these
+// columns.
+func (c *_AtomColumns) updateAtom(a *_Atom) {
+	i, ok := c.pos[a.iId]
+	if !ok {
+		return
+	}
+
+	c.atNums[i] = a.atNum
+	c.charges[i] = a.charge
+	c.hCounts[i] = a.hCount
+	c.degrees[i] = uint8(len(a.adj))
+	c.aromatic[i] = a.isInAroRing
+	c.counted[i] = a.isCountedHydrogen()
+}
+
+// elementCounts answers the elemental composition of the atoms in
+// these columns.  See `Molecule.ElementCounts`.
+func (c *_AtomColumns) elementCounts() map[uint8]int {
+	counts := make(map[uint8]int)
+	for i, atNum := range c.atNums {
+		if c.counted[i] {
+			continue
+		}
+		counts[atNum]++
+		if c.hCounts[i] > 0 {
+			counts[1] += int(c.hCounts[i])
+		}
+	}
+
+	return counts
+}
+
+// heavyAtomCount answers the number of non-hydrogen atoms in these
+// columns.
+func (c *_AtomColumns) heavyAtomCount() int {
+	n := 0
+	for _, atNum := range c.atNums {
+		if atNum != 1 {
+			n++
+		}
+	}
+	return n
+}
+
+// syncAtom refreshes the columns of this molecule, if it has them, for
+// the given atom, after a change in its properties.
+func (m *Molecule) syncAtom(a *_Atom) {
+	if m.cols != nil {
+		m.cols.updateAtom(a)
+	}
+}
+
+// setAtomHCount sets the hydrogen count of the given atom of this
+// molecule, keeping its columns in sync.  Its isotopic hydrogens, if
+// any, are reduced to the new count, tritium first.
+func (m *Molecule) setAtomHCount(a *_Atom, n uint8) {
+	a.hCount = n
+	for k := 1; k >= 0; k-- {
+		excess := int(a.hIsotopes[0]) + int(a.hIsotopes[1]) - int(n)
+		if excess <= 0 {
+			break
+		}
+		if excess > int(a.hIsotopes[k]) {
+			excess = int(a.hIsotopes[k])
+		}
+		a.hIsotopes[k] -= uint8(excess)
+	}
+	m.syncAtom(a)
+}
+
+// addHydrogen counts the given hydrogen atom in the hydrogen count of
+// the given atom of this molecule, along with its isotope, should it
+// be deuterium or tritium.  The hydrogen atom is marked as counted, so
+// that it is not counted again; see `_Atom.isCountedHydrogen`.
+func (m *Molecule) addHydrogen(a, h *_Atom) {
+	if h.isotope == 2 || h.isotope == 3 {
+		a.hIsotopes[h.isotope-2]++
+	}
+	h.counted = true
+	m.syncAtom(h)
+	m.setAtomHCount(a, a.hCount+1)
+}
+
+// isCountedHydrogen answers if this atom is a hydrogen atom without
+// neighbours, nor charge, counted in the hydrogen count of its former
+// neighbour.  Hydrogen atoms standing on their own, as those of `H2`,
+// or a proton, are not.
+func (a *_Atom) isCountedHydrogen() bool {
+	return a.atNum == 1 && a.counted && len(a.adj) == 0 && a.charge == 0
+}
+
+// setAtomCharge sets the residual charge of the given atom of this
+// molecule, keeping its columns in sync.
+func (m *Molecule) setAtomCharge(a *_Atom, ch int8) {
+	a.charge = ch
+	m.syncAtom(a)
+}
+
+// setAtomAromatic marks the given atom of this molecule as being part
+// of an aromatic ring, keeping its columns in sync.
+func (m *Molecule) setAtomAromatic(a *_Atom) {
+	a.isInAroRing = true
+	m.members.aromaticAtoms.Set(uint(a.iId))
+	m.syncAtom(a)
+}
+
+// IsColumnar answers if this molecule holds its atom properties in
+// columns.  See `ColumnarStorage`.
+func (m *Molecule) IsColumnar() bool {
+	return m.cols != nil
+}
@@ -0,0 +1,247 @@
+package molecule
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Conformer is a set of 3D coordinates of the atoms of a molecule.
+//
+// The conformers held by a molecule are never modified in place.
+// Aligning them, for instance, replaces their coordinates.
+type Conformer struct {
+	Id        int              // Unique in its molecule; assigned when added.
+	Coords    map[uint16]Point // By input IDs of the atoms.
+	Energy    float64          // In kcal/mol; meaningful only if `HasEnergy`.
+	HasEnergy bool
+}
+
+// PruneOptions determines which conformers `PruneConformers` removes.
+// Zero values impose no limits.
+type PruneOptions struct {
+	// Conformers more than this above the lowest energy are removed.
+	// Those without energies are not judged by this.
+	EnergyWindow float64
+	// Conformers closer than this RMSD, after alignment, to one of
+	// lower energy, or added earlier, are removed.
+	MinRMSD float64
+	// At most these many conformers are retained.
+	MaxCount int
+}
+
+// AddConformer adds the given conformer to this molecule.  It must
+// have the coordinates of all the atoms, and only of them.  It answers
+// the conformer, with its ID assigned.
+func (m *Molecule) AddConformer(c Conformer) (Conformer, error) {
+	reply := m.Call(ReqAddConformer, c)
+	if err := statusError(reply, fmt.Sprintf("molecule %d", m.id)); err != nil {
+		return Conformer{}, err
+	}
+	return reply.Payload.(Conformer), nil
+}
+
+// RemoveConformer removes the conformer with the given ID.
+func (m *Molecule) RemoveConformer(id int) error {
+	return statusError(m.Call(ReqRemoveConformer, id), fmt.Sprintf("conformer %d", id))
+}
+
+// Conformers answers the conformers of this molecule, in the order of
+// their addition.
+func (m *Molecule) Conformers() ([]Conformer, error) {
+	reply := m.Call(ReqConformers, nil)
+	if err := statusError(reply, fmt.Sprintf("molecule %d", m.id)); err != nil {
+		return nil, err
+	}
+	return reply.Payload.([]Conformer), nil
+}
+
+// Conformer answers the conformer with the given ID.
+func (m *Molecule) Conformer(id int) (Conformer, error) {
+	confs, err := m.Conformers()
+	if err != nil {
+		return Conformer{}, err
+	}
+	for _, c := range confs {
+		if c.Id == id {
+			return c, nil
+		}
+	}
+	return Conformer{}, newRequestError(ReqConformers, StNotFound, fmt.Errorf("conformer %d of molecule %d", id, m.id))
+}
+
+// AlignConformers rotates and translates all the conformers of this
+// molecule to best fit the one with the given ID.  It answers the RMSD
+// of each conformer from that one, by ID.
+func (m *Molecule) AlignConformers(refId int) (map[int]float64, error) {
+	reply := m.Call(ReqAlignConformers, refId)
+	if err := statusError(reply, fmt.Sprintf("conformer %d", refId)); err != nil {
+		return nil, err
+	}
+	return reply.Payload.(map[int]float64), nil
+}
+
+// PruneConformers removes the conformers of this molecule that are
+// too high in energy, too similar to others, or too many, per the
+// given options.  Conformers are considered in increasing order of
+// energy, those without energies last, in the order of their addition.
+// It answers the IDs of the conformers removed.
+func (m *Molecule) PruneConformers(opts PruneOptions) ([]int, error) {
+	reply := m.Call(ReqPruneConformers, opts)
+	if err := statusError(reply, fmt.Sprintf("molecule %d", m.id)); err != nil {
+		return nil, err
+	}
+	return reply.Payload.([]int), nil
+}
+
+// handleAddConformer adds the given conformer to this molecule.
+func (m *Molecule) handleAddConformer(p interface{}) (StatusType, interface{}) {
+	c, ok := p.(Conformer)
+	if !ok {
+		return StIncorrectParameter, nil
+	}
+	if len(c.Coords) != len(m.atoms) {
+		return StIncorrectParameter, fmt.Errorf("Conformer has coordinates of %d atoms; molecule %d has %d.", len(c.Coords), m.id, len(m.atoms))
+	}
+
+	coords := make(map[uint16]Point, len(c.Coords))
+	for _, a := range m.atoms {
+		pt, ok := c.Coords[a.iId]
+		if !ok {
+			return StIncorrectParameter, fmt.Errorf("Conformer lacks the coordinates of atom %d.", a.iId)
+		}
+		coords[a.iId] = pt
+	}
+	c.Coords = coords
+
+	return StSuccess, m.addConformer(c)
+}
+
+// addConformer assigns the next ID to the given conformer, and adds it
+// to this molecule.  It answers the conformer so added.
+func (m *Molecule) addConformer(c Conformer) Conformer {
+	m.nextConformerId++
+	c.Id = m.nextConformerId
+	m.conformers = append(m.conformers, c)
+	return c
+}
+
+// conformerIndex answers the position of the conformer with the given
+// ID, or `-1` if there is none.
+func (m *Molecule) conformerIndex(id int) int {
+	for i, c := range m.conformers {
+		if c.Id == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// handleRemoveConformer removes the requested conformer.
+func (m *Molecule) handleRemoveConformer(p interface{}) (StatusType, interface{}) {
+	id, ok := p.(int)
+	if !ok {
+		return StIncorrectParameter, nil
+	}
+	i := m.conformerIndex(id)
+	if i < 0 {
+		return StNotFound, nil
+	}
+
+	m.conformers = append(m.conformers[:i:i], m.conformers[i+1:]...)
+	return StSuccess, nil
+}
+
+// points answers the coordinates of the given conformer, in the order
+// of the atoms of this molecule.  Atoms added after the conformer are
+// placed at the origin.
+func (m *Molecule) points(c Conformer) []Point {
+	pts := make([]Point, len(m.atoms))
+	for i, a := range m.atoms {
+		pts[i] = c.Coords[a.iId]
+	}
+	return pts
+}
+
+// handleAlignConformers aligns all the conformers of this molecule to
+// the requested one.
+func (m *Molecule) handleAlignConformers(p interface{}) (StatusType, interface{}) {
+	id, ok := p.(int)
+	if !ok {
+		return StIncorrectParameter, nil
+	}
+	i := m.conformerIndex(id)
+	if i < 0 {
+		return StNotFound, nil
+	}
+
+	ref := m.points(m.conformers[i])
+	res := make(map[int]float64, len(m.conformers))
+	confs := make([]Conformer, len(m.conformers))
+	for j, c := range m.conformers {
+		pts, r := superpose(ref, m.points(c))
+		c.Coords = make(map[uint16]Point, len(pts))
+		for k, a := range m.atoms {
+			c.Coords[a.iId] = pts[k]
+		}
+		confs[j] = c
+		res[c.Id] = r
+	}
+	m.conformers = confs
+
+	return StSuccess, res
+}
+
+// handlePruneConformers removes the conformers of this molecule per the
+// given options.
+func (m *Molecule) handlePruneConformers(p interface{}) (StatusType, interface{}) {
+	opts, ok := p.(PruneOptions)
+	if !ok {
+		return StIncorrectParameter, nil
+	}
+
+	order := append([]Conformer(nil), m.conformers...)
+	sort.SliceStable(order, func(i, j int) bool {
+		ci, cj := order[i], order[j]
+		if ci.HasEnergy != cj.HasEnergy {
+			return ci.HasEnergy
+		}
+		return ci.HasEnergy && ci.Energy < cj.Energy
+	})
+
+	kept := make(map[int]bool, len(order))
+	keptPts := make([][]Point, 0, len(order))
+	removed := make([]int, 0, len(order))
+	for _, c := range order {
+		drop := opts.MaxCount > 0 && len(keptPts) == opts.MaxCount
+		if !drop && opts.EnergyWindow > 0 && c.HasEnergy {
+			drop = c.Energy-order[0].Energy > opts.EnergyWindow
+		}
+		pts := m.points(c)
+		if !drop && opts.MinRMSD > 0 {
+			for _, k := range keptPts {
+				if _, r := superpose(k, pts); r < opts.MinRMSD {
+					drop = true
+					break
+				}
+			}
+		}
+
+		if drop {
+			removed = append(removed, c.Id)
+		} else {
+			kept[c.Id] = true
+			keptPts = append(keptPts, pts)
+		}
+	}
+
+	confs := make([]Conformer, 0, len(keptPts))
+	for _, c := range m.conformers {
+		if kept[c.Id] {
+			confs = append(confs, c)
+		}
+	}
+	m.conformers = confs
+
+	sort.Ints(removed)
+	return StSuccess, removed
+}
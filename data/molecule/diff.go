@@ -0,0 +1,286 @@
+package molecule
+
+import (
+	"sort"
+)
+
+// AtomChange records an atom present in both molecules compared by
+// `Diff`, whose properties differ.
+type AtomChange struct {
+	Old AtomInfo
+	New AtomInfo
+}
+
+// BondChange records a bond present in both molecules compared by
+// `Diff`, whose type or stereo configuration differs.
+type BondChange struct {
+	Old BondInfo
+	New BondInfo
+}
+
+// MolDiff is the structural difference between two molecules.  `Old`
+// refers to the first molecule, and `New` to the second.
+type MolDiff struct {
+	// Aligned atoms: input IDs in the first molecule mapped to those in
+	// the second.
+	AtomMap map[uint16]uint16
+
+	RemovedAtoms []AtomInfo // Atoms only in the first molecule.
+	AddedAtoms   []AtomInfo // Atoms only in the second molecule.
+	ChangedAtoms []AtomChange
+
+	RemovedBonds []BondInfo // Bonds only in the first molecule.
+	AddedBonds   []BondInfo // Bonds only in the second molecule.
+	ChangedBonds []BondChange
+}
+
+// IsEmpty answers if the compared molecules are structurally
+// identical.
+func (d *MolDiff) IsEmpty() bool {
+	return len(d.RemovedAtoms) == 0 && len(d.AddedAtoms) == 0 && len(d.ChangedAtoms) == 0 &&
+		len(d.RemovedBonds) == 0 && len(d.AddedBonds) == 0 && len(d.ChangedBonds) == 0
+}
+
+// Diff answers the structural difference between the two given
+// molecules.
+//
+// The atoms of the molecules are first aligned independently of their
+// input IDs.  Atoms having the same element and equivalent
+// surroundings, as determined by iterative refinement of their
+// connectivity (Morgan's algorithm), are aligned first, widest
+// surroundings first.  The remaining atoms are then aligned greedily,
+// by the most already-aligned neighbours in common.  This alignment is
+// heuristic; it need not be a maximum common substructure.
+//
+// Atoms and bonds are then compared under the alignment.
+func Diff(m1, m2 *Molecule) (*MolDiff, error) {
+	f1, err := m1.Freeze()
+	if err != nil {
+		return nil, err
+	}
+	f2, err := m2.Freeze()
+	if err != nil {
+		return nil, err
+	}
+
+	return diff(f1.mol, f2.mol), nil
+}
+
+// DiffByIid answers the structural difference between the two given
+// molecules, aligning their atoms by their input IDs.  This suits
+// molecules derived from one another by editing, as transforms do.
+func DiffByIid(m1, m2 *Molecule) (*MolDiff, error) {
+	f1, err := m1.Freeze()
+	if err != nil {
+		return nil, err
+	}
+	f2, err := m2.Freeze()
+	if err != nil {
+		return nil, err
+	}
+
+	amap := make(map[uint16]uint16)
+	for _, a := range f1.mol.atoms {
+		if f2.mol.atomWithIid(a.iId) != nil {
+			amap[a.iId] = a.iId
+		}
+	}
+	return compare(f1.mol, f2.mol, amap), nil
+}
+
+// diff aligns the atoms of the two given molecules, and compares them.
+func diff(m1, m2 *Molecule) *MolDiff {
+	return compare(m1, m2, align(m1, m2))
+}
+
+// morganClasses answers the equivalence classes of the atoms of the
+// given molecule, by element and connectivity, as computed using
+// Morgan's algorithm.  The classes after each round of refinement are
+// answered, beginning with the initial ones.  Classes after the same
+// number of rounds are comparable across molecules.
+//
+// At most the given number of rounds are performed.  If `untilStable`
+// is set, refinement stops when a round does not increase the number
+// of distinct classes.
+func morganClasses(m *Molecule, rounds int, untilStable bool) []map[uint16]uint64 {
+	cls := make(map[uint16]uint64, len(m.atoms))
+	for _, a := range m.atoms {
+		cls[a.iId] = uint64(a.atNum)<<8 | uint64(len(a.adj))
+	}
+	res := []map[uint16]uint64{cls}
+
+	n := countDistinct(cls)
+	for i := 0; i < rounds; i++ {
+		next := make(map[uint16]uint64, len(cls))
+		for _, a := range m.atoms {
+			nc := make([]uint64, 0, len(a.adj))
+			for _, nbr := range a.adj {
+				b := m.bondWithId(nbr.Bond)
+				nc = append(nc, cls[nbr.Atom]<<4|uint64(b.bType))
+			}
+			sort.Slice(nc, func(i, j int) bool { return nc[i] < nc[j] })
+
+			h := cls[a.iId]
+			for _, c := range nc {
+				h = (h ^ c) * 1099511628211
+			}
+			next[a.iId] = h
+		}
+
+		nn := countDistinct(next)
+		if untilStable && nn == n {
+			break
+		}
+		cls, n = next, nn
+		res = append(res, cls)
+	}
+
+	return res
+}
+
+// countDistinct answers the number of distinct values in the given
+// map.
+func countDistinct(m map[uint16]uint64) int {
+	seen := make(map[uint64]bool, len(m))
+	for _, v := range m {
+		seen[v] = true
+	}
+	return len(seen)
+}
+
+// align answers an alignment of the atoms of the first molecule to
+// those of the second.  See `Diff`.
+//
+// Atoms are aligned in stages: first by their classes after the most
+// rounds of refinement, i.e., by their widest surroundings, and then
+// by progressively narrower ones.  Within each stage, atoms having
+// aligned neighbours are aligned before others, and a candidate
+// sharing the most aligned neighbours is preferred.
+func align(m1, m2 *Molecule) map[uint16]uint16 {
+	limit := len(m1.atoms)
+	if len(m2.atoms) > limit {
+		limit = len(m2.atoms)
+	}
+	c1 := morganClasses(m1, limit, true)
+	c2 := morganClasses(m2, limit, true)
+	if len(c1) < len(c2) {
+		c1 = morganClasses(m1, len(c2)-1, false)
+	} else if len(c2) < len(c1) {
+		c2 = morganClasses(m2, len(c1)-1, false)
+	}
+
+	amap := make(map[uint16]uint16)
+	used := make(map[uint16]bool)
+	for r := len(c1) - 1; r >= 0; r-- {
+		same := func(a, b *_Atom) bool {
+			return c1[r][a.iId] == c2[r][b.iId]
+		}
+		alignBy(m1, m2, amap, used, same, true)
+		alignBy(m1, m2, amap, used, same, false)
+	}
+
+	// Remaining atoms, possibly of changed elements, by their aligned
+	// neighbours.
+	alignBy(m1, m2, amap, used, func(a, b *_Atom) bool { return true }, true)
+
+	return amap
+}
+
+// alignBy extends the given alignment with pairs of unaligned atoms
+// satisfying the given predicate.  For each atom of the first
+// molecule, the candidate sharing the most aligned neighbours with it
+// is chosen.  If `needNeighbours` is set, a candidate must share at
+// least one.
+func alignBy(m1, m2 *Molecule, amap map[uint16]uint16, used map[uint16]bool, ok func(a, b *_Atom) bool, needNeighbours bool) {
+	for progress := true; progress; {
+		progress = false
+		for _, a := range m1.atoms {
+			if _, done := amap[a.iId]; done {
+				continue
+			}
+
+			best, bestScore := (*_Atom)(nil), -1
+			for _, b := range m2.atoms {
+				if used[b.iId] || !ok(a, b) {
+					continue
+				}
+				if s := alignmentScore(a, b, amap); s > bestScore {
+					best, bestScore = b, s
+				}
+			}
+			if best == nil || (needNeighbours && bestScore == 0) {
+				continue
+			}
+
+			amap[a.iId] = best.iId
+			used[best.iId] = true
+			progress = true
+		}
+	}
+}
+
+// alignmentScore answers the number of neighbours of the first atom
+// aligned to neighbours of the second.
+func alignmentScore(a, b *_Atom, amap map[uint16]uint16) int {
+	s := 0
+	for _, na := range a.adj {
+		if nb, ok := amap[na.Atom]; ok && b.bondTo(nb) != nil {
+			s++
+		}
+	}
+	return s
+}
+
+// compare answers the differences between the two given molecules,
+// under the given alignment of their atoms.
+func compare(m1, m2 *Molecule, amap map[uint16]uint16) *MolDiff {
+	d := &MolDiff{AtomMap: amap}
+
+	aligned := make(map[uint16]bool, len(amap))
+	for _, a := range m1.atoms {
+		iid2, ok := amap[a.iId]
+		if !ok {
+			d.RemovedAtoms = append(d.RemovedAtoms, a.info())
+			continue
+		}
+		aligned[iid2] = true
+
+		b := m2.atomWithIid(iid2)
+		if a.atNum != b.atNum || a.symbol != b.symbol || a.isotope != b.isotope || a.charge != b.charge ||
+			a.hCount != b.hCount || a.radical != b.radical || a.rgroup != b.rgroup || a.attachment != b.attachment ||
+			a.hIsotopes != b.hIsotopes {
+			d.ChangedAtoms = append(d.ChangedAtoms, AtomChange{a.info(), b.info()})
+		}
+	}
+	for _, b := range m2.atoms {
+		if !aligned[b.iId] {
+			d.AddedAtoms = append(d.AddedAtoms, b.info())
+		}
+	}
+
+	matched := make(map[uint16]bool)
+	for _, b1 := range m1.bonds {
+		x, ok1 := amap[b1.a1]
+		y, ok2 := amap[b1.a2]
+		b2 := (*_Bond)(nil)
+		if ok1 && ok2 {
+			b2 = m2.bondBetween(x, y)
+		}
+		if b2 == nil {
+			d.RemovedBonds = append(d.RemovedBonds, b1.info())
+			continue
+		}
+
+		matched[b2.id] = true
+		if b1.bType != b2.bType || b1.given != b2.given || b1.bStereo != b2.bStereo {
+			d.ChangedBonds = append(d.ChangedBonds, BondChange{b1.info(), b2.info()})
+		}
+	}
+	for _, b2 := range m2.bonds {
+		if !matched[b2.id] {
+			d.AddedBonds = append(d.AddedBonds, b2.info())
+		}
+	}
+
+	return d
+}
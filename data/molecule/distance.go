@@ -0,0 +1,229 @@
+package molecule
+
+// Topological distances between the atoms of a molecule are computed
+// lazily, upon the first request needing them.  Thereafter, they are
+// updated incrementally as atoms and bonds are added, rather than
+// recomputed.  Edits that can lengthen distances discard the matrices,
+// to be recomputed upon the next such request.
+//
+// Both matrices are indexed by the positions of atoms in the
+// molecule's list of atoms, as recorded in `distIdx`.  A distance of
+// `-1` means that the atoms are not connected.  `paths[i][j]` is the
+// position of the atom next to atom `i` on a shortest path from atom
+// `i` to atom `j`, or `-1` if none exists.
+
+// ensureDistances computes the distance and path matrices of this
+// molecule, unless they are current already.
+func (m *Molecule) ensureDistances() {
+	if m.dists != nil {
+		return
+	}
+
+	n := len(m.atoms)
+	m.distIdx = make(map[uint16]int, n)
+	for i, a := range m.atoms {
+		m.distIdx[a.iId] = i
+	}
+
+	m.dists = make([][]int, n)
+	m.paths = make([][]int, n)
+	for i, a := range m.atoms {
+		m.dists[i], m.paths[i] = m.distancesFrom(a)
+	}
+}
+
+// distancesFrom performs a breadth-first search from the given atom,
+// answering the distance to every atom, and the first step on a
+// shortest path to it.
+func (m *Molecule) distancesFrom(src *_Atom) ([]int, []int) {
+	n := len(m.atoms)
+	dists := make([]int, n)
+	nexts := make([]int, n)
+	for i := range dists {
+		dists[i], nexts[i] = -1, -1
+	}
+
+	s := m.distIdx[src.iId]
+	dists[s], nexts[s] = 0, s
+
+	queue := []*_Atom{src}
+	for len(queue) > 0 {
+		a := queue[0]
+		queue = queue[1:]
+
+		ai := m.distIdx[a.iId]
+		for _, nbr := range a.adj {
+			j := m.distIdx[nbr.Atom]
+			if dists[j] != -1 {
+				continue
+			}
+
+			dists[j] = dists[ai] + 1
+			if ai == s {
+				nexts[j] = j
+			} else {
+				nexts[j] = nexts[ai]
+			}
+			queue = append(queue, m.atomWithIid(nbr.Atom))
+		}
+	}
+
+	return dists, nexts
+}
+
+// discardDistances discards the distance and path matrices of this
+// molecule, to be recomputed when next needed.
+func (m *Molecule) discardDistances() {
+	m.dists = nil
+	m.paths = nil
+	m.distIdx = nil
+}
+
+// distancesAtomAdded updates the distance and path matrices, if they
+// are current, for the given newly-added atom.  Being unbonded, it is
+// not connected to any other atom.
+func (m *Molecule) distancesAtomAdded(a *_Atom) {
+	if m.dists == nil {
+		return
+	}
+
+	n := len(m.dists)
+	m.distIdx[a.iId] = n
+	for i := range m.dists {
+		m.dists[i] = append(m.dists[i], -1)
+		m.paths[i] = append(m.paths[i], -1)
+	}
+
+	dists := make([]int, n+1)
+	nexts := make([]int, n+1)
+	for i := range dists {
+		dists[i], nexts[i] = -1, -1
+	}
+	dists[n], nexts[n] = 0, n
+
+	m.dists = append(m.dists, dists)
+	m.paths = append(m.paths, nexts)
+}
+
+// distancesBondAdded updates the distance and path matrices, if they
+// are current, for the given newly-added bond.
+//
+// A shortest path that benefits from the new bond traverses it exactly
+// once.  Hence, every pair of atoms is relaxed through the bond, in
+// each of its directions, using the distances prior to its addition.
+func (m *Molecule) distancesBondAdded(b *_Bond) {
+	if m.dists == nil {
+		return
+	}
+
+	u, v := m.distIdx[b.a1], m.distIdx[b.a2]
+	if m.dists[u][v] == 1 {
+		return
+	}
+
+	n := len(m.dists)
+	toU := make([]int, n)
+	toV := make([]int, n)
+	nextU := make([]int, n)
+	nextV := make([]int, n)
+	for i := 0; i < n; i++ {
+		toU[i], toV[i] = m.dists[i][u], m.dists[i][v]
+		nextU[i], nextV[i] = m.paths[i][u], m.paths[i][v]
+	}
+	fromU := append([]int{}, m.dists[u]...)
+	fromV := append([]int{}, m.dists[v]...)
+
+	for i := 0; i < n; i++ {
+		for j := 0; j < n; j++ {
+			m.relax(i, j, toU[i], fromV[j], u, v, nextU[i])
+			m.relax(i, j, toV[i], fromU[j], v, u, nextV[i])
+		}
+	}
+}
+
+// relax shortens the path from atom `i` to atom `j`, if going to atom
+// `x` (at distance `dix`), across the new bond to atom `y`, and then
+// on to atom `j` (at distance `dyj`) is shorter.  `next` is the first
+// step from atom `i` towards atom `x`.
+func (m *Molecule) relax(i, j, dix, dyj, x, y, next int) {
+	if dix < 0 || dyj < 0 {
+		return
+	}
+
+	d := dix + 1 + dyj
+	if cur := m.dists[i][j]; cur != -1 && cur <= d {
+		return
+	}
+
+	m.dists[i][j] = d
+	if i == x {
+		m.paths[i][j] = y
+	} else {
+		m.paths[i][j] = next
+	}
+}
+
+// distance answers the number of bonds on a shortest path between the
+// two given atoms, or `-1` if they are not connected.
+//
+// Note that the two given atoms are represented by their input IDs,
+// NOT normalised IDs.
+func (m *Molecule) distance(a1id, a2id uint16) int {
+	m.ensureDistances()
+	return m.dists[m.distIdx[a1id]][m.distIdx[a2id]]
+}
+
+// shortestPath answers the input IDs of the atoms on a shortest path
+// between the two given atoms, both inclusive.  Answers `nil` if they
+// are not connected.
+func (m *Molecule) shortestPath(a1id, a2id uint16) []uint16 {
+	m.ensureDistances()
+
+	i, j := m.distIdx[a1id], m.distIdx[a2id]
+	if m.dists[i][j] < 0 {
+		return nil
+	}
+
+	path := make([]uint16, 0, m.dists[i][j]+1)
+	path = append(path, a1id)
+	for i != j {
+		i = m.paths[i][j]
+		path = append(path, m.atoms[i].iId)
+	}
+	return path
+}
+
+// ringSize answers the size of the smallest ring that closes a path of
+// at most the given number of bonds between the given atoms, avoiding
+// the skipped atoms, which are counted in the ring.  Answers `0` if
+// there is no such ring.
+func (m *Molecule) ringSize(from, to uint16, max int, skip ...uint16) int {
+	extra := len(skip)
+	depth := map[uint16]int{from: 0}
+	queue := []uint16{from}
+	for len(queue) > 0 {
+		aid := queue[0]
+		queue = queue[1:]
+		if depth[aid] == max {
+			continue
+		}
+		for _, nbr := range m.atomWithIid(aid).adj {
+			if _, ok := depth[nbr.Atom]; ok {
+				continue
+			}
+			skipped := false
+			for _, x := range skip {
+				skipped = skipped || nbr.Atom == x
+			}
+			if skipped {
+				continue
+			}
+			depth[nbr.Atom] = depth[aid] + 1
+			if nbr.Atom == to {
+				return depth[nbr.Atom] + 1 + extra
+			}
+			queue = append(queue, nbr.Atom)
+		}
+	}
+	return 0
+}
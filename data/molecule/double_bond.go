@@ -0,0 +1,129 @@
+package molecule
+
+import (
+	"math"
+
+	cmn "github.com/RxnWeaver/rxnweaver/common"
+)
+
+// perceiveDoubleBonds determines the configurations of the stereogenic
+// double bonds of this molecule from its coordinates, 2-D or 3-D.
+// Those drawn as `either', or with a wavy bond from an end, are left
+// undetermined, as are those whose coordinates do not settle them.
+func (m *Molecule) perceiveDoubleBonds() {
+	for _, b := range m.bonds {
+		b.sides = 0
+		if b.stereoType != cmn.StereoTypeDoubleBond || b.isDrawnEither() {
+			continue
+		}
+		b.cip = b.doubleBondDescriptor()
+		if r1, r2, ok := b.lowestSubstituents(); ok {
+			side, _ := b.drawnSides(r1, r2)
+			b.sides = int8(side)
+		}
+	}
+}
+
+// lowestSubstituents answers the substituents of the lowest input IDs
+// at the ends of this double bond, by which its sides are given.  It
+// answers `false` should an end lack substituents.
+func (b *_Bond) lowestSubstituents() (uint16, uint16, bool) {
+	m := b.mol
+	lowest := func(iids []uint16) uint16 {
+		res := iids[0]
+		for _, iid := range iids[1:] {
+			if iid < res {
+				res = iid
+			}
+		}
+		return res
+	}
+	s1, s2 := b.axisOrthos(m.atomWithIid(b.a1)), b.axisOrthos(m.atomWithIid(b.a2))
+	if len(s1) == 0 || len(s2) == 0 {
+		return 0, 0, false
+	}
+	return lowest(s1), lowest(s2), true
+}
+
+// isDrawnEither answers if the configuration of this double bond is
+// drawn as unknown: by the bond itself, or by a single bond of unknown
+// sense, a wavy one, drawn from either of its ends.
+func (b *_Bond) isDrawnEither() bool {
+	if b.bStereo == cmn.BondStereoDoubleEither {
+		return true
+	}
+	m := b.mol
+	return m.atomWithIid(b.a1).hasEitherWedge() || m.atomWithIid(b.a2).hasEitherWedge()
+}
+
+// doubleBondDescriptor answers the configuration of this double bond,
+// as drawn: `Z` should the higher-ranked substituents of its ends lie
+// on the same side of it, and `E` should they lie on opposite sides.
+// Should the substituents of an end be tied in rank, or lie in line
+// with the bond, `CIPNone` is answered.
+func (b *_Bond) doubleBondDescriptor() cmn.CIPDescriptor {
+	m := b.mol
+	a1, a2 := m.atomWithIid(b.a1), m.atomWithIid(b.a2)
+	s1, tied1 := m.cipRanked(a1.iId, b.axisOrthos(a1))
+	s2, tied2 := m.cipRanked(a2.iId, b.axisOrthos(a2))
+	if tied1 || tied2 || len(s1) == 0 || len(s2) == 0 {
+		return cmn.CIPNone
+	}
+
+	side, ok := b.drawnSides(s1[0], s2[0])
+	switch {
+	case !ok:
+		return cmn.CIPNone
+	case side > 0:
+		return cmn.CIPZ
+	}
+	return cmn.CIPE
+}
+
+// drawnSides answers `1` should the given substituents of the first
+// and the second ends of this double bond lie on the same side of it,
+// as drawn, and `-1` should they lie on opposite sides.  It answers
+// `false` should they lie in line with the bond.  Declared sides
+// override the coordinates.
+func (b *_Bond) drawnSides(s1, s2 uint16) (int, bool) {
+	if b.declared != 0 {
+		r1, r2, ok := b.lowestSubstituents()
+		if !ok {
+			return 0, false
+		}
+		side := int(b.declared)
+		if s1 != r1 {
+			side = -side
+		}
+		if s2 != r2 {
+			side = -side
+		}
+		return side, true
+	}
+
+	m := b.mol
+	a1, a2 := m.atomWithIid(b.a1), m.atomWithIid(b.a2)
+
+	p1, p2 := a1.point(), a2.point()
+	u := sub(p2, p1)
+	l := math.Sqrt(dot(u, u))
+	if l < 1e-6 {
+		return 0, false
+	}
+	u = Point{u[0] / l, u[1] / l, u[2] / l}
+	perp := func(p, from Point) Point {
+		v := sub(p, from)
+		d := dot(v, u)
+		return Point{v[0] - d*u[0], v[1] - d*u[1], v[2] - d*u[2]}
+	}
+	v1 := perp(m.atomWithIid(s1).point(), p1)
+	v2 := perp(m.atomWithIid(s2).point(), p2)
+	d := dot(v1, v2)
+	if math.Abs(d) < 1e-3*math.Sqrt(dot(v1, v1)*dot(v2, v2)) || d == 0 {
+		return 0, false
+	}
+	if d > 0 {
+		return 1, true
+	}
+	return -1, true
+}
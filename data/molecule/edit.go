@@ -0,0 +1,368 @@
+package molecule
+
+import (
+	"fmt"
+	"sort"
+
+	cmn "github.com/RxnWeaver/rxnweaver/common"
+)
+
+// removeBond removes the given bond from this molecule, and
+// unregisters it from both of its atoms.
+//
+// Rings that include the bond cease to exist, and are removed as
+// well.  The cached distance matrices are discarded, since a removal
+// can lengthen any number of shortest paths.
+func (m *Molecule) removeBond(b *_Bond) {
+	for len(b.rings) > 0 {
+		m.removeRing(m.ringWithId(b.rings[0]))
+	}
+
+	a1 := m.atomWithIid(b.a1)
+	a2 := m.atomWithIid(b.a2)
+	a1.dropDeclaredStereo()
+	a2.dropDeclaredStereo()
+	a1.removeBond(b)
+	a2.removeBond(b)
+	m.syncAtom(a1)
+	m.syncAtom(a2)
+
+	for i, el := range m.bonds {
+		if el == b {
+			m.bonds = append(m.bonds[:i], m.bonds[i+1:]...)
+			break
+		}
+	}
+	delete(m.bondsById, b.id)
+	delete(m.bondsByPair, atomPairKey(b.a1, b.a2))
+	m.dropBondFromSgroups(b.id)
+
+	m.discardDistances()
+}
+
+// dropDeclaredStereo drops the parity declared for this atom, and the
+// sides declared for its double bonds, which a change in its
+// neighbours would invalidate.
+func (a *_Atom) dropDeclaredStereo() {
+	a.declared = cmn.StereoParityNone
+	for _, nbr := range a.adj {
+		a.mol.bondWithId(nbr.Bond).declared = 0
+	}
+}
+
+// removeAtom removes the given atom from this molecule, after
+// removing all of its bonds.
+func (m *Molecule) removeAtom(a *_Atom) {
+	for _, nbr := range m.neighbours(a) {
+		m.removeBond(m.bondWithId(nbr.Bond))
+	}
+
+	for i, el := range m.atoms {
+		if el == a {
+			m.atoms = append(m.atoms[:i], m.atoms[i+1:]...)
+			break
+		}
+	}
+	delete(m.atomsByIid, a.iId)
+	m.dropFromStereoGroups(a.iId)
+	m.dropFromSgroups(a.iId)
+	if cur, ok := m.atomsByNid[a.nId]; ok && cur == a {
+		delete(m.atomsByNid, a.nId)
+	}
+
+	// Positions of the atoms following the removed one have shifted.
+	if m.cols != nil {
+		m.rebuildColumns()
+	}
+
+	m.discardDistances()
+}
+
+// removeRing removes the given ring from this molecule, its atoms,
+// its bonds and its ring system.  A ring system left empty is removed
+// as well.
+//
+// Membership and aromaticity are then re-derived from the remaining
+// rings and ring systems.
+func (m *Molecule) removeRing(r *_Ring) {
+	for _, aid := range r.atoms {
+		if a := m.atomWithIid(aid); a != nil {
+			a.removeRing(r)
+		}
+	}
+	for _, bid := range r.bonds {
+		if b := m.bondWithId(bid); b != nil {
+			b.removeRing(r.id)
+		}
+	}
+
+	wid := 0
+	for _, rs := range m.ringSystems {
+		rs.removeRing(r)
+		if rs.size() > 0 {
+			m.ringSystems[wid] = rs
+			wid++
+		}
+	}
+	m.ringSystems = m.ringSystems[:wid]
+
+	for i, el := range m.rings {
+		if el == r {
+			m.rings = append(m.rings[:i], m.rings[i+1:]...)
+			break
+		}
+	}
+
+	m.rebuildMembership()
+}
+
+// rebuildMembership re-derives the ring and aromaticity membership of
+// the atoms and bonds of this molecule from its current rings and ring
+// systems.
+func (m *Molecule) rebuildMembership() {
+	ms := newMembership()
+	for _, r := range m.rings {
+		ms.addRing(r)
+		if r.isAro {
+			ms.aromaticAtoms.InPlaceUnion(r.atomBitSet)
+			ms.aromaticBonds.InPlaceUnion(r.bondBitSet)
+		}
+	}
+	for _, rs := range m.ringSystems {
+		if rs.isAro {
+			ms.aromaticAtoms.InPlaceUnion(rs.atomBitSet)
+			ms.aromaticBonds.InPlaceUnion(rs.bondBitSet)
+		}
+	}
+	m.members = ms
+
+	for _, a := range m.atoms {
+		a.isInAroRing = ms.aromaticAtoms.Test(uint(a.iId))
+		m.syncAtom(a)
+	}
+	for _, b := range m.bonds {
+		b.isAro = ms.aromaticBonds.Test(uint(b.id))
+	}
+}
+
+// rebuildColumns recreates the columns of this molecule from its
+// current list of atoms.
+func (m *Molecule) rebuildColumns() {
+	m.cols = newAtomColumns()
+	for _, a := range m.atoms {
+		m.cols.appendAtom(a)
+	}
+}
+
+// replaceAtom changes the element of the given atom to that with the
+// given symbol, retaining its bonds, charge and hydrogen count.
+func (m *Molecule) replaceAtom(a *_Atom, el cmn.Element) {
+	a.atNum = el.Number
+	a.symbol = el.Symbol
+	a.valence = el.Valence
+	m.syncAtom(a)
+}
+
+// handleRemoveAtom removes the requested atom, along with its bonds.
+func (m *Molecule) handleRemoveAtom(p interface{}) (StatusType, interface{}) {
+	q, ok := p.(AtomQuery)
+	if !ok {
+		return StIncorrectParameter, nil
+	}
+
+	a := m.atomWithIid(q.Iid)
+	if a == nil {
+		return StNotFound, nil
+	}
+
+	for _, nbr := range a.adj {
+		m.publish(EvBondRemoved, 0, nbr.Bond)
+	}
+	m.removeAtom(a)
+	m.publish(EvAtomRemoved, q.Iid, 0)
+	m.invalidate()
+	releaseAtom(a)
+	return StSuccess, nil
+}
+
+// handleRemoveBond removes the requested bond.
+func (m *Molecule) handleRemoveBond(p interface{}) (StatusType, interface{}) {
+	q, ok := p.(BondQuery)
+	if !ok {
+		return StIncorrectParameter, nil
+	}
+
+	b := m.bondWithId(q.Id)
+	if b == nil {
+		return StNotFound, nil
+	}
+
+	m.removeBond(b)
+	m.publish(EvBondRemoved, 0, q.Id)
+	m.invalidate()
+	releaseBond(b)
+	return StSuccess, nil
+}
+
+// handleReplaceAtom changes the element of the requested atom.
+func (m *Molecule) handleReplaceAtom(p interface{}) (StatusType, interface{}) {
+	q, ok := p.(AtomReplacement)
+	if !ok {
+		return StIncorrectParameter, nil
+	}
+	el, ok := cmn.PeriodicTable[q.Symbol]
+	if !ok {
+		return StIncorrectParameter, nil
+	}
+
+	a := m.atomWithIid(q.Iid)
+	if a == nil {
+		return StNotFound, nil
+	}
+
+	m.replaceAtom(a, el)
+	m.publish(EvAtomChanged, a.iId, 0)
+	m.invalidate()
+	return StSuccess, nil
+}
+
+// handleJoinAtoms replaces the requested terminal atoms by a bond
+// between their neighbours, keeping the configurations declared for
+// those.
+func (m *Molecule) handleJoinAtoms(p interface{}) (StatusType, interface{}) {
+	q, ok := p.(AtomJoin)
+	if !ok || !isValidBondType(q.Type) {
+		return StIncorrectParameter, nil
+	}
+
+	a1, a2 := m.atomWithIid(q.A1), m.atomWithIid(q.A2)
+	if a1 == nil || a2 == nil {
+		return StNotFound, nil
+	}
+	if a1 == a2 || len(a1.adj) != 1 || len(a2.adj) != 1 {
+		return StIncorrectParameter, fmt.Errorf("Atoms %d and %d are not distinct terminal atoms.", q.A1, q.A2)
+	}
+	x1, x2 := m.atomWithIid(a1.adj[0].Atom), m.atomWithIid(a2.adj[0].Atom)
+	if x1 == a2 || x1 == x2 || m.bondBetween(x1.iId, x2.iId) != nil {
+		return StIncorrectParameter, fmt.Errorf("Atoms %d and %d can not be joined.", q.A1, q.A2)
+	}
+
+	// The declarations the removals drop, as they stand with the new
+	// neighbours.
+	parities := [2]cmn.StereoParity{x1.declaredReplacing(a1.iId, x2.iId), x2.declaredReplacing(a2.iId, x1.iId)}
+	sides := make(map[*_Bond]int8)
+	for k, x := range [2]*_Atom{x1, x2} {
+		from, to := [2]uint16{a1.iId, a2.iId}[k], [2]uint16{x2.iId, x1.iId}[k]
+		for _, nbr := range x.adj {
+			if b := m.bondWithId(nbr.Bond); nbr.Atom != from && b.declared != 0 {
+				sides[b] = b.sidesReplacing(x, from, to)
+			}
+		}
+	}
+
+	for _, a := range [2]*_Atom{a1, a2} {
+		iid, bid := a.iId, a.adj[0].Bond
+		m.removeAtom(a)
+		m.publish(EvBondRemoved, 0, bid)
+		m.publish(EvAtomRemoved, iid, 0)
+		releaseAtom(a)
+	}
+	b := newBond(m, int(m.nextBondId))
+	b.a1, b.a2 = x1.iId, x2.iId
+	b.setType(q.Type)
+	if err := m.addBond(b); err != nil {
+		return StIncorrectParameter, err
+	}
+	x1.declared, x2.declared = parities[0], parities[1]
+	for sb, s := range sides {
+		sb.declared = s
+	}
+
+	m.distancesBondAdded(b)
+	m.publish(EvBondAdded, 0, b.id)
+	m.invalidate()
+	return StSuccess, nil
+}
+
+// handleSetAtomParity declares the parity of the requested atom.
+func (m *Molecule) handleSetAtomParity(p interface{}) (StatusType, interface{}) {
+	q, ok := p.(AtomParity)
+	if !ok || q.Parity > cmn.StereoParityUndefined {
+		return StIncorrectParameter, nil
+	}
+
+	a := m.atomWithIid(q.Iid)
+	if a == nil {
+		return StNotFound, nil
+	}
+
+	a.declared = q.Parity
+	m.publish(EvAtomChanged, a.iId, 0)
+	m.invalidate()
+	return StSuccess, nil
+}
+
+// handleSetBondSides declares the sides of the requested double bond.
+func (m *Molecule) handleSetBondSides(p interface{}) (StatusType, interface{}) {
+	q, ok := p.(BondSides)
+	if !ok || q.Sides < -1 || q.Sides > 1 {
+		return StIncorrectParameter, nil
+	}
+
+	b := m.bondWithId(q.Id)
+	if b == nil {
+		return StNotFound, nil
+	}
+
+	b.declared = q.Sides
+	m.publish(EvBondChanged, 0, b.id)
+	m.invalidate()
+	return StSuccess, nil
+}
+
+// declaredReplacing answers the parity declared for this atom, should
+// its neighbour `from` be replaced by `to`: inverted should that
+// change the order of its neighbours by their input IDs.
+func (a *_Atom) declaredReplacing(from, to uint16) cmn.StereoParity {
+	if a.declared != cmn.StereoParityOdd && a.declared != cmn.StereoParityEven {
+		return a.declared
+	}
+
+	seq := a.neighbourIids()
+	sort.Slice(seq, func(i, j int) bool { return seq[i] < seq[j] })
+	for i, n := range seq {
+		if n == from {
+			seq[i] = to
+		}
+	}
+	asc := append([]uint16(nil), seq...)
+	sort.Slice(asc, func(i, j int) bool { return asc[i] < asc[j] })
+	if permutationIsOdd(seq, asc) {
+		return a.declared.Inverse()
+	}
+	return a.declared
+}
+
+// sidesReplacing answers the sides declared for this double bond,
+// should the neighbour `from` of its given end be replaced by `to`:
+// inverted should that change which substituent of the end has the
+// lowest input ID.
+func (b *_Bond) sidesReplacing(end *_Atom, from, to uint16) int8 {
+	other := b.otherAtomIid(end.iId)
+	lowFrom, lowTo := true, true
+	for _, n := range end.neighbourIids() {
+		if n == other || n == from {
+			continue
+		}
+		if n < from {
+			lowFrom = false
+		}
+		if n < to {
+			lowTo = false
+		}
+	}
+	if lowFrom != lowTo {
+		return -b.declared
+	}
+	return b.declared
+}
@@ -0,0 +1,661 @@
+package molecule
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+
+	cmn "github.com/RxnWeaver/rxnweaver/common"
+)
+
+// Point is a position in space, in Angstroms.
+type Point [3]float64
+
+// EmbedOptions configures `Embed`.
+type EmbedOptions struct {
+	Conformers  int     // Number of conformers wanted; `0` means one.
+	Seed        int64   // Equal seeds yield equal conformers.
+	MaxAttempts int     // Per conformer; `0` means `DefaultEmbedAttempts`.
+	MinDistance float64 // Least dRMSD between conformers; `0` means `DefaultConformerDistance`.
+}
+
+// Defaults of embedding.
+const (
+	DefaultEmbedAttempts     = 10
+	DefaultConformerDistance = 0.3 // Angstroms.
+)
+
+// Embed generates 3D conformers of this molecule by distance geometry,
+// adds them to its conformers, and sets the coordinates of its atoms to
+// those of the first.  It answers the conformers generated, which may
+// be fewer than asked for, when the molecule is too rigid to yield as
+// many diverse ones.
+//
+// Only the atoms present are embedded; implicit hydrogens are not.
+// The molecule should have been sanitised, since its aromaticity and
+// hydrogen counts determine the geometry.  Stereocentres drawn with
+// wedge bonds in its 2D coordinates retain their configurations.  See
+// `doc/design/embedding.md`.
+func (m *Molecule) Embed(opts EmbedOptions) ([]Conformer, error) {
+	reply := m.Call(ReqEmbed, opts)
+	if err := statusError(reply, fmt.Sprintf("molecule %d", m.id)); err != nil {
+		return nil, err
+	}
+	return reply.Payload.([]Conformer), nil
+}
+
+// handleEmbed generates the requested conformers of this molecule.
+func (m *Molecule) handleEmbed(p interface{}) (StatusType, interface{}) {
+	opts, ok := p.(EmbedOptions)
+	if !ok && p != nil {
+		return StIncorrectParameter, nil
+	}
+	if opts.Conformers <= 0 {
+		opts.Conformers = 1
+	}
+	if opts.MaxAttempts <= 0 {
+		opts.MaxAttempts = DefaultEmbedAttempts
+	}
+	if opts.MinDistance <= 0 {
+		opts.MinDistance = DefaultConformerDistance
+	}
+	if len(m.atoms) == 0 {
+		return StIncorrectParameter, fmt.Errorf("Molecule %d has no atoms to embed.", m.id)
+	}
+
+	e := newEmbedder(m, opts.Seed)
+	confs := make([][]Point, 0, opts.Conformers)
+	for try := 0; try < opts.Conformers*opts.MaxAttempts && len(confs) < opts.Conformers; try++ {
+		x, ok := e.embed()
+		if !ok {
+			continue
+		}
+		diverse := true
+		for _, c := range confs {
+			if e.dRMSD(x, c) < opts.MinDistance {
+				diverse = false
+				break
+			}
+		}
+		if diverse {
+			confs = append(confs, x)
+		}
+	}
+	if len(confs) == 0 {
+		return StIncorrectParameter, fmt.Errorf("Could not embed molecule %d in %d attempts.", m.id, opts.MaxAttempts)
+	}
+
+	res := make([]Conformer, 0, len(confs))
+	for _, x := range confs {
+		c := Conformer{Coords: make(map[uint16]Point, len(x))}
+		for i, a := range e.atoms {
+			c.Coords[a.iId] = x[i]
+		}
+		res = append(res, m.addConformer(c))
+	}
+	for i, a := range e.atoms {
+		a.X, a.Y, a.Z = float32(confs[0][i][0]), float32(confs[0][i][1]), float32(confs[0][i][2])
+	}
+	m.invalidate()
+	return StSuccess, res
+}
+
+// _ChiralTarget is the required sign of the volume spanned by three
+// neighbours of a stereocentre, relative to it.  A zero sign requires
+// the volume to vanish, flattening sp2 centres.
+type _ChiralTarget struct {
+	centre, n1, n2, n3 int
+	sign               float64
+}
+
+// _Embedder holds the distance bounds of the atoms of a molecule, and
+// embeds them in space.  Atoms are referred to by their positions in
+// the molecule.
+type _Embedder struct {
+	mol    *Molecule
+	atoms  []*_Atom
+	pos    map[uint16]int
+	topo   [][]int8    // `1`, `2` or `3` for 1-2, 1-3 and 1-4 pairs; `0` otherwise.
+	lower  [][]float64 // Lower bounds of distances.
+	upper  [][]float64 // Upper bounds of distances.
+	chiral []_ChiralTarget
+	rng    *rand.Rand
+}
+
+// newEmbedder answers an embedder for the given molecule, with its
+// distance bounds set and smoothed.
+func newEmbedder(m *Molecule, seed int64) *_Embedder {
+	n := len(m.atoms)
+	e := &_Embedder{mol: m, atoms: m.atoms, pos: make(map[uint16]int, n), rng: rand.New(rand.NewSource(seed))}
+	e.topo = make([][]int8, n)
+	e.lower = make([][]float64, n)
+	e.upper = make([][]float64, n)
+	far := 1.5*float64(n) + 5
+	for i, a := range m.atoms {
+		e.pos[a.iId] = i
+		e.topo[i] = make([]int8, n)
+		e.lower[i] = make([]float64, n)
+		e.upper[i] = make([]float64, n)
+		for j := range e.upper[i] {
+			e.upper[i][j] = far
+		}
+		e.upper[i][i] = 0
+	}
+
+	e.setBondBounds()
+	e.setAngleBounds()
+	e.setTorsionBounds()
+	for i, a := range e.atoms {
+		for j := i + 1; j < n; j++ {
+			if e.topo[i][j] == 0 {
+				e.setBounds(i, j, cmn.CovalentRadius(a.atNum)+cmn.CovalentRadius(e.atoms[j].atNum)+1.0, far)
+			}
+		}
+	}
+	e.smooth()
+	e.setChiralTargets()
+
+	return e
+}
+
+// setBounds sets the bounds of the distance between the given atoms.
+func (e *_Embedder) setBounds(i, j int, lo, hi float64) {
+	e.lower[i][j], e.lower[j][i] = lo, lo
+	e.upper[i][j], e.upper[j][i] = hi, hi
+}
+
+// bondLength answers the ideal length of the given bond.
+func (e *_Embedder) bondLength(b *_Bond) float64 {
+	a1, a2 := e.mol.atomWithIid(b.a1), e.mol.atomWithIid(b.a2)
+	d := cmn.CovalentRadius(a1.atNum) + cmn.CovalentRadius(a2.atNum)
+	switch {
+	case b.isAro:
+		return 0.93 * d
+	case b.bType == cmn.BondTypeDouble:
+		return 0.89 * d
+	case b.bType == cmn.BondTypeTriple:
+		return 0.80 * d
+	}
+	return d
+}
+
+// setBondBounds sets the bounds of bonded atoms.
+func (e *_Embedder) setBondBounds() {
+	for _, b := range e.mol.bonds {
+		i, j := e.pos[b.a1], e.pos[b.a2]
+		d := e.bondLength(b)
+		e.setBounds(i, j, d-0.01, d+0.01)
+		e.topo[i][j], e.topo[j][i] = 1, 1
+	}
+}
+
+// angle answers the ideal angle at the given centre between its given
+// neighbours, in radians.
+func (e *_Embedder) angle(i, k, j *_Atom) float64 {
+	if s := e.mol.ringSize(i.iId, j.iId, 3, k.iId); s > 0 {
+		return math.Pi * float64(s-2) / float64(s)
+	}
+	switch {
+	case k.tripleBondCount > 0 || k.doubleBondCount > 1:
+		return math.Pi
+	case k.doubleBondCount == 1 || k.isInAroRing:
+		return 2 * math.Pi / 3
+	}
+	return 109.47 * math.Pi / 180
+}
+
+// setAngleBounds sets the bounds of atoms bonded to a common atom.
+func (e *_Embedder) setAngleBounds() {
+	for _, k := range e.atoms {
+		for x, nx := range k.adj {
+			for _, ny := range k.adj[x+1:] {
+				i, j := e.pos[nx.Atom], e.pos[ny.Atom]
+				if e.topo[i][j] == 1 {
+					continue // Three-membered ring.
+				}
+				r1 := e.bondLength(e.mol.bondWithId(nx.Bond))
+				r2 := e.bondLength(e.mol.bondWithId(ny.Bond))
+				th := e.angle(e.atoms[i], k, e.atoms[j])
+				d := math.Sqrt(r1*r1 + r2*r2 - 2*r1*r2*math.Cos(th))
+				e.setBounds(i, j, d-0.04, d+0.04)
+				e.topo[i][j], e.topo[j][i] = 2, 2
+			}
+		}
+	}
+}
+
+// torsionDistance answers the distance between the end atoms of a
+// torsion with the given bond lengths, bond angles and dihedral angle.
+func torsionDistance(rij, rjk, rkl, th1, th2, phi float64) float64 {
+	ix, iy := rij*math.Cos(th1), rij*math.Sin(th1)
+	lx := rjk - rkl*math.Cos(th2)
+	ly, lz := rkl*math.Sin(th2)*math.Cos(phi), rkl*math.Sin(th2)*math.Sin(phi)
+	return math.Sqrt((lx-ix)*(lx-ix) + (ly-iy)*(ly-iy) + lz*lz)
+}
+
+// setTorsionBounds sets the bounds of atoms separated by three bonds.
+//
+// Following ETKDG, these encode basic chemical knowledge: about flat
+// bonds, substituents are either cis or trans, as given by the ring
+// they share, or by the 2D coordinates of the molecule, and coplanar;
+// about acyclic sp3-sp3 bonds, eclipsed conformations are excluded.
+func (e *_Embedder) setTorsionBounds() {
+	placed := false
+	for _, a := range e.atoms {
+		if a.X != 0 || a.Y != 0 {
+			placed = true
+			break
+		}
+	}
+
+	for _, b := range e.mol.bonds {
+		j, k := e.atomWithIid(b.a1), e.atomWithIid(b.a2)
+		rjk := e.bondLength(b)
+		flat := b.isAro || b.bType == cmn.BondTypeDouble
+		cyclic := e.isCyclic(b, 6)
+
+		for _, ni := range j.adj {
+			if ni.Atom == k.iId {
+				continue
+			}
+			for _, nl := range k.adj {
+				if nl.Atom == j.iId || nl.Atom == ni.Atom {
+					continue
+				}
+				i, l := e.pos[ni.Atom], e.pos[nl.Atom]
+				if e.topo[i][l] != 0 {
+					continue
+				}
+
+				rij := e.bondLength(e.mol.bondWithId(ni.Bond))
+				rkl := e.bondLength(e.mol.bondWithId(nl.Bond))
+				th1 := e.angle(e.atoms[i], j, k)
+				th2 := e.angle(j, k, e.atoms[l])
+				cis := torsionDistance(rij, rjk, rkl, th1, th2, 0)
+				trans := torsionDistance(rij, rjk, rkl, th1, th2, math.Pi)
+
+				switch {
+				case flat:
+					if e.isCis(e.atoms[i], j, k, e.atoms[l], cyclic, placed) {
+						e.setBounds(i, l, cis-0.05, cis+0.05)
+					} else {
+						e.setBounds(i, l, trans-0.05, trans+0.05)
+					}
+					e.chiral = append(e.chiral, _ChiralTarget{e.pos[j.iId], i, e.pos[k.iId], l, 0})
+				case !cyclic && j.doubleBondCount+j.tripleBondCount == 0 && !j.isInAroRing &&
+					k.doubleBondCount+k.tripleBondCount == 0 && !k.isInAroRing:
+					gauche := torsionDistance(rij, rjk, rkl, th1, th2, math.Pi/3)
+					e.setBounds(i, l, gauche-0.1, trans+0.1)
+				default:
+					e.setBounds(i, l, cis-0.1, trans+0.1)
+				}
+				e.topo[i][l], e.topo[l][i] = 3, 3
+			}
+		}
+	}
+}
+
+// atomWithIid answers the atom with the given input ID.
+func (e *_Embedder) atomWithIid(iid uint16) *_Atom {
+	return e.atoms[e.pos[iid]]
+}
+
+// isCyclic answers if the given bond is in a ring of at most the given
+// size.
+func (e *_Embedder) isCyclic(b *_Bond, max int) bool {
+	depth := map[uint16]int{b.a1: 0}
+	queue := []uint16{b.a1}
+	for len(queue) > 0 {
+		aid := queue[0]
+		queue = queue[1:]
+		if depth[aid] == max-1 {
+			continue
+		}
+		for _, nbr := range e.mol.atomWithIid(aid).adj {
+			if nbr.Bond == b.id {
+				continue
+			}
+			if nbr.Atom == b.a2 {
+				return true
+			}
+			if _, ok := depth[nbr.Atom]; !ok {
+				depth[nbr.Atom] = depth[aid] + 1
+				queue = append(queue, nbr.Atom)
+			}
+		}
+	}
+	return false
+}
+
+// isCis answers if the given end atoms of a torsion about a flat bond
+// lie on the same side of it.
+//
+// Substituents in the same ring as the bond are cis.  Those in
+// different rings, or one of them in a ring and the other not, are
+// trans.  Exocyclic substituents on a ring bond are cis.  Others follow
+// the 2D coordinates, if the molecule has any, or are taken to be
+// trans.
+func (e *_Embedder) isCis(i, j, k, l *_Atom, cyclic, placed bool) bool {
+	if e.mol.ringSize(i.iId, l.iId, 6, j.iId, k.iId) > 0 {
+		return true
+	}
+	ri := e.mol.ringSize(i.iId, k.iId, 6, j.iId) > 0
+	rl := e.mol.ringSize(l.iId, j.iId, 6, k.iId) > 0
+	switch {
+	case ri || rl:
+		return false
+	case cyclic:
+		return true
+	case !placed:
+		return false
+	}
+
+	dx, dy := float64(k.X-j.X), float64(k.Y-j.Y)
+	si := dx*float64(i.Y-j.Y) - dy*float64(i.X-j.X)
+	sl := dx*float64(l.Y-j.Y) - dy*float64(l.X-j.X)
+	return si*sl > 0
+}
+
+// smooth tightens the bounds by the triangle inequality.  Bounds left
+// inconsistent by the approximations above are resolved in favour of
+// the upper ones.
+func (e *_Embedder) smooth() {
+	n := len(e.atoms)
+	for k := 0; k < n; k++ {
+		for i := 0; i < n; i++ {
+			for j := i + 1; j < n; j++ {
+				if u := e.upper[i][k] + e.upper[k][j]; u < e.upper[i][j] {
+					e.upper[i][j], e.upper[j][i] = u, u
+				}
+				lo := math.Max(e.lower[i][k]-e.upper[k][j], e.lower[j][k]-e.upper[k][i])
+				if lo > e.lower[i][j] {
+					e.lower[i][j], e.lower[j][i] = lo, lo
+				}
+			}
+		}
+	}
+	for i := 0; i < n; i++ {
+		for j := i + 1; j < n; j++ {
+			if e.lower[i][j] > e.upper[i][j] {
+				e.lower[i][j], e.lower[j][i] = e.upper[i][j], e.upper[i][j]
+			}
+		}
+	}
+}
+
+// setChiralTargets records the configurations of the tetrahedral
+// stereocentres of the molecule, as drawn by wedge bonds from them in
+// its 2D coordinates.  Undrawn centres are embedded either way.  The
+// sp2 centres having three neighbours are recorded as flat.
+func (e *_Embedder) setChiralTargets() {
+	cls := e.mol.canonicalClasses(HashIsotopes)
+	for c, a := range e.atoms {
+		if len(a.adj) == 3 && a.tripleBondCount == 0 && (a.doubleBondCount == 1 || a.isInAroRing) {
+			e.chiral = append(e.chiral, _ChiralTarget{c, e.pos[a.adj[0].Atom], e.pos[a.adj[1].Atom], e.pos[a.adj[2].Atom], 0})
+			continue
+		}
+		if len(a.adj) < 3 || !a.isTetrahedralCentre(cls) {
+			continue
+		}
+
+		v, ok := a.drawnVolume(a.adj[0].Atom, a.adj[1].Atom, a.adj[2].Atom, false)
+		if !ok {
+			continue
+		}
+		t := _ChiralTarget{c, e.pos[a.adj[0].Atom], e.pos[a.adj[1].Atom], e.pos[a.adj[2].Atom], 1}
+		if v < 0 {
+			t.sign = -1
+		}
+		e.chiral = append(e.chiral, t)
+	}
+}
+
+// embed answers one set of coordinates of the atoms, satisfying the
+// bounds and the chiral targets, if it can.
+func (e *_Embedder) embed() ([]Point, bool) {
+	n := len(e.atoms)
+	d := make([][]float64, n)
+	for i := range d {
+		d[i] = make([]float64, n)
+	}
+	for i := 0; i < n; i++ {
+		for j := i + 1; j < n; j++ {
+			v := e.lower[i][j] + e.rng.Float64()*(e.upper[i][j]-e.lower[i][j])
+			d[i][j], d[j][i] = v, v
+		}
+	}
+
+	x := e.metricCoords(d)
+	e.minimise(x)
+	for _, t := range e.chiral {
+		if t.sign != 0 && t.sign*e.chiralVolume(x, t) <= 0 {
+			return nil, false
+		}
+	}
+	return x, true
+}
+
+// metricCoords answers the coordinates best reproducing the given
+// distances, from the three largest eigenvalues of the metric matrix.
+func (e *_Embedder) metricCoords(d [][]float64) []Point {
+	n := len(d)
+	all := 0.0
+	for i := 0; i < n; i++ {
+		for j := i + 1; j < n; j++ {
+			all += d[i][j] * d[i][j]
+		}
+	}
+	d0 := make([]float64, n)
+	for i := 0; i < n; i++ {
+		s := 0.0
+		for j := 0; j < n; j++ {
+			s += d[i][j] * d[i][j]
+		}
+		d0[i] = s/float64(n) - all/float64(n*n)
+	}
+
+	g := make([][]float64, n)
+	shift := 0.0
+	for i := range g {
+		g[i] = make([]float64, n)
+		row := 0.0
+		for j := range g[i] {
+			g[i][j] = (d0[i] + d0[j] - d[i][j]*d[i][j]) / 2
+			row += math.Abs(g[i][j])
+		}
+		shift = math.Max(shift, row)
+	}
+	// Shifting makes all eigenvalues non-negative, so that power
+	// iteration finds the largest ones.
+	for i := range g {
+		g[i][i] += shift
+	}
+
+	x := make([]Point, n)
+	vecs := make([][]float64, 0, 3)
+	for dim := 0; dim < 3; dim++ {
+		v := make([]float64, n)
+		for i := range v {
+			v[i] = e.rng.Float64() - 0.5
+		}
+		lambda := 0.0
+		for iter := 0; iter < 200; iter++ {
+			w := make([]float64, n)
+			for i := range g {
+				for j, gij := range g[i] {
+					w[i] += gij * v[j]
+				}
+			}
+			for _, p := range vecs {
+				dot := 0.0
+				for i := range w {
+					dot += w[i] * p[i]
+				}
+				for i := range w {
+					w[i] -= dot * p[i]
+				}
+			}
+			norm := 0.0
+			for _, wi := range w {
+				norm += wi * wi
+			}
+			norm = math.Sqrt(norm)
+			if norm == 0 {
+				break
+			}
+			for i := range w {
+				w[i] /= norm
+			}
+			v, lambda = w, norm
+		}
+		vecs = append(vecs, v)
+
+		scale := math.Sqrt(math.Max(lambda-shift, 0))
+		for i := range x {
+			if scale > 0 {
+				x[i][dim] = v[i] * scale
+			} else {
+				x[i][dim] = e.rng.Float64() - 0.5
+			}
+		}
+	}
+	return x
+}
+
+// Weight of the chiral and flatness terms of the error function, and
+// the least magnitude of the chiral volumes.
+const (
+	chiralWeight = 1.0
+	minChiralVol = 1.0
+)
+
+// errorAndGradient answers the violation of the bounds and the chiral
+// and flatness targets by the given coordinates, and its gradient.
+func (e *_Embedder) errorAndGradient(x []Point) (float64, []Point) {
+	n := len(x)
+	grad := make([]Point, n)
+	err := 0.0
+	for i := 0; i < n; i++ {
+		for j := i + 1; j < n; j++ {
+			diff := sub(x[i], x[j])
+			d2 := dot(diff, diff)
+			u2 := e.upper[i][j] * e.upper[i][j]
+			l2 := e.lower[i][j] * e.lower[i][j]
+
+			de := 0.0 // Derivative with respect to the squared distance.
+			switch {
+			case d2 > u2:
+				t := d2/u2 - 1
+				err += t * t
+				de = 2 * t / u2
+			case d2 < l2:
+				t := 2*l2/(l2+d2) - 1
+				err += t * t
+				de = 2 * t * (-2 * l2 / ((l2 + d2) * (l2 + d2)))
+			default:
+				continue
+			}
+			for c := 0; c < 3; c++ {
+				grad[i][c] += de * 2 * diff[c]
+				grad[j][c] -= de * 2 * diff[c]
+			}
+		}
+	}
+
+	for _, t := range e.chiral {
+		v := e.chiralVolume(x, t)
+		f := 0.0 // Derivative with respect to the volume.
+		switch {
+		case t.sign == 0:
+			err += chiralWeight * v * v
+			f = 2 * chiralWeight * v
+		case t.sign*v < minChiralVol:
+			dv := minChiralVol - t.sign*v
+			err += chiralWeight * dv * dv
+			f = -2 * chiralWeight * dv * t.sign
+		default:
+			continue
+		}
+
+		a, b, c := sub(x[t.n1], x[t.centre]), sub(x[t.n2], x[t.centre]), sub(x[t.n3], x[t.centre])
+		ga, gb, gc := cross(b, c), cross(c, a), cross(a, b)
+		for k := 0; k < 3; k++ {
+			grad[t.n1][k] += f * ga[k]
+			grad[t.n2][k] += f * gb[k]
+			grad[t.n3][k] += f * gc[k]
+			grad[t.centre][k] -= f * (ga[k] + gb[k] + gc[k])
+		}
+	}
+
+	return err, grad
+}
+
+// minimise reduces the error of the given coordinates in place, by
+// steepest descent with an adaptive step.
+func (e *_Embedder) minimise(x []Point) {
+	err, grad := e.errorAndGradient(x)
+	step := 0.1
+	trial := make([]Point, len(x))
+	for iter := 0; iter < 2000 && err > 1e-8 && step > 1e-10; iter++ {
+		for i := range x {
+			for c := 0; c < 3; c++ {
+				trial[i][c] = x[i][c] - step*grad[i][c]
+			}
+		}
+		te, tg := e.errorAndGradient(trial)
+		if te < err {
+			copy(x, trial)
+			err, grad = te, tg
+			step *= 1.2
+		} else {
+			step *= 0.5
+		}
+	}
+}
+
+// chiralVolume answers the signed volume spanned by the neighbours of
+// the given target, relative to its centre.
+func (e *_Embedder) chiralVolume(x []Point, t _ChiralTarget) float64 {
+	c := x[t.centre]
+	return tripleProduct(sub(x[t.n1], c), sub(x[t.n2], c), sub(x[t.n3], c))
+}
+
+// dRMSD answers the root mean square difference of the interatomic
+// distances in the given coordinates.  Unlike the RMSD, it needs no
+// alignment.
+func (e *_Embedder) dRMSD(x, y []Point) float64 {
+	n := len(x)
+	if n < 2 {
+		return 0
+	}
+	s := 0.0
+	for i := 0; i < n; i++ {
+		for j := i + 1; j < n; j++ {
+			dx, dy := sub(x[i], x[j]), sub(y[i], y[j])
+			d := math.Sqrt(dot(dx, dx)) - math.Sqrt(dot(dy, dy))
+			s += d * d
+		}
+	}
+	return math.Sqrt(s / float64(n*(n-1)/2))
+}
+
+// sub answers the difference of the given points.
+func sub(p, q Point) Point {
+	return Point{p[0] - q[0], p[1] - q[1], p[2] - q[2]}
+}
+
+// dot answers the scalar product of the given vectors.
+func dot(p, q Point) float64 {
+	return p[0]*q[0] + p[1]*q[1] + p[2]*q[2]
+}
+
+// cross answers the vector product of the given vectors.
+func cross(p, q Point) Point {
+	return Point{p[1]*q[2] - p[2]*q[1], p[2]*q[0] - p[0]*q[2], p[0]*q[1] - p[1]*q[0]}
+}
+
+// tripleProduct answers the scalar triple product of the given
+// vectors.
+func tripleProduct(a, b, c Point) float64 {
+	return dot(a, cross(b, c))
+}
@@ -0,0 +1,200 @@
+package molecule
+
+import (
+	"context"
+	"fmt"
+
+	cmn "github.com/RxnWeaver/rxnweaver/common"
+)
+
+// Epimers answers the epimers of this molecule at the given
+// stereocentres, by their input IDs: for each, in order, a copy of this
+// molecule with the configuration of that centre alone inverted.
+// Should no centre be given, all those of determined configurations are
+// inverted in turn, in the order of the atoms.  This serves the
+// exploration of structure-activity relations, and the validation of
+// stereo handling, since each epimer must differ from this molecule.
+//
+// A centre is either a tetrahedral stereocentre, or a ring stereo atom
+// with a determined face; see `RingRelation`.  Inverting the latter
+// exchanges the cis and trans relations of its ring.  The centres are
+// inverted as drawn: by reversing the wedges drawn from them in 2-D
+// coordinates, or otherwise by declaring the inverse of their parities,
+// which override 3-D coordinates; see `AtomBuilder.Parity`.
+//
+// The epimers are new molecules, tracked by the registry of this one,
+// unless it is passive, in which case so are they.  This molecule
+// should have been sanitised; so are the epimers.
+func (m *Molecule) Epimers(centres ...uint16) ([]*Molecule, error) {
+	reply := m.Call(ReqEpimers, EpimerQuery{Centres: centres})
+	if err := statusError(reply, fmt.Sprintf("molecule %d", m.id)); err != nil {
+		return nil, err
+	}
+	return reply.Payload.([]*Molecule), nil
+}
+
+// Diastereomers answers up to `maxN` diastereomers of this molecule,
+// arising from inverting the given stereocentres, by their input IDs,
+// in all combinations; all those of determined configurations, should
+// none be given.  See `Epimers`.
+//
+// The combinations are tried in the order of the bits of their indices,
+// the first given centre being the lowest bit.  Isomers that are the
+// same, as those of a meso compound are, are answered once; they are
+// told apart by their structure hashes.  Neither this molecule, nor its
+// enantiomer, which inverting all its centres may yield, is answered.
+func (m *Molecule) Diastereomers(maxN int, centres ...uint16) ([]*Molecule, error) {
+	reply := m.Call(ReqEpimers, EpimerQuery{Centres: centres, Combined: true, MaxN: maxN})
+	if err := statusError(reply, fmt.Sprintf("molecule %d", m.id)); err != nil {
+		return nil, err
+	}
+	return reply.Payload.([]*Molecule), nil
+}
+
+// maxCombinedCentres is the largest number of stereocentres whose
+// inversions are combined.
+const maxCombinedCentres = 30
+
+// handleEpimers answers the epimers, or the diastereomers, of this
+// molecule, as requested.
+func (m *Molecule) handleEpimers(p interface{}) (StatusType, interface{}) {
+	q, ok := p.(EpimerQuery)
+	if !ok || (q.Combined && q.MaxN <= 0) {
+		return StIncorrectParameter, nil
+	}
+
+	centres := q.Centres
+	if len(centres) == 0 {
+		for _, a := range m.atoms {
+			if a.isInvertible() {
+				centres = append(centres, a.iId)
+			}
+		}
+	}
+	for _, iid := range centres {
+		a := m.atomWithIid(iid)
+		switch {
+		case a == nil:
+			return StNotFound, nil
+		case !a.isInvertible():
+			return StIncorrectParameter, fmt.Errorf("Atom %d is not a stereocentre of determined configuration.", iid)
+		}
+	}
+
+	if !q.Combined {
+		res := make([]*Molecule, 0, len(centres))
+		for _, iid := range centres {
+			res = append(res, m.invertedCopy([]uint16{iid}))
+		}
+		return StSuccess, res
+	}
+
+	if len(centres) > maxCombinedCentres {
+		return StIncorrectParameter, fmt.Errorf("Too many stereocentres to combine : %d.", len(centres))
+	}
+	seen := map[MolHash]bool{m.structureHash(registrationHashOptions): true}
+	mirror := m.duplicate(true)
+	mirror.reflect()
+	seen[mirror.structureHash(registrationHashOptions)] = true
+	mirror.Release()
+
+	found := [][]uint16(nil)
+	for mask := uint32(1); mask < 1<<uint(len(centres)) && len(found) < q.MaxN; mask++ {
+		inv := make([]uint16, 0, len(centres))
+		for k, iid := range centres {
+			if mask&(1<<uint(k)) != 0 {
+				inv = append(inv, iid)
+			}
+		}
+		x := m.duplicate(true)
+		x.invertCentres(inv)
+		if k := x.structureHash(registrationHashOptions); !seen[k] {
+			seen[k] = true
+			found = append(found, inv)
+		}
+		x.Release()
+	}
+
+	res := make([]*Molecule, 0, len(found))
+	for _, inv := range found {
+		res = append(res, m.invertedCopy(inv))
+	}
+	return StSuccess, res
+}
+
+// isInvertible answers if this atom is a stereocentre of determined
+// configuration, or a ring stereo atom with a determined face.
+func (a *_Atom) isInvertible() bool {
+	switch {
+	case a.stereoType != cmn.StereoTypeTetrahedral && a.stereoType != cmn.StereoTypeRing:
+		return false
+	case a.declared == cmn.StereoParityOdd || a.declared == cmn.StereoParityEven:
+		return true
+	}
+	return a.parity == cmn.StereoParityOdd || a.parity == cmn.StereoParityEven
+}
+
+// invertedCopy answers a copy of this molecule, with the given centres
+// inverted, tracked as this molecule is.
+func (m *Molecule) invertedCopy(centres []uint16) *Molecule {
+	c := m.duplicate(m.passive)
+	c.invertCentres(centres)
+	if !c.passive {
+		c.start(context.Background())
+	}
+	return c
+}
+
+// invertCentres inverts the configurations of the given centres of this
+// molecule, and perceives its stereo afresh.  See `Epimers`.
+func (m *Molecule) invertCentres(centres []uint16) {
+	wedged := m.canDrawWedges()
+	for _, iid := range centres {
+		a := m.atomWithIid(iid)
+		switch {
+		case a.declared == cmn.StereoParityOdd || a.declared == cmn.StereoParityEven:
+			a.declared = a.declared.Inverse()
+		case wedged && a.hasWedge():
+			for _, nbr := range a.adj {
+				b := m.bondWithId(nbr.Bond)
+				if b.a1 != a.iId {
+					continue
+				}
+				switch b.bStereo {
+				case cmn.BondStereoUp:
+					b.bStereo = cmn.BondStereoDown
+				case cmn.BondStereoDown:
+					b.bStereo = cmn.BondStereoUp
+				}
+			}
+		default:
+			a.declared = a.parity.Inverse()
+		}
+	}
+	m.perceiveStereo()
+}
+
+// hasWedge answers if a wedge, up or down, is drawn from this atom.
+func (a *_Atom) hasWedge() bool {
+	for _, nbr := range a.adj {
+		b := a.mol.bondWithId(nbr.Bond)
+		if b.a1 == a.iId && (b.bStereo == cmn.BondStereoUp || b.bStereo == cmn.BondStereoDown) {
+			return true
+		}
+	}
+	return false
+}
+
+// reflect replaces this molecule by its mirror image, reflecting its
+// coordinates through the plane `x = 0`, inverting the parities
+// declared for its atoms, and perceives its stereo afresh.  Declared
+// double bond configurations are unchanged by reflection.
+func (m *Molecule) reflect() {
+	for _, a := range m.atoms {
+		a.X = -a.X
+		if a.declared == cmn.StereoParityOdd || a.declared == cmn.StereoParityEven {
+			a.declared = a.declared.Inverse()
+		}
+	}
+	m.perceiveStereo()
+}
@@ -0,0 +1,109 @@
+package molecule
+
+// EventType enumerates the changes that a molecule notifies its
+// subscribers of.
+type EventType uint8
+
+// Constants representing the events published by a molecule.
+const (
+	EvAtomAdded EventType = iota
+	EvBondAdded
+	EvAtomChanged
+	EvBondChanged
+	EvTagAdded
+	EvAtomRemoved
+	EvBondRemoved
+	EvTagChanged
+	EvTagRemoved
+
+	// The structure was replaced wholesale, as by undo or redo.
+	EvRestored
+
+	// Derived properties (rings, aromaticity, distances, etc.) no
+	// longer reflect the structure, and are to be recomputed.
+	EvPropertiesInvalidated
+
+	// The molecule has exited; no further events follow.
+	EvExited
+)
+
+// Event is a notification of a change in a molecule, sent to its
+// subscribers.
+//
+// The atom of an atom event, and the bond of a bond event, are
+// identified by their input ID and ID, respectively.  Fields that do
+// not concern an event are `0`, and to be ignored by its type.
+type Event struct {
+	Type     EventType
+	Molecule uint64
+	Atom     uint16
+	Bond     uint16
+}
+
+// handleSubscribe adds the given channel to the subscribers of this
+// molecule.
+func (m *Molecule) handleSubscribe(p interface{}) (StatusType, interface{}) {
+	ch, ok := p.(chan<- Event)
+	if !ok || ch == nil {
+		return StIncorrectParameter, nil
+	}
+
+	for _, s := range m.subscribers {
+		if s == ch {
+			return StAlreadyExists, nil
+		}
+	}
+
+	m.subscribers = append(m.subscribers, ch)
+	return StSuccess, nil
+}
+
+// handleUnsubscribe removes the given channel from the subscribers of
+// this molecule.
+func (m *Molecule) handleUnsubscribe(p interface{}) (StatusType, interface{}) {
+	ch, ok := p.(chan<- Event)
+	if !ok {
+		return StIncorrectParameter, nil
+	}
+
+	for i, s := range m.subscribers {
+		if s == ch {
+			m.subscribers = append(m.subscribers[:i], m.subscribers[i+1:]...)
+			return StSuccess, nil
+		}
+	}
+	return StNotFound, nil
+}
+
+// publish sends an event of the given type, concerning the given atom
+// and bond, to all the subscribers of this molecule.
+//
+// A molecule never waits on its subscribers: an event that can not be
+// delivered immediately is dropped for that subscriber.  Subscribers
+// should, therefore, use suitably buffered channels.
+//
+// While an edit session is being applied, events are held back, to be
+// sent only if the session succeeds.
+func (m *Molecule) publish(typ EventType, aiid, bid uint16) {
+	if len(m.subscribers) == 0 {
+		return
+	}
+
+	ev := Event{typ, m.id, aiid, bid}
+	if m.holding {
+		m.held = append(m.held, ev)
+		return
+	}
+	for _, s := range m.subscribers {
+		select {
+		case s <- ev:
+		default:
+		}
+	}
+}
+
+// invalidate notifies the subscribers of this molecule that its
+// derived properties are to be recomputed.
+func (m *Molecule) invalidate() {
+	m.publish(EvPropertiesInvalidated, 0, 0)
+}
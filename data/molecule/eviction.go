@@ -0,0 +1,164 @@
+package molecule
+
+import (
+	"sort"
+	"sync/atomic"
+	"time"
+)
+
+// EvictionPolicy bounds the molecules that a registry keeps alive, for
+// services whose molecules would otherwise accumulate without bound.
+// Zero values impose no limits.
+//
+// Molecules are evicted by being sent `ReqExit`, as `Release` and
+// `Clear` do.  Agents holding evicted molecules find their requests
+// failing with `StMoleculeExited`, and should re-create them from
+// their sources, as a cache would.
+type EvictionPolicy struct {
+	// The most molecules kept alive.  The least recently used ones
+	// beyond this are evicted.
+	MaxMolecules int
+
+	// Molecules that have received no requests for this long are
+	// evicted.
+	IdleTTL time.Duration
+
+	// How often the registry is checked.  When zero, a tenth of the
+	// idle TTL, or a second, whichever is shorter, is used.  Creating
+	// molecules beyond `MaxMolecules` triggers a check regardless.
+	Interval time.Duration
+}
+
+// IsZero answers if this policy imposes no limits.
+func (p EvictionPolicy) IsZero() bool {
+	return p.MaxMolecules <= 0 && p.IdleTTL <= 0
+}
+
+// interval answers the period of the checks of this policy.
+func (p EvictionPolicy) interval() time.Duration {
+	if p.Interval > 0 {
+		return p.Interval
+	}
+	if p.IdleTTL > 0 && p.IdleTTL/10 < time.Second {
+		return p.IdleTTL / 10
+	}
+	return time.Second
+}
+
+// _Evictor enforces the eviction policy of a registry, in a goroutine
+// of its own.
+type _Evictor struct {
+	policy EvictionPolicy
+	kick   chan struct{} // Asks for a check now.
+	stop   chan struct{} // Closed to stop.
+}
+
+// SetEvictionPolicy sets the policy by which this registry evicts its
+// molecules, replacing any set earlier.  A zero policy stops eviction.
+func (reg *MoleculeRegistry) SetEvictionPolicy(p EvictionPolicy) {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+
+	if reg.evictor != nil {
+		close(reg.evictor.stop)
+		reg.evictor = nil
+	}
+	atomic.StoreInt64(&reg.evictLimit, 0)
+	if p.IsZero() {
+		return
+	}
+
+	ev := &_Evictor{policy: p, kick: make(chan struct{}, 1), stop: make(chan struct{})}
+	reg.evictor = ev
+	atomic.StoreInt64(&reg.evictLimit, int64(p.MaxMolecules))
+	go reg.runEvictor(ev)
+}
+
+// EvictionPolicy answers the policy set for this registry.
+func (reg *MoleculeRegistry) EvictionPolicy() EvictionPolicy {
+	reg.mu.RLock()
+	defer reg.mu.RUnlock()
+
+	if reg.evictor == nil {
+		return EvictionPolicy{}
+	}
+	return reg.evictor.policy
+}
+
+// Evicted answers the number of molecules evicted from this registry
+// so far.
+func (reg *MoleculeRegistry) Evicted() uint64 {
+	return atomic.LoadUint64(&reg.evicted)
+}
+
+// kickEvictor asks the evictor of this registry, if any, to check it
+// now, should it hold too many molecules.  The lock of the registry is
+// taken only then.
+func (reg *MoleculeRegistry) kickEvictor() {
+	limit := atomic.LoadInt64(&reg.evictLimit)
+	if limit <= 0 || atomic.LoadInt64(&reg.count) <= limit {
+		return
+	}
+
+	reg.mu.RLock()
+	ev := reg.evictor
+	reg.mu.RUnlock()
+	if ev == nil {
+		return
+	}
+	select {
+	case ev.kick <- struct{}{}:
+	default:
+	}
+}
+
+// runEvictor checks this registry periodically, and when kicked, until
+// the given evictor is stopped.
+func (reg *MoleculeRegistry) runEvictor(ev *_Evictor) {
+	ticker := time.NewTicker(ev.policy.interval())
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ev.stop:
+			return
+		case <-ticker.C:
+		case <-ev.kick:
+		}
+		reg.evict(ev.policy, ev.stop)
+	}
+}
+
+// evict sends `ReqExit` to the molecules of this registry that the
+// given policy evicts: first the idle ones, and then the least
+// recently used ones beyond the limit.  It gives up when the given
+// channel is closed.
+func (reg *MoleculeRegistry) evict(p EvictionPolicy, stop <-chan struct{}) {
+	mols := reg.snapshot()
+	used := make(map[*Molecule]int64, len(mols))
+	for _, mol := range mols {
+		used[mol] = atomic.LoadInt64(&mol.lastUsed)
+	}
+	sort.Slice(mols, func(i, j int) bool { return used[mols[i]] < used[mols[j]] })
+
+	n := 0
+	if p.IdleTTL > 0 {
+		cutoff := time.Now().Add(-p.IdleTTL).UnixNano()
+		for n < len(mols) && used[mols[n]] < cutoff {
+			n++
+		}
+	}
+	if p.MaxMolecules > 0 && len(mols)-n > p.MaxMolecules {
+		n = len(mols) - p.MaxMolecules
+	}
+
+	for _, mol := range mols[:n] {
+		select {
+		case mol.inChannel <- InMessage{Request: ReqExit}:
+			atomic.AddUint64(&reg.evicted, 1)
+		case <-mol.done:
+		case <-stop:
+			return
+		}
+	}
+}
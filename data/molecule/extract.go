@@ -0,0 +1,50 @@
+package molecule
+
+import (
+	"context"
+	"fmt"
+)
+
+// ExtractAtoms answers a new molecule comprising copies of the given
+// atoms of this molecule, and of the bonds between them.  Rings all of
+// whose atoms are given are retained as well.
+//
+// The atoms and bonds retain their input IDs and bond IDs.  The new
+// molecule is tracked by the same registry as this molecule, unless
+// this molecule is passive, in which case so is the new one.
+func (m *Molecule) ExtractAtoms(iids []uint16) (*Molecule, error) {
+	reply := m.Call(ReqExtractAtoms, append([]uint16{}, iids...))
+	if err := statusError(reply, fmt.Sprintf("molecule %d", m.id)); err != nil {
+		return nil, err
+	}
+	return reply.Payload.(*Molecule), nil
+}
+
+// handleExtractAtoms answers a new molecule comprising the requested
+// atoms, along with the bonds and rings induced by them.
+func (m *Molecule) handleExtractAtoms(p interface{}) (StatusType, interface{}) {
+	iids, ok := p.([]uint16)
+	if !ok || len(iids) == 0 {
+		return StIncorrectParameter, nil
+	}
+
+	keep := make(map[uint16]bool, len(iids))
+	for _, iid := range iids {
+		if m.atomWithIid(iid) == nil {
+			return StNotFound, fmt.Errorf("Atom not found : %d", iid)
+		}
+		keep[iid] = true
+	}
+
+	c := m.duplicate(m.passive)
+	for _, a := range append([]*_Atom{}, c.atoms...) {
+		if !keep[a.iId] {
+			c.removeAtom(a)
+		}
+	}
+
+	if !c.passive {
+		c.start(context.Background())
+	}
+	return StSuccess, c
+}
@@ -0,0 +1,323 @@
+package molecule
+
+import (
+	"context"
+	"fmt"
+
+	cmn "github.com/RxnWeaver/rxnweaver/common"
+)
+
+// Call sends the given request, with the given payload, to this
+// molecule, and waits for its reply.
+//
+// Call is a blocking convenience over the message protocol.  It must
+// not be invoked from within this molecule's own event loop.  Should
+// the molecule exit before replying, the reply answered has the status
+// `StMoleculeExited`.
+func (m *Molecule) Call(req RequestType, payload interface{}) OutMessage {
+	reply, _ := m.CallContext(context.Background(), req, payload)
+	return reply
+}
+
+// CallContext sends the given request, with the given payload, to this
+// molecule, and waits for its reply until the given context is done.
+// The context's deadline, if any, is sent along with the request.
+//
+// A `*RequestError` is answered if the request could not be completed,
+// along with a reply carrying the same error as its payload.  This
+// includes the cases of the context being done, and the molecule
+// exiting, before a reply is received.
+func (m *Molecule) CallContext(ctx context.Context, req RequestType, payload interface{}) (OutMessage, error) {
+	out := make(chan OutMessage, 1)
+	msg := InMessage{Request: req, OutChannel: out, Payload: payload}
+	if d, ok := ctx.Deadline(); ok {
+		msg.Deadline = d
+	}
+
+	if m.passive {
+		return m.serve(msg)
+	}
+
+	select {
+	case m.inChannel <- msg:
+	case <-m.done:
+		return failedReply(req, StMoleculeExited, nil)
+	case <-ctx.Done():
+		return failedReply(req, StDeadlineExceeded, ctx.Err())
+	}
+
+	select {
+	case reply := <-out:
+		return replyResult(reply)
+	case <-m.done:
+		// The reply may have been sent just before the molecule exited.
+		select {
+		case reply := <-out:
+			return replyResult(reply)
+		default:
+			return failedReply(req, StMoleculeExited, nil)
+		}
+	case <-ctx.Done():
+		return failedReply(req, StDeadlineExceeded, ctx.Err())
+	}
+}
+
+// serve processes the given request synchronously, on behalf of this
+// passive molecule.
+func (m *Molecule) serve(msg InMessage) (OutMessage, error) {
+	select {
+	case <-m.done:
+		return failedReply(msg.Request, StMoleculeExited, nil)
+	default:
+	}
+
+	if msg.Request == ReqExit {
+		m.stop()
+		return OutMessage{StSuccess, msg.Cookie, nil}, nil
+	}
+
+	m.processInMessage(msg)
+	return replyResult(<-msg.OutChannel)
+}
+
+// failedReply answers a reply for the given request that could not be
+// completed, along with its error.
+func failedReply(req RequestType, st StatusType, cause error) (OutMessage, error) {
+	err := newRequestError(req, st, cause)
+	return OutMessage{st, 0, err}, err
+}
+
+// replyResult answers the given reply, along with its error, if any.
+func replyResult(reply OutMessage) (OutMessage, error) {
+	if err, ok := reply.Payload.(*RequestError); ok {
+		return reply, err
+	}
+	return reply, nil
+}
+
+// statusError answers the error describing the failure of the given
+// reply, or `nil` if the reply indicates success.  The subject names
+// the entity that the request concerned, and is recorded as the cause
+// when none is known.
+func statusError(reply OutMessage, subject string) error {
+	if reply.Status == StSuccess {
+		return nil
+	}
+
+	re, ok := reply.Payload.(*RequestError)
+	if !ok {
+		re = newRequestError(0, reply.Status, nil)
+	}
+	if re.Err == nil {
+		re.Err = fmt.Errorf("%s", subject)
+	}
+	return re
+}
+
+// AddAtom adds the atom built by the given builder to this molecule.
+func (m *Molecule) AddAtom(ab *AtomBuilder) error {
+	return statusError(m.Call(ReqAddAtom, ab), "atom")
+}
+
+// AddBond adds the bond built by the given builder to this molecule.
+func (m *Molecule) AddBond(bb *BondBuilder) error {
+	return statusError(m.Call(ReqAddBond, bb), "bond")
+}
+
+// AddTag adds the given attribute to this molecule.
+func (m *Molecule) AddTag(attr Attribute) error {
+	return statusError(m.Call(ReqAddTag, attr), fmt.Sprintf("tag %s", attr.Name))
+}
+
+// AtomCount answers the number of atoms in this molecule, or `0` if the
+// molecule has exited.
+func (m *Molecule) AtomCount() int {
+	n, _ := m.Call(ReqAtomCount, nil).Payload.(int)
+	return n
+}
+
+// BondCount answers the number of bonds in this molecule, or `0` if the
+// molecule has exited.
+func (m *Molecule) BondCount() int {
+	n, _ := m.Call(ReqBondCount, nil).Payload.(int)
+	return n
+}
+
+// RingCount answers the number of rings in this molecule, or `0` if the
+// molecule has exited.
+func (m *Molecule) RingCount() int {
+	n, _ := m.Call(ReqRingCount, nil).Payload.(int)
+	return n
+}
+
+// AtomInfo answers a snapshot of the atom with the given input ID.
+func (m *Molecule) AtomInfo(iid uint16) (AtomInfo, error) {
+	reply := m.Call(ReqAtomInfo, AtomQuery{iid})
+	if err := statusError(reply, fmt.Sprintf("atom %d", iid)); err != nil {
+		return AtomInfo{}, err
+	}
+	return reply.Payload.(AtomInfo), nil
+}
+
+// BondInfo answers a snapshot of the bond with the given ID.
+func (m *Molecule) BondInfo(id uint16) (BondInfo, error) {
+	reply := m.Call(ReqBondInfo, BondQuery{id})
+	if err := statusError(reply, fmt.Sprintf("bond %d", id)); err != nil {
+		return BondInfo{}, err
+	}
+	return reply.Payload.(BondInfo), nil
+}
+
+// BondBetween answers a snapshot of the bond between the atoms with
+// the given input IDs.
+func (m *Molecule) BondBetween(a1, a2 uint16) (BondInfo, error) {
+	reply := m.Call(ReqBondBetween, AtomPair{a1, a2})
+	if err := statusError(reply, fmt.Sprintf("bond between atoms %d and %d", a1, a2)); err != nil {
+		return BondInfo{}, err
+	}
+	return reply.Payload.(BondInfo), nil
+}
+
+// Neighbours answers the distinct neighbours of the atom with the
+// given input ID, along with the bonds to them.  The answer is served
+// from the atom's adjacency list, which is maintained as bonds are
+// added and edited.
+func (m *Molecule) Neighbours(iid uint16) ([]Neighbour, error) {
+	reply := m.Call(ReqNeighbours, AtomQuery{iid})
+	if err := statusError(reply, fmt.Sprintf("atom %d", iid)); err != nil {
+		return nil, err
+	}
+	return reply.Payload.([]Neighbour), nil
+}
+
+// Distance answers the number of bonds on a shortest path between the
+// atoms with the given input IDs, or `-1` if they are not connected.
+func (m *Molecule) Distance(a1, a2 uint16) (int, error) {
+	reply := m.Call(ReqDistance, AtomPair{a1, a2})
+	if err := statusError(reply, fmt.Sprintf("atoms %d and %d", a1, a2)); err != nil {
+		return -1, err
+	}
+	return reply.Payload.(int), nil
+}
+
+// ShortestPath answers the input IDs of the atoms on a shortest path
+// between the atoms with the given input IDs, both inclusive.
+func (m *Molecule) ShortestPath(a1, a2 uint16) ([]uint16, error) {
+	reply := m.Call(ReqShortestPath, AtomPair{a1, a2})
+	if err := statusError(reply, fmt.Sprintf("path between atoms %d and %d", a1, a2)); err != nil {
+		return nil, err
+	}
+	return reply.Payload.([]uint16), nil
+}
+
+// RingInfo answers a snapshot of the ring with the given ID.
+func (m *Molecule) RingInfo(id uint16) (RingInfo, error) {
+	reply := m.Call(ReqRingInfo, RingQuery{id})
+	if err := statusError(reply, fmt.Sprintf("ring %d", id)); err != nil {
+		return RingInfo{}, err
+	}
+	return reply.Payload.(RingInfo), nil
+}
+
+// Descriptor answers the value of the named descriptor of this
+// molecule.  See `DescriptorNames` for the names understood.
+func (m *Molecule) Descriptor(name string) (float64, error) {
+	reply := m.Call(ReqDescriptor, DescriptorQuery{name})
+	if err := statusError(reply, fmt.Sprintf("descriptor %s", name)); err != nil {
+		return 0, err
+	}
+	return reply.Payload.(DescriptorValue).Value, nil
+}
+
+// SetAtomCharge sets the residual charge of the atom with the given
+// input ID.
+func (m *Molecule) SetAtomCharge(iid uint16, charge int8) error {
+	return statusError(m.Call(ReqSetAtomCharge, AtomCharge{iid, charge}), fmt.Sprintf("atom %d", iid))
+}
+
+// SetAtomHCount sets the number of hydrogen atoms attached to the atom
+// with the given input ID.
+func (m *Molecule) SetAtomHCount(iid uint16, hCount uint8) error {
+	return statusError(m.Call(ReqSetAtomHCount, AtomHCount{iid, hCount}), fmt.Sprintf("atom %d", iid))
+}
+
+// SetAttachment sets the attachment points of a substituent at the atom
+// with the given input ID: `1` for the first, `2` for the second, `3`
+// for both, and `0` for none.
+func (m *Molecule) SetAttachment(iid uint16, points uint8) error {
+	return statusError(m.Call(ReqSetAttachment, AtomAttachment{iid, points}), fmt.Sprintf("atom %d", iid))
+}
+
+// SetBondType sets the order of the bond with the given ID.  An
+// aromatic or a query type is kept as given, the bond keeping its
+// Kekulé type, if single or double, and being made single otherwise,
+// until sanitisation assigns its Kekulé type.  See `Kekulise`.
+func (m *Molecule) SetBondType(id uint16, typ cmn.BondType) error {
+	return statusError(m.Call(ReqSetBondType, BondTypeEdit{id, typ}), fmt.Sprintf("bond %d", id))
+}
+
+// SetAtomParity declares the configuration of the atom with the given
+// input ID, as a tetrahedral stereocentre, by the MDL parity of its
+// neighbours, as `AtomBuilder.Parity` does.  `cmn.StereoParityNone`
+// drops the declaration.  Stereo is perceived afresh by sanitisation.
+func (m *Molecule) SetAtomParity(iid uint16, parity cmn.StereoParity) error {
+	return statusError(m.Call(ReqSetAtomParity, AtomParity{iid, parity}), fmt.Sprintf("atom %d", iid))
+}
+
+// SetBondSides declares the configuration of the double bond with the
+// given ID, as `BondBuilder.Cis` does: `1` should the substituents of
+// the lowest input IDs at its ends lie on the same side of it, and `-1`
+// should they lie on opposite sides.  `0` drops the declaration.
+func (m *Molecule) SetBondSides(id uint16, sides int8) error {
+	return statusError(m.Call(ReqSetBondSides, BondSides{id, sides}), fmt.Sprintf("bond %d", id))
+}
+
+// Clone answers an independent copy of this molecule, with a new ID.
+// The copy has its own event loop, and is tracked by the same
+// registry, unless this molecule is passive, in which case so is the
+// copy.  Subscribers are not copied.
+func (m *Molecule) Clone() (*Molecule, error) {
+	reply := m.Call(ReqClone, nil)
+	if err := statusError(reply, fmt.Sprintf("molecule %d", m.id)); err != nil {
+		return nil, err
+	}
+	return reply.Payload.(*Molecule), nil
+}
+
+// RemoveAtom removes the atom with the given input ID, along with all
+// of its bonds.  Rings through the atom are removed as well.
+func (m *Molecule) RemoveAtom(iid uint16) error {
+	return statusError(m.Call(ReqRemoveAtom, AtomQuery{iid}), fmt.Sprintf("atom %d", iid))
+}
+
+// RemoveBond removes the bond with the given ID.  Rings through the
+// bond are removed as well.
+func (m *Molecule) RemoveBond(id uint16) error {
+	return statusError(m.Call(ReqRemoveBond, BondQuery{id}), fmt.Sprintf("bond %d", id))
+}
+
+// ReplaceAtom changes the element of the atom with the given input ID
+// to that with the given symbol.  Its bonds are retained.
+func (m *Molecule) ReplaceAtom(iid uint16, symbol string) error {
+	return statusError(m.Call(ReqReplaceAtom, AtomReplacement{iid, symbol}), fmt.Sprintf("atom %d", iid))
+}
+
+// JoinAtoms replaces the given terminal atoms, each bonded to a single
+// atom, by a bond of the given type between those atoms, as when an
+// R-group is substituted.  Unlike the removal of the atoms, this keeps
+// the configurations declared for the atoms bonded, each taking its new
+// neighbour in place of the atom replaced; see `AtomBuilder.Parity`.
+func (m *Molecule) JoinAtoms(a1, a2 uint16, typ cmn.BondType) error {
+	return statusError(m.Call(ReqJoinAtoms, AtomJoin{a1, a2, typ}), fmt.Sprintf("atoms %d and %d", a1, a2))
+}
+
+// Subscribe registers the given channel to receive notifications of
+// the changes to this molecule.  See `Event`.
+func (m *Molecule) Subscribe(ch chan<- Event) error {
+	return statusError(m.Call(ReqSubscribe, ch), "subscriber")
+}
+
+// Unsubscribe stops the notifications to the given channel.
+func (m *Molecule) Unsubscribe(ch chan<- Event) error {
+	return statusError(m.Call(ReqUnsubscribe, ch), "subscriber")
+}
@@ -0,0 +1,103 @@
+package molecule
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/fnv"
+	"sort"
+
+	cmn "github.com/RxnWeaver/rxnweaver/common"
+)
+
+// Default parameters of circular fingerprints.
+const (
+	FingerprintSize   = 1024 // Number of bins.
+	FingerprintRadius = 2    // Number of neighbourhood expansions.
+)
+
+// Fingerprint answers a hashed circular fingerprint of this molecule,
+// with the given number of bins.
+//
+// Each atom is first assigned an invariant computed from its element,
+// charge, hydrogen count, degree and aromaticity.  In each of the
+// given number of rounds, every atom's invariant is then combined
+// with the sorted invariants of its neighbours, along with the types
+// of the bonds to them, aromatic bonds being of a type of their own,
+// whatever their Kekulé types.  Every invariant computed in every round
+// is counted in the bin it hashes to.
+//
+// The fingerprint is computed by the molecule, through `ReqFingerprint`.
+// Should it fail, as when the molecule has exited, or the size is not
+// positive, an empty fingerprint is answered.
+func (m *Molecule) Fingerprint(size, radius int) []int32 {
+	reply := m.Call(ReqFingerprint, FingerprintQuery{Size: size, Radius: radius})
+	if err := statusError(reply, fmt.Sprintf("molecule %d", m.id)); err != nil {
+		if size < 0 {
+			size = 0
+		}
+		return make([]int32, size)
+	}
+	return reply.Payload.([]int32)
+}
+
+// fingerprint computes the circular fingerprint of this molecule.  See
+// `Fingerprint`.
+func (m *Molecule) fingerprint(size, radius int) []int32 {
+	fp := make([]int32, size)
+	if size <= 0 {
+		return fp
+	}
+
+	invs := make(map[uint16]uint64, len(m.atoms))
+	for _, a := range m.atoms {
+		aro := uint64(0)
+		if a.isInAroRing {
+			aro = 1
+		}
+		invs[a.iId] = hashInts(uint64(a.atNum), uint64(uint8(a.charge)), uint64(a.hCount),
+			uint64(a.bonds.Count()), aro)
+		fp[invs[a.iId]%uint64(size)]++
+	}
+
+	for round := 0; round < radius; round++ {
+		next := make(map[uint16]uint64, len(invs))
+		for _, a := range m.atoms {
+			nbrInvs := make([]uint64, 0, len(a.adj))
+			for _, nbr := range a.adj {
+				b := m.bondWithId(nbr.Bond)
+				typ := b.bType
+				if b.isAro || b.given == cmn.BondTypeAltern {
+					typ = cmn.BondTypeAltern
+				}
+				nbrInvs = append(nbrInvs, hashInts(uint64(typ), invs[nbr.Atom]))
+			}
+			sort.Sort(uint64s(nbrInvs))
+
+			next[a.iId] = hashInts(append([]uint64{invs[a.iId]}, nbrInvs...)...)
+			fp[next[a.iId]%uint64(size)]++
+		}
+		invs = next
+	}
+
+	return fp
+}
+
+// hashInts answers a 64-bit FNV-1a hash of the given sequence of
+// integers.
+func hashInts(vals ...uint64) uint64 {
+	h := fnv.New64a()
+	buf := make([]byte, 8)
+	for _, v := range vals {
+		binary.LittleEndian.PutUint64(buf, v)
+		h.Write(buf)
+	}
+
+	return h.Sum64()
+}
+
+// uint64s sorts a list of unsigned integers in ascending order.
+type uint64s []uint64
+
+func (s uint64s) Len() int           { return len(s) }
+func (s uint64s) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s uint64s) Less(i, j int) bool { return s[i] < s[j] }
@@ -0,0 +1,53 @@
+package molecule_test
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/RxnWeaver/rxnweaver/data/molecule"
+)
+
+func TestFingerprintKekuleForms(t *testing.T) {
+	tests := [][]string{
+		{"c1ccc2ccccc2c1", "c1cccc2c1cccc2", "C1=CC=C2C=CC=CC2=C1", "C1=CC2=CC=CC=C2C=C1"},
+		{"Oc1ccccc1C(=O)O", "c1cccc(O)c1C(O)=O", "OC1=CC=CC=C1C(O)=O", "OC(=O)C1=C(O)C=CC=C1"},
+	}
+	for _, smis := range tests {
+		var want []int32
+		for _, smi := range smis {
+			mol := readSmiles(t, smi)
+			fp := mol.Fingerprint(molecule.FingerprintSize, molecule.FingerprintRadius)
+			mol.Release()
+			if want == nil {
+				want = fp
+				continue
+			}
+			if !reflect.DeepEqual(fp, want) {
+				t.Errorf("%s : fingerprint differs from that of %s", smi, smis[0])
+			}
+		}
+	}
+}
+
+func TestFingerprintConcurrent(t *testing.T) {
+	reg := molecule.NewRegistry()
+	mol := readSmilesIn(t, reg, "CC(=O)Nc1ccc(O)cc1")
+	defer mol.Release()
+
+	want := mol.Fingerprint(molecule.FingerprintSize, molecule.FingerprintRadius)
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if fp := mol.Fingerprint(molecule.FingerprintSize, molecule.FingerprintRadius); !reflect.DeepEqual(fp, want) {
+				t.Error("Fingerprint differs across goroutines.")
+			}
+			if _, err := molecule.Sanitize(mol, 0); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+}
@@ -0,0 +1,708 @@
+package molecule
+
+import (
+	"fmt"
+	"math"
+
+	cmn "github.com/RxnWeaver/rxnweaver/common"
+)
+
+// ForceFieldType selects the force field of `ForceFieldOptions`.
+type ForceFieldType uint8
+
+// Force fields.
+const (
+	ForceFieldAuto   ForceFieldType = iota // MMFF94, or UFF for molecules MMFF94 cannot type.
+	ForceFieldMMFF94                       // MMFF94, or MMFF94s.
+	ForceFieldUFF                          // UFF.
+)
+
+var forceFieldNames = []string{"auto", "MMFF94", "UFF"}
+
+// String answers the name of this force field.
+func (t ForceFieldType) String() string {
+	if int(t) < len(forceFieldNames) {
+		return forceFieldNames[t]
+	}
+	return fmt.Sprintf("ForceFieldType(%d)", t)
+}
+
+// ForceFieldOptions configures the evaluation and minimisation of the
+// energies of conformers.
+type ForceFieldOptions struct {
+	Field         ForceFieldType
+	Static        bool    // Use MMFF94s, whose conjugated nitrogens are planar, rather than MMFF94.
+	Dielectric    float64 // Dielectric constant; `0` means `1`.
+	MaxIterations int     // Of minimisation; `0` means `DefaultMinimiseIterations`.
+	// Minimisation stops when the RMS gradient falls below this, in
+	// kcal/mol/Angstrom; `0` means `DefaultGradientTolerance`.
+	GradientTolerance float64
+}
+
+// Defaults of minimisation.
+const (
+	DefaultMinimiseIterations = 1000
+	DefaultGradientTolerance  = 0.01
+)
+
+// ForceFieldQuery is the payload of `ReqMinimise` and
+// `ReqConformerEnergies`.  An empty list of conformers selects all of
+// them.
+type ForceFieldQuery struct {
+	Options    ForceFieldOptions
+	Conformers []int
+}
+
+// Minimise minimises the energies of the conformers of this molecule
+// with the given IDs, or of all its conformers, if no IDs are given.
+// Their coordinates are replaced, and their energies set.  It answers
+// the conformers so minimised.  The coordinates of the atoms themselves
+// are left as they are.
+//
+// Energies in different force fields are not comparable.  With
+// `ForceFieldAuto`, the force field is determined by the molecule, and
+// is therefore the same for all its conformers.
+//
+// Hydrogens counted in their neighbours are modelled as atoms: they
+// are placed afresh about their neighbours in each conformer, and
+// minimised along with them, but their coordinates are not retained.
+// Hydrogen atoms not so counted are ignored, and keep their
+// coordinates.  All the other atoms must have types in the force field.
+// See `doc/design/forcefield.md`.
+func (m *Molecule) Minimise(opts ForceFieldOptions, ids ...int) ([]Conformer, error) {
+	reply := m.Call(ReqMinimise, ForceFieldQuery{opts, ids})
+	if err := statusError(reply, fmt.Sprintf("molecule %d", m.id)); err != nil {
+		return nil, err
+	}
+	return reply.Payload.([]Conformer), nil
+}
+
+// ConformerEnergies answers the energies, in kcal/mol, of the
+// conformers of this molecule with the given IDs, or of all its
+// conformers, if no IDs are given, by ID.  The conformers are not
+// modified.  The hydrogens counted in their neighbours are placed and
+// minimised as in `Minimise`, with the other atoms held fixed.
+func (m *Molecule) ConformerEnergies(opts ForceFieldOptions, ids ...int) (map[int]float64, error) {
+	reply := m.Call(ReqConformerEnergies, ForceFieldQuery{opts, ids})
+	if err := statusError(reply, fmt.Sprintf("molecule %d", m.id)); err != nil {
+		return nil, err
+	}
+	return reply.Payload.(map[int]float64), nil
+}
+
+// MMFFTypes answers the numeric MMFF94 atom types of the atoms of this
+// molecule, other than hydrogen atoms, by their input IDs.  The types
+// of hydrogens follow from those of their neighbours.
+func (m *Molecule) MMFFTypes() (map[uint16]int, error) {
+	reply := m.Call(ReqMMFFTypes, nil)
+	if err := statusError(reply, fmt.Sprintf("molecule %d", m.id)); err != nil {
+		return nil, err
+	}
+	return reply.Payload.(map[uint16]int), nil
+}
+
+// UFFTypes answers the UFF atom type labels of the atoms of this
+// molecule, other than hydrogen atoms, by their input IDs.
+func (m *Molecule) UFFTypes() (map[uint16]string, error) {
+	reply := m.Call(ReqUFFTypes, nil)
+	if err := statusError(reply, fmt.Sprintf("molecule %d", m.id)); err != nil {
+		return nil, err
+	}
+	return reply.Payload.(map[uint16]string), nil
+}
+
+// _ForceField is a potential energy function of the nodes of a
+// `_FFGraph`.
+type _ForceField interface {
+	// energy answers the energy of the given coordinates, in
+	// kcal/mol.  If the given gradient is not `nil`, the derivatives of
+	// the energy, in kcal/mol/Angstrom, are added to it.
+	energy(x []Point, grad []Point) float64
+
+	// hydrogenGeometry answers the hybridisations of the nodes, and
+	// the ideal lengths of the bonds to hydrogens, by node.
+	hydrogenGeometry() ([]int, []float64)
+}
+
+// newForceField answers the requested force field of the given graph.
+func newForceField(g *_FFGraph, opts ForceFieldOptions) (_ForceField, error) {
+	if opts.Field != ForceFieldUFF {
+		ff, err := newMMFF(g, opts)
+		if err == nil {
+			return ff, nil
+		}
+		if opts.Field == ForceFieldMMFF94 {
+			return nil, err
+		}
+	}
+
+	ff, err := newUFF(g)
+	if err != nil {
+		return nil, err
+	}
+	return ff, nil
+}
+
+// _FFBond is a bond between two nodes of a `_FFGraph`.
+type _FFBond struct {
+	i, j  int
+	isAro bool
+	bType cmn.BondType
+}
+
+// _FFGraph is the graph of a molecule on which a force field is set
+// up.  Its nodes are the atoms of the molecule other than hydrogen
+// atoms, followed by the hydrogens counted in them.
+type _FFGraph struct {
+	mol   *Molecule
+	atoms []*_Atom // For hydrogens, the atoms they are counted in.
+	isH   []bool
+	pos   map[uint16]int // Nodes of the atoms, by input ID.
+	heavy int            // Number of nodes that are atoms.
+	adj   [][]int
+	bonds []_FFBond
+}
+
+// newFFGraph answers the force field graph of the given molecule.
+func newFFGraph(m *Molecule) *_FFGraph {
+	g := &_FFGraph{mol: m, pos: make(map[uint16]int, len(m.atoms))}
+	for _, a := range m.atoms {
+		if a.atNum != 1 {
+			g.pos[a.iId] = len(g.atoms)
+			g.atoms = append(g.atoms, a)
+			g.isH = append(g.isH, false)
+		}
+	}
+	g.heavy = len(g.atoms)
+	g.adj = make([][]int, g.heavy)
+
+	for _, b := range m.bonds {
+		g.addBond(_FFBond{g.pos[b.a1], g.pos[b.a2], b.isAro, b.bType})
+	}
+	for i := 0; i < g.heavy; i++ {
+		a := g.atoms[i]
+		for h := 0; h < int(a.hCount); h++ {
+			g.atoms = append(g.atoms, a)
+			g.isH = append(g.isH, true)
+			g.adj = append(g.adj, nil)
+			g.addBond(_FFBond{i, len(g.atoms) - 1, false, cmn.BondTypeSingle})
+		}
+	}
+	return g
+}
+
+// addBond adds the given bond to this graph.
+func (g *_FFGraph) addBond(b _FFBond) {
+	g.bonds = append(g.bonds, b)
+	g.adj[b.i] = append(g.adj[b.i], b.j)
+	g.adj[b.j] = append(g.adj[b.j], b.i)
+}
+
+// atNum answers the atomic number of the given node.
+func (g *_FFGraph) atNum(n int) uint8 {
+	if g.isH[n] {
+		return 1
+	}
+	return g.atoms[n].atNum
+}
+
+// ringSize answers the size of the smallest ring of at most five atoms
+// containing the given angle, or `0` if there is none.
+func (g *_FFGraph) ringSize(i, j, k int) int {
+	if g.isH[i] || g.isH[j] || g.isH[k] {
+		return 0
+	}
+	return g.mol.ringSize(g.atoms[i].iId, g.atoms[k].iId, 3, g.atoms[j].iId)
+}
+
+// separations answers the numbers of bonds separating the given node
+// from the others within the given number of bonds, by node.
+func (g *_FFGraph) separations(i, max int) map[int]int {
+	sep := map[int]int{i: 0}
+	queue := []int{i}
+	for len(queue) > 0 {
+		n := queue[0]
+		queue = queue[1:]
+		if sep[n] == max {
+			continue
+		}
+		for _, k := range g.adj[n] {
+			if _, ok := sep[k]; !ok {
+				sep[k] = sep[n] + 1
+				queue = append(queue, k)
+			}
+		}
+	}
+	return sep
+}
+
+// coords answers the coordinates of the nodes of this graph in the
+// given conformer.  Hydrogens are placed about their neighbours, at the
+// given distances from them, by node.
+func (g *_FFGraph) coords(c Conformer, sp []int, r0 []float64) []Point {
+	x := make([]Point, len(g.atoms))
+	for i := 0; i < g.heavy; i++ {
+		x[i] = c.Coords[g.atoms[i].iId]
+	}
+
+	for i := 0; i < g.heavy; i++ {
+		hs := make([]int, 0, 4)
+		nbrs := make([]Point, 0, 4)
+		for _, n := range g.adj[i] {
+			if g.isH[n] {
+				hs = append(hs, n)
+			} else {
+				u := sub(x[n], x[i])
+				nbrs = append(nbrs, scale(u, 1/math.Sqrt(dot(u, u))))
+			}
+		}
+		for k, d := range hydrogenDirections(nbrs, len(hs), sp[i], g.otherNeighbour(x, i)) {
+			x[hs[k]] = Point{x[i][0] + r0[hs[k]]*d[0], x[i][1] + r0[hs[k]]*d[1], x[i][2] + r0[hs[k]]*d[2]}
+		}
+	}
+	return x
+}
+
+// otherNeighbour answers the direction from a heavy neighbour of the
+// given node to another of its neighbours, if the node has a single
+// heavy neighbour with others.  It answers the zero vector otherwise.
+func (g *_FFGraph) otherNeighbour(x []Point, i int) Point {
+	n := -1
+	for _, k := range g.adj[i] {
+		if !g.isH[k] {
+			if n >= 0 {
+				return Point{}
+			}
+			n = k
+		}
+	}
+	if n < 0 {
+		return Point{}
+	}
+	for _, k := range g.adj[n] {
+		if k != i && !g.isH[k] {
+			return sub(x[k], x[n])
+		}
+	}
+	return Point{}
+}
+
+// hydrogenDirections answers unit vectors along which to place the
+// given number of hydrogens on a centre of the given hybridisation,
+// having bonds along the given unit vectors.  The reference vector, if
+// not zero, orients hydrogens about a single bond.
+func hydrogenDirections(nbrs []Point, h, sp int, ref Point) []Point {
+	if h == 0 {
+		return nil
+	}
+	if len(nbrs) == 0 {
+		s := 1 / math.Sqrt(3)
+		tetra := []Point{{s, s, s}, {-s, -s, s}, {-s, s, -s}, {s, -s, -s}}
+		if h > 4 {
+			h = 4
+		}
+		return tetra[:h]
+	}
+
+	d := Point{}
+	for _, u := range nbrs {
+		d = sub(d, u)
+	}
+	if dot(d, d) < 1e-8 {
+		d = perpendicular(nbrs[0], Point{})
+	}
+	d = scale(d, 1/math.Sqrt(dot(d, d)))
+
+	// The cone about `d` on which the hydrogens lie.
+	alpha := 0.0
+	p := Point{}
+	switch len(nbrs) {
+	case 1:
+		switch sp {
+		case 1:
+			alpha = 0
+		case 2:
+			alpha = 60
+		default:
+			alpha = 180 - 109.47
+		}
+		p = perpendicular(d, ref)
+	case 2:
+		if sp == 3 {
+			alpha = 54.74
+		}
+		p = perpendicular(d, cross(nbrs[0], nbrs[1]))
+	default:
+		p = perpendicular(d, Point{})
+	}
+	q := cross(d, p)
+
+	res := make([]Point, h)
+	a := alpha * math.Pi / 180
+	for k := range res {
+		phi := 2 * math.Pi * float64(k) / float64(h)
+		for c := 0; c < 3; c++ {
+			res[k][c] = math.Cos(a)*d[c] + math.Sin(a)*(math.Cos(phi)*p[c]+math.Sin(phi)*q[c])
+		}
+	}
+	return res
+}
+
+// perpendicular answers a unit vector perpendicular to the given unit
+// vector: the component of the given reference perpendicular to it,
+// if not negligible, or else an arbitrary one.
+func perpendicular(d, ref Point) Point {
+	p := sub(ref, scale(d, dot(ref, d)))
+	if dot(p, p) < 1e-8 {
+		p = cross(d, Point{1, 0, 0})
+		if dot(p, p) < 1e-8 {
+			p = cross(d, Point{0, 1, 0})
+		}
+	}
+	return scale(p, 1/math.Sqrt(dot(p, p)))
+}
+
+// scale answers the given vector scaled by the given factor.
+func scale(p Point, s float64) Point {
+	return Point{s * p[0], s * p[1], s * p[2]}
+}
+
+// selectConformers answers the positions of the conformers with the
+// given IDs, or of all the conformers if no IDs are given.
+func (m *Molecule) selectConformers(ids []int) ([]int, StatusType) {
+	if len(ids) == 0 {
+		idxs := make([]int, len(m.conformers))
+		for i := range idxs {
+			idxs[i] = i
+		}
+		return idxs, StSuccess
+	}
+
+	idxs := make([]int, 0, len(ids))
+	for _, id := range ids {
+		i := m.conformerIndex(id)
+		if i < 0 {
+			return nil, StNotFound
+		}
+		idxs = append(idxs, i)
+	}
+	return idxs, StSuccess
+}
+
+// minimiseConformer answers the coordinates of the nodes of the given
+// graph in the given conformer, minimised in the given force field,
+// and their energy.  Only the hydrogens are moved, unless asked for
+// otherwise.
+func minimiseConformer(g *_FFGraph, ff _ForceField, c Conformer, opts ForceFieldOptions, all bool) ([]Point, float64) {
+	iters := opts.MaxIterations
+	if iters <= 0 {
+		iters = DefaultMinimiseIterations
+	}
+	tol := opts.GradientTolerance
+	if tol <= 0 {
+		tol = DefaultGradientTolerance
+	}
+
+	sp, r0 := ff.hydrogenGeometry()
+	x := g.coords(c, sp, r0)
+	fixed := make([]bool, len(x))
+	for i := 0; i < g.heavy; i++ {
+		fixed[i] = true
+	}
+	e := minimiseCG(ff, x, fixed, iters, tol)
+	if all {
+		e = minimiseCG(ff, x, nil, iters, tol)
+	}
+	return x, e
+}
+
+// handleMinimise minimises the energies of the requested conformers.
+func (m *Molecule) handleMinimise(p interface{}) (StatusType, interface{}) {
+	q, ok := p.(ForceFieldQuery)
+	if !ok {
+		return StIncorrectParameter, nil
+	}
+	idxs, st := m.selectConformers(q.Conformers)
+	if st != StSuccess {
+		return st, nil
+	}
+	g := newFFGraph(m)
+	ff, err := newForceField(g, q.Options)
+	if err != nil {
+		return StIncorrectParameter, err
+	}
+
+	confs := append([]Conformer(nil), m.conformers...)
+	res := make([]Conformer, 0, len(idxs))
+	for _, i := range idxs {
+		c := confs[i]
+		x, e := minimiseConformer(g, ff, c, q.Options, true)
+
+		coords := make(map[uint16]Point, len(c.Coords))
+		for iid, pt := range c.Coords {
+			coords[iid] = pt
+		}
+		for k := 0; k < g.heavy; k++ {
+			coords[g.atoms[k].iId] = x[k]
+		}
+		c.Coords = coords
+		c.Energy, c.HasEnergy = e, true
+		confs[i] = c
+		res = append(res, c)
+	}
+	m.conformers = confs
+
+	return StSuccess, res
+}
+
+// handleConformerEnergies answers the energies of the requested
+// conformers.
+func (m *Molecule) handleConformerEnergies(p interface{}) (StatusType, interface{}) {
+	q, ok := p.(ForceFieldQuery)
+	if !ok {
+		return StIncorrectParameter, nil
+	}
+	idxs, st := m.selectConformers(q.Conformers)
+	if st != StSuccess {
+		return st, nil
+	}
+	g := newFFGraph(m)
+	ff, err := newForceField(g, q.Options)
+	if err != nil {
+		return StIncorrectParameter, err
+	}
+
+	res := make(map[int]float64, len(idxs))
+	for _, i := range idxs {
+		c := m.conformers[i]
+		_, res[c.Id] = minimiseConformer(g, ff, c, q.Options, false)
+	}
+	return StSuccess, res
+}
+
+// handleMMFFTypes answers the MMFF94 types of the atoms of this
+// molecule.
+func (m *Molecule) handleMMFFTypes(p interface{}) (StatusType, interface{}) {
+	g := newFFGraph(m)
+	types, err := mmffTypes(g)
+	if err != nil {
+		return StIncorrectParameter, err
+	}
+
+	res := make(map[uint16]int, g.heavy)
+	for i := 0; i < g.heavy; i++ {
+		res[g.atoms[i].iId] = types[i]
+	}
+	return StSuccess, res
+}
+
+// handleUFFTypes answers the UFF types of the atoms of this molecule.
+func (m *Molecule) handleUFFTypes(p interface{}) (StatusType, interface{}) {
+	g := newFFGraph(m)
+	types, err := uffTypes(g)
+	if err != nil {
+		return StIncorrectParameter, err
+	}
+
+	res := make(map[uint16]string, g.heavy)
+	for i := 0; i < g.heavy; i++ {
+		res[g.atoms[i].iId] = types[i]
+	}
+	return StSuccess, res
+}
+
+// minimiseCG minimises the energy of the given coordinates in place, by
+// the Polak-Ribière conjugate gradient method.  The nodes marked as
+// fixed, if any, are not moved.  It stops after the given number of
+// iterations, or when the RMS gradient falls below the given
+// tolerance.  It answers the final energy.
+func minimiseCG(ff _ForceField, x []Point, fixed []bool, maxIter int, tol float64) float64 {
+	n := len(x)
+	eval := func(x, grad []Point) float64 {
+		for i := range grad {
+			grad[i] = Point{}
+		}
+		e := ff.energy(x, grad)
+		for i, f := range fixed {
+			if f {
+				grad[i] = Point{}
+			}
+		}
+		return e
+	}
+
+	grad := make([]Point, n)
+	e := eval(x, grad)
+	dir := make([]Point, n)
+	for i := range dir {
+		dir[i] = scale(grad[i], -1)
+	}
+
+	trial := make([]Point, n)
+	tgrad := make([]Point, n)
+	step := 0.01
+	for iter := 0; iter < maxIter; iter++ {
+		gg := pointsDot(grad, grad)
+		if math.Sqrt(gg/float64(3*n)) < tol {
+			break
+		}
+
+		// Restart along the steepest descent if the direction does not
+		// lead downhill.
+		slope := pointsDot(grad, dir)
+		if slope >= 0 {
+			for i := range dir {
+				dir[i] = scale(grad[i], -1)
+			}
+			slope = -gg
+		}
+
+		// Backtrack until the Armijo condition holds.  No atom moves
+		// more than a tenth of an Angstrom in a trial.
+		dmax := 0.0
+		for _, d := range dir {
+			dmax = math.Max(dmax, math.Sqrt(dot(d, d)))
+		}
+		alpha := math.Min(2*step, 0.1/dmax)
+		te := 0.0
+		for ; alpha > 1e-12; alpha *= 0.5 {
+			for i := range x {
+				for c := 0; c < 3; c++ {
+					trial[i][c] = x[i][c] + alpha*dir[i][c]
+				}
+			}
+			te = eval(trial, tgrad)
+			if te <= e+1e-4*alpha*slope {
+				break
+			}
+		}
+		if alpha <= 1e-12 {
+			break
+		}
+		step = alpha
+
+		converged := e-te < 1e-10*math.Max(1, math.Abs(e))
+		copy(x, trial)
+		e = te
+
+		beta := (pointsDot(tgrad, tgrad) - pointsDot(tgrad, grad)) / gg
+		if beta < 0 {
+			beta = 0
+		}
+		for i := range dir {
+			for c := 0; c < 3; c++ {
+				dir[i][c] = -tgrad[i][c] + beta*dir[i][c]
+			}
+		}
+		grad, tgrad = tgrad, grad
+		if converged {
+			break
+		}
+	}
+	return e
+}
+
+// pointsDot answers the scalar product of the given lists of vectors,
+// taken as single vectors.
+func pointsDot(p, q []Point) float64 {
+	s := 0.0
+	for i := range p {
+		s += dot(p[i], q[i])
+	}
+	return s
+}
+
+// addScaled adds the given vector, scaled, to the gradient of the given
+// atom.
+func addScaled(grad []Point, i int, g Point, s float64) {
+	for c := 0; c < 3; c++ {
+		grad[i][c] += s * g[c]
+	}
+}
+
+// addPairGradient adds the gradient of a term depending on the distance
+// between the given atoms, whose difference vector is `d`.  The scale
+// is the derivative of the term with respect to the distance, divided
+// by the distance.
+func addPairGradient(grad []Point, i, j int, d Point, s float64) {
+	for c := 0; c < 3; c++ {
+		grad[i][c] += s * d[c]
+		grad[j][c] -= s * d[c]
+	}
+}
+
+// angleGradient answers the angle, in radians, at `j` between `i` and
+// `k`, and its derivatives with respect to their positions.
+func angleGradient(i, j, k Point) (float64, Point, Point, Point) {
+	u, v := sub(i, j), sub(k, j)
+	lu, lv := math.Sqrt(dot(u, u)), math.Sqrt(dot(v, v))
+	if lu == 0 || lv == 0 {
+		return 0, Point{}, Point{}, Point{}
+	}
+	cos := math.Max(-1, math.Min(1, dot(u, v)/(lu*lv)))
+	sin := math.Max(math.Sqrt(1-cos*cos), 1e-8)
+
+	gi, gk := Point{}, Point{}
+	for c := 0; c < 3; c++ {
+		gi[c] = -(v[c]/lv - cos*u[c]/lu) / (lu * sin)
+		gk[c] = -(u[c]/lu - cos*v[c]/lv) / (lv * sin)
+	}
+	return math.Acos(cos), gi, Point{-gi[0] - gk[0], -gi[1] - gk[1], -gi[2] - gk[2]}, gk
+}
+
+// dihedralGradient answers the dihedral angle, in radians, of `i`-`j`-
+// `k`-`l`, and its derivatives with respect to their positions.
+func dihedralGradient(i, j, k, l Point) (float64, Point, Point, Point, Point) {
+	b1, b2, b3 := sub(j, i), sub(k, j), sub(l, k)
+	n1, n2 := cross(b1, b2), cross(b2, b3)
+	l2 := dot(b2, b2)
+	nn1, nn2 := dot(n1, n1), dot(n2, n2)
+	if l2 == 0 || nn1 == 0 || nn2 == 0 {
+		return 0, Point{}, Point{}, Point{}, Point{}
+	}
+	lb2 := math.Sqrt(l2)
+	phi := math.Atan2(lb2*dot(b1, n2), dot(n1, n2))
+
+	gi, gl := Point{}, Point{}
+	for c := 0; c < 3; c++ {
+		gi[c] = -lb2 / nn1 * n1[c]
+		gl[c] = lb2 / nn2 * n2[c]
+	}
+	f1, f3 := dot(b1, b2)/l2, dot(b3, b2)/l2
+	gj, gk := Point{}, Point{}
+	for c := 0; c < 3; c++ {
+		gj[c] = -(1+f1)*gi[c] + f3*gl[c]
+		gk[c] = -(1+f3)*gl[c] + f1*gi[c]
+	}
+	return phi, gi, gj, gk, gl
+}
+
+// wilsonAngle answers the angle, in radians, between the bond `j`-`l`
+// and the plane of `i`, `j` and `k`.
+func wilsonAngle(i, j, k, l Point) float64 {
+	n := cross(sub(i, j), sub(k, j))
+	d := sub(l, j)
+	nn, dd := math.Sqrt(dot(n, n)), math.Sqrt(dot(d, d))
+	if nn == 0 || dd == 0 {
+		return 0
+	}
+	return math.Asin(math.Max(-1, math.Min(1, dot(n, d)/(nn*dd))))
+}
+
+// numericGradient adds the derivatives of the given term, with respect
+// to the positions of the given atoms, by central differences.  It
+// serves terms whose analytic derivatives are unwieldy.
+func numericGradient(f func(x []Point) float64, x []Point, grad []Point, atoms ...int) {
+	const h = 1e-6
+	for _, a := range atoms {
+		for c := 0; c < 3; c++ {
+			v := x[a][c]
+			x[a][c] = v + h
+			ep := f(x)
+			x[a][c] = v - h
+			em := f(x)
+			x[a][c] = v
+			grad[a][c] += (ep - em) / (2 * h)
+		}
+	}
+}
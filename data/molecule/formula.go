@@ -0,0 +1,111 @@
+package molecule
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strconv"
+
+	cmn "github.com/RxnWeaver/rxnweaver/common"
+)
+
+// ElementCounts answers the elemental composition of this molecule, as
+// a map from atomic number to the number of atoms of that element.
+//
+// Hydrogen atoms are counted using the hydrogen counts of the atoms
+// to which they are attached.  Explicit hydrogen atoms bonded to others
+// are not counted separately, since their bonds are already folded
+// into the hydrogen counts of their neighbours.  Those standing on
+// their own, as in `H2`, or a proton, are counted.
+//
+// The counts are computed by the molecule, through `ReqElementCounts`.
+// A molecule that can not answer, as one that has exited, answers no
+// counts.
+func (m *Molecule) ElementCounts() map[uint8]int {
+	reply := m.Call(ReqElementCounts, nil)
+	if err := statusError(reply, fmt.Sprintf("molecule %d", m.id)); err != nil {
+		return map[uint8]int{}
+	}
+	return reply.Payload.(map[uint8]int)
+}
+
+// elementCounts computes the elemental composition of this molecule.
+// See `ElementCounts`.
+func (m *Molecule) elementCounts() map[uint8]int {
+	if m.cols != nil {
+		return m.cols.elementCounts()
+	}
+
+	counts := make(map[uint8]int)
+	for _, a := range m.atoms {
+		if a.isCountedHydrogen() {
+			continue
+		}
+		counts[a.atNum]++
+		if a.hCount > 0 {
+			counts[1] += int(a.hCount)
+		}
+	}
+
+	return counts
+}
+
+// Weight answers the molecular weight of this molecule, computed using
+// the atomic weights from the periodic table.
+func (m *Molecule) Weight() float64 {
+	return weightOf(m.ElementCounts())
+}
+
+// weightOf answers the molecular weight of the given elemental
+// composition.
+func weightOf(counts map[uint8]int) float64 {
+	w := 0.0
+	for atNum, n := range counts {
+		el := cmn.PeriodicTable[cmn.ElementSymbols[atNum]]
+		w += float64(n) * el.Weight
+	}
+
+	return w
+}
+
+// Formula answers the molecular formula of this molecule, in Hill
+// notation: carbon first, hydrogen next, and then the other elements
+// in alphabetical order of their symbols.  When no carbon is present,
+// all elements are in alphabetical order.
+func (m *Molecule) Formula() string {
+	return formulaOf(m.ElementCounts())
+}
+
+// formulaOf answers the molecular formula of the given elemental
+// composition.  See `Formula`.
+func formulaOf(counts map[uint8]int) string {
+	syms := make([]string, 0, len(counts))
+	for atNum := range counts {
+		syms = append(syms, cmn.ElementSymbols[atNum])
+	}
+	sort.Strings(syms)
+
+	buf := new(bytes.Buffer)
+	write := func(sym string, n int) {
+		buf.WriteString(sym)
+		if n > 1 {
+			buf.WriteString(strconv.Itoa(n))
+		}
+	}
+
+	_, hasC := counts[6]
+	if hasC {
+		write("C", counts[6])
+		if n, ok := counts[1]; ok {
+			write("H", n)
+		}
+	}
+	for _, sym := range syms {
+		if hasC && (sym == "C" || sym == "H") {
+			continue
+		}
+		write(sym, counts[cmn.PeriodicTable[sym].Number])
+	}
+
+	return buf.String()
+}
@@ -0,0 +1,88 @@
+package molecule_test
+
+import (
+	"testing"
+
+	"github.com/RxnWeaver/rxnweaver/data/loader"
+	"github.com/RxnWeaver/rxnweaver/data/molecule"
+)
+
+// readSmiles answers the sanitised passive molecule of the given SMILES
+// string.
+func readSmiles(t *testing.T, smi string) *molecule.Molecule {
+	t.Helper()
+	return readSmilesIn(t, nil, smi)
+}
+
+// readSmilesIn answers the sanitised molecule of the given SMILES
+// string, tracked by the given registry.
+func readSmilesIn(t *testing.T, reg *molecule.MoleculeRegistry, smi string) *molecule.Molecule {
+	t.Helper()
+	mol, err := loader.ReadSmiles(reg, []byte(smi))
+	if err != nil {
+		t.Fatalf("%s : %v", smi, err)
+	}
+	rep, err := molecule.Sanitize(mol, 0)
+	if err == nil && rep.HasErrors() {
+		err = rep
+	}
+	if err != nil {
+		mol.Release()
+		t.Fatalf("%s : %v", smi, err)
+	}
+	return mol
+}
+
+func TestFormula(t *testing.T) {
+	tests := []struct {
+		smi     string
+		formula string
+		weight  float64
+	}{
+		{"C", "CH4", 16.043},
+		{"[H]C([H])([H])[H]", "CH4", 16.043},
+		{"[H]OC", "CH4O", 32.042},
+		{"[H][H]", "H2", 2.016},
+		{"[H+]", "H", 1.008},
+		{"[H-]", "H", 1.008},
+		{"[2H][2H]", "H2", 2.016},
+		{"CC(=O)[O-].[H+]", "C2H4O2", 60.052},
+		{"[Na+].[Cl-]", "ClNa", 58.440},
+	}
+	for _, tt := range tests {
+		mol := readSmiles(t, tt.smi)
+		if f := mol.Formula(); f != tt.formula {
+			t.Errorf("%s : formula %s, want %s", tt.smi, f, tt.formula)
+		}
+		if w := mol.Weight(); w < tt.weight-0.01 || w > tt.weight+0.01 {
+			t.Errorf("%s : weight %.3f, want %.3f", tt.smi, w, tt.weight)
+		}
+		mol.Release()
+	}
+}
+
+func TestWithFormulaConcurrent(t *testing.T) {
+	reg := molecule.NewRegistry()
+	smis := []string{"CCO", "OCC", "CC(=O)O", "[H][H]"}
+	for _, smi := range smis {
+		readSmilesIn(t, reg, smi)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for _, mol := range reg.List() {
+			if _, err := molecule.Sanitize(mol, 0); err != nil {
+				t.Error(err)
+			}
+		}
+	}()
+	got := reg.Filter(molecule.WithFormula("C2H6O"))
+	<-done
+	if len(got) != 2 {
+		t.Errorf("%d molecules of formula C2H6O, want 2", len(got))
+	}
+	for _, mol := range reg.List() {
+		mol.Release()
+	}
+}
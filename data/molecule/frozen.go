@@ -0,0 +1,258 @@
+package molecule
+
+import (
+	"fmt"
+)
+
+// Frozen is an immutable snapshot of a molecule.
+//
+// Its queries are answered directly, in the goroutine of the caller,
+// without going through the event loop of the molecule.  Since nothing
+// can modify it, a frozen molecule is safe for concurrent use by any
+// number of goroutines, without locking.  This suits computing several
+// descriptors and fingerprints of the same molecule in parallel.
+//
+// Changes made to the original molecule after it is frozen are not
+// reflected in its frozen snapshot.
+type Frozen struct {
+	id  uint64    // ID of the original molecule.
+	mol *Molecule // Passive duplicate, never modified.
+}
+
+// frozenRequests holds the requests that a frozen molecule answers.
+// All of them are read-only.
+var frozenRequests = map[RequestType]bool{
+	ReqAtomCount:           true,
+	ReqBondCount:           true,
+	ReqAtomInfo:            true,
+	ReqBondInfo:            true,
+	ReqBondBetween:         true,
+	ReqNeighbours:          true,
+	ReqAtoms:               true,
+	ReqBonds:               true,
+	ReqAttribute:           true,
+	ReqAttributes:          true,
+	ReqAtomAttributes:      true,
+	ReqBondAttributes:      true,
+	ReqProvenance:          true,
+	ReqConformers:          true,
+	ReqConformerRMSD:       true,
+	ReqConformerEnergies:   true,
+	ReqMMFFTypes:           true,
+	ReqUFFTypes:            true,
+	ReqStereoGroups:        true,
+	ReqSgroups:             true,
+	ReqDistance:            true,
+	ReqShortestPath:        true,
+	ReqRingCount:           true,
+	ReqRingInfo:            true,
+	ReqRingRelation:        true,
+	ReqDescriptor:          true,
+	ReqFingerprint:         true,
+	ReqElementCounts:       true,
+	ReqSubstructureMatches: true,
+	ReqHash:                true,
+	ReqCanonicalRanks:      true,
+	ReqValidate:            true,
+	ReqCheck:               true,
+}
+
+// Freeze answers an immutable snapshot of this molecule.
+func (m *Molecule) Freeze() (*Frozen, error) {
+	reply := m.Call(ReqFreeze, nil)
+	if err := statusError(reply, fmt.Sprintf("molecule %d", m.id)); err != nil {
+		return nil, err
+	}
+	return reply.Payload.(*Frozen), nil
+}
+
+// handleFreeze answers an immutable snapshot of this molecule.
+//
+// The distance matrices, otherwise computed lazily, are computed
+// eagerly, so that no query modifies the snapshot.
+func (m *Molecule) handleFreeze(p interface{}) (StatusType, interface{}) {
+	f := &Frozen{id: m.id, mol: m.duplicate(true)}
+	f.mol.ensureDistances()
+	return StSuccess, f
+}
+
+// Id answers the ID of the molecule of which this is a snapshot.
+func (f *Frozen) Id() uint64 {
+	return f.id
+}
+
+// Call answers the reply to the given read-only request, with the
+// given payload, as the original molecule would have at the time of
+// freezing.  Requests that could modify a molecule fail with
+// `StUnknownRequest`.
+func (f *Frozen) Call(req RequestType, payload interface{}) OutMessage {
+	if !frozenRequests[req] {
+		return OutMessage{StUnknownRequest, 0, newRequestError(req, StUnknownRequest, fmt.Errorf("Frozen molecules are read-only."))}
+	}
+
+	st, res := f.mol.dispatch(InMessage{Request: req, Payload: payload})
+	if st != StSuccess {
+		res = newRequestError(req, st, res)
+	}
+	return OutMessage{st, 0, res}
+}
+
+// AtomCount answers the number of atoms in this molecule.
+func (f *Frozen) AtomCount() int {
+	return len(f.mol.atoms)
+}
+
+// BondCount answers the number of bonds in this molecule.
+func (f *Frozen) BondCount() int {
+	return len(f.mol.bonds)
+}
+
+// RingCount answers the number of rings in this molecule.
+func (f *Frozen) RingCount() int {
+	return len(f.mol.rings)
+}
+
+// AtomInfo answers a snapshot of the atom with the given input ID.
+func (f *Frozen) AtomInfo(iid uint16) (AtomInfo, error) {
+	reply := f.Call(ReqAtomInfo, AtomQuery{iid})
+	if err := statusError(reply, fmt.Sprintf("atom %d", iid)); err != nil {
+		return AtomInfo{}, err
+	}
+	return reply.Payload.(AtomInfo), nil
+}
+
+// BondInfo answers a snapshot of the bond with the given ID.
+func (f *Frozen) BondInfo(id uint16) (BondInfo, error) {
+	reply := f.Call(ReqBondInfo, BondQuery{id})
+	if err := statusError(reply, fmt.Sprintf("bond %d", id)); err != nil {
+		return BondInfo{}, err
+	}
+	return reply.Payload.(BondInfo), nil
+}
+
+// BondBetween answers a snapshot of the bond between the atoms with
+// the given input IDs.
+func (f *Frozen) BondBetween(a1, a2 uint16) (BondInfo, error) {
+	reply := f.Call(ReqBondBetween, AtomPair{a1, a2})
+	if err := statusError(reply, fmt.Sprintf("bond between atoms %d and %d", a1, a2)); err != nil {
+		return BondInfo{}, err
+	}
+	return reply.Payload.(BondInfo), nil
+}
+
+// Neighbours answers the distinct neighbours of the atom with the
+// given input ID, along with the bonds to them.
+func (f *Frozen) Neighbours(iid uint16) ([]Neighbour, error) {
+	reply := f.Call(ReqNeighbours, AtomQuery{iid})
+	if err := statusError(reply, fmt.Sprintf("atom %d", iid)); err != nil {
+		return nil, err
+	}
+	return reply.Payload.([]Neighbour), nil
+}
+
+// Distance answers the topological distance between the atoms with
+// the given input IDs, or `-1` if they are not connected.
+func (f *Frozen) Distance(a1, a2 uint16) (int, error) {
+	reply := f.Call(ReqDistance, AtomPair{a1, a2})
+	if err := statusError(reply, fmt.Sprintf("atoms %d and %d", a1, a2)); err != nil {
+		return -1, err
+	}
+	return reply.Payload.(int), nil
+}
+
+// ShortestPath answers the input IDs of the atoms on a shortest path
+// between the atoms with the given input IDs, both inclusive.
+func (f *Frozen) ShortestPath(a1, a2 uint16) ([]uint16, error) {
+	reply := f.Call(ReqShortestPath, AtomPair{a1, a2})
+	if err := statusError(reply, fmt.Sprintf("path between atoms %d and %d", a1, a2)); err != nil {
+		return nil, err
+	}
+	return reply.Payload.([]uint16), nil
+}
+
+// Atoms answers an iterator over the atoms of this molecule that
+// satisfy all of the given predicates.  See `Molecule.Atoms`.
+func (f *Frozen) Atoms(preds ...AtomPredicate) *AtomIterator {
+	reply := f.Call(ReqAtoms, preds)
+	if err := statusError(reply, fmt.Sprintf("molecule %d", f.id)); err != nil {
+		return &AtomIterator{err: err}
+	}
+	return &AtomIterator{atoms: reply.Payload.([]AtomInfo)}
+}
+
+// Bonds answers an iterator over the bonds of this molecule that
+// satisfy all of the given predicates.  See `Molecule.Bonds`.
+func (f *Frozen) Bonds(preds ...BondPredicate) *BondIterator {
+	reply := f.Call(ReqBonds, preds)
+	if err := statusError(reply, fmt.Sprintf("molecule %d", f.id)); err != nil {
+		return &BondIterator{err: err}
+	}
+	return &BondIterator{bonds: reply.Payload.([]BondInfo)}
+}
+
+// Attributes answers all the attributes of this molecule, in the order
+// of their addition.
+func (f *Frozen) Attributes() []Attribute {
+	_, res := f.mol.handleAttributes(nil)
+	return res.([]Attribute)
+}
+
+// Attribute answers the attribute of this molecule with the given
+// name.  See `Molecule.Attribute`.
+func (f *Frozen) Attribute(name string) (Attribute, error) {
+	reply := f.Call(ReqAttribute, name)
+	if err := statusError(reply, fmt.Sprintf("attribute %s", name)); err != nil {
+		return Attribute{}, err
+	}
+	return reply.Payload.(Attribute), nil
+}
+
+// Provenance answers the provenance of this molecule.
+func (f *Frozen) Provenance() Provenance {
+	return f.mol.provenance()
+}
+
+// Conformers answers the conformers of this molecule, in the order of
+// their addition.
+func (f *Frozen) Conformers() []Conformer {
+	return append([]Conformer(nil), f.mol.conformers...)
+}
+
+// Descriptor answers the value of the named descriptor of this
+// molecule.  See `DescriptorNames` for the names understood.
+func (f *Frozen) Descriptor(name string) (float64, error) {
+	reply := f.Call(ReqDescriptor, DescriptorQuery{name})
+	if err := statusError(reply, fmt.Sprintf("descriptor %s", name)); err != nil {
+		return 0, err
+	}
+	return reply.Payload.(DescriptorValue).Value, nil
+}
+
+// Hash answers the 64-bit structure hash of this molecule.  See
+// `Molecule.Hash128`.
+func (f *Frozen) Hash(opts HashOptions) uint64 {
+	h, _ := f.mol.Hash(opts)
+	return h
+}
+
+// Fingerprint answers the circular fingerprint of this molecule.  See
+// `Molecule.Fingerprint`.
+func (f *Frozen) Fingerprint(size, radius int) []int32 {
+	return f.mol.fingerprint(size, radius)
+}
+
+// ElementCounts answers the elemental composition of this molecule.
+// See `Molecule.ElementCounts`.
+func (f *Frozen) ElementCounts() map[uint8]int {
+	return f.mol.elementCounts()
+}
+
+// Weight answers the molecular weight of this molecule.
+func (f *Frozen) Weight() float64 {
+	return weightOf(f.mol.elementCounts())
+}
+
+// Formula answers the molecular formula of this molecule.
+func (f *Frozen) Formula() string {
+	return formulaOf(f.mol.elementCounts())
+}
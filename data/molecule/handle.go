@@ -0,0 +1,108 @@
+package molecule
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+)
+
+// Handle is a counted reference to a molecule.  The molecule is
+// released, as by `Molecule.Release`, when its last handle is
+// released, so that its goroutine and storage are reclaimed without
+// any one agent having to know that it is the last user.
+//
+// A molecule created by `New` is not counted until its first handle is
+// acquired; thereafter, it belongs to its handles, and should not be
+// released directly.  The idiom, therefore, is as follows.
+//
+//	h := molecule.NewHandle()
+//	defer h.Release()
+//	mol := h.Molecule()
+//	...
+//	h2, err := mol.Acquire() // For another agent, which releases it.
+//
+// Each handle is released once; releasing it again has no effect.
+// Handles are safe for concurrent use.
+type Handle struct {
+	mol      *Molecule
+	released int32 // Set atomically upon release.
+}
+
+// NewHandle creates a molecule tracked by the default registry,
+// configured with the given options, and answers its first handle.
+func NewHandle(opts ...Option) *Handle {
+	return AllMolecules.NewHandle(opts...)
+}
+
+// NewHandle creates a molecule tracked by this registry, configured
+// with the given options, and answers its first handle.
+func (reg *MoleculeRegistry) NewHandle(opts ...Option) *Handle {
+	mol := initMolecule(reg, opts)
+	mol.refs = 1
+	mol.start(context.Background())
+	return &Handle{mol: mol}
+}
+
+// Acquire answers a new handle to this molecule, counting it.  Should
+// this molecule have exited, or have been released by its last handle,
+// an error is answered instead.
+func (m *Molecule) Acquire() (*Handle, error) {
+	for {
+		n := atomic.LoadInt64(&m.refs)
+		if n < 0 {
+			return nil, fmt.Errorf("Molecule %d has been released.", m.id)
+		}
+		select {
+		case <-m.done:
+			return nil, fmt.Errorf("Molecule %d has exited.", m.id)
+		default:
+		}
+		if atomic.CompareAndSwapInt64(&m.refs, n, n+1) {
+			return &Handle{mol: m}, nil
+		}
+	}
+}
+
+// Refs answers the number of handles to this molecule that are yet to
+// be released, or `0` if it is not counted.
+func (m *Molecule) Refs() int {
+	n := atomic.LoadInt64(&m.refs)
+	if n < 0 {
+		return 0
+	}
+	return int(n)
+}
+
+// Molecule answers the molecule of this handle.  It may not be used
+// after this handle is released, unless other handles to it remain.
+func (h *Handle) Molecule() *Molecule {
+	return h.mol
+}
+
+// Acquire answers another handle to the molecule of this handle.  See
+// `Molecule.Acquire`.
+func (h *Handle) Acquire() (*Handle, error) {
+	if atomic.LoadInt32(&h.released) != 0 {
+		return nil, fmt.Errorf("Handle to molecule %d has been released.", h.mol.id)
+	}
+	return h.mol.Acquire()
+}
+
+// Release releases this handle.  Should it be the last handle to its
+// molecule, the molecule is released too, and this waits until it has
+// exited.
+func (h *Handle) Release() {
+	if !atomic.CompareAndSwapInt32(&h.released, 0, 1) {
+		return
+	}
+
+	m := h.mol
+	if atomic.AddInt64(&m.refs, -1) > 0 {
+		return
+	}
+	// A handle may be acquired concurrently, reviving the molecule; the
+	// count is marked reclaimed only if it is still zero.
+	if atomic.CompareAndSwapInt64(&m.refs, 0, -1) {
+		m.Release()
+	}
+}
@@ -0,0 +1,337 @@
+package molecule
+
+// descriptors maps the names of the descriptors a molecule can compute
+// to the functions computing them.
+var descriptors = map[string]func(m *Molecule) float64{
+	"atom-count": func(m *Molecule) float64 {
+		return float64(len(m.atoms))
+	},
+	"heavy-atom-count": func(m *Molecule) float64 {
+		if m.cols != nil {
+			return float64(m.cols.heavyAtomCount())
+		}
+
+		c := 0
+		for _, a := range m.atoms {
+			if a.atNum != 1 {
+				c++
+			}
+		}
+		return float64(c)
+	},
+	"bond-count": func(m *Molecule) float64 {
+		return float64(len(m.bonds))
+	},
+	"single-bond-count": func(m *Molecule) float64 {
+		return float64(m.singleBondCount())
+	},
+	"double-bond-count": func(m *Molecule) float64 {
+		return float64(m.doubleBondCount())
+	},
+	"triple-bond-count": func(m *Molecule) float64 {
+		return float64(m.tripleBondCount())
+	},
+	"ring-count": func(m *Molecule) float64 {
+		return float64(len(m.rings))
+	},
+	"aromatic-ring-count": func(m *Molecule) float64 {
+		return float64(m.aromaticRingCount())
+	},
+	"aromatic-ring-system-count": func(m *Molecule) float64 {
+		return float64(m.aromaticRingSystemCount())
+	},
+	"weight": func(m *Molecule) float64 {
+		return weightOf(m.elementCounts())
+	},
+	"chiral": func(m *Molecule) float64 {
+		if units, symmetric := m.mirrorSymmetry(m.canonicalClasses(HashIsotopes)); units > 0 && !symmetric {
+			return 1
+		}
+		return 0
+	},
+	"meso": func(m *Molecule) float64 {
+		if units, symmetric := m.mirrorSymmetry(m.canonicalClasses(HashIsotopes)); units > 1 && symmetric {
+			return 1
+		}
+		return 0
+	},
+}
+
+// DescriptorNames answers the names of the descriptors understood by
+// `ReqDescriptor`.
+func DescriptorNames() []string {
+	names := make([]string, 0, len(descriptors))
+	for n := range descriptors {
+		names = append(names, n)
+	}
+	return names
+}
+
+// handleAddAtom adds the atom built by the given builder to this
+// molecule.
+func (m *Molecule) handleAddAtom(p interface{}) (StatusType, interface{}) {
+	ab, ok := p.(*AtomBuilder)
+	if !ok || ab.a == nil || ab.mol != m {
+		return StIncorrectParameter, nil
+	}
+
+	if m.atomWithIid(ab.a.iId) != nil {
+		return StAlreadyExists, nil
+	}
+	if err := m.addAtom(ab.a); err != nil {
+		return StIncorrectParameter, err
+	}
+
+	m.distancesAtomAdded(ab.a)
+	m.publish(EvAtomAdded, ab.a.iId, 0)
+	m.invalidate()
+	ab.a = nil
+	return StSuccess, nil
+}
+
+// handleAddBond adds the bond built by the given builder to this
+// molecule.
+func (m *Molecule) handleAddBond(p interface{}) (StatusType, interface{}) {
+	bb, ok := p.(*BondBuilder)
+	if !ok || bb.b == nil || bb.mol != m {
+		return StIncorrectParameter, nil
+	}
+
+	if m.bondWithId(bb.b.id) != nil || m.bondBetween(bb.b.a1, bb.b.a2) != nil {
+		return StAlreadyExists, nil
+	}
+	if err := m.addBond(bb.b); err != nil {
+		return StIncorrectParameter, err
+	}
+
+	m.distancesBondAdded(bb.b)
+	m.publish(EvBondAdded, 0, bb.b.id)
+	m.invalidate()
+	bb.b = nil
+	return StSuccess, nil
+}
+
+// handleAddTag adds the given attribute to this molecule.
+func (m *Molecule) handleAddTag(p interface{}) (StatusType, interface{}) {
+	attr, ok := p.(Attribute)
+	if !ok || attr.Name == "" {
+		return StIncorrectParameter, nil
+	}
+
+	m.attributes = append(m.attributes, attr)
+	m.publish(EvTagAdded, 0, 0)
+	return StSuccess, nil
+}
+
+// handleAtomInfo answers a snapshot of the requested atom.
+func (m *Molecule) handleAtomInfo(p interface{}) (StatusType, interface{}) {
+	q, ok := p.(AtomQuery)
+	if !ok {
+		return StIncorrectParameter, nil
+	}
+
+	a := m.atomWithIid(q.Iid)
+	if a == nil {
+		return StNotFound, nil
+	}
+	return StSuccess, a.info()
+}
+
+// handleBondInfo answers a snapshot of the requested bond.
+func (m *Molecule) handleBondInfo(p interface{}) (StatusType, interface{}) {
+	q, ok := p.(BondQuery)
+	if !ok {
+		return StIncorrectParameter, nil
+	}
+
+	b := m.bondWithId(q.Id)
+	if b == nil {
+		return StNotFound, nil
+	}
+	return StSuccess, b.info()
+}
+
+// handleBondBetween answers a snapshot of the bond between the
+// requested pair of atoms.
+func (m *Molecule) handleBondBetween(p interface{}) (StatusType, interface{}) {
+	q, ok := p.(AtomPair)
+	if !ok {
+		return StIncorrectParameter, nil
+	}
+
+	b := m.bondBetween(q.A1, q.A2)
+	if b == nil {
+		return StNotFound, nil
+	}
+	return StSuccess, b.info()
+}
+
+// handleNeighbours answers the distinct neighbours of the requested
+// atom, along with the bonds to them.
+func (m *Molecule) handleNeighbours(p interface{}) (StatusType, interface{}) {
+	q, ok := p.(AtomQuery)
+	if !ok {
+		return StIncorrectParameter, nil
+	}
+
+	a := m.atomWithIid(q.Iid)
+	if a == nil {
+		return StNotFound, nil
+	}
+	return StSuccess, m.neighbours(a)
+}
+
+// handleRingInfo answers a snapshot of the requested ring.
+func (m *Molecule) handleRingInfo(p interface{}) (StatusType, interface{}) {
+	q, ok := p.(RingQuery)
+	if !ok {
+		return StIncorrectParameter, nil
+	}
+
+	r := m.ringWithId(q.Id)
+	if r == nil {
+		return StNotFound, nil
+	}
+
+	ri := RingInfo{Id: r.id, IsAromatic: r.isAro}
+	ri.Atoms = append([]uint16{}, r.atoms...)
+	ri.Bonds = append([]uint16{}, r.bonds...)
+	return StSuccess, ri
+}
+
+// handleDescriptor computes the requested descriptor.
+func (m *Molecule) handleDescriptor(p interface{}) (StatusType, interface{}) {
+	q, ok := p.(DescriptorQuery)
+	if !ok {
+		return StIncorrectParameter, nil
+	}
+
+	f, ok := descriptors[q.Name]
+	if !ok {
+		return StNotFound, nil
+	}
+	return StSuccess, DescriptorValue{q.Name, f(m)}
+}
+
+// handleFingerprint computes the requested fingerprint.
+func (m *Molecule) handleFingerprint(p interface{}) (StatusType, interface{}) {
+	q, ok := p.(FingerprintQuery)
+	if !ok || q.Size <= 0 || q.Radius < 0 {
+		return StIncorrectParameter, nil
+	}
+
+	return StSuccess, m.fingerprint(q.Size, q.Radius)
+}
+
+// handleDistance answers the topological distance between the
+// requested pair of atoms.
+func (m *Molecule) handleDistance(p interface{}) (StatusType, interface{}) {
+	q, ok := p.(AtomPair)
+	if !ok {
+		return StIncorrectParameter, nil
+	}
+
+	if m.atomWithIid(q.A1) == nil || m.atomWithIid(q.A2) == nil {
+		return StNotFound, nil
+	}
+	return StSuccess, m.distance(q.A1, q.A2)
+}
+
+// handleShortestPath answers the atoms on a shortest path between the
+// requested pair of atoms.
+func (m *Molecule) handleShortestPath(p interface{}) (StatusType, interface{}) {
+	q, ok := p.(AtomPair)
+	if !ok {
+		return StIncorrectParameter, nil
+	}
+
+	if m.atomWithIid(q.A1) == nil || m.atomWithIid(q.A2) == nil {
+		return StNotFound, nil
+	}
+
+	path := m.shortestPath(q.A1, q.A2)
+	if path == nil {
+		return StNotFound, nil
+	}
+	return StSuccess, path
+}
+
+// handleSetAtomCharge sets the residual charge of the requested atom.
+func (m *Molecule) handleSetAtomCharge(p interface{}) (StatusType, interface{}) {
+	q, ok := p.(AtomCharge)
+	if !ok {
+		return StIncorrectParameter, nil
+	}
+
+	a := m.atomWithIid(q.Iid)
+	if a == nil {
+		return StNotFound, nil
+	}
+
+	m.setAtomCharge(a, q.Charge)
+	m.publish(EvAtomChanged, a.iId, 0)
+	m.invalidate()
+	return StSuccess, nil
+}
+
+// handleSetAtomHCount sets the hydrogen count of the requested atom.
+func (m *Molecule) handleSetAtomHCount(p interface{}) (StatusType, interface{}) {
+	q, ok := p.(AtomHCount)
+	if !ok {
+		return StIncorrectParameter, nil
+	}
+
+	a := m.atomWithIid(q.Iid)
+	if a == nil {
+		return StNotFound, nil
+	}
+
+	m.setAtomHCount(a, q.HCount)
+	m.publish(EvAtomChanged, a.iId, 0)
+	m.invalidate()
+	return StSuccess, nil
+}
+
+// handleSetAttachment sets the attachment points of the requested
+// atom.
+func (m *Molecule) handleSetAttachment(p interface{}) (StatusType, interface{}) {
+	q, ok := p.(AtomAttachment)
+	if !ok || q.Points > 3 {
+		return StIncorrectParameter, nil
+	}
+
+	a := m.atomWithIid(q.Iid)
+	if a == nil {
+		return StNotFound, nil
+	}
+
+	a.attachment = q.Points
+	m.publish(EvAtomChanged, a.iId, 0)
+	m.invalidate()
+	return StSuccess, nil
+}
+
+// handleSetBondType sets the order of the requested bond, and updates
+// the bond counts and neighbour lists of its atoms.
+func (m *Molecule) handleSetBondType(p interface{}) (StatusType, interface{}) {
+	q, ok := p.(BondTypeEdit)
+	if !ok || !isValidBondType(q.Type) {
+		return StIncorrectParameter, nil
+	}
+
+	b := m.bondWithId(q.Id)
+	if b == nil {
+		return StNotFound, nil
+	}
+
+	a1 := m.atomWithIid(b.a1)
+	a2 := m.atomWithIid(b.a2)
+	a1.removeBond(b)
+	a2.removeBond(b)
+	b.setType(q.Type)
+	a1.addBond(b)
+	a2.addBond(b)
+	m.publish(EvBondChanged, 0, b.id)
+	m.invalidate()
+	return StSuccess, nil
+}
@@ -0,0 +1,480 @@
+package molecule
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/fnv"
+	"sort"
+
+	cmn "github.com/RxnWeaver/rxnweaver/common"
+)
+
+// HashOptions selects the optional layers of information included in a
+// structure hash.  See `Molecule.Hash`.
+type HashOptions uint8
+
+// Constants representing the optional layers of structure hashes.
+const (
+	HashStereo       HashOptions = 1 << iota // Configurations of stereocentres, bonds and axes, and stereo groups.
+	HashIsotopes                             // Mass numbers of atoms.
+	HashIsotopeSites                         // Deuterium and tritium of the hydrogens of each atom.
+)
+
+// MolHash is a 128-bit structure hash.
+type MolHash [16]byte
+
+// String answers the hexadecimal form of this hash.
+func (h MolHash) String() string {
+	return fmt.Sprintf("%x", h[:])
+}
+
+// Hash answers a 64-bit hash of the structure of this molecule, with
+// the given optional layers.  See `Hash128`.
+func (m *Molecule) Hash(opts HashOptions) (uint64, error) {
+	h, err := m.Hash128(opts)
+	if err != nil {
+		return 0, err
+	}
+	return binary.BigEndian.Uint64(h[:8]) ^ binary.BigEndian.Uint64(h[8:]), nil
+}
+
+// Hash128 answers a 128-bit hash of the structure of this molecule,
+// with the given optional layers.
+//
+// The hash is independent of the order of the atoms and bonds, and of
+// their IDs.  It is also stable across processes and releases, so it
+// can be persisted.  Its basis is a canonical labelling of the atoms,
+// by iterative refinement of their invariants (Morgan's algorithm):
+// element, charge, hydrogen count, radical and, optionally, isotope.
+// The hash covers the resulting multiset of atom classes, and that of
+// bonds between classes, with their types and, optionally, stereo
+// configurations.  Aromatic bonds are of a type of their own, whatever
+// their Kekulé types, so that the Kekulé forms of a molecule hash
+// alike; the hashes of aromatic molecules thus differ from those of
+// releases that hashed aromatic bonds by their Kekulé types, and
+// stores keyed by such hashes should be rebuilt.  The configurations of stereocentres and double
+// bonds, as determined by sanitisation, are covered by their CIP
+// descriptors, which do not depend on how they are drawn; thus, a meso compound hashes alike
+// however its mirror-related halves are drawn.  The stereo layer also
+// covers the `AND` and `OR` stereo groups, by the classes of their
+// atoms, and the cis/trans relations of ring substituents; see
+// `StereoGroup` and `RingRelation`.
+//
+// Hydrogen atoms without neighbours, counted in the hydrogen counts of
+// their former neighbours, are hashed through those counts alone, so
+// that `[H]C([H])([H])[H]` hashes as `C`; see `BondBuilder.Atoms`.
+//
+// The layers select how isotopologues compare.  Without the isotope
+// layer, they hash alike: mass numbers are ignored, so that a labelled
+// standard, such as a `d6` or a `13C` one, hashes as its unlabelled
+// parent.  With it, they hash apart, by their mass numbers and their
+// counts of isotopic hydrogens, the counted ones among them; the
+// isotope sites layer further tells apart those bearing their
+// isotopic hydrogens at different atoms, as `CD3-CH2-OH` and
+// `CH3-CD2-OH`.
+//
+// Structures having different hashes are certainly different.  Equal
+// hashes imply identical structures, except for rare, highly
+// symmetric graphs that such refinement does not distinguish, and
+// hash collisions.  Sets keyed by hashes should, therefore, confirm
+// identity by other means where that matters.
+func (m *Molecule) Hash128(opts HashOptions) (MolHash, error) {
+	reply := m.Call(ReqHash, opts)
+	if err := statusError(reply, fmt.Sprintf("molecule %d", m.id)); err != nil {
+		return MolHash{}, err
+	}
+	return reply.Payload.(MolHash), nil
+}
+
+// handleHash answers the structure hash of this molecule, with the
+// given optional layers.
+func (m *Molecule) handleHash(p interface{}) (StatusType, interface{}) {
+	opts, ok := p.(HashOptions)
+	if !ok && p != nil {
+		return StIncorrectParameter, nil
+	}
+	return StSuccess, m.structureHash(opts)
+}
+
+// structureHash computes the structure hash of this molecule.  See
+// `Hash128`.
+func (m *Molecule) structureHash(opts HashOptions) MolHash {
+	cls := m.canonicalClasses(opts)
+
+	atoms := make([]uint64, 0, len(m.atoms))
+	for _, a := range m.atoms {
+		if a.isCountedHydrogen() && (opts&HashIsotopes == 0 || a.isotope == 0) {
+			continue
+		}
+		if opts&HashStereo != 0 && a.cip != cmn.CIPNone {
+			atoms = append(atoms, hashInts(cls[a.iId], uint64(a.cip)))
+			continue
+		}
+		atoms = append(atoms, cls[a.iId])
+	}
+	sort.Sort(uint64s(atoms))
+
+	bonds := make([]uint64, 0, len(m.bonds))
+	for _, b := range m.bonds {
+		c1, c2 := cls[b.a1], cls[b.a2]
+		if c1 > c2 && b.bType != cmn.BondTypeDative {
+			c1, c2 = c2, c1
+		}
+		stereo := uint64(0)
+		if opts&HashStereo != 0 {
+			stereo = b.stereoKey()
+		}
+		bonds = append(bonds, hashInts(c1, c2, b.typeKey(b.a1), stereo))
+	}
+	sort.Sort(uint64s(bonds))
+
+	h := fnv.New128a()
+	buf := make([]byte, 8)
+	write := func(vals []uint64) {
+		binary.LittleEndian.PutUint64(buf, uint64(len(vals)))
+		h.Write(buf)
+		for _, v := range vals {
+			binary.LittleEndian.PutUint64(buf, v)
+			h.Write(buf)
+		}
+	}
+	write(atoms)
+	write(bonds)
+	// Stereo groups and ring relations are written only if any, so that
+	// the hashes of molecules without them are those of earlier
+	// releases.
+	if opts&HashStereo != 0 {
+		if groups := m.stereoGroupKeys(cls); len(groups) > 0 {
+			write(groups)
+		}
+		if rels := m.ringRelationKeys(cls); len(rels) > 0 {
+			write(rels)
+		}
+	}
+
+	res := MolHash{}
+	copy(res[:], h.Sum(nil))
+	return res
+}
+
+// stereoKey answers the stereo configuration of this bond, as hashed:
+// its drawn stereo, and its CIP descriptor, which is independent of the
+// order of the atoms.  The wedge from a stereocentre of determined
+// configuration is not hashed, since the descriptor of the centre is,
+// and the same centre can be drawn with different wedges.  Nor is that
+// from a ring stereo atom of determined face, whose relations are.
+func (b *_Bond) stereoKey() uint64 {
+	drawn := b.bStereo
+	if a := b.mol.atomWithIid(b.a1); a != nil && (a.cip != cmn.CIPNone || a.hasRingFace()) {
+		drawn = cmn.BondStereoNone
+	}
+	return uint64(drawn) | uint64(b.cip)<<8
+}
+
+// typeKey answers the type of this bond, as seen from the given atom
+// of it, for hashing.  A dative bond is seen differently from its
+// donor and from its acceptor, so that its direction is hashed.  A
+// query bond is hashed by its query type, and an aromatic bond as
+// aromatic, whatever its Kekulé type, which depends on how the
+// molecule is drawn.
+func (b *_Bond) typeKey(from uint16) uint64 {
+	switch {
+	case b.bType == cmn.BondTypeDative && from == b.a2:
+		return uint64(b.bType) | 1<<8
+	case b.given == cmn.BondTypeSingleOrDouble:
+		return uint64(b.given)
+	case b.isAro || b.given == cmn.BondTypeAltern:
+		return uint64(cmn.BondTypeAltern)
+	}
+	return uint64(b.bType)
+}
+
+// CanonicalRanks answers a canonical numbering of the atoms of this
+// molecule, from `0`, by their input IDs, with the given optional
+// layers, as of `Hash128`.  Molecules with equal hashes number their
+// corresponding atoms alike, whatever the order of their atoms and
+// bonds; thus, the numbering can order canonical output, as it does
+// that of `loader.CanonicalSmiles`.
+//
+// The atoms are ranked by their classes, refined with the CIP
+// descriptors of their stereocentres, should the stereo layer be
+// given.  Ties between atoms left equivalent are broken invariantly:
+// an atom of the lowest tied class is set apart, and the classes are
+// refined afresh, until none is tied.  Without stereo, which atom of
+// the class is set apart does not matter, when they are truly
+// symmetric.  With it, the choice decides how the configurations of
+// the stereocentres and double bonds read by the ranks of their
+// neighbours; each atom of the class is tried, and the one answering
+// the least such reading is kept.
+func (m *Molecule) CanonicalRanks(opts HashOptions) (map[uint16]int, error) {
+	reply := m.Call(ReqCanonicalRanks, opts)
+	if err := statusError(reply, fmt.Sprintf("molecule %d", m.id)); err != nil {
+		return nil, err
+	}
+	return reply.Payload.(map[uint16]int), nil
+}
+
+// handleCanonicalRanks answers the canonical ranks of the atoms of
+// this molecule, with the given optional layers.
+func (m *Molecule) handleCanonicalRanks(p interface{}) (StatusType, interface{}) {
+	opts, ok := p.(HashOptions)
+	if !ok && p != nil {
+		return StIncorrectParameter, nil
+	}
+	return StSuccess, m.canonicalRanks(opts)
+}
+
+// canonicalRanks computes the canonical ranks of the atoms of this
+// molecule.  See `CanonicalRanks`.
+func (m *Molecule) canonicalRanks(opts HashOptions) map[uint16]int {
+	cls := m.canonicalClasses(opts)
+	if opts&HashStereo == 0 {
+		return m.breakTies(cls, opts)
+	}
+	for _, a := range m.atoms {
+		if a.cip != cmn.CIPNone {
+			cls[a.iId] = hashInts(cls[a.iId], uint64(a.cip))
+		}
+	}
+	cls = m.refineClasses(cls, opts)
+	if !m.hasConfigurations() {
+		return m.breakTies(cls, opts)
+	}
+
+	for {
+		order, tied := orderByClass(cls)
+		if tied < 0 {
+			return ranksOf(order)
+		}
+		var best map[uint16]uint64
+		var bestSig [][4]int
+		for _, iid := range order[tied:] {
+			if cls[iid] != cls[order[tied]] {
+				break
+			}
+			trial := m.setApart(cls, iid, opts)
+			sig := m.stereoSignature(m.breakTies(trial, opts))
+			if best == nil || lessSignature(sig, bestSig) {
+				best, bestSig = trial, sig
+			}
+		}
+		cls = best
+	}
+}
+
+// breakTies answers the ranks of the atoms of this molecule by the
+// given classes, setting apart the first atom, by input ID, of the
+// lowest tied class, until none is tied.
+func (m *Molecule) breakTies(cls map[uint16]uint64, opts HashOptions) map[uint16]int {
+	for {
+		order, tied := orderByClass(cls)
+		if tied < 0 {
+			return ranksOf(order)
+		}
+		cls = m.setApart(cls, order[tied], opts)
+	}
+}
+
+// setApart answers the given classes, with the atom of the given input
+// ID set apart from those of its class, refined afresh.  The given
+// classes are left unchanged.
+func (m *Molecule) setApart(cls map[uint16]uint64, iid uint16, opts HashOptions) map[uint16]uint64 {
+	res := make(map[uint16]uint64, len(cls))
+	for k, c := range cls {
+		res[k] = c
+	}
+	res[iid] = hashInts(res[iid], 1)
+	return m.refineClasses(res, opts)
+}
+
+// orderByClass answers the input IDs of the given classes, ordered by
+// the classes, and then by themselves, and the position of the first
+// atom tied with the next; `-1` if none is.
+func orderByClass(cls map[uint16]uint64) ([]uint16, int) {
+	order := make([]uint16, 0, len(cls))
+	for iid := range cls {
+		order = append(order, iid)
+	}
+	sort.Slice(order, func(i, j int) bool {
+		if ci, cj := cls[order[i]], cls[order[j]]; ci != cj {
+			return ci < cj
+		}
+		return order[i] < order[j]
+	})
+	for i := 1; i < len(order); i++ {
+		if cls[order[i]] == cls[order[i-1]] {
+			return order, i - 1
+		}
+	}
+	return order, -1
+}
+
+// ranksOf answers the positions of the given input IDs.
+func ranksOf(order []uint16) map[uint16]int {
+	res := make(map[uint16]int, len(order))
+	for i, iid := range order {
+		res[iid] = i
+	}
+	return res
+}
+
+// hasConfigurations answers if any stereocentre or double bond of this
+// molecule has a determined configuration.
+func (m *Molecule) hasConfigurations() bool {
+	for _, a := range m.atoms {
+		if a.parity == cmn.StereoParityOdd || a.parity == cmn.StereoParityEven {
+			return true
+		}
+	}
+	for _, b := range m.bonds {
+		if b.sides != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// stereoSignature answers the configurations of the stereocentres and
+// the double bonds of this molecule, as read by the given ranks of
+// their neighbours, in order: for a stereocentre, `0`, its rank, and
+// whether its parity by the ranks of its neighbours, an implicit
+// hydrogen being last, is odd; for a double bond, `1`, the ranks of its
+// atoms, and whether the lowest ranked substituents of its ends are
+// cis.
+func (m *Molecule) stereoSignature(ranks map[uint16]int) [][4]int {
+	const hydrogen = implicitHydrogen
+	b2i := func(b bool) int {
+		if b {
+			return 1
+		}
+		return 0
+	}
+	byRank := func(iids []uint16) []uint16 {
+		res := append([]uint16(nil), iids...)
+		sort.Slice(res, func(i, j int) bool { return ranks[res[i]] < ranks[res[j]] })
+		return res
+	}
+
+	res := [][4]int(nil)
+	for _, a := range m.atoms {
+		if a.parity != cmn.StereoParityOdd && a.parity != cmn.StereoParityEven {
+			continue
+		}
+		asc := a.neighbourIids()
+		sort.Slice(asc, func(i, j int) bool { return asc[i] < asc[j] })
+		seq := byRank(asc)
+		switch {
+		case len(asc) == 3 && a.hCount == 1:
+			asc, seq = append(asc, hydrogen), append(seq, hydrogen)
+		case len(asc) != 4:
+			continue
+		}
+		odd := a.parity == cmn.StereoParityOdd
+		if permutationIsOdd(seq, asc) {
+			odd = !odd
+		}
+		res = append(res, [4]int{0, ranks[a.iId], b2i(odd)})
+	}
+	for _, b := range m.bonds {
+		if b.sides == 0 {
+			continue
+		}
+		r1, r2, ok := b.lowestSubstituents()
+		if !ok {
+			continue
+		}
+		cis := b.sides > 0
+		if byRank(b.axisOrthos(m.atomWithIid(b.a1)))[0] != r1 {
+			cis = !cis
+		}
+		if byRank(b.axisOrthos(m.atomWithIid(b.a2)))[0] != r2 {
+			cis = !cis
+		}
+		k1, k2 := ranks[b.a1], ranks[b.a2]
+		if k1 > k2 {
+			k1, k2 = k2, k1
+		}
+		res = append(res, [4]int{1, k1, k2, b2i(cis)})
+	}
+	sort.Slice(res, func(i, j int) bool { return lessTuple(res[i], res[j]) })
+	return res
+}
+
+// lessTuple answers if the first given tuple precedes the second,
+// lexicographically.
+func lessTuple(t1, t2 [4]int) bool {
+	for k := range t1 {
+		if t1[k] != t2[k] {
+			return t1[k] < t2[k]
+		}
+	}
+	return false
+}
+
+// lessSignature answers if the first given stereo signature precedes
+// the second, lexicographically.
+func lessSignature(s1, s2 [][4]int) bool {
+	for k := 0; k < len(s1) && k < len(s2); k++ {
+		if s1[k] != s2[k] {
+			return lessTuple(s1[k], s2[k])
+		}
+	}
+	return len(s1) < len(s2)
+}
+
+// canonicalClasses answers the classes of the atoms of this molecule,
+// refined from their invariants until the number of distinct classes
+// no longer grows.
+func (m *Molecule) canonicalClasses(opts HashOptions) map[uint16]uint64 {
+	cls := make(map[uint16]uint64, len(m.atoms))
+	for _, a := range m.atoms {
+		iso := uint64(0)
+		if opts&HashIsotopes != 0 {
+			iso = uint64(a.isotope)
+		}
+		cls[a.iId] = hashInts(uint64(a.atNum), uint64(uint8(a.charge)), uint64(a.hCount),
+			uint64(a.radical), iso, uint64(len(a.adj)))
+		// R-groups and attachment points, if any, so that the hashes of
+		// other molecules are unchanged.
+		if a.rgroup != 0 || a.attachment != 0 {
+			cls[a.iId] = hashInts(cls[a.iId], uint64(a.rgroup), uint64(a.attachment))
+		}
+		if opts&HashIsotopeSites != 0 && a.hIsotopes != [2]uint8{} {
+			cls[a.iId] = hashInts(cls[a.iId], uint64(a.hIsotopes[0]), uint64(a.hIsotopes[1]))
+		}
+	}
+	return m.refineClasses(cls, opts)
+}
+
+// refineClasses refines the given classes of the atoms of this
+// molecule by those of their neighbours, until the number of distinct
+// classes no longer grows.
+func (m *Molecule) refineClasses(cls map[uint16]uint64, opts HashOptions) map[uint16]uint64 {
+	n := countDistinct(cls)
+	for round := 0; round < len(m.atoms); round++ {
+		next := make(map[uint16]uint64, len(cls))
+		for _, a := range m.atoms {
+			nbrCls := make([]uint64, 0, len(a.adj))
+			for _, nbr := range a.adj {
+				b := m.bondWithId(nbr.Bond)
+				stereo := uint64(0)
+				if opts&HashStereo != 0 {
+					stereo = b.stereoKey()
+				}
+				nbrCls = append(nbrCls, hashInts(b.typeKey(a.iId), stereo, cls[nbr.Atom]))
+			}
+			sort.Sort(uint64s(nbrCls))
+
+			next[a.iId] = hashInts(append([]uint64{cls[a.iId]}, nbrCls...)...)
+		}
+
+		nn := countDistinct(next)
+		cls = next
+		if nn == n {
+			break
+		}
+		n = nn
+	}
+
+	return cls
+}
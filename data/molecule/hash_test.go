@@ -0,0 +1,91 @@
+package molecule_test
+
+import (
+	"testing"
+
+	"github.com/RxnWeaver/rxnweaver/data/molecule"
+)
+
+// hashOf answers the structure hash of the given SMILES string, with
+// the given optional layers.
+func hashOf(t *testing.T, smi string, opts molecule.HashOptions) molecule.MolHash {
+	t.Helper()
+	mol := readSmiles(t, smi)
+	defer mol.Release()
+	h, err := mol.Hash128(opts)
+	if err != nil {
+		t.Fatalf("%s : %v", smi, err)
+	}
+	return h
+}
+
+func TestHashAlike(t *testing.T) {
+	tests := []struct {
+		name string
+		opts molecule.HashOptions
+		smis []string
+	}{
+		{"naphthalene", 0, []string{
+			"c1ccc2ccccc2c1", "c1cccc2c1cccc2", "C1=CC=C2C=CC=CC2=C1", "C1=CC2=CC=CC=C2C=C1",
+		}},
+		{"salicylic acid", 0, []string{
+			"Oc1ccccc1C(=O)O", "c1cccc(O)c1C(O)=O", "OC1=CC=CC=C1C(O)=O", "OC(=O)C1=C(O)C=CC=C1",
+		}},
+		{"indole", 0, []string{"c1ccc2[nH]ccc2c1", "C1=CC=C2NC=CC2=C1", "N1C=CC2=CC=CC=C12"}},
+		{"salicylic acid, stereo", molecule.HashStereo | molecule.HashIsotopes, []string{
+			"Oc1ccccc1C(=O)O", "OC(=O)C1=C(O)C=CC=C1",
+		}},
+	}
+	for _, tt := range tests {
+		want := hashOf(t, tt.smis[0], tt.opts)
+		for _, smi := range tt.smis[1:] {
+			if h := hashOf(t, smi, tt.opts); h != want {
+				t.Errorf("%s : %s hashes apart from %s", tt.name, smi, tt.smis[0])
+			}
+		}
+	}
+}
+
+func TestHashApart(t *testing.T) {
+	tests := []struct {
+		opts molecule.HashOptions
+		a, b string
+	}{
+		{0, "c1ccccc1", "C1CCCCC1"},
+		{0, "c1ccccc1", "C1=CCC=CC1"},
+		{0, "Oc1ccccc1C(=O)O", "Oc1ccc(cc1)C(=O)O"},
+	}
+	for _, tt := range tests {
+		if hashOf(t, tt.a, tt.opts) == hashOf(t, tt.b, tt.opts) {
+			t.Errorf("%s and %s hash alike", tt.a, tt.b)
+		}
+	}
+}
+
+func TestHashCountedHydrogens(t *testing.T) {
+	tests := []struct {
+		opts  molecule.HashOptions
+		a, b  string
+		alike bool
+	}{
+		{0, "[H]C([H])([H])[H]", "C", true},
+		{0, "[H]OC", "CO", true},
+		{molecule.HashIsotopes, "[H]C([H])([H])[H]", "C", true},
+		{molecule.HashIsotopes, "[H]OC", "CO", true},
+		{0, "[2H]C([2H])([2H])[2H]", "C", true},
+		{0, "[2H]C", "C", true},
+		{molecule.HashIsotopes, "[2H]C([2H])([2H])[2H]", "C", false},
+		{molecule.HashIsotopes, "[2H]C", "C", false},
+		{molecule.HashIsotopes, "[2H]C", "[2H]C([2H])([2H])[2H]", false},
+		{molecule.HashIsotopes, "[2H]C([2H])([2H])CO", "CC([2H])([2H])O", false},
+		{molecule.HashIsotopes, "[2H]C([2H])([2H])CO", "[2H]C([2H])C([2H])O", true},
+		{molecule.HashIsotopes | molecule.HashIsotopeSites, "[2H]C([2H])([2H])CO", "[2H]C([2H])C([2H])O", false},
+		{0, "[H][H]", "[H]", false},
+		{0, "[H+]", "[H]", false},
+	}
+	for _, tt := range tests {
+		if alike := hashOf(t, tt.a, tt.opts) == hashOf(t, tt.b, tt.opts); alike != tt.alike {
+			t.Errorf("%s and %s, options %d : alike %v, want %v", tt.a, tt.b, tt.opts, alike, tt.alike)
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package molecule
+
+// History answers an option that makes a molecule keep a journal of
+// its states before each of its most recent structural modifications,
+// up to the given number.  Such modifications can then be undone and
+// redone, with `Undo` and `Redo`.
+//
+// The journal holds a complete copy of the molecule per modification.
+// This suits interactive editing of molecules of modest sizes, rather
+// than batch processing.
+func History(n int) Option {
+	return func(m *Molecule) {
+		if n > 0 {
+			m.history = &_History{limit: n}
+		}
+	}
+}
+
+// journalledRequests holds the requests whose modifications are
+// recorded in the journals of molecules.
+var journalledRequests = map[RequestType]bool{
+	ReqAddAtom:             true,
+	ReqAddBond:             true,
+	ReqAddTag:              true,
+	ReqSetAttribute:        true,
+	ReqDeleteAttribute:     true,
+	ReqConformAttributes:   true,
+	ReqSetAtomAttribute:    true,
+	ReqSetBondAttribute:    true,
+	ReqDeleteAtomAttribute: true,
+	ReqDeleteBondAttribute: true,
+	ReqAddConformer:        true,
+	ReqRemoveConformer:     true,
+	ReqAlignConformers:     true,
+	ReqAlignConformer:      true,
+	ReqAlignDepiction:      true,
+	ReqSetStereoGroups:     true,
+	ReqSetSgroups:          true,
+	ReqExpandSgroups:       true,
+	ReqPruneConformers:     true,
+	ReqMinimise:            true,
+	ReqSetAtomCharge:       true,
+	ReqSetAtomHCount:       true,
+	ReqSetAttachment:       true,
+	ReqSetBondType:         true,
+	ReqSetAtomParity:       true,
+	ReqSetBondSides:        true,
+	ReqKekulise:            true,
+	ReqAromatise:           true,
+	ReqRemoveAtom:          true,
+	ReqRemoveBond:          true,
+	ReqReplaceAtom:         true,
+	ReqJoinAtoms:           true,
+	ReqMerge:               true,
+	ReqApplyEdits:          true,
+	ReqSanitize:            true,
+	ReqEmbed:               true,
+}
+
+// _History is a bounded journal of the states of a molecule.  Each
+// state is held as a passive duplicate of the molecule.
+type _History struct {
+	limit int
+	undo  []*Molecule // States before the most recent modifications, oldest first.
+	redo  []*Molecule // States after the most recently undone modifications.
+}
+
+// record pushes the given state, before a modification, onto the
+// journal.  The oldest state is dropped if the journal is full.  Any
+// undone modifications can no longer be redone.
+func (h *_History) record(state *Molecule) {
+	if len(h.undo) == h.limit {
+		h.undo = append(h.undo[:0], h.undo[1:]...)
+	}
+	h.undo = append(h.undo, state)
+	h.redo = nil
+}
+
+// dispatchRecorded dispatches the given request, recording the state
+// of this molecule prior to it in its journal, if it has one, should
+// the request modify the molecule.
+func (m *Molecule) dispatchRecorded(msg InMessage) (StatusType, interface{}) {
+	if m.history == nil || !journalledRequests[msg.Request] {
+		return m.dispatch(msg)
+	}
+
+	state := m.duplicate(true)
+	st, res := m.dispatch(msg)
+	if st == StSuccess {
+		m.history.record(state)
+	}
+	return st, res
+}
+
+// Undo reverts the most recent structural modification of this
+// molecule.  An error is answered if the molecule keeps no journal, or
+// if there is nothing to undo.
+func (m *Molecule) Undo() error {
+	return statusError(m.Call(ReqUndo, nil), "modification to undo")
+}
+
+// Redo re-applies the most recently undone structural modification of
+// this molecule.  An error is answered if the molecule keeps no
+// journal, or if there is nothing to redo.
+func (m *Molecule) Redo() error {
+	return statusError(m.Call(ReqRedo, nil), "modification to redo")
+}
+
+// handleUndo restores the state of this molecule before its most
+// recent modification.
+func (m *Molecule) handleUndo(p interface{}) (StatusType, interface{}) {
+	h := m.history
+	if h == nil || len(h.undo) == 0 {
+		return StNotFound, nil
+	}
+
+	n := len(h.undo)
+	state := h.undo[n-1]
+	h.undo = h.undo[:n-1]
+	h.redo = append(h.redo, m.duplicate(true))
+	m.adopt(state)
+
+	m.publish(EvRestored, 0, 0)
+	m.invalidate()
+	return StSuccess, nil
+}
+
+// handleRedo restores the state of this molecule after its most
+// recently undone modification.
+func (m *Molecule) handleRedo(p interface{}) (StatusType, interface{}) {
+	h := m.history
+	if h == nil || len(h.redo) == 0 {
+		return StNotFound, nil
+	}
+
+	n := len(h.redo)
+	state := h.redo[n-1]
+	h.redo = h.redo[:n-1]
+	h.undo = append(h.undo, m.duplicate(true))
+	m.adopt(state)
+
+	m.publish(EvRestored, 0, 0)
+	m.invalidate()
+	return StSuccess, nil
+}
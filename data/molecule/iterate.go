@@ -0,0 +1,239 @@
+package molecule
+
+import (
+	"fmt"
+
+	cmn "github.com/RxnWeaver/rxnweaver/common"
+)
+
+// AtomPredicate selects atoms when iterating over those of a molecule.
+// See `Molecule.Atoms`.
+//
+// Predicates are evaluated in the molecule's own goroutine.  Those
+// constructed by `AtomMatching` must, therefore, not make requests to
+// the molecule.
+type AtomPredicate struct {
+	f func(a *_Atom) bool
+}
+
+// AtomOfElement answers a predicate selecting atoms of the element
+// with the given atomic number.
+func AtomOfElement(atNum uint8) AtomPredicate {
+	return AtomPredicate{func(a *_Atom) bool { return a.atNum == atNum }}
+}
+
+// AromaticAtom answers a predicate selecting atoms participating in
+// at least one aromatic ring.
+func AromaticAtom() AtomPredicate {
+	return AtomPredicate{func(a *_Atom) bool { return a.mol.isAtomAromatic(a.iId) }}
+}
+
+// CyclicAtom answers a predicate selecting atoms participating in at
+// least one ring.
+func CyclicAtom() AtomPredicate {
+	return AtomPredicate{func(a *_Atom) bool { return a.mol.isAtomCyclic(a.iId) }}
+}
+
+// AtomInRingOfSize answers a predicate selecting atoms participating
+// in at least one ring of the given size.
+func AtomInRingOfSize(n int) AtomPredicate {
+	return AtomPredicate{func(a *_Atom) bool { return a.mol.isAtomInRingOfSize(a.iId, n) }}
+}
+
+// AtomMatching answers a predicate selecting atoms whose snapshots
+// satisfy the given function.
+func AtomMatching(f func(ai AtomInfo) bool) AtomPredicate {
+	return AtomPredicate{func(a *_Atom) bool { return f(a.info()) }}
+}
+
+// NotAtom answers a predicate selecting atoms NOT selected by the
+// given predicate.
+func NotAtom(p AtomPredicate) AtomPredicate {
+	return AtomPredicate{func(a *_Atom) bool { return !p.f(a) }}
+}
+
+// BondPredicate selects bonds when iterating over those of a molecule.
+// See `Molecule.Bonds`.
+//
+// Predicates are evaluated in the molecule's own goroutine.  Those
+// constructed by `BondMatching` must, therefore, not make requests to
+// the molecule.
+type BondPredicate struct {
+	f func(b *_Bond) bool
+}
+
+// BondOfType answers a predicate selecting bonds of the given type, as
+// given; see `BondInfo`.
+func BondOfType(typ cmn.BondType) BondPredicate {
+	return BondPredicate{func(b *_Bond) bool { return b.givenType() == typ }}
+}
+
+// AromaticBond answers a predicate selecting aromatic bonds.
+func AromaticBond() BondPredicate {
+	return BondPredicate{func(b *_Bond) bool { return b.mol.isBondAromatic(b.id) }}
+}
+
+// CyclicBond answers a predicate selecting bonds participating in at
+// least one ring.
+func CyclicBond() BondPredicate {
+	return BondPredicate{func(b *_Bond) bool { return b.mol.isBondCyclic(b.id) }}
+}
+
+// BondInRingOfSize answers a predicate selecting bonds participating
+// in at least one ring of the given size.
+func BondInRingOfSize(n int) BondPredicate {
+	return BondPredicate{func(b *_Bond) bool { return b.mol.isBondInRingOfSize(b.id, n) }}
+}
+
+// BondMatching answers a predicate selecting bonds whose snapshots
+// satisfy the given function.
+func BondMatching(f func(bi BondInfo) bool) BondPredicate {
+	return BondPredicate{func(b *_Bond) bool { return f(b.info()) }}
+}
+
+// NotBond answers a predicate selecting bonds NOT selected by the
+// given predicate.
+func NotBond(p BondPredicate) BondPredicate {
+	return BondPredicate{func(b *_Bond) bool { return !p.f(b) }}
+}
+
+// AtomIterator iterates over snapshots of the atoms of a molecule.
+//
+//	it := mol.Atoms(molecule.AtomOfElement(7), molecule.AromaticAtom())
+//	for it.Next() {
+//		ai := it.Atom()
+//		...
+//	}
+//	if err := it.Err(); err != nil {
+//		...
+//	}
+//
+// The snapshots are taken when the iterator is created.  Subsequent
+// changes to the molecule are not reflected in them.
+type AtomIterator struct {
+	atoms []AtomInfo
+	idx   int
+	err   error
+}
+
+// Next advances this iterator to the next atom, answering `false` when
+// there are no more.
+func (it *AtomIterator) Next() bool {
+	if it.idx >= len(it.atoms) {
+		return false
+	}
+	it.idx++
+	return true
+}
+
+// Atom answers the snapshot of the current atom.
+func (it *AtomIterator) Atom() AtomInfo {
+	return it.atoms[it.idx-1]
+}
+
+// Len answers the total number of atoms selected.
+func (it *AtomIterator) Len() int {
+	return len(it.atoms)
+}
+
+// Err answers the error, if any, encountered when taking the
+// snapshots.
+func (it *AtomIterator) Err() error {
+	return it.err
+}
+
+// BondIterator iterates over snapshots of the bonds of a molecule.
+// Its usage is analogous to that of `AtomIterator`.
+type BondIterator struct {
+	bonds []BondInfo
+	idx   int
+	err   error
+}
+
+// Next advances this iterator to the next bond, answering `false` when
+// there are no more.
+func (it *BondIterator) Next() bool {
+	if it.idx >= len(it.bonds) {
+		return false
+	}
+	it.idx++
+	return true
+}
+
+// Bond answers the snapshot of the current bond.
+func (it *BondIterator) Bond() BondInfo {
+	return it.bonds[it.idx-1]
+}
+
+// Len answers the total number of bonds selected.
+func (it *BondIterator) Len() int {
+	return len(it.bonds)
+}
+
+// Err answers the error, if any, encountered when taking the
+// snapshots.
+func (it *BondIterator) Err() error {
+	return it.err
+}
+
+// Atoms answers an iterator over the atoms of this molecule that
+// satisfy all of the given predicates, in the order of their addition.
+func (m *Molecule) Atoms(preds ...AtomPredicate) *AtomIterator {
+	reply := m.Call(ReqAtoms, preds)
+	if err := statusError(reply, fmt.Sprintf("molecule %d", m.id)); err != nil {
+		return &AtomIterator{err: err}
+	}
+	return &AtomIterator{atoms: reply.Payload.([]AtomInfo)}
+}
+
+// Bonds answers an iterator over the bonds of this molecule that
+// satisfy all of the given predicates, in the order of their addition.
+func (m *Molecule) Bonds(preds ...BondPredicate) *BondIterator {
+	reply := m.Call(ReqBonds, preds)
+	if err := statusError(reply, fmt.Sprintf("molecule %d", m.id)); err != nil {
+		return &BondIterator{err: err}
+	}
+	return &BondIterator{bonds: reply.Payload.([]BondInfo)}
+}
+
+// handleAtoms answers snapshots of the atoms satisfying all of the
+// given predicates.
+func (m *Molecule) handleAtoms(p interface{}) (StatusType, interface{}) {
+	preds, ok := p.([]AtomPredicate)
+	if !ok && p != nil {
+		return StIncorrectParameter, nil
+	}
+
+	res := make([]AtomInfo, 0, len(m.atoms))
+outer:
+	for _, a := range m.atoms {
+		for _, pred := range preds {
+			if pred.f == nil || !pred.f(a) {
+				continue outer
+			}
+		}
+		res = append(res, a.info())
+	}
+	return StSuccess, res
+}
+
+// handleBonds answers snapshots of the bonds satisfying all of the
+// given predicates.
+func (m *Molecule) handleBonds(p interface{}) (StatusType, interface{}) {
+	preds, ok := p.([]BondPredicate)
+	if !ok && p != nil {
+		return StIncorrectParameter, nil
+	}
+
+	res := make([]BondInfo, 0, len(m.bonds))
+outer:
+	for _, b := range m.bonds {
+		for _, pred := range preds {
+			if pred.f == nil || !pred.f(b) {
+				continue outer
+			}
+		}
+		res = append(res, b.info())
+	}
+	return StSuccess, res
+}
@@ -0,0 +1,164 @@
+package molecule
+
+import (
+	"fmt"
+
+	cmn "github.com/RxnWeaver/rxnweaver/common"
+)
+
+// Kekulise gives the aromatic bonds of this molecule their Kekulé
+// types, single or double, in place of the aromatic type they were
+// given with.  Those not yet assigned Kekulé types, as by sanitisation,
+// are assigned them first; should that prove impossible, the molecule
+// is left unchanged.  Query bonds are kept.  See `Aromatise`.
+func (m *Molecule) Kekulise() error {
+	return statusError(m.Call(ReqKekulise, nil), fmt.Sprintf("molecule %d", m.id))
+}
+
+// Aromatise gives the bonds of this molecule perceived as aromatic the
+// aromatic type, keeping their Kekulé types for perception.  Other
+// bonds given as aromatic are given their Kekulé types instead.
+// Aromaticity should have been perceived, as by sanitisation.  See
+// `Kekulise`.
+func (m *Molecule) Aromatise() error {
+	return statusError(m.Call(ReqAromatise, nil), fmt.Sprintf("molecule %d", m.id))
+}
+
+// handleKekulise gives the aromatic bonds of this molecule their
+// Kekulé types.
+func (m *Molecule) handleKekulise(p interface{}) (StatusType, interface{}) {
+	if err := m.kekulise(); err != nil {
+		return StIncorrectParameter, err
+	}
+
+	for _, b := range m.bonds {
+		if b.given == cmn.BondTypeAltern {
+			b.given = cmn.BondTypeNone
+			m.publish(EvBondChanged, 0, b.id)
+		}
+	}
+	m.invalidate()
+	return StSuccess, nil
+}
+
+// handleAromatise gives the aromatic bonds of this molecule the
+// aromatic type.
+func (m *Molecule) handleAromatise(p interface{}) (StatusType, interface{}) {
+	for _, b := range m.bonds {
+		if b.given == cmn.BondTypeSingleOrDouble {
+			continue
+		}
+
+		t := cmn.BondTypeNone
+		if b.isAro {
+			t = cmn.BondTypeAltern
+		}
+		if b.given != t {
+			b.given = t
+			m.publish(EvBondChanged, 0, b.id)
+		}
+	}
+	m.invalidate()
+	return StSuccess, nil
+}
+
+// kekulise assigns single and double Kekulé types to the aromatic
+// bonds of this molecule, so that each atom bearing such bonds that
+// falls short of its lowest standard valence, adjusted for charge, gets
+// exactly one double bond.  Atoms that can donate a lone pair to their
+// rings instead, as the nitrogen of pyrrole, or the anionic carbon of
+// cyclopentadienide, are given a double bond only if the others allow
+// it; those left short are given a hydrogen by sanitisation.  Double
+// bonds assigned earlier are kept, so that kekulising afresh changes
+// nothing.
+//
+// Should no such assignment exist, an error is answered, and the
+// molecule is left unchanged.
+func (m *Molecule) kekulise() error {
+	cands := make(map[uint16][]*_Bond) // Candidate bonds, by atom.
+	for _, b := range m.bonds {
+		if b.given == cmn.BondTypeAltern && b.bType == cmn.BondTypeSingle {
+			cands[b.a1] = append(cands[b.a1], b)
+			cands[b.a2] = append(cands[b.a2], b)
+		}
+	}
+	if len(cands) == 0 {
+		return nil
+	}
+
+	needs := make(map[uint16]bool)
+	order := []*_Atom(nil)
+	optional := make(map[uint16]bool)
+	for _, a := range m.atoms {
+		if len(cands[a.iId]) == 0 || !a.fallsShort() {
+			continue
+		}
+		needs[a.iId] = true
+		order = append(order, a)
+		optional[a.iId] = a.charge < 0 || a.charge == 0 && (a.atNum == 7 || a.atNum == 15)
+	}
+
+	matched := make(map[uint16]bool)
+	doubles := []*_Bond(nil)
+	var match func(k int) bool
+	match = func(k int) bool {
+		for k < len(order) && matched[order[k].iId] {
+			k++
+		}
+		if k == len(order) {
+			return true
+		}
+
+		a := order[k]
+		for _, b := range cands[a.iId] {
+			j := b.otherAtomIid(a.iId)
+			if !needs[j] || matched[j] {
+				continue
+			}
+			matched[a.iId], matched[j] = true, true
+			doubles = append(doubles, b)
+			if match(k + 1) {
+				return true
+			}
+			matched[a.iId], matched[j] = false, false
+			doubles = doubles[:len(doubles)-1]
+		}
+		return optional[a.iId] && match(k+1)
+	}
+	if !match(0) {
+		iids := make([]uint16, 0, len(order))
+		for _, a := range order {
+			iids = append(iids, a.iId)
+		}
+		return fmt.Errorf("Aromatic bonds admit no Kekulé structure, at atoms : %v", iids)
+	}
+
+	for _, b := range doubles {
+		a1, a2 := m.atomWithIid(b.a1), m.atomWithIid(b.a2)
+		a1.removeBond(b)
+		a2.removeBond(b)
+		b.bType = cmn.BondTypeDouble
+		a1.addBond(b)
+		a2.addBond(b)
+		m.publish(EvBondChanged, 0, b.id)
+	}
+	return nil
+}
+
+// fallsShort answers if this atom, of the organic subset and not a
+// radical, falls short of the lowest of its standard valences,
+// adjusted for charge, that accommodates its bonds and hydrogens.
+func (a *_Atom) fallsShort() bool {
+	vals, ok := standardValences[a.atNum]
+	if !ok || a.radical != cmn.RadicalNone {
+		return false
+	}
+
+	used := len(a.nbrs) + int(a.hCount)
+	for _, v := range vals {
+		if v = chargeAdjustedValence(a.atNum, v, int(a.charge)); v >= used {
+			return v > used
+		}
+	}
+	return false
+}
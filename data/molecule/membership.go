@@ -0,0 +1,118 @@
+package molecule
+
+import (
+	"fmt"
+
+	bits "github.com/willf/bitset"
+
+	cmn "github.com/RxnWeaver/rxnweaver/common"
+)
+
+// _Membership records the ring and aromaticity membership of the atoms
+// and bonds of a molecule, as bitsets indexed by atom input IDs and
+// bond IDs, respectively.
+//
+// This makes queries such as "is this atom in a six-membered ring?",
+// used heavily during pattern matching, constant-time operations.
+type _Membership struct {
+	cyclicAtoms   *bits.BitSet
+	cyclicBonds   *bits.BitSet
+	aromaticAtoms *bits.BitSet
+	aromaticBonds *bits.BitSet
+
+	atomsByRingSize map[int]*bits.BitSet // Atoms in rings of each size.
+	bondsByRingSize map[int]*bits.BitSet // Bonds in rings of each size.
+}
+
+// newMembership creates empty membership bitsets.
+func newMembership() *_Membership {
+	ms := new(_Membership)
+	ms.cyclicAtoms = bits.New(cmn.ListSizeLarge)
+	ms.cyclicBonds = bits.New(cmn.ListSizeLarge)
+	ms.aromaticAtoms = bits.New(cmn.ListSizeLarge)
+	ms.aromaticBonds = bits.New(cmn.ListSizeLarge)
+	ms.atomsByRingSize = make(map[int]*bits.BitSet)
+	ms.bondsByRingSize = make(map[int]*bits.BitSet)
+	return ms
+}
+
+// addRing records the membership of the atoms and bonds of the given
+// ring.
+func (ms *_Membership) addRing(r *_Ring) {
+	ms.cyclicAtoms.InPlaceUnion(r.atomBitSet)
+	ms.cyclicBonds.InPlaceUnion(r.bondBitSet)
+
+	n := r.size()
+	if _, ok := ms.atomsByRingSize[n]; !ok {
+		ms.atomsByRingSize[n] = bits.New(cmn.ListSizeLarge)
+		ms.bondsByRingSize[n] = bits.New(cmn.ListSizeLarge)
+	}
+	ms.atomsByRingSize[n].InPlaceUnion(r.atomBitSet)
+	ms.bondsByRingSize[n].InPlaceUnion(r.bondBitSet)
+}
+
+// addRing adds the given completed ring to this molecule, and records
+// its membership in its atoms, its bonds and the molecule's bitsets.
+func (m *Molecule) addRing(r *_Ring) error {
+	if !r.isComplete {
+		return fmt.Errorf("Ring %d is not complete.", r.id)
+	}
+	if m.ringWithId(r.id) != nil {
+		return fmt.Errorf("Ring %d already exists.", r.id)
+	}
+
+	m.rings = append(m.rings, r)
+	for _, aid := range r.atoms {
+		m.atomWithIid(aid).addRing(r)
+	}
+	for _, bid := range r.bonds {
+		m.bondWithId(bid).addRing(r.id)
+	}
+	m.members.addRing(r)
+
+	return nil
+}
+
+// setBondAromatic marks the given bond of this molecule as being
+// aromatic.
+func (m *Molecule) setBondAromatic(b *_Bond) {
+	b.isAro = true
+	m.members.aromaticBonds.Set(uint(b.id))
+}
+
+// isAtomCyclic answers if the given atom participates in at least one
+// ring.
+func (m *Molecule) isAtomCyclic(aiid uint16) bool {
+	return m.members.cyclicAtoms.Test(uint(aiid))
+}
+
+// isBondCyclic answers if the given bond participates in at least one
+// ring.
+func (m *Molecule) isBondCyclic(bid uint16) bool {
+	return m.members.cyclicBonds.Test(uint(bid))
+}
+
+// isAtomAromatic answers if the given atom participates in at least
+// one aromatic ring.
+func (m *Molecule) isAtomAromatic(aiid uint16) bool {
+	return m.members.aromaticAtoms.Test(uint(aiid))
+}
+
+// isBondAromatic answers if the given bond is aromatic.
+func (m *Molecule) isBondAromatic(bid uint16) bool {
+	return m.members.aromaticBonds.Test(uint(bid))
+}
+
+// isAtomInRingOfSize answers if the given atom participates in at
+// least one ring of the given size.
+func (m *Molecule) isAtomInRingOfSize(aiid uint16, n int) bool {
+	bs, ok := m.members.atomsByRingSize[n]
+	return ok && bs.Test(uint(aiid))
+}
+
+// isBondInRingOfSize answers if the given bond participates in at
+// least one ring of the given size.
+func (m *Molecule) isBondInRingOfSize(bid uint16, n int) bool {
+	bs, ok := m.members.bondsByRingSize[n]
+	return ok && bs.Test(uint(bid))
+}
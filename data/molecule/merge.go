@@ -0,0 +1,192 @@
+package molecule
+
+import (
+	"fmt"
+	"math"
+)
+
+// Merge copies the atoms, bonds and rings of the given molecule into
+// this molecule.  The copied atoms are assigned input IDs following
+// those of this molecule's atoms; the answered map translates the
+// input IDs of the other molecule's atoms into them.
+//
+// If a link is given, a bond of its type is formed between its atom in
+// this molecule and its atom in the other molecule.
+//
+// The other molecule is not modified.  It is snapshotted before the
+// merge, so it may be live, and may even be this molecule itself.
+func (m *Molecule) Merge(other *Molecule, link *MergeLink) (map[uint16]uint16, error) {
+	reply := other.Call(ReqClone, CloneQuery{Passive: true})
+	if err := statusError(reply, fmt.Sprintf("molecule %d", other.id)); err != nil {
+		return nil, err
+	}
+	frag := reply.Payload.(*Molecule)
+	defer frag.Release()
+
+	reply = m.Call(ReqMerge, MergeRequest{frag, link})
+	if err := statusError(reply, fmt.Sprintf("molecule %d", other.id)); err != nil {
+		return nil, err
+	}
+	return reply.Payload.(map[uint16]uint16), nil
+}
+
+// handleMerge copies the atoms, bonds, rings and ring systems of the
+// given fragment into this molecule, and forms the requested link, if
+// any.
+func (m *Molecule) handleMerge(p interface{}) (StatusType, interface{}) {
+	q, ok := p.(MergeRequest)
+	if !ok || q.Fragment == nil || !q.Fragment.passive {
+		return StIncorrectParameter, nil
+	}
+	frag := q.Fragment
+
+	// Validate everything up front, so that a failed merge leaves this
+	// molecule untouched.
+	nb := len(frag.bonds)
+	if q.Link != nil {
+		nb++
+		if m.atomWithIid(q.Link.Atom) == nil || frag.atomWithIid(q.Link.OtherAtom) == nil {
+			return StNotFound, fmt.Errorf("Link atoms not found : %d, %d", q.Link.Atom, q.Link.OtherAtom)
+		}
+		if !isValidBondType(q.Link.Type) {
+			return StIncorrectParameter, fmt.Errorf("Invalid link bond type : %d", q.Link.Type)
+		}
+	}
+	if int(m.nextAtomIid)+len(frag.atoms) > math.MaxUint16 || int(m.nextBondId)+nb > math.MaxUint16 {
+		return StIncorrectParameter, fmt.Errorf("Too many atoms or bonds in merged molecule %d.", m.id)
+	}
+	if int(m.nextRingId)+len(frag.rings) >= math.MaxUint16 ||
+		int(m.nextRingSystemId)+len(frag.ringSystems) >= math.MaxUint16 {
+		return StIncorrectParameter, fmt.Errorf("Too many rings in merged molecule %d.", m.id)
+	}
+
+	iids := m.mergeAtoms(frag)
+	if err := m.mergeBonds(frag, iids); err != nil {
+		return StIncorrectParameter, err
+	}
+	if err := m.mergeRings(frag, iids); err != nil {
+		return StIncorrectParameter, err
+	}
+
+	if q.Link != nil {
+		m.atomWithIid(q.Link.Atom).dropDeclaredStereo()
+		m.atomWithIid(iids[q.Link.OtherAtom]).dropDeclaredStereo()
+		b := newBond(m, int(m.nextBondId))
+		b.a1 = q.Link.Atom
+		b.a2 = iids[q.Link.OtherAtom]
+		b.setType(q.Link.Type)
+		if err := m.addBond(b); err != nil {
+			return StIncorrectParameter, err
+		}
+		m.publish(EvBondAdded, 0, b.id)
+	}
+
+	m.discardDistances()
+	m.invalidate()
+	return StSuccess, iids
+}
+
+// mergeAtoms adds copies of the atoms of the given fragment to this
+// molecule, without their bonds and rings.  It answers the map of the
+// fragment's atom input IDs to those of the copies.
+func (m *Molecule) mergeAtoms(frag *Molecule) map[uint16]uint16 {
+	iids := make(map[uint16]uint16, len(frag.atoms))
+	for _, a := range frag.atoms {
+		na := a.clone(m)
+		na.iId = m.nextAtomIid
+		na.nId = 0
+
+		na.bonds.ClearAll()
+		na.nbrs = na.nbrs[:0]
+		na.adj = na.adj[:0]
+		na.singleBondCount, na.doubleBondCount, na.tripleBondCount = 0, 0, 0
+		na.rings.ClearAll()
+
+		iids[a.iId] = na.iId
+		m.addAtom(na)
+		if na.isInAroRing {
+			m.setAtomAromatic(na)
+		}
+		m.publish(EvAtomAdded, na.iId, 0)
+	}
+
+	return iids
+}
+
+// mergeBonds adds copies of the bonds of the given fragment to this
+// molecule, between the mapped atoms.
+func (m *Molecule) mergeBonds(frag *Molecule, iids map[uint16]uint16) error {
+	for _, b := range frag.bonds {
+		nb := b.clone(m)
+		nb.id = m.nextBondId
+		nb.a1 = iids[b.a1]
+		nb.a2 = iids[b.a2]
+		nb.rings = nb.rings[:0]
+
+		if err := m.addBond(nb); err != nil {
+			return err
+		}
+		if nb.isAro {
+			m.setBondAromatic(nb)
+		}
+		m.publish(EvBondAdded, 0, nb.id)
+	}
+
+	return nil
+}
+
+// mergeRings adds copies of the rings and ring systems of the given
+// fragment to this molecule, over the mapped atoms.
+func (m *Molecule) mergeRings(frag *Molecule, iids map[uint16]uint16) error {
+	rids := make(map[uint16]*_Ring, len(frag.rings))
+	for _, r := range frag.rings {
+		id, err := m.newRingId()
+		if err != nil {
+			return err
+		}
+
+		nr := newRing(m, id)
+		for _, aid := range r.atoms {
+			if err := nr.addAtom(iids[aid]); err != nil {
+				return err
+			}
+		}
+		if err := nr.complete(); err != nil {
+			return err
+		}
+		nr.isAro = r.isAro
+		nr.isHetAro = r.isHetAro
+
+		if err := m.addRing(nr); err != nil {
+			return err
+		}
+		rids[r.id] = nr
+	}
+
+	for _, r := range frag.rings {
+		nr := rids[r.id]
+		for _, nid := range r.nbrs {
+			nr.nbrs = append(nr.nbrs, rids[nid].id)
+		}
+	}
+
+	for _, rs := range frag.ringSystems {
+		id, err := m.newRingSystemId()
+		if err != nil {
+			return err
+		}
+
+		nrs := newRingSystem(m, id)
+		for _, rid := range rs.rings {
+			nr := rids[rid]
+			if err := nrs.addRing(nr); err != nil {
+				return err
+			}
+			nr.rsId = id
+		}
+		nrs.isAro = rs.isAro
+		m.ringSystems = append(m.ringSystems, nrs)
+	}
+
+	return nil
+}
@@ -1,5 +1,12 @@
 package molecule
 
+import (
+	"fmt"
+	"time"
+
+	cmn "github.com/RxnWeaver/rxnweaver/common"
+)
+
 // RequestType enumerates the requests understood by a molecule.
 type RequestType uint8
 
@@ -21,11 +28,16 @@ type StatusType uint16
 // Thus, it is highly imperative that other agents that correspond
 // with a molecule be aware of what requests molecules understand, and
 // what payloads are to be delivered as part of the message.
+//
+// A request may carry a deadline.  A molecule that receives a request
+// after its deadline has passed does not process it, and replies with
+// `StDeadlineExceeded` instead.  The zero value means no deadline.
 type InMessage struct {
 	Request    RequestType
 	Cookie     uint64
 	OutChannel chan OutMessage
 	Payload    interface{}
+	Deadline   time.Time
 }
 
 // OutMessage is a message sent by a molecule in response to an
@@ -40,6 +52,9 @@ type InMessage struct {
 // Thus, it is highly imperative that other agents that correspond
 // with a molecule be aware of what responses molecules send, and what
 // payloads are delivered as part of the message.
+//
+// The payload of every reply whose status is not `StSuccess` is a
+// `*RequestError`.
 type OutMessage struct {
 	Status  StatusType
 	Cookie  uint64
@@ -50,12 +65,101 @@ type OutMessage struct {
 const ReqChanSize = 5
 
 // Constants representing the requests understood by a molecule.
+//
+// The payload expected with each request, and the payload answered
+// in the corresponding reply, are noted against it.  Requests that
+// take no payload expect `nil`.
 const (
-	ReqExit RequestType = iota
-	ReqAddAtom
-	ReqAddBond
-	ReqSetAtomAttribute
-	ReqAddTag
+	ReqExit                RequestType = iota // -> nil
+	ReqAddAtom                                // *AtomBuilder -> nil
+	ReqAddBond                                // *BondBuilder -> nil
+	ReqSetAtomAttribute                       // AtomAttribute -> nil
+	ReqSetBondAttribute                       // BondAttribute -> nil
+	ReqDeleteAtomAttribute                    // AtomAttribute -> nil
+	ReqDeleteBondAttribute                    // BondAttribute -> nil
+	ReqAddTag                                 // Attribute -> nil
+	ReqSetAttribute                           // Attribute -> nil
+	ReqDeleteAttribute                        // string -> nil
+	ReqConformAttributes                      // *AttributeSchema -> []error
+	ReqSetSource                              // SourceInfo -> nil
+	ReqRecordStep                             // ProvenanceStep -> nil
+	ReqAddConformer                           // Conformer -> Conformer
+	ReqRemoveConformer                        // int -> nil
+	ReqAlignConformers                        // int -> map[int]float64
+	ReqPruneConformers                        // PruneOptions -> []int
+	ReqMinimise                               // ForceFieldQuery -> []Conformer
+	ReqAlignConformer                         // ConformerAlignment -> float64
+	ReqAlignDepiction                         // map[uint16]Point -> float64
+	ReqSetStereoGroups                        // []StereoGroup -> nil
+	ReqSetSgroups                             // []Sgroup -> nil
+	ReqExpandSgroups                          // SgroupExpansion -> nil
+
+	ReqAtomCount         // -> int
+	ReqBondCount         // -> int
+	ReqAtomInfo          // AtomQuery -> AtomInfo
+	ReqBondInfo          // BondQuery -> BondInfo
+	ReqBondBetween       // AtomPair -> BondInfo
+	ReqNeighbours        // AtomQuery -> []Neighbour
+	ReqAtoms             // []AtomPredicate -> []AtomInfo
+	ReqBonds             // []BondPredicate -> []BondInfo
+	ReqAttribute         // string -> Attribute
+	ReqAttributes        // -> []Attribute
+	ReqAtomAttributes    // AtomQuery -> []Attribute
+	ReqBondAttributes    // BondQuery -> []Attribute
+	ReqProvenance        // -> Provenance
+	ReqConformers        // -> []Conformer
+	ReqConformerRMSD     // RMSDQuery -> float64
+	ReqConformerEnergies // ForceFieldQuery -> map[int]float64
+	ReqMMFFTypes         // -> map[uint16]int
+	ReqUFFTypes          // -> map[uint16]string
+	ReqStereoGroups      // -> []StereoGroup
+	ReqSgroups           // -> []Sgroup
+
+	ReqDistance     // AtomPair -> int
+	ReqShortestPath // AtomPair -> []uint16
+
+	ReqRingCount    // -> int
+	ReqRingInfo     // RingQuery -> RingInfo
+	ReqRingRelation // AtomPair -> cmn.RingRelation
+
+	ReqDescriptor          // DescriptorQuery -> DescriptorValue
+	ReqFingerprint         // FingerprintQuery -> []int32
+	ReqElementCounts       // -> map[uint8]int
+	ReqSubstructureMatches // SubstructureQuery -> []map[uint16]uint16
+	ReqHash                // HashOptions -> MolHash
+	ReqCanonicalRanks      // HashOptions -> map[uint16]int
+
+	ReqSetAtomCharge // AtomCharge -> nil
+	ReqSetAtomHCount // AtomHCount -> nil
+	ReqSetAttachment // AtomAttachment -> nil
+	ReqSetBondType   // BondTypeEdit -> nil
+	ReqSetAtomParity // AtomParity -> nil
+	ReqSetBondSides  // BondSides -> nil
+	ReqKekulise      // -> nil
+	ReqAromatise     // -> nil
+
+	ReqRemoveAtom  // AtomQuery -> nil
+	ReqRemoveBond  // BondQuery -> nil
+	ReqReplaceAtom // AtomReplacement -> nil
+	ReqJoinAtoms   // AtomJoin -> nil
+
+	ReqClone        // [CloneQuery] -> *Molecule
+	ReqMerge        // MergeRequest -> map[uint16]uint16
+	ReqExtractAtoms // []uint16 -> *Molecule
+	ReqApplyEdits   // []Edit -> nil
+	ReqUndo         // -> nil
+	ReqRedo         // -> nil
+	ReqFreeze       // -> *Frozen
+	ReqValidate     // -> *cmn.ValidationReport
+	ReqCheck        // *Checker -> *cmn.ValidationReport
+	ReqSanitize     // SanitizeOptions -> *cmn.ValidationReport
+	ReqEmbed        // EmbedOptions -> []Conformer
+
+	ReqEnumerateStereoisomers // int -> []*Molecule
+	ReqEpimers                // EpimerQuery -> []*Molecule
+
+	ReqSubscribe   // chan<- Event -> nil
+	ReqUnsubscribe // chan<- Event -> nil
 )
 
 // Constants representing the outcome status of a request processed by
@@ -65,4 +169,248 @@ const (
 	StNotFound
 	StAlreadyExists
 	StIncorrectParameter
+	StUnknownRequest
+	StDeadlineExceeded
+	StMoleculeExited
 )
+
+// statusNames holds the descriptive names of the statuses.
+var statusNames = map[StatusType]string{
+	StSuccess:            "success",
+	StNotFound:           "not found",
+	StAlreadyExists:      "already exists",
+	StIncorrectParameter: "incorrect parameter",
+	StUnknownRequest:     "unknown request",
+	StDeadlineExceeded:   "deadline exceeded",
+	StMoleculeExited:     "molecule exited",
+}
+
+// String answers a descriptive name of this status.
+func (st StatusType) String() string {
+	if s, ok := statusNames[st]; ok {
+		return s
+	}
+	return fmt.Sprintf("status %d", uint16(st))
+}
+
+// RequestError describes the failure of a request.  It is the payload
+// of every reply whose status is not `StSuccess`, and is also answered
+// by the blocking request methods of `Molecule`.
+type RequestError struct {
+	Request RequestType
+	Status  StatusType
+	Err     error // Underlying cause, if known.
+}
+
+// newRequestError answers an error for the given request and status.
+// The given cause is retained if it is an error.
+func newRequestError(req RequestType, st StatusType, cause interface{}) *RequestError {
+	err, _ := cause.(error)
+	return &RequestError{req, st, err}
+}
+
+// Error answers a description of this failure.
+func (e *RequestError) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("Request %d failed (%v) : %v", e.Request, e.Status, e.Err)
+	}
+	return fmt.Sprintf("Request %d failed (%v)", e.Request, e.Status)
+}
+
+// AtomQuery identifies an atom by its input ID.
+type AtomQuery struct {
+	Iid uint16
+}
+
+// BondQuery identifies a bond by its ID.
+type BondQuery struct {
+	Id uint16
+}
+
+// AtomPair identifies a pair of atoms by their input IDs.
+type AtomPair struct {
+	A1 uint16
+	A2 uint16
+}
+
+// Neighbour is an atom adjacent to a given atom, along with the bond
+// between them.
+type Neighbour struct {
+	Atom uint16 // Input ID of the neighbour.
+	Bond uint16 // ID of the bond to the neighbour.
+}
+
+// RingQuery identifies a ring by its ID.
+type RingQuery struct {
+	Id uint16
+}
+
+// DescriptorQuery names the descriptor to be computed.
+type DescriptorQuery struct {
+	Name string
+}
+
+// FingerprintQuery gives the parameters of the fingerprint to be
+// computed.  See `Molecule.Fingerprint`.
+type FingerprintQuery struct {
+	Size   int
+	Radius int
+}
+
+// AtomCharge sets the residual charge of an atom.
+type AtomCharge struct {
+	Iid    uint16
+	Charge int8
+}
+
+// AtomHCount sets the number of hydrogen atoms attached to an atom.
+type AtomHCount struct {
+	Iid    uint16
+	HCount uint8
+}
+
+// AtomAttachment sets the attachment points of a substituent at an
+// atom.  See `AtomInfo`.
+type AtomAttachment struct {
+	Iid    uint16
+	Points uint8
+}
+
+// BondTypeEdit sets the order of a bond.
+type BondTypeEdit struct {
+	Id   uint16
+	Type cmn.BondType
+}
+
+// AtomParity declares the configuration of a tetrahedral stereocentre.
+// See `Molecule.SetAtomParity`.
+type AtomParity struct {
+	Iid    uint16
+	Parity cmn.StereoParity
+}
+
+// BondSides declares the configuration of a double bond.  See
+// `Molecule.SetBondSides`.
+type BondSides struct {
+	Id    uint16
+	Sides int8
+}
+
+// AtomAttribute is an attribute of an atom.  Only its name is
+// significant when deleting.
+type AtomAttribute struct {
+	Iid  uint16
+	Attr Attribute
+}
+
+// BondAttribute is an attribute of a bond.  Only its name is
+// significant when deleting.
+type BondAttribute struct {
+	Id   uint16
+	Attr Attribute
+}
+
+// AtomReplacement is the payload of `ReqReplaceAtom`.
+type AtomReplacement struct {
+	Iid    uint16
+	Symbol string // Symbol of the new element.
+}
+
+// AtomJoin is the payload of `ReqJoinAtoms`.
+type AtomJoin struct {
+	A1, A2 uint16 // Input IDs of the terminal atoms replaced.
+	Type   cmn.BondType
+}
+
+// CloneQuery is the optional payload of `ReqClone`.
+type CloneQuery struct {
+	Passive bool // Should the copy be passive, regardless of the original?
+}
+
+// EpimerQuery is the payload of `ReqEpimers`.  See `Molecule.Epimers`
+// and `Molecule.Diastereomers`.
+type EpimerQuery struct {
+	Centres  []uint16 // Input IDs of the stereocentres; all, if none.
+	Combined bool     // Invert the centres in all combinations, rather than singly?
+	MaxN     int      // Of the combinations answered.
+}
+
+// SgroupExpansion is the payload of `ReqExpandSgroups`.  See
+// `Molecule.ExpandSgroups`.
+type SgroupExpansion struct {
+	Indices  []int // Positions of the superatoms among the Sgroups; all, if none.
+	Expanded bool
+}
+
+// MergeLink describes the bond formed between a molecule and another
+// being merged into it.
+type MergeLink struct {
+	Atom      uint16 // Input ID of the atom in the receiving molecule.
+	OtherAtom uint16 // Input ID of the atom in the other molecule.
+	Type      cmn.BondType
+}
+
+// MergeRequest is the payload of `ReqMerge`.  The fragment must be a
+// passive molecule, which the receiving molecule reads, but does not
+// modify.
+type MergeRequest struct {
+	Fragment *Molecule
+	Link     *MergeLink // Optional.
+}
+
+// AtomInfo is a snapshot of the state of an atom, answered to
+// external agents.
+type AtomInfo struct {
+	Iid          uint16
+	Nid          uint16
+	AtomicNumber uint8
+	Symbol       string
+	Isotope      uint16 // Mass number; `0` if unspecified.
+	Charge       int8
+	HCount       uint8
+	Valence      int8
+	Radical      cmn.Radical
+	X, Y, Z      float32
+	IsAromatic   bool
+	IsCyclic     bool
+	StereoType   cmn.StereoType    // Of the stereocentre this atom is, if perceived.
+	CIP          cmn.CIPDescriptor // Its configuration, if determined.
+	Parity       cmn.StereoParity  // Its MDL parity, by the input IDs of its neighbours.
+	RGroup       uint8             // Of an `R` atom, the number of its R-group; `0` if none.
+	Attachment   uint8             // Attachment points of a substituent at this atom: `1`, `2` or both, `3`.
+	Deuterium    uint8             // Of its hydrogens, those of deuterium.
+	Tritium      uint8             // Of its hydrogens, those of tritium.
+	Counted      bool              // Of a hydrogen atom, whether counted in the hydrogen count of its former neighbour.
+	Neighbours   []uint16          // Input IDs of distinct neighbours.
+}
+
+// BondInfo is a snapshot of the state of a bond, answered to external
+// agents.
+type BondInfo struct {
+	Id         uint16
+	A1         uint16
+	A2         uint16
+	Type       cmn.BondType // As given, aromatic bonds among them.
+	KekuleType cmn.BondType // Of an aromatic or a query bond, as perceived; otherwise, its type.
+	Stereo     cmn.BondStereo
+	IsAromatic bool
+	IsCyclic   bool
+	StereoType cmn.StereoType    // Of the stereogenic unit this bond is, if perceived.
+	CIP        cmn.CIPDescriptor // Its configuration, if determined.
+	Sides      int8              // `1` if cis, `-1` if trans, by the input IDs of its substituents.
+}
+
+// RingInfo is a snapshot of the state of a ring, answered to external
+// agents.
+type RingInfo struct {
+	Id         uint16
+	Atoms      []uint16
+	Bonds      []uint16
+	IsAromatic bool
+}
+
+// DescriptorValue is the computed value of a named descriptor.
+type DescriptorValue struct {
+	Name  string
+	Value float64
+}
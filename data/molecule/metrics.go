@@ -0,0 +1,114 @@
+package molecule
+
+import (
+	"context"
+	"expvar"
+	"fmt"
+	"io"
+	"runtime"
+	"time"
+)
+
+// MetricsTimeout bounds the time for which `PublishExpvar` waits for
+// the molecules of a registry to answer.
+const MetricsTimeout = 2 * time.Second
+
+// RegistryMetrics is a summary of the state of the molecules of a
+// registry, for operating long-running services.  See
+// `MoleculeRegistry.Metrics`.
+type RegistryMetrics struct {
+	Molecules  int // Number tracked.
+	Atoms      int // Total over those that answered.
+	Bonds      int // Total over those that answered.
+	Unanswered int // Number that exited, or did not answer in time.
+
+	Goroutines int // Of the whole process, including those of molecules.
+	Backlog    int // Requests queued in the input channels of all molecules.
+	MaxBacklog int // Requests queued in the longest input channel.
+	Saturated  int // Number of molecules whose input channels are full.
+
+	Evicted uint64 // Number of molecules evicted so far; see `EvictionPolicy`.
+}
+
+// Metrics answers the metrics of a snapshot of the molecules of this
+// registry.  See `List`.
+//
+// Counting atoms and bonds needs a request to each molecule, which
+// waits behind those already queued.  Molecules that have not answered
+// by the time the given context is done are not waited for, but
+// counted as unanswered.  Backlogs are read without requests.
+func (reg *MoleculeRegistry) Metrics(ctx context.Context) RegistryMetrics {
+	mols := reg.snapshot()
+	res := RegistryMetrics{Molecules: len(mols), Goroutines: runtime.NumGoroutine(), Evicted: reg.Evicted()}
+
+	for _, mol := range mols {
+		n := len(mol.inChannel)
+		res.Backlog += n
+		if n > res.MaxBacklog {
+			res.MaxBacklog = n
+		}
+		if n == cap(mol.inChannel) {
+			res.Saturated++
+		}
+	}
+
+	for _, mol := range mols {
+		if ctx.Err() != nil {
+			res.Unanswered++
+			continue
+		}
+		na, err1 := mol.CallContext(ctx, ReqAtomCount, nil)
+		nb, err2 := mol.CallContext(ctx, ReqBondCount, nil)
+		if err1 != nil || err2 != nil {
+			res.Unanswered++
+			continue
+		}
+		res.Atoms += na.Payload.(int)
+		res.Bonds += nb.Payload.(int)
+	}
+
+	return res
+}
+
+// PublishExpvar publishes the metrics of this registry as the `expvar`
+// variable of the given name, computed afresh whenever it is read, as
+// from `/debug/vars`.  Molecules are waited for as long as
+// `MetricsTimeout`.
+//
+// As with `expvar.Publish`, publishing a name twice panics.
+func (reg *MoleculeRegistry) PublishExpvar(name string) {
+	expvar.Publish(name, expvar.Func(func() interface{} {
+		ctx, cancel := context.WithTimeout(context.Background(), MetricsTimeout)
+		defer cancel()
+		return reg.Metrics(ctx)
+	}))
+}
+
+// WritePrometheus writes these metrics in the text exposition format
+// of Prometheus, with the given prefix to their names, such as
+// `rxnweaver_registry_`.
+func (m RegistryMetrics) WritePrometheus(w io.Writer, prefix string) error {
+	for _, g := range []struct {
+		name  string
+		kind  string
+		help  string
+		value uint64
+	}{
+		{"molecules", "gauge", "Number of molecules tracked by the registry.", uint64(m.Molecules)},
+		{"atoms", "gauge", "Total number of atoms of the molecules that answered.", uint64(m.Atoms)},
+		{"bonds", "gauge", "Total number of bonds of the molecules that answered.", uint64(m.Bonds)},
+		{"unanswered_molecules", "gauge", "Number of molecules that did not answer in time.", uint64(m.Unanswered)},
+		{"goroutines", "gauge", "Number of goroutines of the process.", uint64(m.Goroutines)},
+		{"backlog_requests", "gauge", "Number of requests queued for the molecules.", uint64(m.Backlog)},
+		{"max_backlog_requests", "gauge", "Number of requests queued for the busiest molecule.", uint64(m.MaxBacklog)},
+		{"saturated_molecules", "gauge", "Number of molecules whose input channels are full.", uint64(m.Saturated)},
+		{"evicted_molecules_total", "counter", "Number of molecules evicted by the registry.", m.Evicted},
+	} {
+		_, err := fmt.Fprintf(w, "# HELP %s%s %s\n# TYPE %s%s %s\n%s%s %d\n",
+			prefix, g.name, g.help, prefix, g.name, g.kind, prefix, g.name, g.value)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,726 @@
+package molecule
+
+import (
+	"fmt"
+	"math"
+
+	cmn "github.com/RxnWeaver/rxnweaver/common"
+)
+
+// _MMFFType describes an MMFF94 atom type: its symbol, its
+// hybridisation, and its van der Waals parameters.
+type _MMFFType struct {
+	symbol     string
+	sp         int     // `1`, `2` or `3` for linear, trigonal and tetrahedral centres; `0` for terminal atoms.
+	alpha      float64 // Polarisability.
+	n          float64 // Effective number of valence electrons.
+	a, g       float64 // Scaling factors.
+	donor, acc bool    // Hydrogen bond donor or acceptor?
+}
+
+// mmffTypeTable holds the MMFF94 atom types assigned by `mmffTypes`.
+// The van der Waals parameters are those of MMFF94.
+var mmffTypeTable = map[int]_MMFFType{
+	1:  {"CR", 3, 1.050, 2.490, 3.890, 1.282, false, false},
+	2:  {"C=C", 2, 1.350, 2.490, 3.890, 1.282, false, false},
+	3:  {"C=O", 2, 1.100, 2.490, 3.890, 1.282, false, false},
+	4:  {"CSP", 1, 1.300, 2.490, 3.890, 1.282, false, false},
+	5:  {"HC", 0, 0.250, 0.800, 4.200, 1.209, false, false},
+	6:  {"OR", 3, 0.700, 3.150, 3.890, 1.282, false, true},
+	7:  {"O=C", 0, 0.650, 3.150, 3.890, 1.282, false, true},
+	8:  {"NR", 3, 1.150, 2.820, 3.890, 1.282, false, true},
+	9:  {"N=C", 2, 0.900, 2.820, 3.890, 1.282, false, true},
+	10: {"NC=O", 2, 1.000, 2.820, 3.890, 1.282, false, false},
+	11: {"F", 0, 0.350, 3.480, 3.890, 1.282, false, true},
+	12: {"CL", 0, 2.300, 5.100, 3.320, 1.345, false, true},
+	13: {"BR", 0, 3.400, 6.000, 3.190, 1.359, false, true},
+	14: {"I", 0, 5.500, 6.950, 3.080, 1.404, false, true},
+	15: {"S", 3, 3.000, 4.800, 3.320, 1.345, false, true},
+	16: {"S=C", 0, 3.900, 4.800, 3.320, 1.345, false, true},
+	17: {"S=O", 3, 2.700, 4.800, 3.320, 1.345, false, false},
+	18: {"SO2", 3, 2.100, 4.800, 3.320, 1.345, false, false},
+	19: {"SI", 3, 4.500, 4.200, 3.320, 1.345, false, false},
+	20: {"CR4R", 3, 1.050, 2.490, 3.890, 1.282, false, false},
+	21: {"HOR", 0, 0.150, 0.800, 4.200, 1.209, true, false},
+	22: {"CR3R", 3, 1.100, 2.490, 3.890, 1.282, false, false},
+	23: {"HNR", 0, 0.150, 0.800, 4.200, 1.209, true, false},
+	24: {"HOCO", 0, 0.150, 0.800, 4.200, 1.209, true, false},
+	25: {"PO4", 3, 1.600, 4.500, 3.320, 1.345, false, false},
+	26: {"P", 3, 3.600, 4.500, 3.320, 1.345, false, false},
+	27: {"HN=C", 0, 0.150, 0.800, 4.200, 1.209, true, false},
+	28: {"HNCO", 0, 0.150, 0.800, 4.200, 1.209, true, false},
+	31: {"HOH", 0, 0.150, 0.800, 4.200, 1.209, true, false},
+	32: {"O2CM", 0, 0.750, 3.150, 3.890, 1.282, false, true},
+	34: {"NR+", 3, 1.000, 2.820, 3.890, 1.282, false, false},
+	35: {"OM", 0, 1.500, 3.150, 3.890, 1.282, false, true},
+	36: {"HNR+", 0, 0.150, 0.800, 4.200, 1.209, true, false},
+	37: {"CB", 2, 1.350, 2.490, 3.890, 1.282, false, false},
+	38: {"NPYD", 2, 0.850, 2.820, 3.890, 1.282, false, true},
+	39: {"NPYL", 2, 1.100, 2.820, 3.890, 1.282, false, false},
+	40: {"NC=C", 2, 1.000, 2.820, 3.890, 1.282, false, false},
+	42: {"NSP", 0, 1.000, 2.820, 3.890, 1.282, false, true},
+	44: {"STHI", 2, 3.000, 4.800, 3.320, 1.345, false, true},
+	59: {"OFUR", 2, 0.650, 3.150, 3.890, 1.282, false, true},
+	70: {"OH2", 3, 0.870, 3.150, 3.890, 1.282, false, true},
+	71: {"HS", 0, 0.150, 0.800, 4.200, 1.209, false, false},
+	78: {"C5", 2, 1.350, 2.490, 3.890, 1.282, false, false},
+}
+
+// _MMFFElement holds the per-element constants of the empirical rules
+// of MMFF94 for missing parameters.
+type _MMFFElement struct {
+	r, chi float64 // Covalent radius and Allred-Rochow electronegativity, for bond lengths.
+	z, c   float64 // For angle bending force constants.
+	u, v   float64 // For torsions about bonds between sp2 and between sp3 atoms.
+}
+
+var mmffElements = map[uint8]_MMFFElement{
+	1:  {0.33, 2.20, 1.395, 0, 0, 0},
+	6:  {0.77, 2.50, 2.494, 1.016, 2.0, 2.12},
+	7:  {0.73, 3.07, 2.711, 1.113, 2.0, 1.5},
+	8:  {0.72, 3.50, 3.045, 1.337, 2.0, 0.2},
+	9:  {0.74, 4.10, 2.847, 0, 0, 0},
+	14: {1.15, 1.74, 2.350, 0.811, 1.25, 1.22},
+	15: {1.09, 2.06, 2.350, 1.068, 1.25, 2.4},
+	16: {1.03, 2.44, 2.298, 1.249, 1.25, 0.49},
+	17: {1.01, 2.83, 2.910, 1.078, 0, 0},
+	35: {1.15, 2.74, 3.017, 0, 0, 0},
+	53: {1.33, 2.21, 3.086, 0, 0, 0},
+}
+
+// mmffBondCharges holds the MMFF94 bond charge increments of the
+// commonest bonds: the charge acquired by an atom of the first type
+// from one of the second.  Other increments are estimated from the
+// difference in electronegativities.
+var mmffBondCharges = map[[2]int]float64{
+	{1, 5}:   0.0,
+	{2, 5}:   -0.15,
+	{3, 5}:   -0.06,
+	{37, 5}:  -0.15,
+	{78, 5}:  -0.15,
+	{1, 6}:   0.28,
+	{6, 21}:  -0.40,
+	{1, 8}:   0.27,
+	{8, 23}:  -0.36,
+	{3, 7}:   0.57,
+	{70, 31}: -0.43,
+}
+
+// Constants of the MMFF94 functional forms.
+const (
+	mmffBondUnit  = 143.9325 // md/Angstrom to kcal/mol/Angstrom^2.
+	mmffAngleUnit = 0.043844 // md Angstrom/rad^2 to kcal/mol/deg^2.
+	mmffCubicBond = -2.0     // Cubic stretch constant, per Angstrom.
+	mmffCubicBend = -0.006981
+	mmffCoulomb   = 332.0716
+	mmffChargeGap = 0.05 // Buffer of the Coulomb term, in Angstroms.
+	mmffScale14   = 0.75 // Of electrostatic 1-4 interactions.
+)
+
+// mmffTypes answers the MMFF94 types of the nodes of the given graph.
+// Carbon atoms are typed first, then other heavy atoms, nitrogen atoms,
+// whose types depend on the carbon atoms adjoining them, and finally
+// hydrogens.
+func mmffTypes(g *_FFGraph) ([]int, error) {
+	types := make([]int, len(g.atoms))
+	typeOf := func(iid uint16) int {
+		return types[g.pos[iid]]
+	}
+
+	for _, pass := range []func(a *_Atom) int{
+		func(a *_Atom) int {
+			if a.atNum == 6 {
+				return mmffCarbonType(a)
+			}
+			return 0
+		},
+		func(a *_Atom) int {
+			if a.atNum == 6 || a.atNum == 7 {
+				return 0
+			}
+			return mmffHeteroType(a, typeOf)
+		},
+		func(a *_Atom) int {
+			if a.atNum == 7 {
+				return mmffNitrogenType(a, typeOf)
+			}
+			return 0
+		},
+	} {
+		for i := 0; i < g.heavy; i++ {
+			if t := pass(g.atoms[i]); t != 0 {
+				types[i] = t
+			}
+		}
+	}
+	for i := g.heavy; i < len(g.atoms); i++ {
+		types[i] = mmffHydrogenType(g.atoms[i], typeOf)
+	}
+
+	for i := 0; i < g.heavy; i++ {
+		if types[i] <= 0 {
+			a := g.atoms[i]
+			return nil, fmt.Errorf("Atom %d (%s) of molecule %d has no MMFF94 type.", a.iId, a.symbol, g.mol.id)
+		}
+	}
+	return types, nil
+}
+
+// mmffConnectivity answers the number of atoms bonded to the given
+// atom, including its hydrogens.
+func mmffConnectivity(a *_Atom) int {
+	return len(a.adj) + int(a.hCount)
+}
+
+// mmffCarbonType answers the MMFF94 type of the given carbon atom.
+func mmffCarbonType(a *_Atom) int {
+	switch {
+	case a.isInAroRing:
+		if a.isInRingOfSize(5) && !a.isInRingOfSize(6) {
+			return 78
+		}
+		return 37
+	case a.tripleBondCount > 0 || a.doubleBondCount > 1:
+		return 4
+	case a.doubleBondCount == 1:
+		if nid, _ := a.firstDoublyBondedNeighbourId(); a.mol.atomWithIid(nid).atNum == 6 {
+			return 2
+		}
+		return 3
+	case a.isInRingOfSize(3):
+		return 22
+	case a.isInRingOfSize(4):
+		return 20
+	}
+	return 1
+}
+
+// mmffHeteroType answers the MMFF94 type of the given atom, which is
+// neither a carbon, a nitrogen nor a hydrogen atom.  It answers `-1` if
+// the atom has no type.
+func mmffHeteroType(a *_Atom, typeOf func(uint16) int) int {
+	switch a.atNum {
+	case 8:
+		switch {
+		case a.isInAroRing:
+			return 59
+		case a.doubleBondCount > 0:
+			return 7
+		case a.charge == -1:
+			for _, nbr := range a.adj {
+				if typeOf(nbr.Atom) == 3 {
+					return 32
+				}
+			}
+			return 35
+		case mmffConnectivity(a) == 2 && a.hCount == 2:
+			return 70
+		}
+		return 6
+	case 16:
+		oxo := 0
+		for _, nbr := range a.adj {
+			b := a.mol.bondWithId(nbr.Bond)
+			if b.bType == cmn.BondTypeDouble && a.mol.atomWithIid(nbr.Atom).atNum == 8 {
+				oxo++
+			}
+		}
+		switch {
+		case a.isInAroRing:
+			return 44
+		case oxo >= 2:
+			return 18
+		case oxo == 1:
+			return 17
+		case a.doubleBondCount > 0:
+			return 16
+		}
+		return 15
+	case 9:
+		return 11
+	case 17:
+		return 12
+	case 35:
+		return 13
+	case 53:
+		return 14
+	case 14:
+		return 19
+	case 15:
+		if mmffConnectivity(a) == 4 {
+			return 25
+		}
+		return 26
+	}
+	return -1
+}
+
+// mmffNitrogenType answers the MMFF94 type of the given nitrogen atom,
+// or `-1` if it has none.
+func mmffNitrogenType(a *_Atom, typeOf func(uint16) int) int {
+	switch {
+	case a.isInAroRing:
+		if mmffConnectivity(a) == 3 {
+			return 39
+		}
+		return 38
+	case a.charge == 1:
+		if a.doubleBondCount+a.tripleBondCount == 0 {
+			return 34
+		}
+		return -1
+	case a.charge != 0:
+		return -1
+	case a.tripleBondCount > 0:
+		return 42
+	case a.doubleBondCount > 0:
+		return 9
+	}
+
+	conj := false
+	for _, nbr := range a.adj {
+		switch typeOf(nbr.Atom) {
+		case 3:
+			return 10
+		case 2, 37, 78:
+			conj = true
+		}
+	}
+	if conj {
+		return 40
+	}
+	return 8
+}
+
+// mmffHydrogenType answers the MMFF94 type of a hydrogen bonded to the
+// given atom, from the type of the latter.
+func mmffHydrogenType(a *_Atom, typeOf func(uint16) int) int {
+	switch a.atNum {
+	case 7:
+		switch typeOf(a.iId) {
+		case 10:
+			return 28
+		case 9:
+			return 27
+		case 34:
+			return 36
+		}
+		return 23
+	case 8:
+		if typeOf(a.iId) == 70 {
+			return 31
+		}
+		for _, nbr := range a.adj {
+			if typeOf(nbr.Atom) == 3 {
+				return 24
+			}
+		}
+		return 21
+	case 16:
+		return 71
+	}
+	return 5
+}
+
+// _Stretch is a bond stretching term.
+type _Stretch struct {
+	i, j   int
+	kb, r0 float64
+}
+
+// _Bend is an angle bending term, with its centre `j`.
+type _Bend struct {
+	i, j, k int
+	ka, th0 float64 // Force constant, and ideal angle in degrees.
+	linear  bool
+}
+
+// _OutOfPlane is an out-of-plane bending term, of atom `l` from the
+// plane of `i`, `j` and `k`, with its centre `j`.
+type _OutOfPlane struct {
+	i, j, k, l int
+	koop       float64
+}
+
+// _Torsion is a torsion term about the bond `j`-`k`.
+type _Torsion struct {
+	i, j, k, l int
+	v1, v2, v3 float64
+}
+
+// _Pair is a non-bonded term: van der Waals and electrostatic.
+type _Pair struct {
+	i, j       int
+	rStar, eps float64
+	qq         float64 // Scaled product of the charges.
+}
+
+// _MMFF is the MMFF94 force field of a molecule.  It comprises the
+// bond stretching, angle bending, out-of-plane bending, torsion, van
+// der Waals and electrostatic terms.
+type _MMFF struct {
+	stretches []_Stretch
+	bends     []_Bend
+	oops      []_OutOfPlane
+	torsions  []_Torsion
+	pairs     []_Pair
+
+	sp []int     // Hybridisations of the nodes.
+	r0 []float64 // Ideal lengths of the bonds to hydrogens, by node.
+}
+
+// newMMFF answers the MMFF94, or MMFF94s, force field of the given
+// graph.  It answers an error if an atom has no MMFF94 type.
+func newMMFF(g *_FFGraph, opts ForceFieldOptions) (*_MMFF, error) {
+	types, err := mmffTypes(g)
+	if err != nil {
+		return nil, err
+	}
+	for i := 0; i < g.heavy; i++ {
+		if a := g.atoms[i]; mmffElements[a.atNum].r == 0 {
+			return nil, fmt.Errorf("Atom %d (%s) of molecule %d has no MMFF94 parameters.", a.iId, a.symbol, g.mol.id)
+		}
+	}
+
+	n := len(g.atoms)
+	ff := &_MMFF{sp: make([]int, n), r0: make([]float64, n)}
+	for i, t := range types {
+		ff.sp[i] = mmffTypeTable[t].sp
+	}
+
+	r0 := make(map[[2]int]float64, len(g.bonds))
+	for _, b := range g.bonds {
+		zi, zj := g.atNum(b.i), g.atNum(b.j)
+		r := mmffBondLength(zi, zj, b)
+		r0[[2]int{b.i, b.j}], r0[[2]int{b.j, b.i}] = r, r
+		if g.isH[b.j] {
+			ff.r0[b.j] = r
+		}
+		ff.stretches = append(ff.stretches, _Stretch{b.i, b.j, mmffBondStiffness(zi, zj, r), r})
+	}
+
+	for j := 0; j < g.heavy; j++ {
+		t := mmffTypeTable[types[j]]
+		nbrs := g.adj[j]
+		for x, i := range nbrs {
+			for _, k := range nbrs[x+1:] {
+				ring := g.ringSize(i, j, k)
+				th0 := mmffAngle(t.sp, types[j], ring, opts.Static)
+				ka := mmffBendStiffness(g.atNum(i), g.atNum(j), g.atNum(k), r0[[2]int{i, j}], r0[[2]int{j, k}], th0)
+				switch ring {
+				case 3:
+					ka *= 0.05
+				case 4:
+					ka *= 0.85
+				}
+				ff.bends = append(ff.bends, _Bend{i, j, k, ka, th0, t.sp == 1})
+			}
+		}
+
+		if len(nbrs) == 3 {
+			if koop := mmffOutOfPlane(types[j], opts.Static); koop > 0 {
+				for x := 0; x < 3; x++ {
+					ff.oops = append(ff.oops, _OutOfPlane{nbrs[x], j, nbrs[(x+1)%3], nbrs[(x+2)%3], koop})
+				}
+			}
+		}
+	}
+
+	for _, b := range g.bonds {
+		j, k := b.i, b.j
+		v1, v2, v3 := mmffTorsion(b, mmffTypeTable[types[j]], mmffTypeTable[types[k]], g.atNum(j), g.atNum(k), opts.Static)
+		if v1 == 0 && v2 == 0 && v3 == 0 {
+			continue
+		}
+		for _, i := range g.adj[j] {
+			if i == k {
+				continue
+			}
+			for _, l := range g.adj[k] {
+				if l == j || l == i {
+					continue
+				}
+				ff.torsions = append(ff.torsions, _Torsion{i, j, k, l, v1, v2, v3})
+			}
+		}
+	}
+
+	ff.setPairs(g, types, mmffCharges(g, types), opts)
+	return ff, nil
+}
+
+// mmffBondLength answers the ideal length of the given bond between
+// atoms of the given elements, by the modified Schomaker-Stevenson
+// rule of MMFF94.  The radii of atoms are shortened for multiple
+// bonds.
+func mmffBondLength(z1, z2 uint8, b _FFBond) float64 {
+	e1, e2 := mmffElements[z1], mmffElements[z2]
+	shrink := 0.0
+	switch {
+	case b.isAro:
+		shrink = 0.075
+	case b.bType == cmn.BondTypeDouble:
+		shrink = 0.10
+	case b.bType == cmn.BondTypeTriple:
+		shrink = 0.17
+	}
+	c := 0.085
+	if z1 == 1 || z2 == 1 {
+		c = 0.050
+	}
+	return e1.r + e2.r - 2*shrink - c*math.Pow(math.Abs(e1.chi-e2.chi), 1.4) - 0.008
+}
+
+// mmffBondStiffness answers the stretching force constant, in
+// md/Angstrom, of a bond of the given ideal length, by Badger's rule.
+// Its constants are fitted to the MMFF94 parameters of C-C and C=C
+// bonds, and of C-H and O-H bonds for bonds to hydrogen.
+func mmffBondStiffness(z1, z2 uint8, r0 float64) float64 {
+	if z1 == 1 || z2 == 1 {
+		return math.Pow(10, -(r0-1.468)/0.553)
+	}
+	return math.Pow(10, -(r0-1.823)/0.501)
+}
+
+// mmffAngle answers the ideal angle, in degrees, at a centre of the
+// given hybridisation and type, in a ring of the given size, if
+// non-zero.
+func mmffAngle(sp, t, ring int, static bool) float64 {
+	switch ring {
+	case 3:
+		return 60
+	case 4:
+		return 90
+	}
+	switch {
+	case sp == 1:
+		return 180
+	case sp == 2 && ring == 5:
+		return 108
+	case t == 40 && !static:
+		return 116
+	case sp == 2:
+		return 120
+	case t == 6:
+		return 108.5
+	case t == 70:
+		return 103.9
+	case t == 15:
+		return 99
+	}
+	return 109.47
+}
+
+// mmffBendStiffness answers the bending force constant, in md
+// Angstrom/rad^2, of an angle between atoms of the given elements, by
+// the empirical rule of MMFF94.
+func mmffBendStiffness(zi, zj, zk uint8, rij, rjk, th0 float64) float64 {
+	ei, ek := mmffElements[zi].z, mmffElements[zk].z
+	cj := mmffElements[zj].c
+	if cj == 0 {
+		cj = 1
+	}
+	th := th0 * math.Pi / 180
+	d := (rij - rjk) * (rij - rjk) / ((rij + rjk) * (rij + rjk))
+	return 1.75 * ei * cj * ek / ((rij + rjk) * th * th * math.Exp(2*d))
+}
+
+// mmffOutOfPlane answers the out-of-plane bending force constant of a
+// trigonal centre of the given type, or `0` if it has none.  MMFF94s
+// holds the nitrogens of amides and anilines planar.
+func mmffOutOfPlane(t int, static bool) float64 {
+	switch t {
+	case 2, 37, 78, 39:
+		return 0.040
+	case 3:
+		return 0.130
+	case 10:
+		if static {
+			return 0.100
+		}
+		return 0.030
+	case 40:
+		if static {
+			return 0.100
+		}
+		return 0.015
+	}
+	return 0
+}
+
+// mmffTorsion answers the torsion constants about the given bond,
+// between atoms of the given types and elements, by the empirical
+// rules of MMFF94.
+func mmffTorsion(b _FFBond, tj, tk _MMFFType, zj, zk uint8, static bool) (float64, float64, float64) {
+	ej, ek := mmffElements[zj], mmffElements[zk]
+	switch {
+	case tj.sp == 0 || tk.sp == 0 || tj.sp == 1 || tk.sp == 1:
+		return 0, 0, 0
+	case b.isAro:
+		return 0, 6 * 0.5 * math.Sqrt(ej.u*ek.u), 0
+	case b.bType == cmn.BondTypeDouble:
+		return 0, 6 * math.Sqrt(ej.u*ek.u), 0
+	case tj.sp == 2 && tk.sp == 2:
+		pi := 0.15
+		if zj == 7 || zk == 7 {
+			pi = 0.3
+			if static {
+				pi = 0.4
+			}
+		}
+		return 0, 6 * pi * math.Sqrt(ej.u*ek.u), 0
+	case tj.sp == 3 && tk.sp == 3:
+		return 0, 0, math.Sqrt(ej.v*ek.v) / 9
+	}
+	return 0, 0, 0.5
+}
+
+// mmffCharges answers the partial charges of the nodes of the given
+// graph, from their formal charges and the bond charge increments.
+func mmffCharges(g *_FFGraph, types []int) []float64 {
+	q := make([]float64, len(g.atoms))
+	for i := 0; i < g.heavy; i++ {
+		q[i] = float64(g.atoms[i].charge)
+	}
+	for _, b := range g.bonds {
+		i, j := b.i, b.j
+		if types[i] == types[j] {
+			continue
+		}
+		w, ok := mmffBondCharges[[2]int{types[i], types[j]}]
+		if !ok {
+			if v, ok := mmffBondCharges[[2]int{types[j], types[i]}]; ok {
+				w = -v
+			} else {
+				w = 0.3 * (mmffElements[g.atNum(j)].chi - mmffElements[g.atNum(i)].chi)
+			}
+		}
+		q[i] += w
+		q[j] -= w
+	}
+	return q
+}
+
+// setPairs sets the non-bonded terms of all pairs of nodes separated by
+// at least three bonds.
+func (ff *_MMFF) setPairs(g *_FFGraph, types []int, q []float64, opts ForceFieldOptions) {
+	diel := opts.Dielectric
+	if diel <= 0 {
+		diel = 1
+	}
+
+	n := len(g.atoms)
+	for i := 0; i < n; i++ {
+		sep := g.separations(i, 3)
+		ti := mmffTypeTable[types[i]]
+		for j := i + 1; j < n; j++ {
+			s, ok := sep[j]
+			if ok && s < 3 {
+				continue
+			}
+			tj := mmffTypeTable[types[j]]
+
+			ri, rj := ti.a*math.Pow(ti.alpha, 0.25), tj.a*math.Pow(tj.alpha, 0.25)
+			rs := 0.5 * (ri + rj)
+			if !ti.donor && !tj.donor {
+				gm := (ri - rj) / (ri + rj)
+				rs *= 1 + 0.2*(1-math.Exp(-12*gm*gm))
+			}
+			eps := 181.16 * ti.g * tj.g * ti.alpha * tj.alpha /
+				(math.Sqrt(ti.alpha/ti.n) + math.Sqrt(tj.alpha/tj.n)) / math.Pow(rs, 6)
+			if (ti.donor && tj.acc) || (ti.acc && tj.donor) {
+				rs *= 0.8
+				eps *= 0.5
+			}
+
+			qq := mmffCoulomb * q[i] * q[j] / diel
+			if s == 3 {
+				qq *= mmffScale14
+			}
+			ff.pairs = append(ff.pairs, _Pair{i, j, rs, eps, qq})
+		}
+	}
+}
+
+// hydrogenGeometry answers the hybridisations of the nodes, and the
+// ideal lengths of the bonds to hydrogens, by node.
+func (ff *_MMFF) hydrogenGeometry() ([]int, []float64) {
+	return ff.sp, ff.r0
+}
+
+// energy answers the MMFF94 energy of the given coordinates.
+func (ff *_MMFF) energy(x []Point, grad []Point) float64 {
+	e := 0.0
+
+	for _, t := range ff.stretches {
+		d := sub(x[t.i], x[t.j])
+		r := math.Sqrt(dot(d, d))
+		dr := r - t.r0
+		cs := mmffCubicBond
+		e += mmffBondUnit / 2 * t.kb * dr * dr * (1 + cs*dr + 7.0/12*cs*cs*dr*dr)
+		if grad != nil && r > 0 {
+			de := mmffBondUnit / 2 * t.kb * (2*dr + 3*cs*dr*dr + 7.0/3*cs*cs*dr*dr*dr)
+			addPairGradient(grad, t.i, t.j, d, de/r)
+		}
+	}
+
+	for _, t := range ff.bends {
+		th, gi, gj, gk := angleGradient(x[t.i], x[t.j], x[t.k])
+		de := 0.0
+		if t.linear {
+			e += mmffBondUnit * t.ka * (1 + math.Cos(th))
+			de = -mmffBondUnit * t.ka * math.Sin(th)
+		} else {
+			dt := th*180/math.Pi - t.th0
+			e += mmffAngleUnit / 2 * t.ka * dt * dt * (1 + mmffCubicBend*dt)
+			de = mmffAngleUnit / 2 * t.ka * (2*dt + 3*mmffCubicBend*dt*dt) * 180 / math.Pi
+		}
+		if grad != nil {
+			addScaled(grad, t.i, gi, de)
+			addScaled(grad, t.j, gj, de)
+			addScaled(grad, t.k, gk, de)
+		}
+	}
+
+	for _, t := range ff.oops {
+		f := func(x []Point) float64 {
+			chi := wilsonAngle(x[t.i], x[t.j], x[t.k], x[t.l]) * 180 / math.Pi
+			return mmffAngleUnit / 2 * t.koop * chi * chi
+		}
+		e += f(x)
+		if grad != nil {
+			numericGradient(f, x, grad, t.i, t.j, t.k, t.l)
+		}
+	}
+
+	for _, t := range ff.torsions {
+		phi, gi, gj, gk, gl := dihedralGradient(x[t.i], x[t.j], x[t.k], x[t.l])
+		e += 0.5 * (t.v1*(1+math.Cos(phi)) + t.v2*(1-math.Cos(2*phi)) + t.v3*(1+math.Cos(3*phi)))
+		if grad != nil {
+			de := 0.5 * (-t.v1*math.Sin(phi) + 2*t.v2*math.Sin(2*phi) - 3*t.v3*math.Sin(3*phi))
+			addScaled(grad, t.i, gi, de)
+			addScaled(grad, t.j, gj, de)
+			addScaled(grad, t.k, gk, de)
+			addScaled(grad, t.l, gl, de)
+		}
+	}
+
+	for _, t := range ff.pairs {
+		d := sub(x[t.i], x[t.j])
+		r := math.Sqrt(dot(d, d))
+		rs7 := math.Pow(t.rStar, 7)
+		r7 := math.Pow(r, 7)
+		a := math.Pow(1.07*t.rStar/(r+0.07*t.rStar), 7)
+		b := 1.12*rs7/(r7+0.12*rs7) - 2
+		ec := t.qq / (r + mmffChargeGap)
+		e += t.eps*a*b + ec
+		if grad != nil && r > 0 {
+			da := -7 * a / (r + 0.07*t.rStar)
+			db := -1.12 * rs7 * 7 * math.Pow(r, 6) / ((r7 + 0.12*rs7) * (r7 + 0.12*rs7))
+			de := t.eps*(da*b+a*db) - ec/(r+mmffChargeGap)
+			addPairGradient(grad, t.i, t.j, d, de/r)
+		}
+	}
+
+	return e
+}
@@ -1,7 +1,12 @@
 package molecule
 
 import (
+	"context"
+	"fmt"
+	"math"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	cmn "github.com/RxnWeaver/rxnweaver/common"
 )
@@ -10,135 +15,231 @@ import (
 // globally-unique ID to each molecule.
 type nextMolIdHolder struct {
 	mu     sync.Mutex
-	nextId uint32
+	nextId uint64
 }
 
 // The only instance of `nextMolIdHolder`.
 var nextMolId nextMolIdHolder
 
-func nextMoleculeId() uint32 {
+// nextMoleculeId answers the next globally-unique molecule ID.
+//
+// IDs are never reused.  Since a wrapped-around ID could collide with
+// that of a live molecule, exhaustion of the IDs is fatal.
+func nextMoleculeId() uint64 {
 	nextMolId.mu.Lock()
 	defer nextMolId.mu.Unlock()
 
-	nextMolId.nextId++
-	return nextMolId.nextId
-}
-
-// molecules holds all the molecules that are currently alive.
-type molecules struct {
-	allMolecules map[uint32]*Molecule
-}
-
-// MoleculeWithId answers the molecule instance with the given ID, if
-// one such exists.
-func (ms *molecules) MoleculeWithId(id uint32) *Molecule {
-	if mol, ok := ms.allMolecules[id]; ok {
-		return mol
-	}
-
-	return nil
-}
-
-// Clear sends a termination request to all the alive molecules, and
-// stops tracking them.
-func (ms *molecules) Clear() {
-	for id, mol := range ms.allMolecules {
-		msg := InMessage{ReqExit, 0, nil, nil}
-		mol.InChannel() <- msg
-		delete(ms.allMolecules, id)
+	if nextMolId.nextId == math.MaxUint64 {
+		panic("Molecule IDs exhausted!")
 	}
-}
-
-// The only instance of `molecules`.
-var AllMolecules molecules
 
-// Initialise the global molecule cache.
-func init() {
-	AllMolecules.allMolecules = make(map[uint32]*Molecule)
+	nextMolId.nextId++
+	return nextMolId.nextId
 }
 
 // Molecule represents a chemical molecule.
 //
 // It holds information concerning its atom, bonds, rings, etc.  Note
-// that a molecule is expected to be a single connected component.
+// that a molecule is expected to be a single connected component;
+// salts, hydrates and mixtures are represented by `substance.Substance`.
 type Molecule struct {
-	id uint32 // The globally-unique ID of this molecule.
+	id uint64 // The globally-unique ID of this molecule.
+
+	// When this molecule last received a request, in Unix nanoseconds.
+	// It is accessed atomically, and so is kept 64-bit aligned, first
+	// after the ID.
+	lastUsed int64
+
+	// Number of handles to this molecule yet to be released; `-1` once
+	// the last is.  Accessed atomically, as above.  See `Handle`.
+	refs int64
+
+	registry *MoleculeRegistry // Registry tracking this molecule.
 
 	// Channel on which this molecule receives requests and
 	// notifications.
 	inChannel chan InMessage
 
+	// Channel closed when this molecule's event loop terminates.
+	done chan struct{}
+
+	passive bool // Does this molecule serve requests without a goroutine?
+
 	atoms       []*_Atom       // List of atoms in this molecule.
 	bonds       []*_Bond       // List of bonds in this molecule.
 	rings       []*_Ring       // List of rings in this molecule.
 	ringSystems []*_RingSystem // List of ring systems in this molecule.
 
+	// Indices for constant-time look-ups of atoms and bonds.  They are
+	// kept in sync with the lists above.
+	atomsByIid  map[uint16]*_Atom
+	atomsByNid  map[uint16]*_Atom
+	bondsById   map[uint16]*_Bond
+	bondsByPair map[uint32]*_Bond // Keyed by `atomPairKey`.
+
 	nextAtomIid      uint16 // Running number for atom input IDs.
 	nextBondId       uint16 // Running number for bond IDs.
-	nextRingId       uint8  // Running number for ring IDs.
-	nextRingSystemId uint8  // Running number for ring system IDs.
+	nextRingId       uint16 // Running number for ring IDs.
+	nextRingSystemId uint16 // Running number for ring system IDs.
 
 	vendor           string // Optional string identifying the supplier.
 	vendorMoleculeId string // Optional supplier-specified ID.
 
+	source SourceInfo       // Optional record this molecule was read from.
+	steps  []ProvenanceStep // Standardisation steps applied, in order.
+
 	attributes []Attribute // Optional list of annotations.
 
-	dists [][]int // Matrix of pair-wise distances between atoms.
-	paths [][]int // Lists of pair-wise paths between atoms.
+	conformers      []Conformer // 3D coordinate sets, in the order of their addition.
+	nextConformerId int         // Running number for conformer IDs.
+
+	stereoGroups []StereoGroup // Enhanced stereo groups, `ABS` first, then by type and number.
+	sgroups      []Sgroup      // Superatoms, repeating units and data groups, as given.
+
+	cols *_AtomColumns // Optional columnar copy of atom properties.
+
+	members *_Membership // Ring and aromaticity membership bitsets.
+
+	history *_History // Optional journal of states, for undo and redo.
+
+	buildMu   sync.Mutex // Guards the following.
+	buildErrs []error    // Errors accumulated by the chainable builder methods.
+
+	subscribers []chan<- Event // Agents notified of changes.
+	holding     bool           // Are events being held back?
+	held        []Event        // Events held back.
+
+	dists   [][]int        // Matrix of pair-wise distances between atoms.
+	paths   [][]int        // Matrix of next steps on pair-wise shortest paths.
+	distIdx map[uint16]int // Positions of atoms in the above matrices.
+}
+
+// New creates and initialises a molecule, tracked by the default
+// registry, `AllMolecules`, and configured with the given options.
+func New(opts ...Option) *Molecule {
+	return AllMolecules.NewMolecule(opts...)
 }
 
-// New creates and initialises a molecule.
-func New() *Molecule {
+// NewWithContext creates and initialises a molecule, tracked by the
+// default registry, `AllMolecules`.  The molecule's event loop
+// terminates when the given context is done, as it would upon
+// receiving `ReqExit`.
+func NewWithContext(ctx context.Context, opts ...Option) *Molecule {
+	return AllMolecules.NewMoleculeWithContext(ctx, opts...)
+}
+
+// NewPassive creates and initialises a passive molecule.
+//
+// A passive molecule has no event loop of its own.  It serves each
+// request synchronously, in the goroutine of the caller, through
+// `Call` and the methods built upon it.  It has no input channel, and
+// is not tracked by any registry.  This avoids the cost of a goroutine
+// per molecule in batch pipelines that process very many molecules.
+//
+// Passive molecules are NOT safe for concurrent use.  They live until
+// they receive `ReqExit`.
+func NewPassive(opts ...Option) *Molecule {
+	mol := initMolecule(nil, opts)
+	mol.passive = true
+	return mol
+}
+
+// newMolecule creates and initialises a molecule, tracked by the
+// given registry, and living until the given context is done.
+func newMolecule(ctx context.Context, reg *MoleculeRegistry, opts []Option) *Molecule {
+	mol := initMolecule(reg, opts)
+	mol.start(ctx)
+	return mol
+}
+
+// start registers this initialised molecule with its registry, and
+// starts its event loop, which lives until the given context is done.
+func (m *Molecule) start(ctx context.Context) {
+	m.inChannel = make(chan InMessage, ReqChanSize)
+	m.lastUsed = time.Now().UnixNano()
+
+	// Register this molecule before its event loop starts, so that it
+	// can be looked up as soon as it is answered.
+	m.registry.register(m)
+
+	// Start the molecule's event loop.
+	go m.run(ctx)
+}
+
+// initMolecule creates a molecule with initialised state, configured
+// with the given options, and without an event loop.
+func initMolecule(reg *MoleculeRegistry, opts []Option) *Molecule {
 	mol := new(Molecule)
 	mol.id = nextMoleculeId()
+	mol.registry = reg
 
-	mol.inChannel = make(chan InMessage, ReqChanSize)
+	mol.done = make(chan struct{})
 
 	mol.atoms = make([]*_Atom, 0, cmn.ListSizeLarge)
 	mol.bonds = make([]*_Bond, 0, cmn.ListSizeLarge)
 	mol.rings = make([]*_Ring, 0, cmn.ListSizeSmall)
 	mol.ringSystems = make([]*_RingSystem, 0, cmn.ListSizeSmall)
 
+	mol.atomsByIid = make(map[uint16]*_Atom, cmn.ListSizeLarge)
+	mol.atomsByNid = make(map[uint16]*_Atom, cmn.ListSizeLarge)
+	mol.bondsById = make(map[uint16]*_Bond, cmn.ListSizeLarge)
+	mol.bondsByPair = make(map[uint32]*_Bond, cmn.ListSizeLarge)
+
 	mol.attributes = make([]Attribute, 0, cmn.ListSizeTiny)
+	mol.members = newMembership()
 
-	// Start the molecule's event loop.
-	go mol.run()
+	for _, opt := range opts {
+		opt(mol)
+	}
 
 	return mol
 }
 
 // NewAtomBuilder answers a new atom builder.
 func (m *Molecule) NewAtomBuilder() *AtomBuilder {
-	return &AtomBuilder{m, nil}
+	return &AtomBuilder{mol: m}
 }
 
 // NewBondBuilder answers a new bond builder.
 func (m *Molecule) NewBondBuilder() *BondBuilder {
-	return &BondBuilder{m, nil}
+	return &BondBuilder{mol: m}
+}
+
+// Registry answers the registry tracking this molecule, or `nil` if
+// this molecule is passive.
+func (m *Molecule) Registry() *MoleculeRegistry {
+	return m.registry
 }
 
 // Id answers the globally-unique ID of this molecule.
-func (m *Molecule) Id() uint32 {
+func (m *Molecule) Id() uint64 {
 	return m.id
 }
 
-// InChannel answers the input channel of this molecule.
+// InChannel answers the input channel of this molecule, or `nil` if
+// this molecule is passive.
 func (m *Molecule) InChannel() chan InMessage {
 	return m.inChannel
 }
 
+// Done answers a channel that is closed when this molecule's event
+// loop terminates, or when this passive molecule receives `ReqExit`.
+// Requests sent to the molecule thereafter are not processed.
+func (m *Molecule) Done() <-chan struct{} {
+	return m.done
+}
+
 // run is the event loop of this molecule.
 //
 // It serves as the entry point of all in-coming requests from all
 // external agents.  For each request, an appropriate processing is
 // then performed, and the result returned on the channel that is part
 // of that request.
-func (m *Molecule) run() {
-	// Register this molecule in the cache.
-	AllMolecules.allMolecules[m.id] = m
-
-	// Unregister this molecule from the cache when done.
-	defer delete(AllMolecules.allMolecules, m.id)
+//
+// The loop terminates upon receiving `ReqExit`, or when the given
+// context is done, whichever happens first.
+func (m *Molecule) run(ctx context.Context) {
+	defer m.stop()
 
 	alive := true
 
@@ -149,7 +250,11 @@ liveloop:
 		}
 
 		select {
+		case <-ctx.Done():
+			alive = false
+
 		case msg := <-m.inChannel:
+			atomic.StoreInt64(&m.lastUsed, time.Now().UnixNano())
 
 			switch msg.Request {
 			case ReqExit:
@@ -162,50 +267,357 @@ liveloop:
 	}
 }
 
+// stop unregisters this molecule from its registry, if any, and then
+// signals its subscribers and those waiting on it.
+func (m *Molecule) stop() {
+	if m.registry != nil {
+		m.registry.unregister(m)
+	}
+	m.publish(EvExited, 0, 0)
+	close(m.done)
+}
+
 // processInMessage is the workhorse function of this molecule.
+//
+// It dispatches the given request to its handler, and sends the
+// handler's result on the request's out-channel, if one is given.
+//
+// Requests received after their deadlines are not processed.  Failures
+// are reported with a `*RequestError` payload.
 func (m *Molecule) processInMessage(msg InMessage) {
-	// TODO(js): Implement.
+	if !msg.Deadline.IsZero() && time.Now().After(msg.Deadline) {
+		m.reply(msg, StDeadlineExceeded, nil)
+		return
+	}
+
+	st, payload := StUnknownRequest, interface{}(nil)
+	if heavyRequests[msg.Request] {
+		m.workerPool().Do(func() {
+			st, payload = m.dispatchRecorded(msg)
+		})
+	} else {
+		st, payload = m.dispatchRecorded(msg)
+	}
+
+	m.reply(msg, st, payload)
 }
 
-// atomWithIid answers the atom for the given input ID, if found.
-// Answers `nil` otherwise.
-func (m *Molecule) atomWithIid(id uint16) *_Atom {
-	for _, a := range m.atoms {
-		if a.iId == id {
-			return a
-		}
+// dispatch processes the given request with its handler, answering the
+// handler's result.
+func (m *Molecule) dispatch(msg InMessage) (StatusType, interface{}) {
+	switch msg.Request {
+	case ReqAddAtom:
+		return m.handleAddAtom(msg.Payload)
+	case ReqAddBond:
+		return m.handleAddBond(msg.Payload)
+	case ReqAddTag:
+		return m.handleAddTag(msg.Payload)
+	case ReqSetAtomAttribute:
+		return m.handleSetAtomAttribute(msg.Payload)
+	case ReqSetBondAttribute:
+		return m.handleSetBondAttribute(msg.Payload)
+	case ReqDeleteAtomAttribute:
+		return m.handleDeleteAtomAttribute(msg.Payload)
+	case ReqDeleteBondAttribute:
+		return m.handleDeleteBondAttribute(msg.Payload)
+	case ReqSetAttribute:
+		return m.handleSetAttribute(msg.Payload)
+	case ReqDeleteAttribute:
+		return m.handleDeleteAttribute(msg.Payload)
+	case ReqConformAttributes:
+		return m.handleConformAttributes(msg.Payload)
+	case ReqSetSource:
+		return m.handleSetSource(msg.Payload)
+	case ReqRecordStep:
+		return m.handleRecordStep(msg.Payload)
+	case ReqAddConformer:
+		return m.handleAddConformer(msg.Payload)
+	case ReqRemoveConformer:
+		return m.handleRemoveConformer(msg.Payload)
+	case ReqAlignConformers:
+		return m.handleAlignConformers(msg.Payload)
+	case ReqAlignConformer:
+		return m.handleAlignConformer(msg.Payload)
+	case ReqAlignDepiction:
+		return m.handleAlignDepiction(msg.Payload)
+	case ReqConformerRMSD:
+		return m.handleConformerRMSD(msg.Payload)
+	case ReqPruneConformers:
+		return m.handlePruneConformers(msg.Payload)
+	case ReqMinimise:
+		return m.handleMinimise(msg.Payload)
+	case ReqSetStereoGroups:
+		return m.handleSetStereoGroups(msg.Payload)
+	case ReqSetSgroups:
+		return m.handleSetSgroups(msg.Payload)
+	case ReqExpandSgroups:
+		return m.handleExpandSgroups(msg.Payload)
+
+	case ReqAtomCount:
+		return StSuccess, len(m.atoms)
+	case ReqBondCount:
+		return StSuccess, len(m.bonds)
+	case ReqAtomInfo:
+		return m.handleAtomInfo(msg.Payload)
+	case ReqBondInfo:
+		return m.handleBondInfo(msg.Payload)
+	case ReqBondBetween:
+		return m.handleBondBetween(msg.Payload)
+	case ReqNeighbours:
+		return m.handleNeighbours(msg.Payload)
+	case ReqAtoms:
+		return m.handleAtoms(msg.Payload)
+	case ReqBonds:
+		return m.handleBonds(msg.Payload)
+	case ReqAttribute:
+		return m.handleAttribute(msg.Payload)
+	case ReqAttributes:
+		return m.handleAttributes(msg.Payload)
+	case ReqAtomAttributes:
+		return m.handleAtomAttributes(msg.Payload)
+	case ReqBondAttributes:
+		return m.handleBondAttributes(msg.Payload)
+	case ReqProvenance:
+		return m.handleProvenance(msg.Payload)
+	case ReqConformers:
+		return StSuccess, append([]Conformer(nil), m.conformers...)
+	case ReqConformerEnergies:
+		return m.handleConformerEnergies(msg.Payload)
+	case ReqMMFFTypes:
+		return m.handleMMFFTypes(msg.Payload)
+	case ReqUFFTypes:
+		return m.handleUFFTypes(msg.Payload)
+	case ReqStereoGroups:
+		return StSuccess, cloneStereoGroups(m.stereoGroups)
+	case ReqSgroups:
+		return StSuccess, cloneSgroups(m.sgroups)
+
+	case ReqDistance:
+		return m.handleDistance(msg.Payload)
+	case ReqShortestPath:
+		return m.handleShortestPath(msg.Payload)
+
+	case ReqRingCount:
+		return StSuccess, len(m.rings)
+	case ReqRingInfo:
+		return m.handleRingInfo(msg.Payload)
+	case ReqRingRelation:
+		return m.handleRingRelation(msg.Payload)
+
+	case ReqDescriptor:
+		return m.handleDescriptor(msg.Payload)
+	case ReqFingerprint:
+		return m.handleFingerprint(msg.Payload)
+	case ReqElementCounts:
+		return StSuccess, m.elementCounts()
+	case ReqSubstructureMatches:
+		return m.handleSubstructureMatches(msg.Payload)
+	case ReqHash:
+		return m.handleHash(msg.Payload)
+	case ReqCanonicalRanks:
+		return m.handleCanonicalRanks(msg.Payload)
+
+	case ReqSetAtomCharge:
+		return m.handleSetAtomCharge(msg.Payload)
+	case ReqSetAtomHCount:
+		return m.handleSetAtomHCount(msg.Payload)
+	case ReqSetAttachment:
+		return m.handleSetAttachment(msg.Payload)
+	case ReqSetBondType:
+		return m.handleSetBondType(msg.Payload)
+	case ReqSetAtomParity:
+		return m.handleSetAtomParity(msg.Payload)
+	case ReqSetBondSides:
+		return m.handleSetBondSides(msg.Payload)
+	case ReqKekulise:
+		return m.handleKekulise(msg.Payload)
+	case ReqAromatise:
+		return m.handleAromatise(msg.Payload)
+
+	case ReqRemoveAtom:
+		return m.handleRemoveAtom(msg.Payload)
+	case ReqRemoveBond:
+		return m.handleRemoveBond(msg.Payload)
+	case ReqReplaceAtom:
+		return m.handleReplaceAtom(msg.Payload)
+	case ReqJoinAtoms:
+		return m.handleJoinAtoms(msg.Payload)
+
+	case ReqClone:
+		return m.handleClone(msg.Payload)
+	case ReqMerge:
+		return m.handleMerge(msg.Payload)
+	case ReqExtractAtoms:
+		return m.handleExtractAtoms(msg.Payload)
+	case ReqApplyEdits:
+		return m.handleApplyEdits(msg.Payload)
+	case ReqUndo:
+		return m.handleUndo(msg.Payload)
+	case ReqRedo:
+		return m.handleRedo(msg.Payload)
+	case ReqFreeze:
+		return m.handleFreeze(msg.Payload)
+	case ReqValidate:
+		return m.handleValidate(msg.Payload)
+	case ReqCheck:
+		return m.handleCheck(msg.Payload)
+	case ReqSanitize:
+		return m.handleSanitize(msg.Payload)
+	case ReqEmbed:
+		return m.handleEmbed(msg.Payload)
+
+	case ReqEnumerateStereoisomers:
+		return m.handleEnumerateStereoisomers(msg.Payload)
+	case ReqEpimers:
+		return m.handleEpimers(msg.Payload)
+
+	case ReqSubscribe:
+		return m.handleSubscribe(msg.Payload)
+	case ReqUnsubscribe:
+		return m.handleUnsubscribe(msg.Payload)
+	}
+
+	return StUnknownRequest, nil
+}
+
+// reply sends the given result on the given request's out-channel, if
+// one is given.  The payload of a failed request is replaced by a
+// `*RequestError`, retaining the original payload as its cause if that
+// is an error.
+func (m *Molecule) reply(msg InMessage, st StatusType, payload interface{}) {
+	if msg.OutChannel == nil {
+		return
+	}
+
+	if st != StSuccess {
+		payload = newRequestError(msg.Request, st, payload)
+	}
+	msg.OutChannel <- OutMessage{st, msg.Cookie, payload}
+}
+
+// addAtom adds the given atom to this molecule.
+//
+// The atom's input ID must be the next in sequence.
+func (m *Molecule) addAtom(a *_Atom) error {
+	if a.iId != m.nextAtomIid {
+		return fmt.Errorf("Possible out-of-sequence parsing.  Expected atom input ID : %d, given : %d", m.nextAtomIid, a.iId)
 	}
 
+	a.mol = m
+	m.atoms = append(m.atoms, a)
+	m.atomsByIid[a.iId] = a
+	if m.cols != nil {
+		m.cols.appendAtom(a)
+	}
+	if a.nId != 0 {
+		m.atomsByNid[a.nId] = a
+	}
+	m.nextAtomIid++
 	return nil
 }
 
-// atomWithNid answers the atom for the given normalised ID, if found.
-// Answers `nil` otherwise.
-func (m *Molecule) atomWithNid(id uint16) *_Atom {
-	for _, a := range m.atoms {
-		if a.nId == id {
-			return a
-		}
+// setAtomNid sets the normalised ID of the given atom of this molecule,
+// keeping the index of normalised IDs in sync.
+func (m *Molecule) setAtomNid(a *_Atom, nid uint16) {
+	if cur, ok := m.atomsByNid[a.nId]; ok && cur == a {
+		delete(m.atomsByNid, a.nId)
+	}
+
+	a.nId = nid
+	if nid != 0 {
+		m.atomsByNid[nid] = a
+	}
+}
+
+// addBond adds the given bond to this molecule, and registers it with
+// both of its atoms.
+//
+// The bond's ID must be the next in sequence.  Both its atoms must
+// already be present in this molecule, and must not already be bonded
+// to each other.
+func (m *Molecule) addBond(b *_Bond) error {
+	if b.id != m.nextBondId {
+		return fmt.Errorf("Possible out-of-sequence parsing.  Expected bond ID : %d, given : %d", m.nextBondId, b.id)
 	}
 
+	a1 := m.atomWithIid(b.a1)
+	a2 := m.atomWithIid(b.a2)
+	if a1 == nil || a2 == nil {
+		return fmt.Errorf("Bond %d refers to unknown atoms : %d, %d", b.id, b.a1, b.a2)
+	}
+	if m.bondBetween(b.a1, b.a2) != nil {
+		return fmt.Errorf("Atoms %d and %d are already bonded.", b.a1, b.a2)
+	}
+
+	b.mol = m
+	m.bonds = append(m.bonds, b)
+	m.bondsById[b.id] = b
+	m.bondsByPair[atomPairKey(b.a1, b.a2)] = b
+	a1.addBond(b)
+	a2.addBond(b)
+	m.syncAtom(a1)
+	m.syncAtom(a2)
+	m.nextBondId++
 	return nil
 }
 
+// newRingId answers the next ring ID of this molecule.  Like atom and
+// bond IDs, ring IDs begin at 1.
+//
+// An error is answered if the molecule has exhausted its ring IDs.
+func (m *Molecule) newRingId() (uint16, error) {
+	if m.nextRingId == math.MaxUint16 {
+		return 0, fmt.Errorf("Too many rings in molecule %d : at most %d are supported.", m.id, math.MaxUint16)
+	}
+
+	m.nextRingId++
+	return m.nextRingId, nil
+}
+
+// newRingSystemId answers the next ring system ID of this molecule.
+// Ring system IDs begin at 1.
+//
+// An error is answered if the molecule has exhausted its ring system
+// IDs.
+func (m *Molecule) newRingSystemId() (uint16, error) {
+	if m.nextRingSystemId == math.MaxUint16 {
+		return 0, fmt.Errorf("Too many ring systems in molecule %d : at most %d are supported.", m.id, math.MaxUint16)
+	}
+
+	m.nextRingSystemId++
+	return m.nextRingSystemId, nil
+}
+
+// atomPairKey answers a key identifying the unordered pair of the
+// given atom input IDs.
+func atomPairKey(a1id, a2id uint16) uint32 {
+	if a1id > a2id {
+		a1id, a2id = a2id, a1id
+	}
+	return uint32(a1id)<<16 | uint32(a2id)
+}
+
+// atomWithIid answers the atom for the given input ID, if found.
+// Answers `nil` otherwise.
+func (m *Molecule) atomWithIid(id uint16) *_Atom {
+	return m.atomsByIid[id]
+}
+
+// atomWithNid answers the atom for the given normalised ID, if found.
+// Answers `nil` otherwise.
+func (m *Molecule) atomWithNid(id uint16) *_Atom {
+	return m.atomsByNid[id]
+}
+
 // bondWithId answers the bond for the given ID, if found.  Answers
 // `nil` otherwise.
 func (m *Molecule) bondWithId(id uint16) *_Bond {
-	for _, b := range m.bonds {
-		if b.id == id {
-			return b
-		}
-	}
-
-	return nil
+	return m.bondsById[id]
 }
 
 // ringWithId answers the ring for the given ID, if found.  Answers
 // `nil` otherwise.
-func (m *Molecule) ringWithId(id uint8) *_Ring {
+func (m *Molecule) ringWithId(id uint16) *_Ring {
 	for _, r := range m.rings {
 		if r.id == id {
 			return r
@@ -221,13 +633,14 @@ func (m *Molecule) ringWithId(id uint8) *_Ring {
 // Note that the two given atoms are represented by their input IDs,
 // NOT normalised IDs.
 func (m *Molecule) bondBetween(a1id, a2id uint16) *_Bond {
-	for _, b := range m.bonds {
-		if (b.a1 == a1id && b.a2 == a2id) || (b.a2 == a1id && b.a1 == a2id) {
-			return b
-		}
-	}
+	return m.bondsByPair[atomPairKey(a1id, a2id)]
+}
 
-	return nil
+// neighbours answers a copy of the adjacency list of the given atom:
+// its distinct neighbours, along with the bonds to them, in the order
+// in which the bonds were added.
+func (m *Molecule) neighbours(a *_Atom) []Neighbour {
+	return append([]Neighbour{}, a.adj...)
 }
 
 // bondCount answers the total number of bonds of the given type in
@@ -0,0 +1,87 @@
+package molecule
+
+import (
+	"runtime"
+)
+
+// WorkerPool bounds the number of expensive computations that run
+// concurrently, across all the molecules sharing it.
+//
+// A molecule runs each of its expensive requests (see
+// `IsHeavyRequest`) only after acquiring a slot in its pool, holding
+// it for the duration of the computation.  Since the molecule's event
+// loop waits meanwhile, its own state remains consistent.  Thus, a
+// burst of such requests across thousands of molecules does not
+// oversubscribe the processors.
+type WorkerPool struct {
+	slots chan struct{}
+}
+
+// NewWorkerPool creates a pool that runs at most the given number of
+// computations concurrently.  A non-positive size means the number of
+// logical processors.
+func NewWorkerPool(size int) *WorkerPool {
+	if size <= 0 {
+		size = runtime.NumCPU()
+	}
+
+	p := new(WorkerPool)
+	p.slots = make(chan struct{}, size)
+	return p
+}
+
+// The default pool, shared by all registries that do not have their
+// own.
+var DefaultWorkerPool = NewWorkerPool(0)
+
+// Size answers the maximum number of computations this pool runs
+// concurrently.
+func (p *WorkerPool) Size() int {
+	return cap(p.slots)
+}
+
+// Do runs the given function once a slot is available, and waits for
+// it to complete.
+func (p *WorkerPool) Do(f func()) {
+	p.slots <- struct{}{}
+	defer func() { <-p.slots }()
+
+	f()
+}
+
+// heavyRequests holds the requests whose processing is potentially
+// expensive.
+var heavyRequests = map[RequestType]bool{
+	ReqDistance:               true,
+	ReqShortestPath:           true,
+	ReqDescriptor:             true,
+	ReqFingerprint:            true,
+	ReqSubstructureMatches:    true,
+	ReqHash:                   true,
+	ReqCheck:                  true,
+	ReqSanitize:               true,
+	ReqEmbed:                  true,
+	ReqAlignConformers:        true,
+	ReqPruneConformers:        true,
+	ReqMinimise:               true,
+	ReqConformerEnergies:      true,
+	ReqEnumerateStereoisomers: true,
+	ReqEpimers:                true,
+}
+
+// IsHeavyRequest answers if the given request is processed in a
+// worker pool.
+func IsHeavyRequest(req RequestType) bool {
+	return heavyRequests[req]
+}
+
+// workerPool answers the pool in which this molecule runs its
+// expensive requests.
+func (m *Molecule) workerPool() *WorkerPool {
+	if m.registry != nil {
+		if p := m.registry.WorkerPool(); p != nil {
+			return p
+		}
+	}
+	return DefaultWorkerPool
+}
@@ -0,0 +1,121 @@
+package molecule
+
+import (
+	"fmt"
+	"time"
+)
+
+// Provenance records where a molecule came from, and what was done to
+// it since.  Regulated pipelines need to be able to trace every
+// molecule back to its source record.
+type Provenance struct {
+	Vendor           string // Optional string identifying the supplier.
+	VendorMoleculeId string // Optional supplier-specified ID.
+
+	SourceFile string    // Name of the file the molecule was read from, if any.
+	Record     int       // One-based number of its record in that file; `0` if unknown.
+	ParsedAt   time.Time // When it was read; zero if unknown.
+
+	// The standardisation steps applied to the molecule, in order.
+	Steps []ProvenanceStep
+}
+
+// ProvenanceStep records a single standardisation step applied to a
+// molecule.
+type ProvenanceStep struct {
+	Name   string    // E.g. `neutralise`.
+	Detail string    // Optional; parameters, version, etc.
+	At     time.Time // When it was applied.
+}
+
+// SourceInfo identifies the record that a molecule was read from.  It
+// is the payload of `ReqSetSource`.
+type SourceInfo struct {
+	File     string
+	Record   int
+	ParsedAt time.Time
+}
+
+// Vendor answers an option that records the supplier of a molecule,
+// and the supplier's ID for it.
+func Vendor(vendor, id string) Option {
+	return func(m *Molecule) {
+		m.vendor = vendor
+		m.vendorMoleculeId = id
+	}
+}
+
+// Source answers an option that records the file and the one-based
+// record number that a molecule is read from.  The time of parsing is
+// taken to be that of the molecule's construction.
+func Source(file string, record int) Option {
+	return func(m *Molecule) {
+		m.source = SourceInfo{file, record, time.Now()}
+	}
+}
+
+// Provenance answers the provenance of this molecule.
+func (m *Molecule) Provenance() (Provenance, error) {
+	reply := m.Call(ReqProvenance, nil)
+	if err := statusError(reply, fmt.Sprintf("molecule %d", m.id)); err != nil {
+		return Provenance{}, err
+	}
+	return reply.Payload.(Provenance), nil
+}
+
+// SetSource records the record that this molecule was read from.  A
+// zero time of parsing is taken to mean now.
+func (m *Molecule) SetSource(src SourceInfo) error {
+	if src.ParsedAt.IsZero() {
+		src.ParsedAt = time.Now()
+	}
+	return statusError(m.Call(ReqSetSource, src), fmt.Sprintf("molecule %d", m.id))
+}
+
+// RecordStep records the application of the named standardisation step
+// to this molecule, now.
+func (m *Molecule) RecordStep(name, detail string) error {
+	step := ProvenanceStep{name, detail, time.Now()}
+	return statusError(m.Call(ReqRecordStep, step), fmt.Sprintf("step %s", name))
+}
+
+// provenance answers the provenance of this molecule, sharing nothing
+// with it.
+func (m *Molecule) provenance() Provenance {
+	return Provenance{
+		Vendor:           m.vendor,
+		VendorMoleculeId: m.vendorMoleculeId,
+		SourceFile:       m.source.File,
+		Record:           m.source.Record,
+		ParsedAt:         m.source.ParsedAt,
+		Steps:            append([]ProvenanceStep{}, m.steps...),
+	}
+}
+
+// handleProvenance answers the provenance of this molecule.
+func (m *Molecule) handleProvenance(p interface{}) (StatusType, interface{}) {
+	return StSuccess, m.provenance()
+}
+
+// handleSetSource records the given source of this molecule.
+func (m *Molecule) handleSetSource(p interface{}) (StatusType, interface{}) {
+	src, ok := p.(SourceInfo)
+	if !ok || src.Record < 0 {
+		return StIncorrectParameter, nil
+	}
+
+	m.source = src
+	return StSuccess, nil
+}
+
+// handleRecordStep appends the given step to the provenance of this
+// molecule.
+func (m *Molecule) handleRecordStep(p interface{}) (StatusType, interface{}) {
+	step, ok := p.(ProvenanceStep)
+	if !ok || step.Name == "" {
+		return StIncorrectParameter, nil
+	}
+
+	m.steps = append(m.steps, step)
+	return StSuccess, nil
+}
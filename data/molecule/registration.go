@@ -0,0 +1,154 @@
+package molecule
+
+import (
+	"fmt"
+	"sync/atomic"
+)
+
+// RegisterPolicy determines how `MoleculeRegistry.Register` treats a
+// structure that is already registered.
+type RegisterPolicy uint8
+
+// Constants representing the policies of registration.
+const (
+	// Reject the new molecule, answering a `*DuplicateError`.
+	RegisterReject RegisterPolicy = iota
+	// Copy the attributes of the new molecule into the latest
+	// registered version, whose values they override.  The new
+	// molecule itself is not registered.
+	RegisterMergeAttributes
+	// Register the new molecule as the next version of the structure.
+	RegisterNewVersion
+)
+
+// Layers of the hashes used to identify registered structures.
+const registrationHashOptions = HashStereo | HashIsotopes
+
+// Registration is an entry in the structure register of a registry.
+type Registration struct {
+	Molecule *Molecule
+	Hash     MolHash // Identity of the structure.  See `Molecule.Hash128`.
+	Version  int     // One-based version of the structure.
+}
+
+// DuplicateError reports a molecule rejected by `Register`, since its
+// structure is already registered.
+type DuplicateError struct {
+	Molecule uint64       // ID of the rejected molecule.
+	Existing Registration // Latest registered version of the structure.
+}
+
+// Error answers a description of this rejection.
+func (e *DuplicateError) Error() string {
+	return fmt.Sprintf("Molecule %d duplicates registered molecule %d (version %d) : %v",
+		e.Molecule, e.Existing.Molecule.id, e.Existing.Version, e.Existing.Hash)
+}
+
+// Register adds the given molecule to the structure register of this
+// registry, resolving duplicates according to the given policy.
+//
+// Structures are identified by their canonical hashes, including
+// stereo and isotope layers; thus, the order of atoms in the input
+// does not matter.  It answers the registration now representing the
+// structure.  Under `RegisterMergeAttributes`, that is the existing
+// registration, if any.
+//
+// Only molecules tracked by this registry can be registered in it.  A
+// registered molecule leaves the register when it exits.
+func (reg *MoleculeRegistry) Register(mol *Molecule, policy RegisterPolicy) (Registration, error) {
+	if mol.registry != reg {
+		return Registration{}, fmt.Errorf("Molecule %d is not tracked by this registry.", mol.id)
+	}
+	h, err := mol.Hash128(registrationHashOptions)
+	if err != nil {
+		return Registration{}, err
+	}
+
+	reg.mu.Lock()
+	if reg.registered == nil {
+		reg.registered = make(map[MolHash][]Registration)
+		reg.regHashes = make(map[uint64]MolHash)
+	}
+	if _, ok := reg.regHashes[mol.id]; ok {
+		reg.mu.Unlock()
+		return Registration{}, fmt.Errorf("Molecule %d is already registered.", mol.id)
+	}
+
+	vers := reg.registered[h]
+	if len(vers) == 0 || policy == RegisterNewVersion {
+		r := Registration{mol, h, 1}
+		if len(vers) > 0 {
+			r.Version = vers[len(vers)-1].Version + 1
+		}
+		reg.registered[h] = append(vers, r)
+		reg.regHashes[mol.id] = h
+		atomic.AddInt64(&reg.regCount, 1)
+		reg.mu.Unlock()
+		return r, nil
+	}
+	latest := vers[len(vers)-1]
+	reg.mu.Unlock()
+
+	switch policy {
+	case RegisterReject:
+		return Registration{}, &DuplicateError{mol.id, latest}
+
+	case RegisterMergeAttributes:
+		// Outside the lock, since molecules need it to exit.
+		attrs, err := mol.Attributes()
+		if err != nil {
+			return Registration{}, err
+		}
+		for _, attr := range attrs {
+			if err := latest.Molecule.SetAttribute(attr.Name, attr.Value); err != nil {
+				return Registration{}, err
+			}
+		}
+		return latest, nil
+	}
+
+	return Registration{}, fmt.Errorf("Unknown registration policy : %d", policy)
+}
+
+// Registered answers all the registered versions of the structure with
+// the given hash, oldest first.
+func (reg *MoleculeRegistry) Registered(h MolHash) []Registration {
+	reg.mu.RLock()
+	defer reg.mu.RUnlock()
+
+	return append([]Registration{}, reg.registered[h]...)
+}
+
+// Lookup answers all the registered versions of the structure of the
+// given molecule, oldest first.
+func (reg *MoleculeRegistry) Lookup(mol *Molecule) ([]Registration, error) {
+	h, err := mol.Hash128(registrationHashOptions)
+	if err != nil {
+		return nil, err
+	}
+	return reg.Registered(h), nil
+}
+
+// deregister removes the given molecule from the structure register,
+// if it is registered.  The caller holds the lock.
+func (reg *MoleculeRegistry) deregister(mol *Molecule) {
+	h, ok := reg.regHashes[mol.id]
+	if !ok {
+		return
+	}
+	delete(reg.regHashes, mol.id)
+	atomic.AddInt64(&reg.regCount, -1)
+
+	vers := reg.registered[h]
+	for i, r := range vers {
+		if r.Molecule == mol {
+			vers = append(vers[:i], vers[i+1:]...)
+			break
+		}
+	}
+	if len(vers) == 0 {
+		delete(reg.registered, h)
+	} else {
+		reg.registered[h] = vers
+	}
+}
@@ -0,0 +1,343 @@
+package molecule
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+// MoleculeRegistry tracks a set of molecules that are currently alive.
+//
+// Each registry is an independent universe of molecules: libraries and
+// tests can hold as many as they need.  `AllMolecules` is the default
+// registry, used by `New`.
+//
+// A registry is accessed concurrently: molecules register and
+// unregister themselves from their own goroutines, while external
+// agents look them up.  All access is, therefore, synchronised.
+//
+// The molecules are held in shards, by the hashes of their IDs, each
+// under its own lock, so that thousands of molecules registering and
+// unregistering at once, as during bulk loads, seldom contend.  Only
+// the rarely-changed settings of the registry are under its own lock.
+type MoleculeRegistry struct {
+	// Accessed atomically, so first.
+	evicted    uint64 // Number of molecules evicted.
+	count      int64  // Number of molecules tracked.
+	regCount   int64  // Number of molecules in the structure register.
+	evictLimit int64  // `MaxMolecules` of the eviction policy, if any.
+
+	shards [registryShardCount]_RegistryShard
+
+	mu     sync.RWMutex
+	pool   *WorkerPool      // Optional; for expensive requests.
+	schema *AttributeSchema // Optional; for attributes.
+
+	registered map[MolHash][]Registration // Structure register; see `Register`.
+	regHashes  map[uint64]MolHash         // Hashes of registered molecules.
+
+	evictor     *_Evictor              // Optional; see `SetEvictionPolicy`.
+	collections map[string]*Collection // Named; see `NewCollection`.
+}
+
+// Number of shards of a registry, as a power of two.
+const (
+	registryShardBits  = 6
+	registryShardCount = 1 << registryShardBits
+)
+
+// _RegistryShard holds the molecules of a registry whose IDs hash to
+// it.
+type _RegistryShard struct {
+	mu   sync.RWMutex
+	mols map[uint64]*Molecule
+}
+
+// shard answers the shard of this registry holding the molecule with
+// the given ID.  IDs are issued in sequence, so they are mixed by a
+// Fibonacci hash, lest molecules created together share shards.
+func (reg *MoleculeRegistry) shard(id uint64) *_RegistryShard {
+	return &reg.shards[(id*0x9e3779b97f4a7c15)>>(64-registryShardBits)]
+}
+
+// NewRegistry creates an empty molecule registry.
+func NewRegistry() *MoleculeRegistry {
+	reg := new(MoleculeRegistry)
+	for i := range reg.shards {
+		reg.shards[i].mols = make(map[uint64]*Molecule)
+	}
+	return reg
+}
+
+// The default registry.
+var AllMolecules = NewRegistry()
+
+// NewMolecule creates and initialises a molecule tracked by this
+// registry, and configured with the given options.
+func (reg *MoleculeRegistry) NewMolecule(opts ...Option) *Molecule {
+	return newMolecule(context.Background(), reg, opts)
+}
+
+// NewMoleculeWithContext creates and initialises a molecule tracked by
+// this registry.  The molecule's event loop terminates when the given
+// context is done.
+func (reg *MoleculeRegistry) NewMoleculeWithContext(ctx context.Context, opts ...Option) *Molecule {
+	return newMolecule(ctx, reg, opts)
+}
+
+// SetWorkerPool sets the pool in which the molecules of this registry
+// run their expensive requests.  When no pool is set, or upon setting
+// `nil`, `DefaultWorkerPool` is used.
+func (reg *MoleculeRegistry) SetWorkerPool(p *WorkerPool) {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+
+	reg.pool = p
+}
+
+// WorkerPool answers the pool set for this registry, if any.  Answers
+// `nil` otherwise.
+func (reg *MoleculeRegistry) WorkerPool() *WorkerPool {
+	reg.mu.RLock()
+	defer reg.mu.RUnlock()
+
+	return reg.pool
+}
+
+// register starts tracking the given molecule.
+func (reg *MoleculeRegistry) register(mol *Molecule) {
+	sh := reg.shard(mol.id)
+	sh.mu.Lock()
+	_, ok := sh.mols[mol.id]
+	sh.mols[mol.id] = mol
+	sh.mu.Unlock()
+
+	if !ok {
+		atomic.AddInt64(&reg.count, 1)
+	}
+	reg.kickEvictor()
+}
+
+// unregister stops tracking the given molecule, if it is still being
+// tracked.
+func (reg *MoleculeRegistry) unregister(mol *Molecule) {
+	sh := reg.shard(mol.id)
+	sh.mu.Lock()
+	cur, ok := sh.mols[mol.id]
+	ok = ok && cur == mol
+	if ok {
+		delete(sh.mols, mol.id)
+	}
+	sh.mu.Unlock()
+
+	if ok {
+		atomic.AddInt64(&reg.count, -1)
+	}
+
+	// The lock of the registry is taken only when the structure register
+	// is in use.
+	if atomic.LoadInt64(&reg.regCount) > 0 {
+		reg.mu.Lock()
+		reg.deregister(mol)
+		reg.mu.Unlock()
+	}
+}
+
+// MoleculeWithId answers the molecule instance with the given ID, if
+// one such exists.
+func (reg *MoleculeRegistry) MoleculeWithId(id uint64) *Molecule {
+	sh := reg.shard(id)
+	sh.mu.RLock()
+	defer sh.mu.RUnlock()
+
+	if mol, ok := sh.mols[id]; ok {
+		return mol
+	}
+
+	return nil
+}
+
+// Count answers the number of molecules currently tracked by this
+// registry.
+func (reg *MoleculeRegistry) Count() int {
+	return int(atomic.LoadInt64(&reg.count))
+}
+
+// snapshot answers the molecules currently tracked by this registry, in
+// no particular order.  Shards are visited in turn, so that a molecule
+// created meanwhile may or may not be included.
+func (reg *MoleculeRegistry) snapshot() []*Molecule {
+	mols := make([]*Molecule, 0, reg.Count())
+	for i := range reg.shards {
+		sh := &reg.shards[i]
+		sh.mu.RLock()
+		for _, mol := range sh.mols {
+			mols = append(mols, mol)
+		}
+		sh.mu.RUnlock()
+	}
+	return mols
+}
+
+// List answers the molecules tracked by this registry, in the
+// ascending order of their IDs.
+//
+// The answer is a snapshot: molecules created afterwards are not in it,
+// and those in it may exit at any time thereafter, when requests to
+// them fail with `StMoleculeExited`.
+func (reg *MoleculeRegistry) List() []*Molecule {
+	mols := reg.snapshot()
+	sort.Slice(mols, func(i, j int) bool { return mols[i].id < mols[j].id })
+	return mols
+}
+
+// Each calls the given function with each molecule of a snapshot of
+// this registry that satisfies the given predicate, in the ascending
+// order of their IDs, until the function answers `false`.  A `nil`
+// predicate is satisfied by all molecules.  See `List`.
+//
+// No lock is held while the predicate and the function run, so that
+// they may create and release molecules of this registry, and query
+// it.
+func (reg *MoleculeRegistry) Each(pred Predicate, f func(mol *Molecule) bool) {
+	for _, mol := range reg.List() {
+		if pred != nil && !pred(mol) {
+			continue
+		}
+		if !f(mol) {
+			return
+		}
+	}
+}
+
+// Filter answers the molecules of a snapshot of this registry that
+// satisfy the given predicate, in the ascending order of their IDs.
+// See `Each`.
+func (reg *MoleculeRegistry) Filter(pred Predicate) []*Molecule {
+	res := []*Molecule(nil)
+	reg.Each(pred, func(mol *Molecule) bool {
+		res = append(res, mol)
+		return true
+	})
+	return res
+}
+
+// Predicate selects molecules when listing registries.  See
+// `MoleculeRegistry.Each`.
+//
+// Predicates query molecules through their requests, so that a molecule
+// that exits while being queried fails the predicates that query it.
+type Predicate func(mol *Molecule) bool
+
+// ByVendor answers a predicate satisfied by the molecules supplied by
+// the given vendor.  See `Vendor`.
+func ByVendor(vendor string) Predicate {
+	return func(mol *Molecule) bool {
+		prov, err := mol.Provenance()
+		return err == nil && prov.Vendor == vendor
+	}
+}
+
+// WithAttribute answers a predicate satisfied by the molecules having
+// an attribute of the given name, with the given value, or with any
+// value, if the given value is empty.  Should a molecule have several
+// attributes of that name, the most recently added one is compared.
+func WithAttribute(name, value string) Predicate {
+	return func(mol *Molecule) bool {
+		attr, err := mol.Attribute(name)
+		return err == nil && (value == "" || attr.Value == value)
+	}
+}
+
+// WithFormula answers a predicate satisfied by the molecules having the
+// given molecular formula, as answered by `Molecule.Formula`.
+func WithFormula(formula string) Predicate {
+	return func(mol *Molecule) bool {
+		reply := mol.Call(ReqElementCounts, nil)
+		return reply.Status == StSuccess && formulaOf(reply.Payload.(map[uint8]int)) == formula
+	}
+}
+
+// All answers a predicate satisfied by the molecules satisfying all
+// the given predicates, which are evaluated in order, as far as needed.
+func All(preds ...Predicate) Predicate {
+	return func(mol *Molecule) bool {
+		for _, pred := range preds {
+			if !pred(mol) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// Any answers a predicate satisfied by the molecules satisfying any of
+// the given predicates, which are evaluated in order, as far as
+// needed.
+func Any(preds ...Predicate) Predicate {
+	return func(mol *Molecule) bool {
+		for _, pred := range preds {
+			if pred(mol) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// Clear sends a termination request to all the alive molecules, stops
+// tracking them, and waits until each of their event loops has
+// terminated.
+//
+// Should the given context be done before all the molecules have
+// exited, the context's error is answered.  The molecules yet to exit
+// continue to do so in the background.
+func (reg *MoleculeRegistry) Clear(ctx context.Context) error {
+	mols := make([]*Molecule, 0, reg.Count())
+	for i := range reg.shards {
+		sh := &reg.shards[i]
+		sh.mu.Lock()
+		n := len(sh.mols)
+		for id, mol := range sh.mols {
+			mols = append(mols, mol)
+			delete(sh.mols, id)
+		}
+		sh.mu.Unlock()
+		atomic.AddInt64(&reg.count, -int64(n))
+	}
+
+	// Requests are sent outside the lock, since a molecule that is
+	// exiting needs the lock to unregister itself.
+	for i, mol := range mols {
+		select {
+		case mol.inChannel <- InMessage{Request: ReqExit}:
+		case <-mol.done:
+		case <-ctx.Done():
+			go requestExits(mols[i:])
+			return ctx.Err()
+		}
+	}
+
+	// Each molecule acknowledges its exit by closing its done channel.
+	for _, mol := range mols {
+		select {
+		case <-mol.done:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	return nil
+}
+
+// requestExits sends a termination request to each of the given
+// molecules that is still alive, waiting as long as needed.
+func requestExits(mols []*Molecule) {
+	for _, mol := range mols {
+		select {
+		case mol.inChannel <- InMessage{Request: ReqExit}:
+		case <-mol.done:
+		}
+	}
+}
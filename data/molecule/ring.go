@@ -22,12 +22,12 @@ import (
 // doing ring detection, etc.
 type _Ring struct {
 	mol  *Molecule // Containing molecule of this ring.
-	id   uint8     // A unique identifier for this ring.
-	rsId uint8     // ID of the ring system to which this ring belongs.
+	id   uint16    // A unique identifier for this ring.
+	rsId uint16    // ID of the ring system to which this ring belongs.
 
 	atoms []uint16 // List of atoms participating in this ring.
 	bonds []uint16 // List of bonds participating in this ring.
-	nbrs  []uint8  // List of rings neighbouring this ring.
+	nbrs  []uint16 // List of rings neighbouring this ring.
 
 	atomBitSet *bits.BitSet // For faster comparison.
 	bondBitSet *bits.BitSet // For faster comparison.
@@ -35,21 +35,29 @@ type _Ring struct {
 	isAro    bool // Is this ring aromatic?
 	isHetAro bool // Is this an aromatic ring with at least one hetero atom?
 
+	// Faces of this ring taken by the substituents of its atoms, by
+	// their positions: `1` or `-1` for those of determined
+	// configurations, and `0` for others.  Set by stereo perception,
+	// should the ring have two or more substituted stereo atoms.
+	faces []int8
+
 	isComplete bool // Has this ring been finalised?
 }
 
 // newRing creates and initialises a new ring.
-func newRing(mol *Molecule, id uint8) {
+func newRing(mol *Molecule, id uint16) *_Ring {
 	r := new(_Ring)
 	r.mol = mol
 	r.id = id
 
 	r.atoms = make([]uint16, 0, cmn.ListSizeSmall)
 	r.bonds = make([]uint16, 0, cmn.ListSizeSmall)
-	r.nbrs = make([]uint8, 0, cmn.ListSizeSmall)
+	r.nbrs = make([]uint16, 0, cmn.ListSizeSmall)
 
 	r.atomBitSet = bits.New(cmn.ListSizeSmall)
 	r.bondBitSet = bits.New(cmn.ListSizeSmall)
+
+	return r
 }
 
 // size answers the size of this ring.  It is equivalently the number
@@ -259,14 +267,14 @@ func (r *_Ring) determineAromaticity() {
 
 	for _, aiid := range r.atoms {
 		a := mol.atomWithIid(aiid)
-		a.isInAroRing = true
+		mol.setAtomAromatic(a)
 		if a.atNum != 6 {
 			r.isHetAro = true
 		}
 	}
 	for _, bid := range r.bonds {
 		b := mol.bondWithId(bid)
-		b.isAro = true
+		mol.setBondAromatic(b)
 	}
 }
 
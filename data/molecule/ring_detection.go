@@ -0,0 +1,206 @@
+package molecule
+
+import (
+	"fmt"
+	"sort"
+)
+
+// perceiveRings discards the current rings and ring systems of this
+// molecule, and detects them afresh.
+//
+// Atoms in terminal chains are pruned first, since they cannot
+// participate in rings.  For each remaining bond, the smallest ring
+// through it is then found by a breadth-first search that avoids the
+// bond itself.  Such a ring is necessarily genuine: a chord would
+// close a smaller ring through the same bond.  The distinct rings so
+// found comprise the smallest set of smallest rings, extended by
+// those equally small rings that symmetry makes indistinguishable
+// from its members.
+//
+// Rings sharing at least one atom are grouped into ring systems.
+// Coordination bonds, dative ones and those to metal atoms, are
+// disregarded, so that chelates and metallocenes do not close rings
+// through their metal centres.  See `doc/design/ring-detection.md`.
+func (m *Molecule) perceiveRings() error {
+	for len(m.rings) > 0 {
+		m.removeRing(m.rings[0])
+	}
+	m.ringSystems = m.ringSystems[:0]
+	m.nextRingId = 0
+	m.nextRingSystemId = 0
+
+	core := m.cyclicCore()
+	seen := make(map[string]bool)
+	for _, b := range m.bonds {
+		if !core[b.a1] || !core[b.a2] || b.isCoordination() {
+			continue
+		}
+		path := m.pathAvoiding(b, core)
+		if path == nil {
+			continue // A bridge between ring systems.
+		}
+
+		key := ringKey(m, path)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+
+		id, err := m.newRingId()
+		if err != nil {
+			return err
+		}
+		r := newRing(m, id)
+		for _, aid := range path {
+			if err := r.addAtom(aid); err != nil {
+				return err
+			}
+		}
+		if err := r.complete(); err != nil {
+			return err
+		}
+		if err := m.addRing(r); err != nil {
+			return err
+		}
+	}
+
+	return m.perceiveRingSystems()
+}
+
+// cyclicCore answers the set of atoms of this molecule that remain
+// after iteratively pruning those having at most one neighbour, other
+// than by coordination bonds.
+func (m *Molecule) cyclicCore() map[uint16]bool {
+	deg := make(map[uint16]int, len(m.atoms))
+	queue := make([]uint16, 0, len(m.atoms))
+	for _, a := range m.atoms {
+		for _, nbr := range a.adj {
+			if !m.bondWithId(nbr.Bond).isCoordination() {
+				deg[a.iId]++
+			}
+		}
+		if deg[a.iId] <= 1 {
+			queue = append(queue, a.iId)
+		}
+	}
+
+	for len(queue) > 0 {
+		aid := queue[0]
+		queue = queue[1:]
+		if deg[aid] < 0 {
+			continue
+		}
+		deg[aid] = -1
+		for _, nbr := range m.atomWithIid(aid).adj {
+			if deg[nbr.Atom] > 0 && !m.bondWithId(nbr.Bond).isCoordination() {
+				deg[nbr.Atom]--
+				if deg[nbr.Atom] == 1 {
+					queue = append(queue, nbr.Atom)
+				}
+			}
+		}
+	}
+
+	core := make(map[uint16]bool, len(deg))
+	for aid, d := range deg {
+		if d > 1 {
+			core[aid] = true
+		}
+	}
+	return core
+}
+
+// pathAvoiding answers a shortest path from the first atom of the given
+// bond to its second, through the given atoms, that does not use the
+// bond itself, nor coordination bonds.  Answers `nil` if there is no
+// such path.
+func (m *Molecule) pathAvoiding(b *_Bond, core map[uint16]bool) []uint16 {
+	prev := map[uint16]uint16{b.a1: b.a1}
+	queue := []uint16{b.a1}
+	for len(queue) > 0 {
+		aid := queue[0]
+		queue = queue[1:]
+		for _, nbr := range m.atomWithIid(aid).adj {
+			if nbr.Bond == b.id || !core[nbr.Atom] || m.bondWithId(nbr.Bond).isCoordination() {
+				continue
+			}
+			if _, ok := prev[nbr.Atom]; ok {
+				continue
+			}
+			prev[nbr.Atom] = aid
+
+			if nbr.Atom == b.a2 {
+				path := []uint16{b.a2}
+				for cur := aid; cur != b.a1; cur = prev[cur] {
+					path = append(path, cur)
+				}
+				return append(path, b.a1)
+			}
+			queue = append(queue, nbr.Atom)
+		}
+	}
+
+	return nil
+}
+
+// ringKey answers a key identifying the ring closed by the given path,
+// irrespective of where it begins and of its direction.
+func ringKey(m *Molecule, path []uint16) string {
+	ids := make([]int, 0, len(path))
+	for i, aid := range path {
+		b := m.bondBetween(aid, path[(i+1)%len(path)])
+		ids = append(ids, int(b.id))
+	}
+	sort.Ints(ids)
+	return fmt.Sprint(ids)
+}
+
+// perceiveRingSystems groups the rings of this molecule into ring
+// systems of rings sharing at least one atom, and records the
+// neighbours of each ring.
+func (m *Molecule) perceiveRingSystems() error {
+	for _, r := range m.rings {
+		r.nbrs = r.nbrs[:0]
+		for _, o := range m.rings {
+			if o != r && r.commonAtoms(o).Count() > 0 {
+				r.nbrs = append(r.nbrs, o.id)
+			}
+		}
+	}
+
+	done := make(map[uint16]bool, len(m.rings))
+	for _, r := range m.rings {
+		if done[r.id] {
+			continue
+		}
+
+		id, err := m.newRingSystemId()
+		if err != nil {
+			return err
+		}
+		rs := newRingSystem(m, id)
+
+		// Breadth-first, so that each ring added is fused to one already
+		// in the system.
+		queue := []*_Ring{r}
+		done[r.id] = true
+		for len(queue) > 0 {
+			cur := queue[0]
+			queue = queue[1:]
+			if err := rs.addRing(cur); err != nil {
+				return err
+			}
+			cur.rsId = rs.id
+
+			for _, nid := range cur.nbrs {
+				if !done[nid] {
+					done[nid] = true
+					queue = append(queue, m.ringWithId(nid))
+				}
+			}
+		}
+		m.ringSystems = append(m.ringSystems, rs)
+	}
+
+	return nil
+}
@@ -0,0 +1,192 @@
+package molecule
+
+import (
+	"fmt"
+	"sort"
+
+	cmn "github.com/RxnWeaver/rxnweaver/common"
+)
+
+// RingRelation answers the relative configuration of the atoms with
+// the given input IDs, which should share a ring: cis, should their
+// substituents lie on the same face of the smallest such ring whose
+// faces are determined for both, and trans otherwise.
+// `RingRelationNone` is answered should no such ring be found.
+//
+// Each substituted stereo atom of a ring is represented by its higher
+// ranked substituent outside the ring, as the rules for `r`, `c` and
+// `t` prefixes require.  The relation is perceived by sanitisation,
+// from 3-D coordinates, or from the wedges of 2-D ones.  It covers
+// atoms that are not stereocentres themselves, as those of
+// 1,4-dimethylcyclohexane, and the bridgeheads of decalins.
+func (m *Molecule) RingRelation(a1, a2 uint16) (cmn.RingRelation, error) {
+	reply := m.Call(ReqRingRelation, AtomPair{a1, a2})
+	if err := statusError(reply, fmt.Sprintf("atoms %d and %d", a1, a2)); err != nil {
+		return cmn.RingRelationNone, err
+	}
+	return reply.Payload.(cmn.RingRelation), nil
+}
+
+// handleRingRelation answers the relative configuration of the given
+// pair of atoms, about a ring they share.
+func (m *Molecule) handleRingRelation(p interface{}) (StatusType, interface{}) {
+	q, ok := p.(AtomPair)
+	if !ok {
+		return StIncorrectParameter, nil
+	}
+	if m.atomWithIid(q.A1) == nil || m.atomWithIid(q.A2) == nil {
+		return StNotFound, nil
+	}
+
+	shared := false
+	var best *_Ring
+	for _, r := range m.rings {
+		i, j := r.atomIndex(q.A1), r.atomIndex(q.A2)
+		if i < 0 || j < 0 || i == j {
+			continue
+		}
+		shared = true
+		if r.faces == nil || r.faces[i] == 0 || r.faces[j] == 0 {
+			continue
+		}
+		if best == nil || r.size() < best.size() {
+			best = r
+		}
+	}
+	switch {
+	case !shared:
+		return StIncorrectParameter, fmt.Errorf("Atoms %d and %d share no ring.", q.A1, q.A2)
+	case best == nil:
+		return StSuccess, cmn.RingRelationNone
+	case best.faces[best.atomIndex(q.A1)] == best.faces[best.atomIndex(q.A2)]:
+		return StSuccess, cmn.RingRelationCis
+	}
+	return StSuccess, cmn.RingRelationTrans
+}
+
+// perceiveRingStereo marks the substituted stereo atoms of the
+// non-aromatic rings of this molecule, given the canonical classes of
+// its atoms, and determines the faces of the rings their substituents
+// take.  Atoms not already stereocentres are marked as of
+// `StereoTypeRing`.
+//
+// A substituted stereo atom of a ring is an sp3 atom whose two
+// substituents outside the ring differ, one of which may be a
+// hydrogen; a ring needs two or more such atoms for their relative
+// configurations to matter.  The face taken by such an atom is that of
+// its higher ranked substituent, by the sign of its drawn volume with
+// the preceding and the following atoms of the ring; see `drawnVolume`.
+// Since the ring is traversed in one direction, the signs of all its
+// atoms are relative to the same face.
+func (m *Molecule) perceiveRingStereo(cls map[uint16]uint64) {
+	threeD := m.has3DCoordinates()
+	for _, r := range m.rings {
+		r.faces = nil
+		if r.isAro {
+			continue
+		}
+
+		n := len(r.atoms)
+		subs := make([]uint16, n)
+		count := 0
+		for i, iid := range r.atoms {
+			prev, next := r.atoms[(i+n-1)%n], r.atoms[(i+1)%n]
+			if s, ok := m.atomWithIid(iid).ringSubstituent(prev, next, cls); ok {
+				subs[i] = s
+				count++
+			}
+		}
+		if count < 2 {
+			continue
+		}
+
+		r.faces = make([]int8, n)
+		for i, iid := range r.atoms {
+			if subs[i] == 0 {
+				continue
+			}
+			a := m.atomWithIid(iid)
+			if a.stereoType == cmn.StereoTypeNone {
+				a.stereoType = cmn.StereoTypeRing
+			}
+			if a.hasEitherWedge() {
+				continue
+			}
+			prev, next := r.atoms[(i+n-1)%n], r.atoms[(i+1)%n]
+			if v, ok := a.drawnVolume(prev, next, subs[i], threeD); ok {
+				r.faces[i] = 1
+				if v < 0 {
+					r.faces[i] = -1
+				}
+			}
+		}
+	}
+}
+
+// ringSubstituent answers the higher ranked substituent of this atom
+// outside the ring in which it lies between the given atoms, should it
+// be a substituted stereo atom of that ring.
+func (a *_Atom) ringSubstituent(prev, next uint16, cls map[uint16]uint64) (uint16, bool) {
+	if !a.isTetrahedralCandidate() {
+		return 0, false
+	}
+	exo := make([]uint16, 0, 2)
+	for _, nbr := range a.adj {
+		if nbr.Atom != prev && nbr.Atom != next {
+			exo = append(exo, nbr.Atom)
+		}
+	}
+	switch {
+	case len(exo) == 1:
+		return exo[0], true
+	case len(exo) != 2 || cls[exo[0]] == cls[exo[1]]:
+		return 0, false
+	}
+	ranked, tied := a.mol.cipRanked(a.iId, exo)
+	if tied {
+		return 0, false
+	}
+	return ranked[0], true
+}
+
+// hasRingFace answers if the face taken by this atom is determined in
+// any ring.
+func (a *_Atom) hasRingFace() bool {
+	for _, r := range a.mol.rings {
+		if i := r.atomIndex(a.iId); i >= 0 && r.faces != nil && r.faces[i] != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// ringRelationKeys answers the relative configurations of the ring
+// stereo atoms of this molecule, as hashed, given the canonical classes
+// of its atoms: each pair of a ring with determined faces by the size
+// of the ring, the classes of the atoms, and whether they are cis.
+// Being relative, they do not depend on the direction in which the
+// ring is traversed.
+func (m *Molecule) ringRelationKeys(cls map[uint16]uint64) []uint64 {
+	res := []uint64(nil)
+	for _, r := range m.rings {
+		for i, fi := range r.faces {
+			for j := i + 1; j < len(r.faces); j++ {
+				fj := r.faces[j]
+				if fi == 0 || fj == 0 {
+					continue
+				}
+				c1, c2 := cls[r.atoms[i]], cls[r.atoms[j]]
+				if c1 > c2 {
+					c1, c2 = c2, c1
+				}
+				rel := cmn.RingRelationTrans
+				if fi == fj {
+					rel = cmn.RingRelationCis
+				}
+				res = append(res, hashInts(uint64(len(r.atoms)), c1, c2, uint64(rel)))
+			}
+		}
+	}
+	sort.Sort(uint64s(res))
+	return res
+}
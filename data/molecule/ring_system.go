@@ -21,9 +21,9 @@ import (
 // change during the course of the life of its molecule.
 type _RingSystem struct {
 	mol *Molecule // Containing molecule of this ring system.
-	id  uint8     // Unique ID of this ring system in its molecule.
+	id  uint16    // Unique ID of this ring system in its molecule.
 
-	rings      []uint8      // List of rings comprising this system.
+	rings      []uint16     // List of rings comprising this system.
 	atomBitSet *bits.BitSet // All atoms from all rings in this system.
 	bondBitSet *bits.BitSet // All bonds from all rings in this system.
 
@@ -32,12 +32,12 @@ type _RingSystem struct {
 
 // newRingSystem creates and initialises a ring system with the given
 // molecule and unique ID.
-func newRingSystem(mol *Molecule, id uint8) *_RingSystem {
+func newRingSystem(mol *Molecule, id uint16) *_RingSystem {
 	rs := new(_RingSystem)
 	rs.mol = mol
 	rs.id = id
 
-	rs.rings = make([]uint8, 0, cmn.MaxRings)
+	rs.rings = make([]uint16, 0, cmn.MaxRings)
 	rs.atomBitSet = bits.New(cmn.ListSizeSmall)
 	rs.bondBitSet = bits.New(cmn.ListSizeSmall)
 
@@ -50,7 +50,7 @@ func (rs *_RingSystem) size() int {
 }
 
 // hasRing answers if this system includes the given ring.
-func (rs *_RingSystem) hasRing(rid uint8) (bool, int) {
+func (rs *_RingSystem) hasRing(rid uint16) (bool, int) {
 	for i, id := range rs.rings {
 		if id == rid {
 			return true, i
@@ -63,7 +63,7 @@ func (rs *_RingSystem) hasRing(rid uint8) (bool, int) {
 // ringAt answers the ring at the given index.
 //
 // This method does not perform any index boundary checks!
-func (rs *_RingSystem) ringAt(idx int) uint8 {
+func (rs *_RingSystem) ringAt(idx int) uint16 {
 	return rs.rings[idx]
 }
 
@@ -97,7 +97,7 @@ func (rs *_RingSystem) addRingAt(idx int, r *_Ring) error {
 	if rs.bondBitSet.Count() > 0 {
 		if rs.bondBitSet.IntersectionCardinality(r.bondBitSet) == 0 {
 			if rs.atomBitSet.IntersectionCardinality(r.atomBitSet) == 0 {
-				return fmt.Errorf("Ring %d has no bonds or atoms in common with any others in this ring system")
+				return fmt.Errorf("Ring %d has no bonds or atoms in common with any others in this ring system", r.id)
 			}
 		}
 	}
@@ -228,12 +228,12 @@ func (rs *_RingSystem) markAtomsBondsAromatic() {
 	abs := rs.atomBitSet
 	for aiid, ok := abs.NextSet(0); ok; aiid, ok = abs.NextSet(aiid + 1) {
 		a := mol.atomWithIid(uint16(aiid))
-		a.isInAroRing = true
+		mol.setAtomAromatic(a)
 	}
 
 	bbs := rs.bondBitSet
 	for bid, ok := bbs.NextSet(0); ok; bid, ok = bbs.NextSet(bid + 1) {
 		b := mol.bondWithId(uint16(bid))
-		b.isAro = true
+		mol.setBondAromatic(b)
 	}
 }
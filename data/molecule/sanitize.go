@@ -0,0 +1,335 @@
+package molecule
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	cmn "github.com/RxnWeaver/rxnweaver/common"
+)
+
+// SanitizeOptions selects the stages of sanitisation to skip.  See
+// `Sanitize`.  The zero value runs all stages.
+type SanitizeOptions uint8
+
+// Constants representing the stages of sanitisation that can be
+// skipped.  They can be combined with `|`.
+const (
+	SanitizeSkipHydrogens SanitizeOptions = 1 << iota
+	SanitizeSkipValence
+	SanitizeSkipRings
+	SanitizeSkipAromaticity
+	SanitizeSkipStereo
+)
+
+// sanitizeStageNames holds the names of the stages, in the order of
+// their flags.
+var sanitizeStageNames = [...]string{"hydrogens", "valence", "rings", "aromaticity", "stereo"}
+
+// String answers the names of the stages skipped, separated by commas.
+func (o SanitizeOptions) String() string {
+	names := make([]string, 0, len(sanitizeStageNames))
+	for i, name := range sanitizeStageNames {
+		if o&(1<<uint(i)) != 0 {
+			names = append(names, name)
+		}
+	}
+	return strings.Join(names, ",")
+}
+
+// ParseSanitizeOptions answers the options skipping the stages with
+// the given names, separated by commas, as answered by `String`.
+func ParseSanitizeOptions(s string) (SanitizeOptions, error) {
+	opts := SanitizeOptions(0)
+	for _, name := range strings.Split(s, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+
+		found := false
+		for i, sn := range sanitizeStageNames {
+			if sn == name {
+				opts |= 1 << uint(i)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return 0, fmt.Errorf("Unknown stage of sanitisation : %q", name)
+		}
+	}
+	return opts, nil
+}
+
+// Sanitize perceives the implicit features of the given molecule, so
+// that molecules read from any format are alike.  The stages run in
+// the following order, since each depends on the preceding ones.
+// Beforehand, aromatic bonds given as such, without Kekulé types, are
+// assigned those of a Kekulé structure, which perception relies on;
+// they keep their aromatic type.  See `Kekulise`.
+//
+//   - Hydrogens: atoms of the organic subset are given the hydrogens
+//     needed to reach their lowest standard valence, adjusted for
+//     charge.  Hydrogen counts are never lowered.
+//   - Valence: atoms exceeding the valences of their elements are
+//     reported, as `Validate` does.
+//   - Rings: the rings and ring systems are detected afresh.
+//   - Aromaticity: rings and ring systems are tested for aromaticity.
+//   - Stereo: tetrahedral stereocentres, stereogenic double bonds and
+//     biaryl axes of hindered rotation are marked, based on the
+//     constitution alone.  The configurations of the centres are
+//     determined from 3-D coordinates, or from wedge bonds in 2-D, and
+//     pseudo-asymmetric centres are marked by them.  The helicities of
+//     the axes are determined from 3-D coordinates, if any.  See
+//     `AtomInfo` and `BondInfo`.
+//
+// Stages named in the given options are skipped.  The answered report
+// lists the problems found; the molecule is sanitised regardless.  The
+// application is recorded as a `sanitize` step in its provenance.
+func Sanitize(mol *Molecule, opts SanitizeOptions) (*cmn.ValidationReport, error) {
+	reply := mol.Call(ReqSanitize, opts)
+	if err := statusError(reply, fmt.Sprintf("molecule %d", mol.id)); err != nil {
+		return nil, err
+	}
+	return reply.Payload.(*cmn.ValidationReport), nil
+}
+
+// handleSanitize runs the stages of sanitisation not skipped by the
+// given options.
+func (m *Molecule) handleSanitize(p interface{}) (StatusType, interface{}) {
+	opts, ok := p.(SanitizeOptions)
+	if !ok && p != nil {
+		return StIncorrectParameter, nil
+	}
+
+	rep := new(cmn.ValidationReport)
+	if err := m.kekulise(); err != nil {
+		rep.Addf(cmn.SeverityError, cmn.CodeNoKekuleForm, nil, "%v", err)
+	}
+	if opts&SanitizeSkipHydrogens == 0 {
+		m.perceiveHydrogens()
+	}
+	for _, a := range m.atoms {
+		if err := a.determineUnsaturation(); err != nil {
+			rep.Addf(cmn.SeverityWarning, cmn.CodeUnusualValence, []uint16{a.iId},
+				"Atom %d (%s) : %v", a.iId, a.symbol, err)
+		}
+	}
+	if opts&SanitizeSkipValence == 0 {
+		rep.Merge(m.validate())
+	}
+	if opts&SanitizeSkipRings == 0 {
+		if err := m.perceiveRings(); err != nil {
+			return StIncorrectParameter, err
+		}
+	}
+	if opts&SanitizeSkipAromaticity == 0 {
+		m.perceiveAromaticity()
+	}
+	if opts&SanitizeSkipStereo == 0 {
+		m.perceiveStereo()
+	}
+
+	m.steps = append(m.steps, ProvenanceStep{"sanitize", skippedDetail(opts), time.Now()})
+	m.invalidate()
+	return StSuccess, rep
+}
+
+// skippedDetail answers the detail recorded in the provenance step of
+// sanitisation with the given options.
+func skippedDetail(opts SanitizeOptions) string {
+	if opts == 0 {
+		return ""
+	}
+	return "skipped : " + opts.String()
+}
+
+// standardValences holds the standard valences of the elements of the
+// organic subset, in increasing order.
+var standardValences = map[uint8][]int{
+	5:  {3},
+	6:  {4},
+	7:  {3, 5},
+	8:  {2},
+	9:  {1},
+	15: {3, 5},
+	16: {2, 4, 6},
+	17: {1},
+	35: {1},
+	53: {1},
+}
+
+// perceiveHydrogens raises the hydrogen counts of the atoms of the
+// organic subset to reach their lowest standard valences that
+// accommodate their bonds, adjusted for charge.  Radicals, and atoms
+// exceeding all such valences, are left unchanged.
+func (m *Molecule) perceiveHydrogens() {
+	for _, a := range m.atoms {
+		vals, ok := standardValences[a.atNum]
+		if !ok || a.radical != cmn.RadicalNone {
+			continue
+		}
+
+		used := len(a.nbrs) + int(a.hCount)
+		for _, v := range vals {
+			v = chargeAdjustedValence(a.atNum, v, int(a.charge))
+			if v >= used {
+				if v > used {
+					m.setAtomHCount(a, a.hCount+uint8(v-used))
+					m.publish(EvAtomChanged, a.iId, 0)
+				}
+				break
+			}
+		}
+	}
+}
+
+// chargeAdjustedValence answers the given valence of the given
+// element, adjusted for the given charge.  Carbon loses a bond either
+// way; boron gains one per negative charge, and the others one per
+// positive charge.
+func chargeAdjustedValence(atNum uint8, v, ch int) int {
+	switch atNum {
+	case 5:
+		return v - ch
+	case 6:
+		if ch < 0 {
+			ch = -ch
+		}
+		return v - ch
+	}
+	return v + ch
+}
+
+// perceiveAromaticity determines the aromaticity of the current ring
+// systems of this molecule, and of their rings, afresh.
+func (m *Molecule) perceiveAromaticity() {
+	for _, r := range m.rings {
+		r.isAro = false
+		r.isHetAro = false
+	}
+	for _, rs := range m.ringSystems {
+		rs.isAro = false
+	}
+	m.rebuildMembership()
+
+	for _, rs := range m.ringSystems {
+		rs.determineAromaticity()
+	}
+	m.rebuildMembership()
+}
+
+// perceiveStereo marks the stereocentres and the stereogenic double
+// bonds of this molecule, and determines their configurations.
+//
+// A tetrahedral stereocentre is an sp3 atom with four different
+// substituents, at most one of which is a hydrogen.  A stereogenic
+// double bond is one outside small rings, whose each end has two
+// different substituents, or one substituent and a lone pair or
+// hydrogen.  Substituents are told apart by their canonical classes;
+// see `Hash128`.  The configurations of double bonds, `E` or `Z`, are
+// determined from the coordinates of their substituents, 2-D or 3-D,
+// unless drawn as unknown; see `perceiveDoubleBonds`.  Acyclic
+// centres that are stereogenic only by virtue of other such centres
+// are found once the configurations of those are known; see
+// `perceiveConfigurations`.  Descriptors are determined afresh, so that
+// none perceived before sways the ranking of substituents by the
+// stereo sequence rules.  Those in rings, as in 1,4-disubstituted
+// cyclohexanes, are marked by their rings instead, with their faces;
+// see `perceiveRingStereo`.
+func (m *Molecule) perceiveStereo() {
+	cls := m.canonicalClasses(HashIsotopes)
+
+	for _, a := range m.atoms {
+		a.stereoType, a.cip = cmn.StereoTypeNone, cmn.CIPNone
+		if a.isTetrahedralCentre(cls) {
+			a.stereoType = cmn.StereoTypeTetrahedral
+		}
+	}
+	for _, b := range m.bonds {
+		b.stereoType, b.cip = cmn.StereoTypeNone, cmn.CIPNone
+		if b.bType != cmn.BondTypeDouble || b.isAro || b.inRingSmallerThan(8) {
+			continue
+		}
+		a1, a2 := m.atomWithIid(b.a1), m.atomWithIid(b.a2)
+		if a1.isStereoEnd(b, cls) && a2.isStereoEnd(b, cls) {
+			b.stereoType = cmn.StereoTypeDoubleBond
+		}
+	}
+	m.perceiveAxes(cls)
+	m.perceiveDoubleBonds()
+	m.perceiveRingStereo(cls)
+	m.perceiveConfigurations(cls)
+}
+
+// isTetrahedralCentre answers if this atom is a tetrahedral
+// stereocentre, given the canonical classes of the atoms.
+func (a *_Atom) isTetrahedralCentre(cls map[uint16]uint64) bool {
+	if !a.isTetrahedralCandidate() {
+		return false
+	}
+
+	seen := make(map[uint64]bool, 4)
+	for _, nbr := range a.adj {
+		if seen[cls[nbr.Atom]] {
+			return false
+		}
+		seen[cls[nbr.Atom]] = true
+	}
+	return true
+}
+
+// isTetrahedralCandidate answers if this atom is an sp3 atom of an
+// element that can be a tetrahedral stereocentre, with four
+// substituents, at most one of which is a hydrogen.
+func (a *_Atom) isTetrahedralCandidate() bool {
+	if a.doubleBondCount > 0 || a.tripleBondCount > 0 || a.hCount > 1 {
+		return false
+	}
+	switch a.atNum {
+	case 6, 14:
+	case 7, 15:
+		if a.charge != 1 {
+			return false
+		}
+	default:
+		return false
+	}
+	return len(a.adj)+int(a.hCount) == 4
+}
+
+// isStereoEnd answers if this atom, at an end of the given double
+// bond, has substituents that make the bond stereogenic.
+func (a *_Atom) isStereoEnd(b *_Bond, cls map[uint16]uint64) bool {
+	if a.doubleBondCount > 1 || a.tripleBondCount > 0 {
+		return false // Cumulated.
+	}
+
+	other := b.otherAtomIid(a.iId)
+	subs := make([]uint16, 0, 2)
+	for _, nbr := range a.adj {
+		if nbr.Atom != other {
+			subs = append(subs, nbr.Atom)
+		}
+	}
+
+	switch len(subs) {
+	case 1:
+		return a.hCount <= 1
+	case 2:
+		return a.hCount == 0 && cls[subs[0]] != cls[subs[1]]
+	}
+	return false
+}
+
+// inRingSmallerThan answers if this bond participates in at least one
+// ring smaller than the given size.
+func (b *_Bond) inRingSmallerThan(n int) bool {
+	for _, rid := range b.rings {
+		if r := b.mol.ringWithId(rid); r != nil && r.size() < n {
+			return true
+		}
+	}
+	return false
+}
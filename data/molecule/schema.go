@@ -0,0 +1,253 @@
+package molecule
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// AttributeType enumerates the types of values that an attribute
+// declared in a schema can hold.
+type AttributeType uint8
+
+// Constants representing the types of attribute values.
+const (
+	AttrString AttributeType = iota
+	AttrInt
+	AttrFloat
+	AttrBool
+)
+
+// attributeTypeNames holds the descriptive names of the attribute
+// types.
+var attributeTypeNames = [...]string{"string", "int", "float", "bool"}
+
+// String answers the name of this type.
+func (t AttributeType) String() string {
+	if int(t) < len(attributeTypeNames) {
+		return attributeTypeNames[t]
+	}
+	return fmt.Sprintf("AttributeType(%d)", t)
+}
+
+// AttributeSpec declares a single attribute of molecules.
+type AttributeSpec struct {
+	Name     string
+	Type     AttributeType
+	Units    string // Optional; e.g. `mg/L`.
+	Required bool   // Must every molecule carry this attribute?
+}
+
+// AttributeSchema declares the attributes that the molecules of a
+// dataset carry.  See `MoleculeRegistry.SetAttributeSchema`.
+//
+// Attributes not declared in a schema are left as they are.
+type AttributeSchema struct {
+	specs  []AttributeSpec
+	byName map[string]int
+}
+
+// NewAttributeSchema creates a schema declaring the given attributes.
+// Their names must be non-empty and distinct.
+func NewAttributeSchema(specs ...AttributeSpec) (*AttributeSchema, error) {
+	s := &AttributeSchema{byName: make(map[string]int, len(specs))}
+	for i, spec := range specs {
+		if spec.Name == "" {
+			return nil, fmt.Errorf("Attribute spec %d : empty name.", i)
+		}
+		if _, ok := s.byName[spec.Name]; ok {
+			return nil, fmt.Errorf("Attribute spec %d : duplicate name : %s", i, spec.Name)
+		}
+		if int(spec.Type) >= len(attributeTypeNames) {
+			return nil, fmt.Errorf("Attribute spec %d : unknown type : %d", i, spec.Type)
+		}
+		s.byName[spec.Name] = i
+		s.specs = append(s.specs, spec)
+	}
+	return s, nil
+}
+
+// Specs answers the attributes declared in this schema, in the order
+// of their declaration.
+func (s *AttributeSchema) Specs() []AttributeSpec {
+	return append([]AttributeSpec{}, s.specs...)
+}
+
+// Spec answers the declaration of the attribute with the given name,
+// if any.
+func (s *AttributeSchema) Spec(name string) (AttributeSpec, bool) {
+	i, ok := s.byName[name]
+	if !ok {
+		return AttributeSpec{}, false
+	}
+	return s.specs[i], true
+}
+
+// coerce answers the canonical textual form of the given value of the
+// attribute with the given declaration.
+//
+// Surrounding white space is dropped, as are the declared units, if
+// they suffix the value.  Numbers and booleans are then parsed, and
+// rendered in their canonical forms, as by `SetAttribute`.
+func (spec AttributeSpec) coerce(value string) (string, error) {
+	v := strings.TrimSpace(value)
+	if spec.Units != "" && strings.HasSuffix(v, spec.Units) {
+		v = strings.TrimSpace(strings.TrimSuffix(v, spec.Units))
+	}
+
+	switch spec.Type {
+	case AttrInt:
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return "", fmt.Errorf("Attribute %s is not an integer : %q", spec.Name, value)
+		}
+		return strconv.FormatInt(n, 10), nil
+	case AttrFloat:
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return "", fmt.Errorf("Attribute %s is not a number : %q", spec.Name, value)
+		}
+		return strconv.FormatFloat(f, 'g', -1, 64), nil
+	case AttrBool:
+		switch strings.ToLower(v) {
+		case "yes", "y":
+			return "true", nil
+		case "no", "n":
+			return "false", nil
+		}
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return "", fmt.Errorf("Attribute %s is not a boolean : %q", spec.Name, value)
+		}
+		return strconv.FormatBool(b), nil
+	}
+	return value, nil
+}
+
+// SchemaError reports all the violations of an attribute schema by a
+// molecule.  See `Molecule.ConformAttributes`.
+type SchemaError struct {
+	Molecule   uint64 // ID of the offending molecule.
+	Violations []error
+}
+
+// Error answers the messages of all the violations, one per line.
+func (e *SchemaError) Error() string {
+	msgs := make([]string, 0, len(e.Violations))
+	for _, err := range e.Violations {
+		msgs = append(msgs, err.Error())
+	}
+	return fmt.Sprintf("Molecule %d : %d schema violations :\n%s", e.Molecule, len(e.Violations), strings.Join(msgs, "\n"))
+}
+
+// SetAttributeSchema sets the schema to which the attributes of the
+// molecules of this registry are to conform, or clears it upon `nil`.
+//
+// Molecules are not checked when the schema is set; see
+// `ConformAttributes` and `CheckAttributes`.
+func (reg *MoleculeRegistry) SetAttributeSchema(s *AttributeSchema) {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+
+	reg.schema = s
+}
+
+// AttributeSchema answers the schema set for this registry, if any.
+// Answers `nil` otherwise.
+func (reg *MoleculeRegistry) AttributeSchema() *AttributeSchema {
+	reg.mu.RLock()
+	defer reg.mu.RUnlock()
+
+	return reg.schema
+}
+
+// CheckAttributes conforms the attributes of all the molecules of this
+// registry to its schema.  It answers the errors of the molecules that
+// violate it, by their IDs.  It answers `nil` when no schema is set.
+func (reg *MoleculeRegistry) CheckAttributes() map[uint64]error {
+	s := reg.AttributeSchema()
+	if s == nil {
+		return nil
+	}
+	mols := reg.snapshot()
+
+	res := make(map[uint64]error)
+	for _, mol := range mols {
+		if err := mol.conformAttributes(s); err != nil {
+			res[mol.id] = err
+		}
+	}
+	return res
+}
+
+// ConformAttributes conforms the attributes of this molecule to the
+// schema of its registry.  Declared attributes are coerced to the
+// canonical forms of their values.  All the violations are answered
+// in a `*SchemaError`: required attributes that are missing, and
+// values that can not be coerced, which are left as they are.
+//
+// It answers `nil` if there are no violations, or if no schema is set.
+func (m *Molecule) ConformAttributes() error {
+	if m.registry == nil {
+		return nil
+	}
+	s := m.registry.AttributeSchema()
+	if s == nil {
+		return nil
+	}
+	return m.conformAttributes(s)
+}
+
+// conformAttributes conforms the attributes of this molecule to the
+// given schema.
+func (m *Molecule) conformAttributes(s *AttributeSchema) error {
+	reply := m.Call(ReqConformAttributes, s)
+	if err := statusError(reply, fmt.Sprintf("molecule %d", m.id)); err != nil {
+		return err
+	}
+	if errs := reply.Payload.([]error); len(errs) > 0 {
+		return &SchemaError{m.id, errs}
+	}
+	return nil
+}
+
+// handleConformAttributes coerces the attributes of this molecule
+// declared in the given schema, and answers the violations found.
+func (m *Molecule) handleConformAttributes(p interface{}) (StatusType, interface{}) {
+	s, ok := p.(*AttributeSchema)
+	if !ok || s == nil {
+		return StIncorrectParameter, nil
+	}
+
+	errs := make([]error, 0)
+	seen := make(map[string]bool, len(s.specs))
+	changed := false
+	for i, attr := range m.attributes {
+		spec, ok := s.Spec(attr.Name)
+		if !ok {
+			continue
+		}
+		seen[attr.Name] = true
+
+		v, err := spec.coerce(attr.Value)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if v != attr.Value {
+			m.attributes[i].Value = v
+			changed = true
+		}
+	}
+
+	for _, spec := range s.specs {
+		if spec.Required && !seen[spec.Name] {
+			errs = append(errs, fmt.Errorf("Required attribute missing : %s", spec.Name))
+		}
+	}
+
+	if changed {
+		m.publish(EvTagChanged, 0, 0)
+	}
+	return StSuccess, errs
+}
@@ -0,0 +1,216 @@
+package molecule
+
+import (
+	"fmt"
+
+	cmn "github.com/RxnWeaver/rxnweaver/common"
+)
+
+// Edit is a single structural modification, as batched in an edit
+// session.  Its request and payload are as documented for the
+// corresponding request constant.
+type Edit struct {
+	Request RequestType
+	Payload interface{}
+}
+
+// editRequests holds the requests that can be batched in an edit
+// session.
+var editRequests = map[RequestType]bool{
+	ReqAddAtom:             true,
+	ReqAddBond:             true,
+	ReqAddTag:              true,
+	ReqSetAttribute:        true,
+	ReqDeleteAttribute:     true,
+	ReqSetAtomAttribute:    true,
+	ReqSetBondAttribute:    true,
+	ReqDeleteAtomAttribute: true,
+	ReqDeleteBondAttribute: true,
+	ReqSetAtomCharge:       true,
+	ReqSetAtomHCount:       true,
+	ReqSetAttachment:       true,
+	ReqSetBondType:         true,
+	ReqSetAtomParity:       true,
+	ReqSetBondSides:        true,
+	ReqKekulise:            true,
+	ReqAromatise:           true,
+	ReqRemoveAtom:          true,
+	ReqRemoveBond:          true,
+	ReqReplaceAtom:         true,
+	ReqJoinAtoms:           true,
+	ReqSetStereoGroups:     true,
+	ReqSetSgroups:          true,
+	ReqExpandSgroups:       true,
+}
+
+// EditSession batches structural modifications to a molecule, so that
+// they are applied either all together, or not at all.
+//
+// Modifications are merely recorded until the session is committed.
+// The molecule then applies them in order, in a single request.
+// Should any of them fail, the molecule is restored to its state
+// before the first of them.  Its subscribers are notified of the
+// changes only upon success, and are asked to recompute derived
+// properties only once.
+//
+// A session is NOT safe for concurrent use.  It can not be used after
+// it is committed or rolled back.
+type EditSession struct {
+	mol    *Molecule
+	edits  []Edit
+	closed bool
+}
+
+// BeginEdit answers a new edit session on this molecule.
+func (m *Molecule) BeginEdit() *EditSession {
+	return &EditSession{mol: m}
+}
+
+// Add records the given modification in this session.  It is
+// validated only upon commit.
+func (s *EditSession) Add(req RequestType, payload interface{}) {
+	s.edits = append(s.edits, Edit{req, payload})
+}
+
+// AddAtom records the addition of the atom built by the given
+// builder.  The builder can be used to build another atom
+// immediately.
+func (s *EditSession) AddAtom(ab *AtomBuilder) {
+	s.Add(ReqAddAtom, &AtomBuilder{mol: ab.mol, a: ab.a})
+	ab.a = nil
+}
+
+// AddBond records the addition of the bond built by the given
+// builder.  The builder can be used to build another bond
+// immediately.
+//
+// Note that the builder requires both atoms of the bond to be present
+// in the molecule already.  Atoms added in this session do not qualify
+// until it is committed.
+func (s *EditSession) AddBond(bb *BondBuilder) {
+	s.Add(ReqAddBond, &BondBuilder{mol: bb.mol, b: bb.b})
+	bb.b = nil
+}
+
+// RemoveAtom records the removal of the atom with the given input ID.
+func (s *EditSession) RemoveAtom(iid uint16) {
+	s.Add(ReqRemoveAtom, AtomQuery{iid})
+}
+
+// RemoveBond records the removal of the bond with the given ID.
+func (s *EditSession) RemoveBond(id uint16) {
+	s.Add(ReqRemoveBond, BondQuery{id})
+}
+
+// ReplaceAtom records the change of the element of the atom with the
+// given input ID.
+func (s *EditSession) ReplaceAtom(iid uint16, symbol string) {
+	s.Add(ReqReplaceAtom, AtomReplacement{iid, symbol})
+}
+
+// JoinAtoms records the replacement of the given terminal atoms by a
+// bond of the given type between their neighbours.
+func (s *EditSession) JoinAtoms(a1, a2 uint16, typ cmn.BondType) {
+	s.Add(ReqJoinAtoms, AtomJoin{a1, a2, typ})
+}
+
+// Len answers the number of modifications recorded in this session.
+func (s *EditSession) Len() int {
+	return len(s.edits)
+}
+
+// Commit applies the modifications recorded in this session, and
+// closes it.  Upon error, none of them is in effect.
+func (s *EditSession) Commit() error {
+	if s.closed {
+		return fmt.Errorf("Edit session already closed.")
+	}
+	s.closed = true
+
+	if len(s.edits) == 0 {
+		return nil
+	}
+	return statusError(s.mol.Call(ReqApplyEdits, s.edits), fmt.Sprintf("molecule %d", s.mol.id))
+}
+
+// Rollback discards the modifications recorded in this session, and
+// closes it.  The molecule is not affected.
+func (s *EditSession) Rollback() {
+	s.closed = true
+	s.edits = nil
+}
+
+// handleApplyEdits applies the given modifications in order, restoring
+// this molecule to its prior state should any of them fail.
+func (m *Molecule) handleApplyEdits(p interface{}) (StatusType, interface{}) {
+	edits, ok := p.([]Edit)
+	if !ok {
+		return StIncorrectParameter, nil
+	}
+	for i, e := range edits {
+		if !editRequests[e.Request] {
+			return StIncorrectParameter, fmt.Errorf("Edit %d : request %d can not be batched.", i, e.Request)
+		}
+	}
+
+	snap := m.duplicate(true)
+	m.holding = true
+	defer func() {
+		m.holding = false
+		m.held = m.held[:0]
+	}()
+
+	for i, e := range edits {
+		st, res := m.dispatch(InMessage{Request: e.Request, Payload: e.Payload})
+		if st != StSuccess {
+			m.adopt(snap)
+			if err, ok := res.(error); ok {
+				return st, fmt.Errorf("Edit %d : %v", i, err)
+			}
+			return st, fmt.Errorf("Edit %d : %s", i, st)
+		}
+	}
+
+	m.holding = false
+	for _, ev := range m.held {
+		if ev.Type != EvPropertiesInvalidated {
+			m.publish(ev.Type, ev.Atom, ev.Bond)
+		}
+	}
+	m.invalidate()
+	return StSuccess, nil
+}
+
+// adopt replaces the structure of this molecule with that of the given
+// passive duplicate, which must not be used thereafter.
+func (m *Molecule) adopt(d *Molecule) {
+	m.atoms, m.bonds = d.atoms, d.bonds
+	m.rings, m.ringSystems = d.rings, d.ringSystems
+	m.atomsByIid, m.atomsByNid = d.atomsByIid, d.atomsByNid
+	m.bondsById, m.bondsByPair = d.bondsById, d.bondsByPair
+
+	m.nextAtomIid, m.nextBondId = d.nextAtomIid, d.nextBondId
+	m.nextRingId, m.nextRingSystemId = d.nextRingId, d.nextRingSystemId
+
+	m.vendor, m.vendorMoleculeId = d.vendor, d.vendorMoleculeId
+	m.source, m.steps = d.source, d.steps
+	m.attributes = d.attributes
+	m.conformers, m.nextConformerId = d.conformers, d.nextConformerId
+	m.stereoGroups, m.sgroups = d.stereoGroups, d.sgroups
+	m.cols, m.members = d.cols, d.members
+
+	for _, a := range m.atoms {
+		a.mol = m
+	}
+	for _, b := range m.bonds {
+		b.mol = m
+	}
+	for _, r := range m.rings {
+		r.mol = m
+	}
+	for _, rs := range m.ringSystems {
+		rs.mol = m
+	}
+
+	m.discardDistances()
+}
@@ -0,0 +1,221 @@
+package molecule
+
+import (
+	"fmt"
+	"sort"
+
+	cmn "github.com/RxnWeaver/rxnweaver/common"
+)
+
+// Sgroup is a group of atoms of a molecule, as of MDL molfiles,
+// carrying information beyond its constitution: a superatom, which
+// abbreviates its atoms by a label, such as `Ph` or `Boc`; a structural
+// repeating unit of a polymer, as the `CH2CH2` of polyethylene, bounded
+// by the bonds to its neighbouring units; or a data group, attaching a
+// named value to its atoms.
+//
+// Sgroups are kept as given, for depiction, and for writing molfiles
+// afresh; they do not affect perception, hashing or searching, which
+// see the molecule as drawn, its superatoms expanded.  An atom may
+// belong to several Sgroups.
+type Sgroup struct {
+	Type  cmn.SgroupType
+	Atoms []uint16 // Input IDs of the atoms, in ascending order.
+	Bonds []uint16 // IDs of the bonds crossing its boundary, in ascending order.
+
+	Label        string // Of a superatom, its abbreviation; of a repeating unit, its subscript, such as `n`.
+	Connectivity string // Of a repeating unit: `HT`, `HH` or `EU`; blank if not given.
+	Expanded     bool   // Is a superatom displayed by its atoms, rather than its label?
+
+	FieldName  string // Of a data group.
+	FieldValue string
+
+	Brackets [][4]float32 // As drawn, each by the X- and Y-coordinates of its two ends.
+}
+
+// sgroupConnectivities holds the connectivities of repeating units:
+// head-to-tail, head-to-head, and either or unknown.
+var sgroupConnectivities = map[string]bool{"": true, "HT": true, "HH": true, "EU": true}
+
+// clone answers a copy of this Sgroup, not sharing its lists.
+func (g Sgroup) clone() Sgroup {
+	g.Atoms = append([]uint16(nil), g.Atoms...)
+	g.Bonds = append([]uint16(nil), g.Bonds...)
+	g.Brackets = append([][4]float32(nil), g.Brackets...)
+	return g
+}
+
+// cloneSgroups answers deep copies of the given Sgroups.
+func cloneSgroups(gs []Sgroup) []Sgroup {
+	if gs == nil {
+		return nil
+	}
+	res := make([]Sgroup, len(gs))
+	for i, g := range gs {
+		res[i] = g.clone()
+	}
+	return res
+}
+
+// SetSgroups replaces the Sgroups of this molecule with the given ones,
+// in order.  The crossing bonds of a superatom or a repeating unit are
+// found from its atoms, unless given.  Giving none clears them.
+func (m *Molecule) SetSgroups(groups ...Sgroup) error {
+	return statusError(m.Call(ReqSetSgroups, cloneSgroups(groups)), fmt.Sprintf("molecule %d", m.id))
+}
+
+// Sgroups answers the Sgroups of this molecule, in order.
+func (m *Molecule) Sgroups() ([]Sgroup, error) {
+	reply := m.Call(ReqSgroups, nil)
+	if err := statusError(reply, fmt.Sprintf("molecule %d", m.id)); err != nil {
+		return nil, err
+	}
+	return reply.Payload.([]Sgroup), nil
+}
+
+// ExpandSgroups marks the superatoms of this molecule at the given
+// positions among its Sgroups, counted from `0`, as expanded, or as
+// collapsed, for display.  Should no position be given, all the
+// superatoms are marked.  A collapsed superatom is drawn as its label,
+// in place of its atoms.
+func (m *Molecule) ExpandSgroups(expanded bool, indices ...int) error {
+	q := SgroupExpansion{Indices: append([]int(nil), indices...), Expanded: expanded}
+	return statusError(m.Call(ReqExpandSgroups, q), fmt.Sprintf("molecule %d", m.id))
+}
+
+// handleSetSgroups validates the given Sgroups, and sets them as those
+// of this molecule.
+func (m *Molecule) handleSetSgroups(p interface{}) (StatusType, interface{}) {
+	gs, ok := p.([]Sgroup)
+	if !ok && p != nil {
+		return StIncorrectParameter, nil
+	}
+
+	res := make([]Sgroup, 0, len(gs))
+	for i, g := range gs {
+		if st, err := m.completeSgroup(&g); st != StSuccess {
+			return st, fmt.Errorf("Sgroup %d : %v", i+1, err)
+		}
+		res = append(res, g)
+	}
+
+	if len(res) == 0 {
+		res = nil
+	}
+	m.sgroups = res
+	return StSuccess, nil
+}
+
+// completeSgroup validates the given Sgroup, sorts its atoms and bonds,
+// and finds its crossing bonds, if not given.
+func (m *Molecule) completeSgroup(g *Sgroup) (StatusType, error) {
+	switch {
+	case g.Type == cmn.SgroupNone || g.Type > cmn.SgroupData:
+		return StIncorrectParameter, fmt.Errorf("Unknown type : %d", g.Type)
+	case len(g.Atoms) == 0:
+		return StIncorrectParameter, fmt.Errorf("No atoms.")
+	case g.Type == cmn.SgroupSuperatom && g.Label == "":
+		return StIncorrectParameter, fmt.Errorf("Superatom without a label.")
+	case g.Type == cmn.SgroupData && g.FieldName == "":
+		return StIncorrectParameter, fmt.Errorf("Data group without a field name.")
+	case !sgroupConnectivities[g.Connectivity]:
+		return StIncorrectParameter, fmt.Errorf("Unknown connectivity : %q", g.Connectivity)
+	}
+
+	*g = g.clone()
+	in := make(map[uint16]bool, len(g.Atoms))
+	for _, iid := range g.Atoms {
+		if m.atomWithIid(iid) == nil {
+			return StNotFound, fmt.Errorf("Atom not found : %d", iid)
+		}
+		if in[iid] {
+			return StIncorrectParameter, fmt.Errorf("Duplicate atom : %d", iid)
+		}
+		in[iid] = true
+	}
+	sort.Slice(g.Atoms, func(i, j int) bool { return g.Atoms[i] < g.Atoms[j] })
+
+	crossing := func(b *_Bond) bool { return in[b.a1] != in[b.a2] }
+	if len(g.Bonds) == 0 && g.Type != cmn.SgroupData {
+		for _, b := range m.bonds {
+			if crossing(b) {
+				g.Bonds = append(g.Bonds, b.id)
+			}
+		}
+	}
+	for _, id := range g.Bonds {
+		b := m.bondWithId(id)
+		switch {
+		case b == nil:
+			return StNotFound, fmt.Errorf("Bond not found : %d", id)
+		case !crossing(b):
+			return StIncorrectParameter, fmt.Errorf("Bond %d does not cross the boundary.", id)
+		}
+	}
+	sort.Slice(g.Bonds, func(i, j int) bool { return g.Bonds[i] < g.Bonds[j] })
+	return StSuccess, nil
+}
+
+// handleExpandSgroups marks the requested superatoms as expanded, or
+// as collapsed.
+func (m *Molecule) handleExpandSgroups(p interface{}) (StatusType, interface{}) {
+	q, ok := p.(SgroupExpansion)
+	if !ok {
+		return StIncorrectParameter, nil
+	}
+
+	for _, i := range q.Indices {
+		switch {
+		case i < 0 || i >= len(m.sgroups):
+			return StNotFound, fmt.Errorf("Sgroup not found : %d", i)
+		case m.sgroups[i].Type != cmn.SgroupSuperatom:
+			return StIncorrectParameter, fmt.Errorf("Sgroup %d is not a superatom.", i)
+		}
+	}
+	if len(q.Indices) == 0 {
+		for i, g := range m.sgroups {
+			if g.Type == cmn.SgroupSuperatom {
+				q.Indices = append(q.Indices, i)
+			}
+		}
+	}
+	for _, i := range q.Indices {
+		m.sgroups[i].Expanded = q.Expanded
+	}
+	return StSuccess, nil
+}
+
+// dropFromSgroups removes the atom with the given input ID from the
+// Sgroups of this molecule, dropping any group left empty.  The bonds
+// of the atom are removed before it, and so are not in any group.
+func (m *Molecule) dropFromSgroups(iid uint16) {
+	res := m.sgroups[:0]
+	for _, g := range m.sgroups {
+		for i, aid := range g.Atoms {
+			if aid == iid {
+				g.Atoms = append(g.Atoms[:i:i], g.Atoms[i+1:]...)
+				break
+			}
+		}
+		if len(g.Atoms) > 0 {
+			res = append(res, g)
+		}
+	}
+	if len(res) == 0 {
+		res = nil
+	}
+	m.sgroups = res
+}
+
+// dropBondFromSgroups removes the bond with the given ID from the
+// crossing bonds of the Sgroups of this molecule.
+func (m *Molecule) dropBondFromSgroups(id uint16) {
+	for k, g := range m.sgroups {
+		for i, bid := range g.Bonds {
+			if bid == id {
+				m.sgroups[k].Bonds = append(g.Bonds[:i:i], g.Bonds[i+1:]...)
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,163 @@
+package molecule
+
+import (
+	"fmt"
+	"sort"
+
+	cmn "github.com/RxnWeaver/rxnweaver/common"
+)
+
+// StereoGroup is an enhanced stereo group: a set of stereocentres
+// whose configurations, as drawn, are qualified together.  The
+// centres of an `AND` group are those of a racemic mixture of the
+// drawn configuration and its inverse; those of an `OR` group are
+// known relative to one another, but not absolutely.  Those of the
+// `ABS` group, and those in no group, are as drawn.
+//
+// A molecule may have at most one `ABS` group, and any number of `AND`
+// and `OR` groups, told apart by their numbers.  Each atom belongs to
+// at most one group.
+type StereoGroup struct {
+	Type   cmn.StereoGroupType
+	Number int      // Of an `AND` or `OR` group, as given; unique by type.
+	Atoms  []uint16 // Input IDs of the stereocentres, in ascending order.
+}
+
+// clone answers a copy of this group, not sharing its atoms.
+func (g StereoGroup) clone() StereoGroup {
+	g.Atoms = append([]uint16(nil), g.Atoms...)
+	return g
+}
+
+// cloneStereoGroups answers deep copies of the given groups.
+func cloneStereoGroups(gs []StereoGroup) []StereoGroup {
+	if gs == nil {
+		return nil
+	}
+	res := make([]StereoGroup, len(gs))
+	for i, g := range gs {
+		res[i] = g.clone()
+	}
+	return res
+}
+
+// SetStereoGroups replaces the enhanced stereo groups of this molecule
+// with the given ones.  Empty groups are dropped.  Giving none clears
+// them, so that all the stereocentres are as drawn.
+func (m *Molecule) SetStereoGroups(groups ...StereoGroup) error {
+	return statusError(m.Call(ReqSetStereoGroups, cloneStereoGroups(groups)), fmt.Sprintf("molecule %d", m.id))
+}
+
+// StereoGroups answers the enhanced stereo groups of this molecule,
+// `ABS` first, and then by type and number.
+func (m *Molecule) StereoGroups() ([]StereoGroup, error) {
+	reply := m.Call(ReqStereoGroups, nil)
+	if err := statusError(reply, fmt.Sprintf("molecule %d", m.id)); err != nil {
+		return nil, err
+	}
+	return reply.Payload.([]StereoGroup), nil
+}
+
+// handleSetStereoGroups validates the given groups, and sets them as
+// those of this molecule.
+func (m *Molecule) handleSetStereoGroups(p interface{}) (StatusType, interface{}) {
+	gs, ok := p.([]StereoGroup)
+	if !ok && p != nil {
+		return StIncorrectParameter, nil
+	}
+
+	res := make([]StereoGroup, 0, len(gs))
+	owner := make(map[uint16]int, len(m.atoms))
+	type key struct {
+		typ cmn.StereoGroupType
+		num int
+	}
+	seen := make(map[key]bool, len(gs))
+	for _, g := range gs {
+		if len(g.Atoms) == 0 {
+			continue
+		}
+		switch g.Type {
+		case cmn.StereoGroupAbsolute:
+			g.Number = 0
+		case cmn.StereoGroupAnd, cmn.StereoGroupOr:
+		default:
+			return StIncorrectParameter, fmt.Errorf("Unknown stereo group type : %d", g.Type)
+		}
+		k := key{g.Type, g.Number}
+		if seen[k] {
+			return StIncorrectParameter, fmt.Errorf("Duplicate stereo group : %s%d", g.Type, g.Number)
+		}
+		seen[k] = true
+
+		for _, iid := range g.Atoms {
+			if m.atomWithIid(iid) == nil {
+				return StNotFound, fmt.Errorf("Atom not found : %d", iid)
+			}
+			if _, ok := owner[iid]; ok {
+				return StIncorrectParameter, fmt.Errorf("Atom %d is in more than one stereo group.", iid)
+			}
+			owner[iid] = len(res)
+		}
+		g = g.clone()
+		sort.Slice(g.Atoms, func(i, j int) bool { return g.Atoms[i] < g.Atoms[j] })
+		res = append(res, g)
+	}
+	sort.SliceStable(res, func(i, j int) bool {
+		if res[i].Type != res[j].Type {
+			return res[i].Type < res[j].Type
+		}
+		return res[i].Number < res[j].Number
+	})
+
+	if len(res) == 0 {
+		res = nil
+	}
+	m.stereoGroups = res
+	m.invalidate()
+	return StSuccess, nil
+}
+
+// dropFromStereoGroups removes the atom with the given input ID from
+// the stereo groups of this molecule, dropping any group left empty.
+func (m *Molecule) dropFromStereoGroups(iid uint16) {
+	res := m.stereoGroups[:0]
+	for _, g := range m.stereoGroups {
+		for i, aid := range g.Atoms {
+			if aid == iid {
+				g.Atoms = append(g.Atoms[:i:i], g.Atoms[i+1:]...)
+				break
+			}
+		}
+		if len(g.Atoms) > 0 {
+			res = append(res, g)
+		}
+	}
+	if len(res) == 0 {
+		res = nil
+	}
+	m.stereoGroups = res
+}
+
+// stereoGroupKeys answers the stereo groups of this molecule, as
+// hashed, given the canonical classes of its atoms: each `AND` and
+// `OR` group by its type, and the classes of its atoms, in ascending
+// order.  Their numbers are arbitrary, and are not hashed.  The `ABS`
+// group is not hashed either, since its atoms are as those in no
+// group.
+func (m *Molecule) stereoGroupKeys(cls map[uint16]uint64) []uint64 {
+	res := make([]uint64, 0, len(m.stereoGroups))
+	for _, g := range m.stereoGroups {
+		if g.Type == cmn.StereoGroupAbsolute {
+			continue
+		}
+		vals := make([]uint64, 0, len(g.Atoms))
+		for _, iid := range g.Atoms {
+			vals = append(vals, cls[iid])
+		}
+		sort.Sort(uint64s(vals))
+		res = append(res, hashInts(append([]uint64{uint64(g.Type)}, vals...)...))
+	}
+	sort.Sort(uint64s(res))
+	return res
+}
@@ -0,0 +1,270 @@
+package molecule
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+
+	cmn "github.com/RxnWeaver/rxnweaver/common"
+)
+
+// _StereoAssignment is the assignment of a configuration to a
+// stereogenic unit left unassigned by a drawing: a wedge drawn from a
+// stereocentre, or a double bond turned about its axis.
+type _StereoAssignment struct {
+	bond   uint16 // Bond wedged, or turned.
+	wedge  bool   // Is this a wedge, rather than a double bond?
+	centre uint16 // Atom the wedge is drawn from.
+	flip   bool   // Down rather than up wedge; turned double bond.
+}
+
+// EnumerateStereoisomers answers up to `maxN` stereoisomers of this
+// molecule, with all its potential stereocentres and stereogenic
+// double bonds assigned configurations.  Units already assigned by
+// the drawing keep their configurations; thus, a molecule fully
+// assigned answers a single copy of itself.  This serves registration
+// systems, which receive flat drawings.
+//
+// Unassigned stereocentres are those perceived as such, without a
+// determined configuration, and ring stereo atoms without determined
+// faces; see `RingRelation`.  Each is assigned by wedges drawn from it
+// in its 2-D coordinates, up and down.  Unassigned double bonds are
+// those drawn as `either', or with a wavy bond from an end; each is
+// assigned as drawn, and turned about its axis, by rotating the atoms
+// on one side by half a turn.  Double bonds in rings, and those drawn
+// with their substituents in line, are not assigned.  Pseudo-asymmetric centres arising from the assignment
+// of others are assigned in turn.  Isomers that are the same, such as
+// the two drawings of a meso compound, are answered once; they are
+// told apart by their structure hashes.
+//
+// The isomers are new molecules, tracked by the registry of this one,
+// unless it is passive, in which case so are they.  This molecule
+// should have been sanitised; so are the isomers.  It must have 2-D
+// coordinates, should it have any unassigned stereocentre.
+func (m *Molecule) EnumerateStereoisomers(maxN int) ([]*Molecule, error) {
+	reply := m.Call(ReqEnumerateStereoisomers, maxN)
+	if err := statusError(reply, fmt.Sprintf("molecule %d", m.id)); err != nil {
+		return nil, err
+	}
+	return reply.Payload.([]*Molecule), nil
+}
+
+// handleEnumerateStereoisomers answers up to the requested number of
+// stereoisomers of this molecule.
+func (m *Molecule) handleEnumerateStereoisomers(p interface{}) (StatusType, interface{}) {
+	maxN, ok := p.(int)
+	if !ok || maxN <= 0 {
+		return StIncorrectParameter, nil
+	}
+
+	found := [][]_StereoAssignment(nil)
+	seen := make(map[MolHash]bool)
+	done := make(map[_StereoAssignment]bool) // Units assigned, by their bonds and centres.
+	var err error
+	var search func(x *Molecule, path []_StereoAssignment)
+	search = func(x *Molecule, path []_StereoAssignment) {
+		if len(found) >= maxN || err != nil {
+			return
+		}
+
+		u, ok := x.unassignedUnit(done)
+		if !ok {
+			if k := x.structureHash(registrationHashOptions); !seen[k] {
+				seen[k] = true
+				found = append(found, append([]_StereoAssignment(nil), path...))
+			}
+			return
+		}
+		if u.wedge && !x.canDrawWedges() {
+			err = fmt.Errorf("Molecule %d lacks the 2-D coordinates to assign stereocentre %d.", m.id, u.centre)
+			return
+		}
+
+		key := _StereoAssignment{bond: u.bond, wedge: u.wedge, centre: u.centre}
+		done[key] = true
+		for _, flip := range []bool{false, true} {
+			u.flip = flip
+			y := x.duplicate(true)
+			y.assignStereo(u)
+			search(y, append(path, u))
+			y.Release()
+		}
+		delete(done, key)
+	}
+	base := m.duplicate(true)
+	search(base, nil)
+	base.Release()
+	if err != nil {
+		return StIncorrectParameter, err
+	}
+
+	res := make([]*Molecule, 0, len(found))
+	for _, path := range found {
+		c := m.duplicate(m.passive)
+		for _, u := range path {
+			c.assignStereo(u)
+		}
+		if !c.passive {
+			c.start(context.Background())
+		}
+		res = append(res, c)
+	}
+	return StSuccess, res
+}
+
+// unassignedUnit answers the assignment, yet to be flipped, of the
+// first stereogenic unit of this molecule left unassigned, skipping
+// those already done.  Stereocentres precede double bonds.
+func (m *Molecule) unassignedUnit(done map[_StereoAssignment]bool) (_StereoAssignment, bool) {
+	for _, a := range m.atoms {
+		switch {
+		case a.stereoType == cmn.StereoTypeTetrahedral && a.cip == cmn.CIPNone:
+		case a.stereoType == cmn.StereoTypeRing && !a.hasRingFace():
+		default:
+			continue
+		}
+		if b := a.wedgeableBond(); b != nil && !done[_StereoAssignment{bond: b.id, wedge: true, centre: a.iId}] {
+			return _StereoAssignment{bond: b.id, wedge: true, centre: a.iId}, true
+		}
+	}
+	for _, b := range m.bonds {
+		if b.stereoType != cmn.StereoTypeDoubleBond || !b.isDrawnEither() || b.isCyclic() {
+			continue
+		}
+		s1, s2 := b.axisOrthos(m.atomWithIid(b.a1)), b.axisOrthos(m.atomWithIid(b.a2))
+		if len(s1) == 0 || len(s2) == 0 || done[_StereoAssignment{bond: b.id}] {
+			continue
+		}
+		if _, ok := b.drawnSides(s1[0], s2[0]); ok {
+			return _StereoAssignment{bond: b.id}, true
+		}
+	}
+	return _StereoAssignment{}, false
+}
+
+// wedgeableBond answers the bond from this atom best drawn as a wedge,
+// to assign its configuration: a single bond, not wedged from its
+// other atom, preferably outside rings, and to an atom that is not a
+// stereocentre itself.  It answers `nil` if there is none.
+func (a *_Atom) wedgeableBond() *_Bond {
+	m := a.mol
+	cands := make([]*_Bond, 0, len(a.adj))
+	for _, nbr := range a.adj {
+		b := m.bondWithId(nbr.Bond)
+		if b.bType != cmn.BondTypeSingle {
+			continue
+		}
+		if b.a1 != a.iId && b.bStereo != cmn.BondStereoNone {
+			continue
+		}
+		cands = append(cands, b)
+	}
+	sort.SliceStable(cands, func(i, j int) bool {
+		if ci, cj := cands[i].isCyclic(), cands[j].isCyclic(); ci != cj {
+			return !ci
+		}
+		si := m.atomWithIid(cands[i].otherAtomIid(a.iId)).stereoType != cmn.StereoTypeNone
+		sj := m.atomWithIid(cands[j].otherAtomIid(a.iId)).stereoType != cmn.StereoTypeNone
+		return !si && sj
+	})
+	if len(cands) == 0 {
+		return nil
+	}
+	return cands[0]
+}
+
+// canDrawWedges answers if wedges drawn in this molecule determine
+// configurations: if it has 2-D coordinates, but not 3-D ones.
+func (m *Molecule) canDrawWedges() bool {
+	if m.has3DCoordinates() {
+		return false
+	}
+	for _, a := range m.atoms {
+		if a.X != 0 || a.Y != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// assignStereo applies the given assignment to this molecule, and
+// perceives its stereo afresh.
+func (m *Molecule) assignStereo(u _StereoAssignment) {
+	b := m.bondWithId(u.bond)
+	if !u.wedge {
+		b.bStereo = cmn.BondStereoNone
+		for _, iid := range []uint16{b.a1, b.a2} {
+			m.clearEitherWedges(m.atomWithIid(iid))
+		}
+		if u.flip {
+			m.turnDoubleBond(b)
+		}
+		m.perceiveStereo()
+		return
+	}
+
+	m.clearEitherWedges(m.atomWithIid(u.centre))
+	if b.a1 != u.centre {
+		b.a1, b.a2 = b.a2, b.a1
+	}
+	b.bStereo = cmn.BondStereoUp
+	if u.flip {
+		b.bStereo = cmn.BondStereoDown
+	}
+	m.perceiveStereo()
+}
+
+// clearEitherWedges clears the bonds of unknown sense drawn from the
+// given atom, which an assignment supersedes.
+func (m *Molecule) clearEitherWedges(a *_Atom) {
+	for _, nbr := range a.adj {
+		if ob := m.bondWithId(nbr.Bond); ob.a1 == a.iId && ob.bStereo == cmn.BondStereoEither {
+			ob.bStereo = cmn.BondStereoNone
+		}
+	}
+}
+
+// turnDoubleBond rotates the atoms on the side of the second atom of
+// the given acyclic double bond by half a turn about its axis,
+// exchanging its configuration.  The wedges among them are reversed,
+// since the rotation takes the atoms above the plane below it, so
+// that their stereocentres keep their configurations.
+func (m *Molecule) turnDoubleBond(b *_Bond) {
+	side := map[uint16]bool{b.a2: true}
+	stack := []uint16{b.a2}
+	for len(stack) > 0 {
+		a := m.atomWithIid(stack[len(stack)-1])
+		stack = stack[:len(stack)-1]
+		for _, nbr := range a.adj {
+			if nbr.Bond != b.id && !side[nbr.Atom] {
+				side[nbr.Atom] = true
+				stack = append(stack, nbr.Atom)
+			}
+		}
+	}
+
+	p1 := m.atomWithIid(b.a1).point()
+	u := sub(m.atomWithIid(b.a2).point(), p1)
+	l := math.Sqrt(dot(u, u))
+	u = Point{u[0] / l, u[1] / l, u[2] / l}
+	for iid := range side {
+		a := m.atomWithIid(iid)
+		v := sub(a.point(), p1)
+		d := 2 * dot(v, u)
+		a.X = float32(p1[0] + d*u[0] - v[0])
+		a.Y = float32(p1[1] + d*u[1] - v[1])
+		a.Z = float32(p1[2] + d*u[2] - v[2])
+	}
+	for _, ob := range m.bonds {
+		if !side[ob.a1] || !side[ob.a2] {
+			continue
+		}
+		switch ob.bStereo {
+		case cmn.BondStereoUp:
+			ob.bStereo = cmn.BondStereoDown
+		case cmn.BondStereoDown:
+			ob.bStereo = cmn.BondStereoUp
+		}
+	}
+}
@@ -0,0 +1,380 @@
+package molecule
+
+import (
+	"fmt"
+	"sort"
+
+	cmn "github.com/RxnWeaver/rxnweaver/common"
+)
+
+// SubstructureQuery is the payload of `ReqSubstructureMatches`.  It
+// describes the query molecule by snapshots of its atoms and bonds,
+// since one molecule can not look into another.
+type SubstructureQuery struct {
+	Atoms []AtomInfo
+	Bonds []BondInfo
+	Max   int  // Most matches wanted; `0` means all.
+	Maps  bool // Whether to answer every map, even of the same atoms.
+
+	AtomConstraints map[uint16]AtomConstraint // By input ID of query atom; optional.
+	BondConstraints map[uint16]BondConstraint // By ID of query bond; optional.
+}
+
+// AtomConstraint qualifies the match of a query atom, as the primitives
+// of SMARTS do, beyond what the atom itself can say.  Counts of `-1`
+// are not compared; see `NewAtomConstraint`.
+type AtomConstraint struct {
+	AnyElement bool    // Whether the element of the query atom is not compared.
+	Elements   []uint8 // Atomic numbers, any of which matches, in place of that of the query atom.
+	Charged    bool    // Whether the charge must match, even if `0`.
+	Aromatic   int8    // `1` for aromatic atoms only, `-1` for aliphatic ones only; `0` for either.
+	Ring       int8    // `1` for ring atoms only, `-1` for acyclic ones only; `0` for either.
+
+	HCount       int // Total hydrogens, `H`.
+	Degree       int // Distinct neighbours, `D`.
+	Connectivity int // Distinct neighbours and hydrogens, `X`.
+}
+
+// NewAtomConstraint answers a constraint comparing none of the counts.
+func NewAtomConstraint() AtomConstraint {
+	return AtomConstraint{HCount: -1, Degree: -1, Connectivity: -1}
+}
+
+// BondConstraint widens the match of a query bond beyond its type, as
+// the bond primitives of SMARTS do.
+type BondConstraint uint8
+
+const (
+	BondAsGiven          BondConstraint = iota // Matches as the type of the bond.
+	BondSingleOrAromatic                       // As an unwritten SMARTS bond.
+	BondAny                                    // As `~`.
+)
+
+// Query is a substructure query with constraints on its atoms and bonds
+// beyond those of its molecule, and map numbers of its atoms, as read
+// from SMARTS by `loader.ReadSmarts`.  Its molecule is passive.
+type Query struct {
+	Mol   *Molecule
+	Atoms map[uint16]AtomConstraint // By input ID.
+	Bonds map[uint16]BondConstraint // By bond ID.
+	Maps  map[uint16]int            // Atom map numbers, by input ID; `:n` of SMARTS.
+
+	// Parities declared by the chirality of atoms, `@` and `@@`, by
+	// input ID; see `AtomBuilder.Parity`.  They do not restrict the
+	// matches of the query.
+	Parities map[uint16]cmn.StereoParity
+}
+
+// SubstructureMatches answers the occurrences of the given query
+// molecule in this molecule, as maps of the input IDs of the query's
+// atoms to those of this molecule's.  Occurrences covering the same
+// set of atoms are answered once.  At most `max` occurrences are
+// answered, unless it is `0`.
+//
+// A query atom matches an atom of the same element.  If the query
+// atom is charged or isotopic, the charge and the mass number must
+// match as well.  A query bond matches a bond of the same type; an
+// aromatic query bond, perceived or given as such, matches any
+// aromatic bond, and only such; a single-or-double query bond matches
+// any single or double bond, aromatic or not.
+// Hydrogen counts are not compared, so that a query matches wherever
+// its heavy atoms can be substituted.  Hydrogen atoms without
+// neighbours in the query are ignored.
+//
+// Both molecules should have been sanitised alike, so that their
+// aromaticity is comparable.
+func (m *Molecule) SubstructureMatches(query *Molecule, max int) ([]map[uint16]uint16, error) {
+	return m.substructureMaps(query, SubstructureQuery{Max: max})
+}
+
+// SubstructureMaps answers the maps of the atoms of the given query
+// molecule to those of this molecule, as `SubstructureMatches` does,
+// but including every map covering the same set of atoms, as those of
+// the symmetries of the query.  At most `max` maps are answered,
+// unless it is `0`.
+func (m *Molecule) SubstructureMaps(query *Molecule, max int) ([]map[uint16]uint16, error) {
+	return m.substructureMaps(query, SubstructureQuery{Max: max, Maps: true})
+}
+
+// QueryMaps answers the maps of the atoms of the molecule of the given
+// query to those of this molecule, as `SubstructureMaps` does, subject
+// to the constraints of the query.  At most `max` maps are answered,
+// unless it is `0`.
+func (m *Molecule) QueryMaps(q *Query, max int) ([]map[uint16]uint16, error) {
+	return m.substructureMaps(q.Mol, SubstructureQuery{Max: max, Maps: true, AtomConstraints: q.Atoms, BondConstraints: q.Bonds})
+}
+
+// substructureMaps completes the given query with the atoms and bonds
+// of the given query molecule, and answers its maps in this molecule.
+func (m *Molecule) substructureMaps(query *Molecule, q SubstructureQuery) ([]map[uint16]uint16, error) {
+	it := query.Atoms()
+	for it.Next() {
+		if a := it.Atom(); a.AtomicNumber != 1 || len(a.Neighbours) > 0 {
+			q.Atoms = append(q.Atoms, a)
+		}
+	}
+	if err := it.Err(); err != nil {
+		return nil, err
+	}
+	bit := query.Bonds()
+	for bit.Next() {
+		q.Bonds = append(q.Bonds, bit.Bond())
+	}
+	if err := bit.Err(); err != nil {
+		return nil, err
+	}
+
+	reply := m.Call(ReqSubstructureMatches, q)
+	if err := statusError(reply, fmt.Sprintf("molecule %d", m.id)); err != nil {
+		return nil, err
+	}
+	return reply.Payload.([]map[uint16]uint16), nil
+}
+
+// HasSubstructure answers if the given query molecule occurs in this
+// molecule.  See `SubstructureMatches`.
+func (m *Molecule) HasSubstructure(query *Molecule) (bool, error) {
+	ms, err := m.SubstructureMatches(query, 1)
+	if err != nil {
+		return false, err
+	}
+	return len(ms) > 0, nil
+}
+
+// _QueryBond is a bond of a substructure query, from one of its atoms.
+type _QueryBond struct {
+	to   int // Index of the other atom.
+	bond BondInfo
+}
+
+// _Matcher searches for occurrences of a query in a molecule, by
+// extending partial maps of the query atoms, one atom at a time.
+type _Matcher struct {
+	mol   *Molecule
+	atoms []AtomInfo
+	adj   [][]_QueryBond
+	acons map[uint16]AtomConstraint
+	bcons map[uint16]BondConstraint
+	order []int // Query atoms, in the order of mapping.
+	from  []int // The mapped neighbour to extend from; `-1` for any atom.
+
+	mapped  []*_Atom        // By query atom.
+	used    map[uint16]bool // Atoms of the molecule in use.
+	seen    map[string]bool // Atom sets already answered.
+	matches []map[uint16]uint16
+	max     int
+	maps    bool // Whether to answer maps of the same atoms.
+}
+
+// handleSubstructureMatches answers the occurrences of the given query
+// in this molecule.
+func (m *Molecule) handleSubstructureMatches(p interface{}) (StatusType, interface{}) {
+	q, ok := p.(SubstructureQuery)
+	if !ok {
+		return StIncorrectParameter, nil
+	}
+
+	mt := &_Matcher{
+		mol:    m,
+		atoms:  q.Atoms,
+		adj:    make([][]_QueryBond, len(q.Atoms)),
+		mapped: make([]*_Atom, len(q.Atoms)),
+		used:   make(map[uint16]bool),
+		seen:   make(map[string]bool),
+		max:    q.Max,
+		maps:   q.Maps,
+		acons:  q.AtomConstraints,
+		bcons:  q.BondConstraints,
+	}
+	idx := make(map[uint16]int, len(q.Atoms))
+	for i, a := range q.Atoms {
+		idx[a.Iid] = i
+	}
+	for _, b := range q.Bonds {
+		i, ok1 := idx[b.A1]
+		j, ok2 := idx[b.A2]
+		if !ok1 || !ok2 {
+			return StIncorrectParameter, fmt.Errorf("Query bond %d joins atoms not in the query.", b.Id)
+		}
+		mt.adj[i] = append(mt.adj[i], _QueryBond{j, b})
+		mt.adj[j] = append(mt.adj[j], _QueryBond{i, b})
+	}
+
+	mt.plan()
+	if len(mt.atoms) > 0 {
+		mt.extend(0)
+	}
+	return StSuccess, mt.matches
+}
+
+// plan orders the query atoms for mapping.  Each connected component
+// of the query is traversed breadth-first from its atom of the highest
+// degree, so that every atom but the first of its component is mapped
+// next to an already mapped neighbour.
+func (mt *_Matcher) plan() {
+	n := len(mt.atoms)
+	byDegree := make([]int, n)
+	for i := range byDegree {
+		byDegree[i] = i
+	}
+	sort.SliceStable(byDegree, func(x, y int) bool {
+		return len(mt.adj[byDegree[x]]) > len(mt.adj[byDegree[y]])
+	})
+
+	done := make([]bool, n)
+	for _, s := range byDegree {
+		if done[s] {
+			continue
+		}
+		done[s] = true
+		mt.order = append(mt.order, s)
+		mt.from = append(mt.from, -1)
+		for k := len(mt.order) - 1; k < len(mt.order); k++ {
+			i := mt.order[k]
+			for _, qb := range mt.adj[i] {
+				if !done[qb.to] {
+					done[qb.to] = true
+					mt.order = append(mt.order, qb.to)
+					mt.from = append(mt.from, i)
+				}
+			}
+		}
+	}
+}
+
+// extend maps the `k`th query atom in order to each of its candidates
+// in turn, and recurses.  It answers `false` once enough matches have
+// been found.
+func (mt *_Matcher) extend(k int) bool {
+	if k == len(mt.order) {
+		mt.record()
+		return mt.max == 0 || len(mt.matches) < mt.max
+	}
+
+	i := mt.order[k]
+	var cands []*_Atom
+	if f := mt.from[k]; f >= 0 {
+		for _, nbr := range mt.mapped[f].adj {
+			cands = append(cands, mt.mol.atomWithIid(nbr.Atom))
+		}
+	} else {
+		cands = mt.mol.atoms
+	}
+
+	for _, a := range cands {
+		if mt.used[a.iId] || !mt.atomMatches(i, a) || !mt.bondsMatch(i, a) {
+			continue
+		}
+		mt.mapped[i] = a
+		mt.used[a.iId] = true
+		more := mt.extend(k + 1)
+		mt.used[a.iId] = false
+		mt.mapped[i] = nil
+		if !more {
+			return false
+		}
+	}
+	return true
+}
+
+// atomMatches answers if the given atom can be mapped to the `i`th
+// query atom, considering the atoms alone.
+func (mt *_Matcher) atomMatches(i int, a *_Atom) bool {
+	q := mt.atoms[i]
+	c, ok := mt.acons[q.Iid]
+	if !ok {
+		c = NewAtomConstraint()
+	}
+	switch {
+	case !c.AnyElement && len(c.Elements) == 0 && a.atNum != q.AtomicNumber:
+		return false
+	case len(c.Elements) > 0 && !containsElement(c.Elements, a.atNum):
+		return false
+	case (q.Charge != 0 || c.Charged) && a.charge != q.Charge:
+		return false
+	case q.Isotope != 0 && a.isotope != q.Isotope:
+		return false
+	case (q.IsAromatic || c.Aromatic > 0) && !a.isAromatic():
+		return false
+	case c.Aromatic < 0 && a.isAromatic():
+		return false
+	case c.Ring != 0 && a.isCyclic() != (c.Ring > 0):
+		return false
+	case c.HCount >= 0 && int(a.hCount) != c.HCount:
+		return false
+	case c.Degree >= 0 && len(a.adj) != c.Degree:
+		return false
+	case c.Connectivity >= 0 && len(a.adj)+int(a.hCount) != c.Connectivity:
+		return false
+	}
+	return len(a.adj) >= len(mt.adj[i])
+}
+
+// containsElement answers if the given atomic numbers include the
+// given one.
+func containsElement(els []uint8, n uint8) bool {
+	for _, el := range els {
+		if el == n {
+			return true
+		}
+	}
+	return false
+}
+
+// bondsMatch answers if the bonds of the `i`th query atom to the query
+// atoms already mapped are matched by bonds of the given atom to the
+// atoms they are mapped to.
+func (mt *_Matcher) bondsMatch(i int, a *_Atom) bool {
+	for _, qb := range mt.adj[i] {
+		t := mt.mapped[qb.to]
+		if t == nil {
+			continue
+		}
+		b := a.bondTo(t.iId)
+		if b == nil {
+			return false
+		}
+		switch {
+		case mt.bcons[qb.bond.Id] == BondAny:
+		case mt.bcons[qb.bond.Id] == BondSingleOrAromatic:
+			if !b.isAro && b.bType != cmn.BondTypeSingle {
+				return false
+			}
+		case qb.bond.Type == cmn.BondTypeSingleOrDouble:
+			if b.bType != cmn.BondTypeSingle && b.bType != cmn.BondTypeDouble {
+				return false
+			}
+		case qb.bond.IsAromatic || qb.bond.Type == cmn.BondTypeAltern || b.isAro:
+			if !b.isAro || !(qb.bond.IsAromatic || qb.bond.Type == cmn.BondTypeAltern) {
+				return false
+			}
+		case b.bType != qb.bond.KekuleType:
+			return false
+		}
+	}
+	return true
+}
+
+// record adds the current complete map to the matches, unless a match
+// covering the same atoms has been recorded, and every map is not
+// wanted.
+func (mt *_Matcher) record() {
+	if !mt.maps {
+		iids := make([]int, len(mt.mapped))
+		for i, a := range mt.mapped {
+			iids[i] = int(a.iId)
+		}
+		sort.Ints(iids)
+		key := fmt.Sprint(iids)
+		if mt.seen[key] {
+			return
+		}
+		mt.seen[key] = true
+	}
+
+	match := make(map[uint16]uint16, len(mt.mapped))
+	for i, a := range mt.mapped {
+		match[mt.atoms[i].Iid] = a.iId
+	}
+	mt.matches = append(mt.matches, match)
+}
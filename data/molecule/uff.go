@@ -0,0 +1,477 @@
+package molecule
+
+import (
+	"fmt"
+	"math"
+
+	cmn "github.com/RxnWeaver/rxnweaver/common"
+)
+
+// _UFFType holds the UFF parameters of an atom type.
+//
+// A. K. Rappé, C. J. Casewit, K. S. Colwell, W. A. Goddard III and
+// W. M. Skiff, UFF, a Full Periodic Table Force Field for Molecular
+// Mechanics and Molecular Dynamics Simulations.  J. Am. Chem. Soc.
+// 1992, 114, 10024-10035.
+type _UFFType struct {
+	r     float64 // Bond radius.
+	theta float64 // Ideal angle, in degrees.
+	x, d  float64 // Van der Waals distance and well depth.
+	z     float64 // Effective charge.
+	v, u  float64 // Torsional barriers of sp3 and sp2 atoms.
+	chi   float64 // GMP electronegativity.
+}
+
+// uffTypeTable holds the UFF atom types assigned by `uffType`, by their
+// labels.
+var uffTypeTable = map[string]_UFFType{
+	"H_":    {0.354, 180, 2.886, 0.044, 0.712, 0, 0, 4.528},
+	"Li":    {1.336, 180, 2.451, 0.025, 1.000, 0, 2.0, 3.006},
+	"B_3":   {0.838, 109.47, 4.083, 0.180, 1.755, 0, 1.25, 4.750},
+	"B_2":   {0.828, 120, 4.083, 0.180, 1.755, 0, 1.25, 4.750},
+	"C_3":   {0.757, 109.47, 3.851, 0.105, 1.912, 2.119, 2.0, 5.343},
+	"C_R":   {0.729, 120, 3.851, 0.105, 1.912, 0, 2.0, 5.343},
+	"C_2":   {0.732, 120, 3.851, 0.105, 1.912, 0, 2.0, 5.343},
+	"C_1":   {0.706, 180, 3.851, 0.105, 1.912, 0, 2.0, 5.343},
+	"N_3":   {0.700, 106.7, 3.660, 0.069, 2.544, 0.450, 2.0, 6.899},
+	"N_R":   {0.699, 120, 3.660, 0.069, 2.544, 0, 2.0, 6.899},
+	"N_2":   {0.685, 111.2, 3.660, 0.069, 2.544, 0, 2.0, 6.899},
+	"N_1":   {0.656, 180, 3.660, 0.069, 2.544, 0, 2.0, 6.899},
+	"O_3":   {0.658, 104.51, 3.500, 0.060, 2.300, 0.018, 2.0, 8.741},
+	"O_R":   {0.680, 110, 3.500, 0.060, 2.300, 0, 2.0, 8.741},
+	"O_2":   {0.634, 120, 3.500, 0.060, 2.300, 0, 2.0, 8.741},
+	"O_1":   {0.639, 180, 3.500, 0.060, 2.300, 0, 2.0, 8.741},
+	"F_":    {0.668, 180, 3.364, 0.050, 1.735, 0, 2.0, 10.874},
+	"Na":    {1.539, 180, 2.983, 0.030, 1.081, 0, 1.25, 2.843},
+	"Mg3+2": {1.421, 109.47, 3.021, 0.111, 1.787, 0, 1.25, 3.951},
+	"Al3":   {1.244, 109.47, 4.499, 0.505, 1.792, 0, 1.25, 3.041},
+	"Si3":   {1.117, 109.47, 4.295, 0.402, 2.323, 1.225, 1.25, 4.168},
+	"P_3+3": {1.101, 93.8, 4.147, 0.305, 2.863, 2.4, 1.25, 5.463},
+	"P_3+5": {1.056, 109.47, 4.147, 0.305, 2.863, 2.4, 1.25, 5.463},
+	"S_3+2": {1.064, 92.1, 4.035, 0.274, 2.703, 0.484, 1.25, 6.928},
+	"S_3+4": {1.049, 103.2, 4.035, 0.274, 2.703, 0.484, 1.25, 6.928},
+	"S_3+6": {1.027, 109.47, 4.035, 0.274, 2.703, 0.484, 1.25, 6.928},
+	"S_R":   {1.077, 92.2, 4.035, 0.274, 2.703, 0, 1.25, 6.928},
+	"S_2":   {0.854, 120, 4.035, 0.274, 2.703, 0, 1.25, 6.928},
+	"Cl":    {1.044, 180, 3.947, 0.227, 2.348, 0, 1.25, 8.564},
+	"K_":    {1.953, 180, 3.812, 0.035, 1.165, 0, 0.7, 2.421},
+	"Ca6+2": {1.761, 90, 3.399, 0.238, 2.141, 0, 0.7, 3.231},
+	"Ti6+4": {1.412, 90, 3.175, 0.017, 2.659, 0, 0.7, 3.470},
+	"Cr6+3": {1.345, 90, 3.023, 0.015, 2.463, 0, 0.7, 3.415},
+	"Mn6+2": {1.382, 90, 2.961, 0.013, 2.430, 0, 0.7, 3.325},
+	"Fe3+2": {1.270, 109.47, 2.912, 0.013, 2.430, 0, 0.7, 3.760},
+	"Fe6+2": {1.335, 90, 2.912, 0.013, 2.430, 0, 0.7, 3.760},
+	"Co6+3": {1.241, 90, 2.872, 0.014, 2.430, 0, 0.7, 4.105},
+	"Ni4+2": {1.164, 90, 2.834, 0.015, 2.430, 0, 0.7, 4.465},
+	"Cu3+1": {1.302, 109.47, 3.495, 0.005, 1.756, 0, 0.7, 4.200},
+	"Zn3+2": {1.193, 109.47, 2.763, 0.124, 1.308, 0, 0.7, 5.106},
+	"Ge3":   {1.197, 109.47, 4.280, 0.379, 2.442, 0.701, 0.7, 4.600},
+	"As3+3": {1.211, 92.1, 4.230, 0.309, 2.414, 1.5, 0.7, 5.300},
+	"Se3+2": {1.190, 90.6, 4.205, 0.291, 2.400, 0.335, 0.7, 5.800},
+	"Br":    {1.192, 180, 4.189, 0.251, 2.519, 0, 0.7, 7.790},
+	"Ru6+2": {1.478, 90, 2.963, 0.056, 3.400, 0, 0.2, 3.400},
+	"Rh6+3": {1.332, 90, 2.929, 0.053, 3.508, 0, 0.2, 3.500},
+	"Pd4+2": {1.338, 90, 2.899, 0.048, 3.210, 0, 0.2, 4.320},
+	"Ag1+1": {1.386, 180, 3.148, 0.036, 1.956, 0, 0.2, 4.436},
+	"Sn3":   {1.399, 109.47, 4.392, 0.567, 2.961, 0.199, 0.2, 3.987},
+	"I_":    {1.382, 180, 4.500, 0.339, 2.650, 0, 0.2, 6.822},
+	"Pt4+2": {1.364, 90, 2.754, 0.080, 3.160, 0, 0.1, 4.869},
+	"Au4+3": {1.262, 90, 3.293, 0.039, 3.240, 0, 0.1, 4.894},
+	"Hg1+2": {1.340, 180, 2.705, 0.385, 1.750, 0, 0.1, 6.270},
+}
+
+// uffMetalTypes holds the UFF types of the elements whose type does not
+// depend on their bonding, by atomic number.
+var uffMetalTypes = map[uint8]string{
+	3:  "Li",
+	11: "Na",
+	12: "Mg3+2",
+	13: "Al3",
+	14: "Si3",
+	19: "K_",
+	20: "Ca6+2",
+	22: "Ti6+4",
+	24: "Cr6+3",
+	25: "Mn6+2",
+	27: "Co6+3",
+	28: "Ni4+2",
+	29: "Cu3+1",
+	30: "Zn3+2",
+	32: "Ge3",
+	33: "As3+3",
+	34: "Se3+2",
+	44: "Ru6+2",
+	45: "Rh6+3",
+	46: "Pd4+2",
+	47: "Ag1+1",
+	50: "Sn3",
+	78: "Pt4+2",
+	79: "Au4+3",
+	80: "Hg1+2",
+}
+
+// uffTypes answers the UFF types of the nodes of the given graph.
+func uffTypes(g *_FFGraph) ([]string, error) {
+	types := make([]string, len(g.atoms))
+	for i := range g.atoms {
+		if g.isH[i] {
+			types[i] = "H_"
+			continue
+		}
+		a := g.atoms[i]
+		t := uffType(a)
+		if _, ok := uffTypeTable[t]; !ok {
+			return nil, fmt.Errorf("Atom %d (%s) of molecule %d has no UFF type.", a.iId, a.symbol, g.mol.id)
+		}
+		types[i] = t
+	}
+	return types, nil
+}
+
+// uffType answers the UFF type of the given atom, or an empty string if
+// it has none.
+func uffType(a *_Atom) string {
+	oxo := 0
+	conj := false
+	for _, nbr := range a.adj {
+		o := a.mol.atomWithIid(nbr.Atom)
+		b := a.mol.bondWithId(nbr.Bond)
+		if o.atNum == 8 && b.bType == cmn.BondTypeDouble {
+			oxo++
+		}
+		if b.bType == cmn.BondTypeSingle && (o.isInAroRing || o.doubleBondCount > 0) {
+			conj = true
+		}
+	}
+
+	switch a.atNum {
+	case 5:
+		if mmffConnectivity(a) == 4 {
+			return "B_3"
+		}
+		return "B_2"
+	case 6, 7, 8:
+		sym := map[uint8]string{6: "C", 7: "N", 8: "O"}[a.atNum]
+		switch {
+		case a.isInAroRing:
+			return sym + "_R"
+		case a.tripleBondCount > 0 || a.doubleBondCount > 1:
+			return sym + "_1"
+		case a.doubleBondCount > 0:
+			return sym + "_2"
+		case a.atNum == 7 && conj && a.charge == 0:
+			return "N_R"
+		}
+		return sym + "_3"
+	case 9:
+		return "F_"
+	case 15:
+		if oxo > 0 || mmffConnectivity(a) > 3 {
+			return "P_3+5"
+		}
+		return "P_3+3"
+	case 16:
+		switch {
+		case a.isInAroRing:
+			return "S_R"
+		case oxo >= 2:
+			return "S_3+6"
+		case oxo == 1:
+			return "S_3+4"
+		case a.doubleBondCount > 0 && len(a.adj) == 1:
+			return "S_2"
+		}
+		return "S_3+2"
+	case 17:
+		return "Cl"
+	case 26:
+		if len(a.adj) > 4 {
+			return "Fe6+2"
+		}
+		return "Fe3+2"
+	case 35:
+		return "Br"
+	case 53:
+		return "I_"
+	}
+	return uffMetalTypes[a.atNum]
+}
+
+// _UFFBend is a UFF angle bending term, with its centre `j`.  It is a
+// Fourier series in the angle, of the given periodicity if that is not
+// zero.
+type _UFFBend struct {
+	i, j, k    int
+	ka         float64
+	c0, c1, c2 float64
+	n          int
+}
+
+// _UFFTorsion is a UFF torsion term about the bond `j`-`k`.
+type _UFFTorsion struct {
+	i, j, k, l int
+	v          float64
+	n          int
+	cos        float64 // Cosine of the product of the periodicity and the ideal angle.
+}
+
+// _UFF is the UFF force field of a molecule.  It comprises the bond
+// stretching, angle bending, torsion, inversion and van der Waals
+// terms.
+type _UFF struct {
+	stretches []_Stretch
+	bends     []_UFFBend
+	torsions  []_UFFTorsion
+	oops      []_OutOfPlane
+	pairs     []_Pair
+
+	sp []int
+	r0 []float64
+}
+
+// newUFF answers the UFF force field of the given graph.  It answers an
+// error if an atom has no UFF type.
+func newUFF(g *_FFGraph) (*_UFF, error) {
+	types, err := uffTypes(g)
+	if err != nil {
+		return nil, err
+	}
+
+	n := len(g.atoms)
+	ff := &_UFF{sp: make([]int, n), r0: make([]float64, n)}
+	for i, t := range types {
+		switch uffTypeTable[t].theta {
+		case 180:
+			ff.sp[i] = 1
+		case 120:
+			ff.sp[i] = 2
+		default:
+			ff.sp[i] = 3
+		}
+	}
+
+	r0 := make(map[[2]int]float64, len(g.bonds))
+	order := make(map[[2]int]float64, len(g.bonds))
+	for _, b := range g.bonds {
+		ti, tj := uffTypeTable[types[b.i]], uffTypeTable[types[b.j]]
+		bo := uffBondOrder(b, types[b.i], types[b.j])
+		r := uffBondLength(ti, tj, bo)
+		r0[[2]int{b.i, b.j}], r0[[2]int{b.j, b.i}] = r, r
+		order[[2]int{b.i, b.j}], order[[2]int{b.j, b.i}] = bo, bo
+		if g.isH[b.j] {
+			ff.r0[b.j] = r
+		}
+		ff.stretches = append(ff.stretches, _Stretch{b.i, b.j, 664.12 * ti.z * tj.z / (r * r * r), r})
+	}
+
+	for j := 0; j < g.heavy; j++ {
+		tj := uffTypeTable[types[j]]
+		nbrs := g.adj[j]
+		for x, i := range nbrs {
+			for _, k := range nbrs[x+1:] {
+				ff.bends = append(ff.bends, uffBend(i, j, k, uffTypeTable[types[i]], tj, uffTypeTable[types[k]],
+					r0[[2]int{i, j}], r0[[2]int{j, k}]))
+			}
+		}
+
+		// Inversion about trigonal carbon and nitrogen centres.
+		if len(nbrs) == 3 && (types[j] == "C_2" || types[j] == "C_R" || types[j] == "N_2" || types[j] == "N_R") {
+			k := 6.0
+			if types[j][0] == 'C' {
+				for _, i := range nbrs {
+					if types[i] == "O_2" {
+						k = 50
+					}
+				}
+			}
+			for x := 0; x < 3; x++ {
+				ff.oops = append(ff.oops, _OutOfPlane{nbrs[x], j, nbrs[(x+1)%3], nbrs[(x+2)%3], k / 3})
+			}
+		}
+	}
+
+	for _, b := range g.bonds {
+		j, k := b.i, b.j
+		v, per, cos := uffTorsion(uffTypeTable[types[j]], uffTypeTable[types[k]], ff.sp[j], ff.sp[k], order[[2]int{j, k}])
+		if v == 0 {
+			continue
+		}
+		terms := make([]_UFFTorsion, 0, 9)
+		for _, i := range g.adj[j] {
+			if i == k {
+				continue
+			}
+			for _, l := range g.adj[k] {
+				if l == j || l == i {
+					continue
+				}
+				terms = append(terms, _UFFTorsion{i, j, k, l, v, per, cos})
+			}
+		}
+		// The barrier is shared by all the torsions about the bond.
+		for _, t := range terms {
+			t.v /= float64(len(terms))
+			ff.torsions = append(ff.torsions, t)
+		}
+	}
+
+	for i := 0; i < n; i++ {
+		sep := g.separations(i, 2)
+		ti := uffTypeTable[types[i]]
+		for j := i + 1; j < n; j++ {
+			if _, ok := sep[j]; ok {
+				continue
+			}
+			tj := uffTypeTable[types[j]]
+			ff.pairs = append(ff.pairs, _Pair{i, j, math.Sqrt(ti.x * tj.x), math.Sqrt(ti.d * tj.d), 0})
+		}
+	}
+
+	return ff, nil
+}
+
+// uffBondOrder answers the UFF bond order of the given bond, between
+// atoms of the given types.  Amide C-N bonds have the order 1.41.
+func uffBondOrder(b _FFBond, t1, t2 string) float64 {
+	switch {
+	case b.isAro:
+		return 1.5
+	case b.bType == cmn.BondTypeDouble:
+		return 2
+	case b.bType == cmn.BondTypeTriple:
+		return 3
+	case (t1 == "C_2" && t2 == "N_R") || (t1 == "N_R" && t2 == "C_2"):
+		return 1.41
+	}
+	return 1
+}
+
+// uffBondLength answers the natural length of a bond of the given order
+// between atoms of the given types: the sum of their radii, with the
+// bond order and electronegativity corrections.
+func uffBondLength(ti, tj _UFFType, bo float64) float64 {
+	rbo := -0.1332 * (ti.r + tj.r) * math.Log(bo)
+	d := math.Sqrt(ti.chi) - math.Sqrt(tj.chi)
+	ren := ti.r * tj.r * d * d / (ti.chi*ti.r + tj.chi*tj.r)
+	return ti.r + tj.r + rbo - ren
+}
+
+// uffBend answers the bending term of the given angle, between atoms of
+// the given types, and with the given bond lengths.
+func uffBend(i, j, k int, ti, tj, tk _UFFType, rij, rjk float64) _UFFBend {
+	th0 := tj.theta * math.Pi / 180
+	cos0 := math.Cos(th0)
+	rik2 := rij*rij + rjk*rjk - 2*rij*rjk*cos0
+	ka := 664.12 / (rij * rjk) * ti.z * tk.z / math.Pow(rik2, 2.5) * rij * rjk * (3*rij*rjk*(1-cos0*cos0) - rik2*cos0)
+
+	t := _UFFBend{i: i, j: j, k: k, ka: ka}
+	switch tj.theta {
+	case 180:
+		t.n = 1
+	case 120:
+		t.n = 3
+	case 90:
+		t.n = 4
+	default:
+		sin2 := 1 - cos0*cos0
+		t.c2 = 1 / (4 * sin2)
+		t.c1 = -4 * t.c2 * cos0
+		t.c0 = t.c2 * (2*cos0*cos0 + 1)
+	}
+	return t
+}
+
+// uffTorsion answers the barrier, periodicity and cosine of the phase
+// of torsions about a bond of the given order between atoms of the
+// given types and hybridisations.  It answers a zero barrier if the
+// bond has no torsions.
+func uffTorsion(tj, tk _UFFType, spj, spk int, bo float64) (float64, int, float64) {
+	switch {
+	case spj == 3 && spk == 3:
+		return math.Sqrt(tj.v * tk.v), 3, -1
+	case spj == 2 && spk == 2:
+		return 5 * math.Sqrt(tj.u*tk.u) * (1 + 4.18*math.Log(bo)), 2, 1
+	case (spj == 2 && spk == 3) || (spj == 3 && spk == 2):
+		return 1, 6, 1
+	}
+	return 0, 0, 0
+}
+
+// hydrogenGeometry answers the hybridisations of the nodes, and the
+// ideal lengths of the bonds to hydrogens, by node.
+func (ff *_UFF) hydrogenGeometry() ([]int, []float64) {
+	return ff.sp, ff.r0
+}
+
+// energy answers the UFF energy of the given coordinates.
+func (ff *_UFF) energy(x []Point, grad []Point) float64 {
+	e := 0.0
+
+	for _, t := range ff.stretches {
+		d := sub(x[t.i], x[t.j])
+		r := math.Sqrt(dot(d, d))
+		dr := r - t.r0
+		e += 0.5 * t.kb * dr * dr
+		if grad != nil && r > 0 {
+			addPairGradient(grad, t.i, t.j, d, t.kb*dr/r)
+		}
+	}
+
+	for _, t := range ff.bends {
+		th, gi, gj, gk := angleGradient(x[t.i], x[t.j], x[t.k])
+		de := 0.0
+		switch t.n {
+		case 0:
+			e += t.ka * (t.c0 + t.c1*math.Cos(th) + t.c2*math.Cos(2*th))
+			de = t.ka * (-t.c1*math.Sin(th) - 2*t.c2*math.Sin(2*th))
+		case 1:
+			e += t.ka * (1 + math.Cos(th))
+			de = -t.ka * math.Sin(th)
+		default:
+			n := float64(t.n)
+			e += t.ka / (n * n) * (1 - math.Cos(n*th))
+			de = t.ka / n * math.Sin(n*th)
+		}
+		if grad != nil {
+			addScaled(grad, t.i, gi, de)
+			addScaled(grad, t.j, gj, de)
+			addScaled(grad, t.k, gk, de)
+		}
+	}
+
+	for _, t := range ff.torsions {
+		phi, gi, gj, gk, gl := dihedralGradient(x[t.i], x[t.j], x[t.k], x[t.l])
+		n := float64(t.n)
+		e += 0.5 * t.v * (1 - t.cos*math.Cos(n*phi))
+		if grad != nil {
+			de := 0.5 * t.v * t.cos * n * math.Sin(n*phi)
+			addScaled(grad, t.i, gi, de)
+			addScaled(grad, t.j, gj, de)
+			addScaled(grad, t.k, gk, de)
+			addScaled(grad, t.l, gl, de)
+		}
+	}
+
+	for _, t := range ff.oops {
+		f := func(x []Point) float64 {
+			return t.koop * (1 - math.Cos(wilsonAngle(x[t.i], x[t.j], x[t.k], x[t.l])))
+		}
+		e += f(x)
+		if grad != nil {
+			numericGradient(f, x, grad, t.i, t.j, t.k, t.l)
+		}
+	}
+
+	for _, t := range ff.pairs {
+		d := sub(x[t.i], x[t.j])
+		r := math.Sqrt(dot(d, d))
+		s6 := math.Pow(t.rStar/r, 6)
+		e += t.eps * (s6*s6 - 2*s6)
+		if grad != nil && r > 0 {
+			de := t.eps * (-12*s6*s6 + 12*s6) / r
+			addPairGradient(grad, t.i, t.j, d, de/r)
+		}
+	}
+
+	return e
+}
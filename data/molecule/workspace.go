@@ -0,0 +1,352 @@
+package molecule
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	cmn "github.com/RxnWeaver/rxnweaver/common"
+)
+
+// A workspace is a stream of JSON values, one per line: a header,
+// followed by each molecule, as follows.
+//
+//	{"format": "rxnweaver-workspace", "version": 1}
+//	{"id": 12, "atoms": [...], "bonds": [...], "attributes": [...], ...}
+//
+// Atoms, bonds and their attributes, the attributes, provenance,
+// conformers, stereo groups and Sgroups of molecules are saved.
+// Derived properties, such as rings, aromaticity and stereo, are
+// perceived afresh upon loading.
+const (
+	workspaceFormat  = "rxnweaver-workspace"
+	workspaceVersion = 1
+)
+
+// Largest line of a workspace read, i.e. largest saved molecule.
+const maxWorkspaceLine = 64 * 1024 * 1024
+
+// _WorkspaceHeader is the first line of a workspace.
+type _WorkspaceHeader struct {
+	Format  string `json:"format"`
+	Version int    `json:"version"`
+}
+
+// _SavedMolecule is the saved form of a molecule.
+type _SavedMolecule struct {
+	Id               uint64           `json:"id"`
+	Vendor           string           `json:"vendor,omitempty"`
+	VendorMoleculeId string           `json:"vendorMoleculeId,omitempty"`
+	Source           SourceInfo       `json:"source"`
+	Steps            []ProvenanceStep `json:"steps,omitempty"`
+	Atoms            []_SavedAtom     `json:"atoms"`
+	Bonds            []_SavedBond     `json:"bonds"`
+	Attributes       []Attribute      `json:"attributes,omitempty"`
+	Conformers       []Conformer      `json:"conformers,omitempty"`
+	StereoGroups     []StereoGroup    `json:"stereoGroups,omitempty"`
+	Sgroups          []Sgroup         `json:"sgroups,omitempty"`
+}
+
+// _SavedAtom is the saved form of an atom.
+type _SavedAtom struct {
+	Iid        uint16           `json:"iid"`
+	AtNum      uint8            `json:"atNum"`
+	Symbol     string           `json:"symbol,omitempty"` // Of pseudo-elements.
+	Isotope    uint16           `json:"isotope,omitempty"`
+	Charge     int8             `json:"charge,omitempty"`
+	HCount     uint8            `json:"hCount"`
+	Radical    cmn.Radical      `json:"radical,omitempty"`
+	Valence    int8             `json:"valence,omitempty"`
+	X          float32          `json:"x"`
+	Y          float32          `json:"y"`
+	Z          float32          `json:"z"`
+	Parity     cmn.StereoParity `json:"parity,omitempty"` // As declared.
+	RGroup     uint8            `json:"rgroup,omitempty"`
+	Attachment uint8            `json:"attachment,omitempty"`
+	Deuterium  uint8            `json:"deuterium,omitempty"`
+	Tritium    uint8            `json:"tritium,omitempty"`
+	Alone      bool             `json:"alone,omitempty"` // Of a hydrogen atom, not counted in a neighbour.
+	Attributes []Attribute      `json:"attributes,omitempty"`
+}
+
+// _SavedBond is the saved form of a bond.
+type _SavedBond struct {
+	Id         uint16         `json:"id"`
+	A1         uint16         `json:"a1"`
+	A2         uint16         `json:"a2"`
+	Type       cmn.BondType   `json:"type"`            // Kekulé, of aromatic and query bonds.
+	Given      cmn.BondType   `json:"given,omitempty"` // Aromatic or query type, if any.
+	Stereo     cmn.BondStereo `json:"stereo,omitempty"`
+	Sides      int8           `json:"sides,omitempty"` // As declared.
+	Attributes []Attribute    `json:"attributes,omitempty"`
+}
+
+// Save writes a workspace holding the molecules of a snapshot of this
+// registry, in the ascending order of their IDs, for `Load` to restore.
+// See `List`.
+//
+// Each molecule is saved as of a single instant, but different
+// molecules may be saved at different instants, if they are modified
+// concurrently.  Molecules that exit while being saved are skipped.
+func (reg *MoleculeRegistry) Save(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	if err := enc.Encode(_WorkspaceHeader{workspaceFormat, workspaceVersion}); err != nil {
+		return err
+	}
+
+	for _, mol := range reg.List() {
+		reply := mol.Call(ReqClone, CloneQuery{Passive: true})
+		if reply.Status == StMoleculeExited {
+			continue
+		}
+		if err := statusError(reply, fmt.Sprintf("molecule %d", mol.id)); err != nil {
+			return err
+		}
+
+		c := reply.Payload.(*Molecule)
+		err := enc.Encode(c.saved(mol.id))
+		c.Release()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// saved answers the saved form of this molecule, under the given ID.
+func (m *Molecule) saved(id uint64) *_SavedMolecule {
+	sm := &_SavedMolecule{
+		Id:               id,
+		Vendor:           m.vendor,
+		VendorMoleculeId: m.vendorMoleculeId,
+		Source:           m.source,
+		Steps:            m.steps,
+		Attributes:       m.attributes,
+		Conformers:       m.conformers,
+		StereoGroups:     m.stereoGroups,
+		Sgroups:          m.sgroups,
+		Atoms:            make([]_SavedAtom, 0, len(m.atoms)),
+		Bonds:            make([]_SavedBond, 0, len(m.bonds)),
+	}
+	for _, a := range m.atoms {
+		sym := ""
+		if a.atNum == 0 {
+			sym = a.symbol
+		}
+		sm.Atoms = append(sm.Atoms, _SavedAtom{
+			Iid:        a.iId,
+			AtNum:      a.atNum,
+			Symbol:     sym,
+			Isotope:    a.isotope,
+			Charge:     a.charge,
+			HCount:     a.hCount,
+			Radical:    a.radical,
+			Valence:    a.valence,
+			X:          a.X,
+			Y:          a.Y,
+			Z:          a.Z,
+			Parity:     a.declared,
+			RGroup:     a.rgroup,
+			Attachment: a.attachment,
+			Deuterium:  a.hIsotopes[0],
+			Tritium:    a.hIsotopes[1],
+			Alone:      a.atNum == 1 && !a.counted,
+			Attributes: a.attributes,
+		})
+	}
+	for _, b := range m.bonds {
+		sm.Bonds = append(sm.Bonds, _SavedBond{
+			Id:         b.id,
+			A1:         b.a1,
+			A2:         b.a2,
+			Type:       b.bType,
+			Given:      b.given,
+			Stereo:     b.bStereo,
+			Sides:      b.declared,
+			Attributes: b.attributes,
+		})
+	}
+	return sm
+}
+
+// Load restores the molecules of the given workspace, as written by
+// `Save`, into this registry.  It answers them by their saved IDs.
+//
+// Molecules keep their saved IDs, so that references to them by ID,
+// held elsewhere, remain valid, as when a workspace is loaded afresh
+// in a new process.  IDs already issued in this process, however, can
+// not be reused; molecules saved with such IDs are given new ones.
+// Thus, loading a workspace twice yields distinct molecules.
+//
+// Should any molecule fail to load, none is retained, and the error is
+// answered.
+func (reg *MoleculeRegistry) Load(r io.Reader) (map[uint64]*Molecule, error) {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 0, 64*1024), maxWorkspaceLine)
+
+	var hdr _WorkspaceHeader
+	if !sc.Scan() {
+		if err := sc.Err(); err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("Empty workspace.")
+	}
+	if err := json.Unmarshal(sc.Bytes(), &hdr); err != nil || hdr.Format != workspaceFormat {
+		return nil, fmt.Errorf("Not a workspace of molecules.")
+	}
+	if hdr.Version != workspaceVersion {
+		return nil, fmt.Errorf("Unsupported version of workspace : %d", hdr.Version)
+	}
+
+	// All the molecules are read before any ID is reserved.
+	saved := []*_SavedMolecule(nil)
+	seen := make(map[uint64]bool)
+	maxId := uint64(0)
+	for ln := 2; sc.Scan(); ln++ {
+		sm := new(_SavedMolecule)
+		if err := json.Unmarshal(sc.Bytes(), sm); err != nil {
+			return nil, fmt.Errorf("Workspace line %d : %v", ln, err)
+		}
+		if seen[sm.Id] {
+			return nil, fmt.Errorf("Workspace line %d : duplicate molecule ID %d", ln, sm.Id)
+		}
+		seen[sm.Id] = true
+		saved = append(saved, sm)
+		if sm.Id > maxId {
+			maxId = sm.Id
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+
+	mols := make([]*Molecule, 0, len(saved))
+	for _, sm := range saved {
+		mol, err := sm.restore()
+		if err != nil {
+			for _, m := range mols {
+				m.Release()
+			}
+			return nil, fmt.Errorf("Molecule %d : %v", sm.Id, err)
+		}
+		mols = append(mols, mol)
+	}
+
+	// IDs above the last one issued are free, once reserved.
+	nextMolId.mu.Lock()
+	issued := nextMolId.nextId
+	if maxId > issued {
+		nextMolId.nextId = maxId
+	}
+	nextMolId.mu.Unlock()
+
+	res := make(map[uint64]*Molecule, len(saved))
+	for i, mol := range mols {
+		id := saved[i].Id
+		if id > issued {
+			mol.id = id
+		}
+		mol.registry, mol.passive = reg, false
+		mol.start(context.Background())
+		res[id] = mol
+	}
+	return res, nil
+}
+
+// restore answers a passive molecule built from this saved form, with
+// a new ID.
+func (sm *_SavedMolecule) restore() (*Molecule, error) {
+	mol := NewPassive(Vendor(sm.Vendor, sm.VendorMoleculeId))
+	fail := func(err error) (*Molecule, error) {
+		mol.Release()
+		return nil, err
+	}
+
+	ab := mol.NewAtomBuilder()
+	for _, sa := range sm.Atoms {
+		if int(sa.AtNum) >= len(cmn.ElementSymbols) {
+			return fail(fmt.Errorf("Invalid atomic number : %d", sa.AtNum))
+		}
+		sym := cmn.ElementSymbols[sa.AtNum]
+		if sa.AtNum == 0 && sa.Symbol != "" {
+			sym = sa.Symbol
+		}
+		if _, err := ab.New(sym, int(sa.Iid)); err != nil {
+			return fail(err)
+		}
+		ab.Coordinates(sa.X, sa.Y, sa.Z).FormalCharge(int(sa.Charge)).Valence(int(sa.Valence)).Parity(sa.Parity)
+		if sa.Isotope != 0 {
+			ab.Isotope(int(sa.Isotope))
+		}
+		if sa.RGroup != 0 {
+			ab.RGroup(int(sa.RGroup))
+		}
+		ab.Attachment(int(sa.Attachment))
+		if err := mol.AddAtom(ab); err != nil {
+			return fail(err)
+		}
+	}
+
+	bb := mol.NewBondBuilder()
+	for _, sb := range sm.Bonds {
+		if _, err := bb.New(int(sb.Id)); err != nil {
+			return fail(err)
+		}
+		if _, err := bb.Atoms(int(sb.A1), int(sb.A2)); err != nil {
+			return fail(err)
+		}
+		if _, err := bb.BondType(sb.Type); err != nil {
+			return fail(err)
+		}
+		if sb.Given != cmn.BondTypeNone {
+			if _, err := bb.BondType(sb.Given); err != nil {
+				return fail(err)
+			}
+		}
+		bb.BondStereo(sb.Stereo)
+		bb.b.declared = sb.Sides
+		if err := mol.AddBond(bb); err != nil {
+			return fail(err)
+		}
+	}
+	if err := mol.Build(); err != nil {
+		return fail(err)
+	}
+
+	// Hydrogen counts, as saved, override those implied by the bonds to
+	// hydrogen atoms, and precede the perception of aromaticity.
+	for _, sa := range sm.Atoms {
+		a := mol.atomsByIid[sa.Iid]
+		a.hCount, a.radical = sa.HCount, sa.Radical
+		a.hIsotopes = [2]uint8{sa.Deuterium, sa.Tritium}
+		a.counted = sa.AtNum == 1 && !sa.Alone
+		a.attributes = append(a.attributes[:0], sa.Attributes...)
+	}
+	for _, sb := range sm.Bonds {
+		mol.bondsById[sb.Id].attributes = append([]Attribute(nil), sb.Attributes...)
+	}
+	if _, err := Sanitize(mol, SanitizeSkipHydrogens|SanitizeSkipValence); err != nil {
+		return fail(err)
+	}
+
+	mol.source = sm.Source
+	mol.steps = append(mol.steps[:0], sm.Steps...)
+	mol.attributes = append(mol.attributes[:0], sm.Attributes...)
+	mol.conformers = append(mol.conformers[:0], sm.Conformers...)
+	if st, res := mol.handleSetStereoGroups(sm.StereoGroups); st != StSuccess {
+		err, _ := res.(error)
+		return fail(fmt.Errorf("Invalid stereo groups : %v", err))
+	}
+	if st, res := mol.handleSetSgroups(sm.Sgroups); st != StSuccess {
+		err, _ := res.(error)
+		return fail(fmt.Errorf("Invalid Sgroups : %v", err))
+	}
+	for _, c := range mol.conformers {
+		if c.Id > mol.nextConformerId {
+			mol.nextConformerId = c.Id
+		}
+	}
+	return mol, nil
+}
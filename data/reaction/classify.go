@@ -0,0 +1,259 @@
+package reaction
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ReactionClass is a named class of reactions, as Suzuki coupling, with
+// the templates of its reaction centres.
+type ReactionClass struct {
+	Name string
+	// Hierarchical, as `3.1.1` for Suzuki coupling under `3`, C-C bond
+	// formation, so that classes may be reported at any level of
+	// detail.
+	Code   string
+	Smirks []string // Reaction centre templates; see `Classify`.
+}
+
+// Unrecognised is the class of reactions matching no other.
+var Unrecognised = ReactionClass{Name: "unrecognised"}
+
+// ReactionClasses lists the common classes of medicinal chemistry.
+var ReactionClasses = []ReactionClass{
+	{Name: "N-alkylation", Code: "1.1", Smirks: []string{"[C;X4:1]-[Cl,Br,I].[N:2]>>[C:1]-[N:2]"}},
+	{Name: "O-alkylation", Code: "1.2", Smirks: []string{"[C;X4:1]-[Cl,Br,I].[O:2]>>[C:1]-[O:2]"}},
+	{Name: "N-arylation", Code: "1.3", Smirks: []string{"[c:1]-[F,Cl,Br,I].[N:2]>>[c:1]-[N:2]"}},
+
+	{Name: "N-acylation", Code: "2.1", Smirks: []string{"[C:1](=[O:2])-[O,Cl].[N:3]>>[C:1](=[O:2])-[N:3]"}},
+	{Name: "Schotten-Baumann amide formation", Code: "2.1.1", Smirks: []string{"[C:1](=[O:2])-[Cl].[N:3]>>[C:1](=[O:2])-[N:3]"}},
+	{Name: "amide coupling", Code: "2.1.2", Smirks: []string{"[C:1](=[O:2])-[O;H1].[N:3]>>[C:1](=[O:2])-[N:3]"}},
+	{Name: "esterification", Code: "2.2", Smirks: []string{
+		"[C:1](=[O:2])-[O,Cl].[O;H1:3]-[#6:4]>>[C:1](=[O:2])-[O:3]-[#6:4]",
+	}},
+	{Name: "N-sulfonylation", Code: "2.3", Smirks: []string{"[S:1](=[O:2])(=[O:3])-[Cl].[N:4]>>[S:1](=[O:2])(=[O:3])-[N:4]"}},
+
+	{Name: "Suzuki coupling", Code: "3.1.1", Smirks: []string{"[c:1]-[Cl,Br,I].[#6:2]-[B]>>[c:1]-[#6:2]"}},
+	{Name: "Sonogashira coupling", Code: "3.1.2", Smirks: []string{"[c:1]-[Br,I].[C;H1:2]#[C:3]>>[c:1]-[C:2]#[C:3]"}},
+	{Name: "Heck reaction", Code: "3.1.3", Smirks: []string{"[c:1]-[Br,I].[C;H2:2]=[C:3]>>[c:1]-[C:2]=[C:3]"}},
+
+	{Name: "Boc deprotection", Code: "5.1", Smirks: []string{"[N:1]-C(=O)-O-C(-C)(-C)-C>>[N:1]"}},
+	{Name: "ester hydrolysis", Code: "5.2", Smirks: []string{"[C:1](=[O:2])-[O:3]-[C;X4]>>[C:1](=[O:2])-[O;H1:3]"}},
+
+	{Name: "reductive amination", Code: "7.1", Smirks: []string{"[C:1]=[O].[N:2]>>[C:1]-[N:2]"}},
+	{Name: "carbonyl reduction", Code: "7.2", Smirks: []string{"[C:1]=[O:2]>>[C:1]-[O;H1:2]"}},
+	{Name: "nitro reduction", Code: "7.3", Smirks: []string{"[#6:1]-[N+:2](=O)-[O-]>>[#6:1]-[N;+0:2]"}},
+
+	{Name: "alcohol oxidation", Code: "8.1", Smirks: []string{"[C:1]-[O;H1:2]>>[C:1]=[O:2]"}},
+}
+
+// Classify answers the classes of `ReactionClasses` this reaction is
+// of, as `ClassifyWith` does.
+func (r *Reaction) Classify() ([]ReactionClass, error) {
+	return r.ClassifyWith(ReactionClasses)
+}
+
+// ClassifyWith answers the classes among those given this reaction is
+// of, most specific first, or `Unrecognised` alone.  The atoms of the
+// reactants and of the products correspond by their atom map numbers,
+// as they do for `ExtractTemplate`; molecules whose atoms are not among
+// those of the products take no part, so that reagents and solvents
+// listed as reactants are not mistaken for reactants.
+//
+// A reaction is of a class should one of its templates match it: its
+// reactant patterns occurring in distinct reactants, and its product
+// patterns in the products, their mapped atoms corresponding by the map
+// numbers of the reaction.  The atoms the template removes must leave
+// in the reaction, and its mapped atoms must cover the reaction centre:
+// the mapped atoms that change; see `ExtractTemplate`.  Classes with
+// deeper codes are more specific, and, of those alike, classes whose
+// templates match more atoms.
+//
+// It is an error for the reaction to have no mapped atoms, or for a
+// template to be malformed.
+func (r *Reaction) ClassifyWith(classes []ReactionClass) ([]ReactionClass, error) {
+	rs, err := newSide(r.reactants)
+	if err != nil {
+		return nil, fmt.Errorf("Reactants : %v", err)
+	}
+	ps, err := newSide(r.products)
+	if err != nil {
+		return nil, fmt.Errorf("Products : %v", err)
+	}
+	if len(rs.byMap) == 0 || len(ps.byMap) == 0 {
+		return nil, fmt.Errorf("Reaction has no mapped atoms.")
+	}
+	centre := make(map[int]bool)
+	for n, ra := range rs.byMap {
+		if pa, ok := ps.byMap[n]; ok && changes(rs, ra, ps, pa) {
+			centre[n] = true
+		}
+	}
+
+	type classMatch struct {
+		class ReactionClass
+		size  int // Atoms of the template matched.
+	}
+	matches := []classMatch(nil)
+	for _, c := range classes {
+		size := 0
+		for _, smirks := range c.Smirks {
+			t, err := ParseSmirks(smirks)
+			if err != nil {
+				return nil, fmt.Errorf("Reaction class %s : %v", c.Name, err)
+			}
+			m := _Matcher{t: t, rs: rs, ps: ps, centre: centre}
+			ok, err := m.match()
+			t.Release()
+			if err != nil {
+				return nil, err
+			}
+			if ok && m.size() > size {
+				size = m.size()
+			}
+		}
+		if size > 0 {
+			matches = append(matches, classMatch{c, size})
+		}
+	}
+	if len(matches) == 0 {
+		return []ReactionClass{Unrecognised}, nil
+	}
+
+	depth := func(c ReactionClass) int { return strings.Count(c.Code, ".") }
+	sort.SliceStable(matches, func(i, j int) bool {
+		if di, dj := depth(matches[i].class), depth(matches[j].class); di != dj {
+			return di > dj
+		}
+		return matches[i].size > matches[j].size
+	})
+	res := make([]ReactionClass, len(matches))
+	for i, m := range matches {
+		res[i] = m.class
+	}
+	return res, nil
+}
+
+// _Matcher matches the patterns of a transform in a mapped reaction.
+type _Matcher struct {
+	t      *Transform
+	rs, ps *_Side
+	centre map[int]bool // Map numbers of the reaction centre.
+
+	used  map[int]bool  // Reactants matched.
+	bound map[int]_Site // Reactant atoms, by the map numbers of the transform.
+}
+
+// size answers the number of atoms of the reactant patterns of the
+// transform.
+func (m *_Matcher) size() int {
+	res := 0
+	for _, pat := range m.t.reactants {
+		res += len(pat.atoms)
+	}
+	return res
+}
+
+// match answers if the transform matches the reaction.
+func (m *_Matcher) match() (bool, error) {
+	m.used = make(map[int]bool)
+	m.bound = make(map[int]_Site)
+	return m.matchReactant(0)
+}
+
+// matchReactant answers if the reactant patterns from the given one on
+// occur in reactants not yet matched, consistently with the products.
+func (m *_Matcher) matchReactant(k int) (bool, error) {
+	if k == len(m.t.reactants) {
+		return m.matchProducts()
+	}
+	pat := m.t.reactants[k]
+	for i, mol := range m.rs.mols {
+		if m.used[i] {
+			continue
+		}
+		occs, err := mol.QueryMaps(pat.query, 0)
+		if err != nil {
+			return false, err
+		}
+
+	occurrences:
+		for _, occ := range occs {
+			for iid, to := range occ {
+				n := m.rs.maps[i][to]
+				tn, mapped := pat.query.Maps[iid]
+				switch {
+				case mapped && !m.ps.has(n):
+					// Kept by the transform, but not by the reaction.
+					continue occurrences
+				case !mapped && m.ps.has(n):
+					// Removed by the transform, but kept by the reaction.
+					continue occurrences
+				}
+				if mapped {
+					m.bound[tn] = _Site{i, to}
+				}
+			}
+			m.used[i] = true
+			ok, err := m.matchReactant(k + 1)
+			m.used[i] = false
+			if ok || err != nil {
+				return ok, err
+			}
+		}
+	}
+	return false, nil
+}
+
+// matchProducts answers if the product patterns of the transform occur
+// in the products, their mapped atoms at those of the reaction bound,
+// and if the atoms bound cover the reaction centre.
+func (m *_Matcher) matchProducts() (bool, error) {
+	covered := 0
+	for _, site := range m.bound {
+		if m.centre[m.rs.maps[site.mol][site.iid]] {
+			covered++
+		}
+	}
+	if covered < len(m.centre) {
+		return false, nil
+	}
+
+	for _, pat := range m.t.products {
+		mol := -1
+		want := make(map[uint16]uint16) // Product atoms, by input ID of the pattern.
+		for iid, tn := range pat.query.Maps {
+			ra := m.bound[tn]
+			pa := m.ps.byMap[m.rs.maps[ra.mol][ra.iid]]
+			if mol >= 0 && pa.mol != mol {
+				return false, nil
+			}
+			mol = pa.mol
+			want[iid] = pa.iid
+		}
+		if mol < 0 {
+			continue
+		}
+
+		occs, err := m.ps.mols[mol].QueryMaps(pat.query, 0)
+		if err != nil {
+			return false, err
+		}
+		found := false
+	occurrences:
+		for _, occ := range occs {
+			for iid, to := range want {
+				if occ[iid] != to {
+					continue occurrences
+				}
+			}
+			found = true
+			break
+		}
+		if !found {
+			return false, nil
+		}
+	}
+	return true, nil
+}
@@ -0,0 +1,246 @@
+package reaction
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Conditions records the experimental context of a reaction.
+//
+// Every field is optional.  Numeric fields carry a flag indicating if
+// they have been set, so that a legitimate zero (say, a temperature of
+// 0 C) is distinguishable from an absent value.
+type Conditions struct {
+	temperature    float64 // In degrees Celsius.
+	hasTemperature bool
+
+	duration    time.Duration
+	hasDuration bool
+
+	yield    float64 // As a percentage.
+	hasYield bool
+
+	solvent  string // Name of the solvent, as reported.
+	catalyst string // Name of the catalyst, as reported.
+}
+
+// Conditions answers the experimental conditions of this reaction.
+// The answer is never `nil`.
+func (r *Reaction) Conditions() *Conditions {
+	if r.conditions == nil {
+		r.conditions = new(Conditions)
+	}
+	return r.conditions
+}
+
+// SetTemperature sets the reaction temperature, in degrees Celsius.
+func (c *Conditions) SetTemperature(t float64) *Conditions {
+	c.temperature, c.hasTemperature = t, true
+	return c
+}
+
+// Temperature answers the reaction temperature in degrees Celsius, and
+// if it has been set.
+func (c *Conditions) Temperature() (float64, bool) {
+	return c.temperature, c.hasTemperature
+}
+
+// SetDuration sets the reaction time.
+func (c *Conditions) SetDuration(d time.Duration) *Conditions {
+	c.duration, c.hasDuration = d, true
+	return c
+}
+
+// Duration answers the reaction time, and if it has been set.
+func (c *Conditions) Duration() (time.Duration, bool) {
+	return c.duration, c.hasDuration
+}
+
+// SetYield sets the reported yield, as a percentage.
+func (c *Conditions) SetYield(y float64) (*Conditions, error) {
+	if y < 0 || y > 100 {
+		return nil, fmt.Errorf("Yield out of range : %f", y)
+	}
+
+	c.yield, c.hasYield = y, true
+	return c, nil
+}
+
+// Yield answers the reported yield as a percentage, and if it has been
+// set.
+func (c *Conditions) Yield() (float64, bool) {
+	return c.yield, c.hasYield
+}
+
+// SetSolvent sets the name of the solvent.
+func (c *Conditions) SetSolvent(s string) *Conditions {
+	c.solvent = s
+	return c
+}
+
+// Solvent answers the name of the solvent, if set.
+func (c *Conditions) Solvent() string {
+	return c.solvent
+}
+
+// SetCatalyst sets the name of the catalyst.
+func (c *Conditions) SetCatalyst(s string) *Conditions {
+	c.catalyst = s
+	return c
+}
+
+// Catalyst answers the name of the catalyst, if set.
+func (c *Conditions) Catalyst() string {
+	return c.catalyst
+}
+
+// conditionsJSON is the serialised form of `Conditions`.
+type conditionsJSON struct {
+	Temperature *float64 `json:"temperature_c,omitempty"`
+	Duration    *float64 `json:"time_h,omitempty"`
+	Yield       *float64 `json:"yield_pct,omitempty"`
+	Solvent     string   `json:"solvent,omitempty"`
+	Catalyst    string   `json:"catalyst,omitempty"`
+}
+
+// MarshalJSON answers the JSON representation of these conditions.
+// Fields that are not set are omitted.
+func (c *Conditions) MarshalJSON() ([]byte, error) {
+	cj := conditionsJSON{Solvent: c.solvent, Catalyst: c.catalyst}
+	if c.hasTemperature {
+		cj.Temperature = &c.temperature
+	}
+	if c.hasDuration {
+		h := c.duration.Hours()
+		cj.Duration = &h
+	}
+	if c.hasYield {
+		cj.Yield = &c.yield
+	}
+
+	return json.Marshal(cj)
+}
+
+// UnmarshalJSON sets these conditions from their JSON representation.
+func (c *Conditions) UnmarshalJSON(b []byte) error {
+	cj := conditionsJSON{}
+	if err := json.Unmarshal(b, &cj); err != nil {
+		return err
+	}
+
+	*c = Conditions{solvent: cj.Solvent, catalyst: cj.Catalyst}
+	if cj.Temperature != nil {
+		c.SetTemperature(*cj.Temperature)
+	}
+	if cj.Duration != nil {
+		c.SetDuration(time.Duration(*cj.Duration * float64(time.Hour)))
+	}
+	if cj.Yield != nil {
+		if _, err := c.SetYield(*cj.Yield); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Data types used for conditions in MDL RD files.
+const (
+	rdfTemperature = "RXN:CONDITIONS:TEMPERATURE"
+	rdfTime        = "RXN:CONDITIONS:TIME"
+	rdfYield       = "RXN:CONDITIONS:YIELD"
+	rdfSolvent     = "RXN:CONDITIONS:SOLVENT"
+	rdfCatalyst    = "RXN:CONDITIONS:CATALYST"
+)
+
+// WriteRDF writes these conditions to the given writer, as a sequence
+// of `$DTYPE'/`$DATUM' pairs of an MDL RD file.  Temperature is in
+// degrees Celsius, time in hours and yield in percent.
+func (c *Conditions) WriteRDF(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	put := func(dtype, datum string) {
+		fmt.Fprintf(bw, "$DTYPE %s\n$DATUM %s\n", dtype, datum)
+	}
+
+	if c.hasTemperature {
+		put(rdfTemperature, strconv.FormatFloat(c.temperature, 'f', -1, 64))
+	}
+	if c.hasDuration {
+		put(rdfTime, strconv.FormatFloat(c.duration.Hours(), 'f', -1, 64))
+	}
+	if c.hasYield {
+		put(rdfYield, strconv.FormatFloat(c.yield, 'f', -1, 64))
+	}
+	if c.solvent != "" {
+		put(rdfSolvent, c.solvent)
+	}
+	if c.catalyst != "" {
+		put(rdfCatalyst, c.catalyst)
+	}
+
+	return bw.Flush()
+}
+
+// ReadRDF sets these conditions from the `$DTYPE'/`$DATUM' pairs read
+// from the given reader.  Data types other than conditions are
+// ignored.
+func (c *Conditions) ReadRDF(r io.Reader) error {
+	sc := bufio.NewScanner(r)
+	dtype := ""
+	for sc.Scan() {
+		line := strings.TrimRight(sc.Text(), "\r")
+		switch {
+		case strings.HasPrefix(line, "$DTYPE "):
+			dtype = strings.TrimSpace(line[len("$DTYPE "):])
+			continue
+		case strings.HasPrefix(line, "$DATUM "):
+			// Handled below.
+		default:
+			continue
+		}
+
+		datum := strings.TrimSpace(line[len("$DATUM "):])
+		if err := c.setRDFDatum(dtype, datum); err != nil {
+			return err
+		}
+		dtype = ""
+	}
+
+	return sc.Err()
+}
+
+// setRDFDatum sets the condition identified by the given RD file data
+// type to the given value.
+func (c *Conditions) setRDFDatum(dtype, datum string) error {
+	switch dtype {
+	case rdfSolvent:
+		c.solvent = datum
+		return nil
+	case rdfCatalyst:
+		c.catalyst = datum
+		return nil
+	case rdfTemperature, rdfTime, rdfYield:
+		// Numeric; handled below.
+	default:
+		return nil
+	}
+
+	v, err := strconv.ParseFloat(datum, 64)
+	if err != nil {
+		return fmt.Errorf("Invalid value for %s : %s", dtype, datum)
+	}
+
+	switch dtype {
+	case rdfTemperature:
+		c.SetTemperature(v)
+	case rdfTime:
+		c.SetDuration(time.Duration(v * float64(time.Hour)))
+	case rdfYield:
+		_, err = c.SetYield(v)
+	}
+	return err
+}
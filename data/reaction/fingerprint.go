@@ -0,0 +1,109 @@
+package reaction
+
+import (
+	"sort"
+
+	"github.com/RxnWeaver/rxnweaver/data/molecule"
+)
+
+// DifferenceFingerprint answers the difference between the summed
+// fingerprints of the products and those of the reactants of this
+// reaction.
+//
+// Bins that are unaffected by the reaction cancel out, leaving
+// positive counts for the features formed, and negative counts for
+// those broken.
+func (r *Reaction) DifferenceFingerprint() []int32 {
+	size, radius := molecule.FingerprintSize, molecule.FingerprintRadius
+
+	fp := make([]int32, size)
+	for _, mol := range r.products {
+		for i, c := range mol.Fingerprint(size, radius) {
+			fp[i] += c
+		}
+	}
+	for _, mol := range r.reactants {
+		for i, c := range mol.Fingerprint(size, radius) {
+			fp[i] -= c
+		}
+	}
+
+	return fp
+}
+
+// StructuralFingerprint answers the summed fingerprints of the
+// reactants followed by the summed fingerprints of the products of
+// this reaction.
+//
+// Unlike the difference fingerprint, this retains the structural
+// context in which the reaction takes place.
+func (r *Reaction) StructuralFingerprint() []int32 {
+	size, radius := molecule.FingerprintSize, molecule.FingerprintRadius
+
+	fp := make([]int32, 2*size)
+	for _, mol := range r.reactants {
+		for i, c := range mol.Fingerprint(size, radius) {
+			fp[i] += c
+		}
+	}
+	for _, mol := range r.products {
+		for i, c := range mol.Fingerprint(size, radius) {
+			fp[size+i] += c
+		}
+	}
+
+	return fp
+}
+
+// Similarity answers the continuous Tanimoto similarity between the
+// two given count fingerprints.  It ranges from `-1/3` to `1`, with
+// `1` meaning identical fingerprints.
+//
+// Both fingerprints are expected to have the same length.
+func Similarity(fp1, fp2 []int32) float64 {
+	dot, sq1, sq2 := 0.0, 0.0, 0.0
+	for i := range fp1 {
+		a, b := float64(fp1[i]), float64(fp2[i])
+		dot += a * b
+		sq1 += a * a
+		sq2 += b * b
+	}
+
+	den := sq1 + sq2 - dot
+	if den == 0 {
+		return 1 // Both are all zeroes.
+	}
+	return dot / den
+}
+
+// Hit is a single result of a similarity search.
+type Hit struct {
+	Index      int     // Index of the candidate in the searched list.
+	Similarity float64 // Similarity to the query.
+}
+
+// SearchSimilar answers those of the given candidate reactions whose
+// difference fingerprints are at least as similar to that of the query
+// as the given threshold.  The hits are in descending order of
+// similarity.
+func SearchSimilar(query *Reaction, cands []*Reaction, threshold float64) []Hit {
+	qfp := query.DifferenceFingerprint()
+
+	hits := make([]Hit, 0, len(cands))
+	for i, c := range cands {
+		sim := Similarity(qfp, c.DifferenceFingerprint())
+		if sim >= threshold {
+			hits = append(hits, Hit{i, sim})
+		}
+	}
+
+	sort.Stable(bySimilarity(hits))
+	return hits
+}
+
+// bySimilarity sorts hits in descending order of similarity.
+type bySimilarity []Hit
+
+func (s bySimilarity) Len() int           { return len(s) }
+func (s bySimilarity) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s bySimilarity) Less(i, j int) bool { return s[i].Similarity > s[j].Similarity }
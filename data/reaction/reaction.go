@@ -0,0 +1,115 @@
+package reaction
+
+import (
+	"fmt"
+
+	cmn "github.com/RxnWeaver/rxnweaver/common"
+	"github.com/RxnWeaver/rxnweaver/data/molecule"
+)
+
+// Reaction represents a chemical reaction, as a set of reactant
+// molecules transformed into a set of product molecules.
+//
+// A molecule participating with a stoichiometric coefficient greater
+// than one is added that many times.
+type Reaction struct {
+	reactants []*molecule.Molecule // Molecules consumed.
+	products  []*molecule.Molecule // Molecules produced.
+
+	reagents  []*molecule.Molecule // Consumed, but not incorporated.
+	solvents  []*molecule.Molecule // Reaction media.
+	catalysts []*molecule.Molecule // Not consumed.
+
+	conditions *Conditions // Optional experimental context.
+}
+
+// New creates and initialises an empty reaction.
+func New() *Reaction {
+	r := new(Reaction)
+
+	r.reactants = make([]*molecule.Molecule, 0, cmn.ListSizeTiny)
+	r.products = make([]*molecule.Molecule, 0, cmn.ListSizeTiny)
+
+	r.reagents = make([]*molecule.Molecule, 0, cmn.ListSizeTiny)
+	r.solvents = make([]*molecule.Molecule, 0, cmn.ListSizeTiny)
+	r.catalysts = make([]*molecule.Molecule, 0, cmn.ListSizeTiny)
+
+	return r
+}
+
+// AddReactant adds the given molecule as a reactant of this reaction.
+func (r *Reaction) AddReactant(mol *molecule.Molecule) *Reaction {
+	r.reactants = append(r.reactants, mol)
+	return r
+}
+
+// AddProduct adds the given molecule as a product of this reaction.
+func (r *Reaction) AddProduct(mol *molecule.Molecule) *Reaction {
+	r.products = append(r.products, mol)
+	return r
+}
+
+// Reactants answers the reactants of this reaction.
+func (r *Reaction) Reactants() []*molecule.Molecule {
+	return r.reactants
+}
+
+// Products answers the products of this reaction.
+func (r *Reaction) Products() []*molecule.Molecule {
+	return r.products
+}
+
+// Imbalance answers the difference in elemental composition between
+// the products and the reactants of this reaction, as a map from
+// atomic number to (product count - reactant count).
+//
+// Only elements whose counts differ are present in the answer.
+// Thus, a balanced reaction answers an empty map.
+func (r *Reaction) Imbalance() map[uint8]int {
+	diff := make(map[uint8]int)
+	for _, mol := range r.products {
+		for atNum, n := range mol.ElementCounts() {
+			diff[atNum] += n
+		}
+	}
+	for _, mol := range r.reactants {
+		for atNum, n := range mol.ElementCounts() {
+			diff[atNum] -= n
+		}
+	}
+
+	for atNum, n := range diff {
+		if n == 0 {
+			delete(diff, atNum)
+		}
+	}
+
+	return diff
+}
+
+// IsBalanced answers if the reactants and the products of this
+// reaction have the same elemental composition.
+func (r *Reaction) IsBalanced() bool {
+	return len(r.Imbalance()) == 0
+}
+
+// AtomEconomy answers the atom economy of this reaction with respect
+// to the product at the given index, as a percentage.
+//
+// Atom economy is the molecular weight of the desired product divided
+// by the sum of the molecular weights of all the reactants.
+func (r *Reaction) AtomEconomy(pidx int) (float64, error) {
+	if pidx < 0 || pidx >= len(r.products) {
+		return 0, fmt.Errorf("Product index out of range : %d", pidx)
+	}
+
+	w := 0.0
+	for _, mol := range r.reactants {
+		w += mol.Weight()
+	}
+	if w == 0 {
+		return 0, fmt.Errorf("Reactants have no weight.")
+	}
+
+	return 100 * r.products[pidx].Weight() / w, nil
+}
@@ -0,0 +1,38 @@
+package reaction
+
+import "testing"
+
+func TestBalance(t *testing.T) {
+	tests := []struct {
+		name      string
+		smi       string
+		imbalance map[uint8]int
+	}{
+		{"hydrogenation", "C=C.[H][H]>>CC", nil},
+		{"explicit hydrogens", "C=C.[H][H]>>[H]C([H])([H])C([H])([H])[H]", nil},
+		{"deprotonation", "CC(=O)O>>CC(=O)[O-].[H+]", nil},
+		{"hydride", "C=O.[H-].[H+]>>CO", nil},
+		{"missing hydrogen", "C=C>>CC", map[uint8]int{1: 2}},
+		{"missing water", "CC(=O)O.OCC>>CC(=O)OCC", map[uint8]int{1: -2, 8: -1}},
+	}
+	for _, tt := range tests {
+		r, err := ParseSmiles(nil, tt.smi)
+		if err != nil {
+			t.Fatalf("%s : %v", tt.name, err)
+		}
+		got := r.Imbalance()
+		if len(got) != len(tt.imbalance) {
+			t.Errorf("%s : imbalance %v, want %v", tt.name, got, tt.imbalance)
+		}
+		for atNum, n := range tt.imbalance {
+			if got[atNum] != n {
+				t.Errorf("%s : imbalance %v, want %v", tt.name, got, tt.imbalance)
+				break
+			}
+		}
+		if r.IsBalanced() != (len(tt.imbalance) == 0) {
+			t.Errorf("%s : balanced %v", tt.name, r.IsBalanced())
+		}
+		r.Release()
+	}
+}
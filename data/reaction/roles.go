@@ -0,0 +1,162 @@
+package reaction
+
+import (
+	"github.com/RxnWeaver/rxnweaver/data/molecule"
+)
+
+// Role represents the part played by a molecule in a reaction.
+type Role uint8
+
+const (
+	RoleNone Role = iota
+	RoleReactant
+	RoleReagent
+	RoleSolvent
+	RoleCatalyst
+	RoleProduct
+)
+
+// commonSolvents maps the molecular formulae of common laboratory
+// solvents to their names.
+//
+// Formulae are ambiguous in general (ethanol and dimethyl ether share
+// one, for instance).  The entries here are chosen such that, in a
+// reaction context, the solvent is by far the likely reading.
+var commonSolvents = map[string]string{
+	"H2O":     "water",
+	"CH4O":    "methanol",
+	"C2H6O":   "ethanol",
+	"C3H8O":   "isopropanol",
+	"CH2Cl2":  "dichloromethane",
+	"CHCl3":   "chloroform",
+	"C4H8O":   "tetrahydrofuran",
+	"C4H8O2":  "1,4-dioxane",
+	"C4H10O":  "diethyl ether",
+	"C2H3N":   "acetonitrile",
+	"C3H6O":   "acetone",
+	"C3H7NO":  "N,N-dimethylformamide",
+	"C2H6OS":  "dimethyl sulfoxide",
+	"C6H6":    "benzene",
+	"C7H8":    "toluene",
+	"C6H14":   "hexane",
+	"C5H12":   "pentane",
+	"C4H8O2S": "sulfolane",
+	"C5H9NO":  "N-methyl-2-pyrrolidone",
+}
+
+// catalyticMetals lists the atomic numbers of metals that, when
+// present in a non-participating component, mark it as a catalyst.
+var catalyticMetals = map[uint8]bool{
+	22: true, // Ti
+	26: true, // Fe
+	27: true, // Co
+	28: true, // Ni
+	29: true, // Cu
+	30: true, // Zn
+	44: true, // Ru
+	45: true, // Rh
+	46: true, // Pd
+	47: true, // Ag
+	76: true, // Os
+	77: true, // Ir
+	78: true, // Pt
+	79: true, // Au
+}
+
+// Reagents answers the reagents of this reaction.
+func (r *Reaction) Reagents() []*molecule.Molecule {
+	return r.reagents
+}
+
+// Solvents answers the solvents of this reaction.
+func (r *Reaction) Solvents() []*molecule.Molecule {
+	return r.solvents
+}
+
+// Catalysts answers the catalysts of this reaction.
+func (r *Reaction) Catalysts() []*molecule.Molecule {
+	return r.catalysts
+}
+
+// PerceiveRoles examines each reactant of this reaction, and moves
+// those that do not contribute to the products into the appropriate
+// list of reagents, solvents or catalysts.
+//
+// The heuristics applied are as follows, in order.
+//
+//   - A molecule with an atom whose atom map number is among those of
+//     the products, is a reactant.  See `molecule.AtomMapAttribute`.
+//   - A molecule whose formula is that of a common solvent, is a
+//     solvent.
+//   - A molecule containing a catalytic metal that does not appear in
+//     any product, is a catalyst.
+//   - A molecule none of whose heavy elements appear in any product,
+//     is a reagent.
+//   - Every other molecule remains a reactant.
+func (r *Reaction) PerceiveRoles() {
+	prodElems := make(map[uint8]bool)
+	for _, mol := range r.products {
+		for atNum := range mol.ElementCounts() {
+			prodElems[atNum] = true
+		}
+	}
+	prodMaps, _ := newSide(r.products)
+
+	reactants := r.reactants[:0]
+	for _, mol := range r.reactants {
+		role := roleOf(mol, prodElems)
+		if prodMaps != nil && participates(mol, prodMaps) {
+			role = RoleReactant
+		}
+		switch role {
+		case RoleSolvent:
+			r.solvents = append(r.solvents, mol)
+		case RoleCatalyst:
+			r.catalysts = append(r.catalysts, mol)
+		case RoleReagent:
+			r.reagents = append(r.reagents, mol)
+		default:
+			reactants = append(reactants, mol)
+		}
+	}
+	r.reactants = reactants
+}
+
+// roleOf answers the role of the given molecule, when it appears on
+// the reactant side of a reaction whose products contain the given
+// elements.
+func roleOf(mol *molecule.Molecule, prodElems map[uint8]bool) Role {
+	if _, ok := commonSolvents[mol.Formula()]; ok {
+		return RoleSolvent
+	}
+
+	counts := mol.ElementCounts()
+	for atNum := range counts {
+		if catalyticMetals[atNum] && !prodElems[atNum] {
+			return RoleCatalyst
+		}
+	}
+
+	for atNum := range counts {
+		if atNum != 1 && prodElems[atNum] {
+			return RoleReactant
+		}
+	}
+
+	return RoleReagent
+}
+
+// participates answers if the given molecule has an atom whose atom map
+// number is among those of the given side.
+func participates(mol *molecule.Molecule, side *_Side) bool {
+	ms, err := newSide([]*molecule.Molecule{mol})
+	if err != nil {
+		return false
+	}
+	for n := range ms.byMap {
+		if side.has(n) {
+			return true
+		}
+	}
+	return false
+}
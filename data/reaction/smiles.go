@@ -0,0 +1,63 @@
+package reaction
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/RxnWeaver/rxnweaver/data/loader"
+	"github.com/RxnWeaver/rxnweaver/data/molecule"
+)
+
+// ParseSmiles answers the reaction of the given reaction SMILES,
+// `reactants>agents>products`, whose molecules are separated by `.`.
+// Agents are added as reagents.  The molecules are read as by
+// `loader.ReadSmiles`, with their atom classes, `:n`, as atom map
+// numbers, and sanitised.  They are tracked by the given registry, or
+// passive, if `nil`.
+func ParseSmiles(reg *molecule.MoleculeRegistry, smiles string) (*Reaction, error) {
+	parts := strings.Split(strings.TrimSpace(smiles), ">")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("Malformed reaction SMILES : %q", smiles)
+	}
+
+	r := New()
+	adds := []func(*molecule.Molecule) *Reaction{r.AddReactant, r.addReagent, r.AddProduct}
+	for i, part := range parts {
+		if part == "" {
+			continue
+		}
+		for _, smi := range splitComponents(part) {
+			mol, err := loader.ReadSmiles(reg, []byte(smi))
+			if err != nil {
+				r.Release()
+				return nil, fmt.Errorf("Reaction SMILES %q : %v", smi, err)
+			}
+			adds[i](mol)
+			rep, err := molecule.Sanitize(mol, 0)
+			if err == nil && rep.HasErrors() {
+				err = rep
+			}
+			if err != nil {
+				r.Release()
+				return nil, fmt.Errorf("Reaction SMILES %q : %v", smi, err)
+			}
+		}
+	}
+	return r, nil
+}
+
+// addReagent adds the given molecule as a reagent of this reaction.
+func (r *Reaction) addReagent(mol *molecule.Molecule) *Reaction {
+	r.reagents = append(r.reagents, mol)
+	return r
+}
+
+// Release releases the molecules of this reaction, in all their roles.
+// It should not be used thereafter.
+func (r *Reaction) Release() {
+	for _, mols := range [][]*molecule.Molecule{r.reactants, r.products, r.reagents, r.solvents, r.catalysts} {
+		for _, mol := range mols {
+			mol.Release()
+		}
+	}
+}
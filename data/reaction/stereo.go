@@ -0,0 +1,391 @@
+package reaction
+
+import (
+	"fmt"
+	"math"
+	"sort"
+
+	cmn "github.com/RxnWeaver/rxnweaver/common"
+	"github.com/RxnWeaver/rxnweaver/data/molecule"
+)
+
+// A transform carries a stereo flag for each of its mapped atoms, read
+// from the chirality written for it on either side of its SMIRKS.
+// Chirality does not restrict which atoms a pattern matches; it says
+// what becomes of the configurations of the stereocentres matched.
+//
+// Parities are given by the neighbours of an atom in the ascending
+// order of their input IDs, an implicit hydrogen being last; see
+// `molecule.AtomInfo`.  Carried over to the products, the neighbours
+// of a centre keep their places, and a neighbour lost takes the place
+// of the one gained, should a centre lose one and gain one.  The
+// parity is then counted afresh by the input IDs of the neighbours in
+// the products.
+
+// _StereoFlag says what becomes of the configuration of a mapped atom
+// upon applying a transform.
+type _StereoFlag uint8
+
+const (
+	// Chiral on neither side, or alike on both: the configuration is
+	// retained.
+	stereoRetained _StereoFlag = iota
+	// Chiral on both sides, oppositely, as in `SN2` displacement.
+	stereoInverted
+	// Chiral among the products alone: the configuration is created as
+	// written.
+	stereoCreated
+	// Chiral among the reactants alone: the configuration is lost.
+	stereoDropped
+)
+
+// implicitH stands for an implicit hydrogen among the neighbours of an
+// atom, ordered last.  No atom has its ID.
+const implicitH = math.MaxUint16
+
+// readStereo reads the stereo flags of the mapped atoms of this
+// transform.  It answers an error should an atom chiral on both sides
+// not have the same neighbours on both, but for one replaced.
+func (t *Transform) readStereo() error {
+	t.stereo = make(map[int]_StereoFlag)
+	reactants, products := mapIndex(t.reactants), mapIndex(t.products)
+	for n, pa := range products {
+		ra := reactants[n]
+		rp, rChiral := t.reactants[ra.pat].query.Parities[ra.iid]
+		pp, pChiral := t.products[pa.pat].query.Parities[pa.iid]
+		switch {
+		case !rChiral && !pChiral:
+			continue
+		case !pChiral:
+			t.stereo[n] = stereoDropped
+			continue
+		case !rChiral:
+			t.stereo[n] = stereoCreated
+			continue
+		}
+
+		// The neighbours of the reactant atom, among those of the
+		// product atom.
+		rpat, ppat := t.reactants[ra.pat], t.products[pa.pat]
+		old := queryNeighbours(rpat, ra.iid)
+		for i, nbr := range old {
+			if nbr == implicitH {
+				continue
+			}
+			old[i] = implicitH - 1 - uint16(i) // Lost, unless mapped.
+			if m, ok := rpat.query.Maps[nbr]; ok {
+				if q, ok := products[m]; ok && q.pat == pa.pat {
+					old[i] = q.iid
+				}
+			}
+		}
+		seq, ok := substitute(old, queryNeighbours(ppat, pa.iid))
+		if !ok {
+			return fmt.Errorf("Stereocentre :%d of %s : neighbours do not correspond", n, t.smirks)
+		}
+		if carried(rp, seq) == pp {
+			t.stereo[n] = stereoRetained
+		} else {
+			t.stereo[n] = stereoInverted
+		}
+	}
+	for n, ra := range reactants {
+		if _, ok := products[n]; ok {
+			continue
+		}
+		if _, ok := t.reactants[ra.pat].query.Parities[ra.iid]; ok {
+			t.stereo[n] = stereoDropped
+		}
+	}
+	return nil
+}
+
+// _PatternAtom is an atom of a pattern of a transform.
+type _PatternAtom struct {
+	pat int // Index of its pattern.
+	iid uint16
+}
+
+// mapIndex answers the mapped atoms of the given patterns, by their map
+// numbers.
+func mapIndex(pats []_Pattern) map[int]_PatternAtom {
+	res := make(map[int]_PatternAtom)
+	for i, pat := range pats {
+		for iid, n := range pat.query.Maps {
+			res[n] = _PatternAtom{i, iid}
+		}
+	}
+	return res
+}
+
+// queryNeighbours answers the neighbours of the given atom of the given
+// pattern in ascending order, followed by an implicit hydrogen, should
+// the atom be written with one.
+func queryNeighbours(pat _Pattern, iid uint16) []uint16 {
+	res := []uint16(nil)
+	for _, a := range pat.atoms {
+		if a.Iid != iid {
+			continue
+		}
+		res = append(res, a.Neighbours...)
+		sort.Slice(res, func(i, j int) bool { return res[i] < res[j] })
+		if pat.query.Atoms[iid].HCount == 1 {
+			res = append(res, implicitH)
+		}
+	}
+	return res
+}
+
+// substitute answers the given old neighbours of an atom as they stand
+// among its given new neighbours: each kept, or replaced by the one
+// neighbour gained, should the atom lose just one.  It answers `false`
+// should the neighbours not so correspond.
+func substitute(old, new []uint16) ([]uint16, bool) {
+	if len(old) != len(new) {
+		return nil, false
+	}
+	was := make(map[uint16]bool, len(old))
+	for _, n := range old {
+		was[n] = true
+	}
+	is := make(map[uint16]bool, len(new))
+	for _, n := range new {
+		is[n] = true
+	}
+
+	res := append([]uint16(nil), old...)
+	lost, gained := -1, []uint16(nil)
+	for i, n := range old {
+		if !is[n] {
+			if lost >= 0 {
+				return nil, false
+			}
+			lost = i
+		}
+	}
+	for _, n := range new {
+		if !was[n] {
+			gained = append(gained, n)
+		}
+	}
+	switch {
+	case lost < 0 && len(gained) == 0:
+		return res, true
+	case lost < 0 || len(gained) != 1:
+		return nil, false
+	}
+	res[lost] = gained[0]
+	return res, true
+}
+
+// carried answers the given parity, given by the given sequence of
+// neighbours, as given by them in ascending order instead.
+func carried(p cmn.StereoParity, seq []uint16) cmn.StereoParity {
+	odd := false
+	for i := range seq {
+		for j := i + 1; j < len(seq); j++ {
+			if seq[i] > seq[j] {
+				odd = !odd
+			}
+		}
+	}
+	if odd {
+		return p.Inverse()
+	}
+	return p
+}
+
+// _Centre is the configuration of a stereocentre of the reactants, in
+// the molecule being edited.
+type _Centre struct {
+	parity cmn.StereoParity
+	nbrs   []uint16 // In the order of their input IDs in the reactant, an implicit hydrogen last.
+}
+
+// _DoubleBond is the configuration of a double bond of the reactants,
+// in the molecule being edited.
+type _DoubleBond struct {
+	ends  [2]uint16
+	sides int8        // Of the lowest substituents, as `molecule.BondInfo` gives them.
+	lows  [2]uint16   // The substituent of either end with the lowest input ID in the reactant.
+	subs  [2][]uint16 // The substituents of either end, an implicit hydrogen last.
+}
+
+// _Stereo is the configurations of the reactants around the atoms
+// matched by a transform, in the molecule being edited.
+type _Stereo struct {
+	centres map[uint16]_Centre
+	bonds   map[[2]uint16]_DoubleBond
+}
+
+// capture records the configurations of the given atoms of the given
+// reactant, and of their double bonds, translated by the given input
+// IDs in the molecule being edited.
+func (s *_Stereo) capture(mol *molecule.Molecule, iids []uint16, ids map[uint16]uint16) error {
+	for _, iid := range iids {
+		a, err := mol.AtomInfo(iid)
+		if err != nil {
+			return err
+		}
+		if a.Parity == cmn.StereoParityOdd || a.Parity == cmn.StereoParityEven {
+			nbrs := translate(sortedNeighbours(a, 4), ids)
+			if len(nbrs) == 4 {
+				s.centres[ids[iid]] = _Centre{a.Parity, nbrs}
+			}
+		}
+
+	bonds:
+		for _, nbr := range a.Neighbours {
+			b, err := mol.BondBetween(iid, nbr)
+			if err != nil {
+				return err
+			}
+			key := bondKey(ids[b.A1], ids[b.A2])
+			if _, ok := s.bonds[key]; ok || b.Sides == 0 {
+				continue
+			}
+			ends := [2]uint16{b.A1, b.A2}
+			db := _DoubleBond{ends: [2]uint16{ids[b.A1], ids[b.A2]}, sides: b.Sides}
+			for k, end := range ends {
+				e, err := mol.AtomInfo(end)
+				if err != nil {
+					return err
+				}
+				subs := substituents(e, ends[1-k])
+				if len(subs) == 0 || subs[0] == implicitH {
+					continue bonds
+				}
+				db.lows[k] = ids[subs[0]]
+				db.subs[k] = translate(subs, ids)
+			}
+			s.bonds[key] = db
+		}
+	}
+	return nil
+}
+
+// restore sets the configurations of the given atoms of the molecule
+// being edited, mapped by the given map numbers, and of the double
+// bonds recorded, as the stereo flags of the given transform say.  The
+// given input IDs translate those of the product patterns.
+func (s *_Stereo) restore(t *Transform, work *molecule.Molecule, byMap map[int]uint16, kept map[uint16]bool, prodIds []map[uint16]uint16) error {
+	products := mapIndex(t.products)
+	for n, iid := range byMap {
+		if !kept[iid] {
+			continue
+		}
+		a, err := work.AtomInfo(iid)
+		if err != nil {
+			return err
+		}
+		nbrs := sortedNeighbours(a, 4)
+
+		p := cmn.StereoParityNone
+		switch flag := t.stereo[n]; flag {
+		case stereoCreated:
+			pa := products[n]
+			pat := t.products[pa.pat]
+			seq := translate(queryNeighbours(pat, pa.iid), prodIds[pa.pat])
+			if len(seq) == 4 && sameNeighbours(seq, nbrs) {
+				p = carried(pat.query.Parities[pa.iid], seq)
+			}
+
+		case stereoRetained, stereoInverted:
+			c, ok := s.centres[iid]
+			if !ok {
+				continue
+			}
+			if seq, ok := substitute(c.nbrs, nbrs); ok {
+				p = carried(c.parity, seq)
+			}
+			if flag == stereoInverted {
+				p = p.Inverse()
+			}
+		}
+		if err := work.SetAtomParity(iid, p); err != nil {
+			return err
+		}
+	}
+
+	for _, db := range s.bonds {
+		b, err := work.BondBetween(db.ends[0], db.ends[1])
+		if err != nil || b.KekuleType != cmn.BondTypeDouble {
+			continue
+		}
+		sides := db.sides
+		for k, end := range db.ends {
+			e, err := work.AtomInfo(end)
+			if err != nil {
+				return err
+			}
+			subs := substituents(e, db.ends[1-k])
+			seq, ok := substitute(db.subs[k], subs)
+			if !ok || len(subs) == 0 || subs[0] == implicitH {
+				sides = 0
+				break
+			}
+			for i, sub := range db.subs[k] {
+				if sub == db.lows[k] && seq[i] != subs[0] {
+					sides = -sides
+				}
+			}
+		}
+		if err := work.SetBondSides(b.Id, sides); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sortedNeighbours answers the neighbours of the given atom in
+// ascending order, followed by an implicit hydrogen, should the atom
+// have one, and one neighbour fewer than the given number.
+func sortedNeighbours(a molecule.AtomInfo, n int) []uint16 {
+	res := append([]uint16(nil), a.Neighbours...)
+	sort.Slice(res, func(i, j int) bool { return res[i] < res[j] })
+	if a.HCount == 1 && len(res) == n-1 {
+		res = append(res, implicitH)
+	}
+	return res
+}
+
+// substituents answers the substituents of the given end of a double
+// bond, other than its given end, as `sortedNeighbours` does.
+func substituents(a molecule.AtomInfo, other uint16) []uint16 {
+	res := []uint16(nil)
+	for _, n := range sortedNeighbours(a, 3) {
+		if n != other {
+			res = append(res, n)
+		}
+	}
+	return res
+}
+
+// translate answers the given input IDs, as translated by the given
+// map; an implicit hydrogen is kept as it is.
+func translate(iids []uint16, ids map[uint16]uint16) []uint16 {
+	res := make([]uint16, len(iids))
+	for i, iid := range iids {
+		res[i] = iid
+		if iid != implicitH {
+			res[i] = ids[iid]
+		}
+	}
+	return res
+}
+
+// sameNeighbours answers if the given neighbours of an atom are the
+// same, whatever their order.
+func sameNeighbours(seq, asc []uint16) bool {
+	sorted := append([]uint16(nil), seq...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	if len(sorted) != len(asc) {
+		return false
+	}
+	for i := range sorted {
+		if sorted[i] != asc[i] {
+			return false
+		}
+	}
+	return true
+}
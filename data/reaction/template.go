@@ -0,0 +1,515 @@
+package reaction
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/RxnWeaver/rxnweaver/data/molecule"
+)
+
+// ExtractTemplate answers the template of this reaction, as SMIRKS: its
+// reaction centre, with the given radius of the unchanged atoms around
+// it.  The atoms of the reactants and of the products correspond by
+// their atom map numbers; see `molecule.AtomMapAttribute`.  The
+// molecules should have been sanitised.
+//
+// The centre comprises the mapped atoms that change: in their mapped
+// neighbours, the bonds to them, their charges, hydrogen counts or
+// radicals, or by losing or gaining unmapped neighbours.  The atoms of
+// the reactants that are unmapped, or whose map numbers are missing
+// from the products, are leaving groups, and are included whole, as
+// are the unmapped atoms of the products bonded to the centre.  Atoms
+// within the given number of bonds of them in the reactants are then
+// added, as their environment, along with the atoms on the shortest
+// paths joining the parts of a pattern, so that each molecule has a
+// pattern of a single component.
+//
+// Atoms of the centre, and those leaving or added, are written with
+// their elements, aromaticity, hydrogen counts, degrees and charges;
+// those of the environment with their elements and aromaticity alone.
+// Bonds are written explicitly.  The map numbers are numbered afresh,
+// in the order of the atoms written, and leaving atoms are written
+// unmapped.  Stereochemistry is not written, so that the template
+// retains configurations; see `Transform`.
+//
+// Reactants and products with no atoms in the template are left out of
+// it.  It is an error for the reaction to have no mapped atoms, or no
+// atoms that change.
+func (r *Reaction) ExtractTemplate(radius int) (string, error) {
+	if radius < 0 {
+		return "", fmt.Errorf("Invalid radius : %d", radius)
+	}
+	rs, err := newSide(r.reactants)
+	if err != nil {
+		return "", fmt.Errorf("Reactants : %v", err)
+	}
+	ps, err := newSide(r.products)
+	if err != nil {
+		return "", fmt.Errorf("Products : %v", err)
+	}
+	if len(rs.byMap) == 0 || len(ps.byMap) == 0 {
+		return "", fmt.Errorf("Reaction has no mapped atoms.")
+	}
+
+	// The reaction centre, and the atoms leaving or added.
+	for n, ra := range rs.byMap {
+		pa, ok := ps.byMap[n]
+		if !ok || changes(rs, ra, ps, pa) {
+			rs.include(ra, true)
+		}
+	}
+	if len(rs.full) == 0 {
+		return "", fmt.Errorf("Reaction has no reaction centre.")
+	}
+	rs.spread(func(s _Site) bool { return !ps.has(rs.maps[s.mol][s.iid]) })
+	for n, ra := range rs.byMap {
+		if pa, ok := ps.byMap[n]; ok && rs.full[ra] {
+			ps.include(pa, true)
+		}
+	}
+	ps.spread(func(s _Site) bool { return !rs.has(ps.maps[s.mol][s.iid]) })
+
+	// The environment.
+	for i := 0; i < radius; i++ {
+		for _, s := range rs.sites() {
+			for _, nbr := range rs.atoms[s.mol][s.iid].Neighbours {
+				ns := _Site{s.mol, nbr}
+				if rs.included[ns] || rs.atoms[ns.mol][nbr].AtomicNumber == 1 {
+					continue
+				}
+				rs.include(ns, !ps.has(rs.maps[ns.mol][nbr]))
+			}
+		}
+	}
+	for s := range rs.included {
+		if pa, ok := ps.byMap[rs.maps[s.mol][s.iid]]; ok && !ps.included[pa] {
+			ps.include(pa, false)
+		}
+	}
+
+	// The paths joining the parts of each pattern.
+	for joined := false; !joined; {
+		joined = true
+		for _, sides := range [][2]*_Side{{rs, ps}, {ps, rs}} {
+			added, err := sides[0].join(sides[1])
+			if err != nil {
+				return "", err
+			}
+			joined = joined && !added
+		}
+	}
+
+	renum := make(map[int]int)
+	reactants := rs.write(func(s _Site) int {
+		n := rs.maps[s.mol][s.iid]
+		if !ps.has(n) {
+			return 0
+		}
+		if _, ok := renum[n]; !ok {
+			renum[n] = len(renum) + 1
+		}
+		return renum[n]
+	})
+	products := ps.write(func(s _Site) int {
+		return renum[ps.maps[s.mol][s.iid]]
+	})
+	return reactants + ">>" + products, nil
+}
+
+// TemplateSupport answers the templates of the given reactions,
+// extracted with the given radius, with the number of the reactions
+// giving each, its support.  It also answers the number of reactions
+// whose templates could not be extracted, which are skipped.
+func TemplateSupport(rs []*Reaction, radius int) (map[string]int, int) {
+	res := make(map[string]int)
+	skipped := 0
+	for _, r := range rs {
+		tpl, err := r.ExtractTemplate(radius)
+		if err != nil {
+			skipped++
+			continue
+		}
+		res[tpl]++
+	}
+	return res, skipped
+}
+
+// _Site is an atom of a molecule of a side of a reaction.
+type _Site struct {
+	mol int    // Index of its molecule.
+	iid uint16 // Input ID of the atom.
+}
+
+// _Side is a side of a mapped reaction, with snapshots of the atoms and
+// the bonds of its molecules, and the atoms of its template.
+type _Side struct {
+	mols  []*molecule.Molecule
+	atoms []map[uint16]molecule.AtomInfo    // By input ID, of each molecule.
+	bonds []map[[2]uint16]molecule.BondInfo // By their atoms, of each molecule.
+	maps  []map[uint16]int                  // Map numbers, by input ID, of each molecule.
+	byMap map[int]_Site
+
+	included map[_Site]bool // Atoms of the template.
+	full     map[_Site]bool // Of those, atoms written fully.
+}
+
+// newSide answers the side of the given molecules.
+func newSide(mols []*molecule.Molecule) (*_Side, error) {
+	s := &_Side{
+		mols:     mols,
+		byMap:    make(map[int]_Site),
+		included: make(map[_Site]bool),
+		full:     make(map[_Site]bool),
+	}
+	for i, mol := range mols {
+		atoms := make(map[uint16]molecule.AtomInfo)
+		maps := make(map[uint16]int)
+		it := mol.Atoms()
+		for it.Next() {
+			a := it.Atom()
+			atoms[a.Iid] = a
+			attrs, err := mol.AtomAttributes(a.Iid)
+			if err != nil {
+				return nil, err
+			}
+			n := 0
+			for _, attr := range attrs {
+				if attr.Name == molecule.AtomMapAttribute {
+					n, _ = strconv.Atoi(attr.Value)
+				}
+			}
+			if n <= 0 {
+				continue
+			}
+			if _, ok := s.byMap[n]; ok {
+				return nil, fmt.Errorf("Duplicate atom map number : %d", n)
+			}
+			maps[a.Iid] = n
+			s.byMap[n] = _Site{i, a.Iid}
+		}
+		if err := it.Err(); err != nil {
+			return nil, err
+		}
+
+		bonds := make(map[[2]uint16]molecule.BondInfo)
+		bit := mol.Bonds()
+		for bit.Next() {
+			b := bit.Bond()
+			bonds[bondKey(b.A1, b.A2)] = b
+		}
+		if err := bit.Err(); err != nil {
+			return nil, err
+		}
+		s.atoms = append(s.atoms, atoms)
+		s.bonds = append(s.bonds, bonds)
+		s.maps = append(s.maps, maps)
+	}
+	return s, nil
+}
+
+// has answers if this side has an atom of the given map number.
+func (s *_Side) has(n int) bool {
+	_, ok := s.byMap[n]
+	return n > 0 && ok
+}
+
+// include adds the given atom to the template, to be written fully, if
+// so given.
+func (s *_Side) include(site _Site, full bool) {
+	s.included[site] = true
+	if full {
+		s.full[site] = true
+	}
+}
+
+// sites answers the atoms of the template, in the order of their
+// molecules and input IDs.
+func (s *_Side) sites() []_Site {
+	res := make([]_Site, 0, len(s.included))
+	for site := range s.included {
+		res = append(res, site)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].mol != res[j].mol {
+			return res[i].mol < res[j].mol
+		}
+		return res[i].iid < res[j].iid
+	})
+	return res
+}
+
+// spread adds to the template, to be written fully, the atoms bonded,
+// directly or through one another, to those of the template, and of
+// the given kind.  Hydrogen atoms are left out.
+func (s *_Side) spread(kind func(_Site) bool) {
+	queue := s.sites()
+	for len(queue) > 0 {
+		site := queue[0]
+		queue = queue[1:]
+		for _, nbr := range s.atoms[site.mol][site.iid].Neighbours {
+			ns := _Site{site.mol, nbr}
+			if s.included[ns] || s.atoms[ns.mol][nbr].AtomicNumber == 1 || !kind(ns) {
+				continue
+			}
+			s.include(ns, true)
+			queue = append(queue, ns)
+		}
+	}
+}
+
+// changes answers if the given mapped atom of the reactants changes in
+// the given one of the products.
+func changes(rs *_Side, ra _Site, ps *_Side, pa _Site) bool {
+	a, b := rs.atoms[ra.mol][ra.iid], ps.atoms[pa.mol][pa.iid]
+	if a.Charge != b.Charge || a.HCount != b.HCount || a.Radical != b.Radical {
+		return true
+	}
+	ra1, ok1 := rs.neighbourhood(ra)
+	pa1, ok2 := ps.neighbourhood(pa)
+	if !ok1 || !ok2 || len(ra1) != len(pa1) {
+		return true
+	}
+	for n, order := range ra1 {
+		if o, ok := pa1[n]; !ok || o != order {
+			return true
+		}
+	}
+	return false
+}
+
+// neighbourhood answers the orders of the bonds of the given atom to
+// its mapped neighbours, by their map numbers, `-1` being aromatic.  It
+// answers `false` should the atom have unmapped neighbours other than
+// hydrogens.
+func (s *_Side) neighbourhood(site _Site) (map[int]int, bool) {
+	res := make(map[int]int)
+	for _, nbr := range s.atoms[site.mol][site.iid].Neighbours {
+		n := s.maps[site.mol][nbr]
+		if n == 0 {
+			if s.atoms[site.mol][nbr].AtomicNumber == 1 {
+				continue
+			}
+			return nil, false
+		}
+		b := s.bonds[site.mol][bondKey(site.iid, nbr)]
+		res[n] = b.KekuleType.Order()
+		if b.IsAromatic {
+			res[n] = -1
+		}
+	}
+	return res, true
+}
+
+// join adds to the template of each molecule of this side the atoms on
+// the shortest paths joining its parts, and their counterparts on the
+// given other side.  It answers if it added any.
+func (s *_Side) join(other *_Side) (bool, error) {
+	added := false
+	for i, mol := range s.mols {
+		parts := s.parts(i)
+		if len(parts) < 2 {
+			continue
+		}
+		for _, part := range parts[1:] {
+			path, err := mol.ShortestPath(parts[0][0], part[0])
+			if err != nil {
+				return false, err
+			}
+			for _, iid := range path {
+				site := _Site{i, iid}
+				if s.included[site] {
+					continue
+				}
+				n := s.maps[i][iid]
+				if !other.has(n) {
+					return false, fmt.Errorf("Reaction centre of molecule %d can not be joined.", i)
+				}
+				s.include(site, false)
+				if os := other.byMap[n]; !other.included[os] {
+					other.include(os, false)
+				}
+				added = true
+			}
+		}
+	}
+	return added, nil
+}
+
+// parts answers the atoms of the template in the given molecule of this
+// side, grouped by the connected parts they form, each in ascending
+// order of input IDs.
+func (s *_Side) parts(mol int) [][]uint16 {
+	res := [][]uint16(nil)
+	seen := make(map[uint16]bool)
+	for _, site := range s.sites() {
+		if site.mol != mol || seen[site.iid] {
+			continue
+		}
+		part := []uint16{site.iid}
+		seen[site.iid] = true
+		for k := 0; k < len(part); k++ {
+			for _, nbr := range s.atoms[mol][part[k]].Neighbours {
+				if !seen[nbr] && s.included[_Site{mol, nbr}] {
+					seen[nbr] = true
+					part = append(part, nbr)
+				}
+			}
+		}
+		sort.Slice(part, func(i, j int) bool { return part[i] < part[j] })
+		res = append(res, part)
+	}
+	return res
+}
+
+// write answers the SMARTS patterns of the molecules of this side with
+// atoms in the template, separated by `.`, numbering its atoms by the
+// given function, as they are written; `0` leaves an atom unmapped.
+func (s *_Side) write(num func(_Site) int) string {
+	pats := []string(nil)
+	for i := range s.mols {
+		parts := s.parts(i)
+		if len(parts) == 0 {
+			continue
+		}
+		w := &_SmartsWriter{side: s, mol: i, num: num, digits: make(map[[2]uint16]int)}
+		w.plan(parts[0][0], parts[0][0])
+		w.write(parts[0][0], parts[0][0])
+		pats = append(pats, w.sb.String())
+	}
+	return strings.Join(pats, ".")
+}
+
+// _SmartsWriter writes the atoms of the template in a molecule of a
+// side as SMARTS, depth first.
+type _SmartsWriter struct {
+	side *_Side
+	mol  int
+	num  func(_Site) int
+
+	visited  map[uint16]bool
+	children map[uint16][]uint16    // Atoms written after each, in branches.
+	closures map[uint16][][2]uint16 // Ring bonds opened or closed at each.
+	digits   map[[2]uint16]int      // Digits of the ring bonds open.
+	used     []bool                 // Digits in use.
+	sb       strings.Builder
+}
+
+// plan visits the atoms of the template from the given one, reached
+// from the given parent, recording the bonds of the tree and the ring
+// bonds closing it.
+func (w *_SmartsWriter) plan(iid, parent uint16) {
+	if w.visited == nil {
+		w.visited = make(map[uint16]bool)
+		w.children = make(map[uint16][]uint16)
+		w.closures = make(map[uint16][][2]uint16)
+	}
+	w.visited[iid] = true
+	nbrs := append([]uint16(nil), w.side.atoms[w.mol][iid].Neighbours...)
+	sort.Slice(nbrs, func(i, j int) bool { return nbrs[i] < nbrs[j] })
+	for _, nbr := range nbrs {
+		if nbr == parent || !w.side.included[_Site{w.mol, nbr}] {
+			continue
+		}
+		if !w.visited[nbr] {
+			w.children[iid] = append(w.children[iid], nbr)
+			w.plan(nbr, iid)
+			continue
+		}
+		key := bondKey(iid, nbr)
+		if _, ok := w.digits[key]; !ok {
+			w.digits[key] = -1
+			w.closures[nbr] = append(w.closures[nbr], key)
+			w.closures[iid] = append(w.closures[iid], key)
+		}
+	}
+}
+
+// write writes the given atom, reached from the given parent, and the
+// atoms after it.
+func (w *_SmartsWriter) write(iid, parent uint16) {
+	if iid != parent {
+		w.writeBond(iid, parent)
+	}
+	w.writeAtom(iid)
+	for _, key := range w.closures[iid] {
+		if d := w.digits[key]; d >= 0 {
+			w.used[d] = false
+			w.writeDigit(d)
+			continue
+		}
+		d := 1
+		for ; d < len(w.used) && w.used[d]; d++ {
+		}
+		for len(w.used) <= d {
+			w.used = append(w.used, false)
+		}
+		w.used[d], w.digits[key] = true, d
+		w.writeBond(key[0], key[1])
+		w.writeDigit(d)
+	}
+	kids := w.children[iid]
+	for k, kid := range kids {
+		if k < len(kids)-1 {
+			w.sb.WriteByte('(')
+			w.write(kid, iid)
+			w.sb.WriteByte(')')
+		} else {
+			w.write(kid, iid)
+		}
+	}
+}
+
+// writeDigit writes the given ring closure digit.
+func (w *_SmartsWriter) writeDigit(d int) {
+	if d > 9 {
+		fmt.Fprintf(&w.sb, "%%%02d", d)
+		return
+	}
+	w.sb.WriteByte(byte('0' + d))
+}
+
+// writeBond writes the symbol of the bond between the given atoms.
+func (w *_SmartsWriter) writeBond(a1, a2 uint16) {
+	b := w.side.bonds[w.mol][bondKey(a1, a2)]
+	switch {
+	case b.IsAromatic:
+		w.sb.WriteByte(':')
+	case b.KekuleType.Order() == 1:
+		w.sb.WriteByte('-')
+	case b.KekuleType.Order() == 2:
+		w.sb.WriteByte('=')
+	case b.KekuleType.Order() == 3:
+		w.sb.WriteByte('#')
+	default:
+		w.sb.WriteByte('~')
+	}
+}
+
+// smartsAromatic lists the elements written in lower case when
+// aromatic.
+var smartsAromatic = map[string]bool{"B": true, "C": true, "N": true, "O": true, "P": true, "S": true, "Se": true, "As": true}
+
+// writeAtom writes the given atom, fully, if so included, or with its
+// element and aromaticity alone.
+func (w *_SmartsWriter) writeAtom(iid uint16) {
+	site := _Site{w.mol, iid}
+	a := w.side.atoms[w.mol][iid]
+	w.sb.WriteByte('[')
+	switch {
+	case !a.IsAromatic:
+		w.sb.WriteString(a.Symbol)
+	case smartsAromatic[a.Symbol]:
+		w.sb.WriteString(strings.ToLower(a.Symbol))
+	default:
+		fmt.Fprintf(&w.sb, "#%d;a", a.AtomicNumber)
+	}
+	if w.side.full[site] {
+		fmt.Fprintf(&w.sb, ";H%d;D%d;%+d", a.HCount, len(a.Neighbours), a.Charge)
+	}
+	if n := w.num(site); n > 0 {
+		fmt.Fprintf(&w.sb, ":%d", n)
+	}
+	w.sb.WriteByte(']')
+}
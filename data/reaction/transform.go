@@ -0,0 +1,612 @@
+package reaction
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	cmn "github.com/RxnWeaver/rxnweaver/common"
+	"github.com/RxnWeaver/rxnweaver/data/loader"
+	"github.com/RxnWeaver/rxnweaver/data/molecule"
+)
+
+// Transform is a reaction template read from SMIRKS: patterns of the
+// reactants and of the products, whose atoms correspond by their map
+// numbers.  Each component of either side, separated by `.`, is a
+// pattern of its own, matched in a molecule of its own.  See
+// `loader.ReadSmarts` for what the patterns may say.
+//
+// Applied to reactants, a transform answers the products made by
+// editing each occurrence of its reactant patterns as its product
+// patterns say:
+//   - Mapped atoms are kept.  They take the element of their product
+//     atom, if it gives one, and its charge and hydrogen count, if
+//     given.  Otherwise, their hydrogen counts are adjusted by the
+//     orders of the bonds they gain or lose.
+//   - Atoms of the reactant patterns that are unmapped, or whose map
+//     numbers are missing from the product patterns, are removed.
+//   - Atoms of the product patterns that are unmapped are added, with
+//     their hydrogen counts, if given.
+//   - Bonds between kept atoms are removed, added or retyped as the
+//     product patterns say.  Bonds written alike on both sides, and
+//     bonds not written in the product patterns, are left alone.
+//   - Kept atoms keep their configurations, their neighbours keeping
+//     their places, and a neighbour replaced giving its place to the
+//     one replacing it.  Atoms written chiral on both sides, but
+//     oppositely, are inverted; those written chiral among the
+//     products alone are given the configuration written; and those
+//     written chiral among the reactants alone lose theirs.  Double
+//     bonds kept keep their configurations likewise.
+//
+// The products are then sanitised, to perceive them afresh, and to
+// give atoms of the organic subset the hydrogens they need.
+type Transform struct {
+	smirks    string
+	reactants []_Pattern
+	products  []_Pattern
+	stereo    map[int]_StereoFlag // By map number; see `readStereo`.
+}
+
+// _Pattern is a pattern of a transform, with snapshots of its atoms and
+// bonds.
+type _Pattern struct {
+	query *molecule.Query
+	atoms []molecule.AtomInfo
+	bonds []molecule.BondInfo
+}
+
+// ParseSmirks answers the transform of the given SMIRKS string,
+// `reactants>>products`, or `reactants>agents>products`, the agents
+// being ignored.  Map numbers must be unique on either side, and those
+// of the products must be among those of the reactants.  Unmapped
+// product atoms must give single elements, to be added.  Atoms written
+// chiral on both sides must have the same neighbours on both, counting
+// a hydrogen, `H1`, but for one replaced.
+func ParseSmirks(smirks string) (*Transform, error) {
+	sides := strings.Split(smirks, ">")
+	if len(sides) != 3 || sides[0] == "" || sides[2] == "" {
+		return nil, fmt.Errorf("Malformed SMIRKS : %q", smirks)
+	}
+
+	t := &Transform{smirks: smirks}
+	var err error
+	if t.reactants, err = readPatterns(sides[0]); err != nil {
+		return nil, fmt.Errorf("SMIRKS reactants : %v", err)
+	}
+	if t.products, err = readPatterns(sides[2]); err != nil {
+		t.Release()
+		return nil, fmt.Errorf("SMIRKS products : %v", err)
+	}
+	if err := t.check(); err != nil {
+		t.Release()
+		return nil, err
+	}
+	if err := t.readStereo(); err != nil {
+		t.Release()
+		return nil, err
+	}
+	return t, nil
+}
+
+// readPatterns answers the patterns of the components of the given
+// side of a SMIRKS string.
+func readPatterns(side string) ([]_Pattern, error) {
+	res := []_Pattern(nil)
+	for _, comp := range splitComponents(side) {
+		q, err := loader.ReadSmarts(comp)
+		if err != nil {
+			releasePatterns(res)
+			return nil, err
+		}
+		pat := _Pattern{query: q}
+		it := q.Mol.Atoms()
+		for it.Next() {
+			pat.atoms = append(pat.atoms, it.Atom())
+		}
+		bit := q.Mol.Bonds()
+		for bit.Next() {
+			pat.bonds = append(pat.bonds, bit.Bond())
+		}
+		res = append(res, pat)
+		if err := it.Err(); err != nil {
+			releasePatterns(res)
+			return nil, err
+		}
+		if err := bit.Err(); err != nil {
+			releasePatterns(res)
+			return nil, err
+		}
+	}
+	return res, nil
+}
+
+// splitComponents splits the given SMARTS string at the dots outside
+// its bracket atoms.
+func splitComponents(s string) []string {
+	res := []string(nil)
+	depth, start := 0, 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '[':
+			depth++
+		case ']':
+			depth--
+		case '.':
+			if depth == 0 {
+				res = append(res, s[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(res, s[start:])
+}
+
+// check answers an error should the map numbers of this transform be
+// inconsistent, or an unmapped product atom not give a single element.
+func (t *Transform) check() error {
+	mapped := make(map[int]bool)
+	for _, pat := range t.reactants {
+		for _, n := range pat.query.Maps {
+			if mapped[n] {
+				return fmt.Errorf("Duplicate map number among the reactants : %d", n)
+			}
+			mapped[n] = true
+		}
+	}
+
+	seen := make(map[int]bool)
+	for _, pat := range t.products {
+		for _, a := range pat.atoms {
+			n, ok := pat.query.Maps[a.Iid]
+			switch {
+			case ok && seen[n]:
+				return fmt.Errorf("Duplicate map number among the products : %d", n)
+			case ok && !mapped[n]:
+				return fmt.Errorf("Map number of the products not among the reactants : %d", n)
+			case !ok && !isSpecific(pat.query.Atoms[a.Iid]):
+				return fmt.Errorf("Product atom %d of %s has no single element.", a.Iid, t.smirks)
+			}
+			if ok {
+				seen[n] = true
+			}
+		}
+	}
+	return nil
+}
+
+// isSpecific answers if the given constraint leaves the element of its
+// atom as given.
+func isSpecific(c molecule.AtomConstraint) bool {
+	return !c.AnyElement && len(c.Elements) == 0
+}
+
+// Smirks answers the SMIRKS string of this transform.
+func (t *Transform) Smirks() string {
+	return t.smirks
+}
+
+// Arity answers the number of reactants this transform needs.
+func (t *Transform) Arity() int {
+	return len(t.reactants)
+}
+
+// ProductCount answers the number of product patterns of this
+// transform.
+func (t *Transform) ProductCount() int {
+	return len(t.products)
+}
+
+// Reverse answers the transform from the products of this transform to
+// its reactants, as retrosynthesis applies it.  This transform is not
+// modified.
+func (t *Transform) Reverse() (*Transform, error) {
+	sides := strings.Split(t.smirks, ">")
+	return ParseSmirks(sides[2] + ">" + sides[1] + ">" + sides[0])
+}
+
+// Release releases the query molecules of the patterns of this
+// transform.  It should not be used thereafter.
+func (t *Transform) Release() {
+	releasePatterns(t.reactants)
+	releasePatterns(t.products)
+}
+
+// releasePatterns releases the query molecules of the given patterns.
+func releasePatterns(pats []_Pattern) {
+	for _, pat := range pats {
+		pat.query.Mol.Release()
+	}
+}
+
+// Apply answers the sets of products of this transform applied to the
+// given reactants, one to each of its reactant patterns, in order: a
+// set for each combination of the occurrences of the patterns in the
+// reactants.  Sets of the same products are answered once.  The
+// reactants, which are not modified, should have been sanitised; see
+// `molecule.Sanitize`.  The products are passive molecules.
+//
+// Reactants in which a pattern does not occur answer no products, not
+// an error; nor do occurrences whose products have errors upon
+// sanitisation, as valences exceeded.
+func (t *Transform) Apply(mols []*molecule.Molecule) ([][]*molecule.Molecule, error) {
+	occs, err := t.Occurrences(mols)
+	if err != nil {
+		return nil, err
+	}
+	res := make([][]*molecule.Molecule, len(occs))
+	for i, o := range occs {
+		res[i] = o.Products
+	}
+	return res, nil
+}
+
+// Occurrence is an occurrence of the reactant patterns of a transform
+// in its reactants, with the products it makes.
+type Occurrence struct {
+	Products []*molecule.Molecule
+	// Input IDs of the reactant atoms matched, in ascending order, one
+	// list per reactant.
+	Atoms [][]uint16
+}
+
+// Occurrences answers the occurrences of the reactant patterns of this
+// transform in the given reactants, with their products, as `Apply`
+// does: of occurrences making the same products, the first alone.
+func (t *Transform) Occurrences(mols []*molecule.Molecule) ([]Occurrence, error) {
+	if len(mols) != len(t.reactants) {
+		return nil, fmt.Errorf("Transform %s needs %d reactants, given : %d", t.smirks, len(t.reactants), len(mols))
+	}
+
+	maps := make([][]map[uint16]uint16, len(mols))
+	for i, mol := range mols {
+		ms, err := mol.QueryMaps(t.reactants[i].query, 0)
+		if err != nil {
+			return nil, err
+		}
+		if len(ms) == 0 {
+			return nil, nil
+		}
+		maps[i] = ms
+	}
+
+	res := []Occurrence(nil)
+	release := func() {
+		for _, o := range res {
+			releaseAll(o.Products)
+		}
+	}
+	seen := make(map[string]bool)
+	idxs := make([]int, len(mols))
+	for {
+		occ := make([]map[uint16]uint16, len(mols))
+		for i, k := range idxs {
+			occ[i] = maps[i][k]
+		}
+		prods, err := t.edit(mols, occ)
+		if err != nil {
+			release()
+			return nil, err
+		}
+		if prods != nil {
+			key, err := productsKey(prods)
+			if err != nil {
+				releaseAll(prods)
+				release()
+				return nil, err
+			}
+			if seen[key] {
+				releaseAll(prods)
+			} else {
+				seen[key] = true
+				res = append(res, Occurrence{prods, occurrenceAtoms(occ)})
+			}
+		}
+
+		i := len(idxs) - 1
+		for ; i >= 0; i-- {
+			if idxs[i]++; idxs[i] < len(maps[i]) {
+				break
+			}
+			idxs[i] = 0
+		}
+		if i < 0 {
+			break
+		}
+	}
+	return res, nil
+}
+
+// occurrenceAtoms answers the reactant atoms of the given occurrence,
+// in ascending order, one list per reactant.
+func occurrenceAtoms(occ []map[uint16]uint16) [][]uint16 {
+	res := make([][]uint16, len(occ))
+	for i, m := range occ {
+		res[i] = make([]uint16, 0, len(m))
+		for _, to := range m {
+			res[i] = append(res[i], to)
+		}
+		sort.Slice(res[i], func(a, b int) bool { return res[i][a] < res[i][b] })
+	}
+	return res
+}
+
+// releaseAll releases the molecules of the given sets.
+func releaseAll(sets ...[]*molecule.Molecule) {
+	for _, mols := range sets {
+		for _, mol := range mols {
+			mol.Release()
+		}
+	}
+}
+
+// productsKey answers a key identifying the given set of products,
+// whatever their order.
+func productsKey(mols []*molecule.Molecule) (string, error) {
+	keys := make([]string, len(mols))
+	for i, mol := range mols {
+		h, err := mol.Hash128(molecule.HashStereo | molecule.HashIsotopes)
+		if err != nil {
+			return "", err
+		}
+		keys[i] = h.String()
+	}
+	sort.Strings(keys)
+	return strings.Join(keys, "."), nil
+}
+
+// _PatternBond is a bond of a pattern, between atoms of the molecule
+// being edited.
+type _PatternBond struct {
+	typ  cmn.BondType
+	cons molecule.BondConstraint
+}
+
+// edit answers the products of this transform applied to the given
+// occurrences of its reactant patterns in the given reactants, or
+// `nil`, should they have errors upon sanitisation.
+func (t *Transform) edit(mols []*molecule.Molecule, occ []map[uint16]uint16) ([]*molecule.Molecule, error) {
+	work := molecule.NewPassive()
+	defer work.Release()
+
+	// The atoms of the reactant patterns, in the molecule being edited.
+	byMap := make(map[int]uint16)
+	matched := make(map[uint16]bool)
+	reacted := make(map[[2]uint16]_PatternBond)
+	st := &_Stereo{make(map[uint16]_Centre), make(map[[2]uint16]_DoubleBond)}
+	for i, mol := range mols {
+		ids, err := work.Merge(mol, nil)
+		if err != nil {
+			return nil, err
+		}
+		pat := t.reactants[i]
+		mapped := []uint16(nil)
+		for q, a := range occ[i] {
+			matched[ids[a]] = true
+			if n, ok := pat.query.Maps[q]; ok {
+				byMap[n] = ids[a]
+				mapped = append(mapped, a)
+			}
+		}
+		if err := st.capture(mol, mapped, ids); err != nil {
+			return nil, err
+		}
+		for _, b := range pat.bonds {
+			key := bondKey(ids[occ[i][b.A1]], ids[occ[i][b.A2]])
+			reacted[key] = _PatternBond{b.Type, pat.query.Bonds[b.Id]}
+		}
+	}
+
+	existing := make(map[[2]uint16]molecule.BondInfo)
+	bit := work.Bonds()
+	for bit.Next() {
+		b := bit.Bond()
+		existing[bondKey(b.A1, b.A2)] = b
+	}
+	if err := bit.Err(); err != nil {
+		return nil, err
+	}
+
+	// The atoms of the product patterns, added unless mapped.
+	kept := make(map[uint16]bool)
+	made := make(map[[2]uint16]_PatternBond)
+	next := uint16(work.AtomCount())
+	ab := work.NewAtomBuilder()
+	hCounts := make(map[uint16]int) // Given by the product patterns.
+	prodIds := make([]map[uint16]uint16, len(t.products))
+	for i, pat := range t.products {
+		ids := make(map[uint16]uint16, len(pat.atoms))
+		prodIds[i] = ids
+		for _, a := range pat.atoms {
+			c := pat.query.Atoms[a.Iid]
+			if n, ok := pat.query.Maps[a.Iid]; ok {
+				ids[a.Iid] = byMap[n]
+				kept[byMap[n]] = true
+				if err := t.editAtom(work, byMap[n], a, c); err != nil {
+					return nil, err
+				}
+			} else {
+				ab.Element(a.Symbol)
+				if a.Charge != 0 {
+					ab.FormalCharge(int(a.Charge))
+				}
+				if a.Isotope != 0 {
+					ab.Isotope(int(a.Isotope))
+				}
+				if err := ab.Add(); err != nil {
+					return nil, err
+				}
+				ids[a.Iid] = next
+				next++
+			}
+			if c.HCount >= 0 {
+				hCounts[ids[a.Iid]] = c.HCount
+			}
+		}
+		for _, b := range pat.bonds {
+			made[bondKey(ids[b.A1], ids[b.A2])] = _PatternBond{b.Type, pat.query.Bonds[b.Id]}
+		}
+	}
+
+	// The bonds between kept atoms, and the orders gained by them.  Bonds
+	// to atoms not kept go with those atoms.
+	gained := make(map[uint16]int)
+	for key := range reacted {
+		b := existing[key]
+		if _, ok := made[key]; ok || (!kept[key[0]] && !kept[key[1]]) {
+			continue
+		}
+		if kept[key[0]] && kept[key[1]] {
+			if err := work.RemoveBond(b.Id); err != nil {
+				return nil, err
+			}
+		}
+		if b.IsAromatic {
+			continue
+		}
+		for _, iid := range key {
+			if kept[iid] {
+				gained[iid] -= b.KekuleType.Order()
+			}
+		}
+	}
+	bb := work.NewBondBuilder()
+	for key, pb := range made {
+		rb, ok := reacted[key]
+		typ := pb.typ
+		switch {
+		case ok && (rb == pb || pb.cons != molecule.BondAsGiven):
+			continue
+		case pb.cons != molecule.BondAsGiven:
+			typ = cmn.BondTypeSingle
+		}
+
+		old, aromatic := 0, typ == cmn.BondTypeAltern
+		if b, ok := existing[key]; ok {
+			old, aromatic = b.KekuleType.Order(), aromatic || b.IsAromatic
+			if err := work.SetBondType(b.Id, typ); err != nil {
+				return nil, err
+			}
+		} else if err := bb.Connect(int(key[0]), int(key[1])).Type(typ).Add(); err != nil {
+			return nil, err
+		}
+		if !aromatic {
+			gained[key[0]] += typ.Order() - old
+			gained[key[1]] += typ.Order() - old
+		}
+	}
+
+	for iid, n := range hCounts {
+		if err := work.SetAtomHCount(iid, uint8(n)); err != nil {
+			return nil, err
+		}
+	}
+	for iid, n := range gained {
+		if _, ok := hCounts[iid]; ok || n == 0 || !kept[iid] {
+			continue
+		}
+		a, err := work.AtomInfo(iid)
+		if err != nil {
+			return nil, err
+		}
+		h := int(a.HCount) - n
+		if h < 0 {
+			h = 0
+		}
+		if err := work.SetAtomHCount(iid, uint8(h)); err != nil {
+			return nil, err
+		}
+	}
+
+	for iid := range matched {
+		if kept[iid] {
+			continue
+		}
+		if err := work.RemoveAtom(iid); err != nil {
+			return nil, err
+		}
+	}
+	if err := st.restore(t, work, byMap, kept, prodIds); err != nil {
+		return nil, err
+	}
+
+	rep, err := molecule.Sanitize(work, 0)
+	if err != nil {
+		return nil, err
+	}
+	if rep.HasErrors() {
+		return nil, nil
+	}
+	return components(work)
+}
+
+// editAtom gives the given kept atom of the molecule being edited the
+// element and the charge of the given product atom, as far as it gives
+// them.
+func (t *Transform) editAtom(work *molecule.Molecule, iid uint16, p molecule.AtomInfo, c molecule.AtomConstraint) error {
+	a, err := work.AtomInfo(iid)
+	if err != nil {
+		return err
+	}
+	if isSpecific(c) && a.AtomicNumber != p.AtomicNumber {
+		if err := work.ReplaceAtom(iid, p.Symbol); err != nil {
+			return err
+		}
+	}
+	if c.Charged && a.Charge != p.Charge {
+		if err := work.SetAtomCharge(iid, p.Charge); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// bondKey answers the given pair of atoms in ascending order.
+func bondKey(a1, a2 uint16) [2]uint16 {
+	if a1 > a2 {
+		a1, a2 = a2, a1
+	}
+	return [2]uint16{a1, a2}
+}
+
+// components answers new molecules of the connected components of the
+// given molecule, in the order of their first atoms.
+func components(mol *molecule.Molecule) ([]*molecule.Molecule, error) {
+	nbrs := make(map[uint16][]uint16, mol.AtomCount())
+	iids := make([]uint16, 0, mol.AtomCount())
+	it := mol.Atoms()
+	for it.Next() {
+		a := it.Atom()
+		nbrs[a.Iid] = a.Neighbours
+		iids = append(iids, a.Iid)
+	}
+	if err := it.Err(); err != nil {
+		return nil, err
+	}
+	sort.Slice(iids, func(i, j int) bool { return iids[i] < iids[j] })
+
+	seen := make(map[uint16]bool, len(iids))
+	res := []*molecule.Molecule(nil)
+	for _, iid := range iids {
+		if seen[iid] {
+			continue
+		}
+		seen[iid] = true
+		comp := []uint16{iid}
+		for k := 0; k < len(comp); k++ {
+			for _, n := range nbrs[comp[k]] {
+				if !seen[n] {
+					seen[n] = true
+					comp = append(comp, n)
+				}
+			}
+		}
+		sort.Slice(comp, func(i, j int) bool { return comp[i] < comp[j] })
+		c, err := mol.ExtractAtoms(comp)
+		if err != nil {
+			releaseAll(res)
+			return nil, err
+		}
+		res = append(res, c)
+	}
+	return res, nil
+}
@@ -0,0 +1,292 @@
+package remote
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/RxnWeaver/rxnweaver/data/molecule"
+)
+
+// ChEMBLURL is the base URL of the web services of ChEMBL.
+const ChEMBLURL = "https://www.ebi.ac.uk/chembl/api/data"
+
+// Requests to ChEMBL are spaced politely, though it publishes no limit.
+const chemblInterval = 100 * time.Millisecond
+
+// Value of the `source` attribute of molecules fetched from ChEMBL.
+const ChEMBLSource = "ChEMBL"
+
+// Names of the attributes set from the records of molecules in ChEMBL.
+// The InChIKey is held as by `store.PostgresStore`.
+const (
+	ChEMBLMaxPhaseAttribute = "chembl_max_phase"
+	ChEMBLInChIKeyAttribute = "inchikey"
+	ChEMBLActivityAttribute = "chembl_activity"
+)
+
+// Number of activities fetched by a single request.
+const chemblPageSize = 1000
+
+// ChEMBL is a client of the web services of ChEMBL, fetching molecules
+// and their bioactivities by their ChEMBL IDs.
+//
+// The preferred name of a molecule, if any, becomes its `name`
+// attribute, and its standard InChIKey and maximum phase of development
+// become its attributes `inchikey` and `chembl_max_phase`, along with
+// those of its source; see the package documentation.  Its ChEMBL ID
+// is its `source_id`.
+type ChEMBL struct {
+	BaseURL  string                     // `ChEMBLURL`, unless a mirror is used.
+	Client   *http.Client               // `http.DefaultClient`, if `nil`.
+	Registry *molecule.MoleculeRegistry // Molecules are passive, if `nil`.
+	Sanitize molecule.SanitizeOptions   // Stages of sanitisation skipped.
+
+	throttle _Throttle
+}
+
+// NewChEMBL answers a client of ChEMBL, with the default settings.
+func NewChEMBL() *ChEMBL {
+	return &ChEMBL{BaseURL: ChEMBLURL, throttle: _Throttle{interval: chemblInterval}}
+}
+
+// Activity is a bioactivity of a molecule recorded in ChEMBL, with its
+// standardised value.
+type Activity struct {
+	Id         int
+	Assay      string // ChEMBL ID of the assay.
+	Target     string // ChEMBL ID of the target.
+	TargetName string
+	Organism   string // Of the target.
+	Type       string // E.g. `IC50`, `Ki`.
+	Relation   string // E.g. `=`, `<`; empty if there is no value.
+	Value      float64
+	Units      string
+	PChEMBL    float64 // Negative logarithm of the molar value; `0` if none.
+}
+
+// HasValue answers if this activity has a value, rather than only a
+// comment, as some records have.
+func (a Activity) HasValue() bool {
+	return a.Relation != ""
+}
+
+// String answers the form in which this activity is attached to
+// molecules: its target, type, relation, value, units, pChEMBL value
+// and assay, separated by tabs.  Values absent are empty.
+func (a Activity) String() string {
+	value, pchembl := "", ""
+	if a.HasValue() {
+		value = strconv.FormatFloat(a.Value, 'g', -1, 64)
+	}
+	if a.PChEMBL != 0 {
+		pchembl = strconv.FormatFloat(a.PChEMBL, 'f', 2, 64)
+	}
+	return strings.Join([]string{a.Target, a.Type, a.Relation, value, a.Units, pchembl, a.Assay}, "\t")
+}
+
+// ActivityQuery narrows the activities fetched.  Its zero value fetches
+// all those of a molecule.
+type ActivityQuery struct {
+	Target   string   // ChEMBL ID of the target; any, if empty.
+	Types    []string // Of activity; any, if empty.
+	PChEMBL  bool     // Only those with pChEMBL values.
+	MaxCount int      // Most fetched; all, if non-positive.
+}
+
+// Molecule answers the molecule with the given ChEMBL ID, or
+// `ErrNotFound`.  Molecules without structures, such as biologics, are
+// answered as errors.
+func (c *ChEMBL) Molecule(ctx context.Context, id string) (*molecule.Molecule, error) {
+	addr := c.base() + "/molecule/" + url.PathEscape(id) + ".json"
+	rec := struct {
+		ChEMBLId   string      `json:"molecule_chembl_id"`
+		PrefName   string      `json:"pref_name"`
+		MaxPhase   json.Number `json:"max_phase"`
+		Structures *struct {
+			Molfile  string `json:"molfile"`
+			InChIKey string `json:"standard_inchi_key"`
+		} `json:"molecule_structures"`
+	}{}
+	if err := c.get(ctx, addr, &rec); err != nil {
+		return nil, err
+	}
+	if rec.Structures == nil || rec.Structures.Molfile == "" {
+		return nil, fmt.Errorf("ChEMBL : molecule %s has no structure.", id)
+	}
+
+	mols, err := readSDF([]byte(rec.Structures.Molfile), addr, ChEMBLSource, "", c.Registry, c.Sanitize)
+	if err != nil {
+		return nil, err
+	}
+	if len(mols) != 1 {
+		for _, mol := range mols {
+			mol.Release()
+		}
+		return nil, fmt.Errorf("ChEMBL : molecule %s : %d structures", id, len(mols))
+	}
+
+	mol := mols[0]
+	for _, attr := range []molecule.Attribute{
+		{Name: "name", Value: rec.PrefName},
+		{Name: ChEMBLInChIKeyAttribute, Value: rec.Structures.InChIKey},
+		{Name: ChEMBLMaxPhaseAttribute, Value: rec.MaxPhase.String()},
+		{Name: SourceIdAttribute, Value: rec.ChEMBLId},
+	} {
+		if attr.Value == "" {
+			continue
+		}
+		if err := mol.SetAttribute(attr.Name, attr.Value); err != nil {
+			mol.Release()
+			return nil, err
+		}
+	}
+	return mol, nil
+}
+
+// Activities answers the activities of the molecule with the given
+// ChEMBL ID that match the given query, in the order of their IDs.
+func (c *ChEMBL) Activities(ctx context.Context, id string, q ActivityQuery) ([]Activity, error) {
+	params := url.Values{
+		"molecule_chembl_id": {id},
+		"order_by":           {"activity_id"},
+	}
+	if q.Target != "" {
+		params.Set("target_chembl_id", q.Target)
+	}
+	if len(q.Types) > 0 {
+		params.Set("standard_type__in", strings.Join(q.Types, ","))
+	}
+	if q.PChEMBL {
+		params.Set("pchembl_value__isnull", "false")
+	}
+
+	res := []Activity(nil)
+	for {
+		limit := chemblPageSize
+		if q.MaxCount > 0 && q.MaxCount-len(res) < limit {
+			limit = q.MaxCount - len(res)
+		}
+		params.Set("limit", strconv.Itoa(limit))
+		params.Set("offset", strconv.Itoa(len(res)))
+
+		page := struct {
+			Activities []struct {
+				Id         int         `json:"activity_id"`
+				Assay      string      `json:"assay_chembl_id"`
+				Target     string      `json:"target_chembl_id"`
+				TargetName string      `json:"target_pref_name"`
+				Organism   string      `json:"target_organism"`
+				Type       string      `json:"standard_type"`
+				Relation   string      `json:"standard_relation"`
+				Value      json.Number `json:"standard_value"`
+				Units      string      `json:"standard_units"`
+				PChEMBL    json.Number `json:"pchembl_value"`
+			} `json:"activities"`
+			Meta struct {
+				TotalCount int `json:"total_count"`
+			} `json:"page_meta"`
+		}{}
+		if err := c.get(ctx, c.base()+"/activity.json?"+params.Encode(), &page); err != nil {
+			return nil, err
+		}
+
+		for _, ra := range page.Activities {
+			a := Activity{
+				Id:         ra.Id,
+				Assay:      ra.Assay,
+				Target:     ra.Target,
+				TargetName: ra.TargetName,
+				Organism:   ra.Organism,
+				Type:       ra.Type,
+				Units:      ra.Units,
+			}
+			if v, err := ra.Value.Float64(); err == nil {
+				a.Relation, a.Value = ra.Relation, v
+			}
+			if v, err := ra.PChEMBL.Float64(); err == nil {
+				a.PChEMBL = v
+			}
+			res = append(res, a)
+		}
+
+		if len(page.Activities) == 0 || len(res) >= page.Meta.TotalCount ||
+			(q.MaxCount > 0 && len(res) >= q.MaxCount) {
+			return res, nil
+		}
+	}
+}
+
+// AttachActivities adds the given activities to the given molecule, as
+// attributes named `chembl_activity`, one per activity, whose values
+// are as answered by `Activity.String`.  Activities attached earlier
+// are retained.
+func AttachActivities(mol *molecule.Molecule, acts []Activity) error {
+	for _, a := range acts {
+		if err := mol.AddTag(molecule.Attribute{Name: ChEMBLActivityAttribute, Value: a.String()}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// MoleculeWithActivities answers the molecule with the given ChEMBL ID,
+// with its activities matching the given query attached.  See
+// `AttachActivities`.
+func (c *ChEMBL) MoleculeWithActivities(ctx context.Context, id string, q ActivityQuery) (*molecule.Molecule, error) {
+	acts, err := c.Activities(ctx, id, q)
+	if err != nil {
+		return nil, err
+	}
+	mol, err := c.Molecule(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := AttachActivities(mol, acts); err != nil {
+		mol.Release()
+		return nil, err
+	}
+	return mol, nil
+}
+
+// base answers the base URL of this client.
+func (c *ChEMBL) base() string {
+	if c.BaseURL == "" {
+		return ChEMBLURL
+	}
+	return c.BaseURL
+}
+
+// get decodes the JSON answered for the given URL into the given
+// value.  ChEMBL explains its failures as follows, and answers `404 Not
+// Found` for unknown IDs.
+//
+//	{"error_message": "..."}
+func (c *ChEMBL) get(ctx context.Context, addr string, v interface{}) error {
+	body, err := fetch(ctx, c.Client, &c.throttle, addr, nil, "application/json")
+	if se, ok := err.(*_HTTPStatusError); ok {
+		if se.status == http.StatusNotFound {
+			return ErrNotFound
+		}
+		fault := struct {
+			Message string `json:"error_message"`
+		}{}
+		if json.Unmarshal(body, &fault) == nil {
+			se.msg = fault.Message
+		}
+		return fmt.Errorf("ChEMBL : %v", se)
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := json.Unmarshal(body, v); err != nil {
+		return fmt.Errorf("ChEMBL : %s : %v", addr, err)
+	}
+	return nil
+}
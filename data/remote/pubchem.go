@@ -0,0 +1,169 @@
+package remote
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/RxnWeaver/rxnweaver/data/molecule"
+)
+
+// PubChemURL is the base URL of the PUG-REST API of PubChem.
+const PubChemURL = "https://pubchem.ncbi.nlm.nih.gov/rest/pug"
+
+// PubChem asks for no more than five requests a second.
+const pubChemInterval = 200 * time.Millisecond
+
+// Value of the `source` attribute of molecules fetched from PubChem.
+const PubChemSource = "PubChem"
+
+// Data field of PubChem's SD records holding the CID of a compound.
+const pubChemCIDField = "PUBCHEM_COMPOUND_CID"
+
+// MaxCIDsPerRequest is the most compounds fetched by a single request.
+// Longer lists are fetched in several.
+const MaxCIDsPerRequest = 100
+
+// PubChem is a client of the PUG-REST API of PubChem, fetching
+// compounds as molecules.
+//
+// Compounds are fetched as SD records, whose data fields, such as
+// `PUBCHEM_IUPAC_INCHIKEY` and `PUBCHEM_IUPAC_NAME`, become attributes
+// of the molecules, along with those of their source; see the package
+// documentation.  The CID of a compound is its `source_id`.
+type PubChem struct {
+	BaseURL  string                     // `PubChemURL`, unless a mirror is used.
+	Client   *http.Client               // `http.DefaultClient`, if `nil`.
+	Registry *molecule.MoleculeRegistry // Molecules are passive, if `nil`.
+	Sanitize molecule.SanitizeOptions   // Stages of sanitisation skipped.
+	ThreeD   bool                       // Fetch 3D conformers, rather than 2D depictions.
+
+	throttle _Throttle
+}
+
+// NewPubChem answers a client of PubChem, with the default settings.
+func NewPubChem() *PubChem {
+	return &PubChem{BaseURL: PubChemURL, throttle: _Throttle{interval: pubChemInterval}}
+}
+
+// ByCID answers the compound with the given CID, or `ErrNotFound`.
+func (p *PubChem) ByCID(ctx context.Context, cid int) (*molecule.Molecule, error) {
+	mols, err := p.ByCIDs(ctx, []int{cid})
+	if err != nil {
+		return nil, err
+	}
+	return mols[0], nil
+}
+
+// ByCIDs answers the compounds with the given CIDs, in the order of
+// PubChem's answer, which is usually that of the CIDs.  CIDs not known
+// to PubChem are skipped, unless none is known, when `ErrNotFound` is
+// answered.
+func (p *PubChem) ByCIDs(ctx context.Context, cids []int) ([]*molecule.Molecule, error) {
+	res := []*molecule.Molecule(nil)
+	for len(cids) > 0 {
+		n := len(cids)
+		if n > MaxCIDsPerRequest {
+			n = MaxCIDsPerRequest
+		}
+
+		ids := make([]string, n)
+		for i, cid := range cids[:n] {
+			ids[i] = strconv.Itoa(cid)
+		}
+		mols, err := p.compounds(ctx, "cid", url.Values{"cid": {strings.Join(ids, ",")}})
+		if err != nil && err != ErrNotFound {
+			for _, mol := range res {
+				mol.Release()
+			}
+			return nil, err
+		}
+
+		res = append(res, mols...)
+		cids = cids[n:]
+	}
+
+	if len(res) == 0 {
+		return nil, ErrNotFound
+	}
+	return res, nil
+}
+
+// ByName answers the compounds having the given name or synonym, or
+// `ErrNotFound`.  Several compounds can share a name, such as the
+// isomers of a compound named without its stereo.
+func (p *PubChem) ByName(ctx context.Context, name string) ([]*molecule.Molecule, error) {
+	return p.compounds(ctx, "name", url.Values{"name": {name}})
+}
+
+// ByInChIKey answers the compounds having the given InChIKey, or
+// `ErrNotFound`.
+func (p *PubChem) ByInChIKey(ctx context.Context, key string) ([]*molecule.Molecule, error) {
+	return p.compounds(ctx, "inchikey", url.Values{"inchikey": {key}})
+}
+
+// compounds answers the compounds identified by the given form, in the
+// given namespace of PubChem.  Identifiers are POSTed, rather than
+// given in the path, since names can hold characters, such as `/`,
+// that can not be escaped in paths.
+func (p *PubChem) compounds(ctx context.Context, ns string, form url.Values) ([]*molecule.Molecule, error) {
+	base := p.BaseURL
+	if base == "" {
+		base = PubChemURL
+	}
+	addr := base + "/compound/" + ns + "/SDF"
+	if p.ThreeD {
+		addr += "?record_type=3d"
+	}
+
+	body, err := fetch(ctx, p.Client, &p.throttle, addr, form, "chemical/x-mdl-sdfile")
+	if err != nil {
+		return nil, pubChemError(body, err)
+	}
+
+	// The URL recorded identifies the compounds, as the form would.
+	src := base + "/compound/" + ns + "/" + url.PathEscape(form.Get(ns)) + "/SDF"
+	mols, err := readSDF(body, src, PubChemSource, pubChemCIDField, p.Registry, p.Sanitize)
+	if err != nil {
+		return nil, err
+	}
+	if len(mols) == 0 {
+		return nil, ErrNotFound
+	}
+	return mols, nil
+}
+
+// pubChemError answers the error of the given failed request, whose
+// response had the given body.  PubChem explains its failures by JSON
+// faults, as follows, and answers `404 Not Found` when nothing matches.
+//
+//	{"Fault": {"Code": "PUGREST.NotFound", "Message": "No CID found"}}
+func pubChemError(body []byte, err error) error {
+	se, ok := err.(*_HTTPStatusError)
+	if !ok {
+		return err
+	}
+	if se.status == http.StatusNotFound {
+		return ErrNotFound
+	}
+
+	fault := struct {
+		Fault struct {
+			Code    string
+			Message string
+			Details []string
+		}
+	}{}
+	if json.Unmarshal(body, &fault) == nil && fault.Fault.Message != "" {
+		se.msg = fault.Fault.Message
+		if len(fault.Fault.Details) > 0 {
+			se.msg += " (" + strings.Join(fault.Fault.Details, "; ") + ")"
+		}
+	}
+	return fmt.Errorf("PubChem : %v", se)
+}
@@ -0,0 +1,198 @@
+// Package remote fetches molecules from public chemical databases,
+// over their HTTP APIs, so that datasets can be assembled without
+// downloading and converting files by hand.
+//
+// Molecules are read from the structures the services answer, and
+// sanitised, as those read from files are.  Each is annotated with the
+// attributes `source`, `source_id` and `source_url`, naming the
+// service, the identifier of the molecule in it, and the URL it was
+// fetched from.  The URL and the one-based number of the molecule in
+// the response are also recorded as its source in its provenance.
+//
+// Clients are safe for concurrent use.  The services limit the rates of
+// requests, which clients respect by spacing their requests.
+package remote
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/RxnWeaver/rxnweaver/data/loader"
+	"github.com/RxnWeaver/rxnweaver/data/molecule"
+)
+
+// Names of the attributes recording where a molecule was fetched from.
+const (
+	SourceAttribute    = "source"
+	SourceIdAttribute  = "source_id"
+	SourceURLAttribute = "source_url"
+)
+
+// ErrNotFound is answered when a service has no record of what was
+// asked for.
+var ErrNotFound = errors.New("Not found.")
+
+// MaxResponseSize is the largest response read, in bytes.
+const MaxResponseSize = 64 << 20
+
+// userAgent identifies clients to the services, as they ask.
+const userAgent = "RxnWeaver (https://github.com/RxnWeaver/rxnweaver)"
+
+// _Throttle spaces the requests made through it by at least a given
+// interval.  The zero value does not throttle.
+type _Throttle struct {
+	interval time.Duration
+
+	mu   sync.Mutex
+	next time.Time // Earliest time of the next request.
+}
+
+// wait blocks until a request may be made, or the given context is
+// done.
+func (t *_Throttle) wait(ctx context.Context) error {
+	t.mu.Lock()
+	now := time.Now()
+	at := t.next
+	if at.Before(now) {
+		at = now
+	}
+	t.next = at.Add(t.interval)
+	t.mu.Unlock()
+
+	d := at.Sub(now)
+	if d <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// _HTTPStatusError is the error of a response with an unexpected
+// status, along with the service's explanation, if any.
+type _HTTPStatusError struct {
+	url    string
+	status int
+	msg    string
+}
+
+func (e *_HTTPStatusError) Error() string {
+	if e.msg == "" {
+		return fmt.Sprintf("%s : %d %s", e.url, e.status, http.StatusText(e.status))
+	}
+	return fmt.Sprintf("%s : %d %s : %s", e.url, e.status, http.StatusText(e.status), e.msg)
+}
+
+// fetch answers the body of the response to a request of the given
+// URL, accepting the given media type, with the given client, or the
+// default client, if `nil`.  The request is a GET, unless a form is
+// given, which is POSTed.  A response with any status other than
+// `200 OK` is answered as a `*_HTTPStatusError`, along with its body.
+func fetch(ctx context.Context, client *http.Client, t *_Throttle, addr string, form url.Values, accept string) ([]byte, error) {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	if err := t.wait(ctx); err != nil {
+		return nil, err
+	}
+
+	method, body := http.MethodGet, io.Reader(nil)
+	if form != nil {
+		method, body = http.MethodPost, strings.NewReader(form.Encode())
+	}
+	req, err := http.NewRequestWithContext(ctx, method, addr, body)
+	if err != nil {
+		return nil, err
+	}
+	if form != nil {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+	req.Header.Set("Accept", accept)
+	req.Header.Set("User-Agent", userAgent)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	res, err := io.ReadAll(io.LimitReader(resp.Body, MaxResponseSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("%s : %v", addr, err)
+	}
+	if len(res) > MaxResponseSize {
+		return nil, fmt.Errorf("%s : response larger than %d bytes", addr, MaxResponseSize)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return res, &_HTTPStatusError{url: addr, status: resp.StatusCode}
+	}
+	return res, nil
+}
+
+// readSDF answers the sanitised molecules of the given SD file,
+// fetched from the given URL, in the given registry, or passive, if
+// `nil`.  Each is annotated with its source, and the identifier held
+// in its data field of the given name.
+func readSDF(sdf []byte, addr, source, idField string, reg *molecule.MoleculeRegistry, opts molecule.SanitizeOptions) ([]*molecule.Molecule, error) {
+	parse := loader.Sanitized(loader.MolfileParser(reg), opts)
+	sc := bufio.NewScanner(bytes.NewReader(sdf))
+	sc.Buffer(make([]byte, 0, 4096), loader.MaxRecordSize)
+	sc.Split(loader.SplitSDF)
+
+	res := []*molecule.Molecule(nil)
+	fail := func(err error) ([]*molecule.Molecule, error) {
+		for _, mol := range res {
+			mol.Release()
+		}
+		return nil, err
+	}
+
+	for sc.Scan() {
+		mol, err := parse(sc.Bytes())
+		if err != nil {
+			if mol != nil {
+				mol.Release()
+			}
+			return fail(fmt.Errorf("%s : record %d : %v", addr, len(res)+1, err))
+		}
+		res = append(res, mol)
+
+		id, _ := mol.AttributeString(idField)
+		if err := annotate(mol, source, id, addr, len(res)); err != nil {
+			return fail(err)
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return fail(fmt.Errorf("%s : %v", addr, err))
+	}
+	return res, nil
+}
+
+// annotate sets the attributes recording the source of the given
+// molecule, and records its source in its provenance.
+func annotate(mol *molecule.Molecule, source, id, addr string, record int) error {
+	for _, attr := range []molecule.Attribute{
+		{Name: SourceAttribute, Value: source},
+		{Name: SourceIdAttribute, Value: id},
+		{Name: SourceURLAttribute, Value: addr},
+	} {
+		if err := mol.SetAttribute(attr.Name, attr.Value); err != nil {
+			return err
+		}
+	}
+	return mol.SetSource(molecule.SourceInfo{File: addr, Record: record})
+}
@@ -0,0 +1,129 @@
+package render
+
+import (
+	"fmt"
+	"image/color"
+	"math"
+)
+
+// Highlight is a set of atoms and bonds, such as a substructure match
+// or a reaction centre, to be drawn with halos of a colour.
+//
+// When no bonds are given, the bonds between the atoms given are
+// highlighted.
+type Highlight struct {
+	Atoms []uint16    // Input IDs of atoms.
+	Bonds []uint16    // IDs of bonds.
+	Color color.Color // `nil` means the next of `HighlightColors`.
+}
+
+// HighlightColors are the colours of highlights not given any, used
+// in turn.  They are light enough for the molecule to remain legible
+// over them.
+var HighlightColors = []color.Color{
+	color.NRGBA{0xff, 0xd7, 0x80, 0xff},
+	color.NRGBA{0xa8, 0xd8, 0xff, 0xff},
+	color.NRGBA{0xb8, 0xf0, 0xb0, 0xff},
+	color.NRGBA{0xff, 0xb8, 0xd0, 0xff},
+	color.NRGBA{0xd8, 0xc0, 0xff, 0xff},
+}
+
+// Proportions of halos, as fractions of the bond length in pixels.
+const (
+	atomHaloRatio = 0.3  // Radius around atoms.
+	bondHaloRatio = 0.15 // Half-width along bonds.
+)
+
+// highlightColor answers the colour of the given highlight, which is
+// the `i`th one.
+func highlightColor(h Highlight, i int) color.NRGBA {
+	c := h.Color
+	if c == nil {
+		c = HighlightColors[i%len(HighlightColors)]
+	}
+	return color.NRGBAModel.Convert(c).(color.NRGBA)
+}
+
+// checkHighlights answers an error if any highlight refers to atoms
+// or bonds not drawn.
+func (d *_Depiction) checkHighlights() error {
+	for _, h := range d.opts.Highlights {
+		for _, iid := range h.Atoms {
+			if _, ok := d.index[iid]; !ok {
+				return fmt.Errorf("Atom %d to highlight is not drawn.", iid)
+			}
+		}
+		for _, id := range h.Bonds {
+			if _, ok := d.bondIndex[id]; !ok {
+				return fmt.Errorf("Bond %d to highlight is not drawn.", id)
+			}
+		}
+	}
+	return nil
+}
+
+// halo answers the shape of the halo of the given highlight.  It is a
+// single shape, so that its parts are painted once where they overlap,
+// even in translucent colours.
+func (d *_Depiction) halo(h Highlight) _Shape {
+	var u _Union
+	in := make(map[uint16]bool, len(h.Atoms))
+	for _, iid := range h.Atoms {
+		in[iid] = true
+		u.add(_Disc{d.atoms[d.index[iid]].pos, atomHaloRatio * d.bondPx})
+	}
+
+	bonds := h.Bonds
+	if len(bonds) == 0 {
+		for _, b := range d.bonds {
+			if in[b.A1] && in[b.A2] {
+				bonds = append(bonds, b.Id)
+			}
+		}
+	}
+	for _, id := range bonds {
+		b := d.bonds[d.bondIndex[id]]
+		p, q := d.atoms[d.index[b.A1]].pos, d.atoms[d.index[b.A2]].pos
+		u.add(_Segment{p, q, bondHaloRatio * d.bondPx})
+	}
+	return &u
+}
+
+// _Union is the union of several shapes.
+type _Union struct {
+	shapes []_Shape
+	los    []_Vec // Bounds of the shapes.
+	his    []_Vec
+}
+
+// add includes the given shape in this union.
+func (u *_Union) add(s _Shape) {
+	lo, hi := s.bounds()
+	u.shapes = append(u.shapes, s)
+	u.los = append(u.los, lo)
+	u.his = append(u.his, hi)
+}
+
+func (u *_Union) bounds() (_Vec, _Vec) {
+	if len(u.shapes) == 0 {
+		return _Vec{}, _Vec{}
+	}
+	lo, hi := u.los[0], u.his[0]
+	for i := range u.shapes {
+		lo = _Vec{math.Min(lo.x, u.los[i].x), math.Min(lo.y, u.los[i].y)}
+		hi = _Vec{math.Max(hi.x, u.his[i].x), math.Max(hi.y, u.his[i].y)}
+	}
+	return lo, hi
+}
+
+func (u *_Union) contains(p _Vec) bool {
+	for i, s := range u.shapes {
+		if p.x < u.los[i].x || p.y < u.los[i].y || p.x > u.his[i].x || p.y > u.his[i].y {
+			continue
+		}
+		if s.contains(p) {
+			return true
+		}
+	}
+	return false
+}
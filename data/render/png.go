@@ -0,0 +1,63 @@
+package render
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"image/png"
+	"io"
+	"math"
+
+	"github.com/RxnWeaver/rxnweaver/data/molecule"
+)
+
+// WritePNG writes a depiction of the given molecule to the given
+// writer, as a PNG image.  See `Draw`.
+//
+// The resolution of the options is recorded in the image, so that
+// programs placing it in documents print it at its intended size.
+func WritePNG(w io.Writer, mol *molecule.Molecule, opts Options) error {
+	img, err := Draw(mol, opts)
+	if err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return err
+	}
+
+	dpi := opts.DPI
+	if dpi <= 0 {
+		dpi = DefaultDPI
+	}
+	if opts.Scale > 0 {
+		dpi *= opts.Scale
+	}
+	return writeWithResolution(w, buf.Bytes(), dpi)
+}
+
+// pngHeaderSize is the length of the PNG signature and the `IHDR`
+// chunk, which always come first.
+const pngHeaderSize = 8 + 4 + 4 + 13 + 4
+
+// writeWithResolution writes the given encoded PNG image, with a `pHYs`
+// chunk recording the given resolution inserted after its header.
+func writeWithResolution(w io.Writer, img []byte, dpi float64) error {
+	ppm := uint32(math.Round(dpi / 0.0254)) // Pixels per metre.
+
+	chunk := make([]byte, 4+4+9+4)
+	binary.BigEndian.PutUint32(chunk[0:], 9)
+	copy(chunk[4:], "pHYs")
+	binary.BigEndian.PutUint32(chunk[8:], ppm)
+	binary.BigEndian.PutUint32(chunk[12:], ppm)
+	chunk[16] = 1 // The unit is the metre.
+	binary.BigEndian.PutUint32(chunk[17:], crc32.ChecksumIEEE(chunk[4:17]))
+
+	for _, b := range [][]byte{img[:pngHeaderSize], chunk, img[pngHeaderSize:]} {
+		if _, err := w.Write(b); err != nil {
+			return err
+		}
+	}
+	return nil
+}
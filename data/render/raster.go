@@ -0,0 +1,197 @@
+package render
+
+import (
+	"image"
+	"image/color"
+	"math"
+)
+
+// _Vec is a point, or a displacement, in the plane of the canvas.
+// Its `y` increases downwards.
+type _Vec struct {
+	x, y float64
+}
+
+func (v _Vec) add(w _Vec) _Vec {
+	return _Vec{v.x + w.x, v.y + w.y}
+}
+
+func (v _Vec) sub(w _Vec) _Vec {
+	return _Vec{v.x - w.x, v.y - w.y}
+}
+
+func (v _Vec) scale(f float64) _Vec {
+	return _Vec{v.x * f, v.y * f}
+}
+
+func (v _Vec) length() float64 {
+	return math.Hypot(v.x, v.y)
+}
+
+// unit answers the unit vector along this vector, or the null vector
+// if this is null.
+func (v _Vec) unit() _Vec {
+	l := v.length()
+	if l == 0 {
+		return v
+	}
+	return v.scale(1 / l)
+}
+
+// perp answers this vector rotated by a right angle.
+func (v _Vec) perp() _Vec {
+	return _Vec{-v.y, v.x}
+}
+
+// cross answers the z-component of the cross product of this vector
+// with the given one.
+func (v _Vec) cross(w _Vec) float64 {
+	return v.x*w.y - v.y*w.x
+}
+
+// _Shape is a region of the canvas that can be filled.
+type _Shape interface {
+	// bounds answers the bounding box of this shape, as its top-left
+	// and bottom-right corners.
+	bounds() (_Vec, _Vec)
+
+	// contains answers if the given point lies in this shape.
+	contains(p _Vec) bool
+}
+
+// _Segment is a line segment stroked with round caps; it is the set of
+// points within the given radius of the segment.
+type _Segment struct {
+	a, b _Vec
+	r    float64
+}
+
+func (s _Segment) bounds() (_Vec, _Vec) {
+	return _Vec{math.Min(s.a.x, s.b.x) - s.r, math.Min(s.a.y, s.b.y) - s.r},
+		_Vec{math.Max(s.a.x, s.b.x) + s.r, math.Max(s.a.y, s.b.y) + s.r}
+}
+
+func (s _Segment) contains(p _Vec) bool {
+	d := s.b.sub(s.a)
+	l2 := d.x*d.x + d.y*d.y
+	t := 0.0
+	if l2 > 0 {
+		t = ((p.x-s.a.x)*d.x + (p.y-s.a.y)*d.y) / l2
+		t = math.Max(0, math.Min(1, t))
+	}
+	return p.sub(s.a.add(d.scale(t))).length() <= s.r
+}
+
+// _Polygon is a convex polygon, with its vertices in either order.
+type _Polygon []_Vec
+
+func (pg _Polygon) bounds() (_Vec, _Vec) {
+	lo, hi := pg[0], pg[0]
+	for _, v := range pg[1:] {
+		lo = _Vec{math.Min(lo.x, v.x), math.Min(lo.y, v.y)}
+		hi = _Vec{math.Max(hi.x, v.x), math.Max(hi.y, v.y)}
+	}
+	return lo, hi
+}
+
+func (pg _Polygon) contains(p _Vec) bool {
+	pos, neg := false, false
+	for i, v := range pg {
+		w := pg[(i+1)%len(pg)]
+		c := w.sub(v).cross(p.sub(v))
+		pos = pos || c > 0
+		neg = neg || c < 0
+	}
+	return !(pos && neg)
+}
+
+// _Disc is a filled circle.
+type _Disc struct {
+	c _Vec
+	r float64
+}
+
+func (d _Disc) bounds() (_Vec, _Vec) {
+	return _Vec{d.c.x - d.r, d.c.y - d.r}, _Vec{d.c.x + d.r, d.c.y + d.r}
+}
+
+func (d _Disc) contains(p _Vec) bool {
+	return p.sub(d.c).length() <= d.r
+}
+
+// samplesPerSide is the number of samples taken along each side of a
+// pixel, to anti-alias the edges of shapes.
+const samplesPerSide = 4
+
+// _Canvas is an image onto which shapes are painted.
+type _Canvas struct {
+	img *image.RGBA
+}
+
+// newCanvas answers a canvas of the given size, filled with the given
+// colour.
+func newCanvas(w, h int, bg color.Color) *_Canvas {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	r, g, b, a := bg.RGBA()
+	px := color.RGBA{uint8(r >> 8), uint8(g >> 8), uint8(b >> 8), uint8(a >> 8)}
+	for i := 0; i < len(img.Pix); i += 4 {
+		img.Pix[i], img.Pix[i+1], img.Pix[i+2], img.Pix[i+3] = px.R, px.G, px.B, px.A
+	}
+	return &_Canvas{img}
+}
+
+// fill paints the given shape in the given colour.  Each pixel is
+// covered in proportion to the number of its samples that lie in the
+// shape.
+func (c *_Canvas) fill(s _Shape, col color.NRGBA) {
+	lo, hi := s.bounds()
+	b := c.img.Bounds()
+	x0 := maxInt(int(math.Floor(lo.x)), b.Min.X)
+	y0 := maxInt(int(math.Floor(lo.y)), b.Min.Y)
+	x1 := minInt(int(math.Ceil(hi.x)), b.Max.X)
+	y1 := minInt(int(math.Ceil(hi.y)), b.Max.Y)
+
+	const step = 1.0 / samplesPerSide
+	for y := y0; y < y1; y++ {
+		for x := x0; x < x1; x++ {
+			n := 0
+			for sy := 0; sy < samplesPerSide; sy++ {
+				for sx := 0; sx < samplesPerSide; sx++ {
+					p := _Vec{float64(x) + (float64(sx)+0.5)*step, float64(y) + (float64(sy)+0.5)*step}
+					if s.contains(p) {
+						n++
+					}
+				}
+			}
+			if n > 0 {
+				c.blend(x, y, col, float64(n)/(samplesPerSide*samplesPerSide))
+			}
+		}
+	}
+}
+
+// blend composites the given colour over the pixel at the given
+// position, with its opacity scaled by the given coverage.
+func (c *_Canvas) blend(x, y int, col color.NRGBA, cov float64) {
+	a := float64(col.A) / 255 * cov
+	i := c.img.PixOffset(x, y)
+	px := c.img.Pix[i : i+4 : i+4]
+	px[0] = uint8(float64(col.R)*a + float64(px[0])*(1-a) + 0.5)
+	px[1] = uint8(float64(col.G)*a + float64(px[1])*(1-a) + 0.5)
+	px[2] = uint8(float64(col.B)*a + float64(px[2])*(1-a) + 0.5)
+	px[3] = uint8(255*a + float64(px[3])*(1-a) + 0.5)
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
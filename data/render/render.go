@@ -0,0 +1,564 @@
+// Package render draws 2D depictions of molecules, from the 2D
+// coordinates of their atoms, and rasterises them to images.
+//
+// The package depends on the standard library alone.  Shapes are
+// anti-aliased by supersampling, and labels use a small built-in
+// bitmap font.  The aim is depictions good enough for reports and web
+// responses, not publication-quality artwork.
+package render
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+
+	cmn "github.com/RxnWeaver/rxnweaver/common"
+	"github.com/RxnWeaver/rxnweaver/data/molecule"
+)
+
+// Options control the size and appearance of depictions.  Lengths are
+// in points, i.e. 1/72 of an inch, and are converted to pixels at the
+// resolution given.  Zero values take the corresponding defaults.
+type Options struct {
+	Width, Height int         // Of the canvas, in pixels; fitted to the molecule if `0`.
+	DPI           float64     // Resolution; `0` means `DefaultDPI`.
+	BondLength    float64     // Of an average bond; `0` means `DefaultBondLength`.
+	Padding       float64     // Around the molecule; `0` means `DefaultPadding`.
+	Scale         float64     // Multiplies all lengths, including the canvas size; `0` means `1`.
+	Transparent   bool        // Leaves the background transparent.
+	Background    color.Color // Unless transparent; `nil` means white.
+	Highlights    []Highlight // Drawn in order, beneath the molecule.
+}
+
+// Defaults of depiction.
+const (
+	DefaultDPI        = 96.0
+	DefaultBondLength = 20.0 // Points.
+	DefaultPadding    = 10.0 // Points.
+)
+
+// Proportions of depictions, as fractions of the bond length in
+// pixels.
+const (
+	strokeWidthRatio = 0.06
+	bondSpacingRatio = 0.18 // Between the lines of multiple bonds.
+	bondTrimRatio    = 0.12 // Of inner lines of double bonds.
+	wedgeWidthRatio  = 0.25 // At the wide end.
+	arrowRatio       = 0.16 // Length of the heads of dative bonds.
+	fontHeightRatio  = 0.45 // Of capitals.
+	scriptRatio      = 0.7  // Of sub- and superscripts to capitals.
+)
+
+// _Atom is an atom placed on the canvas.
+type _Atom struct {
+	info   molecule.AtomInfo
+	pos    _Vec
+	nbrs   []int // Indices of drawn neighbours.
+	label  _Text
+	color  color.NRGBA
+	abbrev string // Label of the collapsed superatom it stands for.
+}
+
+// _Depiction is a molecule laid out on a canvas.
+type _Depiction struct {
+	atoms     []*_Atom
+	index     map[uint16]int // Atom input ID to index.
+	bonds     []molecule.BondInfo
+	bondIndex map[uint16]int // Bond ID to index.
+	repeats   []_Repeat      // Structural repeating units, in brackets.
+	bondPx    float64        // Average bond length, in pixels.
+	width     int
+	height    int
+	opts      Options
+}
+
+// Draw answers a depiction of the given molecule, drawn from the 2D
+// coordinates of its atoms, as an image.
+//
+// Carbon atoms are not labelled, unless they are charged, isotopic or
+// isolated.  Labels of other atoms include their implicit hydrogens.
+// Hydrogen atoms without neighbours are omitted, since they are
+// counted in the atoms bearing them; they are drawn only when the
+// molecule has no other atoms.
+//
+// Collapsed superatoms are drawn as their labels, in place of their
+// atoms, and structural repeating units in brackets, across their
+// crossing bonds, with their labels as subscripts; see
+// `molecule.Sgroup`.  Data Sgroups are not drawn.
+func Draw(mol *molecule.Molecule, opts Options) (*image.RGBA, error) {
+	d, err := newDepiction(mol, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	bg := opts.Background
+	if bg == nil {
+		bg = color.White
+	}
+	if opts.Transparent {
+		bg = color.Transparent
+	}
+	c := newCanvas(d.width, d.height, bg)
+	d.draw(c)
+	return c.img, nil
+}
+
+// newDepiction collects the atoms and bonds of the given molecule, and
+// lays them out on a canvas per the given options.
+func newDepiction(mol *molecule.Molecule, opts Options) (*_Depiction, error) {
+	if opts.DPI <= 0 {
+		opts.DPI = DefaultDPI
+	}
+	if opts.BondLength <= 0 {
+		opts.BondLength = DefaultBondLength
+	}
+	if opts.Padding <= 0 {
+		opts.Padding = DefaultPadding
+	}
+	if opts.Scale <= 0 {
+		opts.Scale = 1
+	}
+
+	d := &_Depiction{index: make(map[uint16]int), bondIndex: make(map[uint16]int), opts: opts}
+	var all []molecule.AtomInfo
+	it := mol.Atoms()
+	for it.Next() {
+		all = append(all, it.Atom())
+	}
+	if err := it.Err(); err != nil {
+		return nil, err
+	}
+	sgs, err := mol.Sgroups()
+	if err != nil {
+		return nil, err
+	}
+	hidden, abbrevs := collapsedSgroups(all, sgs)
+
+	var hs []molecule.AtomInfo
+	for _, a := range all {
+		if _, ok := hidden[a.Iid]; ok {
+			continue
+		}
+		if a.AtomicNumber == 1 && len(a.Neighbours) == 0 {
+			hs = append(hs, a)
+			continue
+		}
+		d.index[a.Iid] = len(d.atoms)
+		at := &_Atom{info: a, color: elementColor(a.Symbol), abbrev: abbrevs[a.Iid]}
+		if at.abbrev != "" {
+			at.color = elementColor("")
+		}
+		d.atoms = append(d.atoms, at)
+	}
+	if len(d.atoms) == 0 {
+		for _, a := range hs {
+			d.index[a.Iid] = len(d.atoms)
+			d.atoms = append(d.atoms, &_Atom{info: a, color: elementColor(a.Symbol)})
+		}
+	}
+	if len(d.atoms) == 0 {
+		return nil, fmt.Errorf("Molecule %d has no atoms to draw.", mol.Id())
+	}
+	// The atoms of a collapsed superatom are drawn as one.
+	for iid, anchor := range hidden {
+		if i, ok := d.index[anchor]; ok {
+			d.index[iid] = i
+		}
+	}
+
+	bit := mol.Bonds()
+	for bit.Next() {
+		b := bit.Bond()
+		i, ok1 := d.index[b.A1]
+		j, ok2 := d.index[b.A2]
+		if !ok1 || !ok2 || i == j {
+			continue
+		}
+		d.bondIndex[b.Id] = len(d.bonds)
+		d.bonds = append(d.bonds, b)
+		d.atoms[i].nbrs = append(d.atoms[i].nbrs, j)
+		d.atoms[j].nbrs = append(d.atoms[j].nbrs, i)
+	}
+	if err := bit.Err(); err != nil {
+		return nil, err
+	}
+	d.repeats = d.repeatUnits(sgs)
+
+	if err := d.checkHighlights(); err != nil {
+		return nil, fmt.Errorf("Molecule %d : %v", mol.Id(), err)
+	}
+	if err := d.layOut(); err != nil {
+		return nil, fmt.Errorf("Molecule %d : %v", mol.Id(), err)
+	}
+	return d, nil
+}
+
+// layOut scales the coordinates of the atoms to pixels, sizes the
+// canvas, and places the labels.
+func (d *_Depiction) layOut() error {
+	lo := _Vec{math.Inf(1), math.Inf(1)}
+	hi := _Vec{math.Inf(-1), math.Inf(-1)}
+	for _, a := range d.atoms {
+		p := _Vec{float64(a.info.X), -float64(a.info.Y)}
+		lo = _Vec{math.Min(lo.x, p.x), math.Min(lo.y, p.y)}
+		hi = _Vec{math.Max(hi.x, p.x), math.Max(hi.y, p.y)}
+		a.pos = p
+	}
+	ext := hi.sub(lo)
+	if len(d.atoms) > 1 && ext.x == 0 && ext.y == 0 {
+		return fmt.Errorf("Atoms have no 2D coordinates.")
+	}
+
+	// The average bond length, in the units of the coordinates.
+	avg := 0.0
+	for _, b := range d.bonds {
+		avg += d.atoms[d.index[b.A1]].pos.sub(d.atoms[d.index[b.A2]].pos).length()
+	}
+	if len(d.bonds) > 0 && avg > 0 {
+		avg /= float64(len(d.bonds))
+	} else {
+		avg = math.Max(ext.x, ext.y)
+		if avg == 0 {
+			avg = 1
+		}
+	}
+
+	px := d.opts.DPI / 72 * d.opts.Scale
+	bondPx := d.opts.BondLength * px
+	pad := d.opts.Padding * px
+
+	// A canvas of given size shrinks the molecule to fit, but never
+	// enlarges it.
+	s := bondPx / avg
+	if d.opts.Width > 0 && ext.x > 0 {
+		s = math.Min(s, (float64(d.opts.Width)*d.opts.Scale-2*pad)/ext.x)
+	}
+	if d.opts.Height > 0 && ext.y > 0 {
+		s = math.Min(s, (float64(d.opts.Height)*d.opts.Scale-2*pad)/ext.y)
+	}
+	if s <= 0 {
+		return fmt.Errorf("Canvas of %dx%d pixels is too small.", d.opts.Width, d.opts.Height)
+	}
+	d.bondPx = s * avg
+
+	for _, a := range d.atoms {
+		a.pos = a.pos.scale(s)
+		a.label = d.label(a)
+	}
+
+	// The canvas fits the molecule with its labels, unless its size is
+	// given, and the molecule is centred on it.
+	lo, hi = d.atoms[0].pos, d.atoms[0].pos
+	for _, a := range d.atoms {
+		lo = _Vec{math.Min(lo.x, a.pos.x), math.Min(lo.y, a.pos.y)}
+		hi = _Vec{math.Max(hi.x, a.pos.x), math.Max(hi.y, a.pos.y)}
+		if a.label != nil {
+			l, h := a.label.bounds()
+			lo = _Vec{math.Min(lo.x, l.x), math.Min(lo.y, l.y)}
+			hi = _Vec{math.Max(hi.x, h.x), math.Max(hi.y, h.y)}
+		}
+	}
+	d.width = int(math.Ceil(hi.x - lo.x + 2*pad))
+	if d.opts.Width > 0 {
+		d.width = int(math.Round(float64(d.opts.Width) * d.opts.Scale))
+	}
+	d.height = int(math.Ceil(hi.y - lo.y + 2*pad))
+	if d.opts.Height > 0 {
+		d.height = int(math.Round(float64(d.opts.Height) * d.opts.Scale))
+	}
+
+	off := _Vec{float64(d.width), float64(d.height)}.scale(0.5).sub(lo.add(hi).scale(0.5))
+	for _, a := range d.atoms {
+		a.pos = a.pos.add(off)
+		for i := range a.label {
+			a.label[i].pos = a.label[i].pos.add(off)
+		}
+	}
+	return nil
+}
+
+// label answers the label of the given atom, placed on the canvas, or
+// `nil` if it is not labelled.  The first letter of its symbol is
+// centred on the atom.  Hydrogens follow the symbol, or precede it if
+// the atom's bonds lie mostly to its right.  The isotope precedes all,
+// and the charge follows all, as superscripts.  `R` atoms are labelled
+// with the numbers of their R-groups, as `R1`.
+func (d *_Depiction) label(a *_Atom) _Text {
+	if a.abbrev != "" {
+		return d.abbreviation(a)
+	}
+	ai := a.info
+	if ai.Symbol == "C" && ai.Charge == 0 && ai.Isotope == 0 && len(a.nbrs) > 0 {
+		return nil
+	}
+
+	capH := fontHeightRatio * d.bondPx
+	cell := capH / glyphHeight
+	scriptCell := cell * scriptRatio
+	top := -capH / 2
+	supTop := top - 0.35*capH
+	subTop := capH/2 + 0.35*capH - glyphHeight*scriptCell
+
+	var t _Text
+	x := 0.0
+	put := func(s string, y, c float64) {
+		for _, r := range s {
+			t = append(t, _Glyph{r, _Vec{x, y}, c})
+			x += glyphAdvance * c
+		}
+	}
+	putH := func() {
+		if ai.HCount == 0 {
+			return
+		}
+		put("H", top, cell)
+		if ai.HCount > 1 {
+			put(fmt.Sprint(ai.HCount), subTop, scriptCell)
+		}
+	}
+
+	hLeft := false
+	if ai.HCount > 0 {
+		dx := 0.0
+		for _, j := range a.nbrs {
+			dx += d.atoms[j].pos.x - a.pos.x
+		}
+		hLeft = dx > 0.1*d.bondPx
+	}
+
+	if ai.Isotope != 0 {
+		put(fmt.Sprint(ai.Isotope), supTop, scriptCell)
+	}
+	if hLeft {
+		putH()
+	}
+	anchor := x + glyphWidth*cell/2
+	if ai.RGroup != 0 {
+		put(fmt.Sprintf("R%d", ai.RGroup), top, cell)
+	} else {
+		put(ai.Symbol, top, cell)
+	}
+	if !hLeft {
+		putH()
+	}
+	if ai.Charge != 0 {
+		sign := "+"
+		if ai.Charge < 0 {
+			sign = "-"
+		}
+		n, q := "", int(ai.Charge)
+		if q < 0 {
+			q = -q
+		}
+		if q > 1 {
+			n = fmt.Sprint(q)
+		}
+		put(n+sign, supTop, scriptCell)
+	}
+
+	off := _Vec{a.pos.x - anchor, a.pos.y}
+	for i := range t {
+		t[i].pos = t[i].pos.add(off)
+	}
+	return t
+}
+
+// draw paints the depiction on the given canvas.
+func (d *_Depiction) draw(c *_Canvas) {
+	for i, h := range d.opts.Highlights {
+		c.fill(d.halo(h), highlightColor(h, i))
+	}
+	for _, b := range d.bonds {
+		d.drawBond(c, b)
+	}
+	for _, r := range d.repeats {
+		d.drawRepeat(c, r)
+	}
+	for _, a := range d.atoms {
+		if a.label != nil {
+			c.fill(a.label, a.color)
+		}
+	}
+}
+
+// ends answers the end points of the given bond, trimmed short of the
+// labels of its atoms.
+func (d *_Depiction) ends(b molecule.BondInfo) (_Vec, _Vec) {
+	a1, a2 := d.atoms[d.index[b.A1]], d.atoms[d.index[b.A2]]
+	p, q := a1.pos, a2.pos
+	u := q.sub(p).unit()
+	gap := 0.7 * fontHeightRatio * d.bondPx
+	if a1.label != nil {
+		p = p.add(u.scale(gap))
+	}
+	if a2.label != nil {
+		q = q.sub(u.scale(gap))
+	}
+	return p, q
+}
+
+// side answers the side of the given bond on which the second line of
+// a double bond goes: `+1` or `-1` along the bond's perpendicular, or
+// `0` for a line on either side.  That is the side having more of the
+// other neighbours of its atoms.
+func (d *_Depiction) side(b molecule.BondInfo) int {
+	i, j := d.index[b.A1], d.index[b.A2]
+	p, q := d.atoms[i].pos, d.atoms[j].pos
+	u := q.sub(p)
+	n := 0
+	for _, e := range [2][2]int{{i, j}, {j, i}} {
+		for _, k := range d.atoms[e[0]].nbrs {
+			if k == e[1] {
+				continue
+			}
+			c := u.cross(d.atoms[k].pos.sub(p))
+			if c > 0 {
+				n++
+			} else if c < 0 {
+				n--
+			}
+		}
+	}
+	switch {
+	case n > 0:
+		return 1
+	case n < 0:
+		return -1
+	}
+	return 0
+}
+
+// drawBond paints the given bond.
+func (d *_Depiction) drawBond(c *_Canvas, b molecule.BondInfo) {
+	col := color.NRGBA{0x20, 0x20, 0x20, 0xff}
+	w := strokeWidthRatio * d.bondPx / 2
+	p, q := d.ends(b)
+	u := q.sub(p).unit()
+	n := u.perp()
+	sp := bondSpacingRatio * d.bondPx
+
+	switch b.Type {
+	case cmn.BondTypeDouble, cmn.BondTypeAltern:
+		sd := d.side(b)
+		var l1, l2 _Segment
+		if sd == 0 {
+			off := n.scale(sp / 2)
+			l1 = _Segment{p.add(off), q.add(off), w}
+			l2 = _Segment{p.sub(off), q.sub(off), w}
+		} else {
+			// The inner line is trimmed at unlabelled ends.
+			off := n.scale(sp * float64(sd))
+			trim := u.scale(bondTrimRatio * d.bondPx)
+			pi, qi := p.add(off), q.add(off)
+			if d.atoms[d.index[b.A1]].label == nil {
+				pi = pi.add(trim)
+			}
+			if d.atoms[d.index[b.A2]].label == nil {
+				qi = qi.sub(trim)
+			}
+			l1 = _Segment{p, q, w}
+			l2 = _Segment{pi, qi, w}
+		}
+		c.fill(l1, col)
+		if b.Type == cmn.BondTypeAltern {
+			d.dash(c, l2, col)
+		} else {
+			c.fill(l2, col)
+		}
+
+	case cmn.BondTypeTriple:
+		off := n.scale(sp)
+		c.fill(_Segment{p, q, w}, col)
+		c.fill(_Segment{p.add(off), q.add(off), w}, col)
+		c.fill(_Segment{p.sub(off), q.sub(off), w}, col)
+
+	case cmn.BondTypeSingleOrDouble:
+		d.dash(c, _Segment{p, q, w}, col)
+
+	case cmn.BondTypeDative:
+		// An arrow from the donor to the acceptor.
+		l := arrowRatio * d.bondPx
+		back := q.sub(u.scale(l))
+		c.fill(_Segment{p, back, w}, col)
+		c.fill(_Polygon{q, back.add(n.scale(l / 2)), back.sub(n.scale(l / 2))}, col)
+
+	default:
+		switch b.Stereo {
+		case cmn.BondStereoUp:
+			hw := n.scale(wedgeWidthRatio * d.bondPx / 2)
+			c.fill(_Polygon{p, q.add(hw), q.sub(hw)}, col)
+		case cmn.BondStereoDown:
+			d.hash(c, p, q, w, col)
+		case cmn.BondStereoEither:
+			d.wave(c, p, q, w, col)
+		default:
+			c.fill(_Segment{p, q, w}, col)
+		}
+	}
+}
+
+// dash paints the given line as a dashed one.
+func (d *_Depiction) dash(c *_Canvas, l _Segment, col color.NRGBA) {
+	v := l.b.sub(l.a)
+	n := int(math.Max(2, math.Round(v.length()/(0.1*d.bondPx))))
+	for k := 0; k < n; k += 2 {
+		a := l.a.add(v.scale(float64(k) / float64(n)))
+		b := l.a.add(v.scale(float64(k+1) / float64(n)))
+		c.fill(_Segment{a, b, l.r}, col)
+	}
+}
+
+// hash paints a hashed wedge, narrow at the first point and wide at the
+// second.
+func (d *_Depiction) hash(c *_Canvas, p, q _Vec, w float64, col color.NRGBA) {
+	const n = 7
+	v := q.sub(p)
+	hw := wedgeWidthRatio * d.bondPx / 2
+	for k := 0; k < n; k++ {
+		t := float64(k) / (n - 1)
+		m := p.add(v.scale(t))
+		h := v.unit().perp().scale(math.Max(w, hw*t))
+		c.fill(_Segment{m.sub(h), m.add(h), w}, col)
+	}
+}
+
+// wave paints a wavy line, for bonds of unknown stereo configuration.
+func (d *_Depiction) wave(c *_Canvas, p, q _Vec, w float64, col color.NRGBA) {
+	v := q.sub(p)
+	n := int(math.Max(4, math.Round(v.length()/(0.08*d.bondPx))))
+	amp := v.unit().perp().scale(wedgeWidthRatio * d.bondPx / 3)
+	prev := p
+	for k := 1; k <= n; k++ {
+		next := p.add(v.scale(float64(k) / float64(n)))
+		if k < n {
+			next = next.add(amp.scale(float64(1 - 2*(k%2))))
+		}
+		c.fill(_Segment{prev, next, w}, col)
+		prev = next
+	}
+}
+
+// elementColor answers the colour of the labels of atoms of the given
+// element.
+func elementColor(sym string) color.NRGBA {
+	switch sym {
+	case "N":
+		return color.NRGBA{0x30, 0x50, 0xf8, 0xff}
+	case "O":
+		return color.NRGBA{0xe0, 0x10, 0x10, 0xff}
+	case "S":
+		return color.NRGBA{0xb0, 0xa0, 0x00, 0xff}
+	case "P":
+		return color.NRGBA{0xf0, 0x80, 0x00, 0xff}
+	case "F", "Cl":
+		return color.NRGBA{0x10, 0xa0, 0x10, 0xff}
+	case "Br":
+		return color.NRGBA{0xa6, 0x29, 0x29, 0xff}
+	case "I":
+		return color.NRGBA{0x94, 0x00, 0x94, 0xff}
+	case "B":
+		return color.NRGBA{0xd0, 0x80, 0x60, 0xff}
+	}
+	return color.NRGBA{0x20, 0x20, 0x20, 0xff}
+}
@@ -0,0 +1,185 @@
+package render
+
+import (
+	"image/color"
+
+	cmn "github.com/RxnWeaver/rxnweaver/common"
+	"github.com/RxnWeaver/rxnweaver/data/molecule"
+)
+
+// Proportions of the brackets of repeating units, as fractions of the
+// bond length in pixels.
+const (
+	bracketRatio = 0.8  // Length.
+	hookRatio    = 0.12 // Of the ends, turned towards the unit.
+)
+
+// _Repeat is a structural repeating unit, to be drawn in brackets
+// across its crossing bonds.
+type _Repeat struct {
+	atoms map[uint16]bool // Input IDs of its atoms.
+	bonds []uint16        // IDs of its drawn crossing bonds.
+	label string
+}
+
+// collapsedSgroups answers, of the given atoms and Sgroups of a
+// molecule, the atoms hidden by collapsed superatoms, mapped to those
+// standing for them, and the labels of the latter.  A superatom is
+// drawn as its label at its first atom bonded outside it, or at its
+// first atom, should there be none.  Of overlapping superatoms, the
+// first is collapsed.
+func collapsedSgroups(atoms []molecule.AtomInfo, gs []molecule.Sgroup) (map[uint16]uint16, map[uint16]string) {
+	hidden := make(map[uint16]uint16)
+	labels := make(map[uint16]string)
+	nbrs := make(map[uint16][]uint16, len(atoms))
+	for _, a := range atoms {
+		nbrs[a.Iid] = a.Neighbours
+	}
+
+	for _, g := range gs {
+		if g.Type != cmn.SgroupSuperatom || g.Expanded {
+			continue
+		}
+		in := make(map[uint16]bool, len(g.Atoms))
+		free := true
+		for _, iid := range g.Atoms {
+			in[iid] = true
+			if _, ok := hidden[iid]; ok || labels[iid] != "" {
+				free = false
+			}
+		}
+		if !free {
+			continue
+		}
+
+		anchor := g.Atoms[0]
+	search:
+		for _, iid := range g.Atoms {
+			for _, n := range nbrs[iid] {
+				if !in[n] {
+					anchor = iid
+					break search
+				}
+			}
+		}
+		for _, iid := range g.Atoms {
+			if iid != anchor {
+				hidden[iid] = anchor
+			}
+		}
+		labels[anchor] = g.Label
+	}
+	return hidden, labels
+}
+
+// repeatUnits answers the repeating units of the given Sgroups that have
+// crossing bonds drawn.
+func (d *_Depiction) repeatUnits(gs []molecule.Sgroup) []_Repeat {
+	res := []_Repeat(nil)
+	for _, g := range gs {
+		if g.Type != cmn.SgroupRepeat {
+			continue
+		}
+		r := _Repeat{atoms: make(map[uint16]bool, len(g.Atoms)), label: g.Label}
+		for _, iid := range g.Atoms {
+			r.atoms[iid] = true
+		}
+		for _, id := range g.Bonds {
+			if _, ok := d.bondIndex[id]; ok {
+				r.bonds = append(r.bonds, id)
+			}
+		}
+		if len(r.bonds) > 0 {
+			res = append(res, r)
+		}
+	}
+	return res
+}
+
+// abbreviation answers the label of the given atom standing for a
+// collapsed superatom, placed on the canvas.  Digits are subscripts,
+// as in `CF3`.  The first letter is centred on the atom, or the last,
+// should the atom's bonds lie mostly to its right.
+func (d *_Depiction) abbreviation(a *_Atom) _Text {
+	capH := fontHeightRatio * d.bondPx
+	cell := capH / glyphHeight
+	scriptCell := cell * scriptRatio
+	top := -capH / 2
+	subTop := capH/2 + 0.35*capH - glyphHeight*scriptCell
+
+	var t _Text
+	x := 0.0
+	for _, r := range a.abbrev {
+		if r >= '0' && r <= '9' {
+			t = append(t, _Glyph{r, _Vec{x, subTop}, scriptCell})
+			x += glyphAdvance * scriptCell
+			continue
+		}
+		t = append(t, _Glyph{r, _Vec{x, top}, cell})
+		x += glyphAdvance * cell
+	}
+
+	dx := 0.0
+	for _, j := range a.nbrs {
+		dx += d.atoms[j].pos.x - a.pos.x
+	}
+	g := t[0]
+	if dx > 0.1*d.bondPx {
+		g = t[len(t)-1]
+	}
+	anchor := g.pos.x + glyphWidth*g.cell/2
+
+	off := _Vec{a.pos.x - anchor, a.pos.y}
+	for i := range t {
+		t[i].pos = t[i].pos.add(off)
+	}
+	return t
+}
+
+// drawRepeat paints the brackets of the given repeating unit, across
+// the middles of its crossing bonds, and its label, as a subscript to
+// the last of them.
+func (d *_Depiction) drawRepeat(c *_Canvas, r _Repeat) {
+	col := color.NRGBA{0x20, 0x20, 0x20, 0xff}
+	w := strokeWidthRatio * d.bondPx / 2
+	h := bracketRatio * d.bondPx / 2
+	hook := hookRatio * d.bondPx
+
+	var ends []_Vec // Of the last bracket.
+	var out _Vec
+	for _, id := range r.bonds {
+		b := d.bonds[d.bondIndex[id]]
+		p, q := d.atoms[d.index[b.A1]].pos, d.atoms[d.index[b.A2]].pos
+		if !r.atoms[b.A1] {
+			p, q = q, p
+		}
+		m := p.add(q).scale(0.5)
+		u := q.sub(p).unit()
+		n := u.perp().scale(h)
+		e1, e2 := m.add(n), m.sub(n)
+		c.fill(_Segment{e1, e2, w}, col)
+		c.fill(_Segment{e1, e1.sub(u.scale(hook)), w}, col)
+		c.fill(_Segment{e2, e2.sub(u.scale(hook)), w}, col)
+		ends, out = []_Vec{e1, e2}, u
+	}
+	if r.label == "" {
+		return
+	}
+
+	// The label goes beyond the lower end, outside the unit.
+	e := ends[0]
+	if ends[1].y > e.y {
+		e = ends[1]
+	}
+	cell := fontHeightRatio * d.bondPx / glyphHeight * scriptRatio
+	pos := e.add(out.scale(hook))
+	if out.x < 0 {
+		pos.x -= glyphAdvance * cell * float64(len(r.label))
+	}
+	var t _Text
+	for _, ch := range r.label {
+		t = append(t, _Glyph{ch, pos, cell})
+		pos.x += glyphAdvance * cell
+	}
+	c.fill(t, col)
+}
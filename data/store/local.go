@@ -0,0 +1,581 @@
+package store
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"sync"
+
+	"github.com/RxnWeaver/rxnweaver/data/molecule"
+)
+
+// A local store is a single file, beginning with this magic string,
+// followed by a log of entries.  Each entry comprises a u32 length of
+// its body, a u32 CRC-32 (IEEE) of its body, and the body, with all
+// integers in little-endian byte order.  Bodies are as follows.
+//
+//	u8 operation, [16]byte key
+//	if putting : u16 fingerprint size, u16 number of non-empty bins,
+//	             per bin : u16 bin, u32 count
+//	             u16 number of attributes,
+//	             per attribute : u16 length, name, u16 length, SD header,
+//	                             u32 length, value
+//	             the encoded molecule, to the end of the body
+//
+// A later entry for a key supersedes all earlier ones.
+const localMagic = "RXWLOC01"
+
+// Operations of the entries of a local store.
+const (
+	localPut    = 1
+	localDelete = 2
+)
+
+// Sizes of the fixed parts of the entries of a local store.
+const (
+	localEntryHeaderSize = 8
+	localKeySize         = 16
+)
+
+// LocalStore is an embedded, read-write store of molecules in a single
+// file, for desktop and command-line use.  It needs neither a server
+// nor any dependency beyond the standard library.  It is safe for
+// concurrent use, but only one `LocalStore` should be open on a file
+// at any time.
+//
+// Molecules are stored under their keys (see `Key`), with their
+// fingerprints, of the default parameters, and their attributes.  The
+// file is an append-only log, so that updates never overwrite data in
+// place; an interrupted write leaves a partial entry at the end, which
+// is discarded when the store is next opened.  An index of the keys is
+// held in memory, and built as the store is opened.  Space held by
+// superseded entries is reclaimed by `Compact`.
+//
+// Molecules are stored as given; callers wanting canonical structures
+// should sanitise them first.  As with `Store`, their isotopes,
+// radicals and configurations are recorded, so that a molecule read
+// back, once sanitised, has the key it was stored under.
+type LocalStore struct {
+	mu    sync.RWMutex
+	path  string
+	f     *os.File
+	size  int64                      // Size of the valid part of the file.
+	index map[molecule.MolHash]int64 // Offsets of the current entries, by key.
+	dead  int64                      // Bytes held by superseded entries.
+}
+
+// LocalEntry is a molecule held in a `LocalStore`.  Its molecule is
+// materialised only when asked for.
+type LocalEntry struct {
+	Key         string
+	Fingerprint []int32
+	Attributes  []molecule.Attribute
+	record      []byte
+}
+
+// Molecule materialises the molecule of this entry, as a live molecule
+// tracked by the given registry, or as a passive one, if `nil`, and
+// configured with the given options.  Its attributes are restored,
+// with their SD headers; it is not sanitised.
+func (e *LocalEntry) Molecule(reg *molecule.MoleculeRegistry, opts ...molecule.Option) (*molecule.Molecule, error) {
+	mol := newMolecule(reg, opts)
+	if err := decodeInto(mol, e.record); err != nil {
+		mol.Release()
+		return nil, err
+	}
+	for _, attr := range e.Attributes {
+		if err := mol.AddTag(attr); err != nil {
+			mol.Release()
+			return nil, err
+		}
+	}
+	return mol, nil
+}
+
+// OpenLocal opens the local store in the given file, first creating it
+// if necessary.
+func OpenLocal(path string) (*LocalStore, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &LocalStore{path: path, f: f, index: make(map[molecule.MolHash]int64)}
+	if err := s.load(); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("Store %s : %v", path, err)
+	}
+	return s, nil
+}
+
+// load reads the log of this store, building its index.  A new file is
+// given its magic string; a trailing, partial or corrupt entry is
+// truncated, but errors in reading the file are answered.
+func (s *LocalStore) load() error {
+	fi, err := s.f.Stat()
+	if err != nil {
+		return err
+	}
+	if fi.Size() == 0 {
+		if _, err := s.f.WriteAt([]byte(localMagic), 0); err != nil {
+			return err
+		}
+		s.size = int64(len(localMagic))
+		return nil
+	}
+
+	magic := make([]byte, len(localMagic))
+	if _, err := s.f.ReadAt(magic, 0); err != nil || string(magic) != localMagic {
+		return fmt.Errorf("Not a local store of molecules.")
+	}
+
+	off := int64(len(localMagic))
+	for off < fi.Size() {
+		body, err := s.readEntry(off, fi.Size())
+		if _, ok := err.(*os.PathError); ok {
+			return err
+		}
+		if err != nil {
+			break
+		}
+
+		var key molecule.MolHash
+		copy(key[:], body[1:])
+		if prev, ok := s.index[key]; ok {
+			s.dead += s.entrySize(prev)
+			delete(s.index, key)
+		}
+		n := int64(localEntryHeaderSize + len(body))
+		if body[0] == localPut {
+			s.index[key] = off
+		} else {
+			s.dead += n
+		}
+		off += n
+	}
+
+	s.size = off
+	if off < fi.Size() {
+		return s.f.Truncate(off)
+	}
+	return nil
+}
+
+// readEntry answers the body of the entry at the given offset, having
+// verified it.  The entry must end by the given offset, that of the
+// end of the file.  An entry running past it, as a write interrupted
+// leaves it, answers `errTornEntry`; errors in reading the file are
+// answered as `*os.PathError`.
+func (s *LocalStore) readEntry(off, end int64) ([]byte, error) {
+	if end-off < localEntryHeaderSize {
+		return nil, errTornEntry
+	}
+	hdr := make([]byte, localEntryHeaderSize)
+	if _, err := s.f.ReadAt(hdr, off); err != nil {
+		return nil, tornAtEOF(err)
+	}
+	n := binary.LittleEndian.Uint32(hdr[0:])
+	if n < 1+localKeySize {
+		return nil, fmt.Errorf("Corrupt entry at offset %d.", off)
+	}
+	if int64(n) > end-off-localEntryHeaderSize {
+		return nil, errTornEntry
+	}
+
+	body := make([]byte, n)
+	if _, err := s.f.ReadAt(body, off+localEntryHeaderSize); err != nil {
+		return nil, tornAtEOF(err)
+	}
+	if crc32.ChecksumIEEE(body) != binary.LittleEndian.Uint32(hdr[4:]) {
+		return nil, fmt.Errorf("Corrupt entry at offset %d.", off)
+	}
+	if body[0] != localPut && body[0] != localDelete {
+		return nil, fmt.Errorf("Unknown operation %d at offset %d.", body[0], off)
+	}
+	return body, nil
+}
+
+// errTornEntry is answered for an entry running past the end of a
+// local store.
+var errTornEntry = errors.New("Torn entry at the end of the store.")
+
+// tornAtEOF answers `errTornEntry` for the given error of a read
+// cut short by the end of a file, and the error itself otherwise.
+func tornAtEOF(err error) error {
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return errTornEntry
+	}
+	return err
+}
+
+// entrySize answers the size of the entry at the given offset, which
+// is known to be valid.
+func (s *LocalStore) entrySize(off int64) int64 {
+	hdr := make([]byte, 4)
+	if _, err := s.f.ReadAt(hdr, off); err != nil {
+		return 0
+	}
+	return localEntryHeaderSize + int64(binary.LittleEndian.Uint32(hdr))
+}
+
+// append writes an entry with the given body at the end of this store,
+// answering its offset.
+func (s *LocalStore) append(body []byte) (int64, error) {
+	buf := make([]byte, localEntryHeaderSize+len(body))
+	binary.LittleEndian.PutUint32(buf[0:], uint32(len(body)))
+	binary.LittleEndian.PutUint32(buf[4:], crc32.ChecksumIEEE(body))
+	copy(buf[localEntryHeaderSize:], body)
+
+	off := s.size
+	if _, err := s.f.WriteAt(buf, off); err != nil {
+		return -1, err
+	}
+	s.size += int64(len(buf))
+	return off, nil
+}
+
+// parseKey answers the hash of the given key.
+func parseKey(key string) (molecule.MolHash, error) {
+	var h molecule.MolHash
+	b, err := hex.DecodeString(key)
+	if err != nil || len(b) != len(h) {
+		return h, fmt.Errorf("Invalid key : %q", key)
+	}
+	copy(h[:], b)
+	return h, nil
+}
+
+// Put stores the given molecule, replacing any stored under the same
+// key.  It answers the key.
+func (s *LocalStore) Put(mol *molecule.Molecule) (string, error) {
+	key, err := mol.Hash128(molecule.HashStereo | molecule.HashIsotopes)
+	if err != nil {
+		return "", err
+	}
+	rec, err := encode(mol)
+	if err != nil {
+		return "", err
+	}
+	reply := mol.Call(molecule.ReqFingerprint, molecule.FingerprintQuery{Size: molecule.FingerprintSize, Radius: molecule.FingerprintRadius})
+	if reply.Status != molecule.StSuccess {
+		return "", fmt.Errorf("Molecule %d : fingerprint not computed : %v", mol.Id(), reply.Status)
+	}
+	fp := reply.Payload.([]int32)
+	attrs, err := mol.Attributes()
+	if err != nil {
+		return "", err
+	}
+
+	body, err := encodeLocalPut(key, fp, attrs, rec)
+	if err != nil {
+		return "", fmt.Errorf("Molecule %d : %v", mol.Id(), err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.f == nil {
+		return "", fmt.Errorf("Store %s is closed.", s.path)
+	}
+	off, err := s.append(body)
+	if err != nil {
+		return "", err
+	}
+	if prev, ok := s.index[key]; ok {
+		s.dead += s.entrySize(prev)
+	}
+	s.index[key] = off
+	return key.String(), nil
+}
+
+// encodeLocalPut answers the body of an entry storing the given
+// molecule data under the given key.
+func encodeLocalPut(key molecule.MolHash, fp []int32, attrs []molecule.Attribute, rec []byte) ([]byte, error) {
+	if len(fp) > math.MaxUint16 || len(attrs) > math.MaxUint16 {
+		return nil, fmt.Errorf("Too many bins or attributes to store.")
+	}
+
+	var buf bytes.Buffer
+	le := binary.LittleEndian
+	scratch := make([]byte, 4)
+	put16 := func(n int) {
+		le.PutUint16(scratch, uint16(n))
+		buf.Write(scratch[:2])
+	}
+	put32 := func(n int) {
+		le.PutUint32(scratch, uint32(n))
+		buf.Write(scratch)
+	}
+
+	buf.WriteByte(localPut)
+	buf.Write(key[:])
+
+	bins := 0
+	for _, c := range fp {
+		if c != 0 {
+			bins++
+		}
+	}
+	put16(len(fp))
+	put16(bins)
+	for i, c := range fp {
+		if c != 0 {
+			put16(i)
+			put32(int(c))
+		}
+	}
+
+	put16(len(attrs))
+	for _, attr := range attrs {
+		if len(attr.Name) > math.MaxUint16 || len(attr.Header) > math.MaxUint16 {
+			return nil, fmt.Errorf("Attribute name too long to store : %q", attr.Name)
+		}
+		put16(len(attr.Name))
+		buf.WriteString(attr.Name)
+		put16(len(attr.Header))
+		buf.WriteString(attr.Header)
+		put32(len(attr.Value))
+		buf.WriteString(attr.Value)
+	}
+
+	buf.Write(rec)
+	return buf.Bytes(), nil
+}
+
+// decodeLocalPut answers the entry of the given body of a put.
+func decodeLocalPut(body []byte) (*LocalEntry, error) {
+	var key molecule.MolHash
+	copy(key[:], body[1:])
+	e := &LocalEntry{Key: key.String()}
+
+	// Reading stops at the end of the body, whereafter `short` is set,
+	// and zeros are answered.
+	le := binary.LittleEndian
+	rest, short := body[1+localKeySize:], false
+	take := func(n int) []byte {
+		if short || n > len(rest) {
+			short = true
+			return make([]byte, n)
+		}
+		b := rest[:n]
+		rest = rest[n:]
+		return b
+	}
+	get16 := func() int { return int(le.Uint16(take(2))) }
+	get32 := func() int { return int(le.Uint32(take(4))) }
+
+	e.Fingerprint = make([]int32, get16())
+	for i := get16(); i > 0 && !short; i-- {
+		bin, c := get16(), get32()
+		if bin >= len(e.Fingerprint) {
+			return nil, fmt.Errorf("Entry %s : fingerprint bin out of range : %d", e.Key, bin)
+		}
+		e.Fingerprint[bin] = int32(c)
+	}
+
+	e.Attributes = make([]molecule.Attribute, get16())
+	for i := 0; i < len(e.Attributes) && !short; i++ {
+		attr := &e.Attributes[i]
+		attr.Name = string(take(get16()))
+		attr.Header = string(take(get16()))
+		attr.Value = string(take(get32()))
+	}
+
+	if short {
+		return nil, fmt.Errorf("Entry %s is truncated.", e.Key)
+	}
+	e.record = rest
+	return e, nil
+}
+
+// get answers the entry stored at the given offset.  The caller must
+// hold the lock of this store.
+func (s *LocalStore) get(off int64) (*LocalEntry, error) {
+	body, err := s.readEntry(off, s.size)
+	if err != nil {
+		return nil, err
+	}
+	return decodeLocalPut(body)
+}
+
+// Get answers the entry stored under the given key, or `ErrNotFound`.
+func (s *LocalStore) Get(key string) (*LocalEntry, error) {
+	h, err := parseKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	off, ok := s.index[h]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return s.get(off)
+}
+
+// Find answers the entry of the stored molecule identical to the given
+// one, or `ErrNotFound`.
+func (s *LocalStore) Find(mol *molecule.Molecule) (*LocalEntry, error) {
+	key, err := Key(mol)
+	if err != nil {
+		return nil, err
+	}
+	return s.Get(key)
+}
+
+// Has answers if a molecule is stored under the given key.
+func (s *LocalStore) Has(key string) bool {
+	h, err := parseKey(key)
+	if err != nil {
+		return false
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	_, ok := s.index[h]
+	return ok
+}
+
+// Len answers the number of molecules in this store.
+func (s *LocalStore) Len() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.index)
+}
+
+// Delete removes the molecule stored under the given key, answering
+// `ErrNotFound` if there is none.
+func (s *LocalStore) Delete(key string) error {
+	h, err := parseKey(key)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	prev, ok := s.index[h]
+	if !ok {
+		return ErrNotFound
+	}
+	body := append([]byte{localDelete}, h[:]...)
+	if _, err := s.append(body); err != nil {
+		return err
+	}
+	s.dead += s.entrySize(prev) + int64(localEntryHeaderSize+len(body))
+	delete(s.index, h)
+	return nil
+}
+
+// keys answers the keys of this store, in ascending order.  The caller
+// must hold the lock of this store.
+func (s *LocalStore) keys() []molecule.MolHash {
+	keys := make([]molecule.MolHash, 0, len(s.index))
+	for key := range s.index {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return string(keys[i][:]) < string(keys[j][:])
+	})
+	return keys
+}
+
+// Each calls the given function with each entry of this store, in the
+// ascending order of their keys.  Iteration stops when the function
+// answers `false`, or at the first entry that can not be read, whose
+// error is answered.  The store can not be modified during iteration.
+func (s *LocalStore) Each(f func(e *LocalEntry) bool) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, key := range s.keys() {
+		e, err := s.get(s.index[key])
+		if err != nil {
+			return err
+		}
+		if !f(e) {
+			break
+		}
+	}
+	return nil
+}
+
+// Garbage answers the fraction of the file of this store held by
+// superseded entries, which `Compact` would reclaim.
+func (s *LocalStore) Garbage() float64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return float64(s.dead) / float64(s.size)
+}
+
+// Compact rewrites the file of this store with only its current
+// entries, in the order of their keys.  The new file replaces the old
+// one only once it is complete.
+func (s *LocalStore) Compact() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tmp := s.path + ".compact"
+	f, err := os.OpenFile(tmp, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	fail := func(err error) error {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+
+	if _, err := io.WriteString(f, localMagic); err != nil {
+		return fail(err)
+	}
+	index := make(map[molecule.MolHash]int64, len(s.index))
+	off := int64(len(localMagic))
+	for _, key := range s.keys() {
+		n := s.entrySize(s.index[key])
+		if _, err := io.Copy(f, io.NewSectionReader(s.f, s.index[key], n)); err != nil {
+			return fail(err)
+		}
+		index[key] = off
+		off += n
+	}
+	if err := f.Sync(); err != nil {
+		return fail(err)
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		return fail(err)
+	}
+
+	s.f.Close()
+	s.f, s.size, s.index, s.dead = f, off, index, 0
+	return nil
+}
+
+// Sync commits the writes to this store to stable storage.
+func (s *LocalStore) Sync() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.f.Sync()
+}
+
+// Close syncs and closes this store.  It may not be used thereafter.
+func (s *LocalStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.f == nil {
+		return nil
+	}
+
+	err1 := s.f.Sync()
+	err2 := s.f.Close()
+	s.f, s.index = nil, nil
+	if err1 != nil {
+		return err1
+	}
+	return err2
+}
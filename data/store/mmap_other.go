@@ -0,0 +1,29 @@
+//go:build !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd && !solaris
+// +build !darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd,!solaris
+
+package store
+
+import (
+	"io/ioutil"
+)
+
+// _Mapping holds the contents of a file.  On platforms without memory
+// mapping support, files are read into memory in their entirety.
+type _Mapping struct {
+	data []byte
+}
+
+// mapFile reads the given file into memory.
+func mapFile(name string) (*_Mapping, error) {
+	data, err := ioutil.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	return &_Mapping{data}, nil
+}
+
+// Close releases the contents of this mapping.
+func (m *_Mapping) Close() error {
+	m.data = nil
+	return nil
+}
@@ -0,0 +1,48 @@
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd || solaris
+// +build darwin dragonfly freebsd linux netbsd openbsd solaris
+
+package store
+
+import (
+	"os"
+	"syscall"
+)
+
+// _Mapping is a read-only memory mapping of a file.
+type _Mapping struct {
+	data []byte
+}
+
+// mapFile maps the given file into memory, read-only.
+func mapFile(name string) (*_Mapping, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if fi.Size() == 0 {
+		return &_Mapping{[]byte{}}, nil
+	}
+
+	data, err := syscall.Mmap(int(f.Fd()), 0, int(fi.Size()), syscall.PROT_READ, syscall.MAP_SHARED)
+	if err != nil {
+		return nil, err
+	}
+	return &_Mapping{data}, nil
+}
+
+// Close unmaps this mapping.
+func (m *_Mapping) Close() error {
+	if len(m.data) == 0 {
+		return nil
+	}
+
+	err := syscall.Munmap(m.data)
+	m.data = nil
+	return err
+}
@@ -0,0 +1,257 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/RxnWeaver/rxnweaver/data/loader"
+	"github.com/RxnWeaver/rxnweaver/data/molecule"
+)
+
+// ErrNotFound is answered when a key is not present in a store.
+var ErrNotFound = errors.New("Molecule not found in store.")
+
+// Name of the attribute holding the InChIKey of a molecule, persisted
+// in its own column by `PostgresStore`.  InChIKeys are not computed
+// here, since that needs the IUPAC InChI library.
+const InChIKeyAttribute = "inchikey"
+
+// PostgresStore persists molecules in a table of a PostgreSQL
+// database, keyed by their canonical hashes.  It is safe for
+// concurrent use.
+//
+// Each row holds the encoded molecule, as in the segments of `Store`,
+// along with its SMILES, InChIKey, formula and attributes, so that it
+// can be found without materialising the molecule.  The SMILES is
+// canonical, with the stereo and the isotopes of the molecule, as is
+// the key, the hexadecimal hash of the molecule; see
+// `loader.CanonicalSmiles` and `molecule.Hash128`.  A molecule
+// materialised, once sanitised, has the key it was stored under.
+//
+// The store works through `database/sql`, with any PostgreSQL driver
+// registered by the application, such as that of `pgx` or `lib/pq`.
+// Upserts need PostgreSQL 9.5 or later.
+type PostgresStore struct {
+	db    *sql.DB
+	table string
+}
+
+// tableNameRe matches the table names accepted, since they can not be
+// passed as parameters of statements.
+var tableNameRe = regexp.MustCompile(`^[a-z_][a-z0-9_]*(\.[a-z_][a-z0-9_]*)?$`)
+
+// OpenPostgres answers a store in the named table of the given
+// database, creating the table and its indexes if necessary.  The name
+// may be qualified by a schema.
+func OpenPostgres(ctx context.Context, db *sql.DB, table string) (*PostgresStore, error) {
+	if !tableNameRe.MatchString(table) {
+		return nil, fmt.Errorf("Invalid table name : %q", table)
+	}
+
+	s := &PostgresStore{db: db, table: table}
+	stmts := []string{
+		`CREATE TABLE IF NOT EXISTS ` + table + ` (
+			key        text PRIMARY KEY,
+			smiles     text NOT NULL,
+			inchikey   text,
+			formula    text NOT NULL,
+			record     bytea NOT NULL,
+			attributes jsonb NOT NULL DEFAULT '{}',
+			updated    timestamptz NOT NULL DEFAULT now()
+		)`,
+		`CREATE INDEX IF NOT EXISTS ` + indexName(table, "inchikey") + ` ON ` + table + ` (inchikey)`,
+		`CREATE INDEX IF NOT EXISTS ` + indexName(table, "formula") + ` ON ` + table + ` (formula)`,
+	}
+	for _, stmt := range stmts {
+		if _, err := db.ExecContext(ctx, stmt); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// indexName answers the name of the index of the given table on the
+// given column.  Indexes live in the schema of their tables, so that
+// the schema is dropped from the name.
+func indexName(table, column string) string {
+	for i := len(table) - 1; i >= 0; i-- {
+		if table[i] == '.' {
+			table = table[i+1:]
+			break
+		}
+	}
+	return table + "_" + column + "_idx"
+}
+
+// StoredMolecule is a row of a `PostgresStore`.  Its molecule is
+// materialised only when asked for.
+type StoredMolecule struct {
+	Key        string
+	Smiles     string
+	InChIKey   string // Empty if unknown.
+	Formula    string
+	Attributes map[string]string
+	Updated    time.Time
+	record     []byte
+}
+
+// Molecule materialises the stored molecule, as a live molecule
+// tracked by the given registry, or as a passive one, if `nil`, and
+// configured with the given options.  Its attributes are restored;
+// it is not sanitised, as with `Store.Molecule`.
+func (sm *StoredMolecule) Molecule(reg *molecule.MoleculeRegistry, opts ...molecule.Option) (*molecule.Molecule, error) {
+	mol := newMolecule(reg, opts)
+	if err := decodeInto(mol, sm.record); err != nil {
+		mol.Release()
+		return nil, err
+	}
+	for name, value := range sm.Attributes {
+		if err := mol.SetAttribute(name, value); err != nil {
+			mol.Release()
+			return nil, err
+		}
+	}
+	return mol, nil
+}
+
+// Key answers the key under which the given molecule is stored.
+func Key(mol *molecule.Molecule) (string, error) {
+	h, err := mol.Hash128(molecule.HashStereo | molecule.HashIsotopes)
+	if err != nil {
+		return "", err
+	}
+	return h.String(), nil
+}
+
+// Put inserts the given molecule into this store, or replaces the one
+// stored under the same key.  It answers the key.  Attributes of the
+// same name are stored once, with the last of their values.
+func (s *PostgresStore) Put(ctx context.Context, mol *molecule.Molecule) (string, error) {
+	key, err := Key(mol)
+	if err != nil {
+		return "", err
+	}
+	rec, err := encode(mol)
+	if err != nil {
+		return "", err
+	}
+	smi, err := loader.CanonicalSmiles(mol, molecule.HashStereo|molecule.HashIsotopes)
+	if err != nil {
+		return "", err
+	}
+
+	attrs, err := mol.Attributes()
+	if err != nil {
+		return "", err
+	}
+	am := make(map[string]string, len(attrs))
+	inchiKey := sql.NullString{}
+	for _, attr := range attrs {
+		am[attr.Name] = attr.Value
+		if attr.Name == InChIKeyAttribute && attr.Value != "" {
+			inchiKey = sql.NullString{String: attr.Value, Valid: true}
+		}
+	}
+	aj, err := json.Marshal(am)
+	if err != nil {
+		return "", err
+	}
+
+	_, err = s.db.ExecContext(ctx, `INSERT INTO `+s.table+` (key, smiles, inchikey, formula, record, attributes)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (key) DO UPDATE SET
+			smiles = EXCLUDED.smiles,
+			inchikey = EXCLUDED.inchikey,
+			formula = EXCLUDED.formula,
+			record = EXCLUDED.record,
+			attributes = EXCLUDED.attributes,
+			updated = now()`,
+		key, smi, inchiKey, mol.Formula(), rec, string(aj))
+	if err != nil {
+		return "", err
+	}
+	return key, nil
+}
+
+// Get answers the molecule stored under the given key, or
+// `ErrNotFound`.
+func (s *PostgresStore) Get(ctx context.Context, key string) (*StoredMolecule, error) {
+	sms, err := s.query(ctx, `WHERE key = $1`, key)
+	if err != nil {
+		return nil, err
+	}
+	if len(sms) == 0 {
+		return nil, ErrNotFound
+	}
+	return sms[0], nil
+}
+
+// Find answers the stored molecule identical to the given one, or
+// `ErrNotFound`.
+func (s *PostgresStore) Find(ctx context.Context, mol *molecule.Molecule) (*StoredMolecule, error) {
+	key, err := Key(mol)
+	if err != nil {
+		return nil, err
+	}
+	return s.Get(ctx, key)
+}
+
+// FindByInChIKey answers the molecules stored with the given InChIKey.
+// Several molecules can share one, when they differ in ways the
+// InChIKey does not capture.
+func (s *PostgresStore) FindByInChIKey(ctx context.Context, inchiKey string) ([]*StoredMolecule, error) {
+	return s.query(ctx, `WHERE inchikey = $1 ORDER BY key`, inchiKey)
+}
+
+// FindByFormula answers the molecules stored with the given formula.
+func (s *PostgresStore) FindByFormula(ctx context.Context, formula string) ([]*StoredMolecule, error) {
+	return s.query(ctx, `WHERE formula = $1 ORDER BY key`, formula)
+}
+
+// Delete removes the molecule stored under the given key, answering
+// `ErrNotFound` if there is none.
+func (s *PostgresStore) Delete(ctx context.Context, key string) error {
+	res, err := s.db.ExecContext(ctx, `DELETE FROM `+s.table+` WHERE key = $1`, key)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// query answers the rows selected by the given condition, with the
+// given arguments.
+func (s *PostgresStore) query(ctx context.Context, cond string, args ...interface{}) ([]*StoredMolecule, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT key, smiles, inchikey, formula, record, attributes, updated FROM `+s.table+` `+cond, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	res := []*StoredMolecule(nil)
+	for rows.Next() {
+		sm := &StoredMolecule{}
+		inchiKey := sql.NullString{}
+		aj := []byte(nil)
+		if err := rows.Scan(&sm.Key, &sm.Smiles, &inchiKey, &sm.Formula, &sm.record, &aj, &sm.Updated); err != nil {
+			return nil, err
+		}
+		sm.InChIKey = inchiKey.String
+		if err := json.Unmarshal(aj, &sm.Attributes); err != nil {
+			return nil, fmt.Errorf("Molecule %s : invalid attributes : %v", sm.Key, err)
+		}
+		res = append(res, sm)
+	}
+	return res, rows.Err()
+}
@@ -0,0 +1,230 @@
+package store
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+
+	cmn "github.com/RxnWeaver/rxnweaver/common"
+	"github.com/RxnWeaver/rxnweaver/data/molecule"
+)
+
+// Records are encoded as follows, with all integers in little-endian
+// byte order.
+//
+//	u8 version, u16 number of atoms, u16 number of bonds
+//	per atom : u8 atomic number, i8 charge, u8 hydrogen count,
+//	           u16 mass number, u8 radical, u8 parity,
+//	           f32 X, f32 Y, f32 Z
+//	per bond : u16 first atom, u16 second atom, u8 type, u8 stereo,
+//	           i8 sides
+//
+// The type of an aromatic or a query bond is held in the upper four
+// bits of its byte, and its Kekulé type in the lower four.  A mass
+// number of `0` marks the natural abundance of its element.  The upper
+// bit of the radical byte marks a hydrogen atom standing on its own,
+// as in `H2`, rather than counted in the hydrogen count of a former
+// neighbour; see `molecule.AtomInfo`.  Parities
+// and sides are those perceived, as `molecule.AtomInfo` and
+// `molecule.BondInfo` give them, and are declared upon reading, so
+// that molecules without coordinates keep their configurations.
+// Atoms are stored in the ascending order of their input IDs.  Bonds
+// refer to atoms by their one-based positions in that order.  Thus, a
+// molecule read back has contiguous input IDs, beginning at 0.
+//
+// Records of version 1 have neither the version, nor mass numbers,
+// radicals, parities and sides.  They are told apart by their sizes,
+// and are still read, their hydrogen atoms as counted ones.
+
+// Version of the records encoded.
+const recordVersion = 2
+
+// Sizes of the encoded parts of a record.
+const (
+	headerSize   = 5
+	atomRecSize  = 19
+	bondRecSize  = 7
+	maxAtomOrder = math.MaxUint16
+	aloneBit     = 0x80 // Of the radical byte.
+
+	headerSizeV1  = 4
+	atomRecSizeV1 = 15
+	bondRecSizeV1 = 6
+)
+
+// encode answers the record representing the given molecule.
+func encode(mol *molecule.Molecule) ([]byte, error) {
+	na, nb := mol.AtomCount(), mol.BondCount()
+	if na > maxAtomOrder || nb > maxAtomOrder {
+		return nil, fmt.Errorf("Molecule too large to store : %d atoms, %d bonds", na, nb)
+	}
+
+	buf := make([]byte, headerSize+na*atomRecSize+nb*bondRecSize)
+	le := binary.LittleEndian
+	buf[0] = recordVersion
+	le.PutUint16(buf[1:], uint16(na))
+	le.PutUint16(buf[3:], uint16(nb))
+
+	// Positions of atoms, by their input IDs.
+	pos := make(map[uint16]uint16, na)
+	off := headerSize
+	for iid := 0; len(pos) < na && iid <= maxAtomOrder; iid++ {
+		ai, err := mol.AtomInfo(uint16(iid))
+		if err != nil {
+			continue
+		}
+
+		pos[ai.Iid] = uint16(len(pos) + 1)
+		buf[off] = ai.AtomicNumber
+		buf[off+1] = byte(ai.Charge)
+		buf[off+2] = ai.HCount
+		le.PutUint16(buf[off+3:], ai.Isotope)
+		buf[off+5] = byte(ai.Radical)
+		if ai.AtomicNumber == 1 && !ai.Counted {
+			buf[off+5] |= aloneBit
+		}
+		if ai.Parity == cmn.StereoParityOdd || ai.Parity == cmn.StereoParityEven {
+			buf[off+6] = byte(ai.Parity)
+		}
+		le.PutUint32(buf[off+7:], math.Float32bits(ai.X))
+		le.PutUint32(buf[off+11:], math.Float32bits(ai.Y))
+		le.PutUint32(buf[off+15:], math.Float32bits(ai.Z))
+		off += atomRecSize
+	}
+
+	found := 0
+	for id := 0; found < nb && id <= maxAtomOrder; id++ {
+		bi, err := mol.BondInfo(uint16(id))
+		if err != nil {
+			continue
+		}
+
+		found++
+		le.PutUint16(buf[off:], pos[bi.A1])
+		le.PutUint16(buf[off+2:], pos[bi.A2])
+		buf[off+4] = byte(bi.KekuleType)
+		if bi.Type != bi.KekuleType {
+			buf[off+4] |= byte(bi.Type) << 4
+		}
+		buf[off+5] = byte(bi.Stereo)
+		buf[off+6] = byte(bi.Sides)
+		off += bondRecSize
+	}
+
+	if len(pos) < na || found < nb {
+		return nil, fmt.Errorf("Could not enumerate the atoms and bonds of molecule %d.", mol.Id())
+	}
+	return buf, nil
+}
+
+// decode answers a new passive molecule, configured with the given
+// options, built from the given record.
+func decode(rec []byte, opts []molecule.Option) (*molecule.Molecule, error) {
+	mol := molecule.NewPassive(opts...)
+	if err := decodeInto(mol, rec); err != nil {
+		mol.Release()
+		return nil, err
+	}
+	return mol, nil
+}
+
+// newMolecule answers a new molecule tracked by the given registry, or
+// a passive one, if `nil`, configured with the given options.
+func newMolecule(reg *molecule.MoleculeRegistry, opts []molecule.Option) *molecule.Molecule {
+	if reg == nil {
+		return molecule.NewPassive(opts...)
+	}
+	return reg.NewMolecule(opts...)
+}
+
+// decodeInto builds the molecule of the given record in the given new,
+// empty molecule.
+func decodeInto(mol *molecule.Molecule, rec []byte) error {
+	le := binary.LittleEndian
+	fits := func(hdrSize, atomSize, bondSize int) (int, int, bool) {
+		if len(rec) < hdrSize {
+			return 0, 0, false
+		}
+		na, nb := int(le.Uint16(rec[hdrSize-4:])), int(le.Uint16(rec[hdrSize-2:]))
+		return na, nb, len(rec) == hdrSize+na*atomSize+nb*bondSize
+	}
+	hdrSize, atomSize, bondSize, v1 := headerSize, atomRecSize, bondRecSize, false
+	na, nb, ok := fits(headerSize, atomRecSize, bondRecSize)
+	if !ok || rec[0] != recordVersion {
+		hdrSize, atomSize, bondSize, v1 = headerSizeV1, atomRecSizeV1, bondRecSizeV1, true
+		if na, nb, ok = fits(headerSizeV1, atomRecSizeV1, bondRecSizeV1); !ok {
+			if len(rec) < headerSizeV1 {
+				return fmt.Errorf("Truncated record header.")
+			}
+			return fmt.Errorf("Record size mismatch : %d atoms, %d bonds, %d bytes", na, nb, len(rec))
+		}
+	}
+
+	ab := mol.NewAtomBuilder()
+	off := hdrSize
+	for i := 0; i < na; i++ {
+		atNum := int(rec[off])
+		if atNum >= len(cmn.ElementSymbols) {
+			return fmt.Errorf("Invalid atomic number : %d", atNum)
+		}
+		if _, err := ab.New(cmn.ElementSymbols[atNum], i); err != nil {
+			return err
+		}
+		xyz, alone := off+3, false
+		if !v1 {
+			if mass := le.Uint16(rec[off+3:]); mass != 0 {
+				ab.Isotope(int(mass))
+			}
+			ab.Radical(cmn.Radical(rec[off+5] &^ aloneBit))
+			alone = rec[off+5]&aloneBit != 0
+			if p := cmn.StereoParity(rec[off+6]); p != cmn.StereoParityNone {
+				ab.Parity(p)
+			}
+			xyz = off + 7
+		}
+		if atNum == 1 && !alone {
+			ab.Counted()
+		}
+		ab.Coordinates(math.Float32frombits(le.Uint32(rec[xyz:])),
+			math.Float32frombits(le.Uint32(rec[xyz+4:])),
+			math.Float32frombits(le.Uint32(rec[xyz+8:])))
+		if err := ab.Add(); err != nil {
+			return err
+		}
+		if err := mol.SetAtomCharge(uint16(i), int8(rec[off+1])); err != nil {
+			return err
+		}
+		if err := mol.SetAtomHCount(uint16(i), rec[off+2]); err != nil {
+			return err
+		}
+		off += atomSize
+	}
+
+	bb := mol.NewBondBuilder()
+	for i := 0; i < nb; i++ {
+		if _, err := bb.New(i); err != nil {
+			return err
+		}
+		if _, err := bb.Atoms(int(le.Uint16(rec[off:]))-1, int(le.Uint16(rec[off+2:]))-1); err != nil {
+			return err
+		}
+		if _, err := bb.BondType(cmn.BondType(rec[off+4] & 0x0f)); err != nil {
+			return err
+		}
+		if given := cmn.BondType(rec[off+4] >> 4); given != cmn.BondTypeNone {
+			if _, err := bb.BondType(given); err != nil {
+				return err
+			}
+		}
+		bb.BondStereo(cmn.BondStereo(rec[off+5]))
+		if !v1 && rec[off+6] != 0 {
+			bb.Cis(int8(rec[off+6]) > 0)
+		}
+		if err := mol.AddBond(bb); err != nil {
+			return err
+		}
+		off += bondSize
+	}
+
+	return nil
+}
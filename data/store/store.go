@@ -0,0 +1,290 @@
+// Package store implements stores of molecules.  Its primary store is
+// an on-disk, read-only one, for querying very large reference
+// collections.
+//
+// A store is a directory holding append-only segment files of encoded
+// molecules, and an index locating each molecule in the segments.
+// When reading, both the segments and the index are memory-mapped.
+// Molecules are materialised only when asked for, as passive
+// molecules, so that neither a `Molecule` object nor a goroutine is
+// held in memory per stored molecule.
+//
+// Two other stores are read-write, and keyed by the canonical hashes of
+// molecules: `LocalStore`, embedded in a single file, for desktop and
+// command-line use, and `PostgresStore`, for shared databases.
+package store
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/RxnWeaver/rxnweaver/data/molecule"
+)
+
+// A segment is closed to further appends once it reaches this size.
+const MaxSegmentSize = 256 * 1024 * 1024
+
+// Each index entry comprises a u32 segment number, a u64 offset and a
+// u32 length, in little-endian byte order.
+const indexEntrySize = 16
+
+// Name of the index file in a store's directory.
+const indexFileName = "index"
+
+// segmentFileName answers the name of the segment file with the given
+// number.
+func segmentFileName(n int) string {
+	return fmt.Sprintf("%06d.seg", n)
+}
+
+// Writer appends molecules to a store.
+//
+// A writer is NOT safe for concurrent use.  Neither should more than
+// one writer be open on the same store at any time.
+type Writer struct {
+	dir     string
+	seg     int      // Number of the current segment.
+	segFile *os.File // Current segment.
+	segSize int64    // Current size of the current segment.
+	index   *os.File
+	count   int // Number of molecules in the store.
+}
+
+// Create opens the store in the given directory for appending, first
+// creating it if necessary.
+func Create(dir string) (*Writer, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	idx, err := os.OpenFile(filepath.Join(dir, indexFileName), os.O_RDWR|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	fi, err := idx.Stat()
+	if err != nil {
+		idx.Close()
+		return nil, err
+	}
+	if fi.Size()%indexEntrySize != 0 {
+		idx.Close()
+		return nil, fmt.Errorf("Corrupt index in store %s : size %d", dir, fi.Size())
+	}
+
+	w := &Writer{dir: dir, index: idx, count: int(fi.Size() / indexEntrySize)}
+
+	segs, err := segmentNumbers(dir)
+	if err != nil {
+		idx.Close()
+		return nil, err
+	}
+	w.seg = 1
+	if len(segs) > 0 {
+		w.seg = segs[len(segs)-1]
+	}
+	if err := w.openSegment(); err != nil {
+		idx.Close()
+		return nil, err
+	}
+
+	return w, nil
+}
+
+// openSegment opens the current segment for appending.
+func (w *Writer) openSegment() error {
+	f, err := os.OpenFile(filepath.Join(w.dir, segmentFileName(w.seg)), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	w.segFile, w.segSize = f, fi.Size()
+	return nil
+}
+
+// Append encodes and appends the given molecule to the store.  It
+// answers the index of the molecule in the store.
+func (w *Writer) Append(mol *molecule.Molecule) (int, error) {
+	rec, err := encode(mol)
+	if err != nil {
+		return -1, err
+	}
+
+	if w.segSize > 0 && w.segSize+int64(len(rec)) > MaxSegmentSize {
+		if err := w.segFile.Close(); err != nil {
+			return -1, err
+		}
+		w.seg++
+		if err := w.openSegment(); err != nil {
+			return -1, err
+		}
+	}
+
+	if _, err := w.segFile.Write(rec); err != nil {
+		return -1, err
+	}
+
+	entry := make([]byte, indexEntrySize)
+	binary.LittleEndian.PutUint32(entry[0:], uint32(w.seg))
+	binary.LittleEndian.PutUint64(entry[4:], uint64(w.segSize))
+	binary.LittleEndian.PutUint32(entry[12:], uint32(len(rec)))
+	w.segSize += int64(len(rec))
+
+	// The index is written last, so that an interrupted append leaves
+	// no entry referring to an incomplete record.
+	if _, err := w.index.Write(entry); err != nil {
+		return -1, err
+	}
+
+	w.count++
+	return w.count - 1, nil
+}
+
+// Close flushes and closes the files of this writer.
+func (w *Writer) Close() error {
+	err1 := w.segFile.Sync()
+	err2 := w.segFile.Close()
+	err3 := w.index.Close()
+	for _, err := range []error{err1, err2, err3} {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Store is a read-only view of a store on disk.  It is safe for
+// concurrent use.
+type Store struct {
+	index []byte         // Mapped index.
+	segs  map[int][]byte // Mapped segments, by number.
+	maps  []io.Closer    // For unmapping.
+}
+
+// segmentNumbers answers the numbers of the segments in the given
+// directory, in ascending order.
+func segmentNumbers(dir string) ([]int, error) {
+	names, err := filepath.Glob(filepath.Join(dir, "*.seg"))
+	if err != nil {
+		return nil, err
+	}
+
+	nums := make([]int, 0, len(names))
+	for _, name := range names {
+		n := 0
+		if _, err := fmt.Sscanf(filepath.Base(name), "%06d.seg", &n); err == nil {
+			nums = append(nums, n)
+		}
+	}
+	sort.Ints(nums)
+	return nums, nil
+}
+
+// Open maps the store in the given directory for reading.
+func Open(dir string) (*Store, error) {
+	s := &Store{segs: make(map[int][]byte)}
+
+	m, err := mapFile(filepath.Join(dir, indexFileName))
+	if err != nil {
+		return nil, err
+	}
+	s.index = m.data
+	s.maps = append(s.maps, m)
+
+	// Ignore a trailing, partially-written entry.
+	s.index = s.index[:len(s.index)-len(s.index)%indexEntrySize]
+
+	nums, err := segmentNumbers(dir)
+	if err != nil {
+		s.Close()
+		return nil, err
+	}
+	for _, n := range nums {
+		m, err := mapFile(filepath.Join(dir, segmentFileName(n)))
+		if err != nil {
+			s.Close()
+			return nil, err
+		}
+		s.segs[n] = m.data
+		s.maps = append(s.maps, m)
+	}
+
+	return s, nil
+}
+
+// Len answers the number of molecules in this store.
+func (s *Store) Len() int {
+	return len(s.index) / indexEntrySize
+}
+
+// record answers the encoded molecule at the given index.  The answer
+// refers to mapped memory, and must not be modified.
+func (s *Store) record(i int) ([]byte, error) {
+	if i < 0 || i >= s.Len() {
+		return nil, fmt.Errorf("Index out of range : %d", i)
+	}
+
+	entry := s.index[i*indexEntrySize:]
+	seg := int(binary.LittleEndian.Uint32(entry[0:]))
+	off := binary.LittleEndian.Uint64(entry[4:])
+	n := uint64(binary.LittleEndian.Uint32(entry[12:]))
+
+	data, ok := s.segs[seg]
+	if !ok || off+n > uint64(len(data)) {
+		return nil, fmt.Errorf("Record %d lies outside segment %d.", i, seg)
+	}
+	return data[off : off+n], nil
+}
+
+// Molecule materialises the molecule at the given index, as a passive
+// molecule configured with the given options.  Callers streaming over
+// the store should `Release` each molecule once done with it.
+func (s *Store) Molecule(i int, opts ...molecule.Option) (*molecule.Molecule, error) {
+	rec, err := s.record(i)
+	if err != nil {
+		return nil, err
+	}
+	return decode(rec, opts)
+}
+
+// Each materialises the molecules of this store one at a time, in
+// order, and calls the given function with each.  The molecule is
+// released when the function returns; it must not be retained.
+// Iteration stops when the function answers `false`, or at the first
+// molecule that can not be materialised, whose error is answered.
+func (s *Store) Each(f func(i int, mol *molecule.Molecule) bool) error {
+	for i := 0; i < s.Len(); i++ {
+		mol, err := s.Molecule(i)
+		if err != nil {
+			return err
+		}
+
+		ok := f(i, mol)
+		mol.Release()
+		if !ok {
+			break
+		}
+	}
+	return nil
+}
+
+// Close unmaps this store.  Neither the store nor any data obtained
+// from it by reference may be used thereafter.
+func (s *Store) Close() error {
+	first := error(nil)
+	for _, m := range s.maps {
+		if err := m.Close(); err != nil && first == nil {
+			first = err
+		}
+	}
+	s.maps, s.index, s.segs = nil, nil, nil
+	return first
+}
@@ -0,0 +1,169 @@
+package substance
+
+import (
+	"sort"
+
+	cmn "github.com/RxnWeaver/rxnweaver/common"
+	"github.com/RxnWeaver/rxnweaver/data/molecule"
+)
+
+// FromMolecule answers a substance whose components are the connected
+// components of the given molecule, as a SMILES string separated by
+// dots, or a molfile of several fragments, would give.  Identical
+// components, by their structure hashes with all layers, are counted
+// as units of one; thus, `Cl.Cl.NCCN` answers two units of hydrogen
+// chloride, and one of ethylenediamine.  The components are ordered by
+// their first atoms.  Hydrogen atoms without neighbours, that are not
+// charged, belong to no component, since they are counted in the
+// hydrogen counts of their former neighbours.
+//
+// The components are new molecules, extracted from the given one, and
+// tracked by its registry, unless it is passive, in which case so are
+// they; they retain their input IDs, and the enhanced stereo groups of
+// their atoms.  The substance is named by the `name` attribute of the
+// molecule, if any.  The molecule should have been sanitised; it is
+// not modified.
+func FromMolecule(mol *molecule.Molecule) (*Substance, error) {
+	frags, err := fragments(mol)
+	if err != nil {
+		return nil, err
+	}
+
+	s := New()
+	name, _ := mol.AttributeString("name")
+	s.SetName(name)
+	idx := make(map[molecule.MolHash]int, len(frags))
+	for _, iids := range frags {
+		c, err := mol.ExtractAtoms(iids)
+		if err != nil {
+			s.Release()
+			return nil, err
+		}
+
+		h, err := c.Hash128(molecule.HashStereo | molecule.HashIsotopes)
+		if err != nil {
+			c.Release()
+			s.Release()
+			return nil, err
+		}
+		if i, ok := idx[h]; ok {
+			s.components[i].Count++
+			c.Release()
+			continue
+		}
+		idx[h] = len(s.components)
+		s.Add(c, 1)
+	}
+	return s, nil
+}
+
+// fragments answers the input IDs of the atoms of the connected
+// components of the given molecule, each in ascending order, and the
+// components in the order of their first atoms.
+func fragments(mol *molecule.Molecule) ([][]uint16, error) {
+	nbrs := make(map[uint16][]uint16, mol.AtomCount())
+	iids := make([]uint16, 0, mol.AtomCount())
+	it := mol.Atoms()
+	for it.Next() {
+		a := it.Atom()
+		if a.AtomicNumber == 1 && len(a.Neighbours) == 0 && a.Charge == 0 {
+			continue
+		}
+		nbrs[a.Iid] = a.Neighbours
+		iids = append(iids, a.Iid)
+	}
+	if err := it.Err(); err != nil {
+		return nil, err
+	}
+	sort.Slice(iids, func(i, j int) bool { return iids[i] < iids[j] })
+
+	seen := make(map[uint16]bool, len(iids))
+	res := [][]uint16(nil)
+	for _, iid := range iids {
+		if seen[iid] {
+			continue
+		}
+		seen[iid] = true
+		frag := []uint16{iid}
+		for k := 0; k < len(frag); k++ {
+			for _, n := range nbrs[frag[k]] {
+				if !seen[n] {
+					seen[n] = true
+					frag = append(frag, n)
+				}
+			}
+		}
+		sort.Slice(frag, func(i, j int) bool { return frag[i] < frag[j] })
+		res = append(res, frag)
+	}
+	return res, nil
+}
+
+// Molecule answers a new molecule, in the given registry, or a passive
+// one, if `nil`, comprising copies of the components of this
+// substance, each as many times as its units, in order.  This is the
+// form in which substances are written as SMILES strings and molfiles;
+// see `FromMolecule`.  The substance is not modified.
+//
+// The enhanced stereo groups of the components are carried over to
+// their copies.  Since a racemic component is racemic in each of its
+// units independently, its `AND` and `OR` groups are numbered afresh
+// for each copy, in order; the `ABS` groups of all copies are joined.
+// The new molecule is named by this substance, if it has a name.
+func (s *Substance) Molecule(reg *molecule.MoleculeRegistry) (*molecule.Molecule, error) {
+	if err := s.validate(); err != nil {
+		return nil, err
+	}
+
+	mol := molecule.NewPassive()
+	if reg != nil {
+		mol = reg.NewMolecule()
+	}
+	fail := func(err error) (*molecule.Molecule, error) {
+		mol.Release()
+		return nil, err
+	}
+
+	abs := molecule.StereoGroup{Type: cmn.StereoGroupAbsolute}
+	groups := []molecule.StereoGroup(nil)
+	num := make(map[cmn.StereoGroupType]int)
+	for _, c := range s.components {
+		gs, err := c.Molecule.StereoGroups()
+		if err != nil {
+			return fail(err)
+		}
+		for k := 0; k < c.Count; k++ {
+			iids, err := mol.Merge(c.Molecule, nil)
+			if err != nil {
+				return fail(err)
+			}
+			for _, g := range gs {
+				atoms := make([]uint16, len(g.Atoms))
+				for i, iid := range g.Atoms {
+					atoms[i] = iids[iid]
+				}
+				if g.Type == cmn.StereoGroupAbsolute {
+					abs.Atoms = append(abs.Atoms, atoms...)
+					continue
+				}
+				num[g.Type]++
+				groups = append(groups, molecule.StereoGroup{Type: g.Type, Number: num[g.Type], Atoms: atoms})
+			}
+		}
+	}
+
+	if len(abs.Atoms) > 0 {
+		groups = append([]molecule.StereoGroup{abs}, groups...)
+	}
+	if len(groups) > 0 {
+		if err := mol.SetStereoGroups(groups...); err != nil {
+			return fail(err)
+		}
+	}
+	if s.name != "" {
+		if err := mol.SetAttribute("name", s.name); err != nil {
+			return fail(err)
+		}
+	}
+	return mol, nil
+}
@@ -0,0 +1,241 @@
+// Package substance represents substances made of several molecules:
+// salts, hydrates and formulated mixtures.
+//
+// A molecule is expected to be a single connected component.  A
+// substance, therefore, holds its components as separate molecules,
+// each with the number of its units in the substance: its
+// stoichiometry.
+package substance
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"strconv"
+
+	cmn "github.com/RxnWeaver/rxnweaver/common"
+	"github.com/RxnWeaver/rxnweaver/data/molecule"
+)
+
+// Kind represents the nature of a substance, as perceived from its
+// components.
+type Kind uint8
+
+const (
+	KindNone    Kind = iota // Without components.
+	KindSingle              // A single compound.
+	KindSalt                // Charged components.
+	KindHydrate             // A single compound with water.
+	KindMixture             // Anything else.
+)
+
+// Component is a molecule of a substance, with the number of its units
+// therein.
+type Component struct {
+	Molecule *molecule.Molecule
+	Count    int
+}
+
+// Substance represents a chemical substance, as a list of component
+// molecules, with their counts.
+//
+// The counts are relative: a hemihydrate has two units of its compound
+// for each of water.  Components are held in the order of their
+// addition.
+type Substance struct {
+	name       string
+	components []Component
+}
+
+// New creates and initialises an empty substance.
+func New() *Substance {
+	s := new(Substance)
+	s.components = make([]Component, 0, cmn.ListSizeTiny)
+	return s
+}
+
+// Add adds the given molecule to this substance, with the given number
+// of its units, which should be positive.  The molecule should be a
+// single connected component, and should have been sanitised.
+func (s *Substance) Add(mol *molecule.Molecule, count int) *Substance {
+	s.components = append(s.components, Component{mol, count})
+	return s
+}
+
+// Components answers the components of this substance.
+func (s *Substance) Components() []Component {
+	return s.components
+}
+
+// Name answers the name of this substance, if set.
+func (s *Substance) Name() string {
+	return s.name
+}
+
+// SetName sets the name of this substance.
+func (s *Substance) SetName(name string) *Substance {
+	s.name = name
+	return s
+}
+
+// Release releases the molecules of the components of this substance.
+// Neither this substance, nor its molecules, may be used thereafter.
+func (s *Substance) Release() {
+	for _, c := range s.components {
+		c.Molecule.Release()
+	}
+	s.components = nil
+}
+
+// ElementCounts answers the elemental composition of this substance,
+// as a map from atomic number to the number of atoms of that element,
+// its components being counted as many times as their units.
+func (s *Substance) ElementCounts() map[uint8]int {
+	counts := make(map[uint8]int)
+	for _, c := range s.components {
+		for atNum, n := range c.Molecule.ElementCounts() {
+			counts[atNum] += c.Count * n
+		}
+	}
+	return counts
+}
+
+// Weight answers the formula weight of this substance: the sum of the
+// molecular weights of its components, by their units.
+func (s *Substance) Weight() float64 {
+	w := 0.0
+	for _, c := range s.components {
+		w += float64(c.Count) * c.Molecule.Weight()
+	}
+	return w
+}
+
+// Formula answers the formula of this substance: those of its
+// components, in order, each preceded by its count, if greater than
+// one, and separated by dots, as in `C17H19NO3.HCl.3H2O`.
+func (s *Substance) Formula() string {
+	buf := new(bytes.Buffer)
+	for i, c := range s.components {
+		if i > 0 {
+			buf.WriteByte('.')
+		}
+		if c.Count > 1 {
+			buf.WriteString(strconv.Itoa(c.Count))
+		}
+		buf.WriteString(c.Molecule.Formula())
+	}
+	return buf.String()
+}
+
+// Charge answers the net charge of this substance; `0` for a balanced
+// salt.
+func (s *Substance) Charge() (int, error) {
+	res := 0
+	for _, c := range s.components {
+		ch, err := charge(c.Molecule)
+		if err != nil {
+			return 0, err
+		}
+		res += c.Count * ch
+	}
+	return res, nil
+}
+
+// charge answers the net charge of the given molecule.
+func charge(mol *molecule.Molecule) (int, error) {
+	res := 0
+	it := mol.Atoms()
+	for it.Next() {
+		res += int(it.Atom().Charge)
+	}
+	return res, it.Err()
+}
+
+// Kind answers the nature of this substance.  It is a salt should any
+// of its components be charged, as are those of sodium chloride; a
+// salt may also be a hydrate.  It is a hydrate should it comprise a
+// single compound and water.
+func (s *Substance) Kind() (Kind, error) {
+	formulae := make(map[string]bool)
+	for _, c := range s.components {
+		ch, err := charge(c.Molecule)
+		if err != nil {
+			return KindNone, err
+		}
+		if ch != 0 {
+			return KindSalt, nil
+		}
+		formulae[c.Molecule.Formula()] = true
+	}
+
+	switch {
+	case len(s.components) == 0:
+		return KindNone, nil
+	case len(s.components) == 1:
+		return KindSingle, nil
+	case len(s.components) == 2 && len(formulae) == 2 && formulae["H2O"]:
+		return KindHydrate, nil
+	}
+	return KindMixture, nil
+}
+
+// Hash128 answers a 128-bit hash of this substance, with the given
+// optional layers, as of `molecule.Molecule.Hash128`.  It covers the
+// hashes of its components, with their counts, reduced to their lowest
+// terms; it is independent of their order, and of their being added
+// once, or several times.  Thus, `2A.2B` hashes as `A.B` does.
+func (s *Substance) Hash128(opts molecule.HashOptions) (molecule.MolHash, error) {
+	counts := make(map[molecule.MolHash]int, len(s.components))
+	for _, c := range s.components {
+		h, err := c.Molecule.Hash128(opts)
+		if err != nil {
+			return molecule.MolHash{}, err
+		}
+		counts[h] += c.Count
+	}
+
+	keys := make([]molecule.MolHash, 0, len(counts))
+	div := 0
+	for k, n := range counts {
+		keys = append(keys, k)
+		div = gcd(div, n)
+	}
+	sort.Slice(keys, func(i, j int) bool { return bytes.Compare(keys[i][:], keys[j][:]) < 0 })
+
+	h := fnv.New128a()
+	buf := make([]byte, 8)
+	for _, k := range keys {
+		h.Write(k[:])
+		binary.LittleEndian.PutUint64(buf, uint64(counts[k]/div))
+		h.Write(buf)
+	}
+
+	res := molecule.MolHash{}
+	copy(res[:], h.Sum(nil))
+	return res, nil
+}
+
+// gcd answers the greatest common divisor of the given numbers; the
+// other, should either be `0`.
+func gcd(a, b int) int {
+	for b != 0 {
+		a, b = b, a%b
+	}
+	return a
+}
+
+// validate answers an error should this substance have no components,
+// or a component of a count that is not positive.
+func (s *Substance) validate() error {
+	if len(s.components) == 0 {
+		return fmt.Errorf("Substance has no components.")
+	}
+	for i, c := range s.components {
+		if c.Molecule == nil || c.Count <= 0 {
+			return fmt.Errorf("Invalid component %d of substance : count %d.", i+1, c.Count)
+		}
+	}
+	return nil
+}
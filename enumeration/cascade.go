@@ -0,0 +1,123 @@
+package enumeration
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/RxnWeaver/rxnweaver/data/molecule"
+)
+
+// Cascade chains several templates into a single one-pot sequence.
+// Each product of a step is fed, as the first reagent, to the next
+// step.
+//
+// A cascade is itself a template.  Its reagents are those of the
+// first step, followed by the additional reagents of each subsequent
+// step, in order.  Thus, a cascade of a two-reagent step followed by
+// another two-reagent step has an arity of three.
+type Cascade struct {
+	steps []Template
+
+	// check, when set, is consulted before each step after the first.
+	// A non-nil answer marks the intermediate as incompatible with the
+	// conditions of that step.
+	check func(intermediate *molecule.Molecule, step Template) error
+}
+
+// NewCascade creates a cascade of the given steps.  Every step after
+// the first must consume at least one reagent: the intermediate.
+func NewCascade(steps ...Template) (*Cascade, error) {
+	if len(steps) == 0 {
+		return nil, fmt.Errorf("A cascade needs at least one step.")
+	}
+	for i, s := range steps[1:] {
+		if s.Arity() < 1 {
+			return nil, fmt.Errorf("Step %d (%s) does not consume the intermediate.", i+2, s.Name())
+		}
+	}
+
+	return &Cascade{steps, nil}, nil
+}
+
+// CheckWith sets the function that tests each intermediate for
+// compatibility with the step it is about to enter.
+func (c *Cascade) CheckWith(check func(*molecule.Molecule, Template) error) *Cascade {
+	c.check = check
+	return c
+}
+
+// Name answers the names of the steps of this cascade, joined.
+func (c *Cascade) Name() string {
+	names := make([]string, len(c.steps))
+	for i, s := range c.steps {
+		names[i] = s.Name()
+	}
+	return strings.Join(names, " -> ")
+}
+
+// Arity answers the total number of external reagents consumed by
+// this cascade.
+func (c *Cascade) Arity() int {
+	n := c.steps[0].Arity()
+	for _, s := range c.steps[1:] {
+		n += s.Arity() - 1
+	}
+	return n
+}
+
+// Apply runs the steps of this cascade in order, and answers the
+// products of the final step.
+//
+// As with any template, a cascade whose steps do not match answers no
+// products, and no error: the cascade stops at the first step that
+// yields no intermediates.  Should every intermediate of some step
+// fail to react further, or be found incompatible, an error identifying
+// the step is answered.
+func (c *Cascade) Apply(reagents []*molecule.Molecule) ([]*molecule.Molecule, error) {
+	if len(reagents) != c.Arity() {
+		return nil, fmt.Errorf("Cascade %s needs %d reagents, given : %d", c.Name(), c.Arity(), len(reagents))
+	}
+
+	first := c.steps[0]
+	n := first.Arity()
+	inters, err := first.Apply(reagents[:n])
+	if err != nil {
+		return nil, fmt.Errorf("Step 1 (%s) failed : %v", first.Name(), err)
+	}
+	rest := reagents[n:]
+
+	for i, s := range c.steps[1:] {
+		if len(inters) == 0 {
+			return nil, nil
+		}
+
+		n = s.Arity() - 1
+		extra := rest[:n]
+		rest = rest[n:]
+
+		next := make([]*molecule.Molecule, 0, len(inters))
+		var lastErr error
+		for _, im := range inters {
+			if c.check != nil {
+				if err := c.check(im, s); err != nil {
+					lastErr = err
+					continue
+				}
+			}
+
+			prods, err := s.Apply(append([]*molecule.Molecule{im}, extra...))
+			if err != nil {
+				lastErr = err
+				continue
+			}
+			next = append(next, prods...)
+		}
+
+		if len(next) == 0 && lastErr != nil {
+			return nil, fmt.Errorf("Step %d (%s) incompatible with its intermediates : %v", i+2, s.Name(), lastErr)
+		}
+		inters = next
+	}
+
+	return inters, nil
+}
@@ -0,0 +1,196 @@
+package enumeration
+
+import (
+	"fmt"
+
+	"github.com/RxnWeaver/rxnweaver/data/molecule"
+)
+
+// Template is a reaction transformation that can be applied in the
+// forward direction to an ordered set of reagents.
+//
+// A template that does not match the given reagents answers an empty
+// list, not an error.
+type Template interface {
+	Name() string
+	Arity() int // Number of reagents consumed by one application.
+	Apply(reagents []*molecule.Molecule) ([]*molecule.Molecule, error)
+}
+
+// Product is a single result streamed by an enumerator.
+//
+// When `Err` is non-nil, the application of the template to the given
+// reagents failed, and `Molecule` is `nil`.
+//
+// For site templates, the product also carries the site at which it
+// was formed, its score, and whether it is a major product.  For other
+// templates, every product is labelled major.
+type Product struct {
+	Molecule *molecule.Molecule
+	Reagents []*molecule.Molecule
+	Err      error
+
+	Site    [][]uint16
+	Score   float64
+	IsMajor bool
+}
+
+// Enumerator applies a template to every combination of reagents
+// drawn from its reagent lists, one list per reagent position.
+type Enumerator struct {
+	tmpl     Template
+	reagents [][]*molecule.Molecule
+
+	// key answers the identity of a product, for de-duplication; `nil`
+	// for none.
+	key func(*molecule.Molecule) string
+	// scorer ranks the sites of site templates.
+	scorer SiteScorer
+}
+
+// New creates an enumerator for the given template and reagent lists.
+// The number of lists must equal the template's arity.
+//
+// Products are de-duplicated by their structure hashes, stereo and
+// isotopes included, as by `HashKey(DefaultHashOptions)`; see
+// `DeduplicateBy` for other identities, or none.
+func New(tmpl Template, reagents [][]*molecule.Molecule) (*Enumerator, error) {
+	if tmpl == nil {
+		return nil, fmt.Errorf("No template given.")
+	}
+	if len(reagents) != tmpl.Arity() {
+		return nil, fmt.Errorf("Template %s needs %d reagent lists, given : %d", tmpl.Name(), tmpl.Arity(), len(reagents))
+	}
+
+	return &Enumerator{tmpl: tmpl, reagents: reagents, key: HashKey(DefaultHashOptions)}, nil
+}
+
+// DefaultHashOptions are the layers of the structure hashes by which
+// an enumerator de-duplicates its products, unless told otherwise.
+const DefaultHashOptions = molecule.HashStereo | molecule.HashIsotopes
+
+// DeduplicateBy sets the function that answers the identity of a
+// product.  Products with an identity seen already are not streamed.
+// With `nil`, every product is streamed, duplicates included.
+func (en *Enumerator) DeduplicateBy(key func(*molecule.Molecule) string) *Enumerator {
+	en.key = key
+	return en
+}
+
+// HashKey answers an identity of products for `DeduplicateBy`: their
+// structure hashes, with the given optional layers.  Without the
+// isotope layer, labelled products are taken to be their unlabelled
+// parents; with it, they are kept distinct.  See
+// `molecule.Molecule.Hash128`.  A product that cannot be hashed is
+// identified by its ID, and so kept.
+func HashKey(opts molecule.HashOptions) func(*molecule.Molecule) string {
+	return func(mol *molecule.Molecule) string {
+		h, err := mol.Hash128(opts)
+		if err != nil {
+			return fmt.Sprintf("#%d", mol.Id())
+		}
+		return h.String()
+	}
+}
+
+// ScoreSitesWith sets the function that ranks the regiochemical
+// outcomes of a site template.
+func (en *Enumerator) ScoreSitesWith(scorer SiteScorer) *Enumerator {
+	en.scorer = scorer
+	return en
+}
+
+// outcomes applies the template of this enumerator to the given
+// reagents.  For a site template, every regiochemical outcome is
+// answered; otherwise, each product is answered as a major outcome.
+func (en *Enumerator) outcomes(reagents []*molecule.Molecule) ([]Outcome, error) {
+	if st, ok := en.tmpl.(SiteTemplate); ok {
+		return Regioisomers(st, reagents, en.scorer)
+	}
+
+	prods, err := en.tmpl.Apply(reagents)
+	if err != nil {
+		return nil, err
+	}
+
+	outs := make([]Outcome, len(prods))
+	for i, p := range prods {
+		outs[i] = Outcome{Molecule: p, IsMajor: true}
+	}
+	return outs, nil
+}
+
+// Combinations answers the total number of reagent combinations this
+// enumerator would try.
+func (en *Enumerator) Combinations() int {
+	if len(en.reagents) == 0 {
+		return 0
+	}
+
+	n := 1
+	for _, l := range en.reagents {
+		n *= len(l)
+	}
+	return n
+}
+
+// Run starts the enumeration, and answers the channel on which the
+// products are streamed.  The channel is closed when the enumeration
+// completes, or when `done` is closed.
+func (en *Enumerator) Run(done <-chan struct{}) <-chan Product {
+	out := make(chan Product, molecule.ReqChanSize)
+
+	go func() {
+		defer close(out)
+
+		seen := make(map[string]bool)
+		idxs := make([]int, len(en.reagents))
+		for c, n := 0, en.Combinations(); c < n; c++ {
+			set := make([]*molecule.Molecule, len(idxs))
+			for i, idx := range idxs {
+				set[i] = en.reagents[i][idx]
+			}
+
+			outs, err := en.outcomes(set)
+			if err != nil {
+				select {
+				case out <- Product{Reagents: set, Err: err}:
+				case <-done:
+					return
+				}
+			}
+			for _, o := range outs {
+				if en.key != nil {
+					k := en.key(o.Molecule)
+					if seen[k] {
+						continue
+					}
+					seen[k] = true
+				}
+
+				p := Product{Molecule: o.Molecule, Reagents: set, Site: o.Site, Score: o.Score, IsMajor: o.IsMajor}
+				select {
+				case out <- p:
+				case <-done:
+					return
+				}
+			}
+
+			en.advance(idxs)
+		}
+	}()
+
+	return out
+}
+
+// advance moves the given reagent indices to the next combination,
+// with the last position varying fastest.
+func (en *Enumerator) advance(idxs []int) {
+	for i := len(idxs) - 1; i >= 0; i-- {
+		idxs[i]++
+		if idxs[i] < len(en.reagents[i]) {
+			return
+		}
+		idxs[i] = 0
+	}
+}
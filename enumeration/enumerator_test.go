@@ -0,0 +1,88 @@
+package enumeration_test
+
+import (
+	"testing"
+
+	"github.com/RxnWeaver/rxnweaver/data/loader"
+	"github.com/RxnWeaver/rxnweaver/data/molecule"
+	"github.com/RxnWeaver/rxnweaver/enumeration"
+)
+
+// readSmiles answers the sanitised passive molecule of the given SMILES
+// string.
+func readSmiles(t *testing.T, smi string) *molecule.Molecule {
+	t.Helper()
+	mol, err := loader.ReadSmiles(nil, []byte(smi))
+	if err != nil {
+		t.Fatalf("%s : %v", smi, err)
+	}
+	rep, err := molecule.Sanitize(mol, 0)
+	if err == nil && rep.HasErrors() {
+		err = rep
+	}
+	if err != nil {
+		t.Fatalf("%s : %v", smi, err)
+	}
+	return mol
+}
+
+// _ConstTemplate is a template answering the same products, read from
+// their SMILES strings, for any reagent.
+type _ConstTemplate struct {
+	t    *testing.T
+	smis []string
+}
+
+func (c _ConstTemplate) Name() string { return "const" }
+func (c _ConstTemplate) Arity() int   { return 1 }
+
+func (c _ConstTemplate) Apply(reagents []*molecule.Molecule) ([]*molecule.Molecule, error) {
+	res := make([]*molecule.Molecule, len(c.smis))
+	for i, smi := range c.smis {
+		res[i] = readSmiles(c.t, smi)
+	}
+	return res, nil
+}
+
+func TestEnumeratorDeduplication(t *testing.T) {
+	tmpl := _ConstTemplate{t, []string{"c1ccccc1O", "OC1=CC=CC=C1", "C[C@H](N)O", "C[C@@H](N)O", "[2H]c1ccccc1O"}}
+	reagents := [][]*molecule.Molecule{{readSmiles(t, "C"), readSmiles(t, "CC")}}
+	tests := []struct {
+		name string
+		key  func(*molecule.Molecule) string
+		want int
+	}{
+		{"default", nil, 4},
+		{"one identity", func(*molecule.Molecule) string { return "" }, 1},
+		{"without stereo", enumeration.HashKey(molecule.HashIsotopes), 3},
+		{"without layers", enumeration.HashKey(0), 2},
+	}
+	for _, tt := range tests {
+		en, err := enumeration.New(tmpl, reagents)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tt.key != nil {
+			en.DeduplicateBy(tt.key)
+		}
+		n := 0
+		for p := range en.Run(nil) {
+			if p.Err != nil {
+				t.Fatalf("%s : %v", tt.name, p.Err)
+			}
+			n++
+		}
+		if n != tt.want {
+			t.Errorf("%s : %d products, want %d", tt.name, n, tt.want)
+		}
+	}
+
+	en, _ := enumeration.New(tmpl, reagents)
+	n := 0
+	for range en.DeduplicateBy(nil).Run(nil) {
+		n++
+	}
+	if n != 10 {
+		t.Errorf("opted out : %d products, want 10", n)
+	}
+}
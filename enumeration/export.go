@@ -0,0 +1,44 @@
+package enumeration
+
+import (
+	"fmt"
+
+	"github.com/RxnWeaver/rxnweaver/data/molecule"
+	"github.com/RxnWeaver/rxnweaver/network"
+)
+
+// Network answers the given enumeration results as a reaction
+// network, for export.
+//
+// Each distinct molecule becomes a network node, as does each
+// successful template application.  Edges point from reagents to
+// applications, and from applications to products.  Failed
+// applications are omitted.  Molecules are labelled using the given
+// function; their formulae are used when it is `nil`.
+func Network(name string, prods []Product, label func(*molecule.Molecule) string) *network.Network {
+	if label == nil {
+		label = (*molecule.Molecule).Formula
+	}
+
+	nw := network.New()
+	addMol := func(m *molecule.Molecule) string {
+		id := fmt.Sprintf("m%d", m.Id())
+		nw.AddNode(network.Node{Id: id, Label: label(m), Kind: network.NodeKindMolecule})
+		return id
+	}
+
+	for i, p := range prods {
+		if p.Err != nil {
+			continue
+		}
+
+		rid := fmt.Sprintf("r%d", i+1)
+		nw.AddNode(network.Node{Id: rid, Label: name, Kind: network.NodeKindReaction})
+		for _, rm := range p.Reagents {
+			nw.AddEdge(network.Edge{From: addMol(rm), To: rid})
+		}
+		nw.AddEdge(network.Edge{From: rid, To: addMol(p.Molecule)})
+	}
+
+	return nw
+}
@@ -0,0 +1,251 @@
+package enumeration
+
+import (
+	"fmt"
+	"sort"
+
+	cmn "github.com/RxnWeaver/rxnweaver/common"
+	"github.com/RxnWeaver/rxnweaver/data/molecule"
+)
+
+// Markush instantiates a scaffold bearing R-groups, as read from
+// molfiles or CXSMILES, with substituents, one for each R-group.
+//
+// A Markush scaffold is a template.  Its reagents are the substituents
+// of its R-groups, in the ascending order of their numbers; thus, a
+// scaffold bearing `R1` and `R3` has an arity of two.  An enumerator of
+// it draws the substituents of each R-group from its own list.
+//
+// Each `R` atom is replaced by its substituent, bonded to the
+// substituent's first attachment point: the atom so marked, if any;
+// else, the neighbour of its only `*` atom, which is dropped; else, its
+// first atom.  An `R` atom bonded to two atoms of the scaffold, as a
+// linker, is bonded through the second attachment point as well, to
+// the neighbour following in the order of their input IDs.  A lone
+// hydrogen atom stands for no substituent, the hydrogens of the
+// neighbours of its `R` atoms being raised instead.  Attachment atoms
+// give up a hydrogen for each bond they gain, if they have any.
+//
+// The products are sanitised.  The coordinates of their substituents
+// are those they were given, not laid out anew.  R-groups within
+// substituents are not instantiated.
+type Markush struct {
+	scaffold *molecule.Molecule
+	groups   []uint8 // Numbers of the R-groups, in ascending order.
+}
+
+// NewMarkush creates a Markush template of the given scaffold, which
+// must bear at least one R-group.  See `Markush`.
+func NewMarkush(scaffold *molecule.Molecule) (*Markush, error) {
+	seen := make(map[uint8]bool)
+	groups := []uint8(nil)
+	for it := scaffold.Atoms(); it.Next(); {
+		a := it.Atom()
+		if a.RGroup == 0 || seen[a.RGroup] {
+			continue
+		}
+		if len(a.Neighbours) > 2 {
+			return nil, fmt.Errorf("R-group %d at atom %d has more than two neighbours.", a.RGroup, a.Iid)
+		}
+		seen[a.RGroup] = true
+		groups = append(groups, a.RGroup)
+	}
+	if len(groups) == 0 {
+		return nil, fmt.Errorf("Scaffold %d bears no R-groups.", scaffold.Id())
+	}
+
+	sort.Slice(groups, func(i, j int) bool { return groups[i] < groups[j] })
+	return &Markush{scaffold, groups}, nil
+}
+
+// Name answers the name of this template.
+func (mk *Markush) Name() string {
+	return "markush"
+}
+
+// Arity answers the number of distinct R-groups of the scaffold.
+func (mk *Markush) Arity() int {
+	return len(mk.groups)
+}
+
+// Groups answers the numbers of the R-groups of the scaffold, in the
+// order of the substituents expected by `Apply`.
+func (mk *Markush) Groups() []int {
+	res := make([]int, len(mk.groups))
+	for i, g := range mk.groups {
+		res[i] = int(g)
+	}
+	return res
+}
+
+// Apply answers the single product of replacing each R-group of the
+// scaffold by the corresponding given substituent.
+func (mk *Markush) Apply(subs []*molecule.Molecule) ([]*molecule.Molecule, error) {
+	if len(subs) != mk.Arity() {
+		return nil, fmt.Errorf("Markush scaffold needs %d substituents, given : %d", mk.Arity(), len(subs))
+	}
+	bySub := make(map[uint8]*molecule.Molecule, len(subs))
+	for i, g := range mk.groups {
+		bySub[g] = subs[i]
+	}
+
+	prod, err := mk.scaffold.Clone()
+	if err != nil {
+		return nil, err
+	}
+	fail := func(err error) ([]*molecule.Molecule, error) {
+		prod.Release()
+		return nil, err
+	}
+
+	rs := []molecule.AtomInfo(nil)
+	for it := prod.Atoms(); it.Next(); {
+		if a := it.Atom(); a.RGroup != 0 {
+			rs = append(rs, a)
+		}
+	}
+	for _, r := range rs {
+		if err := substitute(prod, r, bySub[r.RGroup]); err != nil {
+			return fail(fmt.Errorf("R-group %d at atom %d : %v", r.RGroup, r.Iid, err))
+		}
+	}
+
+	if _, err := molecule.Sanitize(prod, 0); err != nil {
+		return fail(err)
+	}
+	return []*molecule.Molecule{prod}, nil
+}
+
+// substitute replaces the given `R` atom of the given molecule by the
+// given substituent.
+func substitute(mol *molecule.Molecule, r molecule.AtomInfo, sub *molecule.Molecule) error {
+	nbrs := append([]uint16(nil), r.Neighbours...)
+	sort.Slice(nbrs, func(i, j int) bool { return nbrs[i] < nbrs[j] })
+	types := make([]cmn.BondType, len(nbrs))
+	for i, nbr := range nbrs {
+		b, err := mol.BondBetween(r.Iid, nbr)
+		if err != nil {
+			return err
+		}
+		types[i] = b.KekuleType
+	}
+	if err := mol.RemoveAtom(r.Iid); err != nil {
+		return err
+	}
+
+	if isHydrogen(sub) {
+		for i, nbr := range nbrs {
+			if err := raiseHydrogens(mol, nbr, types[i].Order()); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	att, star, err := attachments(sub)
+	if err != nil {
+		return err
+	}
+	if len(nbrs) == 0 {
+		_, err := mol.Merge(sub, nil)
+		return err
+	}
+	if len(nbrs) == 2 && len(att) < 2 {
+		return fmt.Errorf("Substituent %d has no second attachment point.", sub.Id())
+	}
+
+	iids, err := mol.Merge(sub, &molecule.MergeLink{Atom: nbrs[0], OtherAtom: att[0], Type: types[0]})
+	if err != nil {
+		return err
+	}
+	if len(nbrs) == 2 {
+		if err := mol.NewBondBuilder().Connect(int(nbrs[1]), int(iids[att[1]])).Type(types[1]).Add(); err != nil {
+			return err
+		}
+	}
+	if star != nil {
+		if err := mol.RemoveAtom(iids[star.Iid]); err != nil {
+			return err
+		}
+	}
+
+	for i, iid := range att[:len(nbrs)] {
+		if i == 0 && star != nil {
+			continue // The bond to the `*` atom is replaced.
+		}
+		if err := raiseHydrogens(mol, iids[iid], -types[i].Order()); err != nil {
+			return err
+		}
+	}
+	for _, iid := range iids {
+		if a, err := mol.AtomInfo(iid); err == nil && a.Attachment != 0 {
+			if err := mol.SetAttachment(iid, 0); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// attachments answers the input IDs of the atoms of the given
+// substituent at its first attachment point, and at its second, if
+// any, and its `*` atom marking the first, if any.  See `Markush`.
+func attachments(sub *molecule.Molecule) ([]uint16, *molecule.AtomInfo, error) {
+	pts := [2]*molecule.AtomInfo{}
+	stars := []molecule.AtomInfo(nil)
+	var first *molecule.AtomInfo
+	for it := sub.Atoms(); it.Next(); {
+		a := it.Atom()
+		if first == nil {
+			first = &a
+		}
+		for k := uint8(0); k < 2; k++ {
+			if a.Attachment&(1<<k) != 0 && pts[k] == nil {
+				pts[k] = &a
+			}
+		}
+		if a.Symbol == "Q_STAR" {
+			stars = append(stars, a)
+		}
+	}
+	if first == nil {
+		return nil, nil, fmt.Errorf("Substituent %d has no atoms.", sub.Id())
+	}
+
+	att, star := []uint16{first.Iid}, (*molecule.AtomInfo)(nil)
+	switch {
+	case pts[0] != nil:
+		att[0] = pts[0].Iid
+	case len(stars) == 1 && len(stars[0].Neighbours) == 1:
+		att[0], star = stars[0].Neighbours[0], &stars[0]
+	}
+	if pts[1] != nil {
+		att = append(att, pts[1].Iid)
+	}
+	return att, star, nil
+}
+
+// isHydrogen answers if the given substituent is a lone hydrogen atom,
+// not isotopic.
+func isHydrogen(sub *molecule.Molecule) bool {
+	it := sub.Atoms()
+	if it.Len() != 1 || !it.Next() {
+		return false
+	}
+	a := it.Atom()
+	return a.AtomicNumber == 1 && a.Isotope == 0
+}
+
+// raiseHydrogens raises the hydrogen count of the given atom by the
+// given number, or lowers it, though not below `0`.
+func raiseHydrogens(mol *molecule.Molecule, iid uint16, n int) error {
+	a, err := mol.AtomInfo(iid)
+	if err != nil {
+		return err
+	}
+	h := int(a.HCount) + n
+	if h < 0 {
+		h = 0
+	}
+	return mol.SetAtomHCount(iid, uint8(h))
+}
@@ -0,0 +1,117 @@
+package enumeration
+
+import (
+	"fmt"
+
+	"github.com/RxnWeaver/rxnweaver/data/molecule"
+	"github.com/RxnWeaver/rxnweaver/synthesis"
+)
+
+// MetabolicLibrary lists common metabolic (phase I and phase II) and
+// hydrolytic transformations, used to predict likely metabolites and
+// degradants; see `MetabolicTemplates`.  The yield priors reflect
+// rough relative frequencies of the transformations in drug
+// metabolism.
+var MetabolicLibrary = synthesis.Library{
+	Name:    "metabolism",
+	Version: "1",
+	Rules: []synthesis.RuleSpec{
+		{Name: "ester hydrolysis", Smirks: "[C:1](=[O:2])[O:3][#6:4]>>[C:1](=[O:2])[OH].[OH:3][#6:4]", YieldPrior: 0.9},
+		{Name: "amide hydrolysis", Smirks: "[C:1](=[O:2])[NX3:3]>>[C:1](=[O:2])[OH].[N:3]", YieldPrior: 0.4},
+		{Name: "N-dealkylation", Smirks: "[NX3:1][CH3:2]>>[N:1].[CH2:2]=O", YieldPrior: 0.8},
+		{Name: "O-dealkylation", Smirks: "[c:1][O:2][CH3:3]>>[c:1][OH:2].[CH2:3]=O", YieldPrior: 0.8},
+		{Name: "aromatic hydroxylation", Smirks: "[cH:1]>>[c:1][OH]", YieldPrior: 0.6},
+		{Name: "aliphatic hydroxylation", Smirks: "[CH3:1][C:2]>>[CH2:1]([OH])[C:2]", YieldPrior: 0.5},
+		{Name: "S-oxidation", Smirks: "[SX2:1]([#6:2])[#6:3]>>[S:1](=O)([#6:2])[#6:3]", YieldPrior: 0.6},
+		{Name: "N-oxidation", Smirks: "[NX3;H0:1]([C:2])([C:3])[C:4]>>[N+:1]([O-])([C:2])([C:3])[C:4]", YieldPrior: 0.3},
+		{Name: "alcohol oxidation", Smirks: "[CH2:1][OH:2]>>[CH:1]=[O:2]", YieldPrior: 0.5},
+		{Name: "glucuronidation", Smirks: "[#6:1][OH:2]>>[#6:1][O:2]C1OC(C(=O)O)C(O)C(O)C1O", YieldPrior: 0.7},
+		{Name: "sulfation", Smirks: "[c:1][OH:2]>>[c:1][O:2]S(=O)(=O)O", YieldPrior: 0.4},
+		{Name: "N-acetylation", Smirks: "[c:1][NH2:2]>>[c:1][NH:2]C(C)=O", YieldPrior: 0.5},
+	},
+}
+
+// MetabolicTemplates answers the templates applying the
+// transformations of `MetabolicLibrary`, for `PredictMetabolites`.
+func MetabolicTemplates() ([]Template, error) {
+	return LibraryTemplates(&MetabolicLibrary)
+}
+
+// Metabolite is a predicted metabolite or degradant, along with the
+// transformations that lead to it from the parent molecule.
+type Metabolite struct {
+	Molecule   *molecule.Molecule
+	Parent     *Metabolite // `nil` for first-generation metabolites.
+	Rule       string      // Transformation applied to the parent.
+	Generation int         // `1` for direct metabolites of the input.
+}
+
+// Provenance answers the names of the transformations that lead from
+// the input molecule to this metabolite, in the order applied.
+func (mt *Metabolite) Provenance() []string {
+	rules := make([]string, mt.Generation)
+	for m := mt; m != nil; m = m.Parent {
+		rules[m.Generation-1] = m.Rule
+	}
+	return rules
+}
+
+// PredictMetabolites applies each of the given single-reagent
+// transformations, as those of `MetabolicTemplates`, to the given
+// molecule, and then to each metabolite so obtained, up to the given
+// number of generations.
+//
+// When a key function is given, a metabolite with an identity seen
+// already (including that of the input) is not expanded again.
+func PredictMetabolites(mol *molecule.Molecule, tmpls []Template, maxGen int, key func(*molecule.Molecule) string) ([]*Metabolite, error) {
+	for _, t := range tmpls {
+		if t.Arity() != 1 {
+			return nil, fmt.Errorf("Transformation %s is not unimolecular.", t.Name())
+		}
+	}
+
+	seen := make(map[string]bool)
+	if key != nil {
+		seen[key(mol)] = true
+	}
+
+	res := make([]*Metabolite, 0)
+	frontier := []*Metabolite{{Molecule: mol}}
+	var firstErr error
+	for gen := 1; gen <= maxGen && len(frontier) > 0; gen++ {
+		next := make([]*Metabolite, 0)
+		for _, pm := range frontier {
+			parent := pm
+			if gen == 1 {
+				parent = nil
+			}
+
+			for _, t := range tmpls {
+				prods, err := t.Apply([]*molecule.Molecule{pm.Molecule})
+				if err != nil {
+					if firstErr == nil {
+						firstErr = fmt.Errorf("Transformation %s failed : %v", t.Name(), err)
+					}
+					continue
+				}
+
+				for _, p := range prods {
+					if key != nil {
+						k := key(p)
+						if seen[k] {
+							continue
+						}
+						seen[k] = true
+					}
+
+					m := &Metabolite{p, parent, t.Name(), gen}
+					res = append(res, m)
+					next = append(next, m)
+				}
+			}
+		}
+		frontier = next
+	}
+
+	return res, firstErr
+}
@@ -0,0 +1,67 @@
+package enumeration_test
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/RxnWeaver/rxnweaver/data/loader"
+	"github.com/RxnWeaver/rxnweaver/data/molecule"
+	"github.com/RxnWeaver/rxnweaver/enumeration"
+)
+
+// canonical answers the canonical SMILES string of the given molecule.
+func canonical(t *testing.T, mol *molecule.Molecule) string {
+	t.Helper()
+	smi, err := loader.CanonicalSmiles(mol, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return smi
+}
+
+func TestPredictMetabolites(t *testing.T) {
+	tmpls, err := enumeration.MetabolicTemplates()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		smi  string
+		want []string // Of the first generation, as `rule : SMILES`.
+	}{
+		{"COC(=O)c1ccc(OC)cc1", []string{
+			"ester hydrolysis : CO",
+			"ester hydrolysis : OC(=O)c1ccc(OC)cc1",
+			"O-dealkylation : COC(=O)c1ccc(O)cc1",
+			"O-dealkylation : C=O",
+			"aromatic hydroxylation : COC(=O)c1ccc(OC)cc1O",
+			"aromatic hydroxylation : COC(=O)c1ccc(OC)c(O)c1",
+		}},
+		{"CCO", []string{
+			"aliphatic hydroxylation : OCCO",
+			"alcohol oxidation : CC=O",
+			"glucuronidation : CCOC1OC(C(=O)O)C(O)C(O)C1O",
+		}},
+	}
+	for _, tt := range tests {
+		ms, err := enumeration.PredictMetabolites(readSmiles(t, tt.smi), tmpls, 1, enumeration.HashKey(0))
+		if err != nil {
+			t.Fatalf("%s : %v", tt.smi, err)
+		}
+		got := make([]string, len(ms))
+		for i, m := range ms {
+			got[i] = m.Rule + " : " + canonical(t, m.Molecule)
+		}
+		want := make([]string, len(tt.want))
+		for i, w := range tt.want {
+			f := strings.SplitN(w, " : ", 2)
+			want[i] = f[0] + " : " + canonical(t, readSmiles(t, f[1]))
+		}
+		sort.Strings(got)
+		sort.Strings(want)
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s : %v, want %v", tt.smi, got, want)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package enumeration
+
+import (
+	"sort"
+
+	"github.com/RxnWeaver/rxnweaver/data/molecule"
+)
+
+// Outcome is the result of applying a template at one particular site
+// of its reagents.
+type Outcome struct {
+	Molecule *molecule.Molecule
+	// Input IDs of the reagent atoms forming the reaction centre, one
+	// list per reagent.
+	Site [][]uint16
+
+	Score   float64 // As assigned by the site scorer.
+	IsMajor bool    // Is this the (or a) best-scoring outcome?
+}
+
+// SiteTemplate is a template that can report each of the sites at
+// which it matches its reagents, rather than only the products.
+//
+// Templates implementing this interface, as `SmirksTemplate`, have
+// every regiochemical outcome enumerated, instead of only the first
+// match.
+type SiteTemplate interface {
+	Template
+	Outcomes(reagents []*molecule.Molecule) ([]Outcome, error)
+}
+
+// SiteScorer answers a score for the given reaction site of the given
+// reagents.  Higher scores indicate more favoured sites.  Typical
+// heuristics consider steric hindrance, and the electronic
+// activation of the site atoms.
+type SiteScorer func(reagents []*molecule.Molecule, site [][]uint16) float64
+
+// Regioisomers applies the given template to the given reagents at
+// every matching site, and answers all outcomes in descending order of
+// score.  Every outcome with the highest score is labelled major; the
+// rest are labelled minor.
+//
+// When no scorer is given, all outcomes are labelled major.
+func Regioisomers(t SiteTemplate, reagents []*molecule.Molecule, scorer SiteScorer) ([]Outcome, error) {
+	outs, err := t.Outcomes(reagents)
+	if err != nil {
+		return nil, err
+	}
+	if len(outs) == 0 {
+		return outs, nil
+	}
+
+	if scorer != nil {
+		for i := range outs {
+			outs[i].Score = scorer(reagents, outs[i].Site)
+		}
+		sort.Stable(byOutcomeScore(outs))
+	}
+
+	best := outs[0].Score
+	for i := range outs {
+		outs[i].IsMajor = outs[i].Score == best
+	}
+	return outs, nil
+}
+
+// byOutcomeScore sorts outcomes in descending order of score.
+type byOutcomeScore []Outcome
+
+func (s byOutcomeScore) Len() int           { return len(s) }
+func (s byOutcomeScore) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s byOutcomeScore) Less(i, j int) bool { return s[i].Score > s[j].Score }
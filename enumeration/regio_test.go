@@ -0,0 +1,83 @@
+package enumeration_test
+
+import (
+	"testing"
+
+	"github.com/RxnWeaver/rxnweaver/data/molecule"
+	"github.com/RxnWeaver/rxnweaver/enumeration"
+)
+
+func TestRegioisomers(t *testing.T) {
+	hydroxylation, err := enumeration.NewSmirksTemplate("aromatic hydroxylation", "[cH:1]>>[c:1][OH]")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Favours the para position of toluene, `Cc1ccccc1`, at atom 4.
+	para := func(reagents []*molecule.Molecule, site [][]uint16) float64 {
+		if len(site) == 1 && len(site[0]) == 1 && site[0][0] == 4 {
+			return 1
+		}
+		return 0
+	}
+	tests := []struct {
+		smi    string
+		scorer enumeration.SiteScorer
+		sites  [][]uint16 // Of the major outcomes, one atom each.
+		count  int
+	}{
+		{"Cc1ccccc1", nil, [][]uint16{{2}, {3}, {4}}, 3},
+		{"Cc1ccccc1", para, [][]uint16{{4}}, 3},
+		{"c1ccccc1", nil, [][]uint16{{0}}, 1},
+		{"CC", nil, nil, 0},
+	}
+	for _, tt := range tests {
+		outs, err := enumeration.Regioisomers(hydroxylation, []*molecule.Molecule{readSmiles(t, tt.smi)}, tt.scorer)
+		if err != nil {
+			t.Fatalf("%s : %v", tt.smi, err)
+		}
+		if len(outs) != tt.count {
+			t.Errorf("%s : %d outcomes, want %d", tt.smi, len(outs), tt.count)
+			continue
+		}
+		major := make(map[uint16]bool)
+		for _, o := range outs {
+			if o.IsMajor {
+				major[o.Site[0][0]] = true
+			}
+		}
+		if len(major) != len(tt.sites) {
+			t.Errorf("%s : major sites %v, want %v", tt.smi, major, tt.sites)
+			continue
+		}
+		for _, s := range tt.sites {
+			if !major[s[0]] {
+				t.Errorf("%s : major sites %v, want %v", tt.smi, major, tt.sites)
+				break
+			}
+		}
+	}
+}
+
+func TestEnumeratorSites(t *testing.T) {
+	hydroxylation, err := enumeration.NewSmirksTemplate("aromatic hydroxylation", "[cH:1]>>[c:1][OH]")
+	if err != nil {
+		t.Fatal(err)
+	}
+	en, err := enumeration.New(hydroxylation, [][]*molecule.Molecule{{readSmiles(t, "Cc1ccccc1"), readSmiles(t, "c1ccccc1")}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := 0
+	for p := range en.Run(nil) {
+		if p.Err != nil {
+			t.Fatal(p.Err)
+		}
+		if len(p.Site) != 1 || len(p.Site[0]) != 1 {
+			t.Errorf("%s : site %v", canonical(t, p.Molecule), p.Site)
+		}
+		n++
+	}
+	if n != 4 {
+		t.Errorf("%d products, want 4", n)
+	}
+}
@@ -0,0 +1,420 @@
+package enumeration
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+
+	cmn "github.com/RxnWeaver/rxnweaver/common"
+	"github.com/RxnWeaver/rxnweaver/data/molecule"
+)
+
+// maxCoreMaps bounds the maps of a core tried in each molecule, since
+// a core of high symmetry maps in many ways.
+const maxCoreMaps = 1000
+
+// RGroupRow is the decomposition of a molecule into a core and its
+// substituents, by R-group.
+//
+// The core and the substituents are new molecules, extracted from the
+// molecule, and tracked by its registry, unless it is passive, in which
+// case so are they.  Each bond to a substituent is replaced by
+// hydrogens on the core, and on the substituent, whose atoms so bonded
+// are marked as its attachment points, in the order of the core atoms;
+// see `AtomInfo`.  A substituent of a single hydrogen atom stands for
+// an R-group left unsubstituted.  Thus, the substituents may be given
+// to a `Markush` of the core to build the molecule afresh.
+type RGroupRow struct {
+	Molecule *molecule.Molecule
+	Core     *molecule.Molecule
+	Map      map[uint16]uint16          // Of the input IDs of the core's atoms to those of the molecule's.
+	RGroups  map[int]*molecule.Molecule // Substituents, by the numbers of their R-groups.
+}
+
+// RGroupTable is the decomposition of a series of molecules against a
+// core, for the analysis of their structure-activity relationships.
+type RGroupTable struct {
+	Groups    []int // Numbers of the R-groups of all rows, in ascending order.
+	Rows      []RGroupRow
+	Unmatched []*molecule.Molecule // Molecules in which the core does not occur.
+}
+
+// _RGroupAttachment is a bond from an atom of a core to an atom of a
+// substituent, in a molecule.
+type _RGroupAttachment struct {
+	core uint16 // Input ID of the core atom.
+	atom uint16 // Input ID of the substituent atom.
+	frag int    // Index of the connected fragment of the substituent atom.
+}
+
+// _RGroupPart is the substituent of an R-group, in a molecule: its
+// fragments, and its attachments to the core.
+type _RGroupPart struct {
+	frags []int
+	atts  []_RGroupAttachment
+}
+
+// _RGroupDecomposition is the decomposition of a molecule by a map of
+// a core.  Its parts are keyed by the numbers of their R-groups, and,
+// for substituents at core atoms bearing no free R-groups, by the
+// negated input IDs of those atoms; parts of unsubstituted R-groups
+// are `nil`.
+type _RGroupDecomposition struct {
+	match      map[uint16]uint16
+	frags      [][]uint16 // Atoms of the fragments, in ascending order.
+	parts      map[int]*_RGroupPart
+	unlabelled int    // Substituents at core atoms bearing no free R-groups.
+	filled     uint64 // R-groups substituted, the lowest numbered as the highest bits.
+}
+
+// DecomposeRGroups decomposes each of the given molecules into the
+// given core and its substituents, aligned by R-group.
+//
+// The core is a scaffold whose `R` atoms, numbered as by
+// `AtomBuilder.RGroup`, mark where its substituents are expected; the
+// other atoms are matched as a substructure query, and should have
+// been sanitised alike.  Each connected fragment of the atoms of a
+// molecule outside the core is a substituent of the R-group bonded to
+// its core atom.  Several substituents at one core atom are given to
+// its R-groups in turn, in the order of their first atoms, and a
+// substituent bonded to several core atoms, as a ring fused to the
+// core, takes up an R-group at each.  Substituents at core atoms
+// bearing no free R-groups are gathered, by core atom, into new
+// R-groups, numbered after the highest of the core, in the order they
+// are found; their numbers hold across the molecules.  Fragments not
+// bonded to the core, as counter-ions, are left out.
+//
+// Where the core maps into a molecule in several ways, as a symmetric
+// core does, the map leaving the fewest substituents outside the
+// R-groups of the core is taken, and of those, the one substituting
+// the lowest numbered R-groups.  Molecules in which the core does not
+// occur are listed apart.
+//
+// The molecules are not modified.  See `RGroupRow`.
+func DecomposeRGroups(core *molecule.Molecule, mols []*molecule.Molecule) (*RGroupTable, error) {
+	labels := make(map[uint16][]int) // R-groups, by the core atoms bearing them.
+	keep := []uint16(nil)
+	last := 0
+	for it := core.Atoms(); it.Next(); {
+		a := it.Atom()
+		if a.RGroup == 0 {
+			keep = append(keep, a.Iid)
+			continue
+		}
+		for _, nbr := range a.Neighbours {
+			labels[nbr] = append(labels[nbr], int(a.RGroup))
+		}
+		if int(a.RGroup) > last {
+			last = int(a.RGroup)
+		}
+	}
+	if len(keep) == 0 {
+		return nil, fmt.Errorf("Core %d has no atoms but R-groups.", core.Id())
+	}
+	for _, ls := range labels {
+		sort.Ints(ls)
+	}
+	sort.Slice(keep, func(i, j int) bool { return keep[i] < keep[j] })
+
+	query, err := core.ExtractAtoms(keep)
+	if err != nil {
+		return nil, err
+	}
+	defer query.Release()
+
+	t := &RGroupTable{}
+	numbers := make(map[int]int) // Of new R-groups, by their keys.
+	seen := make(map[int]bool)
+	for _, ls := range labels {
+		for _, n := range ls {
+			seen[n] = true
+		}
+	}
+	for _, mol := range mols {
+		maps, err := mol.SubstructureMaps(query, maxCoreMaps)
+		if err != nil {
+			t.Release()
+			return nil, err
+		}
+		if len(maps) == 0 {
+			t.Unmatched = append(t.Unmatched, mol)
+			continue
+		}
+
+		atoms := make(map[uint16]molecule.AtomInfo, mol.AtomCount())
+		for it := mol.Atoms(); it.Next(); {
+			a := it.Atom()
+			atoms[a.Iid] = a
+		}
+		var best *_RGroupDecomposition
+		for _, m := range maps {
+			d := decompose(m, keep, labels, atoms)
+			if best == nil || d.unlabelled < best.unlabelled || d.unlabelled == best.unlabelled && d.filled > best.filled {
+				best = d
+			}
+		}
+
+		row, err := best.row(mol, func(k int) int {
+			if k > 0 {
+				return k
+			}
+			if _, ok := numbers[k]; !ok {
+				last++
+				numbers[k] = last
+			}
+			return numbers[k]
+		})
+		if err != nil {
+			t.Release()
+			return nil, err
+		}
+		t.Rows = append(t.Rows, row)
+		for n := range row.RGroups {
+			seen[n] = true
+		}
+	}
+
+	for n := range seen {
+		t.Groups = append(t.Groups, n)
+	}
+	sort.Ints(t.Groups)
+	return t, nil
+}
+
+// decompose answers the decomposition of a molecule, of the given
+// atoms, by the given map of the given core atoms, bearing the given
+// R-groups.  See `DecomposeRGroups`.
+func decompose(match map[uint16]uint16, core []uint16, labels map[uint16][]int, atoms map[uint16]molecule.AtomInfo) *_RGroupDecomposition {
+	d := &_RGroupDecomposition{match: match, parts: make(map[int]*_RGroupPart)}
+	inCore := make(map[uint16]bool, len(match))
+	for _, iid := range match {
+		inCore[iid] = true
+	}
+
+	// Fragments outside the core.  Atoms without neighbours, as
+	// hydrogens counted in their former neighbours, are left out.
+	iids := make([]uint16, 0, len(atoms))
+	for iid := range atoms {
+		iids = append(iids, iid)
+	}
+	sort.Slice(iids, func(i, j int) bool { return iids[i] < iids[j] })
+	fragOf := make(map[uint16]int)
+	for _, iid := range iids {
+		if _, ok := fragOf[iid]; ok || inCore[iid] || len(atoms[iid].Neighbours) == 0 {
+			continue
+		}
+		f := len(d.frags)
+		fragOf[iid] = f
+		frag := []uint16{iid}
+		for k := 0; k < len(frag); k++ {
+			for _, nbr := range atoms[frag[k]].Neighbours {
+				if _, ok := fragOf[nbr]; !ok && !inCore[nbr] {
+					fragOf[nbr] = f
+					frag = append(frag, nbr)
+				}
+			}
+		}
+		sort.Slice(frag, func(i, j int) bool { return frag[i] < frag[j] })
+		d.frags = append(d.frags, frag)
+	}
+
+	used := make(map[int]bool)
+	keyOf := make(map[int]int) // Of the fragments, by index.
+	nextFree := func(q uint16) (int, bool) {
+		for _, n := range labels[q] {
+			if !used[n] {
+				used[n] = true
+				return n, true
+			}
+		}
+		return 0, false
+	}
+	for _, q := range core {
+		t := match[q]
+		nbrs := append([]uint16(nil), atoms[t].Neighbours...)
+		sort.Slice(nbrs, func(i, j int) bool { return nbrs[i] < nbrs[j] })
+		for _, nbr := range nbrs {
+			f, ok := fragOf[nbr]
+			if !ok {
+				continue
+			}
+			att := _RGroupAttachment{t, nbr, f}
+
+			if k, ok := keyOf[f]; ok {
+				d.parts[k].atts = append(d.parts[k].atts, att)
+				nextFree(q)
+				continue
+			}
+			k, ok := nextFree(q)
+			if !ok {
+				k = -int(q)
+				d.unlabelled++
+			} else {
+				d.filled |= 1 << uint(cmn.MaxRGroup-k)
+			}
+			keyOf[f] = k
+			p := d.parts[k]
+			if p == nil {
+				p = &_RGroupPart{}
+				d.parts[k] = p
+			}
+			p.frags = append(p.frags, f)
+			p.atts = append(p.atts, att)
+		}
+	}
+	for _, ls := range labels {
+		for _, n := range ls {
+			if !used[n] {
+				d.parts[n] = nil
+			}
+		}
+	}
+	return d
+}
+
+// row answers the row of this decomposition of the given molecule,
+// numbering its R-groups by their keys with the given function.
+func (d *_RGroupDecomposition) row(mol *molecule.Molecule, number func(k int) int) (RGroupRow, error) {
+	row := RGroupRow{Molecule: mol, Map: d.match, RGroups: make(map[int]*molecule.Molecule, len(d.parts))}
+	fail := func(err error) (RGroupRow, error) {
+		row.release()
+		return RGroupRow{}, err
+	}
+
+	coreAtoms := make([]uint16, 0, len(d.match))
+	for _, iid := range d.match {
+		coreAtoms = append(coreAtoms, iid)
+	}
+	sort.Slice(coreAtoms, func(i, j int) bool { return coreAtoms[i] < coreAtoms[j] })
+	c, err := mol.ExtractAtoms(coreAtoms)
+	if err != nil {
+		return fail(err)
+	}
+	row.Core = c
+
+	keys := make([]int, 0, len(d.parts))
+	for k := range d.parts {
+		keys = append(keys, k)
+	}
+	sort.Ints(keys)
+	for _, k := range keys {
+		p := d.parts[k]
+		if p == nil {
+			h, err := hydrogen(mol)
+			if err != nil {
+				return fail(err)
+			}
+			row.RGroups[number(k)] = h
+			continue
+		}
+
+		iids := []uint16(nil)
+		for _, f := range p.frags {
+			iids = append(iids, d.frags[f]...)
+		}
+		sort.Slice(iids, func(i, j int) bool { return iids[i] < iids[j] })
+		sub, err := mol.ExtractAtoms(iids)
+		if err != nil {
+			return fail(err)
+		}
+		row.RGroups[number(k)] = sub
+
+		points := make(map[uint16]uint8)
+		for i, att := range p.atts {
+			b, err := mol.BondBetween(att.core, att.atom)
+			if err != nil {
+				return fail(err)
+			}
+			if err := raiseHydrogens(sub, att.atom, b.KekuleType.Order()); err != nil {
+				return fail(err)
+			}
+			if err := raiseHydrogens(c, att.core, b.KekuleType.Order()); err != nil {
+				return fail(err)
+			}
+			if i < 2 {
+				points[att.atom] |= 1 << uint(i)
+			}
+		}
+		for iid, pts := range points {
+			if err := sub.SetAttachment(iid, pts); err != nil {
+				return fail(err)
+			}
+		}
+		if _, err := molecule.Sanitize(sub, 0); err != nil {
+			return fail(err)
+		}
+	}
+	if _, err := molecule.Sanitize(c, 0); err != nil {
+		return fail(err)
+	}
+	return row, nil
+}
+
+// hydrogen answers a new molecule of a single hydrogen atom, tracked by
+// the registry of the given molecule, unless it is passive, in which
+// case so is the new one.
+func hydrogen(mol *molecule.Molecule) (*molecule.Molecule, error) {
+	var h *molecule.Molecule
+	if reg := mol.Registry(); reg != nil {
+		h = reg.NewMolecule()
+	} else {
+		h = molecule.NewPassive()
+	}
+	h.NewAtomBuilder().Element("H").Add()
+	if err := h.Build(); err != nil {
+		h.Release()
+		return nil, err
+	}
+	return h, nil
+}
+
+// release releases the core and the substituents of this row.
+func (row *RGroupRow) release() {
+	if row.Core != nil {
+		row.Core.Release()
+	}
+	for _, sub := range row.RGroups {
+		sub.Release()
+	}
+}
+
+// Release releases the cores and the substituents of the rows of this
+// table, but not their molecules.  Neither the rows, nor their cores
+// and substituents, may be used thereafter.
+func (t *RGroupTable) Release() {
+	for i := range t.Rows {
+		t.Rows[i].release()
+	}
+	t.Rows = nil
+}
+
+// WriteTSV writes this table as tab-separated values: a header line,
+// `Molecule`, `Core`, and `R1` and so on, followed by a line for each
+// row.  Molecules are labelled using the given function; their formulae
+// are used when it is `nil`.  R-groups absent from a row are blank.
+func (t *RGroupTable) WriteTSV(w io.Writer, label func(*molecule.Molecule) string) error {
+	if label == nil {
+		label = (*molecule.Molecule).Formula
+	}
+
+	bw := bufio.NewWriter(w)
+	bw.WriteString("Molecule\tCore")
+	for _, n := range t.Groups {
+		fmt.Fprintf(bw, "\tR%d", n)
+	}
+	bw.WriteByte('\n')
+	for _, row := range t.Rows {
+		bw.WriteString(label(row.Molecule))
+		bw.WriteByte('\t')
+		bw.WriteString(label(row.Core))
+		for _, n := range t.Groups {
+			bw.WriteByte('\t')
+			if sub, ok := row.RGroups[n]; ok {
+				bw.WriteString(label(sub))
+			}
+		}
+		bw.WriteByte('\n')
+	}
+	return bw.Flush()
+}
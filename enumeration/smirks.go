@@ -0,0 +1,90 @@
+package enumeration
+
+import (
+	"fmt"
+
+	"github.com/RxnWeaver/rxnweaver/data/molecule"
+	"github.com/RxnWeaver/rxnweaver/data/reaction"
+	"github.com/RxnWeaver/rxnweaver/synthesis"
+)
+
+// SmirksTemplate is a template applying a SMIRKS transform forward,
+// from its reactants to its products.  See `reaction.Transform`.
+//
+// It is a site template: the site of an outcome is the reagent atoms
+// matched by the reactant patterns of the transform.
+type SmirksTemplate struct {
+	name string
+	t    *reaction.Transform
+}
+
+// NewSmirksTemplate answers the template of the given name applying
+// the given SMIRKS.
+func NewSmirksTemplate(name, smirks string) (*SmirksTemplate, error) {
+	t, err := reaction.ParseSmirks(smirks)
+	if err != nil {
+		return nil, fmt.Errorf("Template %s : %v", name, err)
+	}
+	return &SmirksTemplate{name: name, t: t}, nil
+}
+
+// LibraryTemplates answers the templates applying the SMIRKS of the
+// rules of the given library forward, in order.  The incompatible
+// groups of the rules are not checked by the templates.
+func LibraryTemplates(lib *synthesis.Library) ([]Template, error) {
+	tmpls := make([]Template, 0, len(lib.Rules))
+	for _, rs := range lib.Rules {
+		st, err := NewSmirksTemplate(rs.Name, rs.Smirks)
+		if err != nil {
+			return nil, err
+		}
+		tmpls = append(tmpls, st)
+	}
+	return tmpls, nil
+}
+
+// Name answers the name of this template.
+func (st *SmirksTemplate) Name() string {
+	return st.name
+}
+
+// Arity answers the number of reactant patterns of the SMIRKS of this
+// template.
+func (st *SmirksTemplate) Arity() int {
+	return st.t.Arity()
+}
+
+// Apply answers the products of the SMIRKS of this template applied to
+// the given reagents, which should have been sanitised: those of every
+// occurrence of its reactant patterns, each set of products once.
+func (st *SmirksTemplate) Apply(reagents []*molecule.Molecule) ([]*molecule.Molecule, error) {
+	sets, err := st.t.Apply(reagents)
+	if err != nil {
+		return nil, fmt.Errorf("Template %s : %v", st.name, err)
+	}
+
+	prods := make([]*molecule.Molecule, 0, len(sets))
+	for _, set := range sets {
+		prods = append(prods, set...)
+	}
+	return prods, nil
+}
+
+// Outcomes answers the products of the SMIRKS of this template applied
+// to the given reagents, as `Apply` does, each with the reagent atoms
+// its occurrence matched as its site.  Products of the same occurrence
+// share its site.
+func (st *SmirksTemplate) Outcomes(reagents []*molecule.Molecule) ([]Outcome, error) {
+	occs, err := st.t.Occurrences(reagents)
+	if err != nil {
+		return nil, fmt.Errorf("Template %s : %v", st.name, err)
+	}
+
+	outs := make([]Outcome, 0, len(occs))
+	for _, o := range occs {
+		for _, p := range o.Products {
+			outs = append(outs, Outcome{Molecule: p, Site: o.Atoms})
+		}
+	}
+	return outs, nil
+}
@@ -0,0 +1,172 @@
+package network
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+
+	cmn "github.com/RxnWeaver/rxnweaver/common"
+)
+
+// NodeKind distinguishes molecules from reactions in a network.
+type NodeKind uint8
+
+const (
+	NodeKindMolecule NodeKind = iota
+	NodeKindReaction
+)
+
+// String answers a lowercase name of the node kind.
+func (k NodeKind) String() string {
+	if k == NodeKindReaction {
+		return "reaction"
+	}
+	return "molecule"
+}
+
+// Node is a single vertex of a reaction network.
+type Node struct {
+	Id    string
+	Label string // SMILES, formula, name, etc.
+	Image string // Optional path or URL of a depiction.
+	Kind  NodeKind
+}
+
+// Edge is a directed link from a molecule to a reaction consuming it,
+// or from a reaction to a molecule it produces.
+type Edge struct {
+	From  string
+	To    string
+	Label string
+}
+
+// Network is a bipartite graph of molecules and reactions, suitable
+// for export to visualisation tools.
+type Network struct {
+	nodes []Node
+	edges []Edge
+	ids   map[string]bool
+}
+
+// New creates an empty network.
+func New() *Network {
+	nw := new(Network)
+
+	nw.nodes = make([]Node, 0, cmn.ListSizeLarge)
+	nw.edges = make([]Edge, 0, cmn.ListSizeLarge)
+	nw.ids = make(map[string]bool)
+
+	return nw
+}
+
+// AddNode adds the given node to this network, unless a node with the
+// same ID exists already.
+func (nw *Network) AddNode(n Node) *Network {
+	if !nw.ids[n.Id] {
+		nw.nodes = append(nw.nodes, n)
+		nw.ids[n.Id] = true
+	}
+	return nw
+}
+
+// AddEdge adds the given edge to this network.  Both its end-points
+// must already be present.
+func (nw *Network) AddEdge(e Edge) error {
+	if !nw.ids[e.From] {
+		return fmt.Errorf("Unknown node ID : %s", e.From)
+	}
+	if !nw.ids[e.To] {
+		return fmt.Errorf("Unknown node ID : %s", e.To)
+	}
+
+	nw.edges = append(nw.edges, e)
+	return nil
+}
+
+// Nodes answers the nodes of this network.
+func (nw *Network) Nodes() []Node {
+	return nw.nodes
+}
+
+// Edges answers the edges of this network.
+func (nw *Network) Edges() []Edge {
+	return nw.edges
+}
+
+// WriteDOT writes this network to the given writer, in Graphviz DOT
+// format.  Molecules are drawn as boxes, and reactions as ellipses.
+func (nw *Network) WriteDOT(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+
+	fmt.Fprintln(bw, "digraph rxnweaver {")
+	fmt.Fprintln(bw, "  rankdir=LR;")
+	for _, n := range nw.nodes {
+		shape := "box"
+		if n.Kind == NodeKindReaction {
+			shape = "ellipse"
+		}
+		fmt.Fprintf(bw, "  %s [label=%s, shape=%s", dotQuote(n.Id), dotQuote(n.Label), shape)
+		if n.Image != "" {
+			fmt.Fprintf(bw, ", image=%s", dotQuote(n.Image))
+		}
+		fmt.Fprintln(bw, "];")
+	}
+	for _, e := range nw.edges {
+		fmt.Fprintf(bw, "  %s -> %s", dotQuote(e.From), dotQuote(e.To))
+		if e.Label != "" {
+			fmt.Fprintf(bw, " [label=%s]", dotQuote(e.Label))
+		}
+		fmt.Fprintln(bw, ";")
+	}
+	fmt.Fprintln(bw, "}")
+
+	return bw.Flush()
+}
+
+// dotQuote answers the given string as a quoted DOT identifier.
+func dotQuote(s string) string {
+	return `"` + strings.Replace(strings.Replace(s, `\`, `\\`, -1), `"`, `\"`, -1) + `"`
+}
+
+// WriteGraphML writes this network to the given writer, in GraphML
+// format.  Node labels, kinds and images are written as data keys.
+func (nw *Network) WriteGraphML(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+
+	fmt.Fprintln(bw, xml.Header+`<graphml xmlns="http://graphml.graphdrawing.org/xmlns">`)
+	fmt.Fprintln(bw, `  <key id="label" for="all" attr.name="label" attr.type="string"/>`)
+	fmt.Fprintln(bw, `  <key id="kind" for="node" attr.name="kind" attr.type="string"/>`)
+	fmt.Fprintln(bw, `  <key id="image" for="node" attr.name="image" attr.type="string"/>`)
+	fmt.Fprintln(bw, `  <graph id="rxnweaver" edgedefault="directed">`)
+	for _, n := range nw.nodes {
+		fmt.Fprintf(bw, "    <node id=\"%s\">\n", xmlEscape(n.Id))
+		fmt.Fprintf(bw, "      <data key=\"label\">%s</data>\n", xmlEscape(n.Label))
+		fmt.Fprintf(bw, "      <data key=\"kind\">%s</data>\n", n.Kind)
+		if n.Image != "" {
+			fmt.Fprintf(bw, "      <data key=\"image\">%s</data>\n", xmlEscape(n.Image))
+		}
+		fmt.Fprintln(bw, "    </node>")
+	}
+	for _, e := range nw.edges {
+		fmt.Fprintf(bw, "    <edge source=\"%s\" target=\"%s\">", xmlEscape(e.From), xmlEscape(e.To))
+		if e.Label != "" {
+			fmt.Fprintf(bw, "<data key=\"label\">%s</data>", xmlEscape(e.Label))
+		}
+		fmt.Fprintln(bw, "</edge>")
+	}
+	fmt.Fprintln(bw, "  </graph>")
+	fmt.Fprintln(bw, "</graphml>")
+
+	return bw.Flush()
+}
+
+// xmlEscape answers the given string with XML special characters
+// escaped.
+func xmlEscape(s string) string {
+	buf := new(bytes.Buffer)
+	xml.EscapeText(buf, []byte(s))
+	return buf.String()
+}
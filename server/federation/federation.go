@@ -0,0 +1,407 @@
+// Package federation joins the molecule registries of several nodes,
+// each serving its own through package `server`, into one, so that
+// enumeration and search jobs can scale horizontally.
+//
+// Molecules are named across the federation by global IDs, which hold
+// the number of the node owning a molecule in their top 16 bits, and
+// its ID in the registry of that node in the remaining 48.  Lookups by
+// global ID are routed to the owning node; bulk operations fan out to
+// all the nodes concurrently, and their results are merged.  Nodes do
+// not talk to one another, nor need to know that they are federated:
+// the protocol is that of package `server`, with local IDs.
+//
+// See `doc/design/federation.md`.
+package federation
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/RxnWeaver/rxnweaver/server"
+)
+
+// Bits of a global ID holding the local ID of a molecule.
+const localIdBits = 48
+
+// MaxLocalId is the largest ID of a molecule in the registry of a node
+// that can be named globally.
+const MaxLocalId = 1<<localIdBits - 1
+
+// MaxResponseSize is the largest response read from a node, in bytes.
+const MaxResponseSize = 256 << 20
+
+// GlobalId answers the global ID of the molecule with the given ID in
+// the registry of the given node.
+func GlobalId(node uint16, id uint64) (uint64, error) {
+	if id == 0 || id > MaxLocalId {
+		return 0, fmt.Errorf("Molecule ID out of range : %d", id)
+	}
+	return uint64(node)<<localIdBits | id, nil
+}
+
+// SplitId answers the node and local ID named by the given global ID.
+func SplitId(gid uint64) (uint16, uint64) {
+	return uint16(gid >> localIdBits), gid & MaxLocalId
+}
+
+// Node is a member of a federation: a server of a registry, at the
+// given base URL, such as `http://10.0.0.7:8080`.
+type Node struct {
+	Id  uint16
+	URL string
+}
+
+// Federation is a client of the registries of a set of nodes, treating
+// them as one.  It is safe for concurrent use.
+type Federation struct {
+	Client *http.Client // `http.DefaultClient`, if `nil`.
+
+	nodes []Node // In ascending order of their IDs.
+	next  uint32 // Index of the node to place the next molecule on.
+}
+
+// New answers a federation of the given nodes, whose IDs must be
+// distinct.
+func New(nodes ...Node) (*Federation, error) {
+	if len(nodes) == 0 {
+		return nil, fmt.Errorf("No nodes given.")
+	}
+
+	f := &Federation{nodes: append([]Node(nil), nodes...)}
+	sort.Slice(f.nodes, func(i, j int) bool { return f.nodes[i].Id < f.nodes[j].Id })
+	for i, n := range f.nodes {
+		if i > 0 && n.Id == f.nodes[i-1].Id {
+			return nil, fmt.Errorf("Duplicate node ID : %d", n.Id)
+		}
+		if _, err := url.Parse(n.URL); err != nil {
+			return nil, fmt.Errorf("Node %d : %v", n.Id, err)
+		}
+		f.nodes[i].URL = strings.TrimSuffix(n.URL, "/")
+	}
+	return f, nil
+}
+
+// Nodes answers the nodes of this federation, in ascending order of
+// their IDs.
+func (f *Federation) Nodes() []Node {
+	return append([]Node(nil), f.nodes...)
+}
+
+// node answers the node with the given ID.
+func (f *Federation) node(id uint16) (Node, error) {
+	i := sort.Search(len(f.nodes), func(i int) bool { return f.nodes[i].Id >= id })
+	if i == len(f.nodes) || f.nodes[i].Id != id {
+		return Node{}, fmt.Errorf("No node with ID %d.", id)
+	}
+	return f.nodes[i], nil
+}
+
+// NodeError is the failure of a request to a node.
+type NodeError struct {
+	Node   uint16
+	Status int // HTTP status; `0` if no response was received.
+	Err    error
+}
+
+func (e *NodeError) Error() string {
+	return fmt.Sprintf("Node %d : %v", e.Node, e.Err)
+}
+
+func (e *NodeError) Unwrap() error {
+	return e.Err
+}
+
+// FanOutError collects the failures of the nodes of a bulk operation.
+// The results of the other nodes are answered along with it.
+type FanOutError struct {
+	Errs []*NodeError // In ascending order of their nodes.
+}
+
+func (e *FanOutError) Error() string {
+	msgs := make([]string, len(e.Errs))
+	for i, ne := range e.Errs {
+		msgs[i] = ne.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// do sends a request with the given method, path and JSON body, if
+// any, to the given node, and decodes its JSON response into the given
+// value, if any.
+func (f *Federation) do(ctx context.Context, n Node, method, path string, body, v interface{}) error {
+	var rd io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		rd = bytes.NewReader(b)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, n.URL+path, rd)
+	if err != nil {
+		return &NodeError{Node: n.Id, Err: err}
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set("Accept", "application/json")
+
+	client := f.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return &NodeError{Node: n.Id, Err: err}
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, MaxResponseSize))
+	if err != nil {
+		return &NodeError{Node: n.Id, Status: resp.StatusCode, Err: err}
+	}
+	if resp.StatusCode/100 != 2 {
+		fault := struct {
+			Error string `json:"error"`
+		}{}
+		if json.Unmarshal(data, &fault) != nil || fault.Error == "" {
+			fault.Error = resp.Status
+		}
+		return &NodeError{Node: n.Id, Status: resp.StatusCode, Err: fmt.Errorf("%s", fault.Error)}
+	}
+
+	if v == nil {
+		return nil
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return &NodeError{Node: n.Id, Status: resp.StatusCode, Err: err}
+	}
+	return nil
+}
+
+// fanOut calls the given function for each node concurrently, and
+// waits for all of them.  It answers their failures, if any.
+func (f *Federation) fanOut(ctx context.Context, call func(ctx context.Context, n Node) error) error {
+	errs := make([]error, len(f.nodes))
+	var wg sync.WaitGroup
+	for i, n := range f.nodes {
+		wg.Add(1)
+		go func(i int, n Node) {
+			defer wg.Done()
+			errs[i] = call(ctx, n)
+		}(i, n)
+	}
+	wg.Wait()
+
+	var fe *FanOutError
+	for i, err := range errs {
+		if err == nil {
+			continue
+		}
+		if fe == nil {
+			fe = new(FanOutError)
+		}
+		ne, ok := err.(*NodeError)
+		if !ok {
+			ne = &NodeError{Node: f.nodes[i].Id, Err: err}
+		}
+		fe.Errs = append(fe.Errs, ne)
+	}
+	if fe == nil {
+		return nil
+	}
+	return fe
+}
+
+// Create creates the given molecule on a node of this federation,
+// chosen in rotation, and answers its summary, with its global ID.
+func (f *Federation) Create(ctx context.Context, jm *server.Molecule) (server.Summary, error) {
+	i := (atomic.AddUint32(&f.next, 1) - 1) % uint32(len(f.nodes))
+	return f.CreateOn(ctx, f.nodes[i].Id, jm)
+}
+
+// CreateOn creates the given molecule on the given node, and answers
+// its summary, with its global ID.
+func (f *Federation) CreateOn(ctx context.Context, node uint16, jm *server.Molecule) (server.Summary, error) {
+	n, err := f.node(node)
+	if err != nil {
+		return server.Summary{}, err
+	}
+
+	var sum server.Summary
+	if err := f.do(ctx, n, http.MethodPost, "/molecules", jm, &sum); err != nil {
+		return server.Summary{}, err
+	}
+	gid, err := GlobalId(node, sum.Id)
+	if err != nil {
+		return server.Summary{}, &NodeError{Node: node, Err: err}
+	}
+	sum.Id = gid
+	return sum, nil
+}
+
+// Molecule answers the molecule with the given global ID, from its
+// owning node, with its global ID.
+func (f *Federation) Molecule(ctx context.Context, gid uint64) (*server.Molecule, error) {
+	node, id := SplitId(gid)
+	n, err := f.node(node)
+	if err != nil {
+		return nil, err
+	}
+
+	jm := new(server.Molecule)
+	if err := f.do(ctx, n, http.MethodGet, "/molecules/"+strconv.FormatUint(id, 10), nil, jm); err != nil {
+		return nil, err
+	}
+	jm.Id = gid
+	return jm, nil
+}
+
+// Delete releases the molecule with the given global ID, on its owning
+// node.
+func (f *Federation) Delete(ctx context.Context, gid uint64) error {
+	node, id := SplitId(gid)
+	n, err := f.node(node)
+	if err != nil {
+		return err
+	}
+	return f.do(ctx, n, http.MethodDelete, "/molecules/"+strconv.FormatUint(id, 10), nil, nil)
+}
+
+// Each calls the given function with the global ID of each molecule of
+// this federation, node by node, in ascending order, until it answers
+// `false`.  IDs are fetched a page at a time, so that federations too
+// large to list at once can be enumerated.
+//
+// As with `molecule.MoleculeRegistry.List`, molecules created during
+// the enumeration may or may not be included.
+func (f *Federation) Each(ctx context.Context, fn func(gid uint64) bool) error {
+	for _, n := range f.nodes {
+		after := uint64(0)
+		for {
+			var page server.MoleculeList
+			path := fmt.Sprintf("/molecules?after=%d&limit=%d", after, server.DefaultPageSize)
+			if err := f.do(ctx, n, http.MethodGet, path, nil, &page); err != nil {
+				return err
+			}
+			for _, id := range page.Ids {
+				gid, err := GlobalId(n.Id, id)
+				if err != nil {
+					return &NodeError{Node: n.Id, Err: err}
+				}
+				if !fn(gid) {
+					return nil
+				}
+				after = id
+			}
+			if !page.More || len(page.Ids) == 0 {
+				break
+			}
+		}
+	}
+	return nil
+}
+
+// Search answers the molecules of this federation that contain the
+// given query, with the number of its occurrences in each, up to the
+// given maximum, or all if `0`.  The hits are in the ascending order of
+// their global IDs.
+//
+// Each node searches its own molecules.  Should any fail, the hits of
+// the others are answered, along with a `*FanOutError`.
+func (f *Federation) Search(ctx context.Context, query *server.Molecule, max int) ([]server.SearchHit, error) {
+	var mu sync.Mutex
+	res := []server.SearchHit(nil)
+
+	err := f.fanOut(ctx, func(ctx context.Context, n Node) error {
+		var reply server.SearchReply
+		if err := f.do(ctx, n, http.MethodPost, "/search", server.SearchRequest{Query: *query, Max: max}, &reply); err != nil {
+			return err
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		for _, h := range reply.Hits {
+			gid, err := GlobalId(n.Id, h.Id)
+			if err != nil {
+				return &NodeError{Node: n.Id, Err: err}
+			}
+			res = append(res, server.SearchHit{Id: gid, Count: h.Count})
+		}
+		return nil
+	})
+
+	sort.Slice(res, func(i, j int) bool { return res[i].Id < res[j].Id })
+	return res, err
+}
+
+// Descriptors answers the named descriptors, or all of them if none
+// are named, of the molecules of this federation, by their global IDs,
+// along with the failures of those whose descriptors failed.
+//
+// Should any node fail, the results of the others are answered, along
+// with a `*FanOutError`.
+func (f *Federation) Descriptors(ctx context.Context, names ...string) (map[uint64]map[string]float64, map[uint64]string, error) {
+	var mu sync.Mutex
+	vals := make(map[uint64]map[string]float64)
+	fails := make(map[uint64]string)
+
+	err := f.fanOut(ctx, func(ctx context.Context, n Node) error {
+		var reply server.BulkDescriptorsReply
+		if err := f.do(ctx, n, http.MethodPost, "/bulk/descriptors", server.BulkDescriptorsRequest{Names: names}, &reply); err != nil {
+			return err
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		for id, v := range reply.Values {
+			gid, err := GlobalId(n.Id, id)
+			if err != nil {
+				return &NodeError{Node: n.Id, Err: err}
+			}
+			vals[gid] = v
+		}
+		for id, msg := range reply.Errors {
+			gid, err := GlobalId(n.Id, id)
+			if err != nil {
+				return &NodeError{Node: n.Id, Err: err}
+			}
+			fails[gid] = msg
+		}
+		return nil
+	})
+
+	return vals, fails, err
+}
+
+// Metrics answers the metrics of the registries of the nodes of this
+// federation, by their IDs.  Should any node fail, the metrics of the
+// others are answered, along with a `*FanOutError`.
+func (f *Federation) Metrics(ctx context.Context) (map[uint16]server.Metrics, error) {
+	var mu sync.Mutex
+	res := make(map[uint16]server.Metrics)
+
+	err := f.fanOut(ctx, func(ctx context.Context, n Node) error {
+		var m server.Metrics
+		if err := f.do(ctx, n, http.MethodGet, "/registry", nil, &m); err != nil {
+			return err
+		}
+
+		mu.Lock()
+		res[n.Id] = m
+		mu.Unlock()
+		return nil
+	})
+
+	return res, err
+}
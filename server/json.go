@@ -0,0 +1,302 @@
+package server
+
+import (
+	"fmt"
+	"image/color"
+	"strconv"
+
+	cmn "github.com/RxnWeaver/rxnweaver/common"
+	"github.com/RxnWeaver/rxnweaver/data/molecule"
+	"github.com/RxnWeaver/rxnweaver/data/render"
+)
+
+// Molecule is the JSON form of a molecule.
+//
+// In requests, atoms are numbered from `0`, in the order of their
+// listing, and bonds refer to them by those numbers; the `id`s of
+// atoms and bonds, and the perceived fields, are ignored.  In replies,
+// atoms and bonds carry their IDs, and the perceived fields are set.
+type Molecule struct {
+	Id         uint64            `json:"id,omitempty"`
+	Atoms      []Atom            `json:"atoms"`
+	Bonds      []Bond            `json:"bonds"`
+	Attributes map[string]string `json:"attributes,omitempty"`
+}
+
+// Atom is the JSON form of an atom.
+type Atom struct {
+	Id       uint16  `json:"id"`
+	Symbol   string  `json:"symbol"`
+	Charge   int     `json:"charge,omitempty"`
+	Isotope  int     `json:"isotope,omitempty"` // Mass number.
+	X        float32 `json:"x"`
+	Y        float32 `json:"y"`
+	Z        float32 `json:"z,omitempty"`
+	HCount   int     `json:"hCount,omitempty"`   // Perceived.
+	Aromatic bool    `json:"aromatic,omitempty"` // Perceived.
+}
+
+// Bond is the JSON form of a bond.  Its order is `1`, `2` or `3`, or
+// `4` for an alternating bond; its stereo is that of MDL molfiles.
+type Bond struct {
+	Id       uint16 `json:"id"`
+	A1       uint16 `json:"a1"`
+	A2       uint16 `json:"a2"`
+	Order    int    `json:"order"`
+	Stereo   int    `json:"stereo,omitempty"`
+	Aromatic bool   `json:"aromatic,omitempty"` // Perceived.
+}
+
+// Target names the molecule that an operation applies to: either one
+// created earlier, by its ID, or one given inline.  An inline molecule
+// lives only as long as its request.
+type Target struct {
+	Id       uint64    `json:"id,omitempty"`
+	Molecule *Molecule `json:"molecule,omitempty"`
+}
+
+// Summary describes a molecule, as answered on its creation.
+type Summary struct {
+	Id        uint64  `json:"id"`
+	Formula   string  `json:"formula"`
+	Weight    float64 `json:"weight"`
+	AtomCount int     `json:"atomCount"`
+	BondCount int     `json:"bondCount"`
+	Hash      string  `json:"hash"`
+}
+
+// ConvertRequest asks for a molecule in the given format: `json` or
+// `sdf`.
+type ConvertRequest struct {
+	Target
+	Format string `json:"format"`
+}
+
+// Canonical holds the canonical identifiers of a molecule.  The hashes
+// and the SMILES strings are equal for equal structures, regardless of
+// the order of their atoms and bonds.
+type Canonical struct {
+	Formula     string `json:"formula"`
+	Hash        string `json:"hash"`        // Of the constitution.
+	FullHash    string `json:"fullHash"`    // Including stereo and isotopes.
+	Smiles      string `json:"smiles"`      // Including stereo and isotopes.
+	LooseSmiles string `json:"looseSmiles"` // Without stereo, for loose matching.
+}
+
+// Metrics summarises the molecules of the registry of a server.  See
+// `molecule.RegistryMetrics`.
+type Metrics struct {
+	Molecules  int    `json:"molecules"`
+	Atoms      int    `json:"atoms"`
+	Bonds      int    `json:"bonds"`
+	Unanswered int    `json:"unanswered"`
+	Goroutines int    `json:"goroutines"`
+	Backlog    int    `json:"backlog"`
+	MaxBacklog int    `json:"maxBacklog"`
+	Saturated  int    `json:"saturated"`
+	Evicted    uint64 `json:"evicted"`
+}
+
+// DescriptorsRequest asks for the descriptors with the given names,
+// or all of them if none are named.
+type DescriptorsRequest struct {
+	Target
+	Names []string `json:"names,omitempty"`
+}
+
+// MoleculeList is a page of the IDs of the molecules held by a server,
+// in ascending order.  More follow, if `More` is set.
+type MoleculeList struct {
+	Ids  []uint64 `json:"ids"`
+	More bool     `json:"more,omitempty"`
+}
+
+// BulkDescriptorsRequest asks for the descriptors with the given names,
+// or all of them if none are named, of the molecules with the given
+// IDs, or of all the molecules held if none are given.
+type BulkDescriptorsRequest struct {
+	Ids   []uint64 `json:"ids,omitempty"`
+	Names []string `json:"names,omitempty"`
+}
+
+// BulkDescriptorsReply holds the descriptors of molecules by their
+// IDs, and the errors of those whose descriptors failed.  Molecules
+// not held are in neither.
+type BulkDescriptorsReply struct {
+	Values map[uint64]map[string]float64 `json:"values"`
+	Errors map[uint64]string             `json:"errors,omitempty"`
+}
+
+// SearchRequest asks for the molecules that contain the query, among
+// those with the given IDs, or among all those held if none are given.
+// The occurrences in each molecule are counted up to `Max`; at most
+// `Limit` molecules are answered.
+type SearchRequest struct {
+	Query Molecule `json:"query"`
+	Ids   []uint64 `json:"ids,omitempty"`
+	Max   int      `json:"max,omitempty"`   // `0` means all.
+	Limit int      `json:"limit,omitempty"` // `0` means all.
+}
+
+// SearchHit is a molecule that contains the query of a search, with
+// the number of its occurrences.
+type SearchHit struct {
+	Id    uint64 `json:"id"`
+	Count int    `json:"count"`
+}
+
+// SearchReply lists the hits of a search, in the ascending order of
+// the IDs of their molecules.  The search stopped upon reaching its
+// limit, if `More` is set.
+type SearchReply struct {
+	Hits []SearchHit `json:"hits"`
+	More bool        `json:"more,omitempty"`
+}
+
+// SubstructureRequest asks for the occurrences of the query in the
+// target.  See `molecule.SubstructureMatches`.
+type SubstructureRequest struct {
+	Target
+	Query Molecule `json:"query"`
+	Max   int      `json:"max,omitempty"` // `0` means all.
+}
+
+// SubstructureReply lists the occurrences of a query, each as a map of
+// the IDs of the query's atoms to those of the target's.
+type SubstructureReply struct {
+	Count   int                 `json:"count"`
+	Matches []map[uint16]uint16 `json:"matches"`
+}
+
+// DepictRequest asks for a PNG depiction of a molecule.  See
+// `render.Options`.  If a query is given, its occurrences are
+// highlighted, after the highlights given.
+type DepictRequest struct {
+	Target
+	Width       int         `json:"width,omitempty"`
+	Height      int         `json:"height,omitempty"`
+	DPI         float64     `json:"dpi,omitempty"`
+	BondLength  float64     `json:"bondLength,omitempty"`
+	Scale       float64     `json:"scale,omitempty"`
+	Transparent bool        `json:"transparent,omitempty"`
+	Highlights  []Highlight `json:"highlights,omitempty"`
+	Query       *Molecule   `json:"query,omitempty"`
+}
+
+// Highlight is the JSON form of `render.Highlight`.  Its colour is
+// given as `#rrggbb` or `#rrggbbaa`.
+type Highlight struct {
+	Atoms []uint16 `json:"atoms,omitempty"`
+	Bonds []uint16 `json:"bonds,omitempty"`
+	Color string   `json:"color,omitempty"`
+}
+
+// build constructs a sanitised molecule in the given registry from
+// its JSON form.  The molecule is passive, if the registry is `nil`.
+func build(reg *molecule.MoleculeRegistry, jm *Molecule) (*molecule.Molecule, error) {
+	var mol *molecule.Molecule
+	if reg == nil {
+		mol = molecule.NewPassive()
+	} else {
+		mol = reg.NewMolecule()
+	}
+	for _, a := range jm.Atoms {
+		ab := mol.NewAtomBuilder().Element(a.Symbol)
+		if a.Charge != 0 {
+			ab.FormalCharge(a.Charge)
+		}
+		if a.Isotope != 0 {
+			ab.Isotope(a.Isotope)
+		}
+		ab.Coords(a.X, a.Y, a.Z).Add()
+	}
+	for i, b := range jm.Bonds {
+		if b.Order < 1 || b.Order > 4 {
+			mol.Release()
+			return nil, fmt.Errorf("Bond %d : invalid order : %d", i+1, b.Order)
+		}
+		mol.NewBondBuilder().Connect(int(b.A1), int(b.A2)).Type(cmn.BondType(b.Order)).Stereo(cmn.BondStereo(b.Stereo)).Add()
+	}
+	if err := mol.Build(); err != nil {
+		mol.Release()
+		return nil, err
+	}
+
+	for name, value := range jm.Attributes {
+		if err := mol.SetAttribute(name, value); err != nil {
+			mol.Release()
+			return nil, err
+		}
+	}
+	if _, err := molecule.Sanitize(mol, 0); err != nil {
+		mol.Release()
+		return nil, err
+	}
+	return mol, nil
+}
+
+// toJSON answers the JSON form of the given molecule.
+func toJSON(mol *molecule.Molecule) (*Molecule, error) {
+	jm := &Molecule{Id: mol.Id(), Atoms: []Atom{}, Bonds: []Bond{}}
+	it := mol.Atoms()
+	for it.Next() {
+		a := it.Atom()
+		jm.Atoms = append(jm.Atoms, Atom{
+			Id:       a.Iid,
+			Symbol:   a.Symbol,
+			Charge:   int(a.Charge),
+			Isotope:  int(a.Isotope),
+			X:        a.X,
+			Y:        a.Y,
+			Z:        a.Z,
+			HCount:   int(a.HCount),
+			Aromatic: a.IsAromatic,
+		})
+	}
+	if err := it.Err(); err != nil {
+		return nil, err
+	}
+
+	bit := mol.Bonds()
+	for bit.Next() {
+		b := bit.Bond()
+		jm.Bonds = append(jm.Bonds, Bond{b.Id, b.A1, b.A2, int(b.Type), int(b.Stereo), b.IsAromatic})
+	}
+	if err := bit.Err(); err != nil {
+		return nil, err
+	}
+
+	attrs, err := mol.Attributes()
+	if err != nil {
+		return nil, err
+	}
+	if len(attrs) > 0 {
+		jm.Attributes = make(map[string]string, len(attrs))
+		for _, attr := range attrs {
+			jm.Attributes[attr.Name] = attr.Value
+		}
+	}
+	return jm, nil
+}
+
+// highlight answers the given highlight in the form of the renderer.
+func (h Highlight) highlight() (render.Highlight, error) {
+	rh := render.Highlight{Atoms: h.Atoms, Bonds: h.Bonds}
+	if h.Color == "" {
+		return rh, nil
+	}
+
+	s := h.Color
+	if len(s) > 0 && s[0] == '#' {
+		s = s[1:]
+	}
+	if len(s) == 6 {
+		s += "ff"
+	}
+	v, err := strconv.ParseUint(s, 16, 32)
+	if len(s) != 8 || err != nil {
+		return rh, fmt.Errorf("Invalid colour : %q", h.Color)
+	}
+	rh.Color = color.NRGBA{uint8(v >> 24), uint8(v >> 16), uint8(v >> 8), uint8(v)}
+	return rh, nil
+}
@@ -0,0 +1,651 @@
+// Package server exposes the operations on molecules over HTTP, with
+// JSON payloads, so that programs in other languages can use RxnWeaver
+// as a service.
+//
+// The endpoints are as follows.  Those taking a `Target` operate on a
+// molecule created earlier, or on one given inline.
+//
+//	POST   /molecules        Molecule               -> Summary
+//	GET    /molecules                               -> MoleculeList
+//	GET    /molecules/{id}                          -> Molecule
+//	DELETE /molecules/{id}
+//	POST   /convert          ConvertRequest         -> Molecule, or an SD file
+//	POST   /canonicalize     Target                 -> Canonical
+//	GET    /descriptors                             -> []string
+//	POST   /descriptors      DescriptorsRequest     -> map[string]float64
+//	POST   /substructure     SubstructureRequest    -> SubstructureReply
+//	POST   /search           SearchRequest          -> SearchReply
+//	POST   /bulk/descriptors BulkDescriptorsRequest -> BulkDescriptorsReply
+//	POST   /depict           DepictRequest          -> PNG image
+//	GET    /registry                                -> Metrics
+//	GET    /metrics                                 -> Prometheus metrics
+//
+// `GET /molecules` lists the IDs of the molecules held, in ascending
+// order, a page at a time: those after the ID given by the parameter
+// `after`, at most as many as the parameter `limit`, or
+// `DefaultPageSize`.  `/search` and `/bulk/descriptors` operate on all
+// the molecules held, or on those named.  These let registries on
+// several nodes be federated; see package `federation`.
+//
+// The metrics of the registry are answered in JSON by `/registry`, and
+// in the text exposition format of Prometheus by `/metrics`, for
+// scraping.
+//
+// Molecules are sanitised when created.  Errors are answered as
+// `{"error": "..."}`, with a suitable status.
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/RxnWeaver/rxnweaver/data/loader"
+	"github.com/RxnWeaver/rxnweaver/data/molecule"
+	"github.com/RxnWeaver/rxnweaver/data/render"
+)
+
+// MaxRequestSize is the largest request body accepted, in bytes.
+const MaxRequestSize = 8 << 20
+
+// Sizes of the pages of IDs answered by `GET /molecules`.
+const (
+	DefaultPageSize = 1000
+	MaxPageSize     = 100000
+)
+
+// Server answers HTTP requests on the molecules of a registry.  It is
+// an `http.Handler`.
+type Server struct {
+	reg *molecule.MoleculeRegistry
+	mux *http.ServeMux
+}
+
+// New answers a server of the molecules of the given registry, or of
+// the default registry, if `nil`.
+func New(reg *molecule.MoleculeRegistry) *Server {
+	if reg == nil {
+		reg = molecule.AllMolecules
+	}
+
+	s := &Server{reg: reg, mux: http.NewServeMux()}
+	s.mux.HandleFunc("/molecules", s.molecules)
+	s.mux.HandleFunc("/molecules/", s.molecule)
+	s.mux.HandleFunc("/convert", s.method(http.MethodPost, s.convert))
+	s.mux.HandleFunc("/canonicalize", s.method(http.MethodPost, s.canonicalize))
+	s.mux.HandleFunc("/descriptors", s.descriptors)
+	s.mux.HandleFunc("/substructure", s.method(http.MethodPost, s.substructure))
+	s.mux.HandleFunc("/search", s.method(http.MethodPost, s.search))
+	s.mux.HandleFunc("/bulk/descriptors", s.method(http.MethodPost, s.bulkDescriptors))
+	s.mux.HandleFunc("/depict", s.method(http.MethodPost, s.depict))
+	s.mux.HandleFunc("/registry", s.method(http.MethodGet, s.registry))
+	s.mux.HandleFunc("/metrics", s.method(http.MethodGet, s.metrics))
+	return s
+}
+
+// ServeHTTP dispatches the given request to its endpoint.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// _HTTPError is an error to be answered with the given status.
+type _HTTPError struct {
+	status int
+	err    error
+}
+
+func (e *_HTTPError) Error() string {
+	return e.err.Error()
+}
+
+// httpErrorf answers an error with the given status and message.
+func httpErrorf(status int, format string, args ...interface{}) error {
+	return &_HTTPError{status, fmt.Errorf(format, args...)}
+}
+
+// statusOf answers the HTTP status for the given error.  Problems with
+// the molecules given are the client's; other errors are the server's.
+func statusOf(err error) int {
+	var he *_HTTPError
+	if errors.As(err, &he) {
+		return he.status
+	}
+	var re *molecule.RequestError
+	if errors.As(err, &re) {
+		switch re.Status {
+		case molecule.StNotFound:
+			return http.StatusNotFound
+		case molecule.StIncorrectParameter:
+			return http.StatusBadRequest
+		}
+		return http.StatusInternalServerError
+	}
+	var be *molecule.BuildError
+	if errors.As(err, &be) {
+		return http.StatusBadRequest
+	}
+	return http.StatusUnprocessableEntity
+}
+
+// writeJSON answers the given value as JSON, with the given status.
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// writeError answers the given error as JSON.
+func writeError(w http.ResponseWriter, err error) {
+	writeJSON(w, statusOf(err), map[string]string{"error": err.Error()})
+}
+
+// method answers a handler that passes requests of the given method to
+// the given handler, and refuses others.
+func (s *Server) method(m string, h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != m {
+			w.Header().Set("Allow", m)
+			writeError(w, httpErrorf(http.StatusMethodNotAllowed, "Method %s is not allowed.", r.Method))
+			return
+		}
+		h(w, r)
+	}
+}
+
+// decode reads the JSON body of the given request into the given
+// value.
+func decode(w http.ResponseWriter, r *http.Request, v interface{}) error {
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, MaxRequestSize))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		return httpErrorf(http.StatusBadRequest, "Invalid request : %v", err)
+	}
+	return nil
+}
+
+// resolve answers the molecule named by the given target, and a
+// function to call once done with it.  That releases an inline
+// molecule.
+func (s *Server) resolve(t Target) (*molecule.Molecule, func(), error) {
+	switch {
+	case t.Molecule != nil && t.Id != 0:
+		return nil, nil, httpErrorf(http.StatusBadRequest, "Both a molecule ID and a molecule are given.")
+	case t.Molecule != nil:
+		mol, err := build(s.reg, t.Molecule)
+		if err != nil {
+			return nil, nil, err
+		}
+		return mol, mol.Release, nil
+	case t.Id != 0:
+		mol := s.reg.MoleculeWithId(t.Id)
+		if mol == nil {
+			return nil, nil, httpErrorf(http.StatusNotFound, "No molecule with ID %d.", t.Id)
+		}
+		return mol, func() {}, nil
+	}
+	return nil, nil, httpErrorf(http.StatusBadRequest, "No molecule given.")
+}
+
+// create builds the molecule in the request, and retains it in the
+// registry.
+func (s *Server) create(w http.ResponseWriter, r *http.Request) {
+	var jm Molecule
+	if err := decode(w, r, &jm); err != nil {
+		writeError(w, err)
+		return
+	}
+	mol, err := build(s.reg, &jm)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	h, err := mol.Hash128(0)
+	if err != nil {
+		mol.Release()
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, Summary{
+		Id:        mol.Id(),
+		Formula:   mol.Formula(),
+		Weight:    mol.Weight(),
+		AtomCount: mol.AtomCount(),
+		BondCount: mol.BondCount(),
+		Hash:      h.String(),
+	})
+}
+
+// molecules creates a molecule, or lists the IDs of those held.
+func (s *Server) molecules(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPost:
+		s.create(w, r)
+		return
+	case http.MethodGet:
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		writeError(w, httpErrorf(http.StatusMethodNotAllowed, "Method %s is not allowed.", r.Method))
+		return
+	}
+
+	after, limit := uint64(0), DefaultPageSize
+	if v := r.URL.Query().Get("after"); v != "" {
+		n, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			writeError(w, httpErrorf(http.StatusBadRequest, "Invalid molecule ID : %q", v))
+			return
+		}
+		after = n
+	}
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 || n > MaxPageSize {
+			writeError(w, httpErrorf(http.StatusBadRequest, "Invalid limit : %q", v))
+			return
+		}
+		limit = n
+	}
+
+	list := MoleculeList{Ids: []uint64{}}
+	for _, mol := range s.reg.List() {
+		if mol.Id() <= after {
+			continue
+		}
+		if len(list.Ids) == limit {
+			list.More = true
+			break
+		}
+		list.Ids = append(list.Ids, mol.Id())
+	}
+	writeJSON(w, http.StatusOK, list)
+}
+
+// molecule answers, or deletes, the molecule whose ID is in the path.
+func (s *Server) molecule(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseUint(strings.TrimPrefix(r.URL.Path, "/molecules/"), 10, 64)
+	if err != nil {
+		writeError(w, httpErrorf(http.StatusNotFound, "Invalid molecule ID : %q", r.URL.Path))
+		return
+	}
+	mol := s.reg.MoleculeWithId(id)
+	if mol == nil {
+		writeError(w, httpErrorf(http.StatusNotFound, "No molecule with ID %d.", id))
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		jm, err := toJSON(mol)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, jm)
+	case http.MethodDelete:
+		mol.Release()
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.Header().Set("Allow", "GET, DELETE")
+		writeError(w, httpErrorf(http.StatusMethodNotAllowed, "Method %s is not allowed.", r.Method))
+	}
+}
+
+// convert answers the target molecule in the requested format.
+func (s *Server) convert(w http.ResponseWriter, r *http.Request) {
+	var req ConvertRequest
+	if err := decode(w, r, &req); err != nil {
+		writeError(w, err)
+		return
+	}
+	mol, done, err := s.resolve(req.Target)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	defer done()
+
+	switch strings.ToLower(req.Format) {
+	case "", "json":
+		jm, err := toJSON(mol)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, jm)
+	case "sdf", "mol":
+		var buf bytes.Buffer
+		if err := loader.WriteSDF(&buf, mol); err != nil {
+			writeError(w, err)
+			return
+		}
+		w.Header().Set("Content-Type", "chemical/x-mdl-sdfile")
+		w.Write(buf.Bytes())
+	default:
+		writeError(w, httpErrorf(http.StatusBadRequest, "Unknown format : %q", req.Format))
+	}
+}
+
+// canonicalize answers the canonical identifiers of the target
+// molecule.
+func (s *Server) canonicalize(w http.ResponseWriter, r *http.Request) {
+	var t Target
+	if err := decode(w, r, &t); err != nil {
+		writeError(w, err)
+		return
+	}
+	mol, done, err := s.resolve(t)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	defer done()
+
+	h, err := mol.Hash128(0)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	fh, err := mol.Hash128(molecule.HashStereo | molecule.HashIsotopes)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	smi, err := loader.CanonicalSmiles(mol, molecule.HashStereo|molecule.HashIsotopes)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	loose, err := loader.CanonicalSmiles(mol, molecule.HashIsotopes)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, Canonical{mol.Formula(), h.String(), fh.String(), smi, loose})
+}
+
+// descriptors lists the names of the descriptors, or answers the
+// requested descriptors of the target molecule.
+func (s *Server) descriptors(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		names := molecule.DescriptorNames()
+		sort.Strings(names)
+		writeJSON(w, http.StatusOK, names)
+		return
+	case http.MethodPost:
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		writeError(w, httpErrorf(http.StatusMethodNotAllowed, "Method %s is not allowed.", r.Method))
+		return
+	}
+
+	var req DescriptorsRequest
+	if err := decode(w, r, &req); err != nil {
+		writeError(w, err)
+		return
+	}
+	mol, done, err := s.resolve(req.Target)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	defer done()
+
+	names := req.Names
+	if len(names) == 0 {
+		names = molecule.DescriptorNames()
+	}
+	vals := make(map[string]float64, len(names))
+	for _, name := range names {
+		v, err := mol.Descriptor(name)
+		if err != nil {
+			writeError(w, httpErrorf(http.StatusBadRequest, "Descriptor %s : %v", name, err))
+			return
+		}
+		vals[name] = v
+	}
+	writeJSON(w, http.StatusOK, vals)
+}
+
+// substructure answers the occurrences of the query in the target
+// molecule.
+func (s *Server) substructure(w http.ResponseWriter, r *http.Request) {
+	var req SubstructureRequest
+	if err := decode(w, r, &req); err != nil {
+		writeError(w, err)
+		return
+	}
+	mol, done, err := s.resolve(req.Target)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	defer done()
+
+	ms, err := s.matches(mol, &req.Query, req.Max)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if ms == nil {
+		ms = []map[uint16]uint16{}
+	}
+	writeJSON(w, http.StatusOK, SubstructureReply{len(ms), ms})
+}
+
+// matches answers the occurrences of the given query in the given
+// molecule.
+func (s *Server) matches(mol *molecule.Molecule, query *Molecule, max int) ([]map[uint16]uint16, error) {
+	q, err := build(s.reg, query)
+	if err != nil {
+		return nil, err
+	}
+	defer q.Release()
+	return mol.SubstructureMatches(q, max)
+}
+
+// targets answers the molecules with the given IDs, or all those
+// held, if none are given.  Those not held are skipped.
+func (s *Server) targets(ids []uint64) []*molecule.Molecule {
+	if len(ids) == 0 {
+		return s.reg.List()
+	}
+	mols := make([]*molecule.Molecule, 0, len(ids))
+	for _, id := range ids {
+		if mol := s.reg.MoleculeWithId(id); mol != nil {
+			mols = append(mols, mol)
+		}
+	}
+	return mols
+}
+
+// search answers the molecules held that contain the query.
+func (s *Server) search(w http.ResponseWriter, r *http.Request) {
+	var req SearchRequest
+	if err := decode(w, r, &req); err != nil {
+		writeError(w, err)
+		return
+	}
+	// The query is kept out of the registry, lest it be searched too.
+	q, err := build(nil, &req.Query)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	defer q.Release()
+
+	reply := SearchReply{Hits: []SearchHit{}}
+	for _, mol := range s.targets(req.Ids) {
+		if err := r.Context().Err(); err != nil {
+			writeError(w, httpErrorf(http.StatusServiceUnavailable, "Search abandoned : %v", err))
+			return
+		}
+		if req.Limit > 0 && len(reply.Hits) == req.Limit {
+			reply.More = true
+			break
+		}
+
+		ms, err := mol.SubstructureMatches(q, req.Max)
+		if err != nil {
+			// Molecules that exit during the search are skipped.
+			var re *molecule.RequestError
+			if errors.As(err, &re) && re.Status == molecule.StMoleculeExited {
+				continue
+			}
+			writeError(w, fmt.Errorf("Molecule %d : %w", mol.Id(), err))
+			return
+		}
+		if len(ms) > 0 {
+			reply.Hits = append(reply.Hits, SearchHit{mol.Id(), len(ms)})
+		}
+	}
+	writeJSON(w, http.StatusOK, reply)
+}
+
+// bulkDescriptors answers the requested descriptors of the molecules
+// held, or of those named.
+func (s *Server) bulkDescriptors(w http.ResponseWriter, r *http.Request) {
+	var req BulkDescriptorsRequest
+	if err := decode(w, r, &req); err != nil {
+		writeError(w, err)
+		return
+	}
+	names := req.Names
+	if len(names) == 0 {
+		names = molecule.DescriptorNames()
+	}
+	known := make(map[string]bool)
+	for _, name := range molecule.DescriptorNames() {
+		known[name] = true
+	}
+	for _, name := range names {
+		if !known[name] {
+			writeError(w, httpErrorf(http.StatusBadRequest, "Unknown descriptor : %q", name))
+			return
+		}
+	}
+
+	reply := BulkDescriptorsReply{
+		Values: make(map[uint64]map[string]float64),
+		Errors: make(map[uint64]string),
+	}
+	for _, mol := range s.targets(req.Ids) {
+		if err := r.Context().Err(); err != nil {
+			writeError(w, httpErrorf(http.StatusServiceUnavailable, "Descriptors abandoned : %v", err))
+			return
+		}
+
+		vals := make(map[string]float64, len(names))
+		for _, name := range names {
+			v, err := mol.Descriptor(name)
+			if err != nil {
+				reply.Errors[mol.Id()] = fmt.Sprintf("Descriptor %s : %v", name, err)
+				vals = nil
+				break
+			}
+			vals[name] = v
+		}
+		if vals != nil {
+			reply.Values[mol.Id()] = vals
+		}
+	}
+	writeJSON(w, http.StatusOK, reply)
+}
+
+// depict answers a PNG depiction of the target molecule.
+func (s *Server) depict(w http.ResponseWriter, r *http.Request) {
+	var req DepictRequest
+	if err := decode(w, r, &req); err != nil {
+		writeError(w, err)
+		return
+	}
+	mol, done, err := s.resolve(req.Target)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	defer done()
+
+	opts := render.Options{
+		Width:       req.Width,
+		Height:      req.Height,
+		DPI:         req.DPI,
+		BondLength:  req.BondLength,
+		Scale:       req.Scale,
+		Transparent: req.Transparent,
+	}
+	for _, h := range req.Highlights {
+		rh, err := h.highlight()
+		if err != nil {
+			writeError(w, httpErrorf(http.StatusBadRequest, "%v", err))
+			return
+		}
+		opts.Highlights = append(opts.Highlights, rh)
+	}
+	if req.Query != nil {
+		ms, err := s.matches(mol, req.Query, 0)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		for _, m := range ms {
+			h := render.Highlight{Color: render.HighlightColors[0]}
+			for _, iid := range m {
+				h.Atoms = append(h.Atoms, iid)
+			}
+			opts.Highlights = append(opts.Highlights, h)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := render.WritePNG(&buf, mol, opts); err != nil {
+		writeError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "image/png")
+	w.Write(buf.Bytes())
+}
+
+// MetricsPrefix prefixes the names of the metrics answered by
+// `/metrics`.
+const MetricsPrefix = "rxnweaver_registry_"
+
+// registryMetrics answers the metrics of the registry of this server,
+// waiting for its molecules no longer than the request lasts, nor
+// `molecule.MetricsTimeout`.
+func (s *Server) registryMetrics(r *http.Request) molecule.RegistryMetrics {
+	ctx, cancel := context.WithTimeout(r.Context(), molecule.MetricsTimeout)
+	defer cancel()
+	return s.reg.Metrics(ctx)
+}
+
+// registry answers the metrics of the registry of this server.
+func (s *Server) registry(w http.ResponseWriter, r *http.Request) {
+	m := s.registryMetrics(r)
+	writeJSON(w, http.StatusOK, Metrics{
+		Molecules:  m.Molecules,
+		Atoms:      m.Atoms,
+		Bonds:      m.Bonds,
+		Unanswered: m.Unanswered,
+		Goroutines: m.Goroutines,
+		Backlog:    m.Backlog,
+		MaxBacklog: m.MaxBacklog,
+		Saturated:  m.Saturated,
+		Evicted:    m.Evicted,
+	})
+}
+
+// metrics answers the metrics of the registry of this server, for
+// Prometheus.
+func (s *Server) metrics(w http.ResponseWriter, r *http.Request) {
+	m := s.registryMetrics(r)
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	m.WritePrometheus(w, MetricsPrefix)
+}
@@ -0,0 +1,47 @@
+package synthesis
+
+import (
+	"fmt"
+
+	"github.com/RxnWeaver/rxnweaver/data/molecule"
+	"github.com/RxnWeaver/rxnweaver/network"
+)
+
+// Network answers this tree as a reaction network, for export.
+//
+// Each molecule node and each end-point becomes a network node.  Edges
+// point from precursors to end-points, and from end-points to their
+// products, in the forward direction of synthesis.  Molecules are
+// labelled using the given function; their formulae are used when it
+// is `nil`.
+func (t *Tree) Network(label func(*molecule.Molecule) string) *network.Network {
+	if label == nil {
+		label = (*molecule.Molecule).Formula
+	}
+
+	nw := network.New()
+	mc, ec := 0, 0
+
+	var visit func(n *MoleculeNode) string
+	visit = func(n *MoleculeNode) string {
+		mc++
+		mid := fmt.Sprintf("m%d", mc)
+		nw.AddNode(network.Node{Id: mid, Label: label(n.mol), Kind: network.NodeKindMolecule})
+
+		for _, e := range n.endPoints {
+			ec++
+			eid := fmt.Sprintf("r%d", ec)
+			nw.AddNode(network.Node{Id: eid, Label: e.rule, Kind: network.NodeKindReaction})
+			nw.AddEdge(network.Edge{From: eid, To: mid})
+
+			for _, pn := range e.precursors {
+				pid := visit(pn)
+				nw.AddEdge(network.Edge{From: pid, To: eid})
+			}
+		}
+		return mid
+	}
+	visit(t.root)
+
+	return nw
+}
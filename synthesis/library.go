@@ -0,0 +1,187 @@
+package synthesis
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/RxnWeaver/rxnweaver/data/molecule"
+	"github.com/RxnWeaver/rxnweaver/data/reaction"
+)
+
+// RuleSpec is the serialised description of a single transformation
+// in a rule library.
+type RuleSpec struct {
+	Name   string `json:"name"`
+	Smirks string `json:"smirks"`
+
+	// Prior probability of the transformation succeeding, in the range
+	// [0, 1].
+	YieldPrior float64 `json:"yield_prior"`
+
+	// Names of functional groups that must not be present elsewhere in
+	// the substrate for this transformation to be applicable.  A search
+	// rejects the transformation of molecules having them, given a
+	// `Protection` detecting them; see `Library.Incompatibilities`.
+	IncompatibleGroups []string `json:"incompatible_groups,omitempty"`
+}
+
+// Library is a named, versioned collection of rule specifications.
+//
+// The on-disk format is a single JSON object.
+//
+//	{
+//	  "name": "...",
+//	  "version": "...",
+//	  "rules": [
+//	    {"name": "...", "smirks": "...>>...", "yield_prior": 0.8,
+//	     "incompatible_groups": ["..."]},
+//	    ...
+//	  ]
+//	}
+type Library struct {
+	Name    string     `json:"name"`
+	Version string     `json:"version"`
+	Rules   []RuleSpec `json:"rules"`
+}
+
+// LoadLibrary reads a rule library from the given reader, and
+// validates it.
+func LoadLibrary(r io.Reader) (*Library, error) {
+	lib := new(Library)
+	if err := json.NewDecoder(r).Decode(lib); err != nil {
+		return nil, fmt.Errorf("Could not decode rule library : %v", err)
+	}
+
+	if err := lib.Validate(); err != nil {
+		return nil, err
+	}
+	return lib, nil
+}
+
+// Save writes this library to the given writer, in its on-disk
+// format.
+func (lib *Library) Save(w io.Writer) error {
+	b, err := json.MarshalIndent(lib, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(b)
+	return err
+}
+
+// Validate checks every rule in this library, and answers an error
+// listing all the problems found, if any.  Both sides of the SMIRKS of
+// each rule are read as SMARTS; see `reaction.ParseSmirks`.
+func (lib *Library) Validate() error {
+	probs := make([]string, 0)
+	seen := make(map[string]bool)
+
+	for i, rs := range lib.Rules {
+		if rs.Name == "" {
+			probs = append(probs, fmt.Sprintf("rule %d : missing name", i))
+		} else if seen[rs.Name] {
+			probs = append(probs, fmt.Sprintf("rule %d : duplicate name %s", i, rs.Name))
+		}
+		seen[rs.Name] = true
+
+		if t, err := reaction.ParseSmirks(rs.Smirks); err != nil {
+			probs = append(probs, fmt.Sprintf("rule %d : invalid SMIRKS %q : %v", i, rs.Smirks, err))
+		} else {
+			t.Release()
+		}
+
+		if rs.YieldPrior < 0 || rs.YieldPrior > 1 {
+			probs = append(probs, fmt.Sprintf("rule %d : yield prior out of range : %f", i, rs.YieldPrior))
+		}
+
+		for _, g := range rs.IncompatibleGroups {
+			if strings.TrimSpace(g) == "" {
+				probs = append(probs, fmt.Sprintf("rule %d : empty incompatible group", i))
+				break
+			}
+		}
+	}
+
+	if len(probs) > 0 {
+		return fmt.Errorf("Invalid rule library %s : %s", lib.Name, strings.Join(probs, "; "))
+	}
+	return nil
+}
+
+// RuleSpecWithName answers the rule specification with the given
+// name, if one exists.  Answers `nil` otherwise.
+func (lib *Library) RuleSpecWithName(name string) *RuleSpec {
+	for i := range lib.Rules {
+		if lib.Rules[i].Name == name {
+			return &lib.Rules[i]
+		}
+	}
+
+	return nil
+}
+
+// ConfidenceScorer answers a scorer that scores end-points by the
+// yield priors of the rules in this library.
+func (lib *Library) ConfidenceScorer() ConfidenceScorer {
+	cs := ConfidenceScorer{Confidences: make(map[string]float64, len(lib.Rules))}
+	for _, rs := range lib.Rules {
+		cs.Confidences[rs.Name] = rs.YieldPrior
+	}
+	return cs
+}
+
+// Incompatibilities answers the incompatible groups of the rules of
+// this library, by the names of the rules, for
+// `Protection.RuleIncompatible`.
+func (lib *Library) Incompatibilities() map[string][]string {
+	res := make(map[string][]string)
+	for _, rs := range lib.Rules {
+		if len(rs.IncompatibleGroups) > 0 {
+			res[rs.Name] = rs.IncompatibleGroups
+		}
+	}
+	return res
+}
+
+// SmirksRule is a rule applying the SMIRKS of a rule specification in
+// reverse, from its product to its reactants, which are answered as
+// the precursors.  See `reaction.Transform`.
+type SmirksRule struct {
+	name  string
+	retro *reaction.Transform
+}
+
+// NewSmirksRule answers the rule of the given specification, whose
+// SMIRKS must have a single product.  The incompatible groups of the
+// specification are not checked by the rule, but by a search, given a
+// `Protection`; see `Library.Incompatibilities`.
+func NewSmirksRule(rs RuleSpec) (*SmirksRule, error) {
+	t, err := reaction.ParseSmirks(rs.Smirks)
+	if err != nil {
+		return nil, fmt.Errorf("Rule %s : %v", rs.Name, err)
+	}
+	defer t.Release()
+	if n := t.ProductCount(); n != 1 {
+		return nil, fmt.Errorf("Rule %s : expected a single product, given : %d", rs.Name, n)
+	}
+
+	retro, err := t.Reverse()
+	if err != nil {
+		return nil, fmt.Errorf("Rule %s : %v", rs.Name, err)
+	}
+	return &SmirksRule{name: rs.Name, retro: retro}, nil
+}
+
+// Name answers the name of the specification of this rule.
+func (r *SmirksRule) Name() string {
+	return r.name
+}
+
+// Precursors answers the sets of reactants of which the SMIRKS of this
+// rule makes the given molecule, which should have been sanitised.
+func (r *SmirksRule) Precursors(mol *molecule.Molecule) ([][]*molecule.Molecule, error) {
+	return r.retro.Apply([]*molecule.Molecule{mol})
+}
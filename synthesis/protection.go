@@ -0,0 +1,137 @@
+package synthesis
+
+import (
+	"github.com/RxnWeaver/rxnweaver/data/molecule"
+)
+
+// ProtectingGroup describes a group that masks a functional group
+// while a transformation that would otherwise damage it is carried
+// out.
+type ProtectingGroup struct {
+	Name  string // E.g. `Boc'.
+	Group string // Name of the functional group it protects.
+
+	// Protection, applied in reverse to a protected molecule, answers
+	// the unprotected molecule and the protecting reagent.
+	Protection Rule
+	// Deprotection, applied in reverse to an unprotected molecule,
+	// answers its protected form.
+	Deprotection Rule
+
+	// Names of the reaction conditions this group survives.
+	StableUnder []string
+}
+
+// isStableUnder answers if this protecting group survives the given
+// reaction condition.
+func (pg *ProtectingGroup) isStableUnder(cond string) bool {
+	for _, c := range pg.StableUnder {
+		if c == cond {
+			return true
+		}
+	}
+	return false
+}
+
+// Protection holds the information needed to insert protection and
+// deprotection steps into synthesis routes.
+type Protection struct {
+	// Detect answers the names of the functional groups present in
+	// the given molecule.
+	Detect func(mol *molecule.Molecule) []string
+
+	// Conditions maps the name of a rule to the name of the reaction
+	// condition under which it runs (`acidic', `reductive', etc.).
+	Conditions map[string]string
+	// Incompatible maps the name of a reaction condition to the names
+	// of the functional groups it damages.
+	Incompatible map[string][]string
+	// RuleIncompatible maps the name of a rule to the names of the
+	// functional groups it damages, whatever its condition, as the
+	// incompatible groups of the rules of a library do; see
+	// `Library.Incompatibilities`.
+	RuleIncompatible map[string][]string
+
+	Groups []ProtectingGroup // Available protecting groups.
+}
+
+// damagedGroups answers the functional groups of the given molecule
+// that the given rule, or its conditions, would damage.
+func (p *Protection) damagedGroups(mol *molecule.Molecule, r Rule) []string {
+	bad := make(map[string]bool)
+	if cond, ok := p.Conditions[r.Name()]; ok {
+		for _, g := range p.Incompatible[cond] {
+			bad[g] = true
+		}
+	}
+	for _, g := range p.RuleIncompatible[r.Name()] {
+		bad[g] = true
+	}
+	if len(bad) == 0 {
+		return nil
+	}
+
+	dmg := make([]string, 0)
+	for _, g := range p.Detect(mol) {
+		if bad[g] {
+			dmg = append(dmg, g)
+		}
+	}
+	return dmg
+}
+
+// protectingGroupsFor determines how the given rule can be applied to
+// the given molecule.
+//
+// It answers no groups and `true` when no functional group is damaged,
+// and the rule can be applied as is.  It answers a protecting group
+// for each damaged group, in the order detected, and `true` when each
+// has a suitable one: the groups are put on last to first, and taken
+// off first to last, so that each must survive the conditions of the
+// rule, and of taking off those after it.  A rule without a condition
+// damaging groups, as one of incompatible groups, has none survive it.
+// It answers `(nil, false)` otherwise: the rule must not be applied.
+func (p *Protection) protectingGroupsFor(mol *molecule.Molecule, r Rule) ([]*ProtectingGroup, bool) {
+	dmg := p.damagedGroups(mol, r)
+	if len(dmg) == 0 {
+		return nil, true
+	}
+
+	conds := []string{p.Conditions[r.Name()]}
+	pgs := make([]*ProtectingGroup, len(dmg))
+	for k := len(dmg) - 1; k >= 0; k-- {
+	groups:
+		for i := range p.Groups {
+			pg := &p.Groups[i]
+			if pg.Group != dmg[k] || pg.Deprotection == nil {
+				continue
+			}
+			for _, c := range conds {
+				if !pg.isStableUnder(c) {
+					continue groups
+				}
+			}
+			pgs[k] = pg
+			break
+		}
+		if pgs[k] == nil {
+			return nil, false
+		}
+		if c, ok := p.Conditions[pgs[k].Deprotection.Name()]; ok {
+			conds = append(conds, c)
+		}
+	}
+	return pgs, true
+}
+
+// protectionRules answers the protection rules of all protecting
+// groups, for inclusion in a search's rule set.
+func (p *Protection) protectionRules() []Rule {
+	rules := make([]Rule, 0, len(p.Groups))
+	for _, pg := range p.Groups {
+		if pg.Protection != nil {
+			rules = append(rules, pg.Protection)
+		}
+	}
+	return rules
+}
@@ -0,0 +1,49 @@
+package synthesis
+
+// Pruner decides which of the scored candidate end-points of a
+// molecule node are retained for further expansion.
+//
+// The candidates given are already sorted in descending order of
+// score, those scoring alike in the order of the rules that made them.
+type Pruner interface {
+	Prune(cands []*EndPoint) []*EndPoint
+}
+
+// BeamPruner retains at most a fixed number of the best candidates.
+type BeamPruner struct {
+	Width int
+}
+
+// Prune answers the best `Width` candidates.
+func (p BeamPruner) Prune(cands []*EndPoint) []*EndPoint {
+	if p.Width > 0 && len(cands) > p.Width {
+		return cands[:p.Width]
+	}
+	return cands
+}
+
+// GreedyPruner retains only the best candidate.  This yields a
+// single route, found quickly.
+type GreedyPruner struct{}
+
+// Prune answers the best candidate, if any.
+func (p GreedyPruner) Prune(cands []*EndPoint) []*EndPoint {
+	return BeamPruner{1}.Prune(cands)
+}
+
+// ThresholdPruner retains every candidate whose score is at least the
+// given minimum.  It is of use only with a `Scorer`, which a search
+// requires of it.
+type ThresholdPruner struct {
+	MinScore float64
+}
+
+// Prune answers the candidates scoring at least `MinScore`.
+func (p ThresholdPruner) Prune(cands []*EndPoint) []*EndPoint {
+	for i, e := range cands {
+		if e.score < p.MinScore {
+			return cands[:i]
+		}
+	}
+	return cands
+}
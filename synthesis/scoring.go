@@ -0,0 +1,83 @@
+package synthesis
+
+import (
+	"github.com/RxnWeaver/rxnweaver/data/molecule"
+)
+
+// StepScorer penalises end-points in proportion to the number of
+// steps between them and the goal molecule.  Used in combination with
+// other scorers, it favours shorter routes.
+type StepScorer struct{}
+
+// Score answers the negated number of steps up to and including the
+// given end-point.
+func (s StepScorer) Score(e *EndPoint) float64 {
+	return -float64(e.product.depth + 1)
+}
+
+// ComplexityScorer favours end-points that simplify the product the
+// most.
+//
+// The complexity of a molecule is approximated by its number of heavy
+// atoms.  The score is the difference between the complexity of the
+// product and that of its most complex precursor.
+type ComplexityScorer struct{}
+
+// Score answers the complexity reduction effected by the given
+// end-point.
+func (s ComplexityScorer) Score(e *EndPoint) float64 {
+	max := 0
+	for _, pn := range e.precursors {
+		if c := complexity(pn.mol); c > max {
+			max = c
+		}
+	}
+
+	return float64(complexity(e.product.mol) - max)
+}
+
+// complexity answers the number of heavy atoms in the given molecule.
+func complexity(mol *molecule.Molecule) int {
+	n := 0
+	for atNum, c := range mol.ElementCounts() {
+		if atNum != 1 {
+			n += c
+		}
+	}
+	return n
+}
+
+// ConfidenceScorer scores end-points by the confidence attached to
+// the rules that produced them.
+type ConfidenceScorer struct {
+	Confidences map[string]float64 // Rule name -> confidence.
+	Default     float64            // For rules not in the map.
+}
+
+// Score answers the confidence of the rule of the given end-point.
+func (s ConfidenceScorer) Score(e *EndPoint) float64 {
+	if c, ok := s.Confidences[e.rule]; ok {
+		return c
+	}
+	return s.Default
+}
+
+// WeightedScorer combines several scorers, as a weighted sum of their
+// individual scores.
+type WeightedScorer struct {
+	Scorers []Scorer
+	Weights []float64 // One per scorer.
+}
+
+// Score answers the weighted sum of the scores of the given end-point.
+func (s WeightedScorer) Score(e *EndPoint) float64 {
+	sum := 0.0
+	for i, sc := range s.Scorers {
+		w := 1.0
+		if i < len(s.Weights) {
+			w = s.Weights[i]
+		}
+		sum += w * sc.Score(e)
+	}
+	return sum
+}
@@ -0,0 +1,300 @@
+package synthesis
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/RxnWeaver/rxnweaver/data/molecule"
+)
+
+// Rule is a transformation that can be applied in reverse to a
+// product molecule.
+//
+// Each set of precursors answered represents one way of making the
+// given molecule.  A rule that does not apply answers an empty list,
+// not an error.
+type Rule interface {
+	Name() string
+	Precursors(mol *molecule.Molecule) ([][]*molecule.Molecule, error)
+}
+
+// Scorer assigns a score to a candidate end-point.  Higher scores are
+// better.
+type Scorer interface {
+	Score(e *EndPoint) float64
+}
+
+// Options configures a retro-synthesis search.
+type Options struct {
+	MaxDepth int // Maximum number of steps from the goal; `0` for no limit.
+	MaxWidth int // Maximum end-points retained per molecule; `0` for no limit.
+
+	// Scorer is optional.  Without one, every end-point scores `0`,
+	// and candidates are ranked in the order of the rules.
+	Scorer Scorer
+
+	// Pruner is optional, and applied after `MaxWidth`, which is a
+	// shorthand for a `BeamPruner`.  A `ThresholdPruner` needs a
+	// `Scorer`.
+	Pruner Pruner
+
+	// Stock, when given, terminates branches at molecules that are
+	// available as building blocks.
+	Stock Stock
+
+	// Protection, when given, guards functional groups that a rule's
+	// conditions would damage, by inserting protection steps.
+	Protection *Protection
+
+	// Progress, when given, is invoked after each molecule node is
+	// expanded.
+	Progress func(n *MoleculeNode)
+}
+
+// Search applies a library of rules in reverse to a goal molecule,
+// building a synthesis tree of its precursors.
+type Search struct {
+	rules []Rule
+	opts  Options
+}
+
+// NewSearch creates a search that uses the given rules, configured
+// by the given options.
+func NewSearch(rules []Rule, opts Options) *Search {
+	rs := make([]Rule, len(rules))
+	copy(rs, rules)
+	if opts.Protection != nil {
+		rs = append(rs, opts.Protection.protectionRules()...)
+	}
+
+	return &Search{rs, opts}
+}
+
+// Run performs a breadth-first expansion starting with the given goal
+// molecule, and answers the resulting tree.
+//
+// Each set of precursors is expanded but once: an end-point whose
+// precursors, as identified by their canonical structure hashes, were
+// met before, the goal included, is kept in the tree, but its
+// precursors are left as leaves.  Thus, rules that undo one another
+// do not make the search run forever, even without a `MaxDepth`.
+// Such leaves are still looked up in the stock, as every node is, when
+// made, so that an end-point whose precursors are all in stock is
+// solved, however often they were met.
+//
+// Should any rule fail on a molecule, that rule is skipped for that
+// molecule, and the search continues.  The first such failure is
+// answered along with the tree.
+func (s *Search) Run(goal *molecule.Molecule) (*Tree, error) {
+	if goal == nil {
+		return nil, fmt.Errorf("No goal molecule given.")
+	}
+	if _, ok := s.opts.Pruner.(ThresholdPruner); ok && s.opts.Scorer == nil {
+		return nil, fmt.Errorf("A threshold pruner needs a scorer.")
+	}
+
+	t := new(Tree)
+	t.root = s.newNode(goal, 0)
+	t.nodeCount = 1
+
+	k, err := precursorKey([]*MoleculeNode{t.root})
+	if err != nil {
+		return nil, err
+	}
+	seen := map[string]bool{k: true} // Precursor sets met, by their keys.
+
+	var firstErr error
+	queue := []*MoleculeNode{t.root}
+	for len(queue) > 0 {
+		n := queue[0]
+		queue = queue[1:]
+
+		if n.inStock {
+			continue
+		}
+		if s.opts.MaxDepth > 0 && n.depth >= s.opts.MaxDepth {
+			continue
+		}
+
+		if !n.expanded {
+			err := s.expand(n)
+			if err != nil && firstErr == nil {
+				firstErr = err
+			}
+		}
+
+		for _, e := range n.endPoints {
+			t.nodeCount += len(e.precursors)
+			k, err := precursorKey(e.precursors)
+			if err != nil {
+				if firstErr == nil {
+					firstErr = err
+				}
+				continue
+			}
+			if seen[k] {
+				continue
+			}
+			seen[k] = true
+			queue = append(queue, e.precursors...)
+		}
+
+		if s.opts.Progress != nil {
+			s.opts.Progress(n)
+		}
+	}
+
+	return t, firstErr
+}
+
+// precursorKey answers the key of the given set of precursors: the
+// canonical structure hashes of their molecules, stereochemistry and
+// isotopes included, in ascending order.
+func precursorKey(ns []*MoleculeNode) (string, error) {
+	hs := make([]string, len(ns))
+	for i, n := range ns {
+		h, err := n.mol.Hash128(molecule.HashStereo | molecule.HashIsotopes)
+		if err != nil {
+			return "", fmt.Errorf("Molecule %d : %v", n.mol.Id(), err)
+		}
+		hs[i] = string(h[:])
+	}
+	sort.Strings(hs)
+	return strings.Join(hs, ""), nil
+}
+
+// newNode answers a new node for the given molecule, at the given
+// depth, looked up in the stock, if any.
+func (s *Search) newNode(mol *molecule.Molecule, depth int) *MoleculeNode {
+	n := newMoleculeNode(mol, depth)
+	n.inStock = s.opts.Stock != nil && s.opts.Stock.Contains(mol)
+	return n
+}
+
+// expand applies every rule in reverse to the molecule of the given
+// node, and attaches the best of the resulting end-points to it.
+func (s *Search) expand(n *MoleculeNode) error {
+	var firstErr error
+	cands := make([]*EndPoint, 0, len(s.rules))
+
+	for _, r := range s.rules {
+		es, err := s.candidates(n, r)
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+		cands = append(cands, es...)
+	}
+
+	s.attach(n, cands)
+	return firstErr
+}
+
+// attach ranks the given candidate end-points of the given node,
+// prunes them, and attaches those retained to it.
+func (s *Search) attach(n *MoleculeNode, cands []*EndPoint) {
+	sort.Stable(byScore(cands))
+	if s.opts.MaxWidth > 0 {
+		cands = BeamPruner{s.opts.MaxWidth}.Prune(cands)
+	}
+	if s.opts.Pruner != nil {
+		cands = s.opts.Pruner.Prune(cands)
+	}
+
+	for _, e := range cands {
+		for _, pn := range e.precursors {
+			pn.parents = append(pn.parents, e)
+		}
+		n.endPoints = append(n.endPoints, e)
+	}
+
+	n.expanded = true
+}
+
+// candidates answers the end-points obtained by applying the given
+// rule in reverse to the molecule of the given node, taking
+// protection of functional groups into account.
+func (s *Search) candidates(n *MoleculeNode, r Rule) ([]*EndPoint, error) {
+	if s.opts.Protection == nil {
+		return s.endPoints(n, r)
+	}
+
+	pgs, ok := s.opts.Protection.protectingGroupsFor(n.mol, r)
+	switch {
+	case !ok:
+		return []*EndPoint{}, nil // Rule would damage an unprotectable group.
+	case len(pgs) == 0:
+		return s.endPoints(n, r)
+	}
+	return s.protectedEndPoints(n, r, pgs)
+}
+
+// endPoints applies the given rule in reverse to the molecule of the
+// given node, and answers the scored end-points, one per set of
+// precursors.  They are not yet attached to the node.
+func (s *Search) endPoints(n *MoleculeNode, r Rule) ([]*EndPoint, error) {
+	sets, err := r.Precursors(n.mol)
+	if err != nil {
+		return nil, fmt.Errorf("Rule %s failed on molecule %d : %v", r.Name(), n.mol.Id(), err)
+	}
+
+	es := make([]*EndPoint, 0, len(sets))
+	for _, set := range sets {
+		e := &EndPoint{product: n, rule: r.Name()}
+		e.precursors = make([]*MoleculeNode, len(set))
+		for i, pm := range set {
+			e.precursors[i] = s.newNode(pm, n.depth+1)
+		}
+		if s.opts.Scorer != nil {
+			e.score = s.opts.Scorer.Score(e)
+		}
+		es = append(es, e)
+	}
+
+	return es, nil
+}
+
+// protectedEndPoints answers the end-points that make the molecule of
+// the given node by taking off the first of the given protecting
+// groups from its protected form, which in turn is made by taking off
+// the rest, and, at last, by the given rule.
+//
+// The protected forms are new nodes, already expanded thus, within the
+// maximum depth, their end-points ranked and pruned as those of any
+// node.
+func (s *Search) protectedEndPoints(n *MoleculeNode, r Rule, pgs []*ProtectingGroup) ([]*EndPoint, error) {
+	des, err := s.endPoints(n, pgs[0].Deprotection)
+	if err != nil {
+		return nil, err
+	}
+
+	var firstErr error
+	for _, de := range des {
+		for _, pn := range de.precursors {
+			if pn.inStock || (s.opts.MaxDepth > 0 && pn.depth >= s.opts.MaxDepth) {
+				continue
+			}
+
+			var es []*EndPoint
+			var err error
+			if len(pgs) > 1 {
+				es, err = s.protectedEndPoints(pn, r, pgs[1:])
+			} else {
+				es, err = s.endPoints(pn, r)
+			}
+			if err != nil && firstErr == nil {
+				firstErr = err
+			}
+			s.attach(pn, es)
+		}
+	}
+
+	return des, firstErr
+}
+
+// byScore sorts end-points in descending order of their scores.
+type byScore []*EndPoint
+
+func (s byScore) Len() int           { return len(s) }
+func (s byScore) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s byScore) Less(i, j int) bool { return s[i].score > s[j].score }
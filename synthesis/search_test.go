@@ -0,0 +1,254 @@
+package synthesis_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/RxnWeaver/rxnweaver/data/loader"
+	"github.com/RxnWeaver/rxnweaver/data/molecule"
+	"github.com/RxnWeaver/rxnweaver/synthesis"
+)
+
+// readSmiles answers the sanitised passive molecule of the given SMILES
+// string.
+func readSmiles(t *testing.T, smi string) *molecule.Molecule {
+	t.Helper()
+	mol, err := loader.ReadSmiles(nil, []byte(smi))
+	if err != nil {
+		t.Fatalf("%s : %v", smi, err)
+	}
+	rep, err := molecule.Sanitize(mol, 0)
+	if err == nil && rep.HasErrors() {
+		err = rep
+	}
+	if err != nil {
+		t.Fatalf("%s : %v", smi, err)
+	}
+	return mol
+}
+
+// canonical answers the canonical SMILES string of the given molecule.
+func canonical(mol *molecule.Molecule) string {
+	smi, _ := loader.CanonicalSmiles(mol, 0)
+	return smi
+}
+
+// _TableRule is a rule answering the precursors listed for each
+// product, all by their SMILES strings.
+type _TableRule struct {
+	t     *testing.T
+	name  string
+	table map[string][][]string
+}
+
+func (r _TableRule) Name() string { return r.name }
+
+func (r _TableRule) Precursors(mol *molecule.Molecule) ([][]*molecule.Molecule, error) {
+	res := [][]*molecule.Molecule{}
+	for smi, sets := range r.table {
+		if canonical(readSmiles(r.t, smi)) != canonical(mol) {
+			continue
+		}
+		for _, set := range sets {
+			ms := make([]*molecule.Molecule, len(set))
+			for i, p := range set {
+				ms[i] = readSmiles(r.t, p)
+			}
+			res = append(res, ms)
+		}
+	}
+	return res, nil
+}
+
+// stockOf answers a stock of the given molecules.
+func stockOf(t *testing.T, smis ...string) *synthesis.KeyedStock {
+	st := synthesis.NewKeyedStock(canonical)
+	for _, smi := range smis {
+		st.AddMolecule(readSmiles(t, smi))
+	}
+	return st
+}
+
+func TestSearchSolved(t *testing.T) {
+	amide := map[string][][]string{"CC(=O)NC": {{"CC(=O)O", "CN"}}}
+	tests := []struct {
+		name     string
+		rules    []synthesis.Rule
+		stock    []string
+		maxDepth int
+		solved   int // End-points of the goal solved.
+	}{
+		{"in stock", []synthesis.Rule{_TableRule{t, "amide", amide}}, []string{"CC(=O)O", "CN"}, 0, 1},
+		{"not in stock", []synthesis.Rule{_TableRule{t, "amide", amide}}, []string{"CC(=O)O"}, 0, 0},
+		{"same precursors twice", []synthesis.Rule{
+			_TableRule{t, "amide", amide},
+			_TableRule{t, "amide again", amide},
+		}, []string{"CC(=O)O", "CN"}, 0, 2},
+		{"two steps", []synthesis.Rule{
+			_TableRule{t, "amide", amide},
+			_TableRule{t, "oxidation", map[string][][]string{"CC(=O)O": {{"CCO"}}}},
+		}, []string{"CCO", "CN"}, 0, 1},
+		{"two steps, too deep", []synthesis.Rule{
+			_TableRule{t, "amide", amide},
+			_TableRule{t, "oxidation", map[string][][]string{"CC(=O)O": {{"CCO"}}}},
+		}, []string{"CCO", "CN"}, 1, 0},
+	}
+	for _, tt := range tests {
+		s := synthesis.NewSearch(tt.rules, synthesis.Options{
+			MaxDepth: tt.maxDepth,
+			Stock:    stockOf(t, tt.stock...),
+		})
+		tree, err := s.Run(readSmiles(t, "CC(=O)NC"))
+		if err != nil {
+			t.Fatalf("%s : %v", tt.name, err)
+		}
+		solved := 0
+		for _, e := range tree.Root().EndPoints() {
+			if e.IsSolved() {
+				solved++
+			}
+		}
+		if solved != tt.solved {
+			t.Errorf("%s : %d end-points solved, want %d", tt.name, solved, tt.solved)
+		}
+		if root := tree.Root(); root.IsSolved() != (tt.solved > 0) {
+			t.Errorf("%s : goal solved %v", tt.name, root.IsSolved())
+		}
+	}
+}
+
+func TestSearchProtection(t *testing.T) {
+	const (
+		goal    = "NCCO"
+		boc     = "CC(C)(C)OC(=O)NCCO"
+		bocTms  = "CC(C)(C)OC(=O)NCCO[Si](C)(C)C"
+		acid    = "CC(C)(C)OC(=O)NCC(=O)O"
+		acidTms = "NCC(=O)O[Si](C)(C)C"
+	)
+	groups := map[string][]string{canonical(readSmiles(t, goal)): {"amine", "alcohol"}}
+	detect := func(mol *molecule.Molecule) []string { return groups[canonical(mol)] }
+	reduction := _TableRule{t, "reduction", map[string][][]string{bocTms: {{acid}, {acidTms}}}}
+	protection := func(chain bool) *synthesis.Protection {
+		p := &synthesis.Protection{
+			Detect:       detect,
+			Conditions:   map[string]string{"reduction": "reductive", "TMS removal": "fluoride"},
+			Incompatible: map[string][]string{"reductive": {"amine", "alcohol"}},
+			Groups: []synthesis.ProtectingGroup{
+				{Name: "Boc", Group: "amine", StableUnder: []string{"reductive", "fluoride"},
+					Deprotection: _TableRule{t, "Boc removal", map[string][][]string{goal: {{boc}}}}},
+				{Name: "TMS", Group: "alcohol", StableUnder: []string{"reductive"},
+					Deprotection: _TableRule{t, "TMS removal", map[string][][]string{boc: {{bocTms}}}}},
+			},
+		}
+		if !chain {
+			p.Groups[0].StableUnder = []string{"reductive"}
+		}
+		return p
+	}
+	tests := []struct {
+		name     string
+		chain    bool // Is Boc stable under the removal of TMS?
+		maxDepth int
+		pruner   synthesis.Pruner
+		maxWidth int
+		route    []string // Rules from the goal, following the first end-points.
+		leaves   int      // End-points of the deepest protected form.
+	}{
+		{"two groups", true, 0, nil, 0, []string{"Boc removal", "TMS removal", "reduction"}, 2},
+		{"not orthogonal", false, 0, nil, 0, nil, 0},
+		{"too deep", true, 2, nil, 0, []string{"Boc removal", "TMS removal"}, 0},
+		{"pruned", true, 0, synthesis.GreedyPruner{}, 0, []string{"Boc removal", "TMS removal", "reduction"}, 1},
+		{"narrow", true, 0, nil, 1, []string{"Boc removal", "TMS removal", "reduction"}, 1},
+	}
+	for _, tt := range tests {
+		s := synthesis.NewSearch([]synthesis.Rule{reduction}, synthesis.Options{
+			MaxDepth:   tt.maxDepth,
+			MaxWidth:   tt.maxWidth,
+			Pruner:     tt.pruner,
+			Protection: protection(tt.chain),
+		})
+		tree, err := s.Run(readSmiles(t, goal))
+		if err != nil {
+			t.Fatalf("%s : %v", tt.name, err)
+		}
+		route := []string(nil)
+		n := tree.Root()
+		for len(n.EndPoints()) > 0 {
+			e := n.EndPoints()[0]
+			route = append(route, e.Rule())
+			n = e.Precursors()[0]
+		}
+		if strings.Join(route, ", ") != strings.Join(tt.route, ", ") {
+			t.Errorf("%s : route %v, want %v", tt.name, route, tt.route)
+		}
+		if len(tt.route) < 2 {
+			continue
+		}
+		pn := tree.Root().EndPoints()[0].Precursors()[0].EndPoints()[0].Precursors()[0]
+		if got := len(pn.EndPoints()); got != tt.leaves {
+			t.Errorf("%s : %d end-points of %s, want %d", tt.name, got, canonical(pn.Molecule()), tt.leaves)
+		}
+	}
+}
+
+func TestSearchIncompatibleGroups(t *testing.T) {
+	lib := &synthesis.Library{Name: "test", Version: "1", Rules: []synthesis.RuleSpec{{
+		Name:               "amide coupling",
+		Smirks:             "[C:1](=[O:2])-[OH].[N;H2:3]>>[C:1](=[O:2])-[N:3]",
+		YieldPrior:         0.9,
+		IncompatibleGroups: []string{"alcohol"},
+	}}}
+	if err := lib.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	rule, err := synthesis.NewSmirksRule(lib.Rules[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	alcohol, err := loader.ReadSmarts("[O;H1]-[C;X4]")
+	if err != nil {
+		t.Fatal(err)
+	}
+	detect := func(mol *molecule.Molecule) []string {
+		if ms, err := mol.QueryMaps(alcohol, 1); err == nil && len(ms) > 0 {
+			return []string{"alcohol"}
+		}
+		return nil
+	}
+	tms := synthesis.ProtectingGroup{Name: "TMS", Group: "alcohol", StableUnder: []string{"amide coupling"},
+		Deprotection: _TableRule{t, "TMS removal", map[string][][]string{"CC(=O)NCCO": {{"CC(=O)NCCO[Si](C)(C)C"}}}}}
+	tests := []struct {
+		name       string
+		goal       string
+		protection *synthesis.Protection
+		route      []string
+	}{
+		{"no alcohol", "CC(=O)NCC", &synthesis.Protection{Detect: detect}, []string{"amide coupling"}},
+		{"alcohol", "CC(=O)NCCO", &synthesis.Protection{Detect: detect}, nil},
+		{"alcohol, unchecked", "CC(=O)NCCO", nil, []string{"amide coupling"}},
+		{"alcohol, protected", "CC(=O)NCCO", &synthesis.Protection{
+			Detect:     detect,
+			Conditions: map[string]string{"amide coupling": "amide coupling"},
+			Groups:     []synthesis.ProtectingGroup{tms},
+		}, []string{"TMS removal", "amide coupling"}},
+	}
+	for _, tt := range tests {
+		if tt.protection != nil {
+			tt.protection.RuleIncompatible = lib.Incompatibilities()
+		}
+		s := synthesis.NewSearch([]synthesis.Rule{rule}, synthesis.Options{Protection: tt.protection})
+		tree, err := s.Run(readSmiles(t, tt.goal))
+		if err != nil {
+			t.Fatalf("%s : %v", tt.name, err)
+		}
+		route := []string(nil)
+		for n := tree.Root(); len(n.EndPoints()) > 0; {
+			e := n.EndPoints()[0]
+			route = append(route, e.Rule())
+			n = e.Precursors()[0]
+		}
+		if strings.Join(route, ", ") != strings.Join(tt.route, ", ") {
+			t.Errorf("%s : route %v, want %v", tt.name, route, tt.route)
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package synthesis
+
+import (
+	"sync"
+
+	"github.com/RxnWeaver/rxnweaver/data/molecule"
+)
+
+// Stock answers if a given molecule is available as a building block,
+// and hence need not be synthesised.
+type Stock interface {
+	Contains(mol *molecule.Molecule) bool
+}
+
+// KeyedStock is an in-memory stock of building blocks, identified by
+// string keys such as canonical SMILES or InChIKeys.
+//
+// The function that answers the key of a given molecule is supplied
+// at construction, so that the same stock can be used with any
+// identity scheme.  It is safe for concurrent use.
+type KeyedStock struct {
+	mu   sync.RWMutex
+	key  func(*molecule.Molecule) string
+	keys map[string]bool
+}
+
+// NewKeyedStock creates an empty stock that identifies molecules using
+// the given key function.
+func NewKeyedStock(key func(*molecule.Molecule) string) *KeyedStock {
+	return &KeyedStock{key: key, keys: make(map[string]bool)}
+}
+
+// Add adds the given keys to this stock.
+func (s *KeyedStock) Add(keys ...string) *KeyedStock {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, k := range keys {
+		s.keys[k] = true
+	}
+	return s
+}
+
+// AddMolecule adds the given molecule to this stock.
+func (s *KeyedStock) AddMolecule(mol *molecule.Molecule) *KeyedStock {
+	return s.Add(s.key(mol))
+}
+
+// Size answers the number of distinct building blocks in this stock.
+func (s *KeyedStock) Size() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return len(s.keys)
+}
+
+// Contains answers if the given molecule is in this stock.
+func (s *KeyedStock) Contains(mol *molecule.Molecule) bool {
+	k := s.key(mol)
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.keys[k]
+}
@@ -0,0 +1,155 @@
+package synthesis
+
+import (
+	"github.com/RxnWeaver/rxnweaver/data/molecule"
+)
+
+// MoleculeNode represents a single molecule in a synthesis tree.
+//
+// It is an `OR' node: each of its end-points is an alternative way of
+// synthesising this molecule.  A node with no end-points is a leaf.
+type MoleculeNode struct {
+	mol   *molecule.Molecule // The molecule this node represents.
+	depth int                // Number of steps from the root.
+
+	inStock  bool // Is this molecule available as a building block?
+	expanded bool // Have the rules been applied to this molecule?
+
+	parents   []*EndPoint // End-points that consume this molecule.
+	endPoints []*EndPoint // Alternative incoming syntheses.
+}
+
+// newMoleculeNode creates and initialises a node for the given
+// molecule, at the given depth.
+func newMoleculeNode(mol *molecule.Molecule, depth int) *MoleculeNode {
+	n := new(MoleculeNode)
+	n.mol = mol
+	n.depth = depth
+
+	n.parents = make([]*EndPoint, 0, 1)
+	n.endPoints = make([]*EndPoint, 0, 1)
+
+	return n
+}
+
+// Molecule answers the molecule this node represents.
+func (n *MoleculeNode) Molecule() *molecule.Molecule {
+	return n.mol
+}
+
+// Depth answers the number of synthesis steps between this node and
+// the root.  The root has a depth of `0`.
+func (n *MoleculeNode) Depth() int {
+	return n.depth
+}
+
+// IsRoot answers if this node represents the goal molecule.
+func (n *MoleculeNode) IsRoot() bool {
+	return len(n.parents) == 0
+}
+
+// IsLeaf answers if this node has no incoming syntheses.
+func (n *MoleculeNode) IsLeaf() bool {
+	return len(n.endPoints) == 0
+}
+
+// IsInStock answers if this molecule was found in the stock of
+// building blocks during search.
+func (n *MoleculeNode) IsInStock() bool {
+	return n.inStock
+}
+
+// IsSolved answers if this molecule can be made entirely from
+// building blocks in stock: either it is in stock itself, or at least
+// one of its end-points has all of its precursors solved.
+func (n *MoleculeNode) IsSolved() bool {
+	if n.inStock {
+		return true
+	}
+
+	for _, e := range n.endPoints {
+		if e.IsSolved() {
+			return true
+		}
+	}
+	return false
+}
+
+// Parents answers the end-points in which this molecule is a
+// precursor.
+func (n *MoleculeNode) Parents() []*EndPoint {
+	return n.parents
+}
+
+// EndPoints answers the alternative syntheses of this molecule, in
+// descending order of score.
+func (n *MoleculeNode) EndPoints() []*EndPoint {
+	return n.endPoints
+}
+
+// EndPoint represents one application of a rule that produces a
+// molecule from its precursors.
+//
+// It is an `AND' node: all of its precursors are needed for the
+// synthesis to proceed.  An end-point with exactly one precursor is a
+// linear synthesis end-point; one with more is convergent.
+type EndPoint struct {
+	product    *MoleculeNode   // Molecule produced.
+	rule       string          // Name of the rule applied.
+	precursors []*MoleculeNode // Molecules consumed.
+	score      float64         // As assigned by the search's scorer.
+}
+
+// Product answers the molecule node produced by this end-point.
+func (e *EndPoint) Product() *MoleculeNode {
+	return e.product
+}
+
+// Rule answers the name of the rule whose application resulted in
+// this end-point.
+func (e *EndPoint) Rule() string {
+	return e.rule
+}
+
+// Precursors answers the molecule nodes consumed by this end-point.
+func (e *EndPoint) Precursors() []*MoleculeNode {
+	return e.precursors
+}
+
+// Score answers the score assigned to this end-point during search.
+func (e *EndPoint) Score() float64 {
+	return e.score
+}
+
+// IsConvergent answers if this end-point has more than one incoming
+// path.
+func (e *EndPoint) IsConvergent() bool {
+	return len(e.precursors) > 1
+}
+
+// IsSolved answers if all precursors of this end-point are solved.
+func (e *EndPoint) IsSolved() bool {
+	for _, pn := range e.precursors {
+		if !pn.IsSolved() {
+			return false
+		}
+	}
+	return true
+}
+
+// Tree is the result of a retro-synthesis search for a single goal
+// molecule.
+type Tree struct {
+	root      *MoleculeNode // Goal molecule.
+	nodeCount int           // Total number of molecule nodes.
+}
+
+// Root answers the node representing the goal molecule.
+func (t *Tree) Root() *MoleculeNode {
+	return t.root
+}
+
+// NodeCount answers the total number of molecule nodes in this tree.
+func (t *Tree) NodeCount() int {
+	return t.nodeCount
+}